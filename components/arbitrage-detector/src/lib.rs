@@ -0,0 +1,369 @@
+mod trigger;
+mod venues;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_primitives::U256;
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    fan_out::FanOut,
+    fixed_point::{self, Rounding},
+    output::{self, Computed},
+    panic_guard,
+};
+use serde::{Deserialize, Serialize};
+use venues::{Book, Pair, Venue};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["spread"];
+
+/// Venues compared, overridable with `arb_venues`
+const DEFAULT_VENUES: &str = "binance,coinbase,kraken,okx";
+
+/// Smallest spread published, overridable with `arb_min_spread_bps`
+const DEFAULT_MIN_SPREAD_BPS: u32 = 25;
+
+/// Quote units bought and sold to price each side, overridable with
+/// `arb_notional`, so a spread only counts if it survives that much depth
+const DEFAULT_NOTIONAL: u64 = 10_000;
+
+/// Decimals of the fixed-point prices
+const PRICE_DECIMALS: u8 = 18;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let pair = Pair::parse(input.trim_end_matches('\0')).map_err(|e| e.to_string())?;
+    println!("pair: {}", pair);
+
+    let config = ArbConfig::from_env().map_err(|e| e.to_string())?;
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(detect(&ctx, &config, &pair))?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("arbitrage:{}", report.pair);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::ArbitrageSignal {
+                    pair: report.pair.clone(),
+                    timestamp: report.timestamp,
+                    decimals: PRICE_DECIMALS,
+                    notional: report.notional,
+                    opportunities: report
+                        .opportunities
+                        .iter()
+                        .map(|o| solidity::Opportunity {
+                            buyVenue: o.buy_venue.to_string(),
+                            sellVenue: o.sell_venue.to_string(),
+                            buyPrice: o.buy_price,
+                            sellPrice: o.sell_price,
+                            spreadBps: o.spread_bps,
+                        })
+                        .collect(),
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+struct ArbConfig {
+    venues: Vec<Venue>,
+    min_spread_bps: u32,
+    notional: u64,
+    /// Taker fee paid on each leg
+    fee_bps: u32,
+}
+
+impl ArbConfig {
+    fn from_env() -> anyhow::Result<Self> {
+        let mut venues = config::list("arb_venues")
+            .unwrap_or_else(|| DEFAULT_VENUES.split(',').map(String::from).collect())
+            .iter()
+            .map(|v| v.parse())
+            .collect::<anyhow::Result<Vec<Venue>>>()?;
+        venues.sort_by_key(|v| v.as_str());
+        venues.dedup();
+        if venues.len() < 2 {
+            return Err(anyhow::anyhow!("arb_venues needs at least two venues"));
+        }
+        let notional = config::parse_or("arb_notional", DEFAULT_NOTIONAL)?;
+        if notional == 0 {
+            return Err(anyhow::anyhow!("arb_notional must be positive"));
+        }
+        Ok(Self {
+            venues,
+            min_spread_bps: config::parse_or("arb_min_spread_bps", DEFAULT_MIN_SPREAD_BPS)?,
+            notional,
+            fee_bps: config::parse_or("arb_fee_bps", 0)?,
+        })
+    }
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct VenueQuote {
+    venue: Venue,
+    /// Average price of buying the notional, `None` when the book is too thin
+    buy_price: Option<U256>,
+    /// Average price of selling the notional
+    sell_price: Option<U256>,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct Opportunity {
+    buy_venue: Venue,
+    sell_venue: Venue,
+    buy_price: U256,
+    sell_price: U256,
+    /// After fees on both legs, rounded down
+    spread_bps: u32,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct SpreadReport {
+    pair: String,
+    /// Unix seconds the books were read at
+    timestamp: u64,
+    /// Quote units each side was priced for
+    notional: u64,
+    min_spread_bps: u32,
+    /// Venues that answered, in name order
+    venues: Vec<VenueQuote>,
+    /// Widest spread first
+    opportunities: Vec<Opportunity>,
+}
+
+/// Reads every venue's book and lists the spreads above the threshold.
+/// Venues that fail are logged and left out, as long as two remain.
+async fn detect(ctx: &RunContext, config: &ArbConfig, pair: &Pair) -> Result<SpreadReport, String> {
+    let results = FanOut::from_env()
+        .map_err(|e| e.to_string())?
+        .try_join(
+            ctx,
+            config
+                .venues
+                .iter()
+                .map(|&venue| async move { anyhow::Ok((venue, venue.book(ctx, pair).await)) }),
+        )
+        .await
+        .map_err(|e| e.to_string())?;
+    let books: Vec<(Venue, Book)> = results
+        .into_iter()
+        .filter_map(|(venue, book)| match book {
+            Ok(book) => Some((venue, book)),
+            Err(e) => {
+                println!("{venue} book for {pair} unavailable: {e:#}");
+                None
+            }
+        })
+        .collect();
+    spreads(config, pair, &books, ctx.clock().unix_secs())
+}
+
+/// The spreads between `books` above the threshold, read at `timestamp`
+fn spreads(
+    config: &ArbConfig,
+    pair: &Pair,
+    books: &[(Venue, Book)],
+    timestamp: u64,
+) -> Result<SpreadReport, String> {
+    if books.len() < 2 {
+        return Err(format!("Fewer than two venues returned a {} book", pair));
+    }
+
+    let (notional, fee) = (config.notional as f64, config.fee_bps as f64 / 10_000.0);
+    let sides: Vec<(Venue, Option<f64>, Option<f64>)> = books
+        .iter()
+        .map(|(venue, book)| (*venue, book.buy_price(notional), book.sell_price(notional)))
+        .collect();
+    let mut opportunities = Vec::new();
+    for &(buy_venue, buy, _) in &sides {
+        for &(sell_venue, _, sell) in &sides {
+            let (Some(buy), Some(sell)) = (buy, sell) else { continue };
+            if buy_venue == sell_venue {
+                continue;
+            }
+            let spread = (sell * (1.0 - fee) - buy * (1.0 + fee)) / buy * 10_000.0;
+            if spread < config.min_spread_bps as f64 {
+                continue;
+            }
+            opportunities.push(Opportunity {
+                buy_venue,
+                sell_venue,
+                buy_price: price(buy_venue, buy)?,
+                sell_price: price(sell_venue, sell)?,
+                spread_bps: spread.floor() as u32,
+            });
+        }
+    }
+    opportunities.sort_by(|a, b| {
+        b.spread_bps
+            .cmp(&a.spread_bps)
+            .then(a.buy_venue.as_str().cmp(b.buy_venue.as_str()))
+            .then(a.sell_venue.as_str().cmp(b.sell_venue.as_str()))
+    });
+
+    let venues = sides
+        .iter()
+        .map(|&(venue, buy, sell)| {
+            Ok(VenueQuote {
+                venue,
+                buy_price: buy.map(|p| price(venue, p)).transpose()?,
+                sell_price: sell.map(|p| price(venue, p)).transpose()?,
+            })
+        })
+        .collect::<Result<Vec<_>, String>>()?;
+    Ok(SpreadReport {
+        pair: pair.to_string(),
+        timestamp,
+        notional: config.notional,
+        min_spread_bps: config.min_spread_bps,
+        venues,
+        opportunities,
+    })
+}
+
+fn price(venue: Venue, price: f64) -> Result<U256, String> {
+    fixed_point::from_f64(price, PRICE_DECIMALS, Rounding::HalfUp)
+        .map_err(|e| format!("Price on {}: {}", venue, e))
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // Prices are the average fill of `notional` quote units, fixed-point
+        // with `decimals`; buy on `buyVenue`, sell on `sellVenue`
+        struct Opportunity {
+            string buyVenue;
+            string sellVenue;
+            uint256 buyPrice;
+            uint256 sellPrice;
+            uint32 spreadBps;
+        }
+
+        struct ArbitrageSignal {
+            string pair;
+            uint64 timestamp;
+            uint8 decimals;
+            uint64 notional;
+            Opportunity[] opportunities;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const NOW: u64 = 1_735_689_600;
+
+    fn config(min_spread_bps: u32, fee_bps: u32) -> ArbConfig {
+        ArbConfig {
+            venues: vec![Venue::Binance, Venue::Coinbase, Venue::Kraken],
+            min_spread_bps,
+            notional: DEFAULT_NOTIONAL,
+            fee_bps,
+        }
+    }
+
+    fn book(bid: f64, ask: f64) -> Book {
+        Book { bids: vec![(bid, 1_000.0)], asks: vec![(ask, 1_000.0)] }
+    }
+
+    fn fixed(price: u64) -> U256 {
+        U256::from(price) * U256::from(10u64).pow(U256::from(PRICE_DECIMALS))
+    }
+
+    fn pair() -> Pair {
+        Pair::parse("BTC-USDT").unwrap()
+    }
+
+    #[test]
+    fn default_config() {
+        let config = ArbConfig::from_env().unwrap();
+        assert_eq!(config.venues, [Venue::Binance, Venue::Coinbase, Venue::Kraken, Venue::Okx]);
+        assert_eq!((config.min_spread_bps, config.notional, config.fee_bps), (25, 10_000, 0));
+    }
+
+    #[test]
+    fn spreads_above_the_threshold_are_listed_widest_first() {
+        let books = [
+            (Venue::Binance, book(99.0, 100.0)),
+            (Venue::Coinbase, book(101.0, 102.0)),
+            (Venue::Kraken, book(100.5, 101.0)),
+        ];
+        let report = spreads(&config(25, 0), &pair(), &books, NOW).unwrap();
+        assert_eq!((report.pair.as_str(), report.timestamp), ("BTC-USDT", NOW));
+        let found: Vec<(Venue, Venue, u32)> = report
+            .opportunities
+            .iter()
+            .map(|o| (o.buy_venue, o.sell_venue, o.spread_bps))
+            .collect();
+        assert_eq!(
+            found,
+            [(Venue::Binance, Venue::Coinbase, 100), (Venue::Binance, Venue::Kraken, 50)]
+        );
+        let widest = &report.opportunities[0];
+        assert_eq!((widest.buy_price, widest.sell_price), (fixed(100), fixed(101)));
+        assert_eq!(report.venues.len(), 3);
+    }
+
+    #[test]
+    fn fees_are_paid_on_both_legs() {
+        let books = [(Venue::Binance, book(99.0, 100.0)), (Venue::Coinbase, book(101.0, 102.0))];
+        let report = spreads(&config(25, 10), &pair(), &books, NOW).unwrap();
+        // (101 * 0.999 - 100 * 1.001) / 100, rounded down
+        assert_eq!(report.opportunities[0].spread_bps, 79);
+        let report = spreads(&config(80, 10), &pair(), &books, NOW).unwrap();
+        assert!(report.opportunities.is_empty());
+    }
+
+    #[test]
+    fn thin_books_price_no_side() {
+        let thin = Book { bids: vec![(101.0, 1.0)], asks: vec![(100.0, 1_000.0)] };
+        let books = [(Venue::Binance, thin), (Venue::Coinbase, book(101.0, 102.0))];
+        let report = spreads(&config(25, 0), &pair(), &books, NOW).unwrap();
+        assert_eq!(report.venues[0].buy_price, Some(fixed(100)));
+        assert_eq!(report.venues[0].sell_price, None);
+        assert_eq!(report.opportunities.len(), 1);
+    }
+
+    #[test]
+    fn two_venues_are_needed() {
+        let books = [(Venue::Binance, book(99.0, 100.0))];
+        assert_eq!(
+            spreads(&config(25, 0), &pair(), &books, NOW).unwrap_err(),
+            "Fewer than two venues returned a BTC-USDT book"
+        );
+    }
+}
@@ -0,0 +1,28 @@
+use crate::bindings::{
+    host::get_eth_chain_config,
+    wavs::worker::layer_types::{TriggerData, TriggerDataEthContractEvent},
+};
+use anyhow::Result;
+use common::trigger::{self, EthEvent};
+pub use common::types::{Destination, TriggerBlock, TriggerRequest};
+
+/// Converts the host's trigger into the shared [`common::trigger`] inputs
+pub fn decode_trigger_event(trigger_data: TriggerData) -> Result<TriggerRequest> {
+    match trigger_data {
+        TriggerData::EthContractEvent(TriggerDataEthContractEvent {
+            contract_address,
+            log,
+            chain_name,
+            block_height,
+        }) => trigger::decode_eth_event(EthEvent {
+            contract_address: &contract_address.raw_bytes,
+            topics: &log.topics,
+            data: &log.data,
+            http_endpoint: get_eth_chain_config(&chain_name).and_then(|c| c.http_endpoint),
+            chain_name,
+            block_height,
+        }),
+        TriggerData::Raw(data) => trigger::decode_raw(&data, crate::CLI_COMMANDS),
+        _ => Err(trigger::unsupported()),
+    }
+}
@@ -0,0 +1,310 @@
+//! Venues and their public order book endpoints.
+//!
+//! Each venue's base URL is overridable with `<venue>_base_urls`, like any
+//! other [`Mirrors`] source. Books are read to a fixed depth, enough to fill
+//! the configured notional on liquid pairs.
+
+use anyhow::{anyhow, Context, Result};
+use common::{context::RunContext, http::fetch_json, mirrors::Mirrors, proxy};
+use serde::{de::DeserializeOwned, Deserialize, Serialize};
+use std::fmt;
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+/// Price levels read from each side of a book
+const BOOK_DEPTH: usize = 50;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Venue {
+    Binance,
+    Coinbase,
+    Kraken,
+    Okx,
+}
+
+impl std::str::FromStr for Venue {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self> {
+        match s.trim() {
+            "binance" => Ok(Self::Binance),
+            "coinbase" => Ok(Self::Coinbase),
+            "kraken" => Ok(Self::Kraken),
+            "okx" => Ok(Self::Okx),
+            other => {
+                Err(anyhow!("unknown venue {other}, expected binance, coinbase, kraken or okx"))
+            }
+        }
+    }
+}
+
+impl fmt::Display for Venue {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(self.as_str())
+    }
+}
+
+/// A trading pair, e.g. `BTC-USDT`
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Pair {
+    pub base: String,
+    pub quote: String,
+}
+
+impl Pair {
+    /// Parses `BASE-QUOTE` or `BASE/QUOTE`, case-insensitively
+    pub fn parse(s: &str) -> Result<Self> {
+        let (base, quote) = s
+            .trim()
+            .split_once(['-', '/'])
+            .ok_or_else(|| anyhow!("invalid pair {s:?}, expected BASE-QUOTE, e.g. BTC-USDT"))?;
+        let valid = |a: &str| {
+            !a.is_empty() && a.len() <= 10 && a.bytes().all(|b| b.is_ascii_alphanumeric())
+        };
+        if !valid(base) || !valid(quote) {
+            return Err(anyhow!("invalid pair {s:?}, expected BASE-QUOTE, e.g. BTC-USDT"));
+        }
+        Ok(Self { base: base.to_ascii_uppercase(), quote: quote.to_ascii_uppercase() })
+    }
+}
+
+impl fmt::Display for Pair {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}-{}", self.base, self.quote)
+    }
+}
+
+/// `(price, size)` levels, best first
+#[derive(Debug, Clone, PartialEq)]
+pub struct Book {
+    pub bids: Vec<(f64, f64)>,
+    pub asks: Vec<(f64, f64)>,
+}
+
+impl Book {
+    fn from_depth(depth: Depth) -> Result<Self> {
+        let side = |levels: &[Vec<serde_json::Value>]| -> Result<Vec<(f64, f64)>> {
+            levels
+                .iter()
+                .map(|level| {
+                    // `[price, size, ...]` as strings on every venue
+                    let field =
+                        |i: usize| level.get(i).and_then(serde_json::Value::as_str).unwrap_or("");
+                    let (price, size) = (field(0), field(1));
+                    let price: f64 =
+                        price.parse().with_context(|| format!("invalid price {price}"))?;
+                    let size: f64 = size.parse().with_context(|| format!("invalid size {size}"))?;
+                    if !price.is_finite() || price <= 0.0 || !size.is_finite() || size < 0.0 {
+                        return Err(anyhow!("invalid level {price} x {size}"));
+                    }
+                    Ok((price, size))
+                })
+                .collect()
+        };
+        Ok(Self { bids: side(&depth.bids)?, asks: side(&depth.asks)? })
+    }
+
+    /// Average price of buying `notional` quote units from the asks, `None`
+    /// when the book is too thin
+    pub fn buy_price(&self, notional: f64) -> Option<f64> {
+        fill(&self.asks, notional)
+    }
+
+    /// Average price of selling `notional` quote units into the bids
+    pub fn sell_price(&self, notional: f64) -> Option<f64> {
+        fill(&self.bids, notional)
+    }
+}
+
+/// Volume-weighted price of filling `notional` quote units from `levels`
+fn fill(levels: &[(f64, f64)], notional: f64) -> Option<f64> {
+    let (mut quote, mut base) = (0.0, 0.0);
+    for &(price, size) in levels {
+        let take = (notional - quote).min(price * size);
+        quote += take;
+        base += take / price;
+        if quote >= notional {
+            return Some(quote / base);
+        }
+    }
+    None
+}
+
+/// Both sides of a book as the venues return them
+#[derive(Debug, Deserialize)]
+struct Depth {
+    bids: Vec<Vec<serde_json::Value>>,
+    asks: Vec<Vec<serde_json::Value>>,
+}
+
+#[derive(Debug, Deserialize)]
+struct KrakenDepth {
+    error: Vec<String>,
+    #[serde(default)]
+    result: std::collections::BTreeMap<String, Depth>,
+}
+
+impl KrakenDepth {
+    fn into_book(self) -> Result<Book> {
+        if !self.error.is_empty() {
+            return Err(anyhow!("kraken: {}", self.error.join("; ")));
+        }
+        // Keyed by Kraken's own name for the pair, e.g. XXBTZUSD
+        Book::from_depth(self.result.into_values().next().context("kraken: no book")?)
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct OkxBooks {
+    code: String,
+    #[serde(default)]
+    msg: String,
+    data: Vec<Depth>,
+}
+
+impl OkxBooks {
+    fn into_book(self) -> Result<Book> {
+        if self.code != "0" {
+            return Err(anyhow!("okx: {} {}", self.code, self.msg));
+        }
+        Book::from_depth(self.data.into_iter().next().context("okx: no book")?)
+    }
+}
+
+impl Venue {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Binance => "binance",
+            Self::Coinbase => "coinbase",
+            Self::Kraken => "kraken",
+            Self::Okx => "okx",
+        }
+    }
+
+    fn default_base(self) -> &'static str {
+        match self {
+            Self::Binance => "https://api.binance.com",
+            Self::Coinbase => "https://api.exchange.coinbase.com",
+            Self::Kraken => "https://api.kraken.com",
+            Self::Okx => "https://www.okx.com",
+        }
+    }
+
+    /// The venue's current order book for `pair`
+    pub async fn book(self, ctx: &RunContext, pair: &Pair) -> Result<Book> {
+        let Pair { base, quote } = pair;
+        match self {
+            Self::Binance => {
+                let path = format!("/api/v3/depth?symbol={base}{quote}&limit={BOOK_DEPTH}");
+                Book::from_depth(self.get(ctx, &path).await?)
+            }
+            Self::Coinbase => {
+                // Level 2 is the top 50 levels, aggregated by price
+                Book::from_depth(
+                    self.get(ctx, &format!("/products/{base}-{quote}/book?level=2")).await?,
+                )
+            }
+            Self::Kraken => {
+                // Kraken still names bitcoin XBT
+                let base = if base == "BTC" { "XBT" } else { base.as_str() };
+                let path = format!("/0/public/Depth?pair={base}{quote}&count={BOOK_DEPTH}");
+                self.get::<KrakenDepth>(ctx, &path).await?.into_book()
+            }
+            Self::Okx => {
+                let path = format!("/api/v5/market/books?instId={base}-{quote}&sz={BOOK_DEPTH}");
+                self.get::<OkxBooks>(ctx, &path).await?.into_book()
+            }
+        }
+    }
+
+    async fn get<T: DeserializeOwned>(self, ctx: &RunContext, path: &str) -> Result<T> {
+        Mirrors::from_env(self.as_str(), self.default_base())?
+            .fetch(ctx, path, |url| async move {
+                let mut req = http_request_get(&url)?;
+                req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+                proxy::apply(&mut req)?;
+                fetch_json(req).await
+            })
+            .await
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn depth(json: &str) -> Result<Book> {
+        Book::from_depth(serde_json::from_str(json).unwrap())
+    }
+
+    #[test]
+    fn pairs_parse() {
+        let pair = Pair::parse(" btc/usdt ").unwrap();
+        assert_eq!((pair.base.as_str(), pair.quote.as_str()), ("BTC", "USDT"));
+        assert_eq!(Pair::parse("ETH-USD").unwrap().to_string(), "ETH-USD");
+        for invalid in ["BTCUSDT", "-USDT", "BTC-", "BTC-US$", "ABCDEFGHIJK-USD"] {
+            assert!(Pair::parse(invalid).is_err(), "{invalid}");
+        }
+    }
+
+    #[test]
+    fn venues_parse() {
+        assert_eq!(" okx ".parse::<Venue>().unwrap(), Venue::Okx);
+        assert_eq!(Venue::Kraken.to_string(), "kraken");
+        assert_eq!(
+            "bitfinex".parse::<Venue>().unwrap_err().to_string(),
+            "unknown venue bitfinex, expected binance, coinbase, kraken or okx"
+        );
+    }
+
+    #[test]
+    fn books_parse_string_levels() {
+        let book = depth(
+            r#"{"bids": [["99.5", "2", 3]], "asks": [["100.5", "1.5", "0", "1"]], "seq": 7}"#,
+        )
+        .unwrap();
+        assert_eq!(book, Book { bids: vec![(99.5, 2.0)], asks: vec![(100.5, 1.5)] });
+
+        assert!(depth(r#"{"bids": [[99.5, 2]], "asks": []}"#).is_err());
+        assert!(depth(r#"{"bids": [["0", "2"]], "asks": []}"#).is_err());
+        assert!(depth(r#"{"bids": [["NaN", "2"]], "asks": []}"#).is_err());
+    }
+
+    #[test]
+    fn fills_are_volume_weighted() {
+        let book = Book { bids: vec![(99.0, 1_000.0)], asks: vec![(100.0, 50.0), (400.0, 100.0)] };
+        // 5000 at 100 and 5000 at 400 buy 62.5 units
+        assert_eq!(book.buy_price(10_000.0), Some(160.0));
+        assert_eq!(book.buy_price(5_000.0), Some(100.0));
+        assert_eq!(book.sell_price(10_000.0), Some(99.0));
+        // The asks hold 45000 quote units
+        assert_eq!(book.buy_price(45_001.0), None);
+    }
+
+    #[test]
+    fn venue_errors_are_reported() {
+        let kraken: KrakenDepth =
+            serde_json::from_str(r#"{"error": ["EQuery:Unknown asset pair"]}"#).unwrap();
+        assert_eq!(
+            kraken.into_book().unwrap_err().to_string(),
+            "kraken: EQuery:Unknown asset pair"
+        );
+        let kraken: KrakenDepth = serde_json::from_str(
+            r#"{"error": [], "result": {"XXBTZUSD": {"bids": [["99", "1", 1]], "asks": []}}}"#,
+        )
+        .unwrap();
+        assert_eq!(kraken.into_book().unwrap().bids, [(99.0, 1.0)]);
+
+        let okx: OkxBooks = serde_json::from_str(
+            r#"{"code": "51001", "msg": "Instrument ID does not exist", "data": []}"#,
+        )
+        .unwrap();
+        assert_eq!(
+            okx.into_book().unwrap_err().to_string(),
+            "okx: 51001 Instrument ID does not exist"
+        );
+        let empty: OkxBooks = serde_json::from_str(r#"{"code": "0", "data": []}"#).unwrap();
+        assert_eq!(empty.into_book().unwrap_err().to_string(), "okx: no book");
+    }
+}
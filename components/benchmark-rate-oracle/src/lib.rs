@@ -0,0 +1,338 @@
+mod rates;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, clock, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    fan_out::FanOut,
+    output::{self, Computed},
+    panic_guard,
+};
+use rates::{Benchmark, Observation};
+use serde::{Deserialize, Serialize};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["rate"];
+
+/// Benchmarks published when the input is empty, overridable with `benchmarks`
+const DEFAULT_BENCHMARKS: &[&str] = &["SOFR"];
+
+/// Decimals of the fixed-point percentages, overridable with `rate_decimals`
+const DEFAULT_RATE_DECIMALS: u8 = 4;
+
+/// Oldest effective date accepted for a latest rate, in days; covers long
+/// weekends and holidays. Overridable with `max_rate_age_days`
+const DEFAULT_MAX_RATE_AGE_DAYS: u64 = 5;
+
+const SECS_PER_DAY: u64 = 86_400;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let requests = parse_requests(input.trim_end_matches('\0'))?;
+    println!("requests: {:?}", requests);
+
+    let config = RateConfig::from_env()?;
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(get_rates(&ctx, &config, &requests))?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("rates:{}", report.benchmarks_label());
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload: Vec<solidity::BenchmarkRate> = report
+                    .rates
+                    .iter()
+                    .map(|r| solidity::BenchmarkRate {
+                        benchmark: r.benchmark.name().to_string(),
+                        rate: r.rate,
+                        decimals: report.decimals,
+                        effectiveDate: r.effective_time,
+                    })
+                    .collect();
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// A benchmark, and the effective date asked for when it is not the latest
+#[derive(Debug, Clone, PartialEq, Eq, PartialOrd, Ord)]
+struct RateRequest {
+    benchmark: Benchmark,
+    date: Option<String>,
+}
+
+/// Reads comma or whitespace separated `BENCHMARK` or `BENCHMARK@YYYY-MM-DD`
+/// entries of the input, or the comma separated `benchmarks` kv config when
+/// it is empty
+fn parse_requests(input: &str) -> Result<Vec<RateRequest>, String> {
+    let list = if input.trim().is_empty() {
+        config::list("benchmarks")
+            .unwrap_or_else(|| DEFAULT_BENCHMARKS.iter().map(|b| b.to_string()).collect())
+    } else {
+        input.split(|c: char| c == ',' || c.is_whitespace()).map(str::to_string).collect()
+    };
+    let mut requests = Vec::new();
+    for entry in list.iter().map(String::as_str).filter(|e| !e.is_empty()) {
+        let (name, date) = match entry.split_once('@') {
+            Some((name, date)) => (name, Some(date)),
+            None => (entry, None),
+        };
+        let benchmark = Benchmark::parse(name).map_err(|e| e.to_string())?;
+        if let Some(date) = date {
+            clock::parse_utc(&format!("{}T00:00:00", date))
+                .map_err(|_| format!("Invalid effective date {:?}, expected YYYY-MM-DD", date))?;
+        }
+        requests.push(RateRequest { benchmark, date: date.map(str::to_string) });
+    }
+    requests.sort();
+    requests.dedup();
+    if requests.is_empty() {
+        return Err("No benchmarks requested".to_string());
+    }
+    Ok(requests)
+}
+
+struct RateConfig {
+    decimals: u8,
+    max_age_days: u64,
+}
+
+impl RateConfig {
+    fn from_env() -> Result<Self, String> {
+        let decimals =
+            config::parse_or("rate_decimals", DEFAULT_RATE_DECIMALS).map_err(|e| e.to_string())?;
+        // Keeps any percentage below 10^6 inside an int64
+        if decimals > 12 {
+            return Err(format!("rate_decimals {} is above 12", decimals));
+        }
+        let max_age_days = config::parse_or("max_rate_age_days", DEFAULT_MAX_RATE_AGE_DAYS)
+            .map_err(|e| e.to_string())?;
+        Ok(Self { decimals, max_age_days })
+    }
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct BenchmarkRate {
+    benchmark: Benchmark,
+    source: String,
+    /// Percent, fixed-point with the report's decimals
+    rate: i64,
+    /// `YYYY-MM-DD` the rate applies to
+    effective_date: String,
+    /// Unix seconds of midnight UTC on the effective date
+    effective_time: u64,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct RateReport {
+    decimals: u8,
+    rates: Vec<BenchmarkRate>,
+}
+
+impl RateReport {
+    fn benchmarks_label(&self) -> String {
+        let names: Vec<String> = self
+            .rates
+            .iter()
+            .map(|r| format!("{}@{}", r.benchmark.name(), r.effective_date))
+            .collect();
+        names.join(",")
+    }
+}
+
+async fn get_rates(
+    ctx: &RunContext,
+    config: &RateConfig,
+    requests: &[RateRequest],
+) -> Result<RateReport, String> {
+    let today = ctx.clock().unix_secs() / SECS_PER_DAY;
+    let rates = FanOut::from_env()
+        .map_err(|e| e.to_string())?
+        .try_join(ctx, requests.iter().map(|request| get_rate(ctx, config, request, today)))
+        .await
+        .map_err(|e| e.to_string())?;
+    Ok(RateReport { decimals: config.decimals, rates })
+}
+
+async fn get_rate(
+    ctx: &RunContext,
+    config: &RateConfig,
+    request: &RateRequest,
+    today: u64,
+) -> Result<BenchmarkRate, String> {
+    let benchmark = request.benchmark;
+    let observation = benchmark
+        .observe(ctx, request.date.as_deref())
+        .await
+        .map_err(|e| format!("{}: {:#}", benchmark.name(), e))?;
+    benchmark_rate(config, request, observation, today)
+}
+
+/// The published rate of `observation`, checked against what `request` asked
+/// for
+fn benchmark_rate(
+    config: &RateConfig,
+    request: &RateRequest,
+    observation: Observation,
+    today: u64,
+) -> Result<BenchmarkRate, String> {
+    let benchmark = request.benchmark;
+    let effective_time = clock::parse_utc(&format!("{}T00:00:00", observation.effective_date))
+        .map_err(|e| e.to_string())?;
+
+    match &request.date {
+        // Searches may fall back to a neighbouring publication
+        Some(date) if *date != observation.effective_date => {
+            return Err(format!(
+                "{} has no rate effective {}, the closest is {}",
+                benchmark.name(),
+                date,
+                observation.effective_date
+            ));
+        }
+        Some(_) => {}
+        None => {
+            let age = today.saturating_sub(effective_time / SECS_PER_DAY);
+            if age > config.max_age_days {
+                return Err(format!(
+                    "Latest {} is effective {}, {} days ago, above max_rate_age_days {}",
+                    benchmark.name(),
+                    observation.effective_date,
+                    age,
+                    config.max_age_days
+                ));
+            }
+        }
+    }
+
+    Ok(BenchmarkRate {
+        benchmark,
+        source: benchmark.source().to_string(),
+        rate: rates::to_fixed_point(&observation.percent, config.decimals)
+            .map_err(|e| e.to_string())?,
+        effective_date: observation.effective_date,
+        effective_time,
+    })
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // Percent, fixed-point with `decimals`; effectiveDate is midnight UTC
+        // of the day the rate applies to
+        struct BenchmarkRate {
+            string benchmark;
+            int64 rate;
+            uint8 decimals;
+            uint64 effectiveDate;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// Midnight UTC of 2025-01-02, in days
+    const JAN_2: u64 = 20_090;
+
+    const CONFIG: RateConfig = RateConfig { decimals: 4, max_age_days: DEFAULT_MAX_RATE_AGE_DAYS };
+
+    fn request(benchmark: Benchmark, date: Option<&str>) -> RateRequest {
+        RateRequest { benchmark, date: date.map(str::to_string) }
+    }
+
+    fn observed(effective_date: &str, percent: &str) -> Observation {
+        Observation { effective_date: effective_date.to_string(), percent: percent.to_string() }
+    }
+
+    #[test]
+    fn requests_parse_from_input() {
+        assert_eq!(
+            parse_requests("ust10y, sofr@2025-01-02 UST10Y").unwrap(),
+            [request(Benchmark::Sofr, Some("2025-01-02")), request(Benchmark::Ust10y, None)]
+        );
+        assert_eq!(
+            parse_requests("SOFR@2025-13-01"),
+            Err(r#"Invalid effective date "2025-13-01", expected YYYY-MM-DD"#.to_string())
+        );
+        assert!(parse_requests("LIBOR").is_err());
+        // The latest SOFR when nothing is asked for
+        assert_eq!(parse_requests(" ").unwrap(), [request(Benchmark::Sofr, None)]);
+    }
+
+    #[test]
+    fn latest_rates_are_dated_and_scaled() {
+        let sofr = request(Benchmark::Sofr, None);
+        let rate = benchmark_rate(&CONFIG, &sofr, observed("2025-01-02", "4.33"), JAN_2 + 3);
+        let rate = rate.unwrap();
+        assert_eq!((rate.rate, rate.effective_time), (43_300, 1_735_776_000));
+        assert_eq!((rate.source.as_str(), rate.effective_date.as_str()), ("nyfed", "2025-01-02"));
+
+        let stale = benchmark_rate(&CONFIG, &sofr, observed("2025-01-02", "4.33"), JAN_2 + 6);
+        assert_eq!(
+            stale.unwrap_err(),
+            "Latest SOFR is effective 2025-01-02, 6 days ago, above max_rate_age_days 5"
+        );
+    }
+
+    #[test]
+    fn dated_requests_need_that_date() {
+        let dated = request(Benchmark::Ust10y, Some("2025-01-01"));
+        // Old dates are fine when asked for
+        let rate = benchmark_rate(&CONFIG, &dated, observed("2025-01-01", "4.57"), JAN_2 + 365);
+        assert_eq!(rate.unwrap().rate, 45_700);
+
+        let closest = benchmark_rate(&CONFIG, &dated, observed("2024-12-31", "4.58"), JAN_2);
+        assert_eq!(
+            closest.unwrap_err(),
+            "UST10Y has no rate effective 2025-01-01, the closest is 2024-12-31"
+        );
+    }
+
+    #[test]
+    fn report_labels_rates_by_effective_date() {
+        let rates = [(Benchmark::Sofr, "2025-01-02"), (Benchmark::Effr, "2025-01-01")]
+            .iter()
+            .map(|&(benchmark, date)| {
+                let request = request(benchmark, Some(date));
+                benchmark_rate(&CONFIG, &request, observed(date, "4.33"), JAN_2).unwrap()
+            })
+            .collect();
+        let report = RateReport { decimals: 4, rates };
+        assert_eq!(report.benchmarks_label(), "SOFR@2025-01-02,EFFR@2025-01-01");
+    }
+}
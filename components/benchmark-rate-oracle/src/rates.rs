@@ -0,0 +1,269 @@
+//! Benchmark rates and the official or aggregator APIs publishing them.
+//!
+//! Rates are published for an effective date, usually the previous business
+//! day, so every observation carries the date it applies to rather than the
+//! time it was read.
+
+use anyhow::{anyhow, Context, Result};
+use common::{
+    context::RunContext,
+    fixed_point::{self, Rounding},
+    http::fetch_json,
+    mirrors::Mirrors,
+    proxy,
+    secret::Secret,
+};
+use serde::{de::DeserializeOwned, Deserialize, Serialize};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+/// New York Fed Markets API, overridable with the `nyfed_base_urls` mirrors
+const NYFED_API_BASE: &str = "https://markets.newyorkfed.org";
+
+/// FRED API, overridable with the `fred_base_urls` mirrors
+const FRED_API_BASE: &str = "https://api.stlouisfed.org";
+
+/// FRED API key, needed for Treasury yields
+pub const FRED_API_KEY_ENV: &str = "WAVS_ENV_FRED_API_KEY";
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize, Deserialize)]
+#[serde(rename_all = "UPPERCASE")]
+pub enum Benchmark {
+    Sofr,
+    Effr,
+    Ust3m,
+    Ust2y,
+    Ust5y,
+    Ust10y,
+    Ust30y,
+}
+
+/// A rate in percent, as the decimal string it was published as
+#[derive(Debug)]
+pub struct Observation {
+    /// `YYYY-MM-DD`
+    pub effective_date: String,
+    pub percent: String,
+}
+
+impl Benchmark {
+    pub fn parse(s: &str) -> Result<Self> {
+        match s.trim().to_ascii_uppercase().as_str() {
+            "SOFR" => Ok(Self::Sofr),
+            "EFFR" => Ok(Self::Effr),
+            "UST3M" => Ok(Self::Ust3m),
+            "UST2Y" => Ok(Self::Ust2y),
+            "UST5Y" => Ok(Self::Ust5y),
+            "UST10Y" => Ok(Self::Ust10y),
+            "UST30Y" => Ok(Self::Ust30y),
+            _ => Err(anyhow!(
+                "unsupported benchmark {s:?}, expected SOFR, EFFR or UST3M/2Y/5Y/10Y/30Y"
+            )),
+        }
+    }
+
+    pub fn name(self) -> &'static str {
+        match self {
+            Self::Sofr => "SOFR",
+            Self::Effr => "EFFR",
+            Self::Ust3m => "UST3M",
+            Self::Ust2y => "UST2Y",
+            Self::Ust5y => "UST5Y",
+            Self::Ust10y => "UST10Y",
+            Self::Ust30y => "UST30Y",
+        }
+    }
+
+    /// Publisher of the rate
+    pub fn source(self) -> &'static str {
+        match self {
+            Self::Sofr | Self::Effr => "nyfed",
+            _ => "fred",
+        }
+    }
+
+    /// Reads the rate effective on `date`, or the latest published rate
+    pub async fn observe(self, ctx: &RunContext, date: Option<&str>) -> Result<Observation> {
+        match self {
+            Self::Sofr => nyfed(ctx, "secured/sofr", date).await,
+            Self::Effr => nyfed(ctx, "unsecured/effr", date).await,
+            Self::Ust3m => fred(ctx, "DGS3MO", date).await,
+            Self::Ust2y => fred(ctx, "DGS2", date).await,
+            Self::Ust5y => fred(ctx, "DGS5", date).await,
+            Self::Ust10y => fred(ctx, "DGS10", date).await,
+            Self::Ust30y => fred(ctx, "DGS30", date).await,
+        }
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct NyFedRates {
+    #[serde(rename = "refRates")]
+    ref_rates: Vec<NyFedRate>,
+}
+
+#[derive(Debug, Deserialize)]
+struct NyFedRate {
+    #[serde(rename = "effectiveDate")]
+    effective_date: String,
+    #[serde(rename = "percentRate")]
+    percent_rate: serde_json::Number,
+}
+
+async fn nyfed(ctx: &RunContext, rate: &str, date: Option<&str>) -> Result<Observation> {
+    let path = match date {
+        Some(date) => format!("/api/rates/{rate}/search.json?startDate={date}&endDate={date}"),
+        None => format!("/api/rates/{rate}/last/1.json"),
+    };
+    let response: NyFedRates = get_json(ctx, "nyfed", NYFED_API_BASE, &path).await?;
+    response.into_observation(rate, date)
+}
+
+impl NyFedRates {
+    fn into_observation(self, rate: &str, date: Option<&str>) -> Result<Observation> {
+        let published = self.ref_rates.into_iter().next().with_context(|| {
+            format!("no {rate} rate published for {}", date.unwrap_or("latest"))
+        })?;
+        Ok(Observation {
+            effective_date: published.effective_date,
+            percent: published.percent_rate.to_string(),
+        })
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct FredObservations {
+    observations: Vec<FredObservation>,
+}
+
+#[derive(Debug, Deserialize)]
+struct FredObservation {
+    date: String,
+    /// `.` on days without a value, e.g. bond market holidays
+    value: String,
+}
+
+async fn fred(ctx: &RunContext, series: &str, date: Option<&str>) -> Result<Observation> {
+    let key = Secret::required(FRED_API_KEY_ENV)?;
+    let range = match date {
+        Some(date) => format!("&observation_start={date}&observation_end={date}"),
+        // A few recent rows, holidays publish `.`
+        None => "&sort_order=desc&limit=10".to_string(),
+    };
+    let path = format!(
+        "/fred/series/observations?series_id={series}&api_key={}&file_type=json{range}",
+        common::http::percent_encode(key.expose())
+    );
+    let response: FredObservations = get_json(ctx, "fred", FRED_API_BASE, &path).await?;
+    response.into_observation(series, date)
+}
+
+impl FredObservations {
+    /// The first row with a value
+    fn into_observation(self, series: &str, date: Option<&str>) -> Result<Observation> {
+        let observation =
+            self.observations.into_iter().find(|o| o.value != ".").with_context(|| {
+                format!("no {series} yield published for {}", date.unwrap_or("latest"))
+            })?;
+        Ok(Observation { effective_date: observation.date, percent: observation.value })
+    }
+}
+
+async fn get_json<T: DeserializeOwned>(
+    ctx: &RunContext,
+    source: &str,
+    base: &str,
+    path: &str,
+) -> Result<T> {
+    Mirrors::from_env(source, base)?
+        .fetch(ctx, path, |url| async move {
+            let mut req = http_request_get(&url)?;
+            req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+            proxy::apply(&mut req)?;
+            fetch_json(req).await
+        })
+        .await
+}
+
+/// Parses a decimal percentage into fixed-point with `decimals`, rejecting
+/// precision the encoding would drop
+pub fn to_fixed_point(percent: &str, decimals: u8) -> Result<i64> {
+    let invalid = || anyhow!("invalid rate {percent:?} for {decimals} decimals");
+    let s = percent.trim();
+    let (negative, digits) = match s.strip_prefix('-') {
+        Some(rest) => (true, rest),
+        None => (false, s),
+    };
+    let value = fixed_point::parse(digits, decimals, Rounding::Exact).map_err(|_| invalid())?;
+    let value = i64::try_from(value).map_err(|_| invalid())?;
+    Ok(if negative { -value } else { value })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn benchmarks_parse_ignoring_case() {
+        assert_eq!(Benchmark::parse(" sofr ").unwrap(), Benchmark::Sofr);
+        assert_eq!(Benchmark::parse("Ust10Y").unwrap(), Benchmark::Ust10y);
+        assert!(Benchmark::parse("UST7Y").is_err());
+        assert_eq!((Benchmark::Effr.source(), Benchmark::Ust3m.source()), ("nyfed", "fred"));
+        assert_eq!(serde_json::to_value(Benchmark::Ust30y).unwrap(), "UST30Y");
+    }
+
+    #[test]
+    fn nyfed_rate_is_the_first_published() {
+        let response: NyFedRates = serde_json::from_str(
+            r#"{"refRates": [{"effectiveDate": "2025-01-02", "type": "SOFR",
+                "percentRate": 4.33, "volumeInBillions": 2100}]}"#,
+        )
+        .unwrap();
+        let observation = response.into_observation("secured/sofr", None).unwrap();
+        assert_eq!(
+            (observation.effective_date.as_str(), observation.percent.as_str()),
+            ("2025-01-02", "4.33")
+        );
+
+        let empty: NyFedRates = serde_json::from_str(r#"{"refRates": []}"#).unwrap();
+        assert_eq!(
+            empty.into_observation("secured/sofr", Some("2025-01-04")).unwrap_err().to_string(),
+            "no secured/sofr rate published for 2025-01-04"
+        );
+    }
+
+    #[test]
+    fn fred_skips_days_without_a_value() {
+        let response: FredObservations = serde_json::from_str(
+            r#"{"observations": [{"date": "2025-01-01", "value": "."},
+                {"date": "2024-12-31", "value": "4.58"}]}"#,
+        )
+        .unwrap();
+        let observation = response.into_observation("DGS10", None).unwrap();
+        assert_eq!(
+            (observation.effective_date.as_str(), observation.percent.as_str()),
+            ("2024-12-31", "4.58")
+        );
+
+        let holiday: FredObservations =
+            serde_json::from_str(r#"{"observations": [{"date": "2025-01-01", "value": "."}]}"#)
+                .unwrap();
+        assert_eq!(
+            holiday.into_observation("DGS10", None).unwrap_err().to_string(),
+            "no DGS10 yield published for latest"
+        );
+    }
+
+    #[test]
+    fn rates_scale_exactly() {
+        assert_eq!(to_fixed_point("4.33", 4).unwrap(), 43_300);
+        assert_eq!(to_fixed_point(" -0.125 ", 4).unwrap(), -1_250);
+        assert_eq!(to_fixed_point("0", 4).unwrap(), 0);
+        assert_eq!(
+            to_fixed_point("4.33125", 4).unwrap_err().to_string(),
+            r#"invalid rate "4.33125" for 4 decimals"#
+        );
+        assert!(to_fixed_point("--1", 4).is_err());
+        assert!(to_fixed_point("abc", 4).is_err());
+    }
+}
@@ -0,0 +1,332 @@
+mod odds;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, clock, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    http::{self, fetch_json},
+    mirrors::Mirrors,
+    output::{self, Computed},
+    panic_guard, proxy,
+    secret::Secret,
+};
+use odds::Book;
+use serde::{Deserialize, Serialize};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::{http::HeaderValue, runtime::block_on};
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["odds"];
+
+/// The Odds API, overridable with the `odds_base_urls` mirrors
+const DEFAULT_ODDS_API_BASE: &str = "https://api.the-odds-api.com";
+
+/// The Odds API key
+const API_KEY_ENV: &str = "WAVS_ENV_ODDS_API_KEY";
+
+/// Bookmaker regions averaged over, overridable with `odds_regions`
+const DEFAULT_REGIONS: &[&str] = &["us", "uk", "eu"];
+
+/// Fewest bookmakers a consensus is published from, overridable with
+/// `min_bookmakers`
+const DEFAULT_MIN_BOOKMAKERS: usize = 3;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let (sport, event_id) = parse_event(input.trim_end_matches('\0').trim())?;
+    println!("event: {}/{}", sport, event_id);
+
+    let config = OddsConfig::from_env()?;
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(get_odds(&ctx, &config, &sport, &event_id))?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("odds:{}", report.event_id);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::EventOdds {
+                    eventId: report.event_id.clone(),
+                    commenceTime: report.commence_time,
+                    live: report.phase == Phase::Live,
+                    bookmakers: report.bookmakers,
+                    outcomes: report
+                        .outcomes
+                        .iter()
+                        .map(|o| solidity::OutcomeProbability {
+                            name: o.name.clone(),
+                            probabilityPpm: o.probability_ppm,
+                        })
+                        .collect(),
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// Parses `sport_key/event_id`, e.g. `soccer_epl/e912304de2b2ce35b473ce2ecd3d1502`
+fn parse_event(input: &str) -> Result<(String, String), String> {
+    let (sport, event_id) =
+        input.split_once('/').ok_or("Expected sport_key/event_id, e.g. soccer_epl/<event id>")?;
+    let valid = |s: &str| !s.is_empty() && s.chars().all(|c| c.is_ascii_alphanumeric() || c == '_');
+    if !valid(sport) || !valid(event_id) {
+        return Err(format!("Invalid event: {}", input));
+    }
+    Ok((sport.to_string(), event_id.to_string()))
+}
+
+struct OddsConfig {
+    api_key: Secret,
+    regions: String,
+    min_bookmakers: usize,
+}
+
+impl OddsConfig {
+    fn from_env() -> Result<Self, String> {
+        let api_key = Secret::required(API_KEY_ENV).map_err(|e| e.to_string())?;
+        // Sent as the comma separated `regions` query parameter
+        let regions = config::list("odds_regions")
+            .map_or_else(|| DEFAULT_REGIONS.join(","), |regions| regions.join(","));
+        let min_bookmakers = config::parse_or("min_bookmakers", DEFAULT_MIN_BOOKMAKERS)
+            .map_err(|e| e.to_string())?;
+        Ok(Self { api_key, regions, min_bookmakers })
+    }
+}
+
+/// Event odds response of `/v4/sports/{sport}/events/{id}/odds`
+#[derive(Debug, Deserialize)]
+struct EventResponse {
+    id: String,
+    commence_time: String,
+    bookmakers: Vec<Bookmaker>,
+}
+
+#[derive(Debug, Deserialize)]
+struct Bookmaker {
+    key: String,
+    markets: Vec<Market>,
+}
+
+#[derive(Debug, Deserialize)]
+struct Market {
+    key: String,
+    outcomes: Vec<Outcome>,
+}
+
+#[derive(Debug, Deserialize)]
+struct Outcome {
+    name: String,
+    price: f64,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum Phase {
+    PreMatch,
+    /// Started; live odds move with the game state
+    Live,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct OutcomeProbability {
+    name: String,
+    /// Margin-free implied probability, parts per million
+    probability_ppm: u64,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct OddsReport {
+    event_id: String,
+    /// Unix seconds of the scheduled start
+    commence_time: u64,
+    phase: Phase,
+    /// Books in the consensus
+    bookmakers: u32,
+    outcomes: Vec<OutcomeProbability>,
+}
+
+async fn get_odds(
+    ctx: &RunContext,
+    config: &OddsConfig,
+    sport: &str,
+    event_id: &str,
+) -> Result<OddsReport, String> {
+    // Head-to-head (moneyline) markets price every outcome of the event
+    let path = format!(
+        "/v4/sports/{}/events/{}/odds?apiKey={}&regions={}&markets=h2h&oddsFormat=decimal",
+        sport,
+        event_id,
+        http::percent_encode(config.api_key.expose()),
+        http::percent_encode(&config.regions)
+    );
+    let mirrors = Mirrors::from_env("odds", DEFAULT_ODDS_API_BASE).map_err(|e| e.to_string())?;
+    let event: EventResponse = mirrors
+        .fetch(ctx, &path, |url| async move {
+            let mut req = http_request_get(&url)?;
+            req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+            proxy::apply(&mut req)?;
+            fetch_json(req).await
+        })
+        .await
+        .map_err(|e| e.to_string())?;
+    odds_report(event, ctx.clock().unix_secs(), config.min_bookmakers)
+}
+
+/// The consensus of the head-to-head markets of `event` at `now`
+fn odds_report(
+    event: EventResponse,
+    now: u64,
+    min_bookmakers: usize,
+) -> Result<OddsReport, String> {
+    let commence_time = clock::parse_utc(&event.commence_time).map_err(|e| e.to_string())?;
+    let phase = if now >= commence_time { Phase::Live } else { Phase::PreMatch };
+
+    let books: Vec<Book> = event
+        .bookmakers
+        .into_iter()
+        .filter_map(|bookmaker| {
+            let market = bookmaker.markets.into_iter().find(|m| m.key == "h2h")?;
+            Some(Book {
+                bookmaker: bookmaker.key,
+                prices: market.outcomes.into_iter().map(|o| (o.name, o.price)).collect(),
+            })
+        })
+        .collect();
+    let (probabilities, bookmakers) = odds::consensus(&books).map_err(|e| e.to_string())?;
+    if bookmakers < min_bookmakers {
+        return Err(format!(
+            "Only {} bookmakers quote {}, min_bookmakers is {}",
+            bookmakers, event.id, min_bookmakers
+        ));
+    }
+
+    Ok(OddsReport {
+        event_id: event.id,
+        commence_time,
+        phase,
+        bookmakers: bookmakers as u32,
+        outcomes: probabilities
+            .into_iter()
+            .map(|(name, probability_ppm)| OutcomeProbability { name, probability_ppm })
+            .collect(),
+    })
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // Probabilities are parts per million and sum to exactly 1e6
+        struct OutcomeProbability {
+            string name;
+            uint64 probabilityPpm;
+        }
+
+        struct EventOdds {
+            string eventId;
+            uint64 commenceTime;
+            bool live;
+            uint32 bookmakers;
+            OutcomeProbability[] outcomes;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// 2025-01-01T15:00:00Z
+    const KICK_OFF: u64 = 1_735_743_600;
+
+    /// Three books with the same 1X2 line, one without a draw line and one
+    /// quoting only spreads
+    const EVENT: &str = r#"{"id": "e912304de2b2ce35b473ce2ecd3d1502",
+        "commence_time": "2025-01-01T15:00:00Z", "bookmakers": [
+        {"key": "betfair", "markets": [{"key": "h2h", "outcomes": [
+            {"name": "Arsenal", "price": 2.7}, {"name": "Chelsea", "price": 2.7},
+            {"name": "Draw", "price": 2.7}]}]},
+        {"key": "unibet", "markets": [{"key": "h2h", "outcomes": [
+            {"name": "Draw", "price": 3.0}, {"name": "Chelsea", "price": 3.0},
+            {"name": "Arsenal", "price": 3.0}]}]},
+        {"key": "williamhill", "markets": [{"key": "h2h", "outcomes": [
+            {"name": "Arsenal", "price": 2.9}, {"name": "Chelsea", "price": 2.9},
+            {"name": "Draw", "price": 2.9}]}]},
+        {"key": "mybook", "markets": [{"key": "h2h", "outcomes": [
+            {"name": "Arsenal", "price": 1.5}, {"name": "Chelsea", "price": 3.0}]}]},
+        {"key": "pinnacle", "markets": [{"key": "spreads", "outcomes": [
+            {"name": "Arsenal", "price": 1.9}, {"name": "Chelsea", "price": 1.9}]}]}]}"#;
+
+    fn event() -> EventResponse {
+        serde_json::from_str(EVENT).unwrap()
+    }
+
+    #[test]
+    fn events_parse() {
+        assert_eq!(
+            parse_event("soccer_epl/e912304de2b2ce35b473ce2ecd3d1502").unwrap(),
+            ("soccer_epl".to_string(), "e912304de2b2ce35b473ce2ecd3d1502".to_string())
+        );
+        assert_eq!(
+            parse_event("soccer_epl"),
+            Err("Expected sport_key/event_id, e.g. soccer_epl/<event id>".to_string())
+        );
+        assert_eq!(parse_event("soccer_epl/"), Err("Invalid event: soccer_epl/".to_string()));
+        assert_eq!(parse_event("../odds/x"), Err("Invalid event: ../odds/x".to_string()));
+    }
+
+    #[test]
+    fn consensus_of_the_matching_books() {
+        let report = odds_report(event(), KICK_OFF - 60, 3).unwrap();
+        assert_eq!(report.commence_time, KICK_OFF);
+        assert_eq!(report.phase, Phase::PreMatch);
+        assert_eq!(report.bookmakers, 3);
+        let outcomes: Vec<(&str, u64)> =
+            report.outcomes.iter().map(|o| (o.name.as_str(), o.probability_ppm)).collect();
+        // The remainder of a three-way split goes to the first outcome
+        assert_eq!(outcomes, [("Arsenal", 333_334), ("Chelsea", 333_333), ("Draw", 333_333)]);
+    }
+
+    #[test]
+    fn started_events_are_live() {
+        assert_eq!(odds_report(event(), KICK_OFF, 3).unwrap().phase, Phase::Live);
+    }
+
+    #[test]
+    fn too_few_bookmakers_fail() {
+        assert_eq!(
+            odds_report(event(), KICK_OFF, 4).unwrap_err(),
+            "Only 3 bookmakers quote e912304de2b2ce35b473ce2ecd3d1502, min_bookmakers is 4"
+        );
+    }
+}
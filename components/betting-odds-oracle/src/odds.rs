@@ -0,0 +1,140 @@
+//! Implied probabilities from bookmaker odds.
+//!
+//! Each bookmaker's decimal odds imply probabilities summing to more than
+//! one, the overround being its margin. Dividing by the sum removes the
+//! margin; the normalized books are then averaged and scaled to integers
+//! that sum to exactly [`PROBABILITY_SCALE`].
+
+use anyhow::{anyhow, Result};
+
+/// Probabilities are published in parts per million
+pub const PROBABILITY_SCALE: u64 = 1_000_000;
+
+/// One bookmaker's decimal odds per outcome name
+#[derive(Debug, Clone)]
+pub struct Book {
+    pub bookmaker: String,
+    pub prices: Vec<(String, f64)>,
+}
+
+/// Margin-free probability of each outcome of a book, sorted by outcome name
+fn normalize(book: &Book) -> Option<Vec<(String, f64)>> {
+    let mut prices = book.prices.clone();
+    prices.sort_by(|a, b| a.0.cmp(&b.0));
+    // Decimal odds of 1 or less are void or suspended markets
+    if prices.len() < 2 || prices.iter().any(|(_, price)| !price.is_finite() || *price <= 1.0) {
+        return None;
+    }
+    let total: f64 = prices.iter().map(|(_, price)| 1.0 / price).sum();
+    Some(prices.into_iter().map(|(name, price)| (name, 1.0 / price / total)).collect())
+}
+
+/// Averages the normalized books that quote the same outcomes as the
+/// majority, returning the probabilities in parts per million and the number
+/// of books used
+pub fn consensus(books: &[Book]) -> Result<(Vec<(String, u64)>, usize)> {
+    let mut books: Vec<&Book> = books.iter().collect();
+    // Summation order is fixed so every operator rounds the same way
+    books.sort_by(|a, b| a.bookmaker.cmp(&b.bookmaker));
+    let normalized: Vec<Vec<(String, f64)>> = books.into_iter().filter_map(normalize).collect();
+
+    // Books missing an outcome (e.g. no draw line) can't be averaged in
+    let outcome_names = |book: &Vec<(String, f64)>| -> Vec<String> {
+        book.iter().map(|(name, _)| name.clone()).collect()
+    };
+    let mut shapes: Vec<Vec<String>> = normalized.iter().map(outcome_names).collect();
+    shapes.sort();
+    let names = shapes
+        .iter()
+        .max_by_key(|shape| shapes.iter().filter(|other| other == shape).count())
+        .cloned()
+        .ok_or_else(|| anyhow!("no bookmaker quotes a complete market"))?;
+    let matching: Vec<&Vec<(String, f64)>> =
+        normalized.iter().filter(|book| outcome_names(book) == names).collect();
+
+    let mean: Vec<f64> = (0..names.len())
+        .map(|i| matching.iter().map(|book| book[i].1).sum::<f64>() / matching.len() as f64)
+        .collect();
+    let scaled = largest_remainder(&mean);
+    Ok((names.into_iter().zip(scaled).collect(), matching.len()))
+}
+
+/// Scales probabilities to integers summing to [`PROBABILITY_SCALE`], giving
+/// the rounding remainder to the largest fractional parts
+fn largest_remainder(probabilities: &[f64]) -> Vec<u64> {
+    let total: f64 = probabilities.iter().sum();
+    let exact: Vec<f64> =
+        probabilities.iter().map(|p| p / total * PROBABILITY_SCALE as f64).collect();
+    let mut scaled: Vec<u64> = exact.iter().map(|x| x.floor() as u64).collect();
+    let missing = PROBABILITY_SCALE.saturating_sub(scaled.iter().sum());
+
+    let mut order: Vec<usize> = (0..exact.len()).collect();
+    // Stable, so equal remainders go to the earlier outcome name
+    order.sort_by(|&a, &b| (exact[b] - exact[b].floor()).total_cmp(&(exact[a] - exact[a].floor())));
+    for &i in order.iter().take(missing as usize) {
+        scaled[i] += 1;
+    }
+    scaled
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn book(bookmaker: &str, prices: &[(&str, f64)]) -> Book {
+        Book {
+            bookmaker: bookmaker.to_string(),
+            prices: prices.iter().map(|&(name, price)| (name.to_string(), price)).collect(),
+        }
+    }
+
+    #[test]
+    fn margins_are_removed() {
+        let fair = normalize(&book("a", &[("Home", 1.8), ("Away", 1.8)])).unwrap();
+        assert_eq!(fair, [("Away".to_string(), 0.5), ("Home".to_string(), 0.5)]);
+
+        assert!(normalize(&book("a", &[("Home", 1.0), ("Away", 9.0)])).is_none());
+        assert!(normalize(&book("a", &[("Home", f64::NAN), ("Away", 2.0)])).is_none());
+        assert!(normalize(&book("a", &[("Home", 2.0)])).is_none());
+    }
+
+    #[test]
+    fn books_are_averaged() {
+        let books = [
+            book("b", &[("Home", 2.0), ("Away", 2.0)]),
+            book("a", &[("Home", 1.5), ("Away", 3.0)]),
+            // Suspended, left out
+            book("c", &[("Home", 1.0), ("Away", 1.0)]),
+        ];
+        let (probabilities, used) = consensus(&books).unwrap();
+        assert_eq!(used, 2);
+        assert_eq!(probabilities, [("Away".to_string(), 416_667), ("Home".to_string(), 583_333)]);
+    }
+
+    #[test]
+    fn the_majority_line_wins() {
+        let books = [
+            book("a", &[("Home", 2.0), ("Away", 2.0)]),
+            book("b", &[("Home", 3.0), ("Draw", 3.0), ("Away", 3.0)]),
+            book("c", &[("Home", 3.0), ("Draw", 3.0), ("Away", 3.0)]),
+        ];
+        let (probabilities, used) = consensus(&books).unwrap();
+        assert_eq!(used, 2);
+        let names: Vec<&str> = probabilities.iter().map(|(name, _)| name.as_str()).collect();
+        assert_eq!(names, ["Away", "Draw", "Home"]);
+
+        assert_eq!(
+            consensus(&[book("a", &[("Home", 1.0), ("Away", 2.0)])]).unwrap_err().to_string(),
+            "no bookmaker quotes a complete market"
+        );
+    }
+
+    #[test]
+    fn scaled_probabilities_sum_to_the_scale() {
+        assert_eq!(largest_remainder(&[0.5, 0.5]), [500_000, 500_000]);
+        assert_eq!(largest_remainder(&[0.1, 0.2, 0.7]).iter().sum::<u64>(), PROBABILITY_SCALE);
+        // Remainders go to the largest fractional parts
+        assert_eq!(largest_remainder(&[2.0, 1.0]), [666_667, 333_333]);
+        assert_eq!(largest_remainder(&[1.0, 1.0, 1.0]), [333_334, 333_333, 333_333]);
+    }
+}
@@ -0,0 +1,166 @@
+//! Supported commodities and the units they are quoted in.
+//!
+//! Prices are normalized to USD per the commodity's standard unit: troy
+//! ounces for precious metals, barrels for crude oil.
+
+use anyhow::{anyhow, Result};
+use serde::{Deserialize, Serialize};
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize, Deserialize)]
+pub enum Commodity {
+    #[serde(rename = "XAU")]
+    Gold,
+    #[serde(rename = "XAG")]
+    Silver,
+    #[serde(rename = "WTIOIL")]
+    Wti,
+    #[serde(rename = "BRENTOIL")]
+    Brent,
+}
+
+impl Commodity {
+    /// Symbol used by commodities APIs
+    pub fn symbol(self) -> &'static str {
+        match self {
+            Self::Gold => "XAU",
+            Self::Silver => "XAG",
+            Self::Wti => "WTIOIL",
+            Self::Brent => "BRENTOIL",
+        }
+    }
+
+    pub fn standard_unit(self) -> Unit {
+        match self {
+            Self::Gold | Self::Silver => Unit::TroyOunce,
+            Self::Wti | Self::Brent => Unit::Barrel,
+        }
+    }
+
+    /// Accepts symbols and common names, ignoring case: `XAU`, `gold`, `oil`, ...
+    pub fn parse(s: &str) -> Result<Self> {
+        match s.trim().to_ascii_lowercase().as_str() {
+            "xau" | "gold" => Ok(Self::Gold),
+            "xag" | "silver" => Ok(Self::Silver),
+            "wtioil" | "wti" | "oil" => Ok(Self::Wti),
+            "brentoil" | "brent" => Ok(Self::Brent),
+            _ => Err(anyhow!("unsupported commodity {s:?}, expected gold, silver, wti or brent")),
+        }
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum Unit {
+    TroyOunce,
+    Gram,
+    Kilogram,
+    Barrel,
+    Gallon,
+}
+
+/// Grams in a troy ounce
+const GRAMS_PER_TROY_OUNCE: f64 = 31.103_476_8;
+
+/// US gallons in an oil barrel
+const GALLONS_PER_BARREL: f64 = 42.0;
+
+impl Unit {
+    pub fn parse(s: &str) -> Result<Self> {
+        match s.trim() {
+            "troy_ounce" | "oz" => Ok(Self::TroyOunce),
+            "gram" | "g" => Ok(Self::Gram),
+            "kilogram" | "kg" => Ok(Self::Kilogram),
+            "barrel" | "bbl" => Ok(Self::Barrel),
+            "gallon" | "gal" => Ok(Self::Gallon),
+            _ => Err(anyhow!("unsupported unit {s:?}")),
+        }
+    }
+
+    pub fn name(self) -> &'static str {
+        match self {
+            Self::TroyOunce => "troy_ounce",
+            Self::Gram => "gram",
+            Self::Kilogram => "kilogram",
+            Self::Barrel => "barrel",
+            Self::Gallon => "gallon",
+        }
+    }
+
+    /// How many of `self` make up one `standard` unit, `None` when the units
+    /// measure different things
+    pub fn per(self, standard: Unit) -> Option<f64> {
+        match (self, standard) {
+            (a, b) if a == b => Some(1.0),
+            (Self::Gram, Self::TroyOunce) => Some(GRAMS_PER_TROY_OUNCE),
+            (Self::Kilogram, Self::TroyOunce) => Some(GRAMS_PER_TROY_OUNCE / 1000.0),
+            (Self::Gallon, Self::Barrel) => Some(GALLONS_PER_BARREL),
+            _ => None,
+        }
+    }
+}
+
+/// Converts a USD price per `quoted` unit into USD per the commodity's
+/// standard unit
+pub fn normalize(commodity: Commodity, price: f64, quoted: Unit) -> Result<f64> {
+    let standard = commodity.standard_unit();
+    let factor = quoted.per(standard).ok_or_else(|| {
+        anyhow!(
+            "{} is quoted per {}, which can't be converted to {}",
+            commodity.symbol(),
+            quoted.name(),
+            standard.name()
+        )
+    })?;
+    Ok(price * factor)
+}
+
+/// Parses the `quote_units` kv config, e.g. `XAU=gram,WTIOIL=gallon`, naming
+/// the unit the API quotes each commodity in when it is not the standard one
+pub fn parse_quote_units(s: &str) -> Result<Vec<(Commodity, Unit)>> {
+    s.split(',')
+        .filter(|entry| !entry.trim().is_empty())
+        .map(|entry| {
+            let (commodity, unit) = entry.split_once('=').ok_or_else(|| {
+                anyhow!("invalid quote_units entry {entry:?}, expected SYMBOL=unit")
+            })?;
+            Ok((Commodity::parse(commodity)?, Unit::parse(unit)?))
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn commodities_parse_by_symbol_or_name() {
+        assert_eq!(Commodity::parse(" Gold ").unwrap(), Commodity::Gold);
+        assert_eq!(Commodity::parse("XAG").unwrap(), Commodity::Silver);
+        assert_eq!(Commodity::parse("oil").unwrap(), Commodity::Wti);
+        assert_eq!(Commodity::parse("brentoil").unwrap(), Commodity::Brent);
+        assert!(Commodity::parse("copper").is_err());
+        assert_eq!(serde_json::to_value(Commodity::Wti).unwrap(), "WTIOIL");
+    }
+
+    #[test]
+    fn prices_normalize_to_the_standard_unit() {
+        assert_eq!(normalize(Commodity::Gold, 2.0, Unit::TroyOunce).unwrap(), 2.0);
+        assert_eq!(normalize(Commodity::Gold, 1.0, Unit::Gram).unwrap(), GRAMS_PER_TROY_OUNCE);
+        assert_eq!(normalize(Commodity::Brent, 2.0, Unit::Gallon).unwrap(), 84.0);
+        assert_eq!(
+            normalize(Commodity::Wti, 1.0, Unit::Gram).unwrap_err().to_string(),
+            "WTIOIL is quoted per gram, which can't be converted to barrel"
+        );
+    }
+
+    #[test]
+    fn quote_units_parse() {
+        assert_eq!(
+            parse_quote_units("XAU=gram, wti=gal,").unwrap(),
+            [(Commodity::Gold, Unit::Gram), (Commodity::Wti, Unit::Gallon)]
+        );
+        assert!(parse_quote_units("").unwrap().is_empty());
+        assert!(parse_quote_units("XAU").is_err());
+        assert!(parse_quote_units("XAU=stone").is_err());
+    }
+}
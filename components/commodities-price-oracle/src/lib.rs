@@ -0,0 +1,389 @@
+mod commodities;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_primitives::U256;
+use alloy_sol_types::SolValue;
+use commodities::{Commodity, Unit};
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    fixed_point::{self, Rounding},
+    http::{self, fetch_json},
+    mirrors::Mirrors,
+    output::{self, Computed},
+    panic_guard, proxy,
+    sanity::PriceBounds,
+    secret::Secret,
+};
+use serde::{Deserialize, Serialize};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::{http::HeaderValue, runtime::block_on};
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["price"];
+
+/// Commodities API serving `/api/latest`, overridable with the
+/// `commodities_base_urls` mirrors
+const DEFAULT_API_BASE: &str = "https://commodities-api.com";
+
+/// API key passed as `access_key`
+const API_KEY_ENV: &str = "WAVS_ENV_COMMODITIES_API_KEY";
+
+/// Commodities priced when the input is empty, overridable with `commodities`
+const DEFAULT_COMMODITIES: &[&str] = &["XAU", "XAG", "WTIOIL"];
+
+/// Decimals of the fixed-point prices, overridable with `price_decimals`
+const DEFAULT_PRICE_DECIMALS: u8 = 8;
+
+/// Oldest quote accepted, overridable with `max_price_age_secs`
+const DEFAULT_MAX_PRICE_AGE_SECS: u64 = 3600;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let commodities = parse_commodities(input.trim_end_matches('\0'))?;
+    println!("commodities: {:?}", commodities);
+
+    let config = PriceConfig::from_env()?;
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(get_prices(&ctx, &config, &commodities))?;
+        println!("report: {:?}", report);
+
+        let symbols: Vec<&str> = report.prices.iter().map(|p| p.symbol.symbol()).collect();
+        let feed_id = format!("commodities:{}", symbols.join(","));
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload: Vec<solidity::CommodityPrice> = report
+                    .prices
+                    .iter()
+                    .map(|p| solidity::CommodityPrice {
+                        symbol: p.symbol.symbol().to_string(),
+                        unit: p.unit.name().to_string(),
+                        price: p.price,
+                        decimals: report.decimals,
+                        timestamp: report.timestamp,
+                    })
+                    .collect();
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// Reads the comma or whitespace separated commodities of the input, or the
+/// comma separated `commodities` kv config when the input is empty
+fn parse_commodities(input: &str) -> Result<Vec<Commodity>, String> {
+    let list = if input.trim().is_empty() {
+        config::list("commodities")
+            .unwrap_or_else(|| DEFAULT_COMMODITIES.iter().map(|c| c.to_string()).collect())
+    } else {
+        input.split(|c: char| c == ',' || c.is_whitespace()).map(str::to_string).collect()
+    };
+    let mut commodities = list
+        .iter()
+        .filter(|s| !s.is_empty())
+        .map(|s| Commodity::parse(s))
+        .collect::<anyhow::Result<Vec<_>>>()
+        .map_err(|e| e.to_string())?;
+    commodities.sort();
+    commodities.dedup();
+    if commodities.is_empty() {
+        return Err("No commodities requested".to_string());
+    }
+    Ok(commodities)
+}
+
+struct PriceConfig {
+    api_key: Secret,
+    decimals: u8,
+    max_age_secs: u64,
+    quote_units: Vec<(Commodity, Unit)>,
+}
+
+impl PriceConfig {
+    fn from_env() -> Result<Self, String> {
+        let api_key = Secret::required(API_KEY_ENV).map_err(|e| e.to_string())?;
+        let decimals = config::parse_or("price_decimals", DEFAULT_PRICE_DECIMALS)
+            .map_err(|e| e.to_string())?;
+        // Beyond 18 decimals f64 quotes carry no more precision
+        if decimals > 18 {
+            return Err(format!("price_decimals {} is above 18", decimals));
+        }
+        let max_age_secs = config::parse_or("max_price_age_secs", DEFAULT_MAX_PRICE_AGE_SECS)
+            .map_err(|e| e.to_string())?;
+        let quote_units = commodities::parse_quote_units(&config::string_or("quote_units", ""))
+            .map_err(|e| e.to_string())?;
+        Ok(Self { api_key, decimals, max_age_secs, quote_units })
+    }
+
+    fn quoted_unit(&self, commodity: Commodity) -> Unit {
+        self.quote_units
+            .iter()
+            .find(|(c, _)| *c == commodity)
+            .map(|(_, unit)| *unit)
+            .unwrap_or_else(|| commodity.standard_unit())
+    }
+}
+
+/// `/api/latest` response; rates are commodity units per USD
+#[derive(Debug, Deserialize)]
+struct LatestResponse {
+    data: LatestRates,
+}
+
+#[derive(Debug, Deserialize)]
+struct LatestRates {
+    #[serde(default = "default_success")]
+    success: bool,
+    timestamp: u64,
+    base: String,
+    rates: std::collections::BTreeMap<String, f64>,
+}
+
+fn default_success() -> bool {
+    true
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct CommodityQuote {
+    symbol: Commodity,
+    unit: Unit,
+    /// USD per `unit`, fixed-point with the report's decimals
+    price: U256,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct PriceReport {
+    /// Unix seconds of the API quote
+    timestamp: u64,
+    decimals: u8,
+    prices: Vec<CommodityQuote>,
+}
+
+async fn get_prices(
+    ctx: &RunContext,
+    config: &PriceConfig,
+    commodities: &[Commodity],
+) -> Result<PriceReport, String> {
+    let symbols: Vec<&str> = commodities.iter().map(|c| c.symbol()).collect();
+    let path = format!(
+        "/api/latest?access_key={}&base=USD&symbols={}",
+        http::percent_encode(config.api_key.expose()),
+        symbols.join(",")
+    );
+    let mirrors = Mirrors::from_env("commodities", DEFAULT_API_BASE).map_err(|e| e.to_string())?;
+    let response: LatestResponse = mirrors
+        .fetch(ctx, &path, |url| async move {
+            let mut req = http_request_get(&url)?;
+            req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+            proxy::apply(&mut req)?;
+            fetch_json(req).await
+        })
+        .await
+        .map_err(|e| e.to_string())?;
+    let bounds = PriceBounds::from_env().map_err(|e| e.to_string())?;
+    price_report(config, commodities, response.data, ctx.clock().unix_secs(), &bounds)
+}
+
+/// Prices `commodities` in USD per standard unit from the `rates` quoted
+/// per USD
+fn price_report(
+    config: &PriceConfig,
+    commodities: &[Commodity],
+    rates: LatestRates,
+    now: u64,
+    bounds: &PriceBounds,
+) -> Result<PriceReport, String> {
+    if !rates.success || rates.base != "USD" {
+        return Err(format!("Unexpected commodities response with base {}", rates.base));
+    }
+
+    let age = now.saturating_sub(rates.timestamp);
+    if age > config.max_age_secs {
+        return Err(format!(
+            "Quotes are {}s old, above max_price_age_secs {}",
+            age, config.max_age_secs
+        ));
+    }
+
+    let mut prices = Vec::with_capacity(commodities.len());
+    for &commodity in commodities {
+        let rate = rates
+            .rates
+            .get(commodity.symbol())
+            .copied()
+            .ok_or_else(|| format!("No quote for {}", commodity.symbol()))?;
+        let quoted = config.quoted_unit(commodity);
+        let usd =
+            commodities::normalize(commodity, 1.0 / rate, quoted).map_err(|e| e.to_string())?;
+        // Also rejects the infinite or negative prices of zero or negative rates
+        let usd = bounds.check(commodity.symbol(), usd).map_err(|e| e.to_string())?;
+        prices.push(CommodityQuote {
+            symbol: commodity,
+            unit: commodity.standard_unit(),
+            price: fixed_point::from_f64(usd, config.decimals, Rounding::HalfUp)
+                .map_err(|e| format!("Price of {}: {}", commodity.symbol(), e))?,
+        });
+    }
+    Ok(PriceReport { timestamp: rates.timestamp, decimals: config.decimals, prices })
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // USD per `unit`, fixed-point with `decimals`
+        struct CommodityPrice {
+            string symbol;
+            string unit;
+            uint256 price;
+            uint8 decimals;
+            uint64 timestamp;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// Quote time of [`RATES`]
+    const QUOTED_AT: u64 = 1_735_689_600;
+
+    /// Units per USD; the reciprocals are exact
+    const RATES: &str = r#"{"data": {"success": true, "timestamp": 1735689600, "base": "USD",
+        "rates": {"XAU": 0.00048828125, "XAG": 0.03125, "WTIOIL": 0.5, "BRENTOIL": -0.0125}}}"#;
+
+    fn config(quote_units: &str) -> PriceConfig {
+        PriceConfig {
+            api_key: Secret::new("test-key"),
+            decimals: 8,
+            max_age_secs: DEFAULT_MAX_PRICE_AGE_SECS,
+            quote_units: commodities::parse_quote_units(quote_units).unwrap(),
+        }
+    }
+
+    fn rates(json: &str) -> LatestRates {
+        serde_json::from_str::<LatestResponse>(json).unwrap().data
+    }
+
+    fn report(config: &PriceConfig, commodities: &[Commodity]) -> Result<PriceReport, String> {
+        price_report(config, commodities, rates(RATES), QUOTED_AT + 60, &PriceBounds::default())
+    }
+
+    #[test]
+    fn commodities_parse_from_input() {
+        assert_eq!(
+            parse_commodities("oil, XAU gold\tsilver").unwrap(),
+            [Commodity::Gold, Commodity::Silver, Commodity::Wti]
+        );
+        assert_eq!(
+            parse_commodities("copper"),
+            Err(r#"unsupported commodity "copper", expected gold, silver, wti or brent"#
+                .to_string())
+        );
+    }
+
+    #[test]
+    fn default_commodities_when_none_are_given() {
+        assert_eq!(
+            parse_commodities(" ").unwrap(),
+            [Commodity::Gold, Commodity::Silver, Commodity::Wti]
+        );
+    }
+
+    #[test]
+    fn prices_are_usd_per_standard_unit() {
+        let report = report(&config(""), &[Commodity::Gold, Commodity::Silver]).unwrap();
+        assert_eq!((report.timestamp, report.decimals), (QUOTED_AT, 8));
+        let prices: Vec<(Commodity, Unit, U256)> =
+            report.prices.iter().map(|p| (p.symbol, p.unit, p.price)).collect();
+        assert_eq!(
+            prices,
+            [
+                (Commodity::Gold, Unit::TroyOunce, U256::from(204_800_000_000u64)),
+                (Commodity::Silver, Unit::TroyOunce, U256::from(3_200_000_000u64)),
+            ]
+        );
+    }
+
+    #[test]
+    fn quote_units_are_converted() {
+        let config = config("WTIOIL=gallon");
+        assert_eq!(config.quoted_unit(Commodity::Wti), Unit::Gallon);
+        assert_eq!(config.quoted_unit(Commodity::Gold), Unit::TroyOunce);
+
+        let report = report(&config, &[Commodity::Wti]).unwrap();
+        assert_eq!(report.prices[0].unit, Unit::Barrel);
+        assert_eq!(report.prices[0].price, U256::from(8_400_000_000u64));
+    }
+
+    #[test]
+    fn stale_or_foreign_quotes_fail() {
+        let config = config("");
+        let stale = price_report(
+            &config,
+            &[Commodity::Gold],
+            rates(RATES),
+            QUOTED_AT + 3_601,
+            &PriceBounds::default(),
+        );
+        assert_eq!(stale.unwrap_err(), "Quotes are 3601s old, above max_price_age_secs 3600");
+
+        let eur = rates(&RATES.replace("\"USD\"", "\"EUR\""));
+        let foreign =
+            price_report(&config, &[Commodity::Gold], eur, QUOTED_AT, &Default::default());
+        assert_eq!(foreign.unwrap_err(), "Unexpected commodities response with base EUR");
+
+        let failed = rates(&RATES.replace("true", "false"));
+        assert!(price_report(&config, &[Commodity::Gold], failed, QUOTED_AT, &Default::default())
+            .is_err());
+    }
+
+    #[test]
+    fn missing_or_insane_quotes_fail() {
+        let missing = price_report(
+            &config(""),
+            &[Commodity::Gold],
+            rates(&RATES.replace("\"XAU\"", "\"XPT\"")),
+            QUOTED_AT,
+            &PriceBounds::default(),
+        );
+        assert_eq!(missing.unwrap_err(), "No quote for XAU");
+
+        let negative = report(&config(""), &[Commodity::Brent]).unwrap_err();
+        assert!(negative.starts_with("SANITY_CHECK_FAILED"), "{negative}");
+
+        let bounds = PriceBounds { min: 1.0, max: 1_000.0 };
+        let high = price_report(&config(""), &[Commodity::Gold], rates(RATES), QUOTED_AT, &bounds);
+        assert!(high.unwrap_err().contains("price 2048 of XAU is outside 1 to 1000"));
+    }
+}
@@ -0,0 +1,58 @@
+//! Per-trigger hot paths: trigger event decoding, output ABI encoding and
+//! upstream JSON parsing. Run with `make bench`.
+
+use alloy_primitives::{Address, Bytes};
+use alloy_sol_types::{SolEvent, SolValue};
+use common::{canonical_json, trigger_compat};
+use criterion::{black_box, criterion_group, criterion_main, Criterion};
+
+mod solidity {
+    use alloy_sol_macro::sol;
+    pub use ITypes::*;
+
+    sol!("../../src/interfaces/ITypes.sol");
+}
+
+const CMC_DETAIL: &str = include_str!("fixtures/cmc_detail.json");
+
+fn trigger_event_data(payload_len: usize) -> Vec<u8> {
+    let info = solidity::TriggerInfo {
+        triggerId: 42,
+        creator: Address::repeat_byte(0x11),
+        data: Bytes::from(vec![0xab; payload_len]),
+    };
+    solidity::NewTrigger { _triggerInfo: info.abi_encode().into() }.encode_data()
+}
+
+fn decode(c: &mut Criterion) {
+    for len in [32, 1024] {
+        let data = trigger_event_data(len);
+        let topics = vec![solidity::NewTrigger::SIGNATURE_HASH.to_vec()];
+        c.bench_function(&format!("decode_trigger_event/{len}"), |b| {
+            b.iter(|| trigger_compat::decode_log(&topics, black_box(&data)).unwrap())
+        });
+    }
+}
+
+fn encode(c: &mut Criterion) {
+    let output =
+        canonical_json::to_vec(&serde_json::from_str::<serde_json::Value>(CMC_DETAIL).unwrap())
+            .unwrap();
+    c.bench_function("encode_trigger_output", |b| {
+        b.iter(|| {
+            solidity::DataWithId { triggerId: 42, data: black_box(&output).clone().into() }
+                .abi_encode()
+        })
+    });
+}
+
+fn json(c: &mut Criterion) {
+    c.bench_function("parse_price_feed", |b| {
+        b.iter(|| serde_json::from_str::<serde_json::Value>(black_box(CMC_DETAIL)).unwrap())
+    });
+    let value: serde_json::Value = serde_json::from_str(CMC_DETAIL).unwrap();
+    c.bench_function("canonical_json", |b| b.iter(|| canonical_json::to_vec(black_box(&value))));
+}
+
+criterion_group!(benches, decode, encode, json);
+criterion_main!(benches);
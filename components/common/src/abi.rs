@@ -0,0 +1,508 @@
+//! ABI encoding and decoding driven by a type descriptor known only at
+//! runtime.
+//!
+//! `sol!` needs the output types at compile time. A component that can target
+//! any consumer contract instead reads a descriptor such as
+//! `(uint256,string,uint64)` from its config and encodes a JSON value tree
+//! against it:
+//!
+//! - `uintN` / `intN`: integer or decimal / `0x` hex string;
+//! - `address`, `bytesN`, `bytes`: hex string;
+//! - `bool`, `string`: boolean, string;
+//! - `T[]`, `T[N]`, tuples: arrays, tuples with one element per component.
+//!
+//! The result is `abi.encode` of the descriptor's components, so a contract
+//! reads it with `abi.decode(data, (uint256, string, uint64))`. [`decode`]
+//! is the inverse, for reading contract data whose layout is configured.
+//!
+//! Only `alloy-primitives` is needed, not `alloy-dyn-abi` and its parser
+//! and EIP-712 machinery, which keeps the code compiled into every component
+//! small.
+
+use alloy_primitives::{hex, Address, I256, U256};
+use anyhow::{anyhow, Context, Result};
+use serde_json::Value;
+use std::fmt;
+
+/// An ABI type
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum AbiType {
+    /// `uintN`, with N bits
+    Uint(usize),
+    /// `intN`, with N bits
+    Int(usize),
+    Address,
+    Bool,
+    /// `bytesN`, with N bytes
+    FixedBytes(usize),
+    Bytes,
+    String,
+    /// `T[]`
+    Array(Box<AbiType>),
+    /// `T[N]`
+    FixedArray(Box<AbiType>, usize),
+    /// `(T1,T2,...)`
+    Tuple(Vec<AbiType>),
+}
+
+impl AbiType {
+    /// Parses a descriptor such as `(uint256,string,uint64[])`; `uint` and
+    /// `int` are `uint256` and `int256`
+    pub fn parse(descriptor: &str) -> Result<Self> {
+        let mut parser = Parser { s: descriptor, pos: 0 };
+        let ty = parser.parse_type()?;
+        parser.skip_whitespace();
+        if parser.pos != descriptor.len() {
+            return Err(anyhow!("unexpected {:?} in ABI type {descriptor:?}", parser.rest()));
+        }
+        Ok(ty)
+    }
+
+    /// Whether the encoding is referenced by offset rather than inline
+    pub fn is_dynamic(&self) -> bool {
+        match self {
+            Self::Bytes | Self::String | Self::Array(_) => true,
+            Self::FixedArray(inner, _) => inner.is_dynamic(),
+            Self::Tuple(types) => types.iter().any(Self::is_dynamic),
+            _ => false,
+        }
+    }
+
+    /// Bytes taken in the head of the enclosing sequence
+    fn head_size(&self) -> usize {
+        match self {
+            _ if self.is_dynamic() => 32,
+            Self::FixedArray(inner, len) => inner.head_size().saturating_mul(*len),
+            Self::Tuple(types) => types.iter().map(Self::head_size).sum(),
+            _ => 32,
+        }
+    }
+}
+
+/// Canonical form, as used in function and event signatures
+impl fmt::Display for AbiType {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Self::Uint(bits) => write!(f, "uint{bits}"),
+            Self::Int(bits) => write!(f, "int{bits}"),
+            Self::Address => f.write_str("address"),
+            Self::Bool => f.write_str("bool"),
+            Self::FixedBytes(len) => write!(f, "bytes{len}"),
+            Self::Bytes => f.write_str("bytes"),
+            Self::String => f.write_str("string"),
+            Self::Array(inner) => write!(f, "{inner}[]"),
+            Self::FixedArray(inner, len) => write!(f, "{inner}[{len}]"),
+            Self::Tuple(types) => {
+                f.write_str("(")?;
+                for (i, ty) in types.iter().enumerate() {
+                    if i > 0 {
+                        f.write_str(",")?;
+                    }
+                    write!(f, "{ty}")?;
+                }
+                f.write_str(")")
+            }
+        }
+    }
+}
+
+struct Parser<'a> {
+    s: &'a str,
+    pos: usize,
+}
+
+impl<'a> Parser<'a> {
+    fn rest(&self) -> &'a str {
+        &self.s[self.pos..]
+    }
+
+    fn skip_whitespace(&mut self) {
+        let rest = self.rest();
+        self.pos += rest.len() - rest.trim_start().len();
+    }
+
+    fn eat(&mut self, c: char) -> bool {
+        self.skip_whitespace();
+        if self.rest().starts_with(c) {
+            self.pos += 1;
+            true
+        } else {
+            false
+        }
+    }
+
+    fn parse_type(&mut self) -> Result<AbiType> {
+        let mut ty = if self.eat('(') {
+            let mut types = Vec::new();
+            if !self.eat(')') {
+                loop {
+                    types.push(self.parse_type()?);
+                    if self.eat(')') {
+                        break;
+                    }
+                    if !self.eat(',') {
+                        return Err(anyhow!("expected , or ) in ABI type {:?}", self.s));
+                    }
+                }
+            }
+            AbiType::Tuple(types)
+        } else {
+            self.parse_elementary()?
+        };
+
+        while self.eat('[') {
+            let end = self.rest().find(']').ok_or_else(|| anyhow!("unclosed [ in {:?}", self.s))?;
+            let len = self.rest()[..end].trim();
+            ty = match len {
+                "" => AbiType::Array(Box::new(ty)),
+                len => {
+                    let len = len.parse().with_context(|| format!("invalid array length {len}"))?;
+                    AbiType::FixedArray(Box::new(ty), len)
+                }
+            };
+            self.pos += end + 1;
+        }
+        Ok(ty)
+    }
+
+    fn parse_elementary(&mut self) -> Result<AbiType> {
+        self.skip_whitespace();
+        let rest = self.rest();
+        let end = rest.find(|c: char| !c.is_ascii_alphanumeric()).unwrap_or(rest.len());
+        let name = &rest[..end];
+        self.pos += end;
+
+        let size = |prefix: &str| -> Result<Option<usize>> {
+            match &name[prefix.len()..] {
+                "" => Ok(None),
+                n => n.parse().map(Some).map_err(|_| anyhow!("unknown ABI type {name:?}")),
+            }
+        };
+        let bits = |prefix: &str| -> Result<usize> {
+            let bits = size(prefix)?.unwrap_or(256);
+            if bits == 0 || bits > 256 || bits % 8 != 0 {
+                return Err(anyhow!("invalid integer size in {name:?}"));
+            }
+            Ok(bits)
+        };
+        match name {
+            "address" => Ok(AbiType::Address),
+            "bool" => Ok(AbiType::Bool),
+            "string" => Ok(AbiType::String),
+            "bytes" => Ok(AbiType::Bytes),
+            _ if name.starts_with("uint") => Ok(AbiType::Uint(bits("uint")?)),
+            _ if name.starts_with("int") => Ok(AbiType::Int(bits("int")?)),
+            _ if name.starts_with("bytes") => match size("bytes")? {
+                Some(len @ 1..=32) => Ok(AbiType::FixedBytes(len)),
+                _ => Err(anyhow!("invalid size in {name:?}")),
+            },
+            "" => Err(anyhow!("expected a type at {:?} in {:?}", self.rest(), self.s)),
+            _ => Err(anyhow!("unknown ABI type {name:?}")),
+        }
+    }
+}
+
+/// `abi.encode` of `value` as the components of `ty`; a type other than a
+/// tuple is encoded as the only component
+pub fn encode(ty: &AbiType, value: &Value) -> Result<Vec<u8>> {
+    match ty {
+        AbiType::Tuple(types) => encode_tuple(types, value),
+        ty => encode_sequence(std::slice::from_ref(ty), std::slice::from_ref(value)),
+    }
+}
+
+fn encode_tuple(types: &[AbiType], value: &Value) -> Result<Vec<u8>> {
+    let values = value.as_array().ok_or_else(|| anyhow!("expected an array, got {value}"))?;
+    if values.len() != types.len() {
+        return Err(anyhow!("expected {} tuple components, got {}", types.len(), values.len()));
+    }
+    encode_sequence(types, values)
+}
+
+/// Heads of all items followed by the tails of the dynamic ones
+fn encode_sequence(types: &[AbiType], values: &[Value]) -> Result<Vec<u8>> {
+    let head_size: usize = types.iter().map(AbiType::head_size).sum();
+    let (mut head, mut tail) = (Vec::with_capacity(head_size), Vec::new());
+    for (i, (ty, value)) in types.iter().zip(values).enumerate() {
+        let encoded = encode_value(ty, value).with_context(|| format!("component {i} ({ty})"))?;
+        if ty.is_dynamic() {
+            head.extend_from_slice(&word(U256::from(head_size + tail.len())));
+            tail.extend(encoded);
+        } else {
+            head.extend(encoded);
+        }
+    }
+    head.extend(tail);
+    Ok(head)
+}
+
+fn encode_value(ty: &AbiType, value: &Value) -> Result<Vec<u8>> {
+    match ty {
+        AbiType::Uint(bits) => {
+            let n = uint(value)?;
+            if n.bit_len() > *bits {
+                return Err(anyhow!("{n} does not fit uint{bits}"));
+            }
+            Ok(word(n).to_vec())
+        }
+        AbiType::Int(bits) => {
+            let n = int(value)?;
+            if !fits_int(n, *bits) {
+                return Err(anyhow!("{n} does not fit int{bits}"));
+            }
+            Ok(word(n.into_raw()).to_vec())
+        }
+        AbiType::Address => {
+            let address: Address =
+                string(value)?.parse().with_context(|| format!("invalid address {value}"))?;
+            Ok(address.into_word().to_vec())
+        }
+        AbiType::Bool => {
+            let b = value.as_bool().ok_or_else(|| anyhow!("expected a boolean, got {value}"))?;
+            Ok(word(U256::from(b as u8)).to_vec())
+        }
+        AbiType::FixedBytes(len) => {
+            let bytes = hex_bytes(value)?;
+            if bytes.len() != *len {
+                return Err(anyhow!("expected {len} bytes, got {}", bytes.len()));
+            }
+            Ok(padded(&bytes))
+        }
+        AbiType::Bytes => Ok(length_prefixed(&hex_bytes(value)?)),
+        AbiType::String => Ok(length_prefixed(string(value)?.as_bytes())),
+        AbiType::Array(inner) => {
+            let values =
+                value.as_array().ok_or_else(|| anyhow!("expected an array, got {value}"))?;
+            let types = vec![(**inner).clone(); values.len()];
+            let mut out = word(U256::from(values.len())).to_vec();
+            out.extend(encode_sequence(&types, values)?);
+            Ok(out)
+        }
+        AbiType::FixedArray(inner, len) => {
+            let values =
+                value.as_array().ok_or_else(|| anyhow!("expected an array, got {value}"))?;
+            if values.len() != *len {
+                return Err(anyhow!("expected {len} array items, got {}", values.len()));
+            }
+            encode_sequence(&vec![(**inner).clone(); *len], values)
+        }
+        AbiType::Tuple(types) => encode_tuple(types, value),
+    }
+}
+
+fn uint(value: &Value) -> Result<U256> {
+    match value {
+        Value::Number(n) => {
+            n.as_u64().map(U256::from).ok_or_else(|| anyhow!("{n} is not an unsigned integer"))
+        }
+        Value::String(s) => s.trim().parse().with_context(|| format!("invalid integer {s:?}")),
+        _ => Err(anyhow!("expected an integer, got {value}")),
+    }
+}
+
+fn int(value: &Value) -> Result<I256> {
+    match value {
+        Value::Number(n) => n
+            .as_i64()
+            .map(I256::try_from)
+            .and_then(Result::ok)
+            .ok_or_else(|| anyhow!("{n} is not an integer")),
+        Value::String(s) => s.trim().parse().with_context(|| format!("invalid integer {s:?}")),
+        _ => Err(anyhow!("expected an integer, got {value}")),
+    }
+}
+
+fn fits_int(n: I256, bits: usize) -> bool {
+    // Two's complement of a negative n is its magnitude minus one, inverted
+    let magnitude = if n.is_negative() { !n.into_raw() } else { n.into_raw() };
+    magnitude.bit_len() < bits
+}
+
+fn string(value: &Value) -> Result<&str> {
+    value.as_str().ok_or_else(|| anyhow!("expected a string, got {value}"))
+}
+
+fn hex_bytes(value: &Value) -> Result<Vec<u8>> {
+    let s = string(value)?;
+    hex::decode(s).with_context(|| format!("invalid hex {s:?}"))
+}
+
+fn word(n: U256) -> [u8; 32] {
+    n.to_be_bytes()
+}
+
+/// `bytes` right-padded to a multiple of 32
+fn padded(bytes: &[u8]) -> Vec<u8> {
+    let mut out = bytes.to_vec();
+    out.resize(bytes.len().div_ceil(32) * 32, 0);
+    out
+}
+
+fn length_prefixed(bytes: &[u8]) -> Vec<u8> {
+    let mut out = word(U256::from(bytes.len())).to_vec();
+    out.extend(padded(bytes));
+    out
+}
+
+/// Values [`decode`] produces at most. Offsets of nested dynamic values may
+/// all point at the same data, so without a cap a few hundred bytes could
+/// describe millions of items.
+pub const MAX_DECODED_VALUES: usize = 1 << 16;
+
+/// Arrays and tuples [`decode`] follows into at most
+pub const MAX_DECODE_DEPTH: usize = 32;
+
+/// Decodes `abi.encode` of the components of `ty` into the JSON value tree
+/// [`encode`] takes. Integers become decimal strings, so that no precision
+/// is lost, addresses are checksummed and bytes `0x` hex.
+///
+/// Offsets and lengths are checked against `data`, and values against their
+/// type (e.g. the padding of a `uint8`), so untrusted input fails cleanly.
+/// The work is bounded by [`MAX_DECODED_VALUES`] and [`MAX_DECODE_DEPTH`].
+pub fn decode(ty: &AbiType, data: &[u8]) -> Result<Value> {
+    let mut budget = Budget { values: MAX_DECODED_VALUES, depth: 0 };
+    match ty {
+        AbiType::Tuple(types) => budget.sequence(types.iter(), data).map(Value::Array),
+        ty => Ok(budget.sequence(std::iter::once(ty), data)?.remove(0)),
+    }
+}
+
+/// What is left of the bounds of one [`decode`]
+struct Budget {
+    values: usize,
+    depth: usize,
+}
+
+impl Budget {
+    fn sequence<'a>(
+        &mut self,
+        types: impl ExactSizeIterator<Item = &'a AbiType>,
+        data: &[u8],
+    ) -> Result<Vec<Value>> {
+        if types.len() > self.values {
+            return Err(anyhow!("more than {MAX_DECODED_VALUES} values"));
+        }
+        let mut head = 0usize;
+        let mut values = Vec::with_capacity(types.len());
+        for (i, ty) in types.enumerate() {
+            let context = || format!("component {i} ({ty})");
+            let value = if ty.is_dynamic() {
+                let offset = read_usize(data, head).with_context(context)?;
+                let tail =
+                    data.get(offset..).ok_or_else(|| anyhow!("offset {offset} out of range"));
+                self.value(ty, tail.with_context(context)?)
+            } else {
+                self.value(ty, data.get(head..).unwrap_or_default())
+            };
+            values.push(value.with_context(context)?);
+            head = head.saturating_add(ty.head_size());
+        }
+        Ok(values)
+    }
+
+    fn value(&mut self, ty: &AbiType, data: &[u8]) -> Result<Value> {
+        self.values = self
+            .values
+            .checked_sub(1)
+            .ok_or_else(|| anyhow!("more than {MAX_DECODED_VALUES} values"))?;
+        match ty {
+            AbiType::Array(_) | AbiType::FixedArray(..) | AbiType::Tuple(_) => {
+                if self.depth == MAX_DECODE_DEPTH {
+                    return Err(anyhow!("nested deeper than {MAX_DECODE_DEPTH}"));
+                }
+                self.depth += 1;
+                let value = self.nested(ty, data);
+                self.depth -= 1;
+                value
+            }
+            ty => decode_value(ty, data),
+        }
+    }
+
+    fn nested(&mut self, ty: &AbiType, data: &[u8]) -> Result<Value> {
+        match ty {
+            AbiType::Array(inner) => {
+                let len = read_usize(data, 0)?;
+                // Every item has its head in the data, which bounds the items
+                let items = &data[32..];
+                if !len.checked_mul(inner.head_size()).is_some_and(|size| size <= items.len()) {
+                    return Err(anyhow!("array length {len} out of range"));
+                }
+                self.sequence((0..len).map(|_| &**inner), items).map(Value::Array)
+            }
+            AbiType::FixedArray(inner, len) => {
+                self.sequence((0..*len).map(|_| &**inner), data).map(Value::Array)
+            }
+            AbiType::Tuple(types) => self.sequence(types.iter(), data).map(Value::Array),
+            _ => unreachable!("{ty} is not nested"),
+        }
+    }
+}
+
+/// Decodes a value that holds no other values
+fn decode_value(ty: &AbiType, data: &[u8]) -> Result<Value> {
+    match ty {
+        AbiType::Uint(bits) => {
+            let n = U256::from_be_bytes(read_word(data, 0)?);
+            if n.bit_len() > *bits {
+                return Err(anyhow!("{n} does not fit uint{bits}"));
+            }
+            Ok(Value::String(n.to_string()))
+        }
+        AbiType::Int(bits) => {
+            let n = I256::from_raw(U256::from_be_bytes(read_word(data, 0)?));
+            if !fits_int(n, *bits) {
+                return Err(anyhow!("{n} does not fit int{bits}"));
+            }
+            Ok(Value::String(n.to_string()))
+        }
+        AbiType::Address => {
+            let word = read_word(data, 0)?;
+            if word[..12].iter().any(|&b| b != 0) {
+                return Err(anyhow!("dirty address padding"));
+            }
+            Ok(Value::String(Address::from_slice(&word[12..]).to_checksum(None)))
+        }
+        AbiType::Bool => match U256::from_be_bytes(read_word(data, 0)?) {
+            n if n.is_zero() => Ok(Value::Bool(false)),
+            n if n == U256::from(1) => Ok(Value::Bool(true)),
+            n => Err(anyhow!("{n} is not a boolean")),
+        },
+        AbiType::FixedBytes(len) => {
+            let word = read_word(data, 0)?;
+            if word[*len..].iter().any(|&b| b != 0) {
+                return Err(anyhow!("dirty bytes{len} padding"));
+            }
+            Ok(Value::String(hex::encode_prefixed(&word[..*len])))
+        }
+        AbiType::Bytes => Ok(Value::String(hex::encode_prefixed(read_bytes(data)?))),
+        AbiType::String => {
+            let s = std::str::from_utf8(read_bytes(data)?).context("string is not UTF-8")?;
+            Ok(Value::String(s.to_string()))
+        }
+        AbiType::Array(_) | AbiType::FixedArray(..) | AbiType::Tuple(_) => {
+            unreachable!("{ty} is decoded by Budget::nested")
+        }
+    }
+}
+
+fn read_word(data: &[u8], at: usize) -> Result<[u8; 32]> {
+    at.checked_add(32)
+        .and_then(|end| data.get(at..end))
+        .map(|word| word.try_into().expect("32 bytes"))
+        .ok_or_else(|| anyhow!("data too short"))
+}
+
+fn read_usize(data: &[u8], at: usize) -> Result<usize> {
+    let n = U256::from_be_bytes(read_word(data, at)?);
+    usize::try_from(n).map_err(|_| anyhow!("{n} out of range"))
+}
+
+/// Contents of a length-prefixed `bytes` or `string`
+fn read_bytes(data: &[u8]) -> Result<&[u8]> {
+    let len = read_usize(data, 0)?;
+    32usize
+        .checked_add(len)
+        .and_then(|end| data.get(32..end))
+        .ok_or_else(|| anyhow!("length {len} out of range"))
+}
@@ -0,0 +1,75 @@
+//! Per-network deployment addresses, endpoints and decimals.
+//!
+//! The address book is supplied by the operator at deploy time instead of being
+//! compiled into the component, either inline through the `address_book` kv
+//! entry or as a JSON file referenced by `address_book_file`:
+//!
+//! ```json
+//! {
+//!   "local": {
+//!     "chain_id": 31337,
+//!     "submit_address": "0x5FbDB2315678afecb367f032d93F642f64180aa3",
+//!     "provider_endpoints": ["http://localhost:8545"],
+//!     "decimals": 8
+//!   }
+//! }
+//! ```
+
+use alloy_primitives::Address;
+use anyhow::{anyhow, Context, Result};
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+
+/// Deployment settings for a single network
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct NetworkEntry {
+    pub chain_id: u64,
+    pub submit_address: Address,
+    #[serde(default)]
+    pub provider_endpoints: Vec<String>,
+    #[serde(default = "default_decimals")]
+    pub decimals: u8,
+}
+
+fn default_decimals() -> u8 {
+    8
+}
+
+/// Network name to deployment settings
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+#[serde(transparent)]
+pub struct AddressBook(pub BTreeMap<String, NetworkEntry>);
+
+impl AddressBook {
+    pub fn from_json(json: &str) -> Result<Self> {
+        serde_json::from_str(json).context("invalid address book")
+    }
+
+    /// Loads the address book from the service config.
+    ///
+    /// Returns an empty book when neither `address_book` nor `address_book_file` is set.
+    pub fn from_env() -> Result<Self> {
+        if let Ok(json) = std::env::var("address_book") {
+            return Self::from_json(&json);
+        }
+        if let Ok(path) = std::env::var("address_book_file") {
+            let json = std::fs::read_to_string(&path)
+                .with_context(|| format!("failed to read address book {path}"))?;
+            return Self::from_json(&json);
+        }
+        Ok(Self::default())
+    }
+
+    /// Looks up a network by name, or by chain ID when `network` is numeric.
+    pub fn get(&self, network: &str) -> Option<&NetworkEntry> {
+        self.0.get(network).or_else(|| {
+            let chain_id: u64 = network.parse().ok()?;
+            self.0.values().find(|entry| entry.chain_id == chain_id)
+        })
+    }
+
+    /// Same as [`AddressBook::get`] but errors when the network is unknown.
+    pub fn require(&self, network: &str) -> Result<&NetworkEntry> {
+        self.get(network).ok_or_else(|| anyhow!("network {network} not found in address book"))
+    }
+}
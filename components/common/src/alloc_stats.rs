@@ -0,0 +1,132 @@
+//! Allocation counting for sizing component memory limits.
+//!
+//! Components opt in with their `alloc-profiling` cargo feature, which
+//! installs [`CountingAlloc`] as the global allocator. [`Profile`] then logs
+//! the allocations, peak heap and bytes still live at the end of each `run`;
+//! live bytes that keep growing across invocations of a reused instance
+//! point at a leak. The stats so far are also added to CLI output and to the
+//! record copied to `result_destinations` as `alloc_stats`; like the compute
+//! cost they differ between operators, so they never go into the on-chain
+//! result. Without the feature the profile is a no-op.
+
+use serde::Serialize;
+use std::{
+    alloc::{GlobalAlloc, Layout, System},
+    fmt,
+    sync::atomic::{AtomicBool, AtomicUsize, Ordering::Relaxed},
+};
+
+static ACTIVE: AtomicBool = AtomicBool::new(false);
+static ALLOCATIONS: AtomicUsize = AtomicUsize::new(0);
+static ALLOCATED: AtomicUsize = AtomicUsize::new(0);
+static LIVE: AtomicUsize = AtomicUsize::new(0);
+static PEAK: AtomicUsize = AtomicUsize::new(0);
+static LIVE_AT_START: AtomicUsize = AtomicUsize::new(0);
+
+/// The system allocator, counting every allocation
+pub struct CountingAlloc;
+
+impl CountingAlloc {
+    fn record_alloc(size: usize) {
+        ACTIVE.store(true, Relaxed);
+        ALLOCATIONS.fetch_add(1, Relaxed);
+        ALLOCATED.fetch_add(size, Relaxed);
+        let live = LIVE.fetch_add(size, Relaxed) + size;
+        PEAK.fetch_max(live, Relaxed);
+    }
+}
+
+unsafe impl GlobalAlloc for CountingAlloc {
+    unsafe fn alloc(&self, layout: Layout) -> *mut u8 {
+        let ptr = System.alloc(layout);
+        if !ptr.is_null() {
+            Self::record_alloc(layout.size());
+        }
+        ptr
+    }
+
+    unsafe fn alloc_zeroed(&self, layout: Layout) -> *mut u8 {
+        let ptr = System.alloc_zeroed(layout);
+        if !ptr.is_null() {
+            Self::record_alloc(layout.size());
+        }
+        ptr
+    }
+
+    unsafe fn dealloc(&self, ptr: *mut u8, layout: Layout) {
+        System.dealloc(ptr, layout);
+        LIVE.fetch_sub(layout.size(), Relaxed);
+    }
+
+    unsafe fn realloc(&self, ptr: *mut u8, layout: Layout, new_size: usize) -> *mut u8 {
+        let new_ptr = System.realloc(ptr, layout, new_size);
+        if !new_ptr.is_null() {
+            LIVE.fetch_sub(layout.size(), Relaxed);
+            Self::record_alloc(new_size);
+        }
+        new_ptr
+    }
+}
+
+/// Counters for one invocation
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+pub struct AllocStats {
+    pub allocations: usize,
+    pub allocated_bytes: usize,
+    pub peak_bytes: usize,
+    pub live_bytes: usize,
+    /// Live bytes gained since the invocation started
+    pub retained_bytes: isize,
+}
+
+impl fmt::Display for AllocStats {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "allocations={} allocated_bytes={} peak_bytes={} live_bytes={} retained_bytes={}",
+            self.allocations,
+            self.allocated_bytes,
+            self.peak_bytes,
+            self.live_bytes,
+            self.retained_bytes
+        )
+    }
+}
+
+/// Stats since the current [`Profile`] started, `None` when the counting
+/// allocator is not installed
+pub fn current() -> Option<AllocStats> {
+    if !ACTIVE.load(Relaxed) {
+        return None;
+    }
+    let live = LIVE.load(Relaxed);
+    Some(AllocStats {
+        allocations: ALLOCATIONS.load(Relaxed),
+        allocated_bytes: ALLOCATED.load(Relaxed),
+        peak_bytes: PEAK.load(Relaxed),
+        live_bytes: live,
+        retained_bytes: live as isize - LIVE_AT_START.load(Relaxed) as isize,
+    })
+}
+
+/// Logs the allocation stats of its scope when dropped
+pub struct Profile(());
+
+impl Profile {
+    pub fn start() -> Self {
+        let live = LIVE.load(Relaxed);
+        ALLOCATIONS.store(0, Relaxed);
+        ALLOCATED.store(0, Relaxed);
+        PEAK.store(live, Relaxed);
+        LIVE_AT_START.store(live, Relaxed);
+        Self(())
+    }
+}
+
+impl Drop for Profile {
+    fn drop(&mut self) {
+        if let Some(stats) = current() {
+            println!("alloc profile: {stats}");
+        }
+    }
+}
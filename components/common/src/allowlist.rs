@@ -0,0 +1,116 @@
+//! Restricts which trigger contracts and creators a component serves.
+//!
+//! Any contract can emit a log with the trigger event's signature, so set
+//! the `trigger_contract` kv config to the contract the service was deployed
+//! against, or comma-separated contracts, and events emitted by any other
+//! contract fail with `UNAUTHORIZED`.
+//!
+//! Set the `creator_allowlist` kv config to comma-separated addresses and
+//! chain triggers whose creator is not among them fail with
+//! `UNAUTHORIZED`, before any upstream request is made. Without it every
+//! creator is served. Triggers from contracts that predate the creator field
+//! carry none and are refused while an allowlist is set.
+
+use crate::{config, types::ErrorCode};
+use alloy_primitives::Address;
+use anyhow::{anyhow, Result};
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct CreatorAllowlist {
+    creators: Vec<Address>,
+}
+
+impl CreatorAllowlist {
+    /// Reads `creator_allowlist`, `None` when it is unset
+    pub fn from_env() -> Result<Option<Self>> {
+        let Some(entries) = config::list("creator_allowlist") else {
+            return Ok(None);
+        };
+        let creators = entries
+            .iter()
+            .map(|entry| {
+                entry.parse().map_err(|e| anyhow!("invalid creator_allowlist entry {entry}: {e}"))
+            })
+            .collect::<Result<Vec<Address>>>()?;
+        if creators.is_empty() {
+            return Err(anyhow!("creator_allowlist is empty"));
+        }
+        Ok(Some(Self { creators }))
+    }
+
+    pub fn allows(&self, creator: &Address) -> bool {
+        self.creators.contains(creator)
+    }
+
+    /// Fails with [`ErrorCode::Unauthorized`] unless `creator` is listed
+    pub fn check(&self, creator: Option<Address>) -> Result<()> {
+        match creator {
+            Some(creator) if self.allows(&creator) => Ok(()),
+            Some(creator) => Err(anyhow!(
+                ErrorCode::Unauthorized.error(format!("creator {creator} not allowed"))
+            )),
+            None => Err(anyhow!(ErrorCode::Unauthorized
+                .error("trigger has no creator to check against creator_allowlist"))),
+        }
+    }
+}
+
+/// Checks a chain trigger's creator against the configured allowlist, if any
+pub fn check_creator(creator: Option<Address>) -> Result<()> {
+    match CreatorAllowlist::from_env()? {
+        Some(allowlist) => allowlist.check(creator),
+        None => Ok(()),
+    }
+}
+
+/// The contracts whose trigger events are served
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct TriggerContracts {
+    contracts: Vec<Address>,
+}
+
+impl TriggerContracts {
+    pub fn new(contracts: Vec<Address>) -> Result<Self> {
+        if contracts.is_empty() {
+            return Err(anyhow!("trigger_contract is empty"));
+        }
+        Ok(Self { contracts })
+    }
+
+    /// Reads `trigger_contract`, `None` when it is unset
+    pub fn from_env() -> Result<Option<Self>> {
+        let Some(entries) = config::list("trigger_contract") else {
+            return Ok(None);
+        };
+        let contracts = entries
+            .iter()
+            .map(|entry| {
+                entry.parse().map_err(|e| anyhow!("invalid trigger_contract {entry}: {e}"))
+            })
+            .collect::<Result<Vec<Address>>>()?;
+        Self::new(contracts).map(Some)
+    }
+
+    /// Fails with [`ErrorCode::Unauthorized`] unless the 20-byte `contract`
+    /// is listed
+    pub fn check(&self, contract: &[u8]) -> Result<()> {
+        let emitter: Address = contract
+            .try_into()
+            .map_err(|_| anyhow!("trigger contract address is {} bytes", contract.len()))?;
+        if !self.contracts.contains(&emitter) {
+            return Err(anyhow!(ErrorCode::Unauthorized.error(format!(
+                "event emitted by {emitter}, not the configured trigger_contract"
+            ))));
+        }
+        Ok(())
+    }
+}
+
+/// Checks the contract that emitted a chain trigger against
+/// `trigger_contract`, if set
+pub fn check_emitter(contract: &[u8]) -> Result<()> {
+    match TriggerContracts::from_env()? {
+        Some(contracts) => contracts.check(contract),
+        None => Ok(()),
+    }
+}
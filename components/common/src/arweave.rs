@@ -0,0 +1,103 @@
+//! Arweave transaction data retrieval with gateway failover and size limits.
+
+use crate::{http::fetch_bytes_limited, proxy};
+use anyhow::{anyhow, Context, Result};
+use wavs_wasi_chain::http::http_request_get;
+
+/// Gateways tried in order when `arweave_gateways` is not configured
+pub const DEFAULT_GATEWAYS: &[&str] = &["https://arweave.net", "https://ar-io.dev"];
+
+/// Largest payload fetched when `arweave_max_bytes` is not configured (1 MiB)
+pub const DEFAULT_MAX_BYTES: u64 = 1024 * 1024;
+
+/// Data of an Arweave transaction and the gateway that served it
+#[derive(Debug, Clone)]
+pub struct ArweaveContent {
+    pub tx_id: String,
+    pub gateway: String,
+    pub data: Vec<u8>,
+}
+
+/// Reads the comma separated `arweave_gateways` kv config, falling back to [`DEFAULT_GATEWAYS`]
+pub fn gateways_from_env() -> Vec<String> {
+    match std::env::var("arweave_gateways") {
+        Ok(gateways) => gateways
+            .split(',')
+            .map(|g| g.trim().trim_end_matches('/').to_string())
+            .filter(|g| !g.is_empty())
+            .collect(),
+        Err(_) => DEFAULT_GATEWAYS.iter().map(|g| g.to_string()).collect(),
+    }
+}
+
+/// Reads the `arweave_max_bytes` kv config, falling back to [`DEFAULT_MAX_BYTES`]
+pub fn max_bytes_from_env() -> Result<u64> {
+    match std::env::var("arweave_max_bytes") {
+        Ok(max) => max.parse().context("invalid arweave_max_bytes"),
+        Err(_) => Ok(DEFAULT_MAX_BYTES),
+    }
+}
+
+/// Transaction IDs are 32 bytes, base64url encoded without padding
+pub fn validate_tx_id(tx_id: &str) -> Result<()> {
+    let valid = tx_id.len() == 43
+        && tx_id.bytes().all(|b| b.is_ascii_alphanumeric() || b == b'-' || b == b'_');
+    if !valid {
+        return Err(anyhow!("invalid Arweave transaction id {tx_id}"));
+    }
+    Ok(())
+}
+
+/// Fetches the data of `tx_id`, trying each gateway in order.
+///
+/// The declared data size is checked against `max_bytes` before downloading.
+/// The gateway may lie about it, so the download stops at the declared size
+/// and must then have received exactly that many bytes.
+pub async fn fetch_tx_data(
+    tx_id: &str,
+    gateways: &[String],
+    max_bytes: u64,
+) -> Result<ArweaveContent> {
+    validate_tx_id(tx_id)?;
+    let mut last_err = anyhow!("no Arweave gateways configured");
+
+    for gateway in gateways {
+        match fetch_from_gateway(gateway, tx_id, max_bytes).await {
+            Ok(data) => {
+                return Ok(ArweaveContent {
+                    tx_id: tx_id.to_string(),
+                    gateway: gateway.clone(),
+                    data,
+                })
+            }
+            Err(e) => {
+                println!("gateway {gateway} failed: {e}");
+                last_err = e;
+            }
+        }
+    }
+    Err(last_err)
+}
+
+async fn fetch_from_gateway(gateway: &str, tx_id: &str, max_bytes: u64) -> Result<Vec<u8>> {
+    // A decimal number, 32 bytes is plenty
+    let size = get(&format!("{gateway}/tx/{tx_id}/data_size"), 32).await?;
+    let size = String::from_utf8(size)?;
+    let size: u64 = size.trim().parse().context("invalid data_size response")?;
+    if size > max_bytes {
+        return Err(anyhow!("transaction data is {size} bytes, limit is {max_bytes}"));
+    }
+
+    let limit = usize::try_from(size).context("transaction data too large")?;
+    let data = get(&format!("{gateway}/{tx_id}"), limit).await?;
+    if data.len() as u64 != size {
+        return Err(anyhow!("expected {size} bytes, gateway served {}", data.len()));
+    }
+    Ok(data)
+}
+
+async fn get(url: &str, max_bytes: usize) -> Result<Vec<u8>> {
+    let mut req = http_request_get(url)?;
+    proxy::apply(&mut req)?;
+    fetch_bytes_limited(req, max_bytes).await
+}
@@ -0,0 +1,172 @@
+//! Batched submission of several triggers' results.
+//!
+//! High-frequency triggers pay the fixed cost of a submission transaction for
+//! every answer. With `batch_size` above 1, chain-triggered results are held
+//! in `batch_state_dir` instead of being returned, and the run that fills the
+//! batch submits all of them at once as the `TriggerBatch` struct of
+//! `ITypes.sol`:
+//!
+//! ```text
+//! DataWithId(BATCH_TRIGGER_ID, abi.encode(TriggerBatch(triggerIds, results)))
+//! ```
+//!
+//! where each result is the data that trigger would have submitted on its
+//! own. `SimpleSubmit` recognizes the reserved [`BATCH_TRIGGER_ID`] and stores
+//! every result under its own trigger ID. A batch also goes out when its oldest result has waited
+//! `batch_max_wait_secs`, but only once another trigger arrives: a component
+//! runs per trigger and cannot wake itself up, so a quiet feed can keep
+//! results pending for longer.
+//!
+//! A batch that would exceed `max_submission_gas` goes out with as many of
+//! its oldest triggers as fit; the rest wait for the next run. A result too
+//! large to submit even on its own is dropped with an error, as it would fail
+//! without batching.
+//!
+//! Pending results live in the operator's local data directory, so operators
+//! that saw different triggers cut different batches. Batching suits
+//! deployments with one operator or with a submitter that tolerates that.
+
+use crate::{config, gas};
+use alloy_primitives::Bytes;
+use alloy_sol_types::SolValue;
+use anyhow::{anyhow, Context, Result};
+use serde::{Deserialize, Serialize};
+use std::path::PathBuf;
+
+/// Trigger ID of `DataWithId` outputs carrying a `TriggerBatch`; trigger
+/// contracts count up from 1 and never reach it
+pub const BATCH_TRIGGER_ID: u64 = u64::MAX;
+
+/// Seconds the oldest result may wait, overridable with `batch_max_wait_secs`
+pub const DEFAULT_MAX_WAIT_SECS: u64 = 60;
+
+const STATE_FILE: &str = "batch.json";
+
+pub struct Batcher {
+    dir: PathBuf,
+    size: usize,
+    max_wait_secs: u64,
+}
+
+/// A result waiting for its batch
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+struct Pending {
+    trigger_id: u64,
+    data: Bytes,
+    /// Unix seconds, at the run's clock
+    at: u64,
+}
+
+impl Batcher {
+    /// The batcher of the `batch_size` kv config, `None` unless it is above 1
+    pub fn from_env() -> Result<Option<Self>> {
+        let size: usize = config::parse_or("batch_size", 1)?;
+        if size <= 1 {
+            return Ok(None);
+        }
+        let dir: String = config::required("batch_state_dir")?;
+        let max_wait_secs = config::parse_or("batch_max_wait_secs", DEFAULT_MAX_WAIT_SECS)?;
+        Self::open(dir, size, max_wait_secs).map(Some)
+    }
+
+    pub fn open(dir: impl Into<PathBuf>, size: usize, max_wait_secs: u64) -> Result<Self> {
+        let dir = dir.into();
+        std::fs::create_dir_all(&dir)
+            .with_context(|| format!("failed to create batch state {}", dir.display()))?;
+        Ok(Self { dir, size, max_wait_secs })
+    }
+
+    /// Adds the `DataWithId` output of `trigger_id` to the batch. Returns the
+    /// batch's `DataWithId` output once it is due, `None` while it is pending.
+    pub fn push(&self, trigger_id: u64, output: &[u8], now: u64) -> Result<Option<Vec<u8>>> {
+        let (_, data) = <(u64, Bytes)>::abi_decode(output, true).context("invalid DataWithId")?;
+        let mut pending = self.load()?;
+        // A redelivered trigger replaces its earlier result
+        pending.retain(|p| p.trigger_id != trigger_id);
+        pending.push(Pending { trigger_id, data, at: now });
+        pending.sort_by_key(|p| p.trigger_id);
+        // Saved before anything can fail, so the result is never lost
+        self.save(&pending)?;
+
+        let oldest = pending.iter().map(|p| p.at).min().unwrap_or(now);
+        let due = pending.len() >= self.size || now.saturating_sub(oldest) >= self.max_wait_secs;
+        if !due {
+            println!("batch: {} of {} results pending", pending.len(), self.size);
+            return Ok(None);
+        }
+
+        // The largest run of the oldest triggers that fits in a submission
+        let mut count = pending.len();
+        loop {
+            let (output, result_lens) = batch_output(&pending[..count]);
+            match gas::check_batch_submission(&output, &result_lens) {
+                Ok(gas) => {
+                    let (sent, rest) = pending.split_at(count);
+                    println!(
+                        "batch: submitting triggers {:?}, {} carried over; estimated gas {gas}",
+                        sent.iter().map(|p| p.trigger_id).collect::<Vec<_>>(),
+                        rest.len()
+                    );
+                    self.save(rest)?;
+                    return Ok(Some(output));
+                }
+                Err(_) if count > 1 => count -= 1,
+                Err(e) => {
+                    let dropped = pending.remove(0);
+                    self.save(&pending)?;
+                    return Err(e.context(format!(
+                        "dropped the result of trigger {} from the batch",
+                        dropped.trigger_id
+                    )));
+                }
+            }
+        }
+    }
+
+    fn load(&self) -> Result<Vec<Pending>> {
+        let path = self.dir.join(STATE_FILE);
+        match std::fs::read(&path) {
+            Ok(bytes) => serde_json::from_slice(&bytes)
+                .with_context(|| format!("corrupt batch state {}", path.display())),
+            Err(e) if e.kind() == std::io::ErrorKind::NotFound => Ok(Vec::new()),
+            Err(e) => Err(e).with_context(|| format!("failed to read {}", path.display())),
+        }
+    }
+
+    fn save(&self, pending: &[Pending]) -> Result<()> {
+        // Write then rename so a crash never leaves a truncated file behind
+        let path = self.dir.join(STATE_FILE);
+        let tmp = path.with_extension("tmp");
+        std::fs::write(&tmp, serde_json::to_vec(pending)?)
+            .context("failed to write batch state")?;
+        std::fs::rename(&tmp, &path).context("failed to commit batch state")
+    }
+}
+
+/// The `DataWithId` output of `pending` and the length of each result
+fn batch_output(pending: &[Pending]) -> (Vec<u8>, Vec<usize>) {
+    let (trigger_ids, results): (Vec<u64>, Vec<Bytes>) =
+        pending.iter().map(|p| (p.trigger_id, p.data.clone())).unzip();
+    let result_lens = results.iter().map(|r| r.len()).collect();
+    let output = (BATCH_TRIGGER_ID, Bytes::from(encode(trigger_ids, results))).abi_encode();
+    (output, result_lens)
+}
+
+/// `abi.encode(TriggerBatch(triggerIds, results))`
+pub fn encode(trigger_ids: Vec<u64>, results: Vec<Bytes>) -> Vec<u8> {
+    (trigger_ids, results).abi_encode()
+}
+
+/// Inverse of [`encode`]
+pub fn decode(data: &[u8]) -> Result<(Vec<u64>, Vec<Bytes>)> {
+    let (trigger_ids, results) =
+        <(Vec<u64>, Vec<Bytes>)>::abi_decode(data, true).context("invalid TriggerBatch")?;
+    if trigger_ids.len() != results.len() {
+        return Err(anyhow!(
+            "TriggerBatch has {} trigger IDs but {} results",
+            trigger_ids.len(),
+            results.len()
+        ));
+    }
+    Ok((trigger_ids, results))
+}
@@ -0,0 +1,158 @@
+//! BLS12-381 signatures for attestations that are aggregated off-chain.
+//!
+//! Follows the IETF BLS signature draft in its minimal-pubkey-size variant, as
+//! used by Ethereum consensus and most BLS-based AVS aggregators: public keys
+//! are compressed G1 points (48 bytes), signatures compressed G2 points (96
+//! bytes), messages hashed to G2 with the proof-of-possession ciphersuite.
+//! Because the aggregator adds public keys together, every operator key must
+//! be registered with a proof of possession, see [`SecretKey::prove_possession`].
+//!
+//! The operator key is read from the `WAVS_ENV_BLS_SECRET_KEY` env var as a
+//! 32-byte big-endian hex scalar. With it set, [`signer::sign_if_configured`]
+//! submits results as a `BlsSignedResult` of `ITypes.sol`, signing the same
+//! result hash as the secp256k1 signer, chain and submit contract included,
+//! so the aggregation layer can sum the operators' signatures of one result.
+
+use crate::{secret::Secret, signer};
+use alloy_primitives::{hex, Bytes};
+use alloy_sol_types::SolValue;
+use anyhow::{anyhow, Context, Result};
+use bls12_381::{
+    hash_to_curve::{ExpandMsgXmd, HashToCurve},
+    multi_miller_loop, G1Affine, G1Projective, G2Affine, G2Prepared, G2Projective, Gt, Scalar,
+};
+
+pub const SECRET_KEY_ENV: &str = "WAVS_ENV_BLS_SECRET_KEY";
+
+/// Domain separation tag for signatures
+pub const SIGNATURE_DST: &[u8] = b"BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_";
+/// Domain separation tag for proofs of possession
+pub const POP_DST: &[u8] = b"BLS_POP_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_";
+
+pub type PublicKey = [u8; 48];
+pub type Signature = [u8; 96];
+
+pub struct SecretKey(Scalar);
+
+impl SecretKey {
+    /// Parses a big-endian scalar, rejecting zero and values outside the field
+    pub fn from_bytes(bytes: &[u8; 32]) -> Result<Self> {
+        let mut le = *bytes;
+        le.reverse();
+        let scalar: Option<Scalar> = Scalar::from_bytes(&le).into();
+        match scalar {
+            Some(scalar) if scalar != Scalar::zero() => Ok(Self(scalar)),
+            _ => Err(anyhow!("BLS secret key is not a nonzero scalar")),
+        }
+    }
+
+    /// Reads the operator key, `None` when it is not configured
+    pub fn from_env() -> Result<Option<Self>> {
+        let Some(key) = Secret::from_env(SECRET_KEY_ENV) else {
+            return Ok(None);
+        };
+        let bytes: [u8; 32] = hex::decode(key.expose())
+            .ok()
+            .and_then(|k| k.try_into().ok())
+            .with_context(|| format!("{SECRET_KEY_ENV} must be 32 hex-encoded bytes"))?;
+        Self::from_bytes(&bytes).map(Some)
+    }
+
+    pub fn public_key(&self) -> PublicKey {
+        G1Affine::from(G1Projective::generator() * self.0).to_compressed()
+    }
+
+    pub fn sign(&self, message: &[u8]) -> Signature {
+        G2Affine::from(hash_to_g2(message, SIGNATURE_DST) * self.0).to_compressed()
+    }
+
+    /// Signs the public key itself, registered alongside it so the aggregator
+    /// can rule out rogue-key attacks
+    pub fn prove_possession(&self) -> Signature {
+        G2Affine::from(hash_to_g2(&self.public_key(), POP_DST) * self.0).to_compressed()
+    }
+
+    /// ABI-encoded `BlsSignedResult(data, publicKey, signature)` for
+    /// `payload`, signing [`signer::result_hash`]
+    pub fn sign_result(
+        &self,
+        domain: &signer::SigningDomain,
+        trigger_id: u64,
+        payload: Vec<u8>,
+    ) -> Vec<u8> {
+        let signature = self.sign(signer::result_hash(domain, trigger_id, &payload).as_slice());
+        (
+            Bytes::from(payload),
+            Bytes::from(self.public_key().to_vec()),
+            Bytes::from(signature.to_vec()),
+        )
+            .abi_encode()
+    }
+}
+
+pub fn verify(public_key: &PublicKey, message: &[u8], signature: &Signature) -> Result<bool> {
+    let public_key = decode_public_key(public_key)?;
+    let signature = decode_signature(signature)?;
+    Ok(check(&public_key, &hash_to_g2(message, SIGNATURE_DST), &signature))
+}
+
+pub fn verify_possession(public_key: &PublicKey, proof: &Signature) -> Result<bool> {
+    let point = decode_public_key(public_key)?;
+    let proof = decode_signature(proof)?;
+    Ok(check(&point, &hash_to_g2(public_key, POP_DST), &proof))
+}
+
+/// Sums signatures into one of the same size
+pub fn aggregate(signatures: &[Signature]) -> Result<Signature> {
+    if signatures.is_empty() {
+        return Err(anyhow!("nothing to aggregate"));
+    }
+    let sum = signatures.iter().try_fold(G2Projective::identity(), |sum, signature| {
+        Ok::<_, anyhow::Error>(sum + decode_signature(signature)?)
+    })?;
+    Ok(G2Affine::from(sum).to_compressed())
+}
+
+/// Checks an aggregate signature of one message by every key, the usual
+/// case for operators attesting to the same result. Keys must come with
+/// verified proofs of possession.
+pub fn fast_aggregate_verify(
+    public_keys: &[PublicKey],
+    message: &[u8],
+    signature: &Signature,
+) -> Result<bool> {
+    if public_keys.is_empty() {
+        return Err(anyhow!("no public keys to verify against"));
+    }
+    let sum = public_keys.iter().try_fold(G1Projective::identity(), |sum, key| {
+        Ok::<_, anyhow::Error>(sum + decode_public_key(key)?)
+    })?;
+    let signature = decode_signature(signature)?;
+    Ok(check(&G1Affine::from(sum), &hash_to_g2(message, SIGNATURE_DST), &signature))
+}
+
+/// e(pk, H(m)) == e(g1, sig), as one multi-pairing
+fn check(public_key: &G1Affine, hash: &G2Projective, signature: &G2Affine) -> bool {
+    let hash = G2Prepared::from(G2Affine::from(hash));
+    let signature = G2Prepared::from(*signature);
+    let neg_g1 = -G1Affine::generator();
+    multi_miller_loop(&[(public_key, &hash), (&neg_g1, &signature)]).final_exponentiation()
+        == Gt::identity()
+}
+
+fn hash_to_g2(message: &[u8], dst: &[u8]) -> G2Projective {
+    <G2Projective as HashToCurve<ExpandMsgXmd<sha2_v09::Sha256>>>::hash_to_curve(message, dst)
+}
+
+fn decode_public_key(bytes: &PublicKey) -> Result<G1Affine> {
+    let point: Option<G1Affine> = G1Affine::from_compressed(bytes).into();
+    match point {
+        Some(point) if !bool::from(point.is_identity()) => Ok(point),
+        _ => Err(anyhow!("invalid BLS public key {}", hex::encode(bytes))),
+    }
+}
+
+fn decode_signature(bytes: &Signature) -> Result<G2Affine> {
+    Option::from(G2Affine::from_compressed(bytes))
+        .ok_or_else(|| anyhow!("invalid BLS signature {}", hex::encode(bytes)))
+}
@@ -0,0 +1,71 @@
+//! Canonical JSON encoding for payloads that are hashed or submitted.
+//!
+//! Operators only reach consensus when their outputs are byte-identical, so
+//! the encoding must not depend on map iteration order or float formatting:
+//!
+//! - object keys are sorted by their UTF-8 bytes,
+//! - no insignificant whitespace is emitted,
+//! - integral floats below 2^53 are written as integers (`1.0` -> `1`),
+//! - other floats use the shortest round-trip representation.
+
+use anyhow::Result;
+use serde::Serialize;
+use serde_json::{Number, Value};
+
+/// Largest float that is still an exactly representable integer
+const MAX_SAFE_INTEGER: f64 = 9_007_199_254_740_992.0;
+
+/// Serializes `value` to canonical JSON bytes
+pub fn to_vec<T: Serialize + ?Sized>(value: &T) -> Result<Vec<u8>> {
+    let value = serde_json::to_value(value)?;
+    let mut out = Vec::new();
+    write_value(&value, &mut out)?;
+    Ok(out)
+}
+
+/// Serializes `value` to a canonical JSON string
+pub fn to_string<T: Serialize + ?Sized>(value: &T) -> Result<String> {
+    Ok(String::from_utf8(to_vec(value)?)?)
+}
+
+fn write_value(value: &Value, out: &mut Vec<u8>) -> Result<()> {
+    match value {
+        Value::Null | Value::Bool(_) | Value::String(_) => serde_json::to_writer(&mut *out, value)?,
+        Value::Number(n) => write_number(n, out),
+        Value::Array(items) => {
+            out.push(b'[');
+            for (i, item) in items.iter().enumerate() {
+                if i > 0 {
+                    out.push(b',');
+                }
+                write_value(item, out)?;
+            }
+            out.push(b']');
+        }
+        Value::Object(map) => {
+            let mut entries: Vec<_> = map.iter().collect();
+            entries.sort_by(|(a, _), (b, _)| a.as_bytes().cmp(b.as_bytes()));
+
+            out.push(b'{');
+            for (i, (key, item)) in entries.into_iter().enumerate() {
+                if i > 0 {
+                    out.push(b',');
+                }
+                serde_json::to_writer(&mut *out, key)?;
+                out.push(b':');
+                write_value(item, out)?;
+            }
+            out.push(b'}');
+        }
+    }
+    Ok(())
+}
+
+fn write_number(n: &Number, out: &mut Vec<u8>) {
+    match n.as_f64() {
+        Some(f) if n.is_f64() && f.fract() == 0.0 && f.abs() < MAX_SAFE_INTEGER => {
+            out.extend_from_slice((f as i64).to_string().as_bytes())
+        }
+        _ => out.extend_from_slice(n.to_string().as_bytes()),
+    }
+}
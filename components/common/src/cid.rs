@@ -0,0 +1,105 @@
+//! Minimal CID parsing: CIDv0 (base58btc) and CIDv1 (base32 lower) with sha2-256 multihashes.
+
+use anyhow::{anyhow, Result};
+
+/// Multihash code for sha2-256
+pub const SHA2_256: u64 = 0x12;
+
+#[derive(Debug, Clone, PartialEq)]
+pub struct Cid {
+    pub version: u64,
+    pub codec: u64,
+    pub hash_code: u64,
+    pub digest: Vec<u8>,
+}
+
+impl Cid {
+    pub fn parse(s: &str) -> Result<Self> {
+        if s.len() == 46 && s.starts_with("Qm") {
+            // CIDv0 is a bare base58btc sha2-256 multihash of a dag-pb block
+            let bytes = decode_base58(s)?;
+            let (hash_code, digest) = parse_multihash(&bytes)?;
+            return Ok(Cid { version: 0, codec: 0x70, hash_code, digest });
+        }
+
+        let encoded =
+            s.strip_prefix('b').ok_or_else(|| anyhow!("only base32 (b...) CIDv1 is supported"))?;
+        let bytes = decode_base32(encoded)?;
+        let (version, rest) = read_varint(&bytes)?;
+        if version != 1 {
+            return Err(anyhow!("unsupported CID version {}", version));
+        }
+        let (codec, rest) = read_varint(rest)?;
+        let (hash_code, digest) = parse_multihash(rest)?;
+        Ok(Cid { version, codec, hash_code, digest })
+    }
+}
+
+fn parse_multihash(bytes: &[u8]) -> Result<(u64, Vec<u8>)> {
+    let (code, rest) = read_varint(bytes)?;
+    let (len, rest) = read_varint(rest)?;
+    if rest.len() != len as usize {
+        return Err(anyhow!("multihash digest length mismatch"));
+    }
+    Ok((code, rest.to_vec()))
+}
+
+fn read_varint(bytes: &[u8]) -> Result<(u64, &[u8])> {
+    let mut value = 0u64;
+    for (i, byte) in bytes.iter().enumerate().take(9) {
+        value |= ((byte & 0x7f) as u64) << (7 * i);
+        if byte & 0x80 == 0 {
+            return Ok((value, &bytes[i + 1..]));
+        }
+    }
+    Err(anyhow!("invalid varint"))
+}
+
+fn decode_base58(s: &str) -> Result<Vec<u8>> {
+    const ALPHABET: &[u8] = b"123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz";
+
+    let mut bytes: Vec<u8> = Vec::new();
+    for c in s.bytes() {
+        let mut carry = ALPHABET
+            .iter()
+            .position(|&a| a == c)
+            .ok_or_else(|| anyhow!("invalid base58 character {}", c as char))?
+            as u32;
+        for byte in bytes.iter_mut().rev() {
+            carry += (*byte as u32) * 58;
+            *byte = (carry & 0xff) as u8;
+            carry >>= 8;
+        }
+        while carry > 0 {
+            bytes.insert(0, (carry & 0xff) as u8);
+            carry >>= 8;
+        }
+    }
+    let zeros = s.bytes().take_while(|&c| c == b'1').count();
+    let mut out = vec![0u8; zeros];
+    out.extend(bytes);
+    Ok(out)
+}
+
+fn decode_base32(s: &str) -> Result<Vec<u8>> {
+    const ALPHABET: &[u8] = b"abcdefghijklmnopqrstuvwxyz234567";
+
+    let mut out = Vec::with_capacity(s.len() * 5 / 8);
+    let mut buffer = 0u32;
+    let mut bits = 0;
+    for c in s.bytes() {
+        let value = ALPHABET
+            .iter()
+            .position(|&a| a == c)
+            .ok_or_else(|| anyhow!("invalid base32 character {}", c as char))?
+            as u32;
+        buffer = (buffer << 5) | value;
+        bits += 5;
+        if bits >= 8 {
+            bits -= 8;
+            out.push((buffer >> bits) as u8);
+            buffer &= (1 << bits) - 1;
+        }
+    }
+    Ok(out)
+}
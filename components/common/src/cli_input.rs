@@ -0,0 +1,174 @@
+//! Input handling for raw (CLI) triggers.
+//!
+//! Plain text is passed through unchanged. Hex input is recognized so the
+//! exact bytes a contract emits can be pasted in to test decoding end to end:
+//!
+//! - `0x…` that is `NewTrigger` event data or a trigger payload is decoded as
+//!   the chain trigger would be, trigger ID included;
+//! - `hex:0x…` (or `hex:…`) is always decoded to raw bytes.
+//!
+//! Any other `0x…` text, such as an address, stays text.
+//!
+//! Binary requests (protobuf, ABI-encoded structs) can be passed as
+//! `base64:…`. Their bytes are delivered exactly, whereas raw binary that
+//! happens to be valid UTF-8 would lose trailing zero bytes to the NUL
+//! trimming text input gets.
+//!
+//! A JSON object with a `cmd` field is a structured request that also picks
+//! the output encoding, so every destination encoder can be exercised without
+//! a chain trigger:
+//!
+//! ```json
+//! {"cmd": "price", "args": "1", "format": "abi", "trigger_id": 7}
+//! ```
+//!
+//! `cmd` must be one of the component's commands. String `args` are decoded
+//! like plain input (so `hex:` and `base64:` work), other JSON is passed to
+//! the component as canonical JSON. `format` is `json` (CLI output, the
+//! default) or `abi` (the on-chain encoding).
+
+use crate::{
+    canonical_json, json_schema,
+    trigger_compat::{self, TriggerFormat},
+};
+use alloy_primitives::{hex, Bytes};
+use alloy_sol_types::SolValue;
+use anyhow::{anyhow, Context, Result};
+use base64::{
+    engine::general_purpose::{STANDARD, URL_SAFE},
+    Engine,
+};
+use serde::Deserialize;
+use serde_json::Value;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum InputEncoding {
+    Text,
+    Hex,
+    Base64,
+    /// Hex of a `NewTrigger` event or payload in the given layout
+    Trigger(TriggerFormat),
+}
+
+/// Encoding requested for the result
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum OutputFormat {
+    #[default]
+    Json,
+    Abi,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct CliInput {
+    /// From the request or the decoded trigger, 0 otherwise
+    pub trigger_id: u64,
+    pub data: Vec<u8>,
+    pub encoding: InputEncoding,
+    /// Set by structured requests
+    pub command: Option<String>,
+    pub format: OutputFormat,
+}
+
+/// Schema of [`CliRequest`]
+pub const REQUEST_SCHEMA: &str = include_str!("../schemas/cli_request.schema.json");
+
+#[derive(Deserialize)]
+struct CliRequest {
+    cmd: String,
+    #[serde(default)]
+    args: Value,
+    #[serde(default)]
+    format: OutputFormat,
+    trigger_id: Option<u64>,
+}
+
+impl CliInput {
+    fn new(trigger_id: u64, data: Vec<u8>, encoding: InputEncoding) -> Self {
+        Self { trigger_id, data, encoding, command: None, format: OutputFormat::Json }
+    }
+
+    fn text(raw: &[u8]) -> Self {
+        Self::new(0, raw.to_vec(), InputEncoding::Text)
+    }
+
+    /// Rejects structured requests for a command the component does not have
+    pub fn check_command(&self, commands: &[&str]) -> Result<()> {
+        match &self.command {
+            Some(cmd) if !commands.contains(&cmd.as_str()) => {
+                Err(anyhow!("unknown command {cmd}, expected one of {}", commands.join(", ")))
+            }
+            _ => Ok(()),
+        }
+    }
+}
+
+pub fn parse(raw: &[u8]) -> Result<CliInput> {
+    // bytes32-formatted input is NUL padded
+    let Ok(text) = std::str::from_utf8(raw) else {
+        return Ok(CliInput::text(raw));
+    };
+    let text = text.trim_end_matches('\0').trim();
+
+    // Other JSON objects are component input
+    if let Ok(Value::Object(object)) = serde_json::from_str::<Value>(text) {
+        if object.contains_key("cmd") {
+            let request = Value::Object(object);
+            json_schema::validate(REQUEST_SCHEMA, &request)
+                .context("invalid structured CLI request")?;
+            let request = serde_json::from_value(request)?;
+            return parse_request(request);
+        }
+    }
+    parse_data(raw, text)
+}
+
+fn parse_request(request: CliRequest) -> Result<CliInput> {
+    let mut input = match &request.args {
+        Value::Null => CliInput::text(&[]),
+        Value::String(args) => parse_data(args.as_bytes(), args.trim())?,
+        args => CliInput::text(&canonical_json::to_vec(args)?),
+    };
+    if let Some(trigger_id) = request.trigger_id {
+        input.trigger_id = trigger_id;
+    }
+    input.command = Some(request.cmd);
+    input.format = request.format;
+    Ok(input)
+}
+
+/// Decodes `text`, the trimmed form of `raw`
+fn parse_data(raw: &[u8], text: &str) -> Result<CliInput> {
+    if let Some(encoded) = text.strip_prefix("hex:") {
+        let data = hex::decode(encoded.trim()).context("invalid hex: input")?;
+        return Ok(CliInput::new(0, data, InputEncoding::Hex));
+    }
+    if let Some(encoded) = text.strip_prefix("base64:") {
+        let encoded = encoded.trim();
+        let data = STANDARD
+            .decode(encoded)
+            .or_else(|_| URL_SAFE.decode(encoded))
+            .context("invalid base64: input")?;
+        return Ok(CliInput::new(0, data, InputEncoding::Base64));
+    }
+
+    let Some(digits) = text.strip_prefix("0x") else {
+        return Ok(CliInput::text(raw));
+    };
+    let Ok(bytes) = hex::decode(digits) else {
+        return Ok(CliInput::text(raw));
+    };
+    // Event data wraps the payload in `abi.encode(bytes)`
+    let payload = match <(Bytes,)>::abi_decode_params(&bytes, true) {
+        Ok((payload,)) if trigger_compat::detect(&payload).is_ok() => payload.to_vec(),
+        _ => bytes,
+    };
+    match trigger_compat::decode_payload(&payload) {
+        Ok(trigger) => Ok(CliInput::new(
+            trigger.trigger_id,
+            trigger.data,
+            InputEncoding::Trigger(trigger.format),
+        )),
+        Err(_) => Ok(CliInput::text(raw)),
+    }
+}
@@ -0,0 +1,146 @@
+//! Wall-clock time behind a trait, so it can be pinned in tests and replays.
+//!
+//! Components read the time through [`RunContext::clock`](crate::context::RunContext::clock)
+//! rather than calling `SystemTime::now()` directly.
+//!
+//! The host clock differs slightly between operators. With the
+//! `clock_source` kv config set to `block`, chain triggers read the timestamp
+//! of the block they were emitted in instead, so every operator computes with
+//! the same time for the same trigger.
+
+use crate::{context::RunContext, evm, types::TriggerBlock};
+use anyhow::{anyhow, Context, Result};
+use std::{
+    rc::Rc,
+    time::{Duration, SystemTime, UNIX_EPOCH},
+};
+use wstd::runtime::block_on;
+
+pub trait Clock {
+    fn now(&self) -> SystemTime;
+
+    /// Seconds since the Unix epoch, zero for times before it
+    fn unix_secs(&self) -> u64 {
+        self.now().duration_since(UNIX_EPOCH).map(|d| d.as_secs()).unwrap_or_default()
+    }
+}
+
+/// The host wall clock (`wasi:clocks/wall-clock` on `wasm32-wasip1`)
+#[derive(Debug, Clone, Copy, Default)]
+pub struct SystemClock;
+
+impl Clock for SystemClock {
+    fn now(&self) -> SystemTime {
+        SystemTime::now()
+    }
+}
+
+/// A clock stuck at one instant
+#[derive(Debug, Clone, Copy)]
+pub struct FixedClock(pub SystemTime);
+
+impl FixedClock {
+    pub fn from_unix_secs(secs: u64) -> Self {
+        Self(UNIX_EPOCH + Duration::from_secs(secs))
+    }
+}
+
+impl Clock for FixedClock {
+    fn now(&self) -> SystemTime {
+        self.0
+    }
+}
+
+/// Returns a [`FixedClock`] when the `fixed_unix_time` kv config is set,
+/// otherwise the [`SystemClock`]
+pub fn from_env() -> Result<Rc<dyn Clock>> {
+    match std::env::var("fixed_unix_time") {
+        Ok(secs) => {
+            let secs = secs.parse().context("invalid fixed_unix_time")?;
+            Ok(Rc::new(FixedClock::from_unix_secs(secs)))
+        }
+        Err(_) => Ok(Rc::new(SystemClock)),
+    }
+}
+
+/// The clock for the trigger of `ctx`: a [`FixedClock`] at `fixed_unix_time`
+/// when that kv config is set, at the trigger block's timestamp when
+/// `clock_source` is `block`, and the [`SystemClock`] otherwise. CLI input has
+/// no block and always gets the [`SystemClock`].
+///
+/// The block header is read within the deadline of `ctx`.
+pub fn for_trigger(ctx: &RunContext) -> Result<Rc<dyn Clock>> {
+    if std::env::var("fixed_unix_time").is_ok() {
+        return from_env();
+    }
+    match std::env::var("clock_source").as_deref() {
+        Err(_) | Ok("host") => Ok(Rc::new(SystemClock)),
+        Ok("block") => match ctx.block() {
+            Some(block) => Ok(Rc::new(FixedClock::from_unix_secs(block_time(ctx, block)?))),
+            None => Ok(Rc::new(SystemClock)),
+        },
+        Ok(other) => Err(anyhow!("unknown clock_source {other}, expected host or block")),
+    }
+}
+
+fn block_time(ctx: &RunContext, block: &TriggerBlock) -> Result<u64> {
+    let header = block_on(async { ctx.run(evm::trigger_header(block)).await? })
+        .context("clock_source block")?;
+    Ok(header.timestamp.to())
+}
+
+/// Parses a UTC timestamp such as `2025-03-01T12:00:00`, `2025-03-01T12:00:00.5Z`
+/// or `2025-03-01 12:00:00` into seconds since the Unix epoch, dropping
+/// fractional seconds
+pub fn parse_utc(s: &str) -> Result<u64> {
+    let invalid = || anyhow!("invalid UTC timestamp {s}");
+    let s = s.trim().trim_end_matches('Z');
+    let (date, time) = s.split_once(['T', ' ']).ok_or_else(invalid)?;
+    let time = time.split_once('.').map_or(time, |(whole, _)| whole);
+
+    let fields = |part: &str, sep: char| -> Result<Vec<u64>> {
+        part.split(sep).map(|n| n.parse().map_err(|_| invalid())).collect()
+    };
+    let (date, time) = (fields(date, '-')?, fields(time, ':')?);
+    let (&[year, month, day], &[hour, minute, second]) = (date.as_slice(), time.as_slice()) else {
+        return Err(invalid());
+    };
+    if !(1..=12).contains(&month)
+        || !(1..=31).contains(&day)
+        || hour > 23
+        || minute > 59
+        || second > 60
+    {
+        return Err(invalid());
+    }
+    let days = days_from_civil(year, month, day).ok_or_else(invalid)?;
+    Ok(days * 86_400 + hour * 3_600 + minute * 60 + second)
+}
+
+/// Days from 1970-01-01 to a proleptic Gregorian date, `None` before the epoch
+fn days_from_civil(year: u64, month: u64, day: u64) -> Option<u64> {
+    // Howard Hinnant's algorithm, with years starting in March
+    let year = if month <= 2 { year.checked_sub(1)? } else { year };
+    let era = year / 400;
+    let year_of_era = year - era * 400;
+    let month_index = (month + 9) % 12;
+    let day_of_year = (153 * month_index + 2) / 5 + day - 1;
+    let day_of_era = year_of_era * 365 + year_of_era / 4 - year_of_era / 100 + day_of_year;
+    (era * 146_097 + day_of_era).checked_sub(719_468)
+}
+
+/// UTC calendar date `(year, month, day)` of Unix seconds
+pub fn utc_date(unix_secs: u64) -> (u64, u64, u64) {
+    // Inverse of `days_from_civil`, shifted to eras starting 0000-03-01
+    let days = unix_secs / 86_400 + 719_468;
+    let era = days / 146_097;
+    let day_of_era = days - era * 146_097;
+    let year_of_era =
+        (day_of_era - day_of_era / 1_460 + day_of_era / 36_524 - day_of_era / 146_096) / 365;
+    let day_of_year = day_of_era - (365 * year_of_era + year_of_era / 4 - year_of_era / 100);
+    let month_index = (5 * day_of_year + 2) / 153;
+    let day = day_of_year - (153 * month_index + 2) / 5 + 1;
+    let month = if month_index < 10 { month_index + 3 } else { month_index - 9 };
+    let year = year_of_era + era * 400 + u64::from(month <= 2);
+    (year, month, day)
+}
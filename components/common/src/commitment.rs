@@ -0,0 +1,58 @@
+//! Result commitments with a selectable hash.
+//!
+//! `keccak256` is cheapest to check in the EVM; `poseidon` is cheap to
+//! recompute inside a ZK circuit, where keccak costs tens of thousands of
+//! constraints. The hash is picked with the `commitment_hash` kv config.
+
+use crate::{crypto::keccak256, poseidon};
+use alloy_primitives::B256;
+use anyhow::{anyhow, Result};
+
+/// Discriminants are the `commitmentHash` codes of the output envelope
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+#[repr(u8)]
+pub enum CommitmentHash {
+    #[default]
+    Keccak256 = 0,
+    /// circomlib-compatible Poseidon over BN254, see [`poseidon::hash_bytes`]
+    Poseidon = 1,
+}
+
+impl std::str::FromStr for CommitmentHash {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self> {
+        match s {
+            "keccak256" => Ok(Self::Keccak256),
+            "poseidon" => Ok(Self::Poseidon),
+            _ => Err(anyhow!("unknown commitment hash {s}, expected keccak256 or poseidon")),
+        }
+    }
+}
+
+impl std::fmt::Display for CommitmentHash {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::Keccak256 => f.write_str("keccak256"),
+            Self::Poseidon => f.write_str("poseidon"),
+        }
+    }
+}
+
+impl CommitmentHash {
+    /// Reads `commitment_hash` from the service config, defaulting to keccak256
+    pub fn from_env() -> Result<Self> {
+        match std::env::var("commitment_hash") {
+            Ok(hash) => hash.parse(),
+            Err(_) => Ok(Self::default()),
+        }
+    }
+
+    /// Commits to `data`; Poseidon commitments are field elements as bytes32
+    pub fn commit(&self, data: &[u8]) -> B256 {
+        match self {
+            Self::Keccak256 => keccak256(data),
+            Self::Poseidon => B256::from(poseidon::hash_bytes(data).to_be_bytes::<32>()),
+        }
+    }
+}
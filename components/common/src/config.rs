@@ -0,0 +1,190 @@
+//! Typed access to the service's kv config.
+//!
+//! The `config` map of a service is set at deploy time and reaches the
+//! component as environment variables, so changing an API URL or a query
+//! parameter needs a redeploy of the service, not a rebuild of the
+//! component. Keys are lowercase; each accessor names the key in its
+//! errors, e.g. `Invalid max_holders: invalid digit found in string`.
+//!
+//! A component can also ship its defaults as a TOML file compiled into the
+//! wasm with [`embed`], so sources, feeds, thresholds and output formats are
+//! reviewable in one place. Tables join their keys with `_`, so
+//!
+//! ```toml
+//! [coinmarketcap]
+//! base_urls = ["https://api.coinmarketcap.com"]
+//! range = "1h"
+//! ```
+//!
+//! supplies `coinmarketcap_base_urls` and `coinmarketcap_range`; arrays become
+//! comma-separated lists. A key the service's kv config sets wins over the
+//! file. Secrets stay in the operator's `WAVS_ENV_*` variables: keys are
+//! lowercase, so the file cannot supply one.
+
+use anyhow::{anyhow, Context, Result};
+use sha2::{Digest, Sha256};
+use std::{collections::BTreeMap, fmt::Display, str::FromStr};
+
+/// The raw value of `key`, `None` when it is not set
+pub fn string(key: &str) -> Option<String> {
+    std::env::var(key).ok()
+}
+
+/// The raw value of `key`, or `default`
+pub fn string_or(key: &str, default: &str) -> String {
+    string(key).unwrap_or_else(|| default.to_string())
+}
+
+/// `key` parsed as `T`, `None` when it is not set
+pub fn parse<T>(key: &str) -> Result<Option<T>>
+where
+    T: FromStr,
+    T::Err: Display,
+{
+    string(key).map(|v| v.trim().parse().map_err(|e| anyhow!("Invalid {key}: {e}"))).transpose()
+}
+
+/// `key` parsed as `T`, or `default` when it is not set
+pub fn parse_or<T>(key: &str, default: T) -> Result<T>
+where
+    T: FromStr,
+    T::Err: Display,
+{
+    Ok(parse(key)?.unwrap_or(default))
+}
+
+/// `key` parsed as `T`, failing when it is not set
+pub fn required<T>(key: &str) -> Result<T>
+where
+    T: FromStr,
+    T::Err: Display,
+{
+    parse(key)?.ok_or_else(|| anyhow!("{key} not set"))
+}
+
+/// `true` or `false`, `default` when `key` is not set
+pub fn flag(key: &str, default: bool) -> Result<bool> {
+    match string(key).as_deref().map(str::trim) {
+        None => Ok(default),
+        Some("true") => Ok(true),
+        Some("false") => Ok(false),
+        Some(other) => Err(anyhow!("Invalid {key}: {other}, expected true or false")),
+    }
+}
+
+/// Comma-separated values of `key` without surrounding whitespace or empty
+/// items, `None` when it is not set
+pub fn list(key: &str) -> Option<Vec<String>> {
+    string(key).map(|v| {
+        v.split(',').map(str::trim).filter(|s| !s.is_empty()).map(str::to_string).collect()
+    })
+}
+
+/// SHA-256 of every kv config key and value in key order, so caches can tell
+/// results computed under another config apart. Only lowercase keys are
+/// config; secrets (`WAVS_ENV_*`) and the rest of the environment are not.
+pub fn digest() -> [u8; 32] {
+    let config: BTreeMap<String, String> = std::env::vars_os()
+        .filter_map(|(key, value)| Some((key.into_string().ok()?, value.into_string().ok()?)))
+        .filter(|(key, _)| !key.bytes().any(|b| b.is_ascii_uppercase()))
+        .collect();
+    let mut hasher = Sha256::new();
+    for (key, value) in &config {
+        for part in [key, value] {
+            hasher.update(part.as_bytes());
+            hasher.update([0]);
+        }
+    }
+    hasher.finalize().into()
+}
+
+/// Experimental modes a deployment opted into by listing them in the
+/// `experimental` kv config, e.g. `experimental=index-geometric`, so a new
+/// encoder or aggregation ships in the same component as the stable path
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct Experiments(Vec<&'static str>);
+
+impl Experiments {
+    /// Reads `experimental`, rejecting modes the component does not offer so
+    /// a misspelled one fails instead of silently running the stable path
+    pub fn from_env(offered: &[&'static str]) -> Result<Self> {
+        let mut enabled = Vec::new();
+        for name in list("experimental").unwrap_or_default() {
+            let known = offered.iter().find(|o| **o == name).ok_or_else(|| {
+                anyhow!("Invalid experimental: unknown mode {name}, expected one of {offered:?}")
+            })?;
+            if !enabled.contains(known) {
+                enabled.push(*known);
+            }
+        }
+        Ok(Self(enabled))
+    }
+
+    pub fn enabled(&self, name: &str) -> bool {
+        self.0.contains(&name)
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.0.is_empty()
+    }
+}
+
+/// Applies an embedded TOML config, usually `include_str!("../config.toml")`:
+/// each of its keys the kv config does not set is set from the file, so every
+/// reader, including the `from_env` constructors of this crate, sees it
+pub fn embed(toml: &str) -> Result<()> {
+    for (key, value) in flatten(toml)? {
+        if std::env::var_os(&key).is_none() {
+            std::env::set_var(key, value);
+        }
+    }
+    Ok(())
+}
+
+/// The kv keys and values an embedded TOML config declares
+pub fn flatten(toml: &str) -> Result<BTreeMap<String, String>> {
+    let table: toml::Table = toml.parse().context("invalid embedded config")?;
+    let mut out = BTreeMap::new();
+    flatten_table("", &table, &mut out)?;
+    Ok(out)
+}
+
+fn flatten_table(
+    prefix: &str,
+    table: &toml::Table,
+    out: &mut BTreeMap<String, String>,
+) -> Result<()> {
+    for (name, value) in table {
+        if name.is_empty() || !name.bytes().all(|b| matches!(b, b'a'..=b'z' | b'0'..=b'9' | b'_')) {
+            return Err(anyhow!(
+                "embedded config key {name:?} must be lowercase letters, digits and _"
+            ));
+        }
+        let key = if prefix.is_empty() { name.clone() } else { format!("{prefix}_{name}") };
+        let value = match value {
+            toml::Value::Table(table) => {
+                flatten_table(&key, table, out)?;
+                continue;
+            }
+            toml::Value::Array(items) => {
+                items.iter().map(|item| scalar(&key, item)).collect::<Result<Vec<_>>>()?.join(",")
+            }
+            value => scalar(&key, value)?,
+        };
+        if out.insert(key.clone(), value).is_some() {
+            return Err(anyhow!("embedded config sets {key} twice"));
+        }
+    }
+    Ok(())
+}
+
+fn scalar(key: &str, value: &toml::Value) -> Result<String> {
+    Ok(match value {
+        toml::Value::String(s) => s.clone(),
+        toml::Value::Integer(i) => i.to_string(),
+        toml::Value::Float(f) => f.to_string(),
+        toml::Value::Boolean(b) => b.to_string(),
+        toml::Value::Datetime(d) => d.to_string(),
+        _ => return Err(anyhow!("embedded config {key} must be a value or a list of values")),
+    })
+}
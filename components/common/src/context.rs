@@ -0,0 +1,171 @@
+//! Deadline and cancellation shared by everything a single `run` does.
+//!
+//! A [`RunContext`] is created once per invocation and passed down to the
+//! compute step and every upstream request, so the overall deadline, per-call
+//! timeouts, retries and parallel fetches all stop at the same point. It also
+//! carries the [`Clock`] used for wall-clock time and the block of the
+//! trigger, if it came from a chain.
+//!
+//! Chain reads should be pinned to that block with [`RunContext::pinned_height`]:
+//! operators run the trigger at different times, and reading `latest` would
+//! let their results differ by whatever happened in between. The block's
+//! hash is available with [`evm::trigger_header`](crate::evm::trigger_header).
+
+use crate::{
+    clock::{self, Clock, SystemClock},
+    types::TriggerBlock,
+};
+use anyhow::{Context as _, Result};
+use std::{
+    cell::Cell,
+    fmt,
+    future::Future,
+    rc::Rc,
+    time::{Duration, Instant},
+};
+use wstd::future::FutureExt;
+
+/// Why a context stopped accepting work
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ContextError {
+    Canceled,
+    DeadlineExceeded,
+}
+
+impl fmt::Display for ContextError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            ContextError::Canceled => f.write_str("context canceled"),
+            ContextError::DeadlineExceeded => f.write_str("context deadline exceeded"),
+        }
+    }
+}
+
+impl std::error::Error for ContextError {}
+
+#[derive(Clone)]
+pub struct RunContext {
+    deadline: Option<Instant>,
+    /// Own flag first, then the flags of every ancestor
+    canceled: Vec<Rc<Cell<bool>>>,
+    clock: Rc<dyn Clock>,
+    block: Option<TriggerBlock>,
+}
+
+impl RunContext {
+    /// A context without deadline that is only canceled explicitly
+    pub fn background() -> Self {
+        Self {
+            deadline: None,
+            canceled: vec![Rc::new(Cell::new(false))],
+            clock: Rc::new(SystemClock),
+            block: None,
+        }
+    }
+
+    /// Reads the overall deadline from the `timeout_ms` kv config and the
+    /// clock from [`clock::from_env`]
+    pub fn from_env() -> Result<Self> {
+        Self::with_env_timeout(Self::background().with_clock(clock::from_env()?))
+    }
+
+    /// Like [`from_env`](Self::from_env), with the clock picked for the
+    /// trigger by [`clock::for_trigger`]. Reading the block timestamp already
+    /// counts against the `timeout_ms` deadline.
+    pub fn from_trigger(block: Option<&TriggerBlock>) -> Result<Self> {
+        let ctx = Self::with_env_timeout(Self { block: block.cloned(), ..Self::background() })?;
+        let clock = clock::for_trigger(&ctx)?;
+        Ok(ctx.with_clock(clock))
+    }
+
+    fn with_env_timeout(ctx: Self) -> Result<Self> {
+        match std::env::var("timeout_ms") {
+            Ok(ms) => {
+                let ms: u64 = ms.parse().context("invalid timeout_ms")?;
+                Ok(ctx.with_timeout(Duration::from_millis(ms)))
+            }
+            Err(_) => Ok(ctx),
+        }
+    }
+
+    /// Derives a child context that expires after `timeout`, or with the
+    /// parent, whichever comes first. Canceling the child leaves the parent alone.
+    pub fn with_timeout(&self, timeout: Duration) -> Self {
+        let deadline = Instant::now() + timeout;
+        let mut canceled = Vec::with_capacity(self.canceled.len() + 1);
+        canceled.push(Rc::new(Cell::new(false)));
+        canceled.extend(self.canceled.iter().cloned());
+        Self {
+            deadline: Some(self.deadline.map_or(deadline, |d| d.min(deadline))),
+            canceled,
+            clock: self.clock.clone(),
+            block: self.block.clone(),
+        }
+    }
+
+    /// Replaces the clock, e.g. with a [`FixedClock`](crate::clock::FixedClock) in tests
+    pub fn with_clock(mut self, clock: Rc<dyn Clock>) -> Self {
+        self.clock = clock;
+        self
+    }
+
+    pub fn clock(&self) -> &dyn Clock {
+        self.clock.as_ref()
+    }
+
+    /// Block of the chain trigger, `None` for CLI input
+    pub fn block(&self) -> Option<&TriggerBlock> {
+        self.block.as_ref()
+    }
+
+    /// Height to pin reads of `chain_name` to: the trigger block when it is
+    /// on that chain, unless the `pin_to_trigger_block` kv config is `false`.
+    /// `None` means reading the latest block.
+    pub fn pinned_height(&self, chain_name: &str) -> Option<u64> {
+        if std::env::var("pin_to_trigger_block").is_ok_and(|v| v == "false") {
+            return None;
+        }
+        self.block.as_ref().filter(|block| block.chain_name == chain_name).map(|block| block.height)
+    }
+
+    pub fn cancel(&self) {
+        if let Some(flag) = self.canceled.first() {
+            flag.set(true);
+        }
+    }
+
+    pub fn deadline(&self) -> Option<Instant> {
+        self.deadline
+    }
+
+    /// Time left before the deadline, `None` when there is no deadline
+    pub fn remaining(&self) -> Option<Duration> {
+        self.deadline.map(|d| d.saturating_duration_since(Instant::now()))
+    }
+
+    /// Returns the reason the context is done, if it is
+    pub fn err(&self) -> Option<ContextError> {
+        if self.canceled.iter().any(|flag| flag.get()) {
+            return Some(ContextError::Canceled);
+        }
+        match self.remaining() {
+            Some(remaining) if remaining.is_zero() => Some(ContextError::DeadlineExceeded),
+            _ => None,
+        }
+    }
+
+    /// Runs `fut` unless the context is already done, abandoning it once the
+    /// deadline passes
+    pub async fn run<F: Future>(&self, fut: F) -> Result<F::Output, ContextError> {
+        if let Some(err) = self.err() {
+            return Err(err);
+        }
+        match self.remaining() {
+            Some(remaining) => fut
+                .timeout(wstd::time::Duration::from(remaining))
+                .await
+                .map_err(|_| ContextError::DeadlineExceeded),
+            None => Ok(fut.await),
+        }
+    }
+}
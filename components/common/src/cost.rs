@@ -0,0 +1,79 @@
+//! Approximate compute effort of a `run`, for services that meter or
+//! reimburse operator costs.
+//!
+//! [`Meter`] counts the HTTP requests sent through [`crate::http`] and the
+//! response bytes read, and times the run; it logs the totals when dropped.
+//! With the `report_compute_cost` kv config set to `true` the totals are also
+//! added to the record copied to `result_destinations` and to CLI output as
+//! `compute_cost`.
+//! They differ between operators and between retries, so they never go into
+//! the primary result operators must agree on. Chain RPC reads are not
+//! counted.
+
+use crate::config;
+use anyhow::Result;
+use serde::Serialize;
+use std::{cell::Cell, fmt, time::Instant};
+
+thread_local! {
+    static CALLS: Cell<u64> = const { Cell::new(0) };
+    static BYTES: Cell<u64> = const { Cell::new(0) };
+    static STARTED: Cell<Option<Instant>> = const { Cell::new(None) };
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+pub struct ComputeCost {
+    pub http_calls: u64,
+    pub bytes_fetched: u64,
+    pub wall_time_ms: u64,
+}
+
+impl fmt::Display for ComputeCost {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "http_calls={} bytes_fetched={} wall_time_ms={}",
+            self.http_calls, self.bytes_fetched, self.wall_time_ms
+        )
+    }
+}
+
+/// Counts one HTTP request that read `bytes` of response body
+pub fn record(bytes: usize) {
+    CALLS.with(|calls| calls.set(calls.get() + 1));
+    BYTES.with(|total| total.set(total.get() + bytes as u64));
+}
+
+/// Effort since the current [`Meter`] started
+pub fn current() -> ComputeCost {
+    ComputeCost {
+        http_calls: CALLS.with(Cell::get),
+        bytes_fetched: BYTES.with(Cell::get),
+        wall_time_ms: STARTED
+            .with(Cell::get)
+            .map_or(0, |started| started.elapsed().as_millis() as u64),
+    }
+}
+
+/// [`current`] when `report_compute_cost` is enabled
+pub fn reported() -> Result<Option<ComputeCost>> {
+    Ok(config::flag("report_compute_cost", false)?.then(current))
+}
+
+/// Measures its scope, logging the totals when dropped
+pub struct Meter(());
+
+impl Meter {
+    pub fn start() -> Self {
+        CALLS.with(|calls| calls.set(0));
+        BYTES.with(|bytes| bytes.set(0));
+        STARTED.with(|started| started.set(Some(Instant::now())));
+        Self(())
+    }
+}
+
+impl Drop for Meter {
+    fn drop(&mut self) {
+        println!("compute cost: {}", current());
+    }
+}
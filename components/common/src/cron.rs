@@ -0,0 +1,200 @@
+//! Cron schedules and the payload of schedule-driven triggers.
+//!
+//! A scheduled trigger carries its schedule, the time it fired for and how
+//! many times it has fired:
+//!
+//! ```json
+//! {"schedule": "*/15 * * * *", "fire_time": 1740830400, "occurrence": 2016}
+//! ```
+//!
+//! [`CronFire::parse`] checks that the fire time is on the schedule, and
+//! [`CronFire::window`] gives the interval since the previous fire, so
+//! heartbeat and time-weighted modes cover exactly one scheduled period
+//! instead of guessing it from the wall clock, which differs per operator.
+//!
+//! Schedules have the five standard fields, minute, hour, day of month,
+//! month and day of week (0 or 7 is Sunday), in UTC. Each field is `*` or a
+//! list of `N` and `N-M`, optionally stepped with `/S`. As in Vixie cron, when
+//! both day fields are restricted a day matching either one fires.
+
+use crate::clock;
+use anyhow::{anyhow, Context, Result};
+use serde::Deserialize;
+use std::fmt;
+
+/// How far back [`Schedule::previous`] looks: a schedule firing on Feb 29
+/// only may wait eight years
+const MAX_LOOKBACK_SECS: u64 = 8 * 366 * 86_400;
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Schedule {
+    source: String,
+    /// Bit N set when minute N matches
+    minutes: u64,
+    hours: u64,
+    days: u64,
+    months: u64,
+    weekdays: u64,
+    /// Whether the day of month / week field is `*`
+    any_day: bool,
+    any_weekday: bool,
+}
+
+impl Schedule {
+    pub fn parse(s: &str) -> Result<Self> {
+        let fields: Vec<&str> = s.split_whitespace().collect();
+        let [minute, hour, day, month, weekday] = fields.as_slice() else {
+            return Err(anyhow!("cron schedule {s:?} must have 5 fields"));
+        };
+        // Sunday is both 0 and 7
+        let weekdays = parse_field(weekday, 0, 7).context("day of week")?;
+        Ok(Self {
+            source: fields.join(" "),
+            minutes: parse_field(minute, 0, 59).context("minute")?,
+            hours: parse_field(hour, 0, 23).context("hour")?,
+            days: parse_field(day, 1, 31).context("day of month")?,
+            months: parse_field(month, 1, 12).context("month")?,
+            weekdays: (weekdays | weekdays >> 7) & 0x7f,
+            any_day: *day == "*",
+            any_weekday: *weekday == "*",
+        })
+    }
+
+    /// Whether the schedule fires in the minute containing `unix_secs`
+    pub fn matches(&self, unix_secs: u64) -> bool {
+        let minute = unix_secs / 60 % 60;
+        let hour = unix_secs / 3_600 % 24;
+        self.minutes >> minute & 1 == 1
+            && self.hours >> hour & 1 == 1
+            && self.day_matches(unix_secs)
+    }
+
+    fn day_matches(&self, unix_secs: u64) -> bool {
+        let (_, month, day) = clock::utc_date(unix_secs);
+        // 1970-01-01 was a Thursday
+        let weekday = (unix_secs / 86_400 + 4) % 7;
+        let by_day = self.days >> day & 1 == 1;
+        let by_weekday = self.weekdays >> weekday & 1 == 1;
+        let day = match (self.any_day, self.any_weekday) {
+            (false, false) => by_day || by_weekday,
+            _ => by_day && by_weekday,
+        };
+        day && self.months >> month & 1 == 1
+    }
+
+    /// Start of the last minute strictly before `unix_secs` the schedule
+    /// fires in, `None` when there is none within eight years
+    pub fn previous(&self, unix_secs: u64) -> Option<u64> {
+        let floor = unix_secs.saturating_sub(MAX_LOOKBACK_SECS);
+        let mut t = unix_secs.checked_sub(1)? / 60 * 60;
+        while t >= floor {
+            if !self.day_matches(t) {
+                // Last minute of the previous day
+                t = (t / 86_400 * 86_400).checked_sub(60)?;
+            } else if self.hours >> (t / 3_600 % 24) & 1 == 0 {
+                t = (t / 3_600 * 3_600).checked_sub(60)?;
+            } else if self.minutes >> (t / 60 % 60) & 1 == 0 {
+                t = t.checked_sub(60)?;
+            } else {
+                return Some(t);
+            }
+        }
+        None
+    }
+}
+
+impl fmt::Display for Schedule {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(&self.source)
+    }
+}
+
+/// Bit set of the values `min..=max` a field selects
+fn parse_field(field: &str, min: u64, max: u64) -> Result<u64> {
+    let mut bits = 0u64;
+    for item in field.split(',') {
+        let (range, step) = match item.split_once('/') {
+            Some((range, step)) => {
+                let step: u64 = step.parse().with_context(|| format!("invalid step {step:?}"))?;
+                if step == 0 {
+                    return Err(anyhow!("step of {item:?} is zero"));
+                }
+                (range, step)
+            }
+            None => (item, 1),
+        };
+        let value = |s: &str| -> Result<u64> {
+            let v: u64 = s.parse().with_context(|| format!("invalid value {s:?}"))?;
+            if v < min || v > max {
+                return Err(anyhow!("{v} is outside {min}-{max}"));
+            }
+            Ok(v)
+        };
+        let (start, end) = match range {
+            "*" => (min, max),
+            range => match range.split_once('-') {
+                Some((start, end)) => (value(start)?, value(end)?),
+                // `N/S` runs from N to the end, as in Vixie cron
+                None if step > 1 => (value(range)?, max),
+                None => (value(range)?, value(range)?),
+            },
+        };
+        if start > end {
+            return Err(anyhow!("range {range:?} is reversed"));
+        }
+        for v in (start..=end).step_by(step as usize) {
+            bits |= 1 << v;
+        }
+    }
+    Ok(bits)
+}
+
+/// A fire of a scheduled trigger
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct CronFire {
+    pub schedule: Schedule,
+    /// Start of the minute the trigger fired for, in Unix seconds
+    pub fire_time: u64,
+    /// Number of fires of the schedule before this one
+    pub occurrence: u64,
+}
+
+#[derive(Deserialize)]
+#[serde(deny_unknown_fields)]
+struct CronPayload {
+    schedule: String,
+    fire_time: u64,
+    #[serde(default)]
+    occurrence: u64,
+}
+
+impl CronFire {
+    /// Parses a cron payload; `None` when `data` is not a JSON object with a
+    /// `schedule`, i.e. not a scheduled trigger
+    pub fn parse(data: &[u8]) -> Result<Option<Self>> {
+        let Ok(value) = serde_json::from_slice::<serde_json::Value>(data) else {
+            return Ok(None);
+        };
+        if value.get("schedule").is_none() {
+            return Ok(None);
+        }
+        let payload: CronPayload =
+            serde_json::from_value(value).context("invalid cron trigger payload")?;
+        let schedule = Schedule::parse(&payload.schedule)?;
+        // Schedulers fire a little late, the minute is what counts
+        let fire_time = payload.fire_time / 60 * 60;
+        if !schedule.matches(fire_time) {
+            return Err(anyhow!("fire time {} is not on schedule {schedule}", payload.fire_time));
+        }
+        Ok(Some(Self { schedule, fire_time, occurrence: payload.occurrence }))
+    }
+
+    /// `(previous fire, this fire)`: the period this fire covers. The first
+    /// fire of a schedule still covers the period since the one before it.
+    pub fn window(&self) -> Result<(u64, u64)> {
+        let previous = self.schedule.previous(self.fire_time).ok_or_else(|| {
+            anyhow!("schedule {} did not fire in the eight years before", self.schedule)
+        })?;
+        Ok((previous, self.fire_time))
+    }
+}
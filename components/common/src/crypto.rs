@@ -0,0 +1,40 @@
+//! Hashing and packing utilities mirroring their Solidity counterparts.
+
+use alloy_primitives::{Address, B256};
+use alloy_sol_types::SolValue;
+use anyhow::{anyhow, Result};
+
+pub use alloy_primitives::keccak256;
+
+/// Equivalent of Solidity's `abi.encodePacked(value)`.
+///
+/// Tuples pack each element in order, e.g. `encode_packed(&(addr, amount))`.
+pub fn encode_packed<T: SolValue>(value: &T) -> Vec<u8> {
+    value.abi_encode_packed()
+}
+
+/// Equivalent of Solidity's `keccak256(abi.encodePacked(value))`.
+pub fn keccak256_packed<T: SolValue>(value: &T) -> B256 {
+    keccak256(encode_packed(value))
+}
+
+/// Formats an address with its EIP-55 mixed-case checksum.
+pub fn to_checksum_address(address: &Address) -> String {
+    address.to_checksum(None)
+}
+
+/// Parses a hex address, rejecting mixed-case input whose EIP-55 checksum is wrong.
+///
+/// All-lowercase and all-uppercase addresses carry no checksum and are accepted as-is.
+pub fn parse_address(s: &str) -> Result<Address> {
+    let hex = s.strip_prefix("0x").unwrap_or(s);
+    let has_lower = hex.chars().any(|c| c.is_ascii_lowercase());
+    let has_upper = hex.chars().any(|c| c.is_ascii_uppercase());
+
+    if has_lower && has_upper {
+        Address::parse_checksummed(format!("0x{hex}"), None)
+            .map_err(|e| anyhow!("invalid checksum address {s}: {e}"))
+    } else {
+        hex.parse().map_err(|e| anyhow!("invalid address {s}: {e}"))
+    }
+}
@@ -0,0 +1,136 @@
+//! Extra destinations a result is copied to besides the trigger's own.
+//!
+//! The trigger decides where the result primarily goes (the on-chain
+//! submission or the CLI output). The `result_destinations` kv config adds
+//! comma-separated copies, each encoded for its destination:
+//!
+//! - `log` prints the JSON record to the component log;
+//! - `webhook:<url>` POSTs the JSON record to `url`.
+//!
+//! The record is the JSON envelope of the result together with its trigger:
+//!
+//! ```json
+//! {"envelope": {...}, "trigger_id": 7}
+//! ```
+//!
+//! With `report_compute_cost=true` the record also carries the run's
+//! [`ComputeCost`](crate::cost::ComputeCost) as `compute_cost`, and components
+//! built with `alloc-profiling` add their
+//! [`AllocStats`](crate::alloc_stats::AllocStats) as `alloc_stats`.
+//!
+//! Delivery is best effort: a failing copy is logged and never affects the
+//! primary result, which operators must agree on.
+
+use crate::{
+    alloc_stats::{self, AllocStats},
+    canonical_json, config,
+    context::RunContext,
+    cost::{self, ComputeCost},
+    envelope::{ComponentInfo, Envelope},
+    http,
+};
+use anyhow::{anyhow, Context, Result};
+use serde::Serialize;
+use std::str::FromStr;
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum Destination {
+    Log,
+    Webhook(String),
+}
+
+impl FromStr for Destination {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self> {
+        if s == "log" {
+            return Ok(Self::Log);
+        }
+        match s.split_once(':') {
+            Some(("webhook", url)) if url.starts_with("http") => Ok(Self::Webhook(url.to_string())),
+            _ => Err(anyhow!("unknown result destination {s}, expected log or webhook:<url>")),
+        }
+    }
+}
+
+impl std::fmt::Display for Destination {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::Log => f.write_str("log"),
+            Self::Webhook(url) => write!(f, "webhook:{url}"),
+        }
+    }
+}
+
+/// Reads the `result_destinations` kv config, empty when it is not set
+pub fn from_env() -> Result<Vec<Destination>> {
+    config::list("result_destinations")
+        .unwrap_or_default()
+        .iter()
+        .map(|d| d.parse().context("invalid result_destinations"))
+        .collect()
+}
+
+#[derive(Serialize)]
+struct Record {
+    trigger_id: u64,
+    envelope: serde_json::Value,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    compute_cost: Option<ComputeCost>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    alloc_stats: Option<AllocStats>,
+}
+
+/// JSON record sent to every destination
+pub fn record(
+    component: ComponentInfo,
+    trigger_id: u64,
+    feed_id: &str,
+    flags: u32,
+    payload: &[u8],
+) -> Result<Vec<u8>> {
+    let envelope = Envelope::new(component, feed_id, payload.to_vec())?.with_flags(flags);
+    let envelope = serde_json::from_slice(&envelope.to_json()?)?;
+    let compute_cost = cost::reported()?;
+    let alloc_stats = alloc_stats::current();
+    canonical_json::to_vec(&Record { trigger_id, envelope, compute_cost, alloc_stats })
+}
+
+/// Copies the result to the configured destinations, logging failed
+/// deliveries; returns how many destinations it reached
+pub async fn deliver(
+    ctx: &RunContext,
+    component: ComponentInfo,
+    trigger_id: u64,
+    feed_id: &str,
+    flags: u32,
+    payload: &[u8],
+) -> Result<usize> {
+    let destinations = from_env()?;
+    if destinations.is_empty() {
+        return Ok(0);
+    }
+    let record = record(component, trigger_id, feed_id, flags, payload)?;
+    let mut delivered = 0;
+    for destination in &destinations {
+        match send(ctx, destination, &record).await {
+            Ok(()) => delivered += 1,
+            Err(e) => eprintln!("failed to deliver result to {destination}: {e:#}"),
+        }
+    }
+    Ok(delivered)
+}
+
+async fn send(ctx: &RunContext, destination: &Destination, record: &[u8]) -> Result<()> {
+    match destination {
+        Destination::Log => {
+            println!("result record: {}", String::from_utf8_lossy(record));
+            Ok(())
+        }
+        Destination::Webhook(url) => {
+            let req = http::post(url, "application/json", record.to_vec())?;
+            ctx.run(http::send(req)).await??.into_ok_body()?;
+            Ok(())
+        }
+    }
+}
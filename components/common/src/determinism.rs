@@ -0,0 +1,168 @@
+//! Determinism self-check mode.
+//!
+//! With the `determinism_check` kv config set to `true`, [`run_checked`] runs
+//! the component's compute step twice: the first run records every upstream
+//! response fetched through [`fetch`], the second replays them. Any difference
+//! in the output bytes (wall-clock time, map ordering, float formatting, ...)
+//! fails the invocation instead of silently breaking operator consensus.
+//!
+//! `output::produce` runs every component's compute step through
+//! [`run_checked`], and `http::send` fetches through [`fetch`], so every HTTP
+//! request a component makes is recorded. Two things are not:
+//!
+//! - chain reads through `evm` go over the host's RPC transport. They are
+//!   pinned to the trigger block, so both runs read the same state; CLI runs
+//!   without a trigger block may see the chain move between runs.
+//! - local state a component keeps between invocations. Components load it
+//!   before the check and save it after, so both runs start from the same
+//!   state.
+//!
+//! Responses are keyed by the caller, and replayed in the order the requests
+//! were made, not the order they were answered, so concurrent requests with
+//! the same key replay the same way.
+
+use alloy_primitives::keccak256;
+use anyhow::{anyhow, Result};
+use std::any::Any;
+use std::cell::RefCell;
+use std::collections::{BTreeMap, VecDeque};
+use std::future::Future;
+
+/// What became of a request in the first run
+enum Capture {
+    /// Never answered: dropped on a timeout, or once enough sources answered
+    Pending,
+    Done(Box<dyn Any>),
+    /// The error chain, outermost first
+    Failed(Vec<String>),
+}
+
+type Captures = BTreeMap<String, VecDeque<Capture>>;
+
+enum Mode {
+    Live,
+    Record(Captures),
+    Replay(Captures),
+}
+
+thread_local! {
+    static MODE: RefCell<Mode> = const { RefCell::new(Mode::Live) };
+}
+
+/// Returns true when the `determinism_check` kv config is `true`
+pub fn enabled() -> bool {
+    std::env::var("determinism_check").is_ok_and(|v| v == "true")
+}
+
+/// Returns true while [`run_checked`] records or replays responses
+pub fn active() -> bool {
+    MODE.with(|mode| !matches!(*mode.borrow(), Mode::Live))
+}
+
+/// Fetches an upstream response through the record/replay layer.
+///
+/// `key` identifies the request (usually its method and URL); `fetch`
+/// performs it and is skipped while replaying. Errors are replayed with the
+/// same messages, and a request the first run never saw answered never
+/// completes, so the same timeout fires again.
+pub async fn fetch<T, F, Fut>(key: &str, fetch: F) -> Result<T>
+where
+    T: Clone + 'static,
+    F: FnOnce() -> Fut,
+    Fut: Future<Output = Result<T>>,
+{
+    enum Slot {
+        Live,
+        Record(usize),
+        Replay(Option<Capture>),
+    }
+
+    let slot = MODE.with(|mode| match &mut *mode.borrow_mut() {
+        Mode::Live => Slot::Live,
+        Mode::Record(captures) => {
+            // The slot is taken when the request is made, so answers that
+            // arrive out of order still replay in request order
+            let queue = captures.entry(key.to_string()).or_default();
+            queue.push_back(Capture::Pending);
+            Slot::Record(queue.len() - 1)
+        }
+        Mode::Replay(captures) => Slot::Replay(captures.get_mut(key).and_then(VecDeque::pop_front)),
+    });
+
+    match slot {
+        Slot::Live => fetch().await,
+        Slot::Record(index) => {
+            let result = fetch().await;
+            let capture = match &result {
+                Ok(value) => Capture::Done(Box::new(value.clone())),
+                Err(e) => Capture::Failed(e.chain().map(ToString::to_string).collect()),
+            };
+            MODE.with(|mode| {
+                if let Mode::Record(captures) = &mut *mode.borrow_mut() {
+                    if let Some(slot) = captures.get_mut(key).and_then(|c| c.get_mut(index)) {
+                        *slot = capture;
+                    }
+                }
+            });
+            result
+        }
+        Slot::Replay(None) => {
+            Err(anyhow!("determinism check failed: {key} was not requested in the first run"))
+        }
+        Slot::Replay(Some(Capture::Pending)) => std::future::pending().await,
+        Slot::Replay(Some(Capture::Done(value))) => {
+            value.downcast::<T>().map(|v| *v).map_err(|_| {
+                anyhow!("determinism check failed: {key} was recorded as a different response type")
+            })
+        }
+        Slot::Replay(Some(Capture::Failed(chain))) => {
+            let mut causes = chain.into_iter().rev();
+            let root = anyhow!(causes.next().unwrap_or_default());
+            Err(causes.fold(root, |e, cause| e.context(cause)))
+        }
+    }
+}
+
+/// Runs `compute` once, or twice with record/replay when the check is enabled
+pub fn run_checked<F>(mut compute: F) -> Result<Vec<u8>, String>
+where
+    F: FnMut() -> Result<Vec<u8>, String>,
+{
+    if !enabled() {
+        return compute();
+    }
+
+    set_mode(Mode::Record(BTreeMap::new()));
+    let first = compute();
+    let captures = match set_mode(Mode::Live) {
+        Mode::Record(captures) => captures,
+        _ => unreachable!("mode changed during recording"),
+    };
+    let first = first?;
+
+    set_mode(Mode::Replay(captures));
+    let second = compute();
+    let leftover = match set_mode(Mode::Live) {
+        Mode::Replay(captures) => captures.values().map(VecDeque::len).sum::<usize>(),
+        _ => unreachable!("mode changed during replay"),
+    };
+    let second = second?;
+
+    if first != second {
+        return Err(format!(
+            "determinism check failed: outputs differ ({} vs {})",
+            keccak256(&first),
+            keccak256(&second)
+        ));
+    }
+    if leftover > 0 {
+        return Err(format!(
+            "determinism check failed: {leftover} upstream responses were not used in the second run"
+        ));
+    }
+    Ok(first)
+}
+
+fn set_mode(mode: Mode) -> Mode {
+    MODE.with(|current| current.replace(mode))
+}
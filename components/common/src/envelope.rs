@@ -0,0 +1,170 @@
+//! Versioned envelope around every component result.
+//!
+//! The envelope carries the schema version, the producing component and its
+//! version, a feed ID naming what was computed, flags and a commitment to the
+//! payload, so consumers can dispatch on the schema version and keep decoding
+//! older results as fields are added. Results submitted on-chain use the ABI
+//! form, the `ResultEnvelope` struct of `ITypes.sol`; CLI output uses JSON.
+//!
+//! Set the `output_envelope` kv config to `none` to submit bare payloads to
+//! consumers that predate the envelope.
+
+use crate::{canonical_json, commitment::CommitmentHash};
+use alloy_primitives::{Bytes, B256};
+use alloy_sol_types::SolValue;
+use anyhow::{anyhow, Result};
+use serde::Serialize;
+
+pub const SCHEMA_VERSION: u16 = 1;
+
+/// The payload was truncated or compressed by the output size limit
+pub const FLAG_SIZE_LIMITED: u32 = 1 << 0;
+/// The payload is EIP-712 typed data rather than the default encoding
+pub const FLAG_TYPED_DATA: u32 = 1 << 1;
+/// The source market was closed, prices are its last close
+pub const FLAG_MARKET_CLOSED: u32 = 1 << 2;
+/// The payload is an ABI-encoded struct rather than the component's JSON
+pub const FLAG_ABI_STRUCT: u32 = 1 << 3;
+/// An experimental mode enabled with the `experimental` kv config produced the payload
+pub const FLAG_EXPERIMENTAL: u32 = 1 << 4;
+/// A result submitted earlier was stored on-chain with different data. Only
+/// set in `result_destinations` records, never in a submitted envelope: it
+/// reflects one operator's view.
+pub const FLAG_READBACK_MISMATCH: u32 = 1 << 5;
+/// A result submitted earlier never showed up on-chain; like
+/// [`FLAG_READBACK_MISMATCH`], only set in `result_destinations` records
+pub const FLAG_READBACK_MISSED: u32 = 1 << 6;
+
+/// Name and version of the component crate, see [`component_info!`](crate::component_info)
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct ComponentInfo {
+    pub name: &'static str,
+    pub version: &'static str,
+}
+
+/// [`ComponentInfo`] of the crate this is expanded in
+#[macro_export]
+macro_rules! component_info {
+    () => {
+        $crate::envelope::ComponentInfo {
+            name: env!("CARGO_PKG_NAME"),
+            version: env!("CARGO_PKG_VERSION"),
+        }
+    };
+}
+
+#[derive(Debug, Clone)]
+pub struct Envelope {
+    pub component: ComponentInfo,
+    pub feed_id: String,
+    pub flags: u32,
+    pub commitment_hash: CommitmentHash,
+    pub payload: Vec<u8>,
+}
+
+#[derive(Serialize)]
+struct JsonEnvelope<'a> {
+    schema_version: u16,
+    component: &'a str,
+    component_version: &'a str,
+    feed_id: &'a str,
+    flags: u32,
+    commitment_hash: String,
+    commitment: B256,
+    /// Inlined when the payload is JSON, hex encoded otherwise
+    payload: serde_json::Value,
+}
+
+impl Envelope {
+    /// Wraps `payload`, committing to it with the `commitment_hash` kv config
+    pub fn new(
+        component: ComponentInfo,
+        feed_id: impl Into<String>,
+        payload: Vec<u8>,
+    ) -> Result<Self> {
+        Ok(Self {
+            component,
+            feed_id: feed_id.into(),
+            flags: 0,
+            commitment_hash: CommitmentHash::from_env()?,
+            payload,
+        })
+    }
+
+    pub fn with_flags(mut self, flags: u32) -> Self {
+        self.flags |= flags;
+        self
+    }
+
+    pub fn commitment(&self) -> B256 {
+        self.commitment_hash.commit(&self.payload)
+    }
+
+    /// `abi.encode(ResultEnvelope)`
+    pub fn abi_encode(&self) -> Vec<u8> {
+        (
+            SCHEMA_VERSION,
+            self.component.name.to_string(),
+            self.component.version.to_string(),
+            self.feed_id.clone(),
+            self.flags,
+            self.commitment_hash as u8,
+            self.commitment(),
+            Bytes::from(self.payload.clone()),
+        )
+            .abi_encode()
+    }
+
+    /// Canonical JSON form
+    pub fn to_json(&self) -> Result<Vec<u8>> {
+        let payload = serde_json::from_slice(&self.payload).unwrap_or_else(|_| {
+            serde_json::Value::String(format!("0x{}", alloy_primitives::hex::encode(&self.payload)))
+        });
+        canonical_json::to_vec(&JsonEnvelope {
+            schema_version: SCHEMA_VERSION,
+            component: self.component.name,
+            component_version: self.component.version,
+            feed_id: &self.feed_id,
+            flags: self.flags,
+            commitment_hash: self.commitment_hash.to_string(),
+            commitment: self.commitment(),
+            payload,
+        })
+    }
+}
+
+/// Whether results are enveloped, from the `output_envelope` kv config
+pub fn enabled() -> Result<bool> {
+    match std::env::var("output_envelope").as_deref() {
+        Err(_) | Ok("v1") => Ok(true),
+        Ok("none") => Ok(false),
+        Ok(other) => Err(anyhow!("unknown output_envelope {other}, expected v1 or none")),
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Format {
+    /// On-chain submissions
+    Abi,
+    /// CLI output
+    Json,
+}
+
+/// Envelopes `payload` in the given form, or returns it unchanged when
+/// enveloping is disabled
+pub fn seal(
+    component: ComponentInfo,
+    feed_id: impl Into<String>,
+    flags: u32,
+    payload: Vec<u8>,
+    format: Format,
+) -> Result<Vec<u8>> {
+    if !enabled()? {
+        return Ok(payload);
+    }
+    let envelope = Envelope::new(component, feed_id, payload)?.with_flags(flags);
+    match format {
+        Format::Abi => Ok(envelope.abi_encode()),
+        Format::Json => envelope.to_json(),
+    }
+}
@@ -0,0 +1,175 @@
+//! Read-only contract calls over the operator's RPC endpoint.
+
+use crate::types::TriggerBlock;
+use alloy_network::Ethereum;
+use alloy_primitives::{Address, Bytes, TxKind, B256, U256, U64};
+use alloy_provider::{Provider, RootProvider};
+use alloy_rpc_types::{eth::TransactionRequest, BlockId, TransactionInput};
+use alloy_sol_types::SolCall;
+use anyhow::{anyhow, Result};
+use serde::Deserialize;
+use serde_json::json;
+use wavs_wasi_chain::ethereum::new_eth_provider;
+
+/// Creates a provider for the `http_endpoint` of a chain from `wavs.toml`
+pub fn provider(http_endpoint: &str) -> Result<RootProvider<Ethereum>> {
+    new_eth_provider::<Ethereum>(http_endpoint.to_string())
+        .map_err(|e| anyhow!("failed to create provider: {e}"))
+}
+
+/// Executes `eth_call` for a `sol!` generated call and decodes its return value.
+///
+/// Pass `block` to pin the read to a block height so every operator sees the same state.
+pub async fn call<C: SolCall>(
+    provider: &RootProvider<Ethereum>,
+    to: Address,
+    call: &C,
+    block: Option<u64>,
+) -> Result<C::Return> {
+    let tx = TransactionRequest {
+        to: Some(TxKind::Call(to)),
+        input: TransactionInput { input: Some(call.abi_encode().into()), data: None },
+        ..Default::default()
+    };
+
+    let mut request = provider.call(&tx);
+    if let Some(block) = block {
+        request = request.block(BlockId::number(block));
+    }
+    let result = request.await.map_err(|e| anyhow!("eth_call to {to} failed: {e}"))?;
+
+    C::abi_decode_returns(&result, false)
+        .map_err(|e| anyhow!("failed to decode {}: {e}", C::SIGNATURE))
+}
+
+/// The fields of a block header the components use
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Deserialize)]
+pub struct BlockHeader {
+    pub number: U64,
+    pub hash: B256,
+    pub timestamp: U64,
+}
+
+/// Height of the chain's latest block
+pub async fn block_number(provider: &RootProvider<Ethereum>) -> Result<u64> {
+    let height: U64 = provider
+        .raw_request("eth_blockNumber".into(), ())
+        .await
+        .map_err(|e| anyhow!("eth_blockNumber failed: {e}"))?;
+    Ok(height.to())
+}
+
+/// Header of the block at `height`
+pub async fn block_header(provider: &RootProvider<Ethereum>, height: u64) -> Result<BlockHeader> {
+    let block: Option<BlockHeader> = provider
+        .raw_request("eth_getBlockByNumber".into(), (U64::from(height), false))
+        .await
+        .map_err(|e| anyhow!("eth_getBlockByNumber {height} failed: {e}"))?;
+    block.ok_or_else(|| anyhow!("block {height} not found"))
+}
+
+/// Header of the block with `hash`, `None` when the node does not know it
+pub async fn block_header_by_hash(
+    provider: &RootProvider<Ethereum>,
+    hash: B256,
+) -> Result<Option<BlockHeader>> {
+    provider
+        .raw_request("eth_getBlockByHash".into(), (hash, false))
+        .await
+        .map_err(|e| anyhow!("eth_getBlockByHash {hash} failed: {e}"))
+}
+
+/// Header of the block a `tag` such as `finalized` or `safe` currently names
+pub async fn tagged_header(provider: &RootProvider<Ethereum>, tag: &str) -> Result<BlockHeader> {
+    let block: Option<BlockHeader> = provider
+        .raw_request("eth_getBlockByNumber".into(), (tag, false))
+        .await
+        .map_err(|e| anyhow!("eth_getBlockByNumber {tag} failed: {e}"))?;
+    block.ok_or_else(|| anyhow!("no {tag} block"))
+}
+
+/// Header of the block a chain trigger was emitted in, read over the chain's
+/// `http_endpoint`; its hash identifies the exact chain state the trigger saw
+pub async fn trigger_header(block: &TriggerBlock) -> Result<BlockHeader> {
+    let endpoint = block.http_endpoint.as_deref().ok_or_else(|| {
+        anyhow!("no http_endpoint for chain {} to read block {}", block.chain_name, block.height)
+    })?;
+    block_header(&provider(endpoint)?, block.height).await
+}
+
+/// The fields of a log the components use
+#[derive(Debug, Clone, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct Log {
+    pub block_number: U64,
+    pub transaction_index: U64,
+    pub log_index: U64,
+    pub transaction_hash: B256,
+    pub topics: Vec<B256>,
+    pub data: Bytes,
+}
+
+/// Logs `address` emitted from block `from` to `to` inclusive whose first
+/// topic is any of `topics0`, in chain order
+pub async fn logs(
+    provider: &RootProvider<Ethereum>,
+    address: Address,
+    topics0: &[B256],
+    from: u64,
+    to: u64,
+) -> Result<Vec<Log>> {
+    let filter = json!({
+        "address": address,
+        "topics": [topics0],
+        "fromBlock": U64::from(from),
+        "toBlock": U64::from(to),
+    });
+    let mut logs: Vec<Log> = provider
+        .raw_request("eth_getLogs".into(), (filter,))
+        .await
+        .map_err(|e| anyhow!("eth_getLogs {from}..={to} for {address} failed: {e}"))?;
+    logs.sort_by_key(|log| (log.block_number, log.log_index));
+    Ok(logs)
+}
+
+/// `eth_feeHistory` for the blocks ending at `newest`
+#[derive(Debug, Clone, PartialEq, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct FeeHistory {
+    pub oldest_block: U64,
+    /// One per block plus the base fee of the block after `newest`
+    pub base_fee_per_gas: Vec<U256>,
+    pub gas_used_ratio: Vec<f64>,
+    /// Per block, the priority fee at each requested percentile
+    #[serde(default)]
+    pub reward: Vec<Vec<U256>>,
+}
+
+/// Base fees, utilization and priority fee `percentiles` of the `count`
+/// blocks ending at `newest`
+pub async fn fee_history(
+    provider: &RootProvider<Ethereum>,
+    count: u64,
+    newest: u64,
+    percentiles: &[f64],
+) -> Result<FeeHistory> {
+    provider
+        .raw_request("eth_feeHistory".into(), (U64::from(count), U64::from(newest), percentiles))
+        .await
+        .map_err(|e| anyhow!("eth_feeHistory {count} blocks to {newest} failed: {e}"))
+}
+
+#[derive(Debug, Deserialize)]
+struct TxPoolStatus {
+    pending: U64,
+}
+
+/// Executable transactions in the node's pool, from the `txpool_status`
+/// method Geth, Erigon, Reth and Nethermind expose
+pub async fn txpool_pending(provider: &RootProvider<Ethereum>) -> Result<u64> {
+    let status: TxPoolStatus = provider
+        .raw_request("txpool_status".into(), ())
+        .await
+        .map_err(|e| anyhow!("txpool_status failed: {e}"))?;
+    Ok(status.pending.to())
+}
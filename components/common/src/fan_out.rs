@@ -0,0 +1,66 @@
+//! Bounded-concurrency fetching from several upstream sources.
+//!
+//! Like an errgroup: sources run in parallel, at most `max_concurrency` at a
+//! time, each with its own timeout on top of the run deadline. The first
+//! failure drops the remaining requests.
+
+use crate::context::RunContext;
+use anyhow::{anyhow, Context, Result};
+use futures::{StreamExt, TryStreamExt};
+use std::{fmt::Display, future::Future, time::Duration};
+
+pub const DEFAULT_MAX_CONCURRENCY: usize = 4;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct FanOut {
+    pub max_concurrency: usize,
+    pub source_timeout: Option<Duration>,
+}
+
+impl Default for FanOut {
+    fn default() -> Self {
+        Self { max_concurrency: DEFAULT_MAX_CONCURRENCY, source_timeout: None }
+    }
+}
+
+impl FanOut {
+    /// Reads `max_concurrency` and `source_timeout_ms` from the service config
+    pub fn from_env() -> Result<Self> {
+        let mut fan_out = Self::default();
+        if let Ok(max) = std::env::var("max_concurrency") {
+            fan_out.max_concurrency = max.parse().context("invalid max_concurrency")?;
+            if fan_out.max_concurrency == 0 {
+                return Err(anyhow!("max_concurrency must be at least 1"));
+            }
+        }
+        if let Ok(ms) = std::env::var("source_timeout_ms") {
+            let ms = ms.parse().context("invalid source_timeout_ms")?;
+            fan_out.source_timeout = Some(Duration::from_millis(ms));
+        }
+        Ok(fan_out)
+    }
+
+    /// Runs every source and returns their results in input order, or the
+    /// first error
+    pub async fn try_join<I, T, E, Fut>(&self, ctx: &RunContext, sources: I) -> Result<Vec<T>>
+    where
+        I: IntoIterator<Item = Fut>,
+        Fut: Future<Output = Result<T, E>>,
+        E: Display,
+    {
+        let source_timeout = self.source_timeout;
+        futures::stream::iter(sources)
+            .map(|source| async move {
+                // The per-source deadline starts when the request does, not
+                // while it is queued behind the concurrency limit
+                let ctx = match source_timeout {
+                    Some(timeout) => ctx.with_timeout(timeout),
+                    None => ctx.clone(),
+                };
+                ctx.run(source).await?.map_err(|e| anyhow!("{e}"))
+            })
+            .buffered(self.max_concurrency)
+            .try_collect()
+            .await
+    }
+}
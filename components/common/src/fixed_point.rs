@@ -0,0 +1,149 @@
+//! Decimal numbers to fixed-point `uint256` without float arithmetic.
+//!
+//! `(price * 10f64.powi(decimals)) as u128` silently saturates on overflow,
+//! truncates to zero on underflow and bakes binary float error into the last
+//! digits (`1.1` with 18 decimals becomes `1100000000000000128`). Here the
+//! decimal digits are shifted exactly: floats go through their shortest
+//! round-trip representation, which is what the provider sent, and every
+//! lossy case is reported:
+//!
+//! - [`ScaleError::Overflow`] when the result exceeds `uint256`;
+//! - [`ScaleError::PrecisionLoss`] when [`Rounding::Exact`] would drop
+//!   non-zero digits;
+//! - [`ScaleError::Underflow`] when a non-zero value rounds to zero.
+
+use alloy_primitives::{I256, U256};
+use std::fmt;
+
+/// What to do with digits beyond the requested decimals
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Rounding {
+    /// Fail with [`ScaleError::PrecisionLoss`]
+    Exact,
+    /// Round half away from zero
+    HalfUp,
+    /// Drop them
+    Down,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum ScaleError {
+    /// Not a plain decimal number
+    Malformed(String),
+    NotFinite,
+    Negative,
+    Overflow,
+    PrecisionLoss,
+    Underflow,
+}
+
+impl fmt::Display for ScaleError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Self::Malformed(s) => write!(f, "{s:?} is not a decimal number"),
+            Self::NotFinite => f.write_str("value is not finite"),
+            Self::Negative => f.write_str("value is negative"),
+            Self::Overflow => f.write_str("value overflows 256 bits"),
+            Self::PrecisionLoss => f.write_str("value has more digits than the decimals"),
+            Self::Underflow => f.write_str("non-zero value rounds to zero"),
+        }
+    }
+}
+
+impl std::error::Error for ScaleError {}
+
+/// Scales a non-negative decimal string such as `"1234.5"`, `"0.000012"` or
+/// `"1.5e-7"` to fixed point with `decimals`
+pub fn parse(s: &str, decimals: u8, rounding: Rounding) -> Result<U256, ScaleError> {
+    let malformed = || ScaleError::Malformed(s.to_string());
+    let trimmed = s.trim();
+    let trimmed = trimmed.strip_prefix('+').unwrap_or(trimmed);
+    if trimmed.starts_with('-') {
+        return Err(ScaleError::Negative);
+    }
+    let (mantissa, exponent) = match trimmed.split_once(['e', 'E']) {
+        Some((mantissa, exponent)) => (mantissa, exponent.parse::<i32>().map_err(|_| malformed())?),
+        None => (trimmed, 0),
+    };
+    let (whole, fraction) = mantissa.split_once('.').unwrap_or((mantissa, ""));
+    if (whole.is_empty() && fraction.is_empty())
+        || !whole.bytes().chain(fraction.bytes()).all(|b| b.is_ascii_digit())
+    {
+        return Err(malformed());
+    }
+
+    // digits * 10^(shift): the decimal point moves right by the exponent and
+    // the decimals, and left by the fraction length
+    let digits: Vec<u8> = whole.bytes().chain(fraction.bytes()).map(|b| b - b'0').collect();
+    let shift = exponent as i64 + decimals as i64 - fraction.len() as i64;
+    let (kept, dropped) = if shift >= 0 {
+        (&digits[..], &[][..])
+    } else {
+        let cut = digits.len().saturating_sub(shift.unsigned_abs() as usize);
+        digits.split_at(cut)
+    };
+
+    let mut value = U256::ZERO;
+    for &digit in kept {
+        value = value
+            .checked_mul(U256::from(10))
+            .and_then(|v| v.checked_add(U256::from(digit)))
+            .ok_or(ScaleError::Overflow)?;
+    }
+    // Zero stays zero however far it is shifted
+    if shift > 0 && !value.is_zero() {
+        let scale = U256::from(10).checked_pow(U256::from(shift)).ok_or(ScaleError::Overflow)?;
+        value = value.checked_mul(scale).ok_or(ScaleError::Overflow)?;
+    }
+
+    if dropped.iter().any(|&d| d != 0) {
+        // The first dropped digit decides rounding only when it is the digit
+        // right after the kept ones
+        let rounds_up = shift.unsigned_abs() as usize == dropped.len() && dropped[0] >= 5;
+        value = match rounding {
+            Rounding::Exact => return Err(ScaleError::PrecisionLoss),
+            Rounding::Down => value,
+            Rounding::HalfUp if rounds_up => {
+                value.checked_add(U256::from(1)).ok_or(ScaleError::Overflow)?
+            }
+            Rounding::HalfUp => value,
+        };
+        if value.is_zero() {
+            return Err(ScaleError::Underflow);
+        }
+    }
+    Ok(value)
+}
+
+/// [`parse`] for values that may be negative, to fixed-point `int256`.
+/// Rounding applies to the magnitude, so half rounds away from zero.
+pub fn parse_signed(s: &str, decimals: u8, rounding: Rounding) -> Result<I256, ScaleError> {
+    let trimmed = s.trim();
+    let (negative, magnitude) = match trimmed.strip_prefix('-') {
+        Some(magnitude) => (true, magnitude),
+        None => (false, trimmed),
+    };
+    if magnitude.starts_with(['-', '+']) {
+        return Err(ScaleError::Malformed(s.to_string()));
+    }
+    let magnitude = parse(magnitude, decimals, rounding)?;
+    let value = I256::try_from(magnitude).map_err(|_| ScaleError::Overflow)?;
+    Ok(if negative { -value } else { value })
+}
+
+/// Scales a float to fixed point with `decimals`, using the shortest decimal
+/// that round-trips to it rather than its binary expansion
+pub fn from_f64(value: f64, decimals: u8, rounding: Rounding) -> Result<U256, ScaleError> {
+    if !value.is_finite() {
+        return Err(ScaleError::NotFinite);
+    }
+    if value < 0.0 {
+        return Err(ScaleError::Negative);
+    }
+    if value == 0.0 {
+        // Also -0.0, which would print with its sign
+        return Ok(U256::ZERO);
+    }
+    // `Display` gives the shortest round-trip digits, never in exponent form
+    parse(&value.to_string(), decimals, rounding)
+}
@@ -0,0 +1,83 @@
+//! Gas estimates for submitting a result to `SimpleSubmit`.
+//!
+//! The layer-trigger world returns only the result bytes, so a component
+//! cannot hand the submitter a gas limit; the submitter uses the `max_gas` of
+//! the service config. Instead, when the `max_submission_gas` kv config is set
+//! (to the same value as `max_gas`), results whose estimated submission cost
+//! exceeds it fail in the component with an actionable error rather than
+//! running out of gas on-chain.
+//!
+//! The estimate covers the transaction, its calldata and the fresh storage
+//! `handleSignedData` writes for the data and the signature. Signature
+//! validation is approximated by [`VALIDATION_GAS`]. A batch writes that
+//! storage once per result.
+
+use anyhow::{anyhow, Context, Result};
+
+pub const TX_BASE_GAS: u64 = 21_000;
+/// Cold SSTORE of a zero slot
+pub const STORAGE_WORD_GAS: u64 = 22_100;
+/// Signature validation by the service manager and the `abi.decode`
+pub const VALIDATION_GAS: u64 = 60_000;
+/// An ECDSA signature: 65 bytes
+pub const SIGNATURE_BYTES: usize = 65;
+
+/// EIP-2028 calldata cost: 4 gas per zero byte, 16 per non-zero byte
+pub fn calldata_gas(data: &[u8]) -> u64 {
+    data.iter().map(|b| if *b == 0 { 4 } else { 16 }).sum()
+}
+
+/// Storage cost of a `bytes` value: one slot when shorter than 32 bytes,
+/// otherwise the length slot plus a slot per word
+pub fn bytes_storage_gas(len: usize) -> u64 {
+    let slots = if len < 32 { 1 } else { 1 + len.div_ceil(32) };
+    slots as u64 * STORAGE_WORD_GAS
+}
+
+/// Estimated gas of `handleSignedData` for `output`, the ABI-encoded
+/// `DataWithId` returned by the component
+pub fn estimate_submission(output: &[u8]) -> u64 {
+    // `data` is at most the encoded output, minus its ABI head
+    let data_len = output.len().saturating_sub(4 * 32);
+    let calldata = calldata_gas(output) + 16 * SIGNATURE_BYTES as u64;
+    let storage =
+        bytes_storage_gas(data_len) + bytes_storage_gas(SIGNATURE_BYTES) + STORAGE_WORD_GAS;
+    TX_BASE_GAS + calldata + storage + VALIDATION_GAS
+}
+
+/// Estimated gas of `handleSignedData` for `output`, a batch whose results
+/// are `result_lens` bytes long: one transaction and validation, but storage
+/// for every result
+pub fn estimate_batch_submission(output: &[u8], result_lens: &[usize]) -> u64 {
+    let calldata = calldata_gas(output) + 16 * SIGNATURE_BYTES as u64;
+    let storage: u64 = result_lens
+        .iter()
+        .map(|&len| bytes_storage_gas(len) + bytes_storage_gas(SIGNATURE_BYTES) + STORAGE_WORD_GAS)
+        .sum();
+    TX_BASE_GAS + calldata + storage + VALIDATION_GAS
+}
+
+/// Fails when the estimated submission gas of `output` exceeds the
+/// `max_submission_gas` kv config; returns the estimate otherwise
+pub fn check_submission(output: &[u8]) -> Result<u64> {
+    check_estimate(output.len(), estimate_submission(output))
+}
+
+/// [`check_submission`] for a batch, see [`estimate_batch_submission`]
+pub fn check_batch_submission(output: &[u8], result_lens: &[usize]) -> Result<u64> {
+    check_estimate(output.len(), estimate_batch_submission(output, result_lens))
+}
+
+fn check_estimate(len: usize, estimate: u64) -> Result<u64> {
+    let Ok(max_gas) = std::env::var("max_submission_gas") else {
+        return Ok(estimate);
+    };
+    let max_gas: u64 = max_gas.parse().context("invalid max_submission_gas")?;
+    if estimate > max_gas {
+        return Err(anyhow!(
+            "submitting {len} bytes needs about {estimate} gas, above max_submission_gas {max_gas}; \
+             raise max_gas in the service config or set max_output_bytes"
+        ));
+    }
+    Ok(estimate)
+}
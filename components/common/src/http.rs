@@ -0,0 +1,297 @@
+//! Generic request building and sending.
+//!
+//! Complements `wavs_wasi_chain::http` with POST bodies (JSON, form encoded,
+//! GraphQL) and with responses that keep their status and headers, which
+//! `fetch_bytes` does not expose. Requests are returned unsent so callers can
+//! still apply header rules and the proxy. Every request sent here is counted
+//! by [`cost`], and recorded for the [`determinism`] check, so components fetch
+//! through [`fetch_bytes`] and [`fetch_json`] rather than their
+//! `wavs_wasi_chain` namesakes.
+
+use crate::{cost, determinism};
+use alloy_primitives::hex;
+use anyhow::{anyhow, Context, Result};
+use serde::{de::DeserializeOwned, Deserialize, Serialize};
+use sha2::{Digest, Sha256};
+use wstd::{
+    http::{
+        error::{ErrorVariant, WasiHttpErrorCode},
+        Body, Client, IntoBody, Method, Request,
+    },
+    io::AsyncRead,
+};
+
+/// A fully read response
+#[derive(Debug, Clone)]
+pub struct Response {
+    pub status: u16,
+    /// Header names lowercased; values that are not valid UTF-8 are dropped
+    pub headers: Vec<(String, String)>,
+    pub body: Vec<u8>,
+}
+
+impl Response {
+    pub fn header(&self, name: &str) -> Option<&str> {
+        self.headers
+            .iter()
+            .find(|(key, _)| key.eq_ignore_ascii_case(name))
+            .map(|(_, value)| value.as_str())
+    }
+
+    /// The body of a `200 OK` response, an error for any other status
+    pub fn into_ok_body(self) -> Result<Vec<u8>> {
+        match self.status {
+            200 => Ok(self.body),
+            status => Err(anyhow!("Status: {status}")),
+        }
+    }
+}
+
+/// A request that got no response, with the error code the host reported:
+/// DNS, connection, TLS and response timeout failures. An HTTP error status is
+/// a response, not a transport error.
+#[derive(Debug, Clone)]
+pub struct TransportError(pub WasiHttpErrorCode);
+
+impl TransportError {
+    /// The host could not reach the server or complete the TLS handshake, as
+    /// opposed to a malformed request or response
+    pub fn is_connection(&self) -> bool {
+        use WasiHttpErrorCode::*;
+        self.is_tls()
+            || matches!(
+                self.0,
+                DnsTimeout
+                    | DnsError(_)
+                    | DestinationNotFound
+                    | DestinationUnavailable
+                    | DestinationIpProhibited
+                    | DestinationIpUnroutable
+                    | ConnectionRefused
+                    | ConnectionTerminated
+                    | ConnectionTimeout
+                    | ConnectionReadTimeout
+                    | ConnectionWriteTimeout
+                    | ConnectionLimitReached
+                    | HttpResponseTimeout
+            )
+    }
+
+    /// The server's certificate was rejected or the TLS handshake failed
+    pub fn is_tls(&self) -> bool {
+        use WasiHttpErrorCode::*;
+        matches!(self.0, TlsProtocolError | TlsCertificateError | TlsAlertReceived(_))
+    }
+}
+
+impl std::fmt::Display for TransportError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(f, "request failed: {:?}", self.0)
+    }
+}
+
+impl std::error::Error for TransportError {}
+
+/// The [`TransportError`] behind `e`, if it is one
+pub fn transport_error(e: &anyhow::Error) -> Option<&TransportError> {
+    e.chain().find_map(|cause| cause.downcast_ref())
+}
+
+/// Keeps the host's error code of a failed send as a [`TransportError`]
+fn send_error(e: wstd::http::Error) -> anyhow::Error {
+    match e.variant() {
+        ErrorVariant::WasiHttp(code) => anyhow::Error::new(TransportError(code.clone())),
+        _ => anyhow::Error::new(e),
+    }
+}
+
+/// Sends `req` and reads the whole response. While the determinism check
+/// runs, responses and transport errors are recorded by method and URI.
+pub async fn send<B: Body>(req: Request<B>) -> Result<Response> {
+    if !determinism::active() {
+        return send_live(req).await;
+    }
+    let key = format!("{} {}", req.method(), req.uri());
+    // Transport errors are kept typed, failover and TLS checks look at them
+    let outcome = determinism::fetch(&key, move || async move {
+        match send_live(req).await {
+            Ok(response) => Ok(Ok(response)),
+            Err(e) => match transport_error(&e) {
+                Some(transport) => Ok(Err(transport.clone())),
+                None => Err(e),
+            },
+        }
+    })
+    .await?;
+    outcome.map_err(anyhow::Error::new)
+}
+
+async fn send_live<B: Body>(req: Request<B>) -> Result<Response> {
+    let mut response = Client::new().send(req).await.map_err(send_error)?;
+    let headers = response
+        .headers()
+        .iter()
+        .filter_map(|(name, value)| {
+            Some((name.as_str().to_string(), value.to_str().ok()?.to_string()))
+        })
+        .collect();
+    let mut body = Vec::new();
+    response.body_mut().read_to_end(&mut body).await?;
+    cost::record(body.len());
+    Ok(Response { status: response.status().as_u16(), headers, body })
+}
+
+/// Sends `req` and decodes a `200 OK` JSON response
+pub async fn send_json<T: DeserializeOwned, B: Body>(req: Request<B>) -> Result<T> {
+    let body = send(req).await?.into_ok_body()?;
+    serde_json::from_slice(&body).context("invalid JSON response")
+}
+
+/// Sends `req` and returns the body of a `200 OK` response
+pub async fn fetch_bytes<B: Body>(req: Request<B>) -> Result<Vec<u8>> {
+    send(req).await?.into_ok_body()
+}
+
+/// [`fetch_bytes`] that stops reading, and fails, once the body exceeds
+/// `max_bytes`, so a server cannot make the component buffer an unbounded body
+pub async fn fetch_bytes_limited<B: Body>(req: Request<B>, max_bytes: usize) -> Result<Vec<u8>> {
+    if !determinism::active() {
+        return fetch_limited_live(req, max_bytes).await;
+    }
+    let key = format!("{} {} (at most {max_bytes} bytes)", req.method(), req.uri());
+    determinism::fetch(&key, || fetch_limited_live(req, max_bytes)).await
+}
+
+async fn fetch_limited_live<B: Body>(req: Request<B>, max_bytes: usize) -> Result<Vec<u8>> {
+    let mut response = Client::new().send(req).await.map_err(send_error)?;
+    let status = response.status().as_u16();
+    if status != 200 {
+        return Err(anyhow!("Status: {status}"));
+    }
+    let mut body = Vec::new();
+    let mut chunk = vec![0; 16 * 1024];
+    loop {
+        let read = response.body_mut().read(&mut chunk).await?;
+        if read == 0 {
+            break;
+        }
+        if body.len() + read > max_bytes {
+            return Err(anyhow!("response body exceeds {max_bytes} bytes"));
+        }
+        body.extend_from_slice(&chunk[..read]);
+    }
+    cost::record(body.len());
+    Ok(body)
+}
+
+/// Same as [`send_json`], named after the `wavs_wasi_chain` helper it replaces
+pub async fn fetch_json<T: DeserializeOwned, B: Body>(req: Request<B>) -> Result<T> {
+    send_json(req).await
+}
+
+/// A POST with a raw body
+pub fn post(url: &str, content_type: &str, body: Vec<u8>) -> Result<Request<impl Body>> {
+    Ok(Request::builder()
+        .method(Method::POST)
+        .uri(url)
+        .header("Content-Type", content_type)
+        .header("Accept", "application/json")
+        .body(body.into_body())?)
+}
+
+/// A POST with a JSON body
+pub fn post_json<T: Serialize>(url: &str, body: &T) -> Result<Request<impl Body>> {
+    post(url, "application/json", serde_json::to_vec(body)?)
+}
+
+/// A POST with an `application/x-www-form-urlencoded` body
+pub fn post_form(url: &str, fields: &[(&str, &str)]) -> Result<Request<impl Body>> {
+    let body = fields
+        .iter()
+        .map(|(key, value)| format!("{}={}", form_encode(key), form_encode(value)))
+        .collect::<Vec<_>>()
+        .join("&");
+    post(url, "application/x-www-form-urlencoded", body.into_bytes())
+}
+
+/// A `multipart/form-data` POST carrying a single file, as IPFS and pinning
+/// APIs expect uploads
+pub fn post_file(
+    url: &str,
+    field: &str,
+    filename: &str,
+    content_type: &str,
+    data: &[u8],
+) -> Result<Request<impl Body>> {
+    // Derived from the content so the request is reproducible, and a hash of
+    // the data will not occur in the data itself
+    let boundary = format!("wavs-{}", &hex::encode(Sha256::digest(data))[..32]);
+    let mut body = format!(
+        "--{boundary}\r\nContent-Disposition: form-data; name=\"{field}\"; filename=\"{filename}\"\r\nContent-Type: {content_type}\r\n\r\n"
+    )
+    .into_bytes();
+    body.extend_from_slice(data);
+    body.extend_from_slice(format!("\r\n--{boundary}--\r\n").as_bytes());
+    post(url, &format!("multipart/form-data; boundary={boundary}"), body)
+}
+
+#[derive(Serialize)]
+struct GraphQlRequest<'a, V> {
+    query: &'a str,
+    variables: V,
+}
+
+#[derive(Deserialize)]
+struct GraphQlResponse<T> {
+    data: Option<T>,
+    #[serde(default)]
+    errors: Vec<GraphQlError>,
+}
+
+#[derive(Deserialize)]
+struct GraphQlError {
+    message: String,
+}
+
+/// A GraphQL query POSTed as JSON
+pub fn graphql<V: Serialize>(url: &str, query: &str, variables: V) -> Result<Request<impl Body>> {
+    post_json(url, &GraphQlRequest { query, variables })
+}
+
+/// Sends a GraphQL request, failing on any reported error
+pub async fn send_graphql<T: DeserializeOwned, B: Body>(req: Request<B>) -> Result<T> {
+    let response: GraphQlResponse<T> = send_json(req).await?;
+    if let Some(error) = response.errors.first() {
+        return Err(anyhow!("GraphQL error: {}", error.message));
+    }
+    response.data.ok_or_else(|| anyhow!("GraphQL response has no data"))
+}
+
+fn form_encode(s: &str) -> String {
+    let mut out = String::with_capacity(s.len());
+    for b in s.bytes() {
+        match b {
+            b'A'..=b'Z' | b'a'..=b'z' | b'0'..=b'9' | b'-' | b'.' | b'_' | b'*' => {
+                out.push(b as char)
+            }
+            b' ' => out.push('+'),
+            _ => out.push_str(&format!("%{b:02X}")),
+        }
+    }
+    out
+}
+
+/// Percent-encodes everything but RFC 3986 unreserved characters, for URL
+/// query values and path segments
+pub fn percent_encode(s: &str) -> String {
+    let mut out = String::with_capacity(s.len() * 3);
+    for b in s.bytes() {
+        match b {
+            b'A'..=b'Z' | b'a'..=b'z' | b'0'..=b'9' | b'-' | b'.' | b'_' | b'~' => {
+                out.push(b as char)
+            }
+            _ => out.push_str(&format!("%{b:02X}")),
+        }
+    }
+    out
+}
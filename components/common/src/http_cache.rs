@@ -0,0 +1,179 @@
+//! Conditional GETs backed by a local cache of validators and bodies.
+//!
+//! The last `ETag` / `Last-Modified` of each URL is stored next to its body
+//! in the `http_cache_dir` kv directory. Later requests send them as
+//! `If-None-Match` / `If-Modified-Since`, and a `304 Not Modified` reuses the
+//! cached body, so frequent cron-triggered fetches cost the provider little.
+//! The `http_cache_capacity` most recently used URLs are kept. Like the
+//! result cache it is only an optimization and safe to delete.
+//!
+//! A cached body was verified when it was first fetched, not in the run that
+//! reuses it, so the [`ResponseVerifier`] audit of a `304` run reports it
+//! unverified.
+
+use crate::{
+    config,
+    http::{self, Response},
+    signed_response::ResponseVerifier,
+};
+use alloy_primitives::hex;
+use anyhow::{anyhow, Context, Result};
+use serde::{Deserialize, Serialize};
+use sha2::{Digest, Sha256};
+use std::path::{Path, PathBuf};
+use wstd::http::{Body, HeaderValue, Request};
+
+/// Number of URLs kept when `http_cache_capacity` is not configured
+pub const DEFAULT_CAPACITY: usize = 256;
+
+/// Cached URLs, least recently used first, so the oldest are evicted without
+/// listing the directory
+const INDEX_FILE: &str = "index.json";
+
+pub struct HttpCache {
+    dir: PathBuf,
+    capacity: usize,
+}
+
+#[derive(Debug, Default, Serialize, Deserialize)]
+struct Validators {
+    etag: Option<String>,
+    last_modified: Option<String>,
+}
+
+/// A request's cache entry, looked up before the request is sent
+pub struct Lookup {
+    key: String,
+    cached: Option<(Validators, Vec<u8>)>,
+}
+
+impl HttpCache {
+    /// Opens the cache in the `http_cache_dir` kv config, or returns `None` when it is not set
+    pub fn from_env() -> Result<Option<Self>> {
+        let Some(dir) = config::string("http_cache_dir") else {
+            return Ok(None);
+        };
+        Self::open(dir, config::parse_or("http_cache_capacity", DEFAULT_CAPACITY)?).map(Some)
+    }
+
+    pub fn open(dir: impl Into<PathBuf>, capacity: usize) -> Result<Self> {
+        let dir = dir.into();
+        std::fs::create_dir_all(&dir)
+            .with_context(|| format!("failed to create http cache {}", dir.display()))?;
+        Ok(Self { dir, capacity })
+    }
+
+    /// Sends `req` conditionally and returns the fresh or cached body. New
+    /// bodies are checked by `verifier`, if any, before being cached.
+    pub async fn fetch<B: Body>(
+        &self,
+        mut req: Request<B>,
+        verifier: Option<&ResponseVerifier>,
+    ) -> Result<Vec<u8>> {
+        let lookup = self.revalidate(&mut req)?;
+        let response = http::send(req).await?;
+        self.complete(lookup, response, verifier)
+    }
+
+    /// Looks up the cached entry of `req`'s URL and adds its validators to
+    /// `req`
+    pub fn revalidate<B: Body>(&self, req: &mut Request<B>) -> Result<Lookup> {
+        let key = hex::encode(Sha256::digest(req.uri().to_string().as_bytes()));
+        let cached = self.load(&key);
+
+        if let Some((validators, _)) = &cached {
+            if let Some(etag) = &validators.etag {
+                req.headers_mut().insert("If-None-Match", HeaderValue::from_str(etag)?);
+            }
+            if let Some(last_modified) = &validators.last_modified {
+                req.headers_mut()
+                    .insert("If-Modified-Since", HeaderValue::from_str(last_modified)?);
+            }
+        }
+        Ok(Lookup { key, cached })
+    }
+
+    /// The body `response` stands for: the cached one on `304 Not Modified`,
+    /// which `verifier` did not check in this run, or the new one once
+    /// `verifier` accepts it
+    pub fn complete(
+        &self,
+        lookup: Lookup,
+        response: Response,
+        verifier: Option<&ResponseVerifier>,
+    ) -> Result<Vec<u8>> {
+        let Lookup { key, cached } = lookup;
+        match (response.status, cached) {
+            (304, Some((_, body))) => {
+                self.touch(&key)?;
+                Ok(body)
+            }
+            (304, None) => Err(anyhow!("304 Not Modified without a cached body")),
+            (200, _) => {
+                if let Some(verifier) = verifier {
+                    verifier.verify_response(&response)?;
+                }
+                self.store(&key, &response)?;
+                Ok(response.body)
+            }
+            (status, _) => Err(anyhow!("Status: {status}")),
+        }
+    }
+
+    fn load(&self, key: &str) -> Option<(Validators, Vec<u8>)> {
+        let validators = std::fs::read(self.dir.join(format!("{key}.json"))).ok()?;
+        let validators = serde_json::from_slice(&validators).ok()?;
+        let body = std::fs::read(self.dir.join(format!("{key}.body"))).ok()?;
+        Some((validators, body))
+    }
+
+    fn store(&self, key: &str, response: &Response) -> Result<()> {
+        let validators = Validators {
+            etag: response.header("etag").map(String::from),
+            last_modified: response.header("last-modified").map(String::from),
+        };
+        if validators.etag.is_none() && validators.last_modified.is_none() {
+            return Ok(());
+        }
+        // Body first, validators last: validators never point at a stale body
+        let _ = std::fs::remove_file(self.dir.join(format!("{key}.json")));
+        write_atomic(&self.dir.join(format!("{key}.body")), &response.body)?;
+        write_atomic(&self.dir.join(format!("{key}.json")), &serde_json::to_vec(&validators)?)?;
+        self.touch(key)
+    }
+
+    /// Marks `key` as the most recently used and evicts the least recently
+    /// used entries beyond the capacity
+    fn touch(&self, key: &str) -> Result<()> {
+        let mut index = self.load_index()?;
+        index.retain(|k| k != key);
+        index.push(key.to_string());
+        let evicted = index.len().saturating_sub(self.capacity);
+        for key in index.drain(..evicted) {
+            // Validators first, so a half-evicted entry is never revalidated
+            for ext in ["json", "body"] {
+                match std::fs::remove_file(self.dir.join(format!("{key}.{ext}"))) {
+                    Err(e) if e.kind() != std::io::ErrorKind::NotFound => return Err(e.into()),
+                    _ => {}
+                }
+            }
+        }
+        write_atomic(&self.dir.join(INDEX_FILE), &serde_json::to_vec(&index)?)
+    }
+
+    fn load_index(&self) -> Result<Vec<String>> {
+        let path = self.dir.join(INDEX_FILE);
+        match std::fs::read(&path) {
+            Ok(bytes) => serde_json::from_slice(&bytes)
+                .with_context(|| format!("corrupt http cache index {}", path.display())),
+            Err(e) if e.kind() == std::io::ErrorKind::NotFound => Ok(Vec::new()),
+            Err(e) => Err(e).with_context(|| format!("failed to read {}", path.display())),
+        }
+    }
+}
+
+fn write_atomic(path: &Path, data: &[u8]) -> Result<()> {
+    let tmp = path.with_extension("tmp");
+    std::fs::write(&tmp, data).context("failed to write http cache entry")?;
+    std::fs::rename(&tmp, path).context("failed to commit http cache entry")
+}
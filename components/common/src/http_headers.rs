@@ -0,0 +1,106 @@
+//! Configurable headers for upstream HTTP requests.
+//!
+//! Rules map a host (or `*` for every host) to headers. Host rules win over
+//! `*`, and rules from the `http_headers` kv config win over a component's
+//! built-in defaults, so provider workarounds can change without a rebuild:
+//!
+//! ```json
+//! {"*": {"Accept": "application/json"},
+//!  "api.example.com": {"User-Agent": "wavs/0.3", "Cookie": "session={unix_time}"}}
+//! ```
+//!
+//! Values are templates: `{unix_time}` is the run clock in seconds and
+//! `{env:NAME}` the value of an environment variable such as a `WAVS_ENV_*` secret.
+
+use crate::{context::RunContext, secret::Secret};
+use anyhow::{anyhow, Context, Result};
+use serde::Deserialize;
+use std::collections::BTreeMap;
+use wstd::http::{HeaderName, HeaderValue, Request};
+
+/// Rule key matching every host
+pub const ANY_HOST: &str = "*";
+
+#[derive(Debug, Clone, Default, PartialEq, Eq, Deserialize)]
+#[serde(transparent)]
+pub struct HeaderRules(BTreeMap<String, BTreeMap<String, String>>);
+
+impl HeaderRules {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Adds a header for `host`, replacing an earlier value of the same header
+    pub fn with(mut self, host: &str, name: &str, value: &str) -> Self {
+        self.0.entry(host.to_string()).or_default().insert(name.to_string(), value.to_string());
+        self
+    }
+
+    pub fn from_json(json: &str) -> Result<Self> {
+        serde_json::from_str(json).context("invalid http_headers")
+    }
+
+    /// Layers the `http_headers` kv config over `defaults`
+    pub fn from_env(defaults: HeaderRules) -> Result<Self> {
+        match std::env::var("http_headers") {
+            Ok(json) => Ok(defaults.merge(Self::from_json(&json)?)),
+            Err(_) => Ok(defaults),
+        }
+    }
+
+    /// Combines two rule sets, `other` taking precedence header by header
+    pub fn merge(mut self, other: HeaderRules) -> Self {
+        for (host, headers) in other.0 {
+            self.0.entry(host).or_default().extend(headers);
+        }
+        self
+    }
+
+    /// Resolved headers for `host`, names lowercased
+    pub fn for_host(&self, host: &str) -> BTreeMap<String, &str> {
+        let mut headers = BTreeMap::new();
+        for key in [ANY_HOST, host] {
+            if let Some(rules) = self.0.get(key) {
+                for (name, value) in rules {
+                    headers.insert(name.to_ascii_lowercase(), value.as_str());
+                }
+            }
+        }
+        headers
+    }
+
+    /// Sets the headers matching the request's host, rendering templates
+    pub fn apply<B>(&self, req: &mut Request<B>, ctx: &RunContext) -> Result<()> {
+        let host = req.uri().host().unwrap_or_default().to_string();
+        for (name, template) in self.for_host(&host) {
+            let name = HeaderName::from_bytes(name.as_bytes())
+                .with_context(|| format!("invalid header name {name}"))?;
+            let value = HeaderValue::from_str(&render(template, ctx)?)
+                .with_context(|| format!("invalid value for header {name}"))?;
+            req.headers_mut().insert(name, value);
+        }
+        Ok(())
+    }
+}
+
+fn render(template: &str, ctx: &RunContext) -> Result<String> {
+    let mut out = String::with_capacity(template.len());
+    let mut rest = template;
+    while let Some(start) = rest.find('{') {
+        out.push_str(&rest[..start]);
+        let end = rest[start..]
+            .find('}')
+            .ok_or_else(|| anyhow!("unterminated placeholder in {template}"))?;
+        let placeholder = &rest[start + 1..start + end];
+        match placeholder.split_once(':') {
+            None if placeholder == "unix_time" => {
+                out.push_str(&ctx.clock().unix_secs().to_string())
+            }
+            Some(("env", name)) => out.push_str(Secret::required(name)?.expose()),
+            _ => return Err(anyhow!("unknown placeholder {{{placeholder}}} in {template}")),
+        }
+        rest = &rest[start + end + 1..];
+    }
+    out.push_str(rest);
+    Ok(out)
+}
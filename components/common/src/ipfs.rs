@@ -0,0 +1,121 @@
+//! Content-addressed fetching over IPFS gateways.
+//!
+//! Gateways are untrusted: every block is hashed locally and checked against
+//! its CID, and a gateway that fails or serves the wrong bytes is skipped in
+//! favour of the next one.
+
+use crate::{
+    cid::{Cid, SHA2_256},
+    http::{self, fetch_bytes},
+    proxy,
+};
+use anyhow::{anyhow, Result};
+use serde::Deserialize;
+use sha2::{Digest, Sha256};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+/// Gateways tried in order when `ipfs_gateways` is not configured
+pub const DEFAULT_GATEWAYS: &[&str] = &["https://ipfs.io", "https://dweb.link"];
+
+/// A block whose bytes were verified against its CID
+#[derive(Debug, Clone)]
+pub struct IpfsContent {
+    pub cid: Cid,
+    pub gateway: String,
+    pub data: Vec<u8>,
+}
+
+/// Returned when every gateway answered but none served bytes matching the CID
+#[derive(Debug)]
+pub struct HashMismatch {
+    pub cid: String,
+}
+
+impl std::fmt::Display for HashMismatch {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(f, "no gateway served content matching {}", self.cid)
+    }
+}
+
+impl std::error::Error for HashMismatch {}
+
+/// Reads the comma separated `ipfs_gateways` kv config, falling back to [`DEFAULT_GATEWAYS`]
+pub fn gateways_from_env() -> Vec<String> {
+    match std::env::var("ipfs_gateways") {
+        Ok(gateways) => gateways
+            .split(',')
+            .map(|g| g.trim().trim_end_matches('/').to_string())
+            .filter(|g| !g.is_empty())
+            .collect(),
+        Err(_) => DEFAULT_GATEWAYS.iter().map(|g| g.to_string()).collect(),
+    }
+}
+
+/// Checks that `data` hashes to the CID's multihash
+pub fn verify(cid: &Cid, data: &[u8]) -> Result<bool> {
+    if cid.hash_code != SHA2_256 {
+        return Err(anyhow!("unsupported multihash code 0x{:x}", cid.hash_code));
+    }
+    Ok(Sha256::digest(data).as_slice() == cid.digest.as_slice())
+}
+
+/// Fetches the raw block for `cid`, failing over across `gateways` until one
+/// serves bytes that verify.
+///
+/// Errors with [`HashMismatch`] when gateways responded but none matched.
+pub async fn fetch_verified(cid: &str, gateways: &[String]) -> Result<IpfsContent> {
+    let parsed = Cid::parse(cid)?;
+    let mut mismatch = false;
+    let mut last_err = anyhow!("no IPFS gateways configured");
+
+    for gateway in gateways {
+        match fetch_block(gateway, cid).await {
+            Ok(data) if verify(&parsed, &data)? => {
+                return Ok(IpfsContent { cid: parsed, gateway: gateway.clone(), data });
+            }
+            Ok(_) => {
+                println!("gateway {gateway} served content not matching {cid}");
+                mismatch = true;
+            }
+            Err(e) => {
+                println!("gateway {gateway} failed: {e}");
+                last_err = e;
+            }
+        }
+    }
+
+    if mismatch {
+        return Err(HashMismatch { cid: cid.to_string() }.into());
+    }
+    Err(last_err)
+}
+
+/// Requests the raw block bytes from a single trustless gateway, without verification
+pub async fn fetch_block(gateway: &str, cid: &str) -> Result<Vec<u8>> {
+    let url = format!("{}/ipfs/{}?format=raw", gateway.trim_end_matches('/'), cid);
+    let mut req = http_request_get(&url)?;
+    req.headers_mut().insert("Accept", HeaderValue::from_static("application/vnd.ipld.raw"));
+    proxy::apply(&mut req)?;
+    fetch_bytes(req).await
+}
+
+/// Reads the `ipfs_api_url` kv config, a Kubo-compatible RPC API used for uploads
+pub fn api_url_from_env() -> Option<String> {
+    std::env::var("ipfs_api_url").ok().filter(|url| !url.is_empty())
+}
+
+#[derive(Deserialize)]
+struct Added {
+    #[serde(rename = "Hash")]
+    hash: String,
+}
+
+/// Adds and pins `data` through `/api/v0/add`, returning its CIDv1
+pub async fn add(api_url: &str, name: &str, content_type: &str, data: &[u8]) -> Result<String> {
+    let url = format!("{}/api/v0/add?cid-version=1&pin=true", api_url.trim_end_matches('/'));
+    let mut req = http::post_file(&url, "file", name, content_type, data)?;
+    proxy::apply(&mut req)?;
+    let added: Added = http::send_json(req).await?;
+    Ok(added.hash)
+}
@@ -0,0 +1,206 @@
+//! Validation of JSON requests against embedded JSON schemas.
+//!
+//! Requests are checked before they are deserialized, so a caller gets every
+//! problem at once with the path of the offending field
+//! (`/args/holders/2: expected format evm-address`) instead of the first
+//! serde error or, for lenient fields, silently ignored input.
+//!
+//! Only the subset of JSON Schema the request schemas use is implemented:
+//! `type` (a name or a list of names), `enum`, `properties`, `required`,
+//! `additionalProperties`, `items`, `minItems`, `maxItems`, `minLength`,
+//! `maxLength`, `minimum`, `maximum` and `format`, with the formats
+//! `evm-address` and `hex`. Annotations such as `title` and `description` are
+//! ignored.
+
+use anyhow::{anyhow, Context, Result};
+use serde::de::DeserializeOwned;
+use serde_json::{Map, Value};
+
+/// A field that does not match the schema
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ValidationError {
+    /// JSON pointer to the field, empty for the document itself
+    pub path: String,
+    pub message: String,
+}
+
+impl std::fmt::Display for ValidationError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        let path = if self.path.is_empty() { "/" } else { &self.path };
+        write!(f, "{}: {}", path, self.message)
+    }
+}
+
+/// Returns every violation of `schema` by `value`
+pub fn errors(schema: &Value, value: &Value) -> Vec<ValidationError> {
+    let mut errors = Vec::new();
+    check(schema, value, String::new(), &mut errors);
+    errors
+}
+
+/// Validates `value` against the JSON `schema`, listing every violation in the error
+pub fn validate(schema: &str, value: &Value) -> Result<()> {
+    let schema: Value = serde_json::from_str(schema).context("invalid JSON schema")?;
+    let errors = errors(&schema, value);
+    if errors.is_empty() {
+        return Ok(());
+    }
+    let errors: Vec<String> = errors.iter().map(ToString::to_string).collect();
+    Err(anyhow!("{}", errors.join("; ")))
+}
+
+/// Deserializes the JSON `input` after validating it against `schema`
+pub fn from_slice<T: DeserializeOwned>(schema: &str, input: &[u8]) -> Result<T> {
+    let value = serde_json::from_slice(input).context("request is not valid JSON")?;
+    validate(schema, &value)?;
+    Ok(serde_json::from_value(value)?)
+}
+
+fn check(schema: &Value, value: &Value, path: String, errors: &mut Vec<ValidationError>) {
+    let Some(schema) = schema.as_object() else {
+        return;
+    };
+    let mut fail = |message: String| errors.push(ValidationError { path: path.clone(), message });
+
+    if let Some(types) = schema.get("type") {
+        let names: Vec<&str> = match types {
+            Value::String(name) => vec![name.as_str()],
+            Value::Array(names) => names.iter().filter_map(Value::as_str).collect(),
+            _ => Vec::new(),
+        };
+        if !names.iter().any(|name| has_type(value, name)) {
+            fail(format!("expected {}, found {}", names.join(" or "), type_name(value)));
+            // The remaining keywords assume the right type
+            return;
+        }
+    }
+    if let Some(allowed) = schema.get("enum").and_then(Value::as_array) {
+        if !allowed.contains(value) {
+            let allowed: Vec<String> = allowed.iter().map(ToString::to_string).collect();
+            fail(format!("expected one of {}", allowed.join(", ")));
+        }
+    }
+    if let Some(format) = schema.get("format").and_then(Value::as_str) {
+        if let Some(s) = value.as_str() {
+            if !has_format(s, format) {
+                fail(format!("expected format {format}"));
+            }
+        }
+    }
+    if let Some(s) = value.as_str() {
+        let len = s.chars().count() as u64;
+        if let Some(min) = schema.get("minLength").and_then(Value::as_u64).filter(|min| len < *min)
+        {
+            fail(format!("must be at least {min} characters"));
+        }
+        if let Some(max) = schema.get("maxLength").and_then(Value::as_u64).filter(|max| len > *max)
+        {
+            fail(format!("must be at most {max} characters"));
+        }
+    }
+    if let Some(n) = value.as_f64() {
+        if let Some(min) = schema.get("minimum").and_then(Value::as_f64).filter(|min| n < *min) {
+            fail(format!("must be at least {min}"));
+        }
+        if let Some(max) = schema.get("maximum").and_then(Value::as_f64).filter(|max| n > *max) {
+            fail(format!("must be at most {max}"));
+        }
+    }
+    match value {
+        Value::Object(object) => check_object(schema, object, &path, errors),
+        Value::Array(items) => check_array(schema, items, &path, errors),
+        _ => {}
+    }
+}
+
+fn check_object(
+    schema: &Map<String, Value>,
+    object: &Map<String, Value>,
+    path: &str,
+    errors: &mut Vec<ValidationError>,
+) {
+    let empty = Map::new();
+    let properties = schema.get("properties").and_then(Value::as_object).unwrap_or(&empty);
+
+    for name in schema.get("required").and_then(Value::as_array).into_iter().flatten() {
+        if let Some(name) = name.as_str().filter(|name| !object.contains_key(*name)) {
+            errors.push(ValidationError {
+                path: pointer(path, name),
+                message: "required field is missing".into(),
+            });
+        }
+    }
+    for (name, field) in object {
+        match (properties.get(name), schema.get("additionalProperties")) {
+            (Some(field_schema), _) => check(field_schema, field, pointer(path, name), errors),
+            (None, Some(Value::Bool(false))) => errors.push(ValidationError {
+                path: pointer(path, name),
+                message: "unknown field".into(),
+            }),
+            (None, Some(extra)) => check(extra, field, pointer(path, name), errors),
+            (None, None) => {}
+        }
+    }
+}
+
+fn check_array(
+    schema: &Map<String, Value>,
+    items: &[Value],
+    path: &str,
+    errors: &mut Vec<ValidationError>,
+) {
+    let len = items.len() as u64;
+    if let Some(min) = schema.get("minItems").and_then(Value::as_u64).filter(|min| len < *min) {
+        errors.push(ValidationError {
+            path: path.to_string(),
+            message: format!("must have at least {min} items"),
+        });
+    }
+    if let Some(max) = schema.get("maxItems").and_then(Value::as_u64).filter(|max| len > *max) {
+        errors.push(ValidationError {
+            path: path.to_string(),
+            message: format!("must have at most {max} items"),
+        });
+    }
+    if let Some(item_schema) = schema.get("items") {
+        for (i, item) in items.iter().enumerate() {
+            check(item_schema, item, pointer(path, &i.to_string()), errors);
+        }
+    }
+}
+
+fn has_type(value: &Value, name: &str) -> bool {
+    match name {
+        "integer" => {
+            value.is_i64() || value.is_u64() || value.as_f64().is_some_and(|n| n.fract() == 0.0)
+        }
+        name => type_name(value) == name || (name == "number" && value.is_number()),
+    }
+}
+
+fn type_name(value: &Value) -> &'static str {
+    match value {
+        Value::Null => "null",
+        Value::Bool(_) => "boolean",
+        Value::Number(n) if n.is_f64() => "number",
+        Value::Number(_) => "integer",
+        Value::String(_) => "string",
+        Value::Array(_) => "array",
+        Value::Object(_) => "object",
+    }
+}
+
+fn has_format(s: &str, format: &str) -> bool {
+    let is_hex = |digits: &str| digits.bytes().all(|b| b.is_ascii_hexdigit());
+    match format {
+        "evm-address" => s.len() == 42 && s.starts_with("0x") && is_hex(&s[2..]),
+        "hex" => s.strip_prefix("0x").is_some_and(|digits| digits.len() % 2 == 0 && is_hex(digits)),
+        // Unknown formats are annotations
+        _ => true,
+    }
+}
+
+/// Appends `segment` to a JSON pointer, escaping it per RFC 6901
+fn pointer(path: &str, segment: &str) -> String {
+    format!("{}/{}", path, segment.replace('~', "~0").replace('/', "~1"))
+}
@@ -0,0 +1,53 @@
+//! Helpers shared by the WAVS components in this workspace.
+//!
+//! Everything here must compile for the `wasm32-wasip1` target, so only
+//! pure-Rust dependencies are allowed.
+
+pub mod abi;
+pub mod address_book;
+pub mod alloc_stats;
+pub mod allowlist;
+pub mod arweave;
+pub mod batch;
+pub mod bls;
+pub mod canonical_json;
+pub mod cid;
+pub mod cli_input;
+pub mod clock;
+pub mod commitment;
+pub mod config;
+pub mod context;
+pub mod cost;
+pub mod cron;
+pub mod crypto;
+pub mod destinations;
+pub mod determinism;
+pub mod envelope;
+pub mod evm;
+pub mod fan_out;
+pub mod fixed_point;
+pub mod gas;
+pub mod http;
+pub mod http_cache;
+pub mod http_headers;
+pub mod ipfs;
+pub mod json_schema;
+pub mod merkle;
+pub mod mirrors;
+pub mod output;
+pub mod output_limit;
+pub mod paginate;
+pub mod panic_guard;
+pub mod poseidon;
+pub mod proxy;
+pub mod random;
+pub mod result_cache;
+pub mod sanity;
+pub mod secret;
+pub mod signed_response;
+pub mod signer;
+pub mod trigger;
+pub mod trigger_compat;
+pub mod trigger_event;
+pub mod types;
+pub mod update_policy;
@@ -0,0 +1,84 @@
+//! Merkle trees compatible with OpenZeppelin's `MerkleProof` and `StandardMerkleTree`.
+//!
+//! Pairs are hashed in sorted order, so proofs need no left/right flags, and
+//! leaves are double hashed, `keccak256(keccak256(abi.encode(values)))`, so a
+//! leaf can never be confused with an inner node. Leaves are sorted before the
+//! tree is built, so the root does not depend on input order and matches the
+//! one `StandardMerkleTree.of(values, types)` computes for the same values.
+
+use crate::crypto::keccak256;
+use alloy_primitives::B256;
+use alloy_sol_types::SolValue;
+use anyhow::{anyhow, Result};
+
+/// Leaf hash for a tuple of values, e.g. `standard_leaf(&(account, amount))`
+pub fn standard_leaf<T: SolValue>(values: &T) -> B256 {
+    keccak256(keccak256(values.abi_encode_params()))
+}
+
+/// `keccak256` of the pair in ascending order, as in `MerkleProof._hashPair`
+pub fn hash_pair(a: B256, b: B256) -> B256 {
+    let (lo, hi) = if a <= b { (a, b) } else { (b, a) };
+    keccak256([lo.as_slice(), hi.as_slice()].concat())
+}
+
+/// A complete binary tree stored as an array: node `i` has children `2i + 1`
+/// and `2i + 2`, and leaves fill the end of the array in reverse order.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct MerkleTree {
+    nodes: Vec<B256>,
+    leaves: usize,
+}
+
+impl MerkleTree {
+    /// Builds the tree over `leaves`, which are sorted first
+    pub fn new(mut leaves: Vec<B256>) -> Result<Self> {
+        if leaves.is_empty() {
+            return Err(anyhow!("a Merkle tree needs at least one leaf"));
+        }
+        leaves.sort();
+
+        let count = leaves.len();
+        let mut nodes = vec![B256::ZERO; 2 * count - 1];
+        let last = nodes.len() - 1;
+        for (i, leaf) in leaves.into_iter().enumerate() {
+            nodes[last - i] = leaf;
+        }
+        for i in (0..nodes.len() - count).rev() {
+            nodes[i] = hash_pair(nodes[2 * i + 1], nodes[2 * i + 2]);
+        }
+        Ok(Self { nodes, leaves: count })
+    }
+
+    pub fn root(&self) -> B256 {
+        self.nodes[0]
+    }
+
+    /// Number of leaves
+    pub fn len(&self) -> usize {
+        self.leaves
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.leaves == 0
+    }
+
+    /// Sibling hashes from `leaf` up to the root, as `MerkleProof.verify`
+    /// expects them, or `None` when `leaf` is not in the tree
+    pub fn proof(&self, leaf: B256) -> Option<Vec<B256>> {
+        let first_leaf = self.nodes.len() - self.leaves;
+        let mut i = first_leaf + self.nodes[first_leaf..].iter().position(|n| *n == leaf)?;
+        let mut proof = Vec::new();
+        while i > 0 {
+            let sibling = if i % 2 == 1 { i + 1 } else { i - 1 };
+            proof.push(self.nodes[sibling]);
+            i = (i - 1) / 2;
+        }
+        Some(proof)
+    }
+}
+
+/// Checks `proof` for `leaf` against `root`, as `MerkleProof.verify` does on-chain
+pub fn verify(root: B256, leaf: B256, proof: &[B256]) -> bool {
+    proof.iter().fold(leaf, |node, sibling| hash_pair(node, *sibling)) == root
+}
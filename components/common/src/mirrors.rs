@@ -0,0 +1,63 @@
+//! Ordered mirror base URLs for a single data source.
+//!
+//! A source is tried at its first base URL; when the mirror cannot be
+//! reached (a DNS, connection or TLS failure, see
+//! [`TransportError::is_connection`]) the next mirror is tried with the same
+//! path, all within the run deadline. Any other error, such as an HTTP error
+//! status, an unparseable body or a failed signature check, is an answer from
+//! the source and is returned as is. Mirrors are configured per source with
+//! the `<source>_base_urls` kv config, a comma-separated list in order of
+//! preference.
+
+use crate::{
+    config,
+    context::RunContext,
+    http::{self, TransportError},
+    secret,
+};
+use anyhow::{anyhow, Result};
+use std::future::Future;
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Mirrors {
+    pub bases: Vec<String>,
+}
+
+impl Mirrors {
+    pub fn new(bases: Vec<String>) -> Self {
+        Self { bases: bases.into_iter().map(|b| b.trim_end_matches('/').to_string()).collect() }
+    }
+
+    /// Reads `<source>_base_urls`, falling back to `default_base` alone
+    pub fn from_env(source: &str, default_base: &str) -> Result<Self> {
+        let key = format!("{source}_base_urls");
+        let bases = config::list(&key).unwrap_or_else(|| vec![default_base.to_string()]);
+        if bases.is_empty() {
+            return Err(anyhow!("{key} is empty"));
+        }
+        Ok(Self::new(bases))
+    }
+
+    /// Calls `request` with `base + path` for each mirror until one is
+    /// reached. Stops early once `ctx` is done, so failover never extends the
+    /// deadline.
+    pub async fn fetch<T, F, Fut>(&self, ctx: &RunContext, path: &str, mut request: F) -> Result<T>
+    where
+        F: FnMut(String) -> Fut,
+        Fut: Future<Output = Result<T>>,
+    {
+        let mut last_err = anyhow!("no base URLs configured");
+        for base in &self.bases {
+            let url = format!("{base}{path}");
+            match ctx.run(request(url)).await? {
+                Ok(value) => return Ok(value),
+                Err(e) if http::transport_error(&e).is_some_and(TransportError::is_connection) => {
+                    println!("mirror {base} unreachable: {}", secret::redact(&e.to_string()));
+                    last_err = e;
+                }
+                Err(e) => return Err(e),
+            }
+        }
+        Err(last_err)
+    }
+}
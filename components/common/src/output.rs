@@ -0,0 +1,171 @@
+//! The path every component result takes to its destination.
+//!
+//! A component computes a [`Computed`] result, its payload already encoded
+//! for the trigger's destination (the ABI struct on-chain, canonical JSON for
+//! the CLI), and [`encode`] turns it into the bytes `run` returns:
+//!
+//! - on-chain: the `max_output_bytes` policy of
+//!   [`output_limit`](crate::output_limit) applied to the payload, the ABI
+//!   envelope, the operator signature and `DataWithId`, checked against
+//!   `max_submission_gas` with [`gas::check_submission`];
+//! - CLI: the JSON envelope.
+//!
+//! [`produce`] runs the component's compute step, encodes its result and
+//! copies it to the `result_destinations` of [`destinations`]. Compute and
+//! encoding run under the [`determinism`] check, so with `determinism_check`
+//! set the encoded bytes are compared; the copies are made once, after it.
+//! [`with_run_stats`] then adds this operator's run stats to CLI output,
+//! which only the operator reads.
+//!
+//! Keeping this in one place means kv config such as `max_output_bytes` and
+//! `max_submission_gas` means the same for every component.
+
+use crate::{
+    alloc_stats, canonical_json,
+    context::RunContext,
+    cost, destinations, determinism,
+    envelope::{self, ComponentInfo, Format},
+    gas,
+    output_limit::SizeLimit,
+    signer, trigger,
+    types::Destination,
+};
+use anyhow::Result;
+use wstd::runtime::block_on;
+
+/// A result before it is encoded for its destination
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Computed {
+    /// Names what was computed in the envelope
+    pub feed_id: String,
+    /// `envelope::FLAG_*` bits
+    pub flags: u32,
+    pub payload: Vec<u8>,
+}
+
+impl Computed {
+    pub fn new(feed_id: impl Into<String>, payload: Vec<u8>) -> Self {
+        Self { feed_id: feed_id.into(), flags: 0, payload }
+    }
+
+    pub fn with_flags(mut self, flags: u32) -> Self {
+        self.flags |= flags;
+        self
+    }
+}
+
+/// Runs `compute`, encodes its result for `dest` and copies it to the
+/// `result_destinations`, returning the bytes `run` returns
+pub fn produce<F>(
+    ctx: &RunContext,
+    component: ComponentInfo,
+    trigger_id: u64,
+    dest: Destination,
+    mut compute: F,
+) -> Result<Vec<u8>, String>
+where
+    F: FnMut() -> Result<Computed, String>,
+{
+    let mut computed = None;
+    let output = determinism::run_checked(|| {
+        let result = compute()?;
+        let output =
+            encode(component, trigger_id, dest, &result).map_err(|e| format!("{:#}", e))?;
+        computed = Some(result);
+        Ok(output)
+    })?;
+    let result = computed.expect("run_checked computes at least once");
+    block_on(deliver(ctx, component, trigger_id, &result)).map_err(|e| format!("{:#}", e))?;
+    with_run_stats(dest, output).map_err(|e| format!("{:#}", e))
+}
+
+/// Adds the run's [`ComputeCost`](cost::ComputeCost) to CLI output as
+/// `compute_cost` when `report_compute_cost` is set, and its
+/// [`AllocStats`](alloc_stats::AllocStats) as `alloc_stats` when built with
+/// `alloc-profiling`. On-chain output is returned unchanged: the stats differ
+/// between operators, who must agree on it. Added after the determinism
+/// check, which compares the output.
+pub fn with_run_stats(dest: Destination, output: Vec<u8>) -> Result<Vec<u8>> {
+    if dest != Destination::CliOutput {
+        return Ok(output);
+    }
+    let compute_cost = cost::reported()?;
+    let alloc_stats = alloc_stats::current();
+    if compute_cost.is_none() && alloc_stats.is_none() {
+        return Ok(output);
+    }
+    let mut json: serde_json::Value = serde_json::from_slice(&output)?;
+    // Without the envelope the payload is returned as is and may not be an object
+    let Some(object) = json.as_object_mut() else {
+        return Ok(output);
+    };
+    if let Some(compute_cost) = compute_cost {
+        object.insert("compute_cost".to_string(), serde_json::to_value(compute_cost)?);
+    }
+    if let Some(alloc_stats) = alloc_stats {
+        object.insert("alloc_stats".to_string(), serde_json::to_value(alloc_stats)?);
+    }
+    canonical_json::to_vec(&json)
+}
+
+/// The bytes `run` returns for `result`
+pub fn encode(
+    component: ComponentInfo,
+    trigger_id: u64,
+    dest: Destination,
+    result: &Computed,
+) -> Result<Vec<u8>> {
+    let Computed { feed_id, flags, payload } = result;
+    match dest {
+        Destination::Ethereum => {
+            trigger::check_trigger_id(trigger_id)?;
+            let (payload, flags) = match SizeLimit::from_env()? {
+                Some(limit) => {
+                    // The limit counts the submitted bytes, payload included
+                    let overhead =
+                        submission(component, trigger_id, feed_id, *flags, Vec::new())?.len();
+                    let limit = limit.for_encoding(overhead)?;
+                    if limit.modifies(payload.len()) {
+                        (limit.apply(payload.clone())?, flags | envelope::FLAG_SIZE_LIMITED)
+                    } else {
+                        (payload.clone(), *flags)
+                    }
+                }
+                None => (payload.clone(), *flags),
+            };
+            let output = submission(component, trigger_id, feed_id, flags, payload)?;
+            let gas = gas::check_submission(&output)?;
+            println!("estimated submission gas: {}", gas);
+            Ok(output)
+        }
+        Destination::CliOutput => {
+            envelope::seal(component, feed_id.as_str(), *flags, payload.clone(), Format::Json)
+        }
+    }
+}
+
+/// The submitted `DataWithId` of `payload`: enveloped, then signed when an
+/// operator key is configured
+fn submission(
+    component: ComponentInfo,
+    trigger_id: u64,
+    feed_id: &str,
+    flags: u32,
+    payload: Vec<u8>,
+) -> Result<Vec<u8>> {
+    let payload = envelope::seal(component, feed_id, flags, payload, Format::Abi)?;
+    let payload = signer::sign_if_configured(trigger_id, payload)?;
+    Ok(trigger::encode_output(trigger_id, payload))
+}
+
+/// Copies `result` to the `result_destinations`, returning how many it
+/// reached; failed copies are logged, not returned
+pub async fn deliver(
+    ctx: &RunContext,
+    component: ComponentInfo,
+    trigger_id: u64,
+    result: &Computed,
+) -> Result<usize> {
+    let Computed { feed_id, flags, payload } = result;
+    destinations::deliver(ctx, component, trigger_id, feed_id, *flags, payload).await
+}
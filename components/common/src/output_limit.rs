@@ -0,0 +1,210 @@
+//! Output size limits with an explicit oversize policy, and compression of
+//! large payloads.
+//!
+//! Submission contracts reject outputs above a certain size. The limits count
+//! the bytes actually submitted, so components shrink them by what the
+//! envelope, signature and `DataWithId` add around the payload with
+//! [`SizeLimit::for_encoding`] before checking the payload. Payloads within
+//! the limit are left untouched; otherwise the configured policy applies:
+//!
+//! - `error` (default): fail the invocation,
+//! - `truncate`: cut the payload and prefix it with [`FLAG_TRUNCATED`],
+//! - `compress`: compress the payload and prefix it with its codec's header
+//!   byte, failing if it still does not fit.
+//!
+//! Independently of the limit, `compress_above_bytes` compresses every
+//! payload larger than the threshold, so small frequent updates stay raw
+//! while batch and historical payloads shrink. `compression_codec` picks
+//! `deflate` (default, [`FLAG_COMPRESSED`]) or `gzip` ([`FLAG_GZIP`]).
+//!
+//! Unmodified JSON payloads start with `{` or `[`, and ABI payloads are
+//! 32-byte aligned, so consumers can tell flagged payloads apart by their
+//! first byte.
+
+use anyhow::{anyhow, Context, Result};
+use flate2::{
+    write::{DeflateEncoder, GzEncoder},
+    Compression,
+};
+use std::io::Write;
+
+/// Header byte of a payload cut to the size limit
+pub const FLAG_TRUNCATED: u8 = 0x01;
+/// Header byte of a raw-deflate compressed payload
+pub const FLAG_COMPRESSED: u8 = 0x02;
+/// Header byte of a gzip compressed payload
+pub const FLAG_GZIP: u8 = 0x03;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum OversizePolicy {
+    Error,
+    Truncate,
+    Compress,
+}
+
+impl std::str::FromStr for OversizePolicy {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self> {
+        match s {
+            "error" => Ok(Self::Error),
+            "truncate" => Ok(Self::Truncate),
+            "compress" => Ok(Self::Compress),
+            _ => Err(anyhow!("unknown oversize policy {s}, expected error, truncate or compress")),
+        }
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Codec {
+    Deflate,
+    Gzip,
+}
+
+impl std::str::FromStr for Codec {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self> {
+        match s {
+            "deflate" => Ok(Self::Deflate),
+            "gzip" => Ok(Self::Gzip),
+            _ => Err(anyhow!("unknown compression codec {s}, expected deflate or gzip")),
+        }
+    }
+}
+
+impl Codec {
+    /// Header byte of payloads compressed with the codec
+    pub fn flag(self) -> u8 {
+        match self {
+            Self::Deflate => FLAG_COMPRESSED,
+            Self::Gzip => FLAG_GZIP,
+        }
+    }
+
+    /// `data` compressed and prefixed with the codec's header byte
+    pub fn compress(self, data: &[u8]) -> Result<Vec<u8>> {
+        let body = match self {
+            Self::Deflate => deflate(data)?,
+            Self::Gzip => gzip(data)?,
+        };
+        Ok(flagged(self.flag(), &body))
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct SizeLimit {
+    /// Largest payload accepted as is, `None` for no limit
+    pub max_bytes: Option<usize>,
+    pub policy: OversizePolicy,
+    /// Payloads larger than this are compressed whether or not they fit
+    pub compress_above: Option<usize>,
+    pub codec: Codec,
+}
+
+impl SizeLimit {
+    /// Reads `max_output_bytes`, `oversize_policy`, `compress_above_bytes` and
+    /// `compression_codec` from the service config, returning `None` when
+    /// neither a limit nor a compression threshold is configured
+    pub fn from_env() -> Result<Option<Self>> {
+        let max_bytes = match std::env::var("max_output_bytes") {
+            Ok(max) => Some(max.parse().context("invalid max_output_bytes")?),
+            Err(_) => None,
+        };
+        let compress_above = match std::env::var("compress_above_bytes") {
+            Ok(threshold) => Some(threshold.parse().context("invalid compress_above_bytes")?),
+            Err(_) => None,
+        };
+        if max_bytes.is_none() && compress_above.is_none() {
+            return Ok(None);
+        }
+        let policy = match std::env::var("oversize_policy") {
+            Ok(policy) => policy.parse()?,
+            Err(_) => OversizePolicy::Error,
+        };
+        let codec = match std::env::var("compression_codec") {
+            Ok(codec) => codec.parse()?,
+            Err(_) => Codec::Deflate,
+        };
+        Ok(Some(Self { max_bytes, policy, compress_above, codec }))
+    }
+
+    /// The limit on a payload that ABI encoding turns into an output
+    /// `overhead` bytes longer than the padded payload, e.g. the length of the
+    /// output of an empty payload. `bytes` are padded to 32-byte words, so the
+    /// payload gets the whole words left over.
+    pub fn for_encoding(&self, overhead: usize) -> Result<Self> {
+        let words = |bytes: usize| bytes / 32 * 32;
+        let max_bytes = match self.max_bytes {
+            Some(max) => Some(words(max.checked_sub(overhead).with_context(|| {
+                format!("max_output_bytes {max} is below the {overhead} bytes of encoding")
+            })?)),
+            None => None,
+        };
+        let compress_above = self.compress_above.map(|t| words(t.saturating_sub(overhead)));
+        Ok(Self { max_bytes, compress_above, ..*self })
+    }
+
+    /// Whether [`apply`](Self::apply) changes a payload of `len` bytes
+    pub fn modifies(&self, len: usize) -> bool {
+        self.compress_above.is_some_and(|threshold| len > threshold)
+            || self.max_bytes.is_some_and(|max| len > max)
+    }
+
+    /// Returns the payload unchanged if it is below the compression threshold
+    /// and fits, compresses it above the threshold, and otherwise applies the
+    /// policy
+    pub fn apply(&self, payload: Vec<u8>) -> Result<Vec<u8>> {
+        if self.compress_above.is_some_and(|threshold| payload.len() > threshold) {
+            return self.fit(payload.len(), self.codec.compress(&payload)?);
+        }
+        let Some(max_bytes) = self.max_bytes.filter(|max| payload.len() > *max) else {
+            return Ok(payload);
+        };
+
+        match self.policy {
+            OversizePolicy::Error => {
+                Err(anyhow!("output is {} bytes, limit is {}", payload.len(), max_bytes))
+            }
+            OversizePolicy::Truncate => {
+                let keep = max_bytes.checked_sub(1).context("max_output_bytes too small")?;
+                Ok(flagged(FLAG_TRUNCATED, &payload[..keep]))
+            }
+            OversizePolicy::Compress => self.fit(payload.len(), self.codec.compress(&payload)?),
+        }
+    }
+
+    /// The compressed payload, if it fits the limit
+    fn fit(&self, raw_len: usize, compressed: Vec<u8>) -> Result<Vec<u8>> {
+        match self.max_bytes {
+            Some(max_bytes) if compressed.len() > max_bytes => Err(anyhow!(
+                "output is {} bytes, {} compressed, limit is {}",
+                raw_len,
+                compressed.len(),
+                max_bytes
+            )),
+            _ => Ok(compressed),
+        }
+    }
+}
+
+fn flagged(flag: u8, body: &[u8]) -> Vec<u8> {
+    let mut out = Vec::with_capacity(body.len() + 1);
+    out.push(flag);
+    out.extend_from_slice(body);
+    out
+}
+
+/// Raw deflate (RFC 1951), decodable on-chain with libraries such as `InflateLib`
+pub fn deflate(data: &[u8]) -> Result<Vec<u8>> {
+    let mut encoder = DeflateEncoder::new(Vec::new(), Compression::best());
+    encoder.write_all(data)?;
+    Ok(encoder.finish()?)
+}
+
+/// Gzip (RFC 1952), for consumers that decode off-chain with standard tools
+pub fn gzip(data: &[u8]) -> Result<Vec<u8>> {
+    let mut encoder = GzEncoder::new(Vec::new(), Compression::best());
+    encoder.write_all(data)?;
+    Ok(encoder.finish()?)
+}
@@ -0,0 +1,121 @@
+//! Following paginated list endpoints.
+//!
+//! Supports both cursor pagination (the response carries an opaque token for
+//! the next page) and offset pagination (the next page starts after the items
+//! seen so far). Pages are fetched one after another, up to `max_pages`, and
+//! their items concatenated. The cap is set with the `max_pages` kv config.
+
+use crate::context::RunContext;
+use anyhow::{anyhow, Context, Result};
+use std::future::Future;
+
+pub const DEFAULT_MAX_PAGES: usize = 10;
+
+/// Where a page starts
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum PageRequest {
+    /// The first page of a cursor-paginated listing
+    First,
+    /// An opaque cursor returned with the previous page
+    Cursor(String),
+    /// The index of the first item, for offset pagination
+    Offset { offset: usize, limit: usize },
+}
+
+impl PageRequest {
+    /// The first page of an offset-paginated listing
+    pub fn offsets(limit: usize) -> Self {
+        PageRequest::Offset { offset: 0, limit }
+    }
+}
+
+/// One page of results and where the next one starts, if anywhere
+#[derive(Debug, Clone, PartialEq)]
+pub struct Page<T> {
+    pub items: Vec<T>,
+    pub next: Option<PageRequest>,
+}
+
+impl<T> Page<T> {
+    /// A cursor page; an empty or missing cursor ends the listing
+    pub fn with_cursor(items: Vec<T>, cursor: Option<String>) -> Self {
+        let next = cursor.filter(|c| !c.is_empty()).map(PageRequest::Cursor);
+        Self { items, next }
+    }
+
+    /// An offset page for `request`; a short page ends the listing
+    pub fn at_offset(items: Vec<T>, request: &PageRequest) -> Self {
+        let next = match *request {
+            PageRequest::Offset { offset, limit } if limit > 0 && items.len() >= limit => {
+                Some(PageRequest::Offset { offset: offset + items.len(), limit })
+            }
+            _ => None,
+        };
+        Self { items, next }
+    }
+}
+
+/// Items gathered across pages
+#[derive(Debug, Clone, PartialEq)]
+pub struct Listing<T> {
+    pub items: Vec<T>,
+    pub pages: usize,
+    /// Whether the listing ended before the page cap
+    pub complete: bool,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct Paginator {
+    pub max_pages: usize,
+}
+
+impl Default for Paginator {
+    fn default() -> Self {
+        Self { max_pages: DEFAULT_MAX_PAGES }
+    }
+}
+
+impl Paginator {
+    /// Reads `max_pages` from the service config
+    pub fn from_env() -> Result<Self> {
+        let mut paginator = Self::default();
+        if let Ok(max) = std::env::var("max_pages") {
+            paginator.max_pages = max.parse().context("invalid max_pages")?;
+            if paginator.max_pages == 0 {
+                return Err(anyhow!("max_pages must be at least 1"));
+            }
+        }
+        Ok(paginator)
+    }
+
+    /// Calls `fetch` from `first` onwards until a page has no successor or the
+    /// cap is reached, all within the run deadline
+    pub async fn collect<T, F, Fut>(
+        &self,
+        ctx: &RunContext,
+        first: PageRequest,
+        mut fetch: F,
+    ) -> Result<Listing<T>>
+    where
+        F: FnMut(PageRequest) -> Fut,
+        Fut: Future<Output = Result<Page<T>>>,
+    {
+        let mut listing = Listing { items: Vec::new(), pages: 0, complete: false };
+        let mut request = Some(first);
+        while let Some(current) = request.take() {
+            if listing.pages == self.max_pages {
+                println!("stopping after {} pages, listing is incomplete", self.max_pages);
+                return Ok(listing);
+            }
+            let page = ctx.run(fetch(current.clone())).await??;
+            listing.pages += 1;
+            listing.items.extend(page.items);
+            if page.next.as_ref() == Some(&current) {
+                return Err(anyhow!("pagination did not advance past {current:?}"));
+            }
+            request = page.next;
+        }
+        listing.complete = true;
+        Ok(listing)
+    }
+}
@@ -0,0 +1,99 @@
+//! Turns panics inside a component's `run` into ordinary error results.
+//!
+//! [`catch`] reports the panic message, its location and, where the platform
+//! can capture one, the top of the backtrace.
+//!
+//! What that buys depends on the target. `wasm32-wasip1` only supports
+//! `panic=abort`, so in deployed components `catch_unwind` never catches
+//! anything: the panic hook writes the summary to stderr, where it lands in
+//! the operator's component log, and the instance then traps. WAVS records
+//! the invocation as failed and nothing is submitted for the trigger, exactly
+//! as without the guard; only the log line is gained. Components therefore
+//! must not panic on input: untrusted data is parsed into `Result`s, and the
+//! remaining `expect`s state invariants the code has already checked.
+//!
+//! With unwinding (native builds and tests, or `-C panic=unwind`) the panic is
+//! returned as the `run` error instead, which `tests/panic_guard.rs` covers.
+
+use crate::secret::redact;
+use std::{
+    any::Any,
+    backtrace::{Backtrace, BacktraceStatus},
+    cell::RefCell,
+    panic::{self, AssertUnwindSafe},
+    sync::Once,
+};
+
+/// Number of backtrace lines kept in the summary
+const BACKTRACE_LINES: usize = 12;
+
+thread_local! {
+    static LAST_PANIC: RefCell<Option<String>> = const { RefCell::new(None) };
+}
+
+/// Runs `f`, converting a panic into an `Err` carrying the panic summary.
+/// Loaded secrets are [`redact`]ed from the error either way.
+pub fn catch<T>(f: impl FnOnce() -> Result<T, String>) -> Result<T, String> {
+    install_hook();
+    match panic::catch_unwind(AssertUnwindSafe(f)) {
+        Ok(result) => result.map_err(|e| redact(&e)),
+        Err(payload) => Err(LAST_PANIC
+            .with(|last| last.borrow_mut().take())
+            .unwrap_or_else(|| redact(&format!("panic: {}", message(&*payload))))),
+    }
+}
+
+fn install_hook() {
+    static INSTALLED: Once = Once::new();
+    INSTALLED.call_once(|| {
+        panic::set_hook(Box::new(|info| {
+            let mut summary = match info.location() {
+                Some(loc) => format!(
+                    "panic at {}:{}:{}: {}",
+                    loc.file(),
+                    loc.line(),
+                    loc.column(),
+                    message(info.payload())
+                ),
+                None => format!("panic: {}", message(info.payload())),
+            };
+            let backtrace = Backtrace::capture();
+            if backtrace.status() == BacktraceStatus::Captured {
+                for line in user_frames(&backtrace.to_string()).take(BACKTRACE_LINES) {
+                    summary.push('\n');
+                    summary.push_str(line);
+                }
+            }
+            let summary = redact(&summary);
+            eprintln!("{summary}");
+            LAST_PANIC.with(|last| *last.borrow_mut() = Some(summary));
+        }));
+    });
+}
+
+/// Skips the frames of the panic machinery itself, keeping each frame's
+/// `at file:line` continuation with its symbol line
+fn user_frames(backtrace: &str) -> impl Iterator<Item = &str> {
+    let mut keep = false;
+    backtrace.lines().filter(move |line| {
+        if let Some((index, symbol)) = line.trim_start().split_once(": ") {
+            if index.chars().all(|c| c.is_ascii_digit()) {
+                keep = !INTERNAL_PREFIXES.iter().any(|prefix| symbol.starts_with(prefix));
+            }
+        }
+        keep
+    })
+}
+
+const INTERNAL_PREFIXES: &[&str] =
+    &["std::", "core::", "<core::", "alloc::", "<alloc::", "__rust", "common::panic_guard::"];
+
+fn message(payload: &(dyn Any + Send)) -> &str {
+    if let Some(s) = payload.downcast_ref::<&str>() {
+        s
+    } else if let Some(s) = payload.downcast_ref::<String>() {
+        s
+    } else {
+        "non-string panic payload"
+    }
+}
@@ -0,0 +1,183 @@
+//! Poseidon over the BN254 scalar field, compatible with circomlib's `Poseidon(n)`.
+//!
+//! Uses the x^5 S-box with 8 full rounds and circomlib's partial round counts.
+//! Round constants and the MDS matrix are not embedded: they are derived with
+//! the Grain LFSR of the reference `generate_parameters_grain.sage` script,
+//! which is how circomlib's constants were produced, the first time a width
+//! is used.
+
+use alloy_primitives::U256;
+use anyhow::{anyhow, Result};
+use std::{cell::RefCell, collections::BTreeMap, collections::VecDeque, rc::Rc};
+
+/// BN254 scalar field modulus, the field circom circuits work in
+pub const MODULUS: U256 = U256::from_limbs([
+    0x43e1f593f0000001,
+    0x2833e84879b97091,
+    0xb85045b68181585d,
+    0x30644e72e131a029,
+]);
+
+/// Most inputs a single permutation takes, as in circomlib
+pub const MAX_INPUTS: usize = 16;
+
+/// Bytes per field element when hashing arbitrary data, small enough to stay
+/// below the modulus
+pub const BYTES_PER_ELEMENT: usize = 31;
+
+const FULL_ROUNDS: usize = 8;
+
+/// Partial rounds by state width, starting at width 2 (one input)
+const PARTIAL_ROUNDS: [usize; MAX_INPUTS] =
+    [56, 57, 56, 60, 60, 63, 64, 63, 60, 66, 60, 65, 70, 60, 64, 68];
+
+struct Params {
+    constants: Vec<U256>,
+    mds: Vec<Vec<U256>>,
+}
+
+thread_local! {
+    static PARAMS: RefCell<BTreeMap<usize, Rc<Params>>> = RefCell::new(BTreeMap::new());
+}
+
+/// `Poseidon(inputs)`; every input must be a field element
+pub fn hash(inputs: &[U256]) -> Result<U256> {
+    if inputs.is_empty() || inputs.len() > MAX_INPUTS {
+        return Err(anyhow!("Poseidon takes 1 to {MAX_INPUTS} inputs, got {}", inputs.len()));
+    }
+    if let Some(input) = inputs.iter().find(|input| **input >= MODULUS) {
+        return Err(anyhow!("Poseidon input {input} is not a BN254 field element"));
+    }
+
+    let width = inputs.len() + 1;
+    let params = params(width);
+    let partial_rounds = PARTIAL_ROUNDS[width - 2];
+    let mut state: Vec<U256> = std::iter::once(U256::ZERO).chain(inputs.iter().copied()).collect();
+    for round in 0..FULL_ROUNDS + partial_rounds {
+        for (i, x) in state.iter_mut().enumerate() {
+            *x = x.add_mod(params.constants[round * width + i], MODULUS);
+        }
+        let full = round < FULL_ROUNDS / 2 || round >= FULL_ROUNDS / 2 + partial_rounds;
+        if full {
+            state.iter_mut().for_each(|x| *x = sbox(*x));
+        } else {
+            state[0] = sbox(state[0]);
+        }
+        state = params
+            .mds
+            .iter()
+            .map(|row| {
+                row.iter()
+                    .zip(&state)
+                    .fold(U256::ZERO, |acc, (m, x)| acc.add_mod(m.mul_mod(*x, MODULUS), MODULUS))
+            })
+            .collect();
+    }
+    Ok(state[0])
+}
+
+/// Hashes arbitrary bytes: the length, then the data as big-endian 31-byte
+/// field elements, absorbed 15 at a time into a running Poseidon chain
+pub fn hash_bytes(data: &[u8]) -> U256 {
+    let elements: Vec<U256> = data.chunks(BYTES_PER_ELEMENT).map(U256::from_be_slice).collect();
+    let mut acc = U256::from(data.len());
+    for group in elements.chunks(MAX_INPUTS - 1) {
+        let inputs: Vec<U256> = std::iter::once(acc).chain(group.iter().copied()).collect();
+        acc = hash(&inputs).expect("inputs are field elements");
+    }
+    if elements.is_empty() {
+        acc = hash(&[acc]).expect("length is a field element");
+    }
+    acc
+}
+
+fn sbox(x: U256) -> U256 {
+    let x2 = x.mul_mod(x, MODULUS);
+    let x4 = x2.mul_mod(x2, MODULUS);
+    x4.mul_mod(x, MODULUS)
+}
+
+fn params(width: usize) -> Rc<Params> {
+    PARAMS.with(|cache| {
+        cache.borrow_mut().entry(width).or_insert_with(|| Rc::new(generate(width))).clone()
+    })
+}
+
+fn generate(width: usize) -> Params {
+    let partial_rounds = PARTIAL_ROUNDS[width - 2];
+    let mut grain = Grain::new(width, partial_rounds);
+
+    let constants = (0..(FULL_ROUNDS + partial_rounds) * width)
+        .map(|_| loop {
+            let c = grain.field_element();
+            if c < MODULUS {
+                break c;
+            }
+        })
+        .collect();
+
+    // Cauchy matrix 1 / (x_i + y_j)
+    let xs: Vec<U256> = (0..width).map(|_| grain.field_element().reduce_mod(MODULUS)).collect();
+    let ys: Vec<U256> = (0..width).map(|_| grain.field_element().reduce_mod(MODULUS)).collect();
+    let mds = xs
+        .iter()
+        .map(|x| {
+            ys.iter()
+                .map(|y| x.add_mod(*y, MODULUS).inv_mod(MODULUS).expect("x + y is nonzero"))
+                .collect()
+        })
+        .collect();
+
+    Params { constants, mds }
+}
+
+/// The reference parameter generator: an 80-bit LFSR seeded with the
+/// instance description, with self-shrinking output
+struct Grain {
+    bits: VecDeque<bool>,
+}
+
+impl Grain {
+    fn new(width: usize, partial_rounds: usize) -> Self {
+        let mut bits = VecDeque::with_capacity(80);
+        let mut push = |value: usize, len: u32| {
+            bits.extend((0..len).rev().map(|i| (value >> i) & 1 == 1));
+        };
+        push(1, 2); // prime field
+        push(0, 4); // x^alpha S-box
+        push(254, 12); // field size in bits
+        push(width, 12);
+        push(FULL_ROUNDS, 10);
+        push(partial_rounds, 10);
+        push((1 << 30) - 1, 30);
+
+        let mut grain = Self { bits };
+        for _ in 0..160 {
+            grain.step();
+        }
+        grain
+    }
+
+    fn step(&mut self) -> bool {
+        let b = &self.bits;
+        let bit = b[62] ^ b[51] ^ b[38] ^ b[23] ^ b[13] ^ b[0];
+        self.bits.pop_front();
+        self.bits.push_back(bit);
+        bit
+    }
+
+    /// Of each pair of bits, the second is output when the first is set
+    fn next_bit(&mut self) -> bool {
+        loop {
+            let keep = self.step();
+            let bit = self.step();
+            if keep {
+                return bit;
+            }
+        }
+    }
+
+    fn field_element(&mut self) -> U256 {
+        (0..254).fold(U256::ZERO, |acc, _| (acc << 1) | U256::from(self.next_bit() as u8))
+    }
+}
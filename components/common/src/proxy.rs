@@ -0,0 +1,101 @@
+//! Routing upstream HTTP requests through an operator egress proxy.
+//!
+//! `wasi:http` gives components no proxy setting and no `CONNECT` tunnel,
+//! so forward (HTTP `CONNECT` / SOCKS) proxies have to be configured on the
+//! WAVS host itself. What a component can do is rewrite its requests to a
+//! gateway-style proxy that fetches the target on its behalf. Set the
+//! `http_proxy` kv config to a URL template using:
+//!
+//! - `{url}`: the full target URL, percent-encoded (`https://egress/fetch?url={url}`)
+//! - `{host}` and `{path}`: target host and path with query (`https://egress/{host}{path}`)
+//!
+//! Hosts listed in the comma-separated `no_proxy` kv config (`.example.com`
+//! matches subdomains) go direct. The `WAVS_ENV_HTTP_PROXY_AUTHORIZATION`
+//! secret, if set, is sent as the `Proxy-Authorization` header.
+
+use crate::{config, http::percent_encode, secret::Secret};
+use anyhow::{anyhow, Context, Result};
+use wstd::http::{HeaderValue, Request};
+
+pub const AUTHORIZATION_ENV: &str = "WAVS_ENV_HTTP_PROXY_AUTHORIZATION";
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Proxy {
+    pub template: String,
+    pub no_proxy: Vec<String>,
+    pub authorization: Option<Secret>,
+}
+
+impl Proxy {
+    /// Reads the proxy settings, `None` when `http_proxy` is unset
+    pub fn from_env() -> Result<Option<Self>> {
+        let Some(template) = config::string("http_proxy") else {
+            return Ok(None);
+        };
+        if !["{url}", "{host}"].iter().any(|p| template.contains(p)) {
+            return Err(anyhow!("http_proxy must contain {{url}} or {{host}}"));
+        }
+        let no_proxy = config::list("no_proxy")
+            .unwrap_or_default()
+            .iter()
+            .map(|host| host.to_ascii_lowercase())
+            .collect();
+        let authorization = Secret::from_env(AUTHORIZATION_ENV);
+        Ok(Some(Self { template, no_proxy, authorization }))
+    }
+
+    fn bypass(&self, host: &str) -> bool {
+        let host = host.to_ascii_lowercase();
+        self.no_proxy.iter().any(|entry| match entry.strip_prefix('.') {
+            Some(domain) => host == domain || host.ends_with(entry.as_str()),
+            None => host == *entry,
+        })
+    }
+
+    /// Rewrites `url` to go through the proxy, or returns it unchanged for
+    /// `no_proxy` hosts
+    pub fn route(&self, url: &str) -> Result<String> {
+        let (_, rest) =
+            url.split_once("://").ok_or_else(|| anyhow!("not an absolute URL: {url}"))?;
+        let split = rest.find(['/', '?']).unwrap_or(rest.len());
+        let (authority, path) = rest.split_at(split);
+        let host = authority.rsplit('@').next().unwrap_or(authority);
+        let host_name = host.split(':').next().unwrap_or(host);
+        if self.bypass(host_name) {
+            return Ok(url.to_string());
+        }
+
+        let path = if path.is_empty() { "/" } else { path };
+        Ok(self
+            .template
+            .replace("{url}", &percent_encode(url))
+            .replace("{host}", host)
+            .replace("{path}", path))
+    }
+
+    /// Points `req` at the proxy and adds the proxy credentials
+    pub fn apply<B>(&self, req: &mut Request<B>) -> Result<()> {
+        let target = req.uri().to_string();
+        let routed = self.route(&target)?;
+        if routed == target {
+            return Ok(());
+        }
+        *req.uri_mut() = routed.parse().with_context(|| format!("invalid proxy URL {routed}"))?;
+        if let Some(authorization) = &self.authorization {
+            let value = HeaderValue::from_str(authorization.expose())
+                .with_context(|| format!("invalid {AUTHORIZATION_ENV}"))?;
+            req.headers_mut().insert("Proxy-Authorization", value);
+        }
+        Ok(())
+    }
+}
+
+/// Routes `req` through the proxy from the service config, if one is set.
+/// Call it after all other headers are set, since header rules match the
+/// original host.
+pub fn apply<B>(req: &mut Request<B>) -> Result<()> {
+    match Proxy::from_env()? {
+        Some(proxy) => proxy.apply(req),
+        None => Ok(()),
+    }
+}
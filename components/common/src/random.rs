@@ -0,0 +1,111 @@
+//! Pseudorandomness every operator derives identically for a trigger.
+//!
+//! Components that sample (e.g. pick a subset of sources) must not use host
+//! randomness, or operators would disagree on the result. The seed here is a
+//! function of the trigger alone:
+//!
+//! ```text
+//! keccak256(abi.encodePacked("wavs-seed-v1", uint64 triggerId, bytes32 blockHash, payload))
+//! ```
+//!
+//! so a contract can recompute it. The block hash is zero for CLI input.
+//!
+//! Whoever submits the trigger picks the payload and, with the block
+//! producer, can grind the seed; don't use it where a biased draw pays out.
+
+use crate::{evm, types::TriggerRequest};
+use alloy_primitives::{keccak256, B256};
+use anyhow::Result;
+
+/// Domain tag hashed ahead of the trigger fields
+pub const DOMAIN: &[u8] = b"wavs-seed-v1";
+
+/// Seed of a trigger with the given block hash
+pub fn seed(trigger_id: u64, block_hash: B256, payload: &[u8]) -> B256 {
+    let mut data = Vec::with_capacity(DOMAIN.len() + 8 + 32 + payload.len());
+    data.extend_from_slice(DOMAIN);
+    data.extend_from_slice(&trigger_id.to_be_bytes());
+    data.extend_from_slice(block_hash.as_slice());
+    data.extend_from_slice(payload);
+    keccak256(data)
+}
+
+/// Seed of `request`, reading the hash of its block from the chain's RPC
+/// endpoint
+pub async fn seed_for(request: &TriggerRequest) -> Result<B256> {
+    let block_hash = match &request.block {
+        Some(block) => evm::trigger_header(block).await?.hash,
+        None => B256::ZERO,
+    };
+    Ok(seed(request.trigger_id, block_hash, &request.data))
+}
+
+/// Generator expanding a seed in counter mode: the `i`th 32 byte block is
+/// `keccak256(seed ++ uint64 i)`, read as big-endian `u64` words
+#[derive(Debug, Clone)]
+pub struct SeededRng {
+    seed: B256,
+    counter: u64,
+    block: B256,
+    /// Next unread word of `block`, 4 when it is used up
+    word: usize,
+}
+
+impl SeededRng {
+    pub fn new(seed: B256) -> Self {
+        Self { seed, counter: 0, block: B256::ZERO, word: 4 }
+    }
+
+    pub fn next_u64(&mut self) -> u64 {
+        if self.word == 4 {
+            let mut input = [0u8; 40];
+            input[..32].copy_from_slice(self.seed.as_slice());
+            input[32..].copy_from_slice(&self.counter.to_be_bytes());
+            self.block = keccak256(input);
+            self.counter += 1;
+            self.word = 0;
+        }
+        let start = self.word * 8;
+        self.word += 1;
+        u64::from_be_bytes(self.block[start..start + 8].try_into().expect("8 bytes"))
+    }
+
+    /// Uniform in `0..n`, without modulo bias
+    ///
+    /// # Panics
+    ///
+    /// When `n` is zero.
+    pub fn below(&mut self, n: u64) -> u64 {
+        assert!(n > 0, "empty range");
+        // Largest multiple of n that fits, draws above it are rejected
+        let zone = u64::MAX - (u64::MAX % n + 1) % n;
+        loop {
+            let draw = self.next_u64();
+            if draw <= zone {
+                return draw % n;
+            }
+        }
+    }
+
+    /// Fisher-Yates shuffle in place
+    pub fn shuffle<T>(&mut self, items: &mut [T]) {
+        for i in (1..items.len()).rev() {
+            let j = self.below(i as u64 + 1) as usize;
+            items.swap(i, j);
+        }
+    }
+
+    /// Indices of `k` distinct items out of `len`, in draw order; all of
+    /// them when `k >= len`
+    pub fn sample_indices(&mut self, len: usize, k: usize) -> Vec<usize> {
+        let mut indices: Vec<usize> = (0..len).collect();
+        let k = k.min(len);
+        // Partial Fisher-Yates from the front
+        for i in 0..k {
+            let j = i + self.below((len - i) as u64) as usize;
+            indices.swap(i, j);
+        }
+        indices.truncate(k);
+        indices
+    }
+}
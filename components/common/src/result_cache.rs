@@ -0,0 +1,108 @@
+//! Persisted cache of recently processed triggers and their results.
+//!
+//! When the same trigger is delivered again (e.g. on operator retry) the
+//! cached bytes are returned instead of refetching, so a retry can neither
+//! double-submit nor produce a diverging answer. Entries are keyed by a hash
+//! of the trigger ID, the trigger data and the kv config ([`config::digest`]),
+//! so a trigger ID reused with another payload, or a redeploy with another
+//! config, computes afresh. The cache lives in the component's local data
+//! directory and is only an optimization: it is safe to delete at any time.
+
+use crate::config;
+use alloy_primitives::hex;
+use anyhow::{Context, Result};
+use sha2::{Digest, Sha256};
+use std::{collections::BTreeSet, path::PathBuf};
+
+/// Number of most recent trigger IDs kept when `result_cache_capacity` is not configured
+pub const DEFAULT_CAPACITY: u64 = 1024;
+
+/// Entries by trigger ID, so the oldest are evicted first without listing the
+/// directory
+const INDEX_FILE: &str = "index.json";
+
+pub struct ResultCache {
+    dir: PathBuf,
+    capacity: u64,
+}
+
+impl ResultCache {
+    /// Opens the cache in the `result_cache_dir` kv config, or returns `None` when it is not set
+    pub fn from_env() -> Result<Option<Self>> {
+        let Ok(dir) = std::env::var("result_cache_dir") else {
+            return Ok(None);
+        };
+        let capacity = match std::env::var("result_cache_capacity") {
+            Ok(capacity) => capacity.parse().context("invalid result_cache_capacity")?,
+            Err(_) => DEFAULT_CAPACITY,
+        };
+        Self::open(dir, capacity).map(Some)
+    }
+
+    pub fn open(dir: impl Into<PathBuf>, capacity: u64) -> Result<Self> {
+        let dir = dir.into();
+        std::fs::create_dir_all(&dir)
+            .with_context(|| format!("failed to create result cache {}", dir.display()))?;
+        Ok(Self { dir, capacity })
+    }
+
+    /// Returns the result previously stored for `trigger_id` with `data`
+    /// under the current config
+    pub fn get(&self, trigger_id: u64, data: &[u8]) -> Option<Vec<u8>> {
+        std::fs::read(self.path(&key(trigger_id, data))).ok()
+    }
+
+    /// Stores the result for `trigger_id` with `data` and evicts entries that
+    /// fell out of the window
+    pub fn put(&self, trigger_id: u64, data: &[u8], output: &[u8]) -> Result<()> {
+        let key = key(trigger_id, data);
+        // Write then rename so a crash never leaves a truncated entry behind
+        let tmp = self.dir.join(format!("{key}.tmp"));
+        std::fs::write(&tmp, output).context("failed to write result cache entry")?;
+        std::fs::rename(&tmp, self.path(&key)).context("failed to commit result cache entry")?;
+
+        let mut index = self.load_index()?;
+        index.insert((trigger_id, key));
+        let oldest =
+            index.last().map_or(0, |(newest, _)| (newest + 1).saturating_sub(self.capacity));
+        while let Some((_, key)) = index.first().filter(|(id, _)| *id < oldest).cloned() {
+            index.pop_first();
+            match std::fs::remove_file(self.path(&key)) {
+                Err(e) if e.kind() != std::io::ErrorKind::NotFound => return Err(e.into()),
+                _ => {}
+            }
+        }
+        self.save_index(&index)
+    }
+
+    fn load_index(&self) -> Result<BTreeSet<(u64, String)>> {
+        let path = self.dir.join(INDEX_FILE);
+        match std::fs::read(&path) {
+            Ok(bytes) => serde_json::from_slice(&bytes)
+                .with_context(|| format!("corrupt result cache index {}", path.display())),
+            Err(e) if e.kind() == std::io::ErrorKind::NotFound => Ok(BTreeSet::new()),
+            Err(e) => Err(e).with_context(|| format!("failed to read {}", path.display())),
+        }
+    }
+
+    fn save_index(&self, index: &BTreeSet<(u64, String)>) -> Result<()> {
+        let path = self.dir.join(INDEX_FILE);
+        let tmp = path.with_extension("tmp");
+        std::fs::write(&tmp, serde_json::to_vec(index)?)
+            .context("failed to write result cache index")?;
+        std::fs::rename(&tmp, &path).context("failed to commit result cache index")
+    }
+
+    fn path(&self, key: &str) -> PathBuf {
+        self.dir.join(format!("{key}.bin"))
+    }
+}
+
+/// Hex SHA-256 of the trigger ID, its data and the config digest
+fn key(trigger_id: u64, data: &[u8]) -> String {
+    let mut hasher = Sha256::new();
+    hasher.update(trigger_id.to_be_bytes());
+    hasher.update(data);
+    hasher.update(config::digest());
+    hex::encode(hasher.finalize())
+}
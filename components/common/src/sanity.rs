@@ -0,0 +1,81 @@
+//! Sanity checks on numbers read from provider responses.
+//!
+//! A provider glitch can hand over `NaN` or `Infinity` (both parse from
+//! strings such as `"NaN"` and `"inf"`), a negative or zero price, or one off
+//! by orders of magnitude. Such values must fail the run before they are
+//! encoded and submitted; the error starts with `SANITY_CHECK_FAILED`.
+//!
+//! Prices must lie within `sanity_min_price` and `sanity_max_price` (kv
+//! config, in the quote currency).
+
+use crate::types::ErrorCode;
+use anyhow::{anyhow, Context, Result};
+use std::fmt;
+
+/// Lowest accepted price, overridable with `sanity_min_price`
+pub const DEFAULT_MIN_PRICE: f64 = 1e-18;
+
+/// Highest accepted price, overridable with `sanity_max_price`
+pub const DEFAULT_MAX_PRICE: f64 = 1e12;
+
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct PriceBounds {
+    pub min: f64,
+    pub max: f64,
+}
+
+impl Default for PriceBounds {
+    fn default() -> Self {
+        Self { min: DEFAULT_MIN_PRICE, max: DEFAULT_MAX_PRICE }
+    }
+}
+
+impl PriceBounds {
+    /// Reads the `sanity_min_price` and `sanity_max_price` kv config
+    pub fn from_env() -> Result<Self> {
+        let bound = |key: &str, default: f64| -> Result<f64> {
+            match std::env::var(key) {
+                Ok(v) => {
+                    let v: f64 = v.parse().with_context(|| format!("invalid {key}"))?;
+                    if !v.is_finite() || v <= 0.0 {
+                        return Err(anyhow!("{key} must be a positive number"));
+                    }
+                    Ok(v)
+                }
+                Err(_) => Ok(default),
+            }
+        };
+        let bounds = Self {
+            min: bound("sanity_min_price", DEFAULT_MIN_PRICE)?,
+            max: bound("sanity_max_price", DEFAULT_MAX_PRICE)?,
+        };
+        if bounds.min > bounds.max {
+            return Err(anyhow!("sanity_min_price is above sanity_max_price"));
+        }
+        Ok(bounds)
+    }
+
+    /// `price` if it is a finite number within the bounds
+    pub fn check(&self, what: impl fmt::Display, price: f64) -> Result<f64> {
+        let price = finite(&what, price)?;
+        if price < self.min || price > self.max {
+            return Err(failed(format!(
+                "price {price} of {what} is outside {} to {}",
+                self.min, self.max
+            )));
+        }
+        Ok(price)
+    }
+}
+
+/// `value` if it is neither `NaN` nor infinite
+pub fn finite(what: impl fmt::Display, value: f64) -> Result<f64> {
+    if !value.is_finite() {
+        return Err(failed(format!("{what} is {value}")));
+    }
+    Ok(value)
+}
+
+fn failed(message: String) -> anyhow::Error {
+    anyhow!(ErrorCode::SanityCheckFailed.error(message))
+}
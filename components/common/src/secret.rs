@@ -0,0 +1,83 @@
+//! API keys and signing keys from the operator's `WAVS_ENV_*` variables.
+//!
+//! A [`Secret`] never prints its value: `Debug` shows `[redacted]` and there
+//! is no `Display`, so the value only leaves through [`Secret::expose`] at the
+//! point it is sent. Every loaded secret is also remembered for the rest of
+//! the invocation so [`redact`] can scrub it, plain or percent-encoded, from
+//! text that embedded it anyway, such as an error carrying a request URL with
+//! an `apiKey` query parameter. [`panic_guard::catch`](crate::panic_guard::catch)
+//! applies it to every `run` error, and [`Mirrors`](crate::mirrors::Mirrors)
+//! to its failover logs.
+
+use crate::http;
+use anyhow::{anyhow, Result};
+use std::{cell::RefCell, fmt};
+
+/// Replaces secret values in [`redact`]ed text
+pub const REDACTED: &str = "[redacted]";
+
+/// Values shorter than this are not scrubbed from text: they would match
+/// unrelated substrings, and are too short to be a credential anyway
+const MIN_REDACT_LEN: usize = 4;
+
+thread_local! {
+    static LOADED: RefCell<Vec<String>> = const { RefCell::new(Vec::new()) };
+}
+
+#[derive(Clone, PartialEq, Eq)]
+pub struct Secret(String);
+
+impl Secret {
+    /// Wraps a secret value and registers it for [`redact`]
+    pub fn new(value: impl Into<String>) -> Self {
+        let value = value.into();
+        if value.len() >= MIN_REDACT_LEN {
+            LOADED.with(|loaded| {
+                let mut loaded = loaded.borrow_mut();
+                if !loaded.contains(&value) {
+                    loaded.push(value.clone());
+                }
+            });
+        }
+        Self(value)
+    }
+
+    /// Reads the secret `name`, `None` when it is unset or empty
+    pub fn from_env(name: &str) -> Option<Self> {
+        std::env::var(name).ok().filter(|v| !v.trim().is_empty()).map(|v| Self::new(v.trim()))
+    }
+
+    /// Reads the secret `name`, failing with a message naming the variable
+    /// the operator has to set. Components call this before any request, so a
+    /// missing key fails the run up front instead of as a provider 401.
+    pub fn required(name: &str) -> Result<Self> {
+        Self::from_env(name)
+            .ok_or_else(|| anyhow!("{name} is not set; add it to the operator's WAVS environment"))
+    }
+
+    /// The secret value, to be passed straight to where it is used
+    pub fn expose(&self) -> &str {
+        &self.0
+    }
+}
+
+impl fmt::Debug for Secret {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "Secret({REDACTED})")
+    }
+}
+
+/// `text` with every secret loaded so far replaced by [`REDACTED`]
+pub fn redact(text: &str) -> String {
+    LOADED.with(|loaded| {
+        let mut out = text.to_string();
+        for value in loaded.borrow().iter() {
+            for form in [value.clone(), http::percent_encode(value)] {
+                if out.contains(&form) {
+                    out = out.replace(&form, REDACTED);
+                }
+            }
+        }
+        out
+    })
+}
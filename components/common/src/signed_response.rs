@@ -0,0 +1,144 @@
+//! Authenticity checks for APIs that sign their responses.
+//!
+//! Some data vendors send a signature of the response body in a header,
+//! either an HMAC-SHA256 with a shared secret or an Ed25519 signature under
+//! a published key. With `response_signature` set in the kv config, responses
+//! without a valid signature are rejected before their data is used:
+//!
+//! - `hmac-sha256`: secret in the `WAVS_ENV_RESPONSE_HMAC_KEY` env var
+//! - `ed25519`: hex public key in the `response_signing_key` kv config
+//!
+//! The header defaults to `X-Signature` (`response_signature_header`) and may
+//! hold hex (optionally `0x` or `sha256=` prefixed) or base64.
+//!
+//! [`ResponseVerifier::audit`] reports whether a signature was actually
+//! checked: a body replayed from a recording or served from the HTTP cache
+//! with `304 Not Modified` was not verified in this run.
+
+use crate::{
+    http::{self, Response},
+    secret::Secret,
+};
+use alloy_primitives::hex;
+use anyhow::{anyhow, Context, Result};
+use base64::{engine::general_purpose::STANDARD, Engine};
+use ed25519_dalek::{Signature, Verifier as _, VerifyingKey};
+use hmac::{Hmac, Mac};
+use serde::{Deserialize, Serialize};
+use sha2::Sha256;
+use std::cell::Cell;
+use wstd::http::{Body, Request};
+
+pub const DEFAULT_HEADER: &str = "X-Signature";
+pub const HMAC_KEY_ENV: &str = "WAVS_ENV_RESPONSE_HMAC_KEY";
+
+#[derive(Clone)]
+pub enum Scheme {
+    HmacSha256(Vec<u8>),
+    Ed25519(VerifyingKey),
+}
+
+#[derive(Clone)]
+pub struct ResponseVerifier {
+    pub scheme: Scheme,
+    pub header: String,
+    /// Set once a signature checks out
+    verified: Cell<bool>,
+}
+
+/// Verification result recorded in the component output for auditing
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct SignatureAudit {
+    pub scheme: String,
+    /// Ed25519 public key, hex encoded; empty for HMAC
+    pub key: String,
+    pub verified: bool,
+}
+
+impl ResponseVerifier {
+    pub fn new(scheme: Scheme, header: impl Into<String>) -> Self {
+        Self { scheme, header: header.into(), verified: Cell::new(false) }
+    }
+
+    /// Reads the verification settings, `None` when `response_signature` is unset
+    pub fn from_env() -> Result<Option<Self>> {
+        let Ok(scheme) = std::env::var("response_signature") else {
+            return Ok(None);
+        };
+        let scheme = match scheme.as_str() {
+            "hmac-sha256" => Scheme::HmacSha256(
+                Secret::required(HMAC_KEY_ENV)
+                    .context("hmac-sha256 response signatures need the shared secret")?
+                    .expose()
+                    .as_bytes()
+                    .to_vec(),
+            ),
+            "ed25519" => {
+                let key = std::env::var("response_signing_key")
+                    .context("response_signing_key is required for ed25519")?;
+                let key: [u8; 32] = hex::decode(key.trim())
+                    .ok()
+                    .and_then(|k| k.try_into().ok())
+                    .context("response_signing_key must be 32 hex-encoded bytes")?;
+                Scheme::Ed25519(VerifyingKey::from_bytes(&key)?)
+            }
+            other => return Err(anyhow!("unknown response_signature {other}")),
+        };
+        let header =
+            std::env::var("response_signature_header").unwrap_or_else(|_| DEFAULT_HEADER.into());
+        Ok(Some(Self::new(scheme, header)))
+    }
+
+    /// Checks `signature` (the header value) against `body`
+    pub fn verify(&self, body: &[u8], signature: &str) -> Result<()> {
+        let signature = decode_signature(signature)?;
+        match &self.scheme {
+            Scheme::HmacSha256(secret) => {
+                let mut mac = Hmac::<Sha256>::new_from_slice(secret)?;
+                mac.update(body);
+                mac.verify_slice(&signature).map_err(|_| anyhow!("invalid HMAC signature"))?;
+            }
+            Scheme::Ed25519(key) => {
+                let signature = Signature::from_slice(&signature)?;
+                key.verify(body, &signature).map_err(|_| anyhow!("invalid Ed25519 signature"))?;
+            }
+        }
+        self.verified.set(true);
+        Ok(())
+    }
+
+    /// The scheme and key, and whether a response has passed [`verify`](Self::verify)
+    pub fn audit(&self) -> SignatureAudit {
+        let (scheme, key) = match &self.scheme {
+            Scheme::HmacSha256(_) => ("hmac-sha256", String::new()),
+            Scheme::Ed25519(key) => ("ed25519", hex::encode(key.as_bytes())),
+        };
+        SignatureAudit { scheme: scheme.to_string(), key, verified: self.verified.get() }
+    }
+
+    /// Checks a response's signature header against its body
+    pub fn verify_response(&self, response: &Response) -> Result<()> {
+        let signature = response
+            .header(&self.header)
+            .ok_or_else(|| anyhow!("response has no {} header", self.header))?;
+        self.verify(&response.body, signature)
+    }
+
+    /// Sends `req` and returns the body once its signature header checks out
+    pub async fn fetch<B: Body>(&self, req: Request<B>) -> Result<Vec<u8>> {
+        let response = http::send(req).await?;
+        if response.status == 200 {
+            self.verify_response(&response)?;
+        }
+        response.into_ok_body()
+    }
+}
+
+fn decode_signature(signature: &str) -> Result<Vec<u8>> {
+    let signature = signature.trim();
+    let signature = signature.strip_prefix("sha256=").unwrap_or(signature);
+    if let Ok(bytes) = hex::decode(signature) {
+        return Ok(bytes);
+    }
+    STANDARD.decode(signature).context("signature is neither hex nor base64")
+}
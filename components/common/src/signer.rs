@@ -0,0 +1,138 @@
+//! Per-operator secp256k1 signatures over component results.
+//!
+//! When `WAVS_ENV_SIGNING_KEY` holds a hex private key, results are wrapped in
+//! the `SignedResult` struct of `ITypes.sol`: the original payload, the
+//! operator address and its signature. The signed hash binds the payload to
+//! its trigger and to the chain and submit contract it is meant for, so a
+//! signature cannot be replayed on another chain or deployment that reuses
+//! the trigger ID:
+//!
+//! ```text
+//! resultHash = keccak256(abi.encodePacked(
+//!     uint256 chainId, address verifyingContract, uint64 triggerId, bytes data))
+//! signature  = sign(toEthSignedMessageHash(resultHash))
+//! ```
+//!
+//! so contracts verify with OpenZeppelin's `ECDSA.recover` and
+//! `MessageHashUtils.toEthSignedMessageHash`, hashing `block.chainid` and
+//! `address(this)`. The chain and contract come from the kv config, see
+//! [`SigningDomain::from_env`].
+//!
+//! Operators attesting through a BLS aggregation layer set
+//! `WAVS_ENV_BLS_SECRET_KEY` instead, and results are wrapped in a
+//! `BlsSignedResult` signing the same hash, see [`bls`](crate::bls).
+
+use crate::{address_book::AddressBook, bls, config, crypto::keccak256, secret::Secret};
+use alloy_primitives::{eip191_hash_message, hex, Address, Bytes, B256, U256};
+use alloy_sol_types::SolValue;
+use anyhow::{anyhow, Context, Result};
+use k256::ecdsa::SigningKey;
+
+pub const SIGNING_KEY_ENV: &str = "WAVS_ENV_SIGNING_KEY";
+
+/// Chain and submit contract a signed result is valid for
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct SigningDomain {
+    pub chain_id: u64,
+    pub verifying_contract: Address,
+}
+
+impl SigningDomain {
+    /// Reads `signing_chain_id` and `signing_contract`, or the address book
+    /// entry named by `signing_network`; one of them is required once a
+    /// signing key is set
+    pub fn from_env() -> Result<Self> {
+        if let Some(verifying_contract) = config::parse::<Address>("signing_contract")? {
+            let chain_id = config::required::<u64>("signing_chain_id")?;
+            return Ok(Self { chain_id, verifying_contract });
+        }
+        if let Some(network) = config::string("signing_network") {
+            let book = AddressBook::from_env()?;
+            let entry = book.require(&network)?;
+            return Ok(Self { chain_id: entry.chain_id, verifying_contract: entry.submit_address });
+        }
+        Err(anyhow!("signing needs signing_contract and signing_chain_id, or signing_network"))
+    }
+}
+
+pub struct ResultSigner {
+    key: SigningKey,
+}
+
+impl ResultSigner {
+    pub fn from_bytes(bytes: &[u8; 32]) -> Result<Self> {
+        let key = SigningKey::from_bytes(bytes.into())
+            .map_err(|_| anyhow!("signing key is not a valid secp256k1 scalar"))?;
+        Ok(Self { key })
+    }
+
+    /// Reads the operator key, `None` when signing is not configured
+    pub fn from_env() -> Result<Option<Self>> {
+        let Some(key) = Secret::from_env(SIGNING_KEY_ENV) else {
+            return Ok(None);
+        };
+        let bytes: [u8; 32] = hex::decode(key.expose())
+            .ok()
+            .and_then(|k| k.try_into().ok())
+            .with_context(|| format!("{SIGNING_KEY_ENV} must be 32 hex-encoded bytes"))?;
+        Self::from_bytes(&bytes).map(Some)
+    }
+
+    /// The operator address contracts recover from the signature
+    pub fn address(&self) -> Address {
+        let point = self.key.verifying_key().to_encoded_point(false);
+        Address::from_slice(&keccak256(&point.as_bytes()[1..])[12..])
+    }
+
+    /// 65-byte `r ‖ s ‖ v` signature of the EIP-191 message hash of `hash`
+    pub fn sign_hash(&self, hash: B256) -> Result<[u8; 65]> {
+        let digest = eip191_hash_message(hash);
+        let (signature, recovery_id) = self
+            .key
+            .sign_prehash_recoverable(digest.as_slice())
+            .map_err(|e| anyhow!("signing failed: {e}"))?;
+        let mut out = [0u8; 65];
+        out[..64].copy_from_slice(&signature.to_bytes());
+        out[64] = 27 + recovery_id.to_byte();
+        Ok(out)
+    }
+
+    /// ABI-encoded `SignedResult(data, signer, signature)` for `payload`
+    pub fn sign_result(
+        &self,
+        domain: &SigningDomain,
+        trigger_id: u64,
+        payload: Vec<u8>,
+    ) -> Result<Vec<u8>> {
+        let signature = self.sign_hash(result_hash(domain, trigger_id, &payload))?;
+        Ok((Bytes::from(payload), self.address(), Bytes::from(signature.to_vec())).abi_encode())
+    }
+}
+
+/// `keccak256(abi.encodePacked(chainId, verifyingContract, triggerId, data))`, see the module docs
+pub fn result_hash(domain: &SigningDomain, trigger_id: u64, payload: &[u8]) -> B256 {
+    keccak256(
+        [
+            &U256::from(domain.chain_id).to_be_bytes::<32>()[..],
+            domain.verifying_contract.as_slice(),
+            &trigger_id.to_be_bytes()[..],
+            payload,
+        ]
+        .concat(),
+    )
+}
+
+/// Wraps `payload` in a `SignedResult`, or a `BlsSignedResult`, when a
+/// signing key is configured
+pub fn sign_if_configured(trigger_id: u64, payload: Vec<u8>) -> Result<Vec<u8>> {
+    match (ResultSigner::from_env()?, bls::SecretKey::from_env()?) {
+        (Some(_), Some(_)) => {
+            Err(anyhow!("set only one of {SIGNING_KEY_ENV} and {}", bls::SECRET_KEY_ENV))
+        }
+        (Some(signer), None) => {
+            signer.sign_result(&SigningDomain::from_env()?, trigger_id, payload)
+        }
+        (None, Some(key)) => Ok(key.sign_result(&SigningDomain::from_env()?, trigger_id, payload)),
+        (None, None) => Ok(payload),
+    }
+}
@@ -0,0 +1,90 @@
+//! Trigger decoding and result encoding every component shares.
+//!
+//! A component's `trigger.rs` only converts its wit-bindgen `TriggerData`
+//! into an [`EthEvent`] or raw CLI bytes, because those types are generated
+//! per component; what happens to them is decided here.
+
+use crate::{
+    allowlist,
+    batch::BATCH_TRIGGER_ID,
+    cli_input::{self, InputEncoding, OutputFormat},
+    trigger_event,
+    types::{Destination, ErrorCode, TriggerBlock, TriggerRequest},
+};
+use alloy_primitives::Bytes;
+use alloy_sol_types::SolValue;
+use anyhow::{anyhow, Result};
+
+/// A contract event trigger, borrowed from the host's `TriggerDataEthContractEvent`
+#[derive(Debug, Clone)]
+pub struct EthEvent<'a> {
+    /// Address of the emitting contract
+    pub contract_address: &'a [u8],
+    pub topics: &'a [Vec<u8>],
+    pub data: &'a [u8],
+    pub chain_name: String,
+    pub block_height: u64,
+    /// RPC endpoint of the chain, when the operator configured one
+    pub http_endpoint: Option<String>,
+}
+
+/// Decodes a contract event after checking its emitter and creator against
+/// the allowlists
+pub fn decode_eth_event(event: EthEvent) -> Result<TriggerRequest> {
+    allowlist::check_emitter(event.contract_address)?;
+    // The configured `trigger_event`, else every layout trigger contracts emit
+    let trigger = trigger_event::decode_log(event.topics, event.data)?;
+    println!("trigger {} ({} layout)", trigger.trigger_id, trigger.format);
+    allowlist::check_creator(trigger.creator)?;
+    check_trigger_id(trigger.trigger_id)?;
+
+    Ok(TriggerRequest {
+        trigger_id: trigger.trigger_id,
+        data: trigger.data,
+        destination: Destination::Ethereum,
+        block: Some(TriggerBlock {
+            chain_name: event.chain_name,
+            height: event.block_height,
+            http_endpoint: event.http_endpoint,
+        }),
+    })
+}
+
+/// Decodes CLI input, rejecting structured requests for a command not in
+/// `commands`
+pub fn decode_raw(data: &[u8], commands: &[&str]) -> Result<TriggerRequest> {
+    let input = cli_input::parse(data)?;
+    input.check_command(commands).map_err(|e| anyhow!(ErrorCode::InvalidRequest.error(e)))?;
+    if input.encoding != InputEncoding::Text {
+        println!("input decoded as {:?}", input.encoding);
+    }
+    check_trigger_id(input.trigger_id)?;
+
+    let destination = match input.format {
+        OutputFormat::Json => Destination::CliOutput,
+        // Exercises the on-chain encoding without a chain trigger
+        OutputFormat::Abi => Destination::Ethereum,
+    };
+    Ok(TriggerRequest { trigger_id: input.trigger_id, data: input.data, destination, block: None })
+}
+
+/// Refuses the trigger ID reserved for batches: `SimpleSubmit` would decode
+/// a single result submitted under it as a `TriggerBatch`
+pub fn check_trigger_id(trigger_id: u64) -> Result<()> {
+    if trigger_id == BATCH_TRIGGER_ID {
+        return Err(anyhow!(ErrorCode::InvalidRequest
+            .error(format!("trigger ID {trigger_id} is reserved for batched submissions"))));
+    }
+    Ok(())
+}
+
+/// Error for trigger kinds no component handles
+pub fn unsupported() -> anyhow::Error {
+    anyhow!(ErrorCode::UnsupportedTrigger.error("unsupported trigger data type"))
+}
+
+/// ABI encodes `output` as the `DataWithId` struct of `ITypes.sol`, which
+/// the service handler decodes
+pub fn encode_output(trigger_id: u64, output: impl AsRef<[u8]>) -> Vec<u8> {
+    (trigger_id, Bytes::copy_from_slice(output.as_ref())).abi_encode()
+}
@@ -0,0 +1,166 @@
+//! Decoding of every `NewTrigger` layout trigger contracts have emitted.
+//!
+//! The `SimpleTrigger` versions emit `NewTrigger(bytes)`; what changed is the
+//! payload:
+//!
+//! - [`TriggerFormat::TriggerInfo`]: `abi.encode(TriggerInfo(triggerId, creator, data))`,
+//!   the current `SimpleTrigger`.
+//! - [`TriggerFormat::DataWithId`]: `abi.encode(DataWithId(triggerId, data))`,
+//!   from trigger contracts deployed before the creator was recorded.
+//!
+//! Contracts that want their triggers filterable by ID or creator emit
+//! [`TriggerFormat::Indexed`] instead,
+//! `NewTrigger(uint64 indexed triggerId, address indexed creator, bytes data)`,
+//! whose key fields are read from the log topics.
+//!
+//! The layouts are told apart by their ABI heads rather than by trial and
+//! error: the payload starts with the offset of the struct, and the word after
+//! the trigger ID is the creator address for `TriggerInfo` but the offset of
+//! `data` (`0x40`) for `DataWithId`. Both are then strictly decoded, so a
+//! payload matching neither is rejected instead of being misread.
+
+use crate::crypto::keccak256;
+use alloy_primitives::{hex, Address, Bytes, B256, U256};
+use alloy_sol_types::SolValue;
+use anyhow::{anyhow, Context, Result};
+
+pub const NEW_TRIGGER_SIGNATURE: &str = "NewTrigger(bytes)";
+
+/// Event of [`TriggerFormat::Indexed`] trigger contracts
+pub const INDEXED_TRIGGER_SIGNATURE: &str = "NewTrigger(uint64,address,bytes)";
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum TriggerFormat {
+    TriggerInfo,
+    DataWithId,
+    Indexed,
+    /// The `trigger_event` of [`trigger_event`](crate::trigger_event)
+    Configured,
+}
+
+/// The two ABI layouts of a `NewTrigger(bytes)` payload, told apart by
+/// [`detect`]
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum PayloadLayout {
+    TriggerInfo,
+    DataWithId,
+}
+
+impl From<PayloadLayout> for TriggerFormat {
+    fn from(layout: PayloadLayout) -> Self {
+        match layout {
+            PayloadLayout::TriggerInfo => Self::TriggerInfo,
+            PayloadLayout::DataWithId => Self::DataWithId,
+        }
+    }
+}
+
+impl std::fmt::Display for TriggerFormat {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::TriggerInfo => f.write_str("TriggerInfo"),
+            Self::DataWithId => f.write_str("DataWithId"),
+            Self::Indexed => f.write_str("Indexed"),
+            Self::Configured => f.write_str("configured event"),
+        }
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct DecodedTrigger {
+    pub format: TriggerFormat,
+    pub trigger_id: u64,
+    /// Not recorded by [`TriggerFormat::DataWithId`] contracts
+    pub creator: Option<Address>,
+    pub data: Vec<u8>,
+}
+
+/// Decodes a `NewTrigger` log from its raw topics and data
+pub fn decode_log(topics: &[Vec<u8>], data: &[u8]) -> Result<DecodedTrigger> {
+    let topic0 = topics.first().context("trigger log has no topics")?;
+    if topic0.as_slice() == keccak256(INDEXED_TRIGGER_SIGNATURE).as_slice() {
+        return decode_indexed(topics, data);
+    }
+    if topic0.as_slice() != keccak256(NEW_TRIGGER_SIGNATURE).as_slice() {
+        return Err(anyhow!("unsupported trigger event 0x{}", hex::encode(topic0)));
+    }
+    let (payload,) =
+        <(Bytes,)>::abi_decode_params(data, true).context("invalid NewTrigger event data")?;
+    decode_payload(&payload)
+}
+
+/// Decodes an [`INDEXED_TRIGGER_SIGNATURE`] log: the trigger ID and creator
+/// are topics, only `data` is in the log data
+fn decode_indexed(topics: &[Vec<u8>], data: &[u8]) -> Result<DecodedTrigger> {
+    let [_, trigger_id, creator] = topics else {
+        return Err(anyhow!("indexed NewTrigger has {} topics, expected 3", topics.len()));
+    };
+    let (data,) =
+        <(Bytes,)>::abi_decode_params(data, true).context("invalid NewTrigger event data")?;
+    Ok(DecodedTrigger {
+        format: TriggerFormat::Indexed,
+        trigger_id: topic_u64(trigger_id).context("triggerId topic")?,
+        creator: Some(topic_address(creator).context("creator topic")?),
+        data: data.to_vec(),
+    })
+}
+
+/// Value of an indexed `uint64` parameter
+pub fn topic_u64(topic: &[u8]) -> Result<u64> {
+    let word = topic_word(topic)?;
+    u64::try_from(U256::from_be_bytes::<32>(word.0))
+        .map_err(|_| anyhow!("topic {word} does not hold a uint64"))
+}
+
+/// Value of an indexed `address` parameter
+pub fn topic_address(topic: &[u8]) -> Result<Address> {
+    let word = topic_word(topic)?;
+    if word[..12].iter().any(|&b| b != 0) {
+        return Err(anyhow!("topic {word} does not hold an address"));
+    }
+    Ok(Address::from_word(word))
+}
+
+fn topic_word(topic: &[u8]) -> Result<B256> {
+    B256::try_from(topic).map_err(|_| anyhow!("topic is {} bytes, expected 32", topic.len()))
+}
+
+/// Detects the layout of a `NewTrigger` payload and decodes it
+pub fn decode_payload(payload: &[u8]) -> Result<DecodedTrigger> {
+    let layout = detect(payload)?;
+    let format = layout.into();
+    match layout {
+        PayloadLayout::TriggerInfo => {
+            let (trigger_id, creator, data) = <(u64, Address, Bytes)>::abi_decode(payload, true)
+                .context("invalid TriggerInfo payload")?;
+            Ok(DecodedTrigger { format, trigger_id, creator: Some(creator), data: data.to_vec() })
+        }
+        PayloadLayout::DataWithId => {
+            let (trigger_id, data) =
+                <(u64, Bytes)>::abi_decode(payload, true).context("invalid DataWithId payload")?;
+            Ok(DecodedTrigger { format, trigger_id, creator: None, data: data.to_vec() })
+        }
+    }
+}
+
+/// Reads the layout from the ABI head: `[0x20][triggerId][creator | 0x40]...`
+pub fn detect(payload: &[u8]) -> Result<PayloadLayout> {
+    let word = |i: usize| -> Result<U256> {
+        let bytes = payload
+            .get(i * 32..(i + 1) * 32)
+            .ok_or_else(|| anyhow!("trigger payload too short ({} bytes)", payload.len()))?;
+        Ok(U256::from_be_bytes::<32>(B256::from_slice(bytes).0))
+    };
+    if word(0)? != U256::from(0x20) {
+        return Err(anyhow!("trigger payload does not start with a struct offset"));
+    }
+    // TriggerInfo's creator could only be 0x40 for the precompile at that
+    // address, which never creates triggers
+    if word(2)? == U256::from(0x40) {
+        Ok(PayloadLayout::DataWithId)
+    } else if word(3)? == U256::from(0x60) {
+        Ok(PayloadLayout::TriggerInfo)
+    } else {
+        Err(anyhow!("unrecognized trigger payload layout"))
+    }
+}
@@ -0,0 +1,376 @@
+//! Trigger events of contracts other than `SimpleTrigger`.
+//!
+//! The `trigger_event` kv config describes the event in Solidity syntax and
+//! names the parameters that carry the trigger fields:
+//!
+//! ```text
+//! event OrderPlaced(uint64 indexed triggerId, address indexed creator, string data, uint256 amount)
+//! event Ping(uint64 triggerId, bytes data) anonymous
+//! ```
+//!
+//! - `triggerId`: unsigned integer of at most 64 bits, required;
+//! - `data`: `bytes` or `string`, the component input, required;
+//! - `creator`: `address`, optional.
+//!
+//! Other parameters are decoded, so malformed logs are still rejected, and
+//! then ignored. Parameter names don't change topic0, which hashes the types
+//! only, so they can be renamed to these roles freely. An anonymous event has
+//! no topic0 and is recognized by its topic count alone.
+//!
+//! The event can also be given as its JSON ABI, inline in `trigger_event_abi`
+//! or as a file in `trigger_event_abi_file`: either the event's entry or a
+//! whole contract ABI, from which the event named `trigger_event_name` (or
+//! the only event) is taken. The ABI's parameter names play the same roles.
+//! So a component is pointed at another trigger contract by config alone.
+//! The event is parsed on the first trigger and kept for the lifetime of the
+//! component instance.
+//!
+//! Without any of these the `SimpleTrigger` layouts of [`trigger_compat`] are
+//! decoded.
+
+use crate::{
+    abi::{self, AbiType},
+    crypto::keccak256,
+    trigger_compat::{self, DecodedTrigger, TriggerFormat},
+};
+use alloy_primitives::{hex, Address, B256};
+use anyhow::{anyhow, Context, Result};
+use serde::Deserialize;
+use serde_json::Value;
+use std::{cell::OnceCell, rc::Rc};
+
+thread_local! {
+    static CONFIGURED: OnceCell<Option<Rc<EventDescriptor>>> = const { OnceCell::new() };
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct EventParam {
+    pub name: String,
+    pub ty: AbiType,
+    pub indexed: bool,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct EventDescriptor {
+    pub name: String,
+    pub params: Vec<EventParam>,
+    pub anonymous: bool,
+}
+
+/// Decodes a trigger log as the configured `trigger_event`, or as one of the
+/// `SimpleTrigger` layouts when none is configured
+pub fn decode_log(topics: &[Vec<u8>], data: &[u8]) -> Result<DecodedTrigger> {
+    match configured()? {
+        Some(event) => event.decode_log(topics, data),
+        None => trigger_compat::decode_log(topics, data),
+    }
+}
+
+/// The configured event, parsed on first use
+fn configured() -> Result<Option<Rc<EventDescriptor>>> {
+    if let Some(event) = CONFIGURED.with(|cell| cell.get().cloned()) {
+        return Ok(event);
+    }
+    let event = EventDescriptor::from_env()?.map(Rc::new);
+    CONFIGURED.with(|cell| cell.get_or_init(|| event.clone()));
+    Ok(event)
+}
+
+impl EventDescriptor {
+    /// Reads the `trigger_event`, `trigger_event_abi` or
+    /// `trigger_event_abi_file` kv config
+    pub fn from_env() -> Result<Option<Self>> {
+        let abi = match std::env::var("trigger_event_abi") {
+            Ok(json) => Some(json),
+            Err(_) => match std::env::var("trigger_event_abi_file") {
+                Ok(path) => Some(
+                    std::fs::read_to_string(&path)
+                        .with_context(|| format!("failed to read trigger event ABI {path}"))?,
+                ),
+                Err(_) => None,
+            },
+        };
+        match (std::env::var("trigger_event"), abi) {
+            (Ok(_), Some(_)) => {
+                Err(anyhow!("set either trigger_event or a trigger event ABI, not both"))
+            }
+            (Ok(event), None) => Self::parse(&event).context("invalid trigger_event").map(Some),
+            (Err(_), Some(json)) => {
+                let name = std::env::var("trigger_event_name").ok();
+                Self::from_abi_json(&json, name.as_deref())
+                    .context("invalid trigger event ABI")
+                    .map(Some)
+            }
+            (Err(_), None) => Ok(None),
+        }
+    }
+
+    /// Builds the event from its JSON ABI entry, or from the event `name` in
+    /// a contract ABI (which may be left out when there is only one)
+    pub fn from_abi_json(json: &str, name: Option<&str>) -> Result<Self> {
+        let entries = match serde_json::from_str(json)? {
+            Value::Array(entries) => entries,
+            entry => vec![entry],
+        };
+        let events: Vec<AbiEvent> = entries
+            .into_iter()
+            .filter(|entry| entry["type"] == "event")
+            .map(serde_json::from_value)
+            .collect::<Result<_, _>>()?;
+        let mut matching = events.into_iter().filter(|e| name.map_or(true, |name| e.name == name));
+        let event = match (matching.next(), matching.next()) {
+            (Some(event), None) => event,
+            (None, _) => return Err(anyhow!("no event {} in the ABI", name.unwrap_or_default())),
+            (Some(_), Some(_)) => {
+                return Err(anyhow!("the ABI has several events, set trigger_event_name"))
+            }
+        };
+
+        let params = event
+            .inputs
+            .iter()
+            .map(|input| {
+                Ok(EventParam {
+                    name: input.name.clone(),
+                    ty: input.abi_type()?,
+                    indexed: input.indexed,
+                })
+            })
+            .collect::<Result<Vec<_>>>()?;
+        let event = Self { name: event.name, params, anonymous: event.anonymous };
+        event.validate()?;
+        Ok(event)
+    }
+
+    /// Parses `[event] Name(type [indexed] [name], ...) [anonymous][;]`
+    pub fn parse(s: &str) -> Result<Self> {
+        let s = s.trim().trim_end_matches(';').trim_end();
+        let s = s.strip_prefix("event ").unwrap_or(s).trim_start();
+        let (name, rest) = s.split_once('(').ok_or_else(|| anyhow!("missing ( in {s:?}"))?;
+        let close = rest.rfind(')').ok_or_else(|| anyhow!("missing ) in {s:?}"))?;
+        let anonymous = match rest[close + 1..].trim() {
+            "" => false,
+            "anonymous" => true,
+            other => return Err(anyhow!("unexpected {other:?} after the parameters")),
+        };
+        let params = split_params(&rest[..close])
+            .into_iter()
+            .map(parse_param)
+            .collect::<Result<Vec<_>>>()?;
+        let event = Self { name: name.trim().to_string(), params, anonymous };
+        event.validate()?;
+        Ok(event)
+    }
+
+    /// Checks the name, the topic count and the trigger field parameters
+    pub fn validate(&self) -> Result<()> {
+        if self.name.is_empty() || !self.name.chars().all(|c| c.is_alphanumeric() || c == '_') {
+            return Err(anyhow!("invalid event name {:?}", self.name));
+        }
+        let max_indexed = if self.anonymous { 4 } else { 3 };
+        if self.params.iter().filter(|p| p.indexed).count() > max_indexed {
+            return Err(anyhow!("{} has more than {max_indexed} indexed parameters", self.name));
+        }
+
+        let trigger_id =
+            self.param("triggerId").ok_or_else(|| anyhow!("no triggerId parameter"))?;
+        if !matches!(trigger_id.ty, AbiType::Uint(bits) if bits <= 64) {
+            return Err(anyhow!("triggerId is {}, expected uint64 or smaller", trigger_id.ty));
+        }
+        let data = self.param("data").ok_or_else(|| anyhow!("no data parameter"))?;
+        if !matches!(data.ty, AbiType::Bytes | AbiType::String) || data.indexed {
+            return Err(anyhow!("data must be non-indexed bytes or string"));
+        }
+        if let Some(creator) = self.param("creator") {
+            if creator.ty != AbiType::Address {
+                return Err(anyhow!("creator is {}, expected address", creator.ty));
+            }
+        }
+        Ok(())
+    }
+
+    fn param(&self, name: &str) -> Option<&EventParam> {
+        self.params.iter().find(|p| p.name == name)
+    }
+
+    /// Canonical signature, e.g. `NewTrigger(uint64,address,bytes)`
+    pub fn signature(&self) -> String {
+        let types: Vec<String> = self.params.iter().map(|p| p.ty.to_string()).collect();
+        format!("{}({})", self.name, types.join(","))
+    }
+
+    /// Hash of the signature, `None` for anonymous events
+    pub fn topic0(&self) -> Option<B256> {
+        (!self.anonymous).then(|| keccak256(self.signature()))
+    }
+
+    pub fn decode_log(&self, topics: &[Vec<u8>], data: &[u8]) -> Result<DecodedTrigger> {
+        let topics = match self.topic0() {
+            Some(topic0) => {
+                let (first, rest) = topics.split_first().context("trigger log has no topics")?;
+                if first.as_slice() != topic0.as_slice() {
+                    return Err(anyhow!(
+                        "log is not {}: topic0 is 0x{}",
+                        self.signature(),
+                        hex::encode(first)
+                    ));
+                }
+                rest
+            }
+            None => topics,
+        };
+        let indexed: Vec<&EventParam> = self.params.iter().filter(|p| p.indexed).collect();
+        if topics.len() != indexed.len() {
+            return Err(anyhow!(
+                "{} has {} indexed parameters, the log {} topics",
+                self.name,
+                indexed.len(),
+                topics.len()
+            ));
+        }
+
+        let non_indexed: Vec<AbiType> =
+            self.params.iter().filter(|p| !p.indexed).map(|p| p.ty.clone()).collect();
+        let values = abi::decode(&AbiType::Tuple(non_indexed), data)
+            .with_context(|| format!("invalid {} event data", self.name))?;
+        let mut values = values.as_array().cloned().unwrap_or_default().into_iter();
+        let mut topics = topics.iter();
+
+        let (mut trigger_id, mut creator, mut payload) = (None, None, None);
+        for param in &self.params {
+            let value = if param.indexed {
+                decode_topic(param, topics.next().expect("counted above"))?
+            } else {
+                values.next().expect("decoded per parameter")
+            };
+            match param.name.as_str() {
+                "triggerId" => trigger_id = value.as_str().and_then(|v| v.parse().ok()),
+                "creator" => creator = value.as_str().and_then(|v| v.parse::<Address>().ok()),
+                "data" => payload = Some(field_bytes(&param.ty, &value)?),
+                _ => {}
+            }
+        }
+        Ok(DecodedTrigger {
+            format: TriggerFormat::Configured,
+            trigger_id: trigger_id.context("missing triggerId")?,
+            creator,
+            data: payload.context("missing data")?,
+        })
+    }
+}
+
+/// Event entry of a JSON ABI
+#[derive(Debug, Deserialize)]
+struct AbiEvent {
+    name: String,
+    #[serde(default)]
+    inputs: Vec<AbiInput>,
+    #[serde(default)]
+    anonymous: bool,
+}
+
+#[derive(Debug, Deserialize)]
+struct AbiInput {
+    #[serde(default)]
+    name: String,
+    #[serde(rename = "type")]
+    ty: String,
+    #[serde(default)]
+    indexed: bool,
+    /// Members of `tuple` types
+    #[serde(default)]
+    components: Vec<AbiInput>,
+}
+
+impl AbiInput {
+    /// Type of the input; a `tuple` (or `tuple[]`, ...) is spelled out from
+    /// its components
+    fn abi_type(&self) -> Result<AbiType> {
+        match self.ty.strip_prefix("tuple") {
+            Some(suffix) => {
+                let components = self
+                    .components
+                    .iter()
+                    .map(|c| Ok(c.abi_type()?.to_string()))
+                    .collect::<Result<Vec<_>>>()?;
+                AbiType::parse(&format!("({}){suffix}", components.join(",")))
+            }
+            None => AbiType::parse(&self.ty),
+        }
+        .with_context(|| format!("input {:?}", self.name))
+    }
+}
+
+/// Value of an indexed parameter; reference types are only present as their
+/// hash, returned as hex
+fn decode_topic(param: &EventParam, topic: &[u8]) -> Result<Value> {
+    if topic.len() != 32 {
+        return Err(anyhow!("topic of {} is {} bytes, expected 32", param.name, topic.len()));
+    }
+    match param.ty {
+        AbiType::Uint(_)
+        | AbiType::Int(_)
+        | AbiType::Address
+        | AbiType::Bool
+        | AbiType::FixedBytes(_) => {
+            abi::decode(&param.ty, topic).with_context(|| format!("{} topic", param.name))
+        }
+        _ => Ok(Value::String(hex::encode_prefixed(topic))),
+    }
+}
+
+/// Bytes of a decoded `bytes` (hex) or `string` value
+fn field_bytes(ty: &AbiType, value: &Value) -> Result<Vec<u8>> {
+    let s = value.as_str().context("data is not a string")?;
+    match ty {
+        AbiType::Bytes => Ok(hex::decode(s)?),
+        _ => Ok(s.as_bytes().to_vec()),
+    }
+}
+
+/// Splits on the commas outside of tuple parentheses
+fn split_params(s: &str) -> Vec<&str> {
+    if s.trim().is_empty() {
+        return Vec::new();
+    }
+    let (mut params, mut depth, mut start) = (Vec::new(), 0, 0);
+    for (i, c) in s.char_indices() {
+        match c {
+            '(' => depth += 1,
+            ')' => depth -= 1,
+            ',' if depth == 0 => {
+                params.push(&s[start..i]);
+                start = i + 1;
+            }
+            _ => {}
+        }
+    }
+    params.push(&s[start..]);
+    params
+}
+
+/// Parses `type [indexed] [name]`
+fn parse_param(s: &str) -> Result<EventParam> {
+    let mut words: Vec<&str> = s.split_whitespace().collect();
+    // A trailing identifier after the type is the name; `(uint256, bool)`
+    // ends in `bool)`, which is not
+    let is_name = |w: &str| {
+        w != "indexed"
+            && w.starts_with(|c: char| c.is_alphabetic() || c == '_')
+            && w.chars().all(|c| c.is_alphanumeric() || c == '_')
+    };
+    let name = match words.as_slice() {
+        [_, .., last] if is_name(last) => {
+            let name = last.to_string();
+            words.pop();
+            name
+        }
+        _ => String::new(),
+    };
+    let indexed = words.last() == Some(&"indexed");
+    if indexed {
+        words.pop();
+    }
+    let ty = AbiType::parse(&words.join(" ")).with_context(|| format!("parameter {s:?}"))?;
+    Ok(EventParam { name, ty, indexed })
+}
@@ -0,0 +1,140 @@
+//! Types every component shares, kept here so the per-component copies
+//! can't drift apart.
+//!
+//! - [`TriggerRequest`], [`TriggerBlock`] and [`Destination`] are what a
+//!   component's `trigger.rs` decodes a trigger into;
+//! - [`ErrorCode`] prefixes error results with a stable, machine-readable
+//!   code;
+//! - [`PriceFeedData`] is one asset price as read from a price API.
+
+use crate::{envelope::Format, signed_response::SignatureAudit};
+use serde::{Deserialize, Serialize};
+use std::fmt;
+
+/// Where a trigger's result is delivered
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Destination {
+    /// Signed and submitted on-chain through the service handler
+    Ethereum,
+    /// Printed by the CLI
+    CliOutput,
+}
+
+impl Destination {
+    /// Payload format the destination expects
+    pub fn format(self) -> Format {
+        match self {
+            Self::Ethereum => Format::Abi,
+            Self::CliOutput => Format::Json,
+        }
+    }
+
+    /// Whether the result is submitted on-chain, so operators must agree on it
+    pub fn is_onchain(self) -> bool {
+        self == Self::Ethereum
+    }
+
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Ethereum => "ethereum",
+            Self::CliOutput => "cli",
+        }
+    }
+}
+
+impl fmt::Display for Destination {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(self.as_str())
+    }
+}
+
+/// A decoded trigger: the request bytes and where the result goes
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct TriggerRequest {
+    /// From the chain trigger or structured CLI request, 0 otherwise
+    pub trigger_id: u64,
+    pub data: Vec<u8>,
+    pub destination: Destination,
+    /// Block of the chain trigger, `None` for CLI input
+    pub block: Option<TriggerBlock>,
+}
+
+/// The block a chain trigger was emitted in
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct TriggerBlock {
+    /// Chain name from `wavs.toml`
+    pub chain_name: String,
+    pub height: u64,
+    /// RPC endpoint of the chain, when the operator configured one
+    pub http_endpoint: Option<String>,
+}
+
+/// Stable codes at the start of error results, e.g.
+/// `INVALID_REQUEST: unknown command foo`
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ErrorCode {
+    /// The trigger input or configuration can't be used
+    InvalidRequest,
+    /// The trigger is not of a kind the component handles
+    UnsupportedTrigger,
+    /// Every upstream source failed
+    SourceUnavailable,
+    /// The upstream data is older than the component accepts
+    StaleData,
+    /// An upstream number is not finite or out of its plausible range
+    SanityCheckFailed,
+    /// The trigger came from a contract other than `trigger_contract`, or a
+    /// creator not on the `creator_allowlist`
+    Unauthorized,
+}
+
+impl ErrorCode {
+    const ALL: [Self; 6] = [
+        Self::InvalidRequest,
+        Self::UnsupportedTrigger,
+        Self::SourceUnavailable,
+        Self::StaleData,
+        Self::SanityCheckFailed,
+        Self::Unauthorized,
+    ];
+
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::InvalidRequest => "INVALID_REQUEST",
+            Self::UnsupportedTrigger => "UNSUPPORTED_TRIGGER",
+            Self::SourceUnavailable => "SOURCE_UNAVAILABLE",
+            Self::StaleData => "STALE_DATA",
+            Self::SanityCheckFailed => "SANITY_CHECK_FAILED",
+            Self::Unauthorized => "UNAUTHORIZED",
+        }
+    }
+
+    /// `message` prefixed with the code
+    pub fn error(self, message: impl fmt::Display) -> String {
+        format!("{}: {message}", self.as_str())
+    }
+
+    /// Code an error result starts with, `None` for uncoded errors
+    pub fn of(error: &str) -> Option<Self> {
+        let (code, _) = error.split_once(':')?;
+        Self::ALL.into_iter().find(|c| c.as_str() == code)
+    }
+}
+
+impl fmt::Display for ErrorCode {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(self.as_str())
+    }
+}
+
+/// One asset price as read from a price API
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct PriceFeedData {
+    pub symbol: String,
+    /// As the API reported it
+    pub timestamp: String,
+    pub price: f64,
+    /// Set when the response signature was checked
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub signature: Option<SignatureAudit>,
+}
@@ -0,0 +1,190 @@
+//! Update decisions: deviation thresholds with a hysteresis band, and a
+//! cooldown between submissions.
+//!
+//! Consumers that only need a fresh value when it has moved set
+//! `update_threshold_bps`, and a chain-triggered run then submits only when
+//! the price is that far from the last submitted one. `update_threshold_up_bps`
+//! and `update_threshold_down_bps` override the threshold per direction.
+//!
+//! A price hovering at the boundary would still flip-flop: up past the
+//! threshold, back down past it, and so on, paying for a submission each
+//! time. `update_min_hold_secs` holds a submission for that long before one
+//! in the opposite direction is made; moves that continue the last one are
+//! not held.
+//!
+//! `update_cooldown_secs` caps the rate outright: no feed is submitted again
+//! within that many seconds of its last submission, however many triggers
+//! arrive and whatever the price did, so trigger spam cannot run up gas.
+//!
+//! The last submission of each feed lives in `update_state_dir`. The state is
+//! the operator's own, so an operator that missed runs can decide
+//! differently from the others; each run's decision is logged.
+
+use crate::config;
+use anyhow::{anyhow, Context, Result};
+use serde::{Deserialize, Serialize};
+use std::path::PathBuf;
+
+/// Thresholds and cooldown, see the module docs
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct UpdatePolicy {
+    /// `None` submits whenever the cooldown allows
+    pub thresholds: Option<Thresholds>,
+    pub cooldown_secs: u64,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct Thresholds {
+    pub up_bps: u32,
+    pub down_bps: u32,
+    pub min_hold_secs: u64,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Direction {
+    Up,
+    Down,
+}
+
+/// The last value submitted for a feed
+#[derive(Debug, Clone, Copy, PartialEq, Serialize, Deserialize)]
+pub struct Submission {
+    /// `None` for results without a single price, which thresholds skip
+    pub price: Option<f64>,
+    /// Unix seconds, at the run's clock
+    pub at: u64,
+    /// Move that triggered it, `None` unless a threshold was crossed
+    pub direction: Option<Direction>,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub enum Decision {
+    /// Nothing submitted for the feed yet
+    First,
+    /// Submitted too recently
+    Cooling { remaining_secs: u64 },
+    /// No threshold applies and the cooldown is over
+    Due,
+    /// The price crossed the threshold in `direction`
+    Moved { direction: Direction, deviation_bps: f64 },
+    /// Within the thresholds
+    Within { deviation_bps: f64 },
+    /// Crossed the threshold against the last move before the hold ended
+    Held { direction: Direction, remaining_secs: u64 },
+}
+
+impl Decision {
+    pub fn submit(&self) -> bool {
+        matches!(self, Self::First | Self::Due | Self::Moved { .. })
+    }
+}
+
+impl UpdatePolicy {
+    /// The policy of the `update_*` kv config, `None` when neither a
+    /// threshold nor a cooldown is set
+    pub fn from_env() -> Result<Option<Self>> {
+        let both: Option<u32> = config::parse("update_threshold_bps")?;
+        let up = config::parse("update_threshold_up_bps")?.or(both);
+        let down = config::parse("update_threshold_down_bps")?.or(both);
+        let thresholds = match (up, down) {
+            (None, None) => None,
+            (Some(up_bps), Some(down_bps)) => {
+                if up_bps == 0 || down_bps == 0 || down_bps >= 10_000 {
+                    return Err(anyhow!("update thresholds must be between 1 and 9999 bps"));
+                }
+                let min_hold_secs = config::parse_or("update_min_hold_secs", 0)?;
+                Some(Thresholds { up_bps, down_bps, min_hold_secs })
+            }
+            _ => {
+                return Err(anyhow!(
+                    "set update_threshold_bps, or both update_threshold_up_bps and update_threshold_down_bps"
+                ))
+            }
+        };
+        let cooldown_secs = config::parse_or("update_cooldown_secs", 0)?;
+        if thresholds.is_none() && cooldown_secs == 0 {
+            return Ok(None);
+        }
+        Ok(Some(Self { thresholds, cooldown_secs }))
+    }
+
+    /// Whether `price` at `now` warrants a submission after `last`
+    pub fn decide(&self, last: Option<&Submission>, price: Option<f64>, now: u64) -> Decision {
+        let Some(last) = last else {
+            return Decision::First;
+        };
+        let cooled_at = last.at.saturating_add(self.cooldown_secs);
+        if now < cooled_at {
+            return Decision::Cooling { remaining_secs: cooled_at - now };
+        }
+        let (Some(thresholds), Some(price), Some(last_price)) =
+            (self.thresholds, price, last.price)
+        else {
+            return Decision::Due;
+        };
+        let deviation_bps = (price - last_price) / last_price * 10_000.0;
+        let direction = if deviation_bps >= thresholds.up_bps as f64 {
+            Direction::Up
+        } else if -deviation_bps >= thresholds.down_bps as f64 {
+            Direction::Down
+        } else {
+            return Decision::Within { deviation_bps };
+        };
+        let held_until = last.at.saturating_add(thresholds.min_hold_secs);
+        if last.direction.is_some_and(|last| last != direction) && now < held_until {
+            return Decision::Held { direction, remaining_secs: held_until - now };
+        }
+        Decision::Moved { direction, deviation_bps }
+    }
+}
+
+/// Last submissions per feed, one JSON file each
+pub struct SubmissionStore {
+    dir: PathBuf,
+}
+
+impl SubmissionStore {
+    /// Opens the store in the `update_state_dir` kv config
+    pub fn from_env() -> Result<Self> {
+        let dir: String = config::required("update_state_dir")?;
+        Self::open(dir)
+    }
+
+    pub fn open(dir: impl Into<PathBuf>) -> Result<Self> {
+        let dir = dir.into();
+        std::fs::create_dir_all(&dir)
+            .with_context(|| format!("failed to create update state {}", dir.display()))?;
+        Ok(Self { dir })
+    }
+
+    pub fn last(&self, feed_id: &str) -> Result<Option<Submission>> {
+        let path = self.path(feed_id);
+        match std::fs::read(&path) {
+            Ok(bytes) => serde_json::from_slice(&bytes)
+                .map(Some)
+                .with_context(|| format!("corrupt update state {}", path.display())),
+            Err(e) if e.kind() == std::io::ErrorKind::NotFound => Ok(None),
+            Err(e) => Err(e).with_context(|| format!("failed to read {}", path.display())),
+        }
+    }
+
+    pub fn put(&self, feed_id: &str, submission: &Submission) -> Result<()> {
+        // Write then rename so a crash never leaves a truncated file behind
+        let path = self.path(feed_id);
+        let tmp = path.with_extension("tmp");
+        std::fs::write(&tmp, serde_json::to_vec(submission)?)
+            .with_context(|| format!("failed to write {}", tmp.display()))?;
+        std::fs::rename(&tmp, &path).with_context(|| format!("failed to commit {}", path.display()))
+    }
+
+    /// Feed IDs such as `price:1` become file names with `_` for anything
+    /// but letters, digits and `-`
+    fn path(&self, feed_id: &str) -> PathBuf {
+        let name: String = feed_id
+            .chars()
+            .map(|c| if c.is_ascii_alphanumeric() || c == '-' { c } else { '_' })
+            .collect();
+        self.dir.join(format!("{name}.json"))
+    }
+}
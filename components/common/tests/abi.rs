@@ -0,0 +1,169 @@
+//! The runtime encoder must produce the same bytes as the `sol!` types, and
+//! the decoder read them back.
+
+use alloy_primitives::{Address, FixedBytes, I256, U256};
+use alloy_sol_types::SolValue;
+use common::abi::{decode, encode, AbiType, MAX_DECODED_VALUES, MAX_DECODE_DEPTH};
+use serde_json::json;
+
+fn encode_as(descriptor: &str, value: serde_json::Value) -> Vec<u8> {
+    encode(&AbiType::parse(descriptor).unwrap(), &value).unwrap()
+}
+
+#[test]
+fn descriptors_parse_to_canonical_types() {
+    for (descriptor, canonical) in [
+        ("(uint256,string,uint64)", "(uint256,string,uint64)"),
+        ("( uint , int8[2][] , (bytes,bool) )", "(uint256,int8[2][],(bytes,bool))"),
+        ("address[]", "address[]"),
+        ("()", "()"),
+    ] {
+        assert_eq!(AbiType::parse(descriptor).unwrap().to_string(), canonical);
+    }
+    for invalid in ["uint7", "uint264", "bytes33", "bytes0", "(uint256", "uint256]", "float", ""] {
+        assert!(AbiType::parse(invalid).is_err(), "{invalid}");
+    }
+}
+
+#[test]
+fn flat_tuple_matches_sol_types() {
+    let expected =
+        (U256::from(9723451823404u64), "BTC".to_string(), 1739355693u64).abi_encode_params();
+    assert_eq!(
+        encode_as("(uint256,string,uint64)", json!(["9723451823404", "BTC", 1739355693])),
+        expected
+    );
+}
+
+#[test]
+fn nested_dynamic_types_match_sol_types() {
+    let address: Address = "0x7FA9385bE102ac3EAc297483Dd6233D62b3e1496".parse().unwrap();
+    let expected = (
+        vec!["ETH".to_string(), "BTC".to_string()],
+        [vec![1u64, 2], vec![]],
+        (address, true, vec![0xabu8, 0xcd].into_iter().collect::<alloy_primitives::Bytes>()),
+        FixedBytes::<4>::from([1, 2, 3, 4]),
+        I256::try_from(-5).unwrap(),
+    )
+        .abi_encode_params();
+    let value = json!([
+        ["ETH", "BTC"],
+        [[1, 2], []],
+        [address.to_string(), true, "0xabcd"],
+        "0x01020304",
+        -5
+    ]);
+    assert_eq!(
+        encode_as("(string[],uint64[][2],(address,bool,bytes),bytes4,int256)", value),
+        expected
+    );
+}
+
+#[test]
+fn single_type_is_the_only_component() {
+    assert_eq!(encode_as("string", json!("hi")), ("hi".to_string(),).abi_encode_params());
+    assert_eq!(encode_as("uint8", json!(7)), (7u8,).abi_encode_params());
+}
+
+#[test]
+fn values_must_fit_their_type() {
+    let fails =
+        |descriptor: &str, value| encode(&AbiType::parse(descriptor).unwrap(), &value).is_err();
+    assert!(fails("uint8", json!(256)));
+    assert!(!fails("uint8", json!(255)));
+    assert!(fails("int8", json!(128)));
+    assert!(fails("int8", json!("-129")));
+    assert!(!fails("int8", json!(-128)));
+    assert!(fails("uint256", json!(-1)));
+    assert!(fails("uint256", json!(1.5)));
+    assert!(fails("bytes4", json!("0x010203")));
+    assert!(fails("(uint256,string)", json!([1])));
+    assert!(fails("uint64[2]", json!([1, 2, 3])));
+    assert!(fails("address", json!("0x1234")));
+}
+
+#[test]
+fn decode_inverts_encode() {
+    let descriptor = "(string[],uint64[][2],(address,bool,bytes),bytes4,int256,uint256)";
+    let value = json!([
+        ["ETH", "BTC"],
+        [["1", "2"], []],
+        ["0x7FA9385bE102ac3EAc297483Dd6233D62b3e1496", true, "0xabcd"],
+        "0x01020304",
+        "-5",
+        "115792089237316195423570985008687907853269984665640564039457584007913129639935"
+    ]);
+    let ty = AbiType::parse(descriptor).unwrap();
+    assert_eq!(decode(&ty, &encode(&ty, &value).unwrap()).unwrap(), value);
+}
+
+#[test]
+fn decode_reads_sol_types_output() {
+    let data = (7u8, "hi".to_string(), vec![U256::from(1), U256::from(2)]).abi_encode_params();
+    let ty = AbiType::parse("(uint8,string,uint256[])").unwrap();
+    assert_eq!(decode(&ty, &data).unwrap(), json!(["7", "hi", ["1", "2"]]));
+}
+
+#[test]
+fn decode_rejects_malformed_data() {
+    let ty = |descriptor: &str| AbiType::parse(descriptor).unwrap();
+    let valid = encode(&ty("(string,uint8)"), &json!(["hi", 7])).unwrap();
+
+    // Truncated
+    assert!(decode(&ty("(string,uint8)"), &valid[..valid.len() - 32]).is_err());
+    // Offset past the end
+    let mut bad_offset = valid.clone();
+    bad_offset[31] = 0xff;
+    assert!(decode(&ty("(string,uint8)"), &bad_offset).is_err());
+    // Value beyond uint8
+    let mut dirty = valid.clone();
+    dirty[62] = 1;
+    assert!(decode(&ty("(string,uint8)"), &dirty).is_err());
+    // Huge array length
+    let mut huge = U256::from(1u64 << 40).to_be_bytes::<32>().to_vec();
+    huge.splice(0..0, U256::from(32).to_be_bytes::<32>());
+    assert!(decode(&ty("uint256[]"), &huge).is_err());
+    // Not a boolean
+    assert!(decode(&ty("bool"), &U256::from(2).to_be_bytes::<32>()).is_err());
+}
+
+/// ABI words of `values`
+fn words(values: &[usize]) -> Vec<u8> {
+    values.iter().flat_map(|n| U256::from(*n).to_be_bytes::<32>()).collect()
+}
+
+/// `uint256[][]` whose `outer` items all point at the same `inner` array
+fn aliased(outer: usize, inner: usize) -> Vec<u8> {
+    let offsets = vec![outer * 32; outer];
+    let items: Vec<usize> = (0..inner).collect();
+    [words(&[32, outer]), words(&offsets), words(&[inner]), words(&items)].concat()
+}
+
+#[test]
+fn decode_bounds_its_work() {
+    let ty = |descriptor: &str| AbiType::parse(descriptor).unwrap();
+    let err =
+        |descriptor: &str, data: &[u8]| format!("{:#}", decode(&ty(descriptor), data).unwrap_err());
+
+    // Aliased offsets decode while the values fit the cap
+    assert_eq!(
+        decode(&ty("uint256[][]"), &aliased(2, 2)).unwrap(),
+        json!([["0", "1"], ["0", "1"]])
+    );
+    // ... and fail once they claim more, from 20 KB of data
+    let data = aliased(300, 300);
+    assert!(300 * 300 > MAX_DECODED_VALUES);
+    assert!(err("uint256[][]", &data).contains(&format!("more than {MAX_DECODED_VALUES} values")));
+
+    // An array length beyond the words that follow it
+    let short = words(&[32, 2, 1]);
+    assert!(err("uint256[]", &short).contains("array length 2 out of range"));
+    // Items without a head are bounded by the cap alone
+    let empty = words(&[32, u32::MAX as usize]);
+    assert!(err("()[]", &empty).contains("values"));
+
+    let nested = format!("uint8{}", "[1]".repeat(MAX_DECODE_DEPTH + 1));
+    assert!(err(&nested, &[0; 32]).contains(&format!("nested deeper than {MAX_DECODE_DEPTH}")));
+    let nested = format!("uint8{}", "[1]".repeat(MAX_DECODE_DEPTH));
+    assert!(decode(&ty(&nested), &[0; 32]).is_ok());
+}
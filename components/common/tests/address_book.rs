@@ -0,0 +1,41 @@
+//! Address book entries are found by network name or chain ID, with the
+//! documented defaults.
+
+use alloy_primitives::address;
+use common::address_book::AddressBook;
+
+const BOOK: &str = r#"{
+    "local": {
+        "chain_id": 31337,
+        "submit_address": "0x5FbDB2315678afecb367f032d93F642f64180aa3",
+        "provider_endpoints": ["http://localhost:8545"],
+        "decimals": 18
+    },
+    "mainnet": {
+        "chain_id": 1,
+        "submit_address": "0x0000000000000000000000000000000000000001"
+    }
+}"#;
+
+#[test]
+fn networks_resolve_by_name_or_chain_id() {
+    let book = AddressBook::from_json(BOOK).unwrap();
+    let local = book.get("local").unwrap();
+    assert_eq!(local.submit_address, address!("5FbDB2315678afecb367f032d93F642f64180aa3"));
+    assert_eq!(local.decimals, 18);
+    assert_eq!(book.get("31337"), Some(local));
+
+    let mainnet = book.require("1").unwrap();
+    assert_eq!(mainnet.decimals, 8);
+    assert!(mainnet.provider_endpoints.is_empty());
+
+    assert!(book.require("sepolia").is_err());
+    assert!(book.get("11155111").is_none());
+}
+
+#[test]
+fn malformed_entries_are_rejected() {
+    assert!(AddressBook::from_json(r#"{"local": {"chain_id": 1}}"#).is_err());
+    assert!(AddressBook::from_json(r#"{"local": {"chain_id": 1, "submit_address": "0x1234"}}"#)
+        .is_err());
+}
@@ -0,0 +1,89 @@
+//! With the counting allocator installed, a profile counts the allocations
+//! of its own run, and the stats reach the CLI output but never the on-chain
+//! result.
+//!
+//! The counters are shared by every test thread, so tests that start a
+//! profile take turns, and counts are checked as lower bounds.
+
+use common::{
+    alloc_stats::{self, AllocStats, CountingAlloc, Profile},
+    envelope::{self, ComponentInfo, Format},
+    output,
+    types::Destination,
+};
+use serde_json::Value;
+use std::sync::{Mutex, MutexGuard};
+
+#[global_allocator]
+static ALLOC: CountingAlloc = CountingAlloc;
+
+const COMPONENT: ComponentInfo = ComponentInfo { name: "test-component", version: "0.1.0" };
+
+const BUFFER: usize = 64 * 1024;
+
+static PROFILING: Mutex<()> = Mutex::new(());
+
+/// Keeps other tests from restarting the counters
+fn exclusive() -> MutexGuard<'static, ()> {
+    PROFILING.lock().unwrap_or_else(|e| e.into_inner())
+}
+
+#[test]
+fn profile_counts_its_own_run() {
+    let _exclusive = exclusive();
+    let _profile = Profile::start();
+    let before = alloc_stats::current().unwrap();
+
+    let buffer = vec![1u8; BUFFER];
+    let held = alloc_stats::current().unwrap();
+    assert!(held.allocations > before.allocations);
+    assert!(held.allocated_bytes >= before.allocated_bytes + BUFFER);
+    assert!(held.retained_bytes >= BUFFER as isize);
+    assert!(held.peak_bytes >= held.live_bytes);
+
+    drop(buffer);
+    let freed = alloc_stats::current().unwrap();
+    // The peak outlives the buffer
+    assert!(freed.peak_bytes >= held.peak_bytes);
+    assert!(freed.live_bytes < freed.peak_bytes);
+
+    // A new run counts from zero, its peak starting at the live heap
+    let _profile = Profile::start();
+    let next = alloc_stats::current().unwrap();
+    assert!(next.allocated_bytes < BUFFER);
+    assert!(next.peak_bytes < freed.peak_bytes);
+}
+
+#[test]
+fn stats_display_as_log_fields() {
+    let stats = AllocStats {
+        allocations: 3,
+        allocated_bytes: 96,
+        peak_bytes: 64,
+        live_bytes: 32,
+        retained_bytes: -8,
+    };
+    assert_eq!(
+        stats.to_string(),
+        "allocations=3 allocated_bytes=96 peak_bytes=64 live_bytes=32 retained_bytes=-8"
+    );
+}
+
+#[test]
+fn cli_output_carries_the_stats() {
+    let _exclusive = exclusive();
+    let _profile = Profile::start();
+    let sealed =
+        envelope::seal(COMPONENT, "price:1", 0, br#"{"price":"1.5"}"#.to_vec(), Format::Json)
+            .unwrap();
+    let output = output::with_run_stats(Destination::CliOutput, sealed).unwrap();
+
+    let json: Value = serde_json::from_slice(&output).unwrap();
+    assert!(json["alloc_stats"]["allocations"].as_u64().unwrap() > 0);
+    assert_eq!(json["payload"]["price"], "1.5");
+    // Off unless `report_compute_cost` is set
+    assert!(json.get("compute_cost").is_none());
+
+    let output = output::with_run_stats(Destination::Ethereum, vec![0xab; 64]).unwrap();
+    assert_eq!(output, vec![0xab; 64]);
+}
@@ -0,0 +1,74 @@
+//! Chain triggers are served only for listed creators and trigger
+//! contracts, and refused with `UNAUTHORIZED` before any upstream request
+//! otherwise.
+
+use alloy_primitives::{address, Address};
+use common::{
+    allowlist::{self, TriggerContracts},
+    types::ErrorCode,
+};
+
+const ALLOWED: Address = address!("1111111111111111111111111111111111111111");
+const OTHER: Address = address!("2222222222222222222222222222222222222222");
+
+/// Every test runs with the same lists: `ALLOWED` and one more address, as
+/// creators and as trigger contracts
+fn configured() {
+    let listed = format!("{ALLOWED}, 0x3333333333333333333333333333333333333333");
+    std::env::set_var("creator_allowlist", &listed);
+    std::env::set_var("trigger_contract", &listed);
+}
+
+fn code(result: anyhow::Result<()>) -> Option<ErrorCode> {
+    ErrorCode::of(&result.unwrap_err().to_string())
+}
+
+#[test]
+fn listed_creators_are_served() {
+    configured();
+    assert!(allowlist::check_creator(Some(ALLOWED)).is_ok());
+}
+
+#[test]
+fn other_creators_are_refused() {
+    configured();
+    let result = allowlist::check_creator(Some(OTHER));
+    assert_eq!(
+        result.as_ref().unwrap_err().to_string(),
+        format!("UNAUTHORIZED: creator {OTHER} not allowed")
+    );
+    assert_eq!(code(result), Some(ErrorCode::Unauthorized));
+}
+
+#[test]
+fn triggers_without_a_creator_are_refused() {
+    configured();
+    assert_eq!(code(allowlist::check_creator(None)), Some(ErrorCode::Unauthorized));
+}
+
+#[test]
+fn listed_contracts_are_served() {
+    configured();
+    assert!(allowlist::check_emitter(ALLOWED.as_slice()).is_ok());
+}
+
+#[test]
+fn other_contracts_are_refused() {
+    configured();
+    let result = allowlist::check_emitter(OTHER.as_slice());
+    assert_eq!(
+        result.as_ref().unwrap_err().to_string(),
+        format!("UNAUTHORIZED: event emitted by {OTHER}, not the configured trigger_contract")
+    );
+    assert_eq!(code(result), Some(ErrorCode::Unauthorized));
+    // Not an address at all
+    assert!(allowlist::check_emitter(&[0x11; 19]).is_err());
+}
+
+#[test]
+fn empty_contract_list_is_an_error() {
+    assert_eq!(
+        TriggerContracts::new(Vec::new()).unwrap_err().to_string(),
+        "trigger_contract is empty"
+    );
+}
@@ -0,0 +1,36 @@
+//! Arweave transaction IDs are validated before any gateway is contacted.
+
+use common::arweave;
+
+#[test]
+fn transaction_ids_are_43_base64url_characters() {
+    arweave::validate_tx_id("bNbA3TEQVL60xlgCcqdz4ZPHFZ711cZ3hmkpGttDt_U").unwrap();
+
+    for invalid in [
+        "",
+        // Too short
+        "bNbA3TEQVL60xlgCcqdz4ZPHFZ711cZ3hmkpGttDt_",
+        // Padded
+        "bNbA3TEQVL60xlgCcqdz4ZPHFZ711cZ3hmkpGttDt_U=",
+        // Standard base64 alphabet
+        "bNbA3TEQVL60xlgCcqdz4ZPHFZ711cZ3hmkpGttDt/U",
+        // Path traversal
+        "../../../../../../../../../../../../../../a",
+    ] {
+        assert!(arweave::validate_tx_id(invalid).is_err(), "{invalid}");
+    }
+}
+
+#[test]
+fn gateways_are_trimmed() {
+    std::env::set_var("arweave_gateways", "https://a.example/, ,https://b.example ");
+    assert_eq!(arweave::gateways_from_env(), ["https://a.example", "https://b.example"]);
+}
+
+#[test]
+fn max_bytes_must_be_a_number() {
+    std::env::set_var("arweave_max_bytes", "2048");
+    assert_eq!(arweave::max_bytes_from_env().unwrap(), 2048);
+    std::env::set_var("arweave_max_bytes", "2 KiB");
+    assert!(arweave::max_bytes_from_env().is_err());
+}
@@ -0,0 +1,48 @@
+//! Batches must decode as the `TriggerBatch` struct of `ITypes.sol`.
+
+use alloy_primitives::Bytes;
+use alloy_sol_macro::sol;
+use alloy_sol_types::SolValue;
+use common::batch::{decode, encode, Batcher, BATCH_TRIGGER_ID};
+
+sol! {
+    struct TriggerBatch {
+        uint64[] triggerIds;
+        bytes[] results;
+    }
+}
+
+#[test]
+fn batches_match_the_sol_struct() {
+    let results = vec![Bytes::from_static(b"one"), Bytes::from_static(&[0u8; 40])];
+    let encoded = encode(vec![3, 7], results.clone());
+    let batch = TriggerBatch::abi_decode(&encoded, true).unwrap();
+    assert_eq!(batch.triggerIds, vec![3, 7]);
+    assert_eq!(batch.results, results);
+    assert_eq!(decode(&encoded).unwrap(), (vec![3, 7], results));
+}
+
+#[test]
+fn mismatched_lengths_are_rejected() {
+    let encoded = TriggerBatch { triggerIds: vec![1, 2], results: vec![Bytes::new()] }.abi_encode();
+    assert!(decode(&encoded).is_err());
+}
+
+#[test]
+fn full_batches_go_out_under_the_batch_trigger_id() {
+    let dir = std::env::temp_dir().join(format!("batch-test-{}", std::process::id()));
+    let batcher = Batcher::open(&dir, 2, 60).unwrap();
+    let output = |id: u64, data: &'static [u8]| (id, Bytes::from_static(data)).abi_encode();
+
+    assert_eq!(batcher.push(7, &output(7, b"seven"), 100).unwrap(), None);
+    let sent = batcher.push(3, &output(3, b"three"), 110).unwrap().expect("batch is full");
+    let (trigger_id, data) = <(u64, Bytes)>::abi_decode(&sent, true).unwrap();
+    assert_eq!(trigger_id, BATCH_TRIGGER_ID);
+    assert_eq!(
+        decode(&data).unwrap(),
+        (vec![3, 7], vec![Bytes::from_static(b"three"), Bytes::from_static(b"seven")])
+    );
+    // Nothing is left over for the next batch
+    assert_eq!(batcher.push(9, &output(9, b"nine"), 120).unwrap(), None);
+    std::fs::remove_dir_all(dir).unwrap();
+}
@@ -0,0 +1,58 @@
+use alloy_primitives::{address, Bytes};
+use alloy_sol_types::SolValue;
+use common::{
+    bls::{self, SecretKey},
+    signer::SigningDomain,
+};
+
+fn key(seed: u8) -> SecretKey {
+    let mut bytes = [0u8; 32];
+    bytes[31] = seed;
+    SecretKey::from_bytes(&bytes).unwrap()
+}
+
+#[test]
+fn sign_and_aggregate() {
+    let keys = [key(1), key(2), key(3)];
+    let public_keys: Vec<_> = keys.iter().map(SecretKey::public_key).collect();
+    let message = b"price:1:8500000000000";
+
+    let signatures: Vec<_> = keys.iter().map(|k| k.sign(message)).collect();
+    assert!(bls::verify(&public_keys[0], message, &signatures[0]).unwrap());
+    assert!(!bls::verify(&public_keys[1], message, &signatures[0]).unwrap());
+
+    let aggregate = bls::aggregate(&signatures).unwrap();
+    assert!(bls::fast_aggregate_verify(&public_keys, message, &aggregate).unwrap());
+    assert!(!bls::fast_aggregate_verify(&public_keys[..2], message, &aggregate).unwrap());
+}
+
+#[test]
+fn proof_of_possession() {
+    let (a, b) = (key(1), key(2));
+    assert!(bls::verify_possession(&a.public_key(), &a.prove_possession()).unwrap());
+    assert!(!bls::verify_possession(&b.public_key(), &a.prove_possession()).unwrap());
+}
+
+#[test]
+fn zero_key_is_rejected() {
+    assert!(SecretKey::from_bytes(&[0u8; 32]).is_err());
+}
+
+#[test]
+fn signed_result_verifies_against_the_result_hash() {
+    let key = key(1);
+    let domain = SigningDomain {
+        chain_id: 31337,
+        verifying_contract: address!("5FbDB2315678afecb367f032d93F642f64180aa3"),
+    };
+    let encoded = key.sign_result(&domain, 7, b"result".to_vec());
+    let (data, public_key, signature) =
+        <(Bytes, Bytes, Bytes)>::abi_decode(&encoded, true).unwrap();
+    assert_eq!(data.as_ref(), b"result");
+
+    let public_key: bls::PublicKey = public_key.as_ref().try_into().unwrap();
+    let signature: bls::Signature = signature.as_ref().try_into().unwrap();
+    assert_eq!(public_key, key.public_key());
+    let hash = common::signer::result_hash(&domain, 7, b"result");
+    assert!(bls::verify(&public_key, hash.as_slice(), &signature).unwrap());
+}
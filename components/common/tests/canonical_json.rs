@@ -0,0 +1,49 @@
+//! Canonical JSON is byte-identical regardless of field order or float formatting.
+
+use common::canonical_json;
+use serde::Serialize;
+use serde_json::json;
+use std::collections::HashMap;
+
+#[test]
+fn keys_are_sorted_without_whitespace() {
+    #[derive(Serialize)]
+    struct Price {
+        symbol: &'static str,
+        price: f64,
+        #[serde(rename = "Decimals")]
+        decimals: u8,
+    }
+
+    let price = Price { symbol: "ETH", price: 2500.25, decimals: 8 };
+    assert_eq!(
+        canonical_json::to_string(&price).unwrap(),
+        r#"{"Decimals":8,"price":2500.25,"symbol":"ETH"}"#
+    );
+
+    let nested: HashMap<&str, _> =
+        [("é", json!([{"b": 1, "a": null}])), ("z", json!(true)), ("a", json!("x y"))].into();
+    assert_eq!(
+        canonical_json::to_string(&nested).unwrap(),
+        r#"{"a":"x y","z":true,"é":[{"a":null,"b":1}]}"#
+    );
+}
+
+#[test]
+fn integral_floats_are_written_as_integers() {
+    assert_eq!(canonical_json::to_string(&1.0).unwrap(), "1");
+    assert_eq!(canonical_json::to_string(&-42.0).unwrap(), "-42");
+    assert_eq!(canonical_json::to_string(&-0.0).unwrap(), "0");
+    assert_eq!(canonical_json::to_string(&0.1).unwrap(), "0.1");
+    assert_eq!(canonical_json::to_string(&(0.1 + 0.2)).unwrap(), "0.30000000000000004");
+    assert_eq!(canonical_json::to_string(&u64::MAX).unwrap(), "18446744073709551615");
+}
+
+#[test]
+fn bytes_match_to_string() {
+    let value = json!({"b": [1.5, "\u{1f600}\n"], "a": {}});
+    let bytes = canonical_json::to_vec(&value).unwrap();
+    assert_eq!(bytes, canonical_json::to_string(&value).unwrap().into_bytes());
+    // Non-ASCII is emitted as UTF-8, control characters are escaped
+    assert_eq!(bytes, "{\"a\":{},\"b\":[1.5,\"\u{1f600}\\n\"]}".as_bytes());
+}
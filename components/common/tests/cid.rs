@@ -0,0 +1,42 @@
+//! CIDs of both versions parse to the multihash digest of the content.
+
+use alloy_primitives::hex;
+use common::cid::{Cid, SHA2_256};
+
+/// sha2-256 of `hello`
+const HELLO_DIGEST: &str = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824";
+
+#[test]
+fn v1_raw_cid() {
+    let cid = Cid::parse("bafkreibm6jg3ux5qumhcn2b3flc3tyu6dmlb4xa7u5bf44yegnrjhc4yeq").unwrap();
+    assert_eq!(cid.version, 1);
+    assert_eq!(cid.codec, 0x55);
+    assert_eq!(cid.hash_code, SHA2_256);
+    assert_eq!(hex::encode(&cid.digest), HELLO_DIGEST);
+}
+
+#[test]
+fn v0_cid() {
+    let cid = Cid::parse("QmRN6wdp1S2A5EtjW9A3M1vKSBuQQGcgvuhoMUoEz4iiT5").unwrap();
+    assert_eq!(cid.version, 0);
+    assert_eq!(cid.codec, 0x70);
+    assert_eq!(cid.hash_code, SHA2_256);
+    assert_eq!(hex::encode(&cid.digest), HELLO_DIGEST);
+}
+
+#[test]
+fn malformed_cids_are_rejected() {
+    for invalid in [
+        "",
+        // Truncated digest
+        "bafkreibm6jg3ux5qumhcn2b3flc3tyu6dmlb4xa7u5bf44yegnrjhc4y",
+        // base58btc multibase prefix, not supported
+        "zb2rhe5P4gXftAwvA4eXQ5HJwsER2owDyS9sKaQRRVQPn93bA",
+        // `0` is not in the base58 alphabet
+        "QmRN6wdp1S2A5EtjW9A3M1vKSBuQQGcgvuhoMUoEz4ii0T",
+        // Upper-case base32
+        "BAFKREIBM6JG3UX5QUMHCN2B3FLC3TYU6DMLB4XA7U5BF44YEGNRJHC4YEQ",
+    ] {
+        assert!(Cid::parse(invalid).is_err(), "{invalid}");
+    }
+}
@@ -0,0 +1,66 @@
+//! CLI input is accepted pasted from an event, as raw text, hex or base64, or
+//! as a structured request.
+
+use alloy_primitives::hex;
+use base64::{engine::general_purpose::STANDARD, Engine};
+use common::{
+    cli_input::{self, InputEncoding, OutputFormat},
+    trigger_compat::TriggerFormat,
+};
+use serde_json::Value;
+
+const FIXTURES: &str = include_str!("../../../test/fixtures/abi.json");
+
+fn fixtures() -> Value {
+    serde_json::from_str(FIXTURES).unwrap()
+}
+
+fn bytes(case: &Value, field: &str) -> Vec<u8> {
+    hex::decode(case[field].as_str().unwrap()).unwrap()
+}
+
+#[test]
+fn cli_input_decodes_pasted_event_data() {
+    let fixtures = fixtures();
+    let case = &fixtures["new_trigger"]["data1"];
+
+    let pasted = cli_input::parse(case["encoded"].as_str().unwrap().as_bytes()).unwrap();
+    assert_eq!(pasted.encoding, InputEncoding::Trigger(TriggerFormat::TriggerInfo));
+    assert_eq!(pasted.trigger_id, case["triggerId"].as_u64().unwrap());
+    assert_eq!(pasted.data, bytes(case, "data"));
+
+    let address = case["creator"].as_str().unwrap().as_bytes();
+    assert_eq!(cli_input::parse(address).unwrap().encoding, InputEncoding::Text);
+
+    let raw = cli_input::parse(b"hex:0x00ff").unwrap();
+    assert_eq!((raw.encoding, raw.data), (InputEncoding::Hex, vec![0x00, 0xff]));
+
+    // Trailing zero bytes of binary requests survive
+    let request = bytes(case, "encoded");
+    let encoded = format!("base64:{}", STANDARD.encode(&request));
+    let binary = cli_input::parse(encoded.as_bytes()).unwrap();
+    assert_eq!((binary.encoding, binary.data), (InputEncoding::Base64, request));
+}
+
+#[test]
+fn cli_structured_request_selects_command_and_format() {
+    let request =
+        cli_input::parse(br#"{"cmd":"price","args":"1","format":"abi","trigger_id":7}"#).unwrap();
+    assert_eq!(request.command.as_deref(), Some("price"));
+    assert_eq!((request.format, request.trigger_id), (OutputFormat::Abi, 7));
+    assert_eq!(request.data, b"1");
+    assert!(request.check_command(&["price", "index"]).is_ok());
+    assert!(request.check_command(&["tvl"]).is_err());
+
+    // JSON args are passed on canonically
+    let request =
+        cli_input::parse(br#"{"cmd":"snapshot","args":{"token":"0x01","block":5}}"#).unwrap();
+    assert_eq!((request.format, request.trigger_id), (OutputFormat::Json, 0));
+    assert_eq!(request.data, br#"{"block":5,"token":"0x01"}"#);
+
+    // Objects without `cmd` are component input
+    let plain = cli_input::parse(br#"{"index":{"name":"top2"}}"#).unwrap();
+    assert_eq!((plain.command, plain.encoding), (None, InputEncoding::Text));
+
+    assert!(cli_input::parse(br#"{"cmd":"price","format":"rlp"}"#).is_err());
+}
@@ -0,0 +1,51 @@
+//! Commitments must match what the contract side recomputes: Solidity's
+//! `keccak256(payload)`, or circomlib's Poseidon over the packed payload, and
+//! the `commitmentHash` codes of the envelope are fixed.
+
+use alloy_primitives::{b256, B256};
+use common::commitment::CommitmentHash;
+
+const PAYLOAD: &[u8] = br#"{"price":"1.5"}"#;
+
+#[test]
+fn keccak256_matches_solidity() {
+    let hash = CommitmentHash::Keccak256;
+    assert_eq!(
+        hash.commit(b""),
+        b256!("c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470")
+    );
+    assert_eq!(
+        hash.commit(PAYLOAD),
+        b256!("41490a3e0c4a6a84ba412c6d307a0384747d4f5336449407ed9b02e8ed42a932")
+    );
+}
+
+#[test]
+fn poseidon_matches_circomlib() {
+    // One byte packs to `Poseidon([length, byte])`, here circomlib's
+    // `Poseidon([1, 2])`
+    assert_eq!(
+        CommitmentHash::Poseidon.commit(&[2]),
+        b256!("115cc0f5e7d690413df64c6b9662e9cf2a3617f2743245519e19607a4417189a")
+    );
+    assert_ne!(CommitmentHash::Poseidon.commit(PAYLOAD), CommitmentHash::Keccak256.commit(PAYLOAD));
+    assert_ne!(CommitmentHash::Poseidon.commit(&[2, 0]), CommitmentHash::Poseidon.commit(&[2]));
+}
+
+#[test]
+fn codes_and_names_are_fixed() {
+    assert_eq!(CommitmentHash::Keccak256 as u8, 0);
+    assert_eq!(CommitmentHash::Poseidon as u8, 1);
+    assert_eq!(CommitmentHash::default(), CommitmentHash::Keccak256);
+    for hash in [CommitmentHash::Keccak256, CommitmentHash::Poseidon] {
+        assert_eq!(hash.to_string().parse::<CommitmentHash>().unwrap(), hash);
+    }
+    assert!("sha256".parse::<CommitmentHash>().is_err());
+}
+
+#[test]
+fn commitments_are_bytes32() {
+    let commitment: B256 = CommitmentHash::Poseidon.commit(PAYLOAD);
+    // Field elements are below 2^254, so the top bits are clear
+    assert!(commitment[0] < 0x40);
+}
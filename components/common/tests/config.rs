@@ -0,0 +1,40 @@
+//! Embedded TOML configs flatten to the kv keys components already read.
+
+use common::config::flatten;
+
+#[test]
+fn tables_and_arrays_flatten_to_kv_keys() {
+    let kv = flatten(
+        r#"
+        price_payload_version = 2
+
+        [coinmarketcap]
+        base_urls = ["https://a.example", "https://b.example"]
+        range = "1d"
+
+        [sanity]
+        min_price = 1e-6
+        enabled = true
+        "#,
+    )
+    .unwrap();
+    let pairs: Vec<(&str, &str)> = kv.iter().map(|(k, v)| (k.as_str(), v.as_str())).collect();
+    assert_eq!(
+        pairs,
+        [
+            ("coinmarketcap_base_urls", "https://a.example,https://b.example"),
+            ("coinmarketcap_range", "1d"),
+            ("price_payload_version", "2"),
+            ("sanity_enabled", "true"),
+            ("sanity_min_price", "0.000001"),
+        ]
+    );
+}
+
+#[test]
+fn secrets_and_clashing_keys_are_rejected() {
+    assert!(flatten("WAVS_ENV_SIGNING_KEY = \"00\"").is_err());
+    assert!(flatten("a_b = 1\n[a]\nb = 2").is_err());
+    assert!(flatten("feeds = [{ id = 1 }]").is_err());
+    assert!(flatten("not toml").is_err());
+}
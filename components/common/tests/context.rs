@@ -0,0 +1,74 @@
+//! Cancellation and deadlines propagate from a context to its children, never
+//! the other way round.
+
+use common::{
+    clock::{Clock, FixedClock},
+    context::{ContextError, RunContext},
+    types::TriggerBlock,
+};
+use futures::executor::block_on;
+use std::{rc::Rc, time::Duration};
+
+#[test]
+fn background_runs_until_canceled() {
+    let ctx = RunContext::background();
+    assert_eq!(ctx.err(), None);
+    assert_eq!(ctx.remaining(), None);
+    assert_eq!(block_on(ctx.run(async { 7 })), Ok(7));
+
+    ctx.cancel();
+    assert_eq!(ctx.err(), Some(ContextError::Canceled));
+    assert_eq!(block_on(ctx.run(async { 7 })), Err(ContextError::Canceled));
+}
+
+#[test]
+fn cancellation_reaches_children_only() {
+    let parent = RunContext::background();
+    let child = parent.with_timeout(Duration::from_secs(60));
+    let grandchild = child.with_timeout(Duration::from_secs(60));
+
+    child.cancel();
+    assert_eq!(parent.err(), None);
+    assert_eq!(grandchild.err(), Some(ContextError::Canceled));
+
+    let sibling = parent.with_timeout(Duration::from_secs(60));
+    parent.cancel();
+    assert_eq!(sibling.err(), Some(ContextError::Canceled));
+}
+
+#[test]
+fn children_never_outlive_their_parent() {
+    let parent = RunContext::background().with_timeout(Duration::from_secs(1));
+    let child = parent.with_timeout(Duration::from_secs(3600));
+    assert_eq!(child.deadline(), parent.deadline());
+
+    let expired = parent.with_timeout(Duration::ZERO);
+    assert_eq!(expired.err(), Some(ContextError::DeadlineExceeded));
+    // The future is not even polled
+    let run = expired.run(async { unreachable!() });
+    assert_eq!(block_on(run), Err(ContextError::DeadlineExceeded));
+    assert_eq!(parent.err(), None);
+}
+
+#[test]
+fn clock_and_block_are_inherited() {
+    let block = TriggerBlock { chain_name: "local".to_string(), height: 42, http_endpoint: None };
+    let ctx = RunContext::from_trigger(Some(&block))
+        .unwrap()
+        .with_clock(Rc::new(FixedClock::from_unix_secs(1_700_000_000)));
+    let child = ctx.with_timeout(Duration::from_secs(60));
+
+    assert_eq!(child.clock().unix_secs(), 1_700_000_000);
+    assert_eq!(child.block(), Some(&block));
+    assert_eq!(child.pinned_height("local"), Some(42));
+    assert_eq!(child.pinned_height("mainnet"), None);
+
+    std::env::set_var("pin_to_trigger_block", "false");
+    assert_eq!(child.pinned_height("local"), None);
+    std::env::remove_var("pin_to_trigger_block");
+
+    std::env::set_var("timeout_ms", "1000");
+    assert!(RunContext::from_env().unwrap().remaining() <= Some(Duration::from_secs(1)));
+    std::env::set_var("timeout_ms", "1s");
+    assert!(RunContext::from_env().is_err());
+}
@@ -0,0 +1,72 @@
+//! A meter counts the requests of its own run only, and the counts reach the
+//! CLI output but never the on-chain result.
+
+use common::{
+    cost::{self, ComputeCost, Meter},
+    envelope::{self, ComponentInfo, Format},
+    output,
+    types::Destination,
+};
+use serde_json::Value;
+
+const COMPONENT: ComponentInfo = ComponentInfo { name: "test-component", version: "0.1.0" };
+
+/// Every test runs with the cost reported
+fn reported() {
+    std::env::set_var("report_compute_cost", "true");
+}
+
+#[test]
+fn meter_counts_requests_since_it_started() {
+    cost::record(100);
+    let _meter = Meter::start();
+    assert_eq!(cost::current().http_calls, 0);
+
+    cost::record(10);
+    cost::record(0);
+    let current = cost::current();
+    assert_eq!((current.http_calls, current.bytes_fetched), (2, 10));
+
+    // A new run starts from zero
+    let _meter = Meter::start();
+    assert_eq!((cost::current().http_calls, cost::current().bytes_fetched), (0, 0));
+}
+
+#[test]
+fn cost_displays_as_log_fields() {
+    let cost = ComputeCost { http_calls: 2, bytes_fetched: 10, wall_time_ms: 3 };
+    assert_eq!(cost.to_string(), "http_calls=2 bytes_fetched=10 wall_time_ms=3");
+}
+
+#[test]
+fn reported_when_enabled() {
+    reported();
+    let _meter = Meter::start();
+    cost::record(10);
+    assert_eq!(cost::reported().unwrap().map(|cost| cost.bytes_fetched), Some(10));
+}
+
+#[test]
+fn cli_output_carries_the_cost() {
+    reported();
+    let _meter = Meter::start();
+    cost::record(10);
+
+    let sealed =
+        envelope::seal(COMPONENT, "price:1", 0, br#"{"price":"1.5"}"#.to_vec(), Format::Json)
+            .unwrap();
+    let output = output::with_run_stats(Destination::CliOutput, sealed).unwrap();
+    let json: Value = serde_json::from_slice(&output).unwrap();
+    assert_eq!(json["compute_cost"]["http_calls"], 1);
+    assert_eq!(json["compute_cost"]["bytes_fetched"], 10);
+    assert_eq!(json["payload"]["price"], "1.5");
+}
+
+#[test]
+fn on_chain_output_is_unchanged() {
+    reported();
+    let _meter = Meter::start();
+    cost::record(10);
+    let output = output::with_run_stats(Destination::Ethereum, vec![0xab; 64]).unwrap();
+    assert_eq!(output, vec![0xab; 64]);
+}
@@ -0,0 +1,79 @@
+//! Schedules must agree with cron on which minutes fire, since the window a
+//! fire covers is derived from them.
+
+use common::cron::{CronFire, Schedule};
+
+// 2025-03-01 12:00 UTC, a Saturday
+const SAT_NOON: u64 = 1740830400;
+// 2025-03-03 09:00 UTC, a Monday
+const MON_NINE: u64 = 1740992400;
+
+#[test]
+fn steps_ranges_and_lists() {
+    let every_15 = Schedule::parse("*/15 * * * *").unwrap();
+    assert!(every_15.matches(SAT_NOON) && every_15.matches(SAT_NOON + 45 * 60 + 59));
+    assert!(!every_15.matches(SAT_NOON + 60));
+    assert_eq!(every_15.previous(SAT_NOON), Some(SAT_NOON - 15 * 60));
+    assert_eq!(every_15.previous(SAT_NOON + 1), Some(SAT_NOON));
+
+    let weekday_mornings = Schedule::parse("0 9 * * 1-5").unwrap();
+    assert!(weekday_mornings.matches(MON_NINE));
+    // The Friday before
+    assert_eq!(weekday_mornings.previous(MON_NINE), Some(1740733200));
+
+    // Sunday is 0 and 7; 2025-03-02 06:30 is a Sunday
+    let sunday_six_thirty = SAT_NOON + 18 * 3600 + 30 * 60;
+    for weekday in ["0", "7"] {
+        let sundays = Schedule::parse(&format!("30 6,18 * * {weekday}")).unwrap();
+        assert!(sundays.matches(sunday_six_thirty));
+        assert!(!sundays.matches(sunday_six_thirty - 86_400));
+    }
+}
+
+#[test]
+fn leap_days_are_found_years_back() {
+    let leap_day = Schedule::parse("0 0 29 2 *").unwrap();
+    // 2024-02-29 00:00
+    assert_eq!(leap_day.previous(SAT_NOON), Some(1709164800));
+    assert_eq!(Schedule::parse("0 0 30 2 *").unwrap().previous(SAT_NOON), None);
+}
+
+#[test]
+fn restricted_day_fields_match_either() {
+    // The 1st, and every Monday
+    let schedule = Schedule::parse("0 0 1 * 1").unwrap();
+    // 2025-09-08 (Mon) back to 2025-09-01 (Mon and the 1st), then 2025-08-25 (Mon)
+    assert_eq!(schedule.previous(1757289600), Some(1756684800));
+    assert_eq!(schedule.previous(1756684800), Some(1756080000));
+}
+
+#[test]
+fn invalid_schedules_are_rejected() {
+    for invalid in [
+        "* * * *",
+        "60 * * * *",
+        "* 24 * * *",
+        "* * 0 * *",
+        "*/0 * * * *",
+        "5-1 * * * *",
+        "a * * * *",
+    ] {
+        assert!(Schedule::parse(invalid).is_err(), "{invalid}");
+    }
+}
+
+#[test]
+fn cron_payload_gives_the_scheduled_window() {
+    let payload =
+        format!(r#"{{"schedule":"*/15 * * * *","fire_time":{},"occurrence":2016}}"#, SAT_NOON + 7);
+    let fire = CronFire::parse(payload.as_bytes()).unwrap().unwrap();
+    assert_eq!((fire.fire_time, fire.occurrence), (SAT_NOON, 2016));
+    assert_eq!(fire.window().unwrap(), (SAT_NOON - 15 * 60, SAT_NOON));
+
+    let off_schedule = format!(r#"{{"schedule":"*/15 * * * *","fire_time":{}}}"#, SAT_NOON + 60);
+    assert!(CronFire::parse(off_schedule.as_bytes()).is_err());
+
+    // Other input is not a scheduled trigger
+    assert_eq!(CronFire::parse(b"1").unwrap(), None);
+    assert_eq!(CronFire::parse(br#"{"index":{}}"#).unwrap(), None);
+}
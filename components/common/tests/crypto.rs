@@ -0,0 +1,35 @@
+//! Packing and hashing must match Solidity's `abi.encodePacked` and
+//! `keccak256`, and addresses follow EIP-55.
+
+use alloy_primitives::{address, U256};
+use common::crypto::{
+    encode_packed, keccak256, keccak256_packed, parse_address, to_checksum_address,
+};
+
+#[test]
+fn packed_encoding_concatenates_without_padding() {
+    let addr = address!("5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed");
+    let packed = encode_packed(&(addr, U256::from(1u64), true));
+    assert_eq!(packed.len(), 20 + 32 + 1);
+    assert_eq!(&packed[..20], addr.as_slice());
+    assert_eq!(packed[51], 1);
+    assert_eq!(packed[52], 1);
+
+    assert_eq!(keccak256_packed(&"hello".to_string()), keccak256(b"hello"));
+}
+
+/// Vectors from EIP-55
+#[test]
+fn addresses_are_checksummed() {
+    for checksummed in [
+        "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+        "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+        "0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+    ] {
+        let addr = parse_address(checksummed).unwrap();
+        assert_eq!(to_checksum_address(&addr), checksummed);
+        assert_eq!(parse_address(&checksummed.to_lowercase()).unwrap(), addr);
+    }
+    // One letter's case flipped
+    assert!(parse_address("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD").is_err());
+}
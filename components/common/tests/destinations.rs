@@ -0,0 +1,68 @@
+//! `result_destinations` lists the copies of a result in order, and a copy
+//! that fails never keeps the others from being delivered.
+
+use common::{
+    context::RunContext,
+    destinations::{self, Destination},
+    envelope::ComponentInfo,
+    output::{self, Computed},
+};
+use futures::executor::block_on;
+use serde_json::Value;
+
+const COMPONENT: ComponentInfo = ComponentInfo { name: "test-component", version: "0.1.0" };
+
+/// Every test runs with the same list: a log copy on either side of a
+/// webhook whose URL can't be requested
+fn configured() {
+    std::env::set_var("result_destinations", "log, webhook:http://bad host/hook,, log");
+}
+
+#[test]
+fn destinations_parse() {
+    assert_eq!("log".parse::<Destination>().unwrap(), Destination::Log);
+    assert_eq!(
+        "webhook:https://example.com/hook".parse::<Destination>().unwrap(),
+        Destination::Webhook("https://example.com/hook".to_string())
+    );
+    assert!("webhook:ftp://example.com".parse::<Destination>().is_err());
+    assert!("webhook".parse::<Destination>().is_err());
+    assert!("stdout".parse::<Destination>().is_err());
+
+    let webhook = Destination::Webhook("https://example.com/hook".to_string());
+    assert_eq!(webhook.to_string().parse::<Destination>().unwrap(), webhook);
+}
+
+#[test]
+fn config_lists_destinations_in_order() {
+    configured();
+    assert_eq!(
+        destinations::from_env().unwrap(),
+        [
+            Destination::Log,
+            Destination::Webhook("http://bad host/hook".to_string()),
+            Destination::Log
+        ]
+    );
+}
+
+#[test]
+fn failed_copies_do_not_stop_the_others() {
+    configured();
+    let ctx = RunContext::background();
+    let result = Computed::new("price:1", br#"{"price":"1.5"}"#.to_vec());
+    assert_eq!(block_on(output::deliver(&ctx, COMPONENT, 7, &result)).unwrap(), 2);
+}
+
+#[test]
+fn record_is_the_json_envelope_and_trigger() {
+    let record = destinations::record(COMPONENT, 7, "price:1", 4, br#"{"price":"1.5"}"#).unwrap();
+    let record: Value = serde_json::from_slice(&record).unwrap();
+    assert_eq!(record["trigger_id"], 7);
+    assert_eq!(record["envelope"]["feed_id"], "price:1");
+    assert_eq!(record["envelope"]["flags"], 4);
+    assert_eq!(record["envelope"]["payload"]["price"], "1.5");
+    // Off unless `report_compute_cost` is set, and without the counting allocator
+    assert!(record.get("compute_cost").is_none());
+    assert!(record.get("alloc_stats").is_none());
+}
@@ -0,0 +1,168 @@
+//! The self-check replays the first run's upstream responses to the second
+//! and fails when the outputs or the requests differ.
+
+use anyhow::anyhow;
+use common::{
+    context::RunContext,
+    determinism,
+    envelope::ComponentInfo,
+    output::{self, Computed},
+    types::Destination,
+};
+use futures::{executor::block_on, future};
+use std::{
+    cell::Cell,
+    future::Future,
+    pin::Pin,
+    task::{Context, Poll},
+};
+
+const COMPONENT: ComponentInfo = ComponentInfo { name: "test-component", version: "0.1.0" };
+
+fn upstream(
+    calls: &Cell<u32>,
+    body: &'static [u8],
+) -> impl FnOnce() -> std::future::Ready<anyhow::Result<Vec<u8>>> + '_ {
+    move || {
+        calls.set(calls.get() + 1);
+        std::future::ready(Ok(body.to_vec()))
+    }
+}
+
+/// Pending on its first poll, so requests made after it are answered first
+struct Late(bool);
+
+impl Future for Late {
+    type Output = ();
+
+    fn poll(mut self: Pin<&mut Self>, cx: &mut Context<'_>) -> Poll<()> {
+        if self.0 {
+            return Poll::Ready(());
+        }
+        self.0 = true;
+        cx.waker().wake_by_ref();
+        Poll::Pending
+    }
+}
+
+#[test]
+fn responses_are_replayed_in_the_second_run() {
+    std::env::set_var("determinism_check", "true");
+    let calls = Cell::new(0);
+    let runs = Cell::new(0);
+
+    let output = determinism::run_checked(|| {
+        runs.set(runs.get() + 1);
+        block_on(async {
+            let a = determinism::fetch("a", upstream(&calls, b"1")).await?;
+            let b = determinism::fetch("a", upstream(&calls, b"2")).await?;
+            Ok([a, b].concat())
+        })
+        .map_err(|e: anyhow::Error| e.to_string())
+    });
+
+    assert_eq!(output, Ok(b"12".to_vec()));
+    assert_eq!(runs.get(), 2);
+    // The replay does not hit the upstream
+    assert_eq!(calls.get(), 2);
+}
+
+#[test]
+fn diverging_outputs_fail() {
+    std::env::set_var("determinism_check", "true");
+    let runs = Cell::new(0u8);
+
+    let output = determinism::run_checked(|| {
+        runs.set(runs.get() + 1);
+        Ok(vec![runs.get()])
+    });
+
+    assert!(output.unwrap_err().starts_with("determinism check failed: outputs differ"));
+}
+
+#[test]
+fn diverging_requests_fail() {
+    std::env::set_var("determinism_check", "true");
+    let calls = Cell::new(0);
+    let runs = Cell::new(0);
+
+    let output = determinism::run_checked(|| {
+        runs.set(runs.get() + 1);
+        let key = if runs.get() == 1 { "a" } else { "b" };
+        block_on(determinism::fetch(key, upstream(&calls, b"1"))).map_err(|e| e.to_string())
+    });
+    assert_eq!(
+        output,
+        Err("determinism check failed: b was not requested in the first run".to_string())
+    );
+
+    runs.set(0);
+    let output = determinism::run_checked(|| {
+        runs.set(runs.get() + 1);
+        if runs.get() == 1 {
+            block_on(determinism::fetch("a", upstream(&calls, b"1"))).map_err(|e| e.to_string())?;
+        }
+        Ok(Vec::new())
+    });
+    assert_eq!(
+        output,
+        Err("determinism check failed: 1 upstream responses were not used in the second run"
+            .to_string())
+    );
+}
+
+#[test]
+fn answers_replay_in_request_order() {
+    std::env::set_var("determinism_check", "true");
+    let runs = Cell::new(0);
+
+    let output = determinism::run_checked(|| {
+        runs.set(runs.get() + 1);
+        let slow = determinism::fetch("a", || async {
+            Late(false).await;
+            Ok(b"slow".to_vec())
+        });
+        let fast = determinism::fetch("a", || async { Ok(b"fast".to_vec()) });
+        let (slow, fast) = block_on(future::join(slow, fast));
+        Ok([slow.map_err(|e| e.to_string())?, fast.map_err(|e| e.to_string())?].concat())
+    });
+    assert_eq!(output, Ok(b"slowfast".to_vec()));
+    assert_eq!(runs.get(), 2);
+}
+
+#[test]
+fn errors_are_replayed_with_their_messages() {
+    std::env::set_var("determinism_check", "true");
+    let calls = Cell::new(0);
+
+    let output = determinism::run_checked(|| {
+        let fetched = block_on(determinism::fetch("a", || async {
+            calls.set(calls.get() + 1);
+            Err::<Vec<u8>, _>(anyhow!("connection reset").context("upstream failed"))
+        }));
+        let e = fetched.unwrap_err();
+        Ok(format!("{e} / {e:#}").into_bytes())
+    });
+    assert_eq!(output, Ok(b"upstream failed / upstream failed: connection reset".to_vec()));
+    assert_eq!(calls.get(), 1);
+}
+
+#[test]
+fn every_component_result_is_checked() {
+    std::env::set_var("determinism_check", "true");
+    let ctx = RunContext::background();
+    let runs = Cell::new(0u8);
+
+    let output = output::produce(&ctx, COMPONENT, 7, Destination::CliOutput, || {
+        runs.set(runs.get() + 1);
+        Ok(Computed::new("price:1", br#"{"price":"1.5"}"#.to_vec()))
+    });
+    assert!(output.is_ok());
+    assert_eq!(runs.get(), 2);
+
+    let output = output::produce(&ctx, COMPONENT, 7, Destination::CliOutput, || {
+        runs.set(runs.get() + 1);
+        Ok(Computed::new("price:1", format!(r#"{{"run":{}}}"#, runs.get()).into_bytes()))
+    });
+    assert!(output.unwrap_err().starts_with("determinism check failed: outputs differ"));
+}
@@ -0,0 +1,119 @@
+//! The envelope is part of the result format consumers decode: the flag bits
+//! and the ABI encoding are pinned here, and the JSON form carries the same
+//! fields as the ABI one.
+
+use alloy_primitives::{hex, keccak256};
+use alloy_sol_types::SolValue;
+use common::envelope::{self, ComponentInfo, Envelope, Format, SCHEMA_VERSION};
+use serde_json::Value;
+
+mod solidity {
+    use alloy_sol_macro::sol;
+    pub use ITypes::*;
+
+    sol!("../../src/interfaces/ITypes.sol");
+}
+
+const COMPONENT: ComponentInfo = ComponentInfo { name: "test-component", version: "0.1.0" };
+
+const PAYLOAD: &[u8] = br#"{"price":"1.5"}"#;
+
+/// `abi.encode(ResultEnvelope)` of [`envelope`]
+const ENCODED: &str = concat!(
+    "0000000000000000000000000000000000000000000000000000000000000020",
+    "0000000000000000000000000000000000000000000000000000000000000001",
+    "0000000000000000000000000000000000000000000000000000000000000100",
+    "0000000000000000000000000000000000000000000000000000000000000140",
+    "0000000000000000000000000000000000000000000000000000000000000180",
+    "0000000000000000000000000000000000000000000000000000000000000005",
+    "0000000000000000000000000000000000000000000000000000000000000000",
+    "41490a3e0c4a6a84ba412c6d307a0384747d4f5336449407ed9b02e8ed42a932",
+    "00000000000000000000000000000000000000000000000000000000000001c0",
+    "000000000000000000000000000000000000000000000000000000000000000e",
+    "746573742d636f6d706f6e656e74000000000000000000000000000000000000",
+    "0000000000000000000000000000000000000000000000000000000000000005",
+    "302e312e30000000000000000000000000000000000000000000000000000000",
+    "0000000000000000000000000000000000000000000000000000000000000007",
+    "70726963653a3100000000000000000000000000000000000000000000000000",
+    "000000000000000000000000000000000000000000000000000000000000000f",
+    "7b227072696365223a22312e35227d0000000000000000000000000000000000",
+);
+
+/// Every test runs enveloped with keccak256 commitments, the defaults
+fn configured() {
+    std::env::set_var("output_envelope", "v1");
+    std::env::set_var("commitment_hash", "keccak256");
+}
+
+fn envelope(payload: &[u8]) -> Envelope {
+    Envelope::new(COMPONENT, "price:1", payload.to_vec())
+        .unwrap()
+        .with_flags(envelope::FLAG_SIZE_LIMITED | envelope::FLAG_MARKET_CLOSED)
+}
+
+#[test]
+fn flag_bits_are_pinned() {
+    // Consumers test these bits; moving one changes what old results mean
+    assert_eq!(
+        [
+            envelope::FLAG_SIZE_LIMITED,
+            envelope::FLAG_TYPED_DATA,
+            envelope::FLAG_MARKET_CLOSED,
+            envelope::FLAG_ABI_STRUCT,
+            envelope::FLAG_EXPERIMENTAL,
+            envelope::FLAG_READBACK_MISMATCH,
+            envelope::FLAG_READBACK_MISSED,
+        ],
+        [1, 2, 4, 8, 16, 32, 64]
+    );
+}
+
+#[test]
+fn abi_envelope_matches_solidity() {
+    configured();
+    let encoded = envelope(PAYLOAD).abi_encode();
+    assert_eq!(hex::encode(&encoded), ENCODED);
+
+    let decoded = solidity::ResultEnvelope::abi_decode(&encoded, true).unwrap();
+    assert_eq!(decoded.schemaVersion, SCHEMA_VERSION);
+    assert_eq!(decoded.component, COMPONENT.name);
+    assert_eq!(decoded.componentVersion, COMPONENT.version);
+    assert_eq!(decoded.feedId, "price:1");
+    assert_eq!(decoded.flags, 5);
+    assert_eq!(decoded.commitmentHash, 0);
+    assert_eq!(decoded.commitment, keccak256(PAYLOAD));
+    assert_eq!(decoded.payload.to_vec(), PAYLOAD);
+}
+
+#[test]
+fn json_envelope_carries_the_abi_fields() {
+    configured();
+    let envelope = envelope(PAYLOAD);
+    let json: Value = serde_json::from_slice(&envelope.to_json().unwrap()).unwrap();
+    assert_eq!(json["schema_version"], SCHEMA_VERSION);
+    assert_eq!(json["component"], COMPONENT.name);
+    assert_eq!(json["component_version"], COMPONENT.version);
+    assert_eq!(json["feed_id"], "price:1");
+    assert_eq!(json["flags"], 5);
+    assert_eq!(json["commitment_hash"], "keccak256");
+    assert_eq!(json["commitment"], serde_json::to_value(envelope.commitment()).unwrap());
+    // JSON payloads are inlined
+    assert_eq!(json["payload"]["price"], "1.5");
+}
+
+#[test]
+fn json_envelope_hex_encodes_other_payloads() {
+    configured();
+    let envelope = envelope(&[0xde, 0xad]);
+    let json: Value = serde_json::from_slice(&envelope.to_json().unwrap()).unwrap();
+    assert_eq!(json["payload"], "0xdead");
+    assert_eq!(json["commitment"], serde_json::to_value(keccak256([0xde, 0xad])).unwrap());
+}
+
+#[test]
+fn seal_picks_the_form() {
+    configured();
+    let seal = |format| envelope::seal(COMPONENT, "price:1", 5, PAYLOAD.to_vec(), format);
+    assert_eq!(hex::encode(seal(Format::Abi).unwrap()), ENCODED);
+    assert_eq!(seal(Format::Json).unwrap(), envelope(PAYLOAD).to_json().unwrap());
+}
@@ -0,0 +1,73 @@
+//! Block headers decode from what nodes return for `eth_getBlockBy*`, and a
+//! trigger's header is only read from its chain's configured endpoint.
+
+use alloy_primitives::{b256, U64};
+use common::{
+    evm::{self, BlockHeader},
+    types::TriggerBlock,
+};
+use futures::executor::block_on;
+use serde::Deserialize;
+
+/// Mainnet block 1 as `eth_getBlockByNumber(0x1, false)` returns it, fields
+/// the components don't read included
+const BLOCK_1: &str = r#"{
+    "jsonrpc": "2.0",
+    "id": 1,
+    "result": {
+        "number": "0x1",
+        "hash": "0x88e96d4537bea4d9c05d12549907b32561d3bf31f45aae734cdc119f13406cb6",
+        "parentHash": "0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3",
+        "miner": "0x05a56e2d52c817161883f50c441c3228cfe54d9f",
+        "extraData": "0x476574682f76312e302e302f6c696e75782f676f312e342e32",
+        "gasLimit": "0x1388",
+        "gasUsed": "0x0",
+        "timestamp": "0x55ba4224",
+        "transactions": [],
+        "uncles": []
+    }
+}"#;
+
+/// What nodes return for a block they don't have
+const UNKNOWN: &str = r#"{"jsonrpc": "2.0", "id": 1, "result": null}"#;
+
+#[derive(Deserialize)]
+struct RpcResponse {
+    result: Option<BlockHeader>,
+}
+
+fn decode(response: &str) -> serde_json::Result<Option<BlockHeader>> {
+    serde_json::from_str::<RpcResponse>(response).map(|response| response.result)
+}
+
+#[test]
+fn header_decodes_from_a_block() {
+    assert_eq!(
+        decode(BLOCK_1).unwrap(),
+        Some(BlockHeader {
+            number: U64::from(1),
+            hash: b256!("88e96d4537bea4d9c05d12549907b32561d3bf31f45aae734cdc119f13406cb6"),
+            timestamp: U64::from(1_438_269_988),
+        })
+    );
+}
+
+#[test]
+fn unknown_block_is_none() {
+    assert_eq!(decode(UNKNOWN).unwrap(), None);
+}
+
+#[test]
+fn headers_need_a_hash() {
+    let without_hash = BLOCK_1.replace(r#""hash""#, r#""blockHash""#);
+    assert!(decode(&without_hash).is_err());
+}
+
+#[test]
+fn trigger_header_needs_an_endpoint() {
+    let block = TriggerBlock { chain_name: "local".to_string(), height: 42, http_endpoint: None };
+    assert_eq!(
+        block_on(evm::trigger_header(&block)).unwrap_err().to_string(),
+        "no http_endpoint for chain local to read block 42"
+    );
+}
@@ -0,0 +1,86 @@
+//! Sources run at most `max_concurrency` at a time and their results keep the
+//! input order.
+
+use common::{context::RunContext, fan_out::FanOut};
+use futures::executor::block_on;
+use std::{
+    cell::Cell,
+    future::Future,
+    pin::Pin,
+    task::{Context, Poll},
+};
+
+/// Yields to the executor once, so other buffered sources get polled
+struct YieldNow(bool);
+
+impl Future for YieldNow {
+    type Output = ();
+
+    fn poll(mut self: Pin<&mut Self>, cx: &mut Context<'_>) -> Poll<()> {
+        if self.0 {
+            return Poll::Ready(());
+        }
+        self.0 = true;
+        cx.waker().wake_by_ref();
+        Poll::Pending
+    }
+}
+
+#[test]
+fn concurrency_is_bounded_and_order_kept() {
+    let fan_out = FanOut { max_concurrency: 2, source_timeout: None };
+    let active = Cell::new(0);
+    let peak = Cell::new(0);
+
+    let sources = (0..5u32).map(|i| {
+        let (active, peak) = (&active, &peak);
+        async move {
+            active.set(active.get() + 1);
+            peak.set(peak.get().max(active.get()));
+            // Later sources finish first
+            for _ in 0..5 - i {
+                YieldNow(false).await;
+            }
+            active.set(active.get() - 1);
+            Ok::<_, String>(i * 10)
+        }
+    });
+    let results = block_on(fan_out.try_join(&RunContext::background(), sources)).unwrap();
+
+    assert_eq!(results, [0, 10, 20, 30, 40]);
+    assert_eq!(peak.get(), 2);
+}
+
+#[test]
+fn first_error_is_returned() {
+    let sources = (0..3u32).map(|i| async move {
+        match i {
+            1 => Err(format!("source {i} is down")),
+            _ => Ok(i),
+        }
+    });
+    let result = block_on(FanOut::default().try_join(&RunContext::background(), sources));
+    assert_eq!(result.unwrap_err().to_string(), "source 1 is down");
+}
+
+#[test]
+fn canceled_context_runs_nothing() {
+    let ctx = RunContext::background();
+    ctx.cancel();
+    let polled = Cell::new(false);
+    let sources = [async {
+        polled.set(true);
+        Ok::<_, String>(())
+    }];
+    assert!(block_on(FanOut::default().try_join(&ctx, sources)).is_err());
+    assert!(!polled.get());
+}
+
+#[test]
+fn config_is_validated() {
+    std::env::set_var("max_concurrency", "8");
+    assert_eq!(FanOut::from_env().unwrap().max_concurrency, 8);
+    std::env::set_var("max_concurrency", "0");
+    assert!(FanOut::from_env().is_err());
+    std::env::remove_var("max_concurrency");
+}
@@ -0,0 +1,59 @@
+//! Scaling must be exact decimal arithmetic: no binary float error, no
+//! silent saturation or truncation.
+
+use alloy_primitives::{I256, U256};
+use common::fixed_point::{from_f64, parse, parse_signed, Rounding, ScaleError};
+
+fn u(s: &str) -> U256 {
+    s.parse().unwrap()
+}
+
+#[test]
+fn floats_scale_by_their_shortest_decimal() {
+    // `1.1 * 1e18` is 1100000000000000128 in f64
+    assert_eq!(from_f64(1.1, 18, Rounding::Exact), Ok(u("1100000000000000000")));
+    assert_eq!(from_f64(97234.51823404113, 8, Rounding::HalfUp), Ok(u("9723451823404")));
+    assert_eq!(from_f64(1e-7, 8, Rounding::Exact), Ok(U256::from(10)));
+    assert_eq!(from_f64(-0.0, 8, Rounding::Exact), Ok(U256::ZERO));
+}
+
+#[test]
+fn rounding_modes() {
+    assert_eq!(parse("1.23456", 4, Rounding::HalfUp), Ok(U256::from(12346)));
+    assert_eq!(parse("1.23454", 4, Rounding::HalfUp), Ok(U256::from(12345)));
+    assert_eq!(parse("1.23456", 4, Rounding::Down), Ok(U256::from(12345)));
+    assert_eq!(parse("1.23456", 4, Rounding::Exact), Err(ScaleError::PrecisionLoss));
+    // Trailing zeros are not lost precision
+    assert_eq!(parse("1.23450000", 4, Rounding::Exact), Ok(U256::from(12345)));
+}
+
+#[test]
+fn exponents_shift_the_point() {
+    assert_eq!(parse("1.5e-7", 8, Rounding::Exact), Ok(U256::from(15)));
+    assert_eq!(parse("2E3", 0, Rounding::Exact), Ok(U256::from(2000)));
+    assert_eq!(parse("0e400", 18, Rounding::Exact), Ok(U256::ZERO));
+}
+
+#[test]
+fn lossy_cases_are_errors() {
+    assert_eq!(parse("0.000000001", 8, Rounding::HalfUp), Err(ScaleError::Underflow));
+    assert_eq!(parse("0.000000005", 8, Rounding::HalfUp), Ok(U256::from(1)));
+    assert_eq!(parse("1e60", 18, Rounding::Exact), Err(ScaleError::Overflow));
+    assert_eq!(parse(&U256::MAX.to_string(), 0, Rounding::Exact), Ok(U256::MAX));
+    assert_eq!(parse("-1", 8, Rounding::Exact), Err(ScaleError::Negative));
+    assert_eq!(from_f64(f64::NAN, 8, Rounding::HalfUp), Err(ScaleError::NotFinite));
+    assert_eq!(from_f64(f64::INFINITY, 8, Rounding::HalfUp), Err(ScaleError::NotFinite));
+    assert!(matches!(parse("1.2.3", 8, Rounding::Exact), Err(ScaleError::Malformed(_))));
+    assert!(matches!(parse("", 8, Rounding::Exact), Err(ScaleError::Malformed(_))));
+}
+
+#[test]
+fn signed_values_round_their_magnitude() {
+    let i = |n: i64| I256::try_from(n).unwrap();
+    assert_eq!(parse_signed("-0.00012345", 6, Rounding::HalfUp), Ok(i(-123)));
+    assert_eq!(parse_signed("-0.0000125", 6, Rounding::HalfUp), Ok(i(-13)));
+    assert_eq!(parse_signed("+0.0001", 6, Rounding::Exact), Ok(i(100)));
+    assert_eq!(parse_signed("-0", 6, Rounding::Exact), Ok(I256::ZERO));
+    assert_eq!(parse_signed(&U256::MAX.to_string(), 0, Rounding::Exact), Err(ScaleError::Overflow));
+    assert!(matches!(parse_signed("--1", 6, Rounding::Exact), Err(ScaleError::Malformed(_))));
+}
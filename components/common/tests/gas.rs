@@ -0,0 +1,62 @@
+//! Submission gas estimates: calldata is priced per byte, storage per slot,
+//! and a batch pays the storage of every result but only one transaction.
+
+use common::gas::{self, STORAGE_WORD_GAS};
+
+const MAX_SUBMISSION_GAS: u64 = 300_000;
+
+/// Every test runs with the same budget, small outputs fit it
+fn budget() {
+    std::env::set_var("max_submission_gas", MAX_SUBMISSION_GAS.to_string());
+}
+
+#[test]
+fn calldata_prices_zero_bytes_lower() {
+    assert_eq!(gas::calldata_gas(&[]), 0);
+    assert_eq!(gas::calldata_gas(&[0, 0, 0]), 12);
+    assert_eq!(gas::calldata_gas(&[0, 1, 0xff]), 36);
+}
+
+#[test]
+fn storage_is_one_slot_below_a_word() {
+    assert_eq!(gas::bytes_storage_gas(0), STORAGE_WORD_GAS);
+    assert_eq!(gas::bytes_storage_gas(31), STORAGE_WORD_GAS);
+    // Long `bytes` keep their length in a slot of its own
+    assert_eq!(gas::bytes_storage_gas(32), 2 * STORAGE_WORD_GAS);
+    assert_eq!(gas::bytes_storage_gas(33), 3 * STORAGE_WORD_GAS);
+    assert_eq!(gas::bytes_storage_gas(64), 3 * STORAGE_WORD_GAS);
+}
+
+#[test]
+fn submission_estimate() {
+    // A DataWithId head of four words and one word of data
+    let output = [0u8; 160];
+    assert_eq!(gas::estimate_submission(&output), 237_380);
+    // Outputs shorter than the head store no data beyond one slot
+    assert_eq!(gas::estimate_submission(&[]), 214_640);
+    assert!(gas::estimate_submission(&[1; 1024]) > gas::estimate_submission(&[0; 1024]));
+}
+
+#[test]
+fn batch_pays_storage_per_result() {
+    let output = [0u8; 160];
+    assert_eq!(gas::estimate_batch_submission(&output, &[32, 32]), 392_080);
+    assert_eq!(gas::estimate_batch_submission(&output, &[]), 21_000 + 1_680 + 60_000);
+}
+
+#[test]
+fn submissions_above_the_budget_fail() {
+    budget();
+    assert_eq!(gas::check_submission(&[0; 160]).unwrap(), 237_380);
+
+    let err = gas::check_submission(&[1; 1024]).unwrap_err().to_string();
+    assert!(err.contains("above max_submission_gas 300000"), "{err}");
+    assert!(err.contains("submitting 1024 bytes"), "{err}");
+}
+
+#[test]
+fn batches_above_the_budget_fail() {
+    budget();
+    assert!(gas::check_batch_submission(&[0; 160], &[32, 32]).is_err());
+    assert!(gas::check_batch_submission(&[0; 160], &[]).is_ok());
+}
@@ -0,0 +1,113 @@
+//! The trigger encoders must produce exactly the bytes the contracts do.
+//! Fixtures are pinned on the Solidity side by test/unit/AbiGolden.t.sol.
+
+use alloy_primitives::{hex, Address};
+use alloy_sol_types::{SolEvent, SolValue};
+use common::{
+    trigger,
+    trigger_compat::{self, TriggerFormat},
+};
+use serde_json::Value;
+
+mod solidity {
+    use alloy_sol_macro::sol;
+    pub use ITypes::*;
+
+    sol!("../../src/interfaces/ITypes.sol");
+}
+
+mod indexed {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        event NewTrigger(uint64 indexed triggerId, address indexed creator, bytes data);
+    }
+}
+
+const FIXTURES: &str = include_str!("../../../test/fixtures/abi.json");
+
+fn fixtures() -> Value {
+    serde_json::from_str(FIXTURES).unwrap()
+}
+
+fn bytes(case: &Value, field: &str) -> Vec<u8> {
+    hex::decode(case[field].as_str().unwrap()).unwrap()
+}
+
+#[test]
+fn data_with_id_matches_solidity() {
+    let fixtures = fixtures();
+    for (name, case) in fixtures["data_with_id"].as_object().unwrap() {
+        let output = solidity::DataWithId {
+            triggerId: case["triggerId"].as_u64().unwrap(),
+            data: bytes(case, "data").into(),
+        };
+        assert_eq!(output.abi_encode(), bytes(case, "encoded"), "{name}");
+    }
+}
+
+#[test]
+fn shared_output_encoder_matches_solidity() {
+    let fixtures = fixtures();
+    for (name, case) in fixtures["data_with_id"].as_object().unwrap() {
+        let encoded =
+            trigger::encode_output(case["triggerId"].as_u64().unwrap(), bytes(case, "data"));
+        assert_eq!(encoded, bytes(case, "encoded"), "{name}");
+    }
+}
+
+#[test]
+fn new_trigger_decodes() {
+    let fixtures = fixtures();
+    let case = &fixtures["new_trigger"]["data1"];
+
+    let event = solidity::NewTrigger::abi_decode_data(&bytes(case, "encoded"), true).unwrap();
+    let info = solidity::TriggerInfo::abi_decode(&event.0, true).unwrap();
+
+    assert_eq!(info.triggerId, case["triggerId"].as_u64().unwrap());
+    assert_eq!(info.creator, case["creator"].as_str().unwrap().parse::<Address>().unwrap());
+    assert_eq!(info.data.to_vec(), bytes(case, "data"));
+}
+
+#[test]
+fn compat_layer_detects_both_layouts() {
+    let fixtures = fixtures();
+    let case = &fixtures["new_trigger"]["data1"];
+    let topics = vec![solidity::NewTrigger::SIGNATURE_HASH.to_vec()];
+
+    let current = trigger_compat::decode_log(&topics, &bytes(case, "encoded")).unwrap();
+    assert_eq!(current.format, TriggerFormat::TriggerInfo);
+    assert_eq!(current.trigger_id, case["triggerId"].as_u64().unwrap());
+    assert_eq!(current.creator, case["creator"].as_str().unwrap().parse().ok());
+    assert_eq!(current.data, bytes(case, "data"));
+
+    // Legacy contracts emitted abi.encode(DataWithId) in the same event
+    let legacy = solidity::DataWithId { triggerId: 9, data: bytes(case, "data").into() };
+    let event = solidity::NewTrigger { _triggerInfo: legacy.abi_encode().into() };
+    let decoded = trigger_compat::decode_log(&topics, &event.encode_data()).unwrap();
+    assert_eq!(decoded.format, TriggerFormat::DataWithId);
+    assert_eq!(decoded.trigger_id, 9);
+    assert_eq!(decoded.creator, None);
+    assert_eq!(decoded.data, bytes(case, "data"));
+
+    let other_event = vec![[0u8; 32].to_vec()];
+    assert!(trigger_compat::decode_log(&other_event, &bytes(case, "encoded")).is_err());
+}
+
+#[test]
+fn compat_layer_reads_indexed_fields_from_topics() {
+    let creator: Address = "0x7FA9385bE102ac3EAc297483Dd6233D62b3e1496".parse().unwrap();
+    let event = indexed::NewTrigger { triggerId: 42, creator, data: b"data1".to_vec().into() };
+    let topics: Vec<Vec<u8>> = event.encode_topics().iter().map(|t| t.0.to_vec()).collect();
+
+    let decoded = trigger_compat::decode_log(&topics, &event.encode_data()).unwrap();
+    assert_eq!(decoded.format, TriggerFormat::Indexed);
+    assert_eq!((decoded.trigger_id, decoded.creator), (42, Some(creator)));
+    assert_eq!(decoded.data, b"data1");
+
+    // Topics must hold values of the indexed types
+    let mut too_big = topics.clone();
+    too_big[1][0] = 1;
+    assert!(trigger_compat::decode_log(&too_big, &event.encode_data()).is_err());
+    assert!(trigger_compat::decode_log(&topics[..2], &event.encode_data()).is_err());
+}
@@ -0,0 +1,138 @@
+//! Cached URLs are revalidated with their `ETag` / `Last-Modified`, a `304`
+//! reuses the cached body without counting as a verified signature, and the
+//! least recently used URLs are evicted past the capacity.
+
+use alloy_primitives::hex;
+use common::{
+    http::Response,
+    http_cache::HttpCache,
+    signed_response::{ResponseVerifier, Scheme},
+};
+use hmac::{Hmac, Mac};
+use sha2::Sha256;
+use std::path::PathBuf;
+use wstd::http::{IntoBody, Request};
+
+const URL: &str = "https://api.example.com/price";
+const BODY: &[u8] = br#"{"price":"97234.5"}"#;
+const SECRET: &[u8] = b"shared secret";
+
+fn dir(test: &str) -> PathBuf {
+    std::env::temp_dir().join(format!("http-cache-test-{test}-{}", std::process::id()))
+}
+
+fn get(url: &str) -> Request<impl wstd::http::Body> {
+    Request::get(url).body(Vec::new().into_body()).unwrap()
+}
+
+fn response(status: u16, headers: &[(&str, &str)], body: &[u8]) -> Response {
+    Response {
+        status,
+        headers: headers.iter().map(|(k, v)| (k.to_string(), v.to_string())).collect(),
+        body: body.to_vec(),
+    }
+}
+
+fn signature(body: &[u8]) -> String {
+    let mut mac = Hmac::<Sha256>::new_from_slice(SECRET).unwrap();
+    mac.update(body);
+    hex::encode(mac.finalize().into_bytes())
+}
+
+fn verifier() -> ResponseVerifier {
+    ResponseVerifier::new(Scheme::HmacSha256(SECRET.to_vec()), "X-Signature")
+}
+
+#[test]
+fn not_modified_reuses_the_cached_body() {
+    let dir = dir("etag");
+    let cache = HttpCache::open(&dir, 2).unwrap();
+
+    let mut req = get(URL);
+    let lookup = cache.revalidate(&mut req).unwrap();
+    assert!(req.headers().get("If-None-Match").is_none());
+    let fresh = response(200, &[("etag", "\"v1\""), ("last-modified", "Tue, 14 Oct 2025")], BODY);
+    assert_eq!(cache.complete(lookup, fresh, None).unwrap(), BODY);
+
+    let mut req = get(URL);
+    let lookup = cache.revalidate(&mut req).unwrap();
+    assert_eq!(req.headers()["If-None-Match"], "\"v1\"");
+    assert_eq!(req.headers()["If-Modified-Since"], "Tue, 14 Oct 2025");
+    assert_eq!(cache.complete(lookup, response(304, &[], b""), None).unwrap(), BODY);
+    std::fs::remove_dir_all(dir).unwrap();
+}
+
+#[test]
+fn responses_without_validators_are_not_cached() {
+    let dir = dir("uncached");
+    let cache = HttpCache::open(&dir, 2).unwrap();
+
+    let lookup = cache.revalidate(&mut get(URL)).unwrap();
+    assert_eq!(cache.complete(lookup, response(200, &[], BODY), None).unwrap(), BODY);
+
+    let mut req = get(URL);
+    let lookup = cache.revalidate(&mut req).unwrap();
+    assert!(req.headers().is_empty());
+    let err = cache.complete(lookup, response(304, &[], b""), None).unwrap_err();
+    assert_eq!(err.to_string(), "304 Not Modified without a cached body");
+
+    let lookup = cache.revalidate(&mut get(URL)).unwrap();
+    let err = cache.complete(lookup, response(500, &[], b""), None).unwrap_err();
+    assert_eq!(err.to_string(), "Status: 500");
+    std::fs::remove_dir_all(dir).unwrap();
+}
+
+#[test]
+fn not_modified_bodies_are_audited_unverified() {
+    let dir = dir("audit");
+    let cache = HttpCache::open(&dir, 2).unwrap();
+    let signature = signature(BODY);
+    let signed = [("etag", "\"v1\""), ("x-signature", signature.as_str())];
+
+    let verifier = verifier();
+    let lookup = cache.revalidate(&mut get(URL)).unwrap();
+    cache.complete(lookup, response(200, &signed, BODY), Some(&verifier)).unwrap();
+    assert!(verifier.audit().verified);
+
+    // A later run gets the body from the cache, its signature unchecked
+    let verifier = verifier();
+    let lookup = cache.revalidate(&mut get(URL)).unwrap();
+    let body = cache.complete(lookup, response(304, &[], b""), Some(&verifier)).unwrap();
+    assert_eq!(body, BODY);
+    assert!(!verifier.audit().verified);
+
+    // Bad signatures are never cached
+    let lookup = cache.revalidate(&mut get(URL)).unwrap();
+    let forged = [("etag", "\"v2\""), ("x-signature", signature.as_str())];
+    assert!(cache.complete(lookup, response(200, &forged, b"forged"), Some(&verifier)).is_err());
+    let lookup = cache.revalidate(&mut get(URL)).unwrap();
+    assert_eq!(cache.complete(lookup, response(304, &[], b""), None).unwrap(), BODY);
+    std::fs::remove_dir_all(dir).unwrap();
+}
+
+#[test]
+fn least_recently_used_urls_are_evicted() {
+    let dir = dir("evict");
+    let cache = HttpCache::open(&dir, 2).unwrap();
+    let store = |url: &str| {
+        let lookup = cache.revalidate(&mut get(url)).unwrap();
+        cache.complete(lookup, response(200, &[("etag", "\"v1\"")], url.as_bytes()), None).unwrap();
+    };
+    let cached = |url: &str| {
+        let mut req = get(url);
+        cache.revalidate(&mut req).unwrap();
+        req.headers().contains_key("If-None-Match")
+    };
+
+    store("https://a.example.com");
+    store("https://b.example.com");
+    // Revalidating `a` makes `b` the least recently used
+    let lookup = cache.revalidate(&mut get("https://a.example.com")).unwrap();
+    cache.complete(lookup, response(304, &[], b""), None).unwrap();
+    store("https://c.example.com");
+
+    assert!(cached("https://a.example.com"));
+    assert!(!cached("https://b.example.com"));
+    assert!(cached("https://c.example.com"));
+    std::fs::remove_dir_all(dir).unwrap();
+}
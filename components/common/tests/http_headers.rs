@@ -0,0 +1,92 @@
+//! Header rules resolve per host, render `{unix_time}` and `{env:NAME}`
+//! templates, and secrets rendered into headers stay out of logged text.
+
+use common::{
+    clock::FixedClock,
+    context::RunContext,
+    http_headers::HeaderRules,
+    secret::{self, REDACTED},
+};
+use std::rc::Rc;
+use wstd::http::{IntoBody, Request};
+
+const API_KEY: &str = "sk-header-0123456789";
+
+/// Every test runs with the same API key secret and a config rule that
+/// overrides one default header
+fn configured() {
+    std::env::set_var("WAVS_ENV_HEADERS_TEST_KEY", API_KEY);
+    std::env::set_var("http_headers", r#"{"api.example.com": {"user-agent": "wavs/0.3"}}"#);
+}
+
+fn ctx() -> RunContext {
+    RunContext::background().with_clock(Rc::new(FixedClock::from_unix_secs(1_700_000_000)))
+}
+
+fn get(url: &str) -> Request<impl wstd::http::Body> {
+    Request::get(url).body(Vec::new().into_body()).unwrap()
+}
+
+fn defaults() -> HeaderRules {
+    HeaderRules::new()
+        .with("*", "Accept", "application/json")
+        .with("api.example.com", "User-Agent", "Mozilla/5.0")
+        .with("api.example.com", "Cookie", "session={unix_time}")
+        .with("api.example.com", "X-Api-Key", "{env:WAVS_ENV_HEADERS_TEST_KEY}")
+}
+
+#[test]
+fn config_rules_win_over_defaults() {
+    configured();
+    let rules = HeaderRules::from_env(defaults()).unwrap();
+    let headers = rules.for_host("api.example.com");
+    assert_eq!(headers["user-agent"], "wavs/0.3");
+    assert_eq!(headers["accept"], "application/json");
+    // Other hosts only get the `*` rules
+    assert_eq!(rules.for_host("other.example.com").keys().collect::<Vec<_>>(), ["accept"]);
+}
+
+#[test]
+fn templates_are_rendered() {
+    configured();
+    let mut req = get("https://api.example.com/v1/price");
+    defaults().apply(&mut req, &ctx()).unwrap();
+    assert_eq!(req.headers()["cookie"], "session=1700000000");
+    assert_eq!(req.headers()["x-api-key"], API_KEY);
+
+    let mut req = get("https://other.example.com/v1/price");
+    defaults().apply(&mut req, &ctx()).unwrap();
+    assert!(req.headers().get("x-api-key").is_none());
+}
+
+#[test]
+fn missing_variables_fail_the_request() {
+    let rules =
+        HeaderRules::new().with("*", "Authorization", "Bearer {env:WAVS_ENV_HEADERS_UNSET}");
+    let err = rules.apply(&mut get("https://api.example.com"), &ctx()).unwrap_err();
+    assert_eq!(
+        err.to_string(),
+        "WAVS_ENV_HEADERS_UNSET is not set; add it to the operator's WAVS environment"
+    );
+
+    let rules = HeaderRules::new().with("*", "Cookie", "session={unix_time");
+    assert!(rules.apply(&mut get("https://api.example.com"), &ctx()).is_err());
+    let rules = HeaderRules::new().with("*", "Cookie", "session={block_time}");
+    assert!(rules.apply(&mut get("https://api.example.com"), &ctx()).is_err());
+}
+
+#[test]
+fn rendered_secrets_are_redacted() {
+    configured();
+    let mut req = get("https://api.example.com/v1/price");
+    defaults().apply(&mut req, &ctx()).unwrap();
+    let logged = format!("request failed with headers {:?}", req.headers());
+    assert!(!secret::redact(&logged).contains(API_KEY));
+    assert!(secret::redact(&logged).contains(REDACTED));
+
+    // Invalid values are reported by header name only
+    std::env::set_var("WAVS_ENV_HEADERS_TEST_NEWLINE", "sk-line\nbreak");
+    let rules = HeaderRules::new().with("*", "X-Api-Key", "{env:WAVS_ENV_HEADERS_TEST_NEWLINE}");
+    let err = rules.apply(&mut get("https://api.example.com"), &ctx()).unwrap_err();
+    assert_eq!(err.to_string(), "invalid value for header x-api-key");
+}
@@ -0,0 +1,31 @@
+//! IPFS content is only accepted when it hashes to its CID.
+
+use common::{cid::Cid, ipfs};
+
+const HELLO_CID: &str = "bafkreibm6jg3ux5qumhcn2b3flc3tyu6dmlb4xa7u5bf44yegnrjhc4yeq";
+
+#[test]
+fn matching_content_verifies() {
+    let cid = Cid::parse(HELLO_CID).unwrap();
+    assert!(ipfs::verify(&cid, b"hello").unwrap());
+    assert!(!ipfs::verify(&cid, b"hello!").unwrap());
+}
+
+#[test]
+fn v0_and_v1_verify_the_same_content() {
+    let cid = Cid::parse("QmRN6wdp1S2A5EtjW9A3M1vKSBuQQGcgvuhoMUoEz4iiT5").unwrap();
+    assert!(ipfs::verify(&cid, b"hello").unwrap());
+}
+
+#[test]
+fn unsupported_hash_functions_are_rejected() {
+    // keccak-256
+    let cid = Cid { hash_code: 0x1b, ..Cid::parse(HELLO_CID).unwrap() };
+    assert!(ipfs::verify(&cid, b"hello").is_err());
+}
+
+#[test]
+fn gateways_are_trimmed() {
+    std::env::set_var("ipfs_gateways", " https://a.example/ ,, https://b.example");
+    assert_eq!(ipfs::gateways_from_env(), ["https://a.example", "https://b.example"]);
+}
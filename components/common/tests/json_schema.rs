@@ -0,0 +1,45 @@
+//! Callers must get every invalid field, with its path, in one failure.
+
+use common::{cli_input, json_schema};
+use serde_json::json;
+
+#[test]
+fn reports_every_invalid_field_with_its_path() {
+    let schema = json!({
+        "type": "object",
+        "required": ["token"],
+        "additionalProperties": false,
+        "properties": {
+            "token": { "type": "string", "format": "evm-address" },
+            "block": { "type": "integer", "minimum": 0 },
+            "holders": { "type": "array", "items": { "type": "string", "format": "evm-address" } }
+        }
+    });
+    let request = json!({ "block": -1, "holders": ["0x01", 7], "blocks": 5 });
+
+    let mut errors: Vec<String> =
+        json_schema::errors(&schema, &request).iter().map(ToString::to_string).collect();
+    errors.sort();
+    assert_eq!(
+        errors,
+        [
+            "/block: must be at least 0",
+            "/blocks: unknown field",
+            "/holders/0: expected format evm-address",
+            "/holders/1: expected string, found integer",
+            "/token: required field is missing",
+        ]
+    );
+}
+
+#[test]
+fn cli_request_schema_rejects_misspelled_fields() {
+    let err = cli_input::parse(br#"{"cmd":"price","fromat":"abi"}"#).unwrap_err();
+    assert!(format!("{err:#}").contains("/fromat: unknown field"));
+
+    json_schema::validate(
+        cli_input::REQUEST_SCHEMA,
+        &json!({ "cmd": "price", "args": { "id": 1 }, "format": "abi", "trigger_id": 7 }),
+    )
+    .unwrap();
+}
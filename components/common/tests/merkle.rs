@@ -0,0 +1,49 @@
+//! Roots must match what `@openzeppelin/merkle-tree` computes, so claims can
+//! be verified on-chain with `MerkleProof`.
+
+use alloy_primitives::{address, b256, U256};
+use common::merkle::{self, standard_leaf, MerkleTree};
+
+/// `StandardMerkleTree.of(values, ["address", "uint256"])` from the
+/// @openzeppelin/merkle-tree README
+#[test]
+fn root_matches_standard_merkle_tree() {
+    let values = [
+        (
+            address!("1111111111111111111111111111111111111111"),
+            U256::from(5_000_000_000_000_000_000u64),
+        ),
+        (
+            address!("2222222222222222222222222222222222222222"),
+            U256::from(2_500_000_000_000_000_000u64),
+        ),
+    ];
+    let tree = MerkleTree::new(values.iter().map(standard_leaf).collect()).unwrap();
+    assert_eq!(
+        tree.root(),
+        b256!("d4dee0beab2d53f2cc83e567171bd2820e49898130a22622b10ead383e90bd77")
+    );
+
+    let reversed = MerkleTree::new(values.iter().rev().map(standard_leaf).collect()).unwrap();
+    assert_eq!(reversed.root(), tree.root());
+}
+
+#[test]
+fn empty_tree_is_rejected() {
+    assert!(MerkleTree::new(Vec::new()).is_err());
+}
+
+#[test]
+fn proofs_verify_against_root() {
+    let leaves: Vec<_> = (0u64..7).map(|i| standard_leaf(&(i, U256::from(i * 100)))).collect();
+    let tree = MerkleTree::new(leaves.clone()).unwrap();
+    for leaf in &leaves {
+        let proof = tree.proof(*leaf).unwrap();
+        assert!(merkle::verify(tree.root(), *leaf, &proof));
+    }
+
+    let outsider = standard_leaf(&(7u64, U256::from(700)));
+    assert!(tree.proof(outsider).is_none());
+    let proof = tree.proof(leaves[0]).unwrap();
+    assert!(!merkle::verify(tree.root(), outsider, &proof));
+}
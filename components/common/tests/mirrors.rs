@@ -0,0 +1,89 @@
+//! Mirrors are tried in the configured order, moving on only when a mirror
+//! can't be reached; any answer from a mirror, errors included, is final.
+
+use common::{context::RunContext, http::TransportError, mirrors::Mirrors};
+use futures::executor::block_on;
+use std::cell::RefCell;
+use wstd::http::error::WasiHttpErrorCode;
+
+/// Every test runs with the same mirrors, and a source whose list is empty
+fn configured() {
+    std::env::set_var(
+        "prices_base_urls",
+        "https://a.example.com/, https://b.example.com,,https://c.example.com",
+    );
+    std::env::set_var("empty_base_urls", " , ");
+}
+
+fn refused() -> anyhow::Error {
+    anyhow::Error::new(TransportError(WasiHttpErrorCode::ConnectionRefused))
+}
+
+/// Fetches `/v1/price` with `answer` per URL, returning the result and the
+/// URLs requested
+fn fetch(answer: impl Fn(&str) -> anyhow::Result<String>) -> (anyhow::Result<String>, Vec<String>) {
+    configured();
+    let mirrors = Mirrors::from_env("prices", "https://default.example.com").unwrap();
+    let requested = RefCell::new(Vec::new());
+    let result = block_on(mirrors.fetch(&RunContext::background(), "/v1/price", |url| {
+        requested.borrow_mut().push(url.clone());
+        let answer = answer(&url);
+        async move { answer }
+    }));
+    (result, requested.into_inner())
+}
+
+#[test]
+fn mirrors_are_read_in_order() {
+    configured();
+    assert_eq!(
+        Mirrors::from_env("prices", "https://default.example.com").unwrap().bases,
+        ["https://a.example.com", "https://b.example.com", "https://c.example.com"]
+    );
+    assert_eq!(
+        Mirrors::from_env("unset", "https://default.example.com").unwrap().bases,
+        ["https://default.example.com"]
+    );
+    assert_eq!(
+        Mirrors::from_env("empty", "https://default.example.com").unwrap_err().to_string(),
+        "empty_base_urls is empty"
+    );
+}
+
+#[test]
+fn unreachable_mirrors_fail_over_in_order() {
+    let answer = |url: &str| match url {
+        "https://a.example.com/v1/price" => Err(refused()),
+        url => Ok(url.to_string()),
+    };
+    let (result, requested) = fetch(answer);
+    assert_eq!(result.unwrap(), "https://b.example.com/v1/price");
+    assert_eq!(requested, ["https://a.example.com/v1/price", "https://b.example.com/v1/price"]);
+}
+
+#[test]
+fn answers_are_not_failed_over() {
+    let (result, requested) = fetch(|_| Err(anyhow::anyhow!("Status: 404")));
+    assert_eq!(result.unwrap_err().to_string(), "Status: 404");
+    assert_eq!(requested, ["https://a.example.com/v1/price"]);
+
+    // A transport error that isn't a connection failure is final too
+    let (result, requested) =
+        fetch(|_| Err(anyhow::Error::new(TransportError(WasiHttpErrorCode::HttpRequestDenied))));
+    assert!(result.is_err());
+    assert_eq!(requested.len(), 1);
+}
+
+#[test]
+fn last_error_is_returned_when_every_mirror_is_down() {
+    let (result, requested) = fetch(|_| Err(refused()));
+    assert!(result.unwrap_err().is::<TransportError>());
+    assert_eq!(
+        requested,
+        [
+            "https://a.example.com/v1/price",
+            "https://b.example.com/v1/price",
+            "https://c.example.com/v1/price"
+        ]
+    );
+}
@@ -0,0 +1,93 @@
+//! Every component's result is encoded the same way: the JSON envelope for
+//! the CLI, and for submissions the ABI envelope in `DataWithId`, with the
+//! `max_output_bytes` limit counting the whole submitted output.
+
+use alloy_primitives::{Bytes, B256};
+use alloy_sol_types::SolValue;
+use common::{
+    batch::BATCH_TRIGGER_ID,
+    envelope::{ComponentInfo, FLAG_MARKET_CLOSED, FLAG_SIZE_LIMITED},
+    output::{self, Computed},
+    output_limit::FLAG_TRUNCATED,
+    types::Destination,
+};
+use serde_json::Value;
+
+const COMPONENT: ComponentInfo = ComponentInfo { name: "test-component", version: "0.1.0" };
+
+const MAX_OUTPUT_BYTES: usize = 1024;
+
+/// Every test runs with the same limit, small results fit it
+fn limited() {
+    std::env::set_var("max_output_bytes", MAX_OUTPUT_BYTES.to_string());
+    std::env::set_var("oversize_policy", "truncate");
+}
+
+type AbiEnvelope = (u16, String, String, String, u32, u8, B256, Bytes);
+
+/// Trigger ID and envelope of a submitted output
+fn decode(output: &[u8]) -> (u64, AbiEnvelope) {
+    let (trigger_id, data) = <(u64, Bytes)>::abi_decode(output, true).unwrap();
+    (trigger_id, AbiEnvelope::abi_decode(&data, true).unwrap())
+}
+
+#[test]
+fn submissions_are_enveloped_data_with_id() {
+    limited();
+    let result = Computed::new("price:1", vec![0xab; 64]).with_flags(FLAG_MARKET_CLOSED);
+    let output = output::encode(COMPONENT, 7, Destination::Ethereum, &result).unwrap();
+
+    let (trigger_id, (version, name, component_version, feed_id, flags, _, _, payload)) =
+        decode(&output);
+    assert_eq!(trigger_id, 7);
+    assert_eq!(version, 1);
+    assert_eq!((name.as_str(), component_version.as_str()), ("test-component", "0.1.0"));
+    assert_eq!(feed_id, "price:1");
+    assert_eq!(flags, FLAG_MARKET_CLOSED);
+    assert_eq!(payload.to_vec(), vec![0xab; 64]);
+}
+
+#[test]
+fn cli_output_is_the_json_envelope() {
+    limited();
+    let result = Computed::new("price:1", br#"{"price":"1.5"}"#.to_vec());
+    let output = output::encode(COMPONENT, 7, Destination::CliOutput, &result).unwrap();
+
+    let json: Value = serde_json::from_slice(&output).unwrap();
+    assert_eq!(json["component"], "test-component");
+    assert_eq!(json["feed_id"], "price:1");
+    assert_eq!(json["flags"], 0);
+    assert_eq!(json["payload"]["price"], "1.5");
+}
+
+#[test]
+fn oversized_submissions_follow_the_policy() {
+    limited();
+    let result = Computed::new("price:1", vec![0xab; 2 * MAX_OUTPUT_BYTES]);
+    let output = output::encode(COMPONENT, 7, Destination::Ethereum, &result).unwrap();
+    assert!(output.len() <= MAX_OUTPUT_BYTES, "{} bytes", output.len());
+
+    let (_, (_, _, _, _, flags, _, _, payload)) = decode(&output);
+    assert_eq!(flags, FLAG_SIZE_LIMITED);
+    assert_eq!(payload[0], FLAG_TRUNCATED);
+    assert!(payload[1..].iter().all(|b| *b == 0xab));
+}
+
+#[test]
+fn cli_output_is_not_limited() {
+    limited();
+    let payload = format!(r#"{{"data":"{}"}}"#, "a".repeat(2 * MAX_OUTPUT_BYTES));
+    let result = Computed::new("price:1", payload.into_bytes());
+    let output = output::encode(COMPONENT, 7, Destination::CliOutput, &result).unwrap();
+
+    let json: Value = serde_json::from_slice(&output).unwrap();
+    assert_eq!(json["flags"], 0);
+    assert_eq!(json["payload"]["data"].as_str().unwrap().len(), 2 * MAX_OUTPUT_BYTES);
+}
+
+#[test]
+fn batch_trigger_id_is_not_submitted_alone() {
+    limited();
+    let result = Computed::new("price:1", vec![0xab; 32]);
+    assert!(output::encode(COMPONENT, BATCH_TRIGGER_ID, Destination::Ethereum, &result).is_err());
+}
@@ -0,0 +1,63 @@
+//! Payloads above the compression threshold are compressed with the
+//! configured codec, smaller ones stay raw, and limits hold for the encoded
+//! output.
+
+use alloy_primitives::Bytes;
+use alloy_sol_types::SolValue;
+use common::output_limit::{Codec, OversizePolicy, SizeLimit, FLAG_COMPRESSED, FLAG_GZIP};
+use flate2::read::{DeflateDecoder, GzDecoder};
+use std::io::Read;
+
+fn limit(max_bytes: Option<usize>, compress_above: Option<usize>, codec: Codec) -> SizeLimit {
+    SizeLimit { max_bytes, policy: OversizePolicy::Error, compress_above, codec }
+}
+
+fn batch() -> Vec<u8> {
+    let rows: Vec<String> =
+        (0..200).map(|i| format!("{{\"id\":{i},\"price\":\"1.00\"}}")).collect();
+    format!("[{}]", rows.join(",")).into_bytes()
+}
+
+#[test]
+fn small_payloads_stay_raw() {
+    let limit = limit(None, Some(256), Codec::Gzip);
+    let payload = br#"{"symbol":"BTC","price":97234.5}"#.to_vec();
+    assert!(!limit.modifies(payload.len()));
+    assert_eq!(limit.apply(payload.clone()).unwrap(), payload);
+}
+
+#[test]
+fn large_payloads_carry_their_codec() {
+    let payload = batch();
+
+    let gzipped = limit(None, Some(256), Codec::Gzip).apply(payload.clone()).unwrap();
+    assert_eq!(gzipped[0], FLAG_GZIP);
+    let mut out = Vec::new();
+    GzDecoder::new(&gzipped[1..]).read_to_end(&mut out).unwrap();
+    assert_eq!(out, payload);
+
+    let deflated = limit(None, Some(256), Codec::Deflate).apply(payload.clone()).unwrap();
+    assert_eq!(deflated[0], FLAG_COMPRESSED);
+    let mut out = Vec::new();
+    DeflateDecoder::new(&deflated[1..]).read_to_end(&mut out).unwrap();
+    assert_eq!(out, payload);
+}
+
+#[test]
+fn compressed_payloads_must_still_fit() {
+    let payload = batch();
+    assert!(limit(Some(64), Some(256), Codec::Deflate).apply(payload.clone()).is_err());
+    assert!(limit(Some(payload.len()), Some(256), Codec::Deflate).apply(payload).is_ok());
+}
+
+#[test]
+fn limits_count_the_encoded_output() {
+    let encoded = |payload: Vec<u8>| (7u64, Bytes::from(payload)).abi_encode();
+    let overhead = encoded(Vec::new()).len();
+    let payload_limit = limit(Some(300), None, Codec::Deflate).for_encoding(overhead).unwrap();
+    for len in 0..=300 {
+        let fits = encoded(vec![0xab; len]).len() <= 300;
+        assert_eq!(!payload_limit.modifies(len), fits, "payload of {len} bytes");
+    }
+    assert!(limit(Some(64), None, Codec::Deflate).for_encoding(overhead).is_err());
+}
@@ -0,0 +1,110 @@
+//! Pages are followed until one has no successor or the page cap is hit, and
+//! a listing that hands back the page it was asked for is an error.
+
+use anyhow::Result;
+use common::{
+    context::RunContext,
+    paginate::{Page, PageRequest, Paginator},
+};
+use futures::executor::block_on;
+use std::cell::RefCell;
+
+/// Item numbers `0..total`, served `limit` at a time from `offset`
+fn numbers(request: &PageRequest, total: usize) -> Page<usize> {
+    let PageRequest::Offset { offset, limit } = *request else {
+        panic!("expected an offset request, got {request:?}");
+    };
+    Page::at_offset((offset..total.min(offset + limit)).collect(), request)
+}
+
+#[test]
+fn short_offset_page_ends_the_listing() {
+    let requests = RefCell::new(Vec::new());
+    let listing = block_on(Paginator::default().collect(
+        &RunContext::background(),
+        PageRequest::offsets(4),
+        |request| {
+            requests.borrow_mut().push(request.clone());
+            let page = numbers(&request, 10);
+            async move { anyhow::Ok(page) }
+        },
+    ))
+    .unwrap();
+
+    assert_eq!(listing.items, (0..10).collect::<Vec<_>>());
+    assert_eq!((listing.pages, listing.complete), (3, true));
+    assert_eq!(
+        requests.into_inner(),
+        [
+            PageRequest::Offset { offset: 0, limit: 4 },
+            PageRequest::Offset { offset: 4, limit: 4 },
+            PageRequest::Offset { offset: 8, limit: 4 },
+        ]
+    );
+}
+
+#[test]
+fn full_last_page_takes_one_empty_request() {
+    let listing = block_on(Paginator::default().collect(
+        &RunContext::background(),
+        PageRequest::offsets(5),
+        |request| {
+            let page = numbers(&request, 10);
+            async move { anyhow::Ok(page) }
+        },
+    ))
+    .unwrap();
+    assert_eq!((listing.items.len(), listing.pages, listing.complete), (10, 3, true));
+}
+
+#[test]
+fn empty_cursor_ends_the_listing() {
+    let fetch = |request: PageRequest| async move {
+        anyhow::Ok(match request {
+            PageRequest::First => Page::with_cursor(vec!["a", "b"], Some("page2".to_string())),
+            PageRequest::Cursor(cursor) if cursor == "page2" => {
+                Page::with_cursor(vec!["c"], Some(String::new()))
+            }
+            other => panic!("unexpected request {other:?}"),
+        })
+    };
+    let listing = block_on(Paginator::default().collect(
+        &RunContext::background(),
+        PageRequest::First,
+        fetch,
+    ))
+    .unwrap();
+    assert_eq!(listing.items, ["a", "b", "c"]);
+    assert_eq!((listing.pages, listing.complete), (2, true));
+
+    assert_eq!(Page::<u8>::with_cursor(Vec::new(), None).next, None);
+}
+
+#[test]
+fn page_cap_leaves_the_listing_incomplete() {
+    let calls = RefCell::new(0);
+    let paginator = Paginator { max_pages: 3 };
+    let listing =
+        block_on(paginator.collect(&RunContext::background(), PageRequest::First, |_| {
+            *calls.borrow_mut() += 1;
+            let page = *calls.borrow();
+            async move { anyhow::Ok(Page::with_cursor(vec![page], Some(format!("after{page}")))) }
+        }))
+        .unwrap();
+    assert_eq!(listing.items, [1, 2, 3]);
+    assert_eq!((listing.pages, listing.complete), (3, false));
+    assert_eq!(calls.into_inner(), 3);
+}
+
+#[test]
+fn repeated_cursor_is_an_error() {
+    let result: Result<_> = block_on(Paginator::default().collect(
+        &RunContext::background(),
+        PageRequest::Cursor("stuck".to_string()),
+        |_| async { anyhow::Ok(Page::with_cursor(vec![1], Some("stuck".to_string()))) },
+    ));
+    assert_eq!(
+        result.unwrap_err().to_string(),
+        r#"pagination did not advance past Cursor("stuck")"#
+    );
+}
@@ -0,0 +1,18 @@
+//! Natively, where panics unwind, a panic comes back as the `run` error with
+//! its location; wasm components abort instead, see the module docs.
+
+use common::panic_guard::catch;
+
+#[test]
+fn panics_become_errors() {
+    let err = catch::<()>(|| panic!("index {} out of range", 3)).unwrap_err();
+    assert!(err.starts_with("panic at "), "{err}");
+    assert!(err.contains("tests/panic_guard.rs"), "{err}");
+    assert!(err.contains("index 3 out of range"), "{err}");
+}
+
+#[test]
+fn results_pass_through() {
+    assert_eq!(catch(|| Ok::<_, String>(7)), Ok(7));
+    assert_eq!(catch::<()>(|| Err("no data".to_string())), Err("no data".to_string()));
+}
@@ -0,0 +1,33 @@
+//! Hashes must match circomlib's `Poseidon(n)` so commitments can be
+//! recomputed inside circuits.
+
+use alloy_primitives::{uint, U256};
+use common::poseidon;
+
+#[test]
+fn matches_circomlib() {
+    let cases: [(&[U256], U256); 3] = [
+        (
+            &[uint!(1_U256)],
+            uint!(0x29176100eaa962bdc1fe6c654d6a3c130e96a4d1168b33848b897dc502820133_U256),
+        ),
+        (
+            &[uint!(1_U256), uint!(2_U256)],
+            uint!(0x115cc0f5e7d690413df64c6b9662e9cf2a3617f2743245519e19607a4417189a_U256),
+        ),
+        (
+            &[uint!(1_U256), uint!(2_U256), uint!(3_U256), uint!(4_U256)],
+            uint!(0x299c867db6c1fdd79dcefa40e4510b9837e60ebb1ce0663dbaa525df65250465_U256),
+        ),
+    ];
+    for (inputs, expected) in cases {
+        assert_eq!(poseidon::hash(inputs).unwrap(), expected);
+    }
+}
+
+#[test]
+fn rejects_out_of_field_inputs() {
+    assert!(poseidon::hash(&[poseidon::MODULUS]).is_err());
+    assert!(poseidon::hash(&[]).is_err());
+    assert!(poseidon::hash(&[U256::ZERO; poseidon::MAX_INPUTS + 1]).is_err());
+}
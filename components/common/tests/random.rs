@@ -0,0 +1,76 @@
+//! The seed must match what a contract computes, and every draw must be a
+//! pure function of it.
+
+use alloy_primitives::{b256, Bytes, B256};
+use common::{
+    crypto::keccak256_packed,
+    random::{seed, SeededRng},
+};
+
+const BLOCK_HASH: B256 = b256!("88e96d4537bea4d9c05d12549907b32561d3bf31f45aae734cdc119f13406cb6");
+
+/// `keccak256(abi.encodePacked("wavs-seed-v1", uint64(7), blockHash, payload))`
+#[test]
+fn seed_matches_solidity_packing() {
+    let payload = b"price:1".to_vec();
+    let expected = keccak256_packed(&(
+        "wavs-seed-v1".to_string(),
+        7u64,
+        BLOCK_HASH,
+        Bytes::from(payload.clone()),
+    ));
+    assert_eq!(seed(7, BLOCK_HASH, &payload), expected);
+}
+
+#[test]
+fn seed_depends_on_every_field() {
+    let base = seed(7, BLOCK_HASH, b"a");
+    assert_ne!(seed(8, BLOCK_HASH, b"a"), base);
+    assert_ne!(seed(7, B256::ZERO, b"a"), base);
+    assert_ne!(seed(7, BLOCK_HASH, b"b"), base);
+}
+
+#[test]
+fn draws_repeat_for_the_same_seed() {
+    let seed = seed(7, BLOCK_HASH, b"a");
+    let draws = |mut rng: SeededRng| (0..10).map(|_| rng.next_u64()).collect::<Vec<_>>();
+    assert_eq!(draws(SeededRng::new(seed)), draws(SeededRng::new(seed)));
+}
+
+#[test]
+fn below_stays_in_range() {
+    let mut rng = SeededRng::new(seed(1, B256::ZERO, b""));
+    let mut seen = [false; 5];
+    for _ in 0..200 {
+        let draw = rng.below(5);
+        assert!(draw < 5);
+        seen[draw as usize] = true;
+    }
+    assert!(seen.iter().all(|s| *s));
+    assert_eq!(rng.below(1), 0);
+}
+
+#[test]
+fn sample_picks_distinct_indices() {
+    let mut rng = SeededRng::new(seed(1, B256::ZERO, b""));
+    let mut sample = rng.sample_indices(10, 4);
+    assert_eq!(sample.len(), 4);
+    sample.sort();
+    sample.dedup();
+    assert_eq!(sample.len(), 4);
+    assert!(sample.iter().all(|i| *i < 10));
+
+    let mut all = rng.sample_indices(3, 5);
+    all.sort();
+    assert_eq!(all, vec![0, 1, 2]);
+}
+
+#[test]
+fn shuffle_is_a_permutation() {
+    let mut rng = SeededRng::new(seed(2, B256::ZERO, b""));
+    let mut items: Vec<u32> = (0..20).collect();
+    rng.shuffle(&mut items);
+    let mut sorted = items.clone();
+    sorted.sort();
+    assert_eq!(sorted, (0..20).collect::<Vec<_>>());
+}
@@ -0,0 +1,24 @@
+//! Redelivered triggers get their stored result, but only for the same data,
+//! and old trigger IDs fall out of the window.
+
+use common::result_cache::ResultCache;
+
+#[test]
+fn results_are_keyed_by_trigger_and_data() {
+    let dir = std::env::temp_dir().join(format!("result-cache-test-{}", std::process::id()));
+    let cache = ResultCache::open(&dir, 2).unwrap();
+
+    cache.put(1, b"price:1", b"first").unwrap();
+    assert_eq!(cache.get(1, b"price:1"), Some(b"first".to_vec()));
+    // The same trigger ID with another payload is another request
+    assert_eq!(cache.get(1, b"price:2"), None);
+    assert_eq!(cache.get(2, b"price:1"), None);
+
+    cache.put(2, b"price:1", b"second").unwrap();
+    assert_eq!(cache.get(1, b"price:1"), Some(b"first".to_vec()));
+    cache.put(3, b"price:1", b"third").unwrap();
+    assert_eq!(cache.get(1, b"price:1"), None);
+    assert_eq!(cache.get(2, b"price:1"), Some(b"second".to_vec()));
+    assert_eq!(cache.get(3, b"price:1"), Some(b"third".to_vec()));
+    std::fs::remove_dir_all(dir).unwrap();
+}
@@ -0,0 +1,62 @@
+//! Prices outside the configured bounds, and numbers that are not finite,
+//! fail with `SANITY_CHECK_FAILED` before anything is encoded.
+
+use common::{
+    sanity::{self, PriceBounds, DEFAULT_MAX_PRICE, DEFAULT_MIN_PRICE},
+    types::ErrorCode,
+};
+
+/// Every test runs with the same bounds
+fn configured() {
+    std::env::set_var("sanity_min_price", "0.01");
+    std::env::set_var("sanity_max_price", "1000");
+}
+
+fn code<T: std::fmt::Debug>(result: anyhow::Result<T>) -> Option<ErrorCode> {
+    ErrorCode::of(&result.unwrap_err().to_string())
+}
+
+#[test]
+fn bounds_are_read_from_config() {
+    configured();
+    assert_eq!(PriceBounds::from_env().unwrap(), PriceBounds { min: 0.01, max: 1000.0 });
+    assert_eq!(
+        PriceBounds::default(),
+        PriceBounds { min: DEFAULT_MIN_PRICE, max: DEFAULT_MAX_PRICE }
+    );
+}
+
+#[test]
+fn prices_within_bounds_pass() {
+    configured();
+    let bounds = PriceBounds::from_env().unwrap();
+    assert_eq!(bounds.check("ETH", 999.5).unwrap(), 999.5);
+    // Both bounds are inclusive
+    assert_eq!(bounds.check("ETH", 0.01).unwrap(), 0.01);
+    assert_eq!(bounds.check("ETH", 1000.0).unwrap(), 1000.0);
+}
+
+#[test]
+fn prices_outside_bounds_fail() {
+    configured();
+    let bounds = PriceBounds::from_env().unwrap();
+    let err = bounds.check("ETH", 1000.5).unwrap_err().to_string();
+    assert_eq!(err, "SANITY_CHECK_FAILED: price 1000.5 of ETH is outside 0.01 to 1000");
+    for price in [0.001, 0.0, -1.0] {
+        assert_eq!(code(bounds.check("ETH", price)), Some(ErrorCode::SanityCheckFailed));
+    }
+}
+
+#[test]
+fn non_finite_numbers_fail() {
+    let bounds = PriceBounds::default();
+    for value in [f64::NAN, f64::INFINITY, f64::NEG_INFINITY] {
+        assert_eq!(code(bounds.check("ETH", value)), Some(ErrorCode::SanityCheckFailed));
+        assert_eq!(code(sanity::finite("volume", value)), Some(ErrorCode::SanityCheckFailed));
+    }
+    assert_eq!(
+        sanity::finite("volume", "NaN".parse().unwrap()).unwrap_err().to_string(),
+        "SANITY_CHECK_FAILED: volume is NaN"
+    );
+    assert_eq!(sanity::finite("volume", -3.5).unwrap(), -3.5);
+}
@@ -0,0 +1,32 @@
+//! Loaded secrets must not leak through formatting or error text.
+
+use common::{
+    panic_guard,
+    secret::{redact, Secret, REDACTED},
+};
+
+#[test]
+fn debug_hides_the_value() {
+    let secret = Secret::new("sk-live-0123456789");
+    assert_eq!(format!("{secret:?}"), format!("Secret({REDACTED})"));
+    assert_eq!(secret.expose(), "sk-live-0123456789");
+}
+
+#[test]
+fn redact_scrubs_plain_and_percent_encoded_values() {
+    Secret::new("p@ss word/1");
+    let url = "https://example.com/v1?key=p%40ss%20word%2F1&q=1";
+    assert_eq!(redact(url), format!("https://example.com/v1?key={REDACTED}&q=1"));
+    assert_eq!(redact("auth failed for p@ss word/1"), format!("auth failed for {REDACTED}"));
+    // Too short to scrub without mangling unrelated text
+    Secret::new("abc");
+    assert_eq!(redact("abcdef"), "abcdef");
+}
+
+#[test]
+fn run_errors_are_redacted() {
+    let key = Secret::new("0xfeedfacecafebeef");
+    let result: Result<(), String> =
+        panic_guard::catch(|| Err(format!("GET /price?apiKey={} failed", key.expose())));
+    assert_eq!(result.unwrap_err(), format!("GET /price?apiKey={REDACTED} failed"));
+}
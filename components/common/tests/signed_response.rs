@@ -0,0 +1,45 @@
+//! Only a signature that was actually checked may be audited as verified.
+
+use alloy_primitives::hex;
+use common::{
+    http::Response,
+    signed_response::{ResponseVerifier, Scheme},
+};
+use hmac::{Hmac, Mac};
+use sha2::Sha256;
+
+const SECRET: &[u8] = b"shared secret";
+const BODY: &[u8] = br#"{"price":"97234.5"}"#;
+
+fn response(signature: &str) -> Response {
+    Response {
+        status: 200,
+        headers: vec![("x-signature".to_string(), signature.to_string())],
+        body: BODY.to_vec(),
+    }
+}
+
+fn verifier() -> ResponseVerifier {
+    ResponseVerifier::new(Scheme::HmacSha256(SECRET.to_vec()), "X-Signature")
+}
+
+#[test]
+fn invalid_signatures_are_not_verified() {
+    let verifier = verifier();
+    assert!(!verifier.audit().verified);
+    assert!(verifier.verify_response(&response(&"ab".repeat(32))).is_err());
+    assert!(!verifier.audit().verified);
+}
+
+#[test]
+fn valid_signatures_are_verified() {
+    let mut mac = Hmac::<Sha256>::new_from_slice(SECRET).unwrap();
+    mac.update(BODY);
+    let signature = format!("sha256={}", hex::encode(mac.finalize().into_bytes()));
+
+    let verifier = verifier();
+    verifier.verify_response(&response(&signature)).unwrap();
+    let audit = verifier.audit();
+    assert_eq!(audit.scheme, "hmac-sha256");
+    assert!(audit.verified);
+}
@@ -0,0 +1,77 @@
+use alloy_primitives::{address, b256, eip191_hash_message};
+use common::signer::{result_hash, ResultSigner, SigningDomain};
+use k256::ecdsa::{RecoveryId, Signature, VerifyingKey};
+
+const LOCAL: SigningDomain = SigningDomain {
+    chain_id: 31337,
+    verifying_contract: address!("5FbDB2315678afecb367f032d93F642f64180aa3"),
+};
+
+fn signer() -> ResultSigner {
+    let mut key = [0u8; 32];
+    key[31] = 1;
+    ResultSigner::from_bytes(&key).unwrap()
+}
+
+#[test]
+fn address_of_known_key() {
+    assert_eq!(signer().address(), address!("7E5F4552091A69125d5DfCb7b8C2659029395Bdf"));
+}
+
+/// What `ECDSA.recover(MessageHashUtils.toEthSignedMessageHash(hash), sig)` does
+#[test]
+fn signature_recovers_to_signer() {
+    let signer = signer();
+    let hash = result_hash(&LOCAL, 7, b"payload");
+    let signature = signer.sign_hash(hash).unwrap();
+
+    let digest = eip191_hash_message(hash);
+    let recovery_id = RecoveryId::from_byte(signature[64] - 27).unwrap();
+    let key = VerifyingKey::recover_from_prehash(
+        digest.as_slice(),
+        &Signature::from_slice(&signature[..64]).unwrap(),
+        recovery_id,
+    )
+    .unwrap();
+    let point = key.to_encoded_point(false);
+    let recovered = &common::crypto::keccak256(&point.as_bytes()[1..])[12..];
+    assert_eq!(recovered, signer.address().as_slice());
+}
+
+#[test]
+fn result_hash_binds_chain_and_contract() {
+    assert_eq!(
+        result_hash(&LOCAL, 7, b"payload"),
+        b256!("4788b48632931c1e208ad520de5706f719edfb4e7447b1cf765f1b688c3b225b")
+    );
+
+    let other_chain = SigningDomain { chain_id: 1, ..LOCAL };
+    assert_ne!(result_hash(&other_chain, 7, b"payload"), result_hash(&LOCAL, 7, b"payload"));
+    let other_contract = SigningDomain {
+        verifying_contract: address!("0000000000000000000000000000000000000001"),
+        ..LOCAL
+    };
+    assert_ne!(result_hash(&other_contract, 7, b"payload"), result_hash(&LOCAL, 7, b"payload"));
+}
+
+#[test]
+fn domain_is_read_from_config() {
+    assert!(SigningDomain::from_env().is_err());
+
+    std::env::set_var("signing_network", "local");
+    std::env::set_var(
+        "address_book",
+        r#"{"local":{"chain_id":31337,"submit_address":"0x5FbDB2315678afecb367f032d93F642f64180aa3"}}"#,
+    );
+    assert_eq!(SigningDomain::from_env().unwrap(), LOCAL);
+
+    // Explicit settings win over the address book
+    std::env::set_var("signing_contract", "0x0000000000000000000000000000000000000001");
+    assert!(SigningDomain::from_env().is_err());
+    std::env::set_var("signing_chain_id", "1");
+    let domain = SigningDomain::from_env().unwrap();
+    assert_eq!(
+        (domain.chain_id, domain.verifying_contract),
+        (1, address!("0000000000000000000000000000000000000001"))
+    );
+}
@@ -0,0 +1,50 @@
+//! Shared trigger decoding: CLI input is routed by its requested format, and
+//! no single trigger may use the ID reserved for batches.
+
+use alloy_primitives::Bytes;
+use alloy_sol_types::SolValue;
+use common::{
+    batch::BATCH_TRIGGER_ID,
+    trigger,
+    types::{Destination, ErrorCode},
+};
+
+const COMMANDS: &[&str] = &["price"];
+
+#[test]
+fn cli_format_selects_destination() {
+    let json =
+        trigger::decode_raw(br#"{"cmd":"price","args":"1","trigger_id":7}"#, COMMANDS).unwrap();
+    assert_eq!(json.trigger_id, 7);
+    assert_eq!(json.data, b"1");
+    assert_eq!(json.destination, Destination::CliOutput);
+    assert_eq!(json.block, None);
+
+    let abi =
+        trigger::decode_raw(br#"{"cmd":"price","args":"1","format":"abi"}"#, COMMANDS).unwrap();
+    assert_eq!(abi.destination, Destination::Ethereum);
+}
+
+#[test]
+fn unknown_command_is_an_invalid_request() {
+    let err = trigger::decode_raw(br#"{"cmd":"nope"}"#, COMMANDS).unwrap_err();
+    assert_eq!(ErrorCode::of(&err.to_string()), Some(ErrorCode::InvalidRequest));
+}
+
+#[test]
+fn batch_trigger_id_is_refused() {
+    let request = format!(r#"{{"cmd":"price","args":"1","trigger_id":{BATCH_TRIGGER_ID}}}"#);
+    let err = trigger::decode_raw(request.as_bytes(), COMMANDS).unwrap_err();
+    assert_eq!(ErrorCode::of(&err.to_string()), Some(ErrorCode::InvalidRequest));
+
+    assert!(trigger::check_trigger_id(BATCH_TRIGGER_ID).is_err());
+    assert!(trigger::check_trigger_id(BATCH_TRIGGER_ID - 1).is_ok());
+}
+
+#[test]
+fn output_is_data_with_id() {
+    let encoded = trigger::encode_output(7, b"abc");
+    let (trigger_id, data) = <(u64, Bytes)>::abi_decode(&encoded, true).unwrap();
+    assert_eq!(trigger_id, 7);
+    assert_eq!(data.as_ref(), b"abc");
+}
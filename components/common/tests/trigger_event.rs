@@ -0,0 +1,129 @@
+//! Configured trigger events, in Solidity syntax or as JSON ABI, must decode
+//! the logs contracts emit for them.
+
+use alloy_primitives::{Address, Bytes};
+use alloy_sol_types::SolEvent;
+use common::{abi::AbiType, trigger_compat::TriggerFormat, trigger_event::EventDescriptor};
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        event OrderPlaced(uint64 indexed orderId, address indexed buyer, string note, uint256 amount);
+        event Ping(uint32 id, bytes payload) anonymous;
+    }
+}
+
+fn topics<E: SolEvent>(event: &E) -> Vec<Vec<u8>> {
+    event.encode_topics().iter().map(|t| t.0.to_vec()).collect()
+}
+
+#[test]
+fn descriptor_parses_solidity_syntax() {
+    let event = EventDescriptor::parse(
+        "event OrderPlaced(uint64 indexed triggerId, address indexed creator, string data, uint256);",
+    )
+    .unwrap();
+    assert_eq!(event.signature(), "OrderPlaced(uint64,address,string,uint256)");
+    assert_eq!(event.topic0(), Some(solidity::OrderPlaced::SIGNATURE_HASH));
+    assert_eq!(event.params[3].ty, AbiType::Uint(256));
+    assert!(event.params[1].indexed && !event.params[2].indexed);
+
+    let anonymous = EventDescriptor::parse("Ping(uint32 triggerId, bytes data) anonymous").unwrap();
+    assert_eq!(anonymous.topic0(), None);
+
+    for invalid in [
+        "Missing(uint64 triggerId)",
+        "WideId(uint128 triggerId, bytes data)",
+        "HashedData(uint64 triggerId, bytes indexed data)",
+        "BadCreator(uint64 triggerId, bytes data, uint256 creator)",
+        "Trailing(uint64 triggerId, bytes data) indexed",
+        "TooMany(uint8 indexed a, uint8 indexed b, uint8 indexed c, uint64 indexed triggerId, bytes data)",
+    ] {
+        assert!(EventDescriptor::parse(invalid).is_err(), "{invalid}");
+    }
+}
+
+#[test]
+fn non_standard_event_reads_topics_and_data() {
+    let buyer: Address = "0x7FA9385bE102ac3EAc297483Dd6233D62b3e1496".parse().unwrap();
+    let log = solidity::OrderPlaced {
+        orderId: 42,
+        buyer,
+        note: "BTC".to_string(),
+        amount: alloy_primitives::U256::from(5),
+    };
+    let event = EventDescriptor::parse(
+        "OrderPlaced(uint64 indexed triggerId, address indexed creator, string data, uint256 amount)",
+    )
+    .unwrap();
+
+    let decoded = event.decode_log(&topics(&log), &log.encode_data()).unwrap();
+    assert_eq!(decoded.format, TriggerFormat::Configured);
+    assert_eq!((decoded.trigger_id, decoded.creator), (42, Some(buyer)));
+    assert_eq!(decoded.data, b"BTC");
+
+    // Another event's log
+    let ping = solidity::Ping { id: 1, payload: Bytes::from_static(b"x") };
+    assert!(event.decode_log(&topics(&ping), &ping.encode_data()).is_err());
+}
+
+#[test]
+fn anonymous_event_has_no_topic0() {
+    let log = solidity::Ping { id: 7, payload: Bytes::from_static(b"\x00\x01") };
+    assert!(topics(&log).is_empty());
+
+    let event = EventDescriptor::parse("Ping(uint32 triggerId, bytes data) anonymous").unwrap();
+    let decoded = event.decode_log(&[], &log.encode_data()).unwrap();
+    assert_eq!((decoded.trigger_id, decoded.creator, decoded.data), (7, None, vec![0, 1]));
+
+    // An unexpected topic means a different event
+    assert!(event.decode_log(&[vec![0; 32]], &log.encode_data()).is_err());
+}
+
+#[test]
+fn json_abi_builds_the_same_descriptor() {
+    let abi = r#"[
+        {"type": "function", "name": "placeOrder", "inputs": []},
+        {"type": "event", "name": "Other", "inputs": [], "anonymous": false},
+        {
+            "type": "event",
+            "name": "OrderPlaced",
+            "inputs": [
+                {"name": "triggerId", "type": "uint64", "indexed": true},
+                {"name": "creator", "type": "address", "indexed": true},
+                {"name": "data", "type": "string", "indexed": false},
+                {"name": "amount", "type": "uint256", "indexed": false}
+            ],
+            "anonymous": false
+        }
+    ]"#;
+    let from_abi = EventDescriptor::from_abi_json(abi, Some("OrderPlaced")).unwrap();
+    let from_solidity = EventDescriptor::parse(
+        "OrderPlaced(uint64 indexed triggerId, address indexed creator, string data, uint256 amount)",
+    )
+    .unwrap();
+    assert_eq!(from_abi, from_solidity);
+
+    // Several events need a name
+    assert!(EventDescriptor::from_abi_json(abi, None).is_err());
+    assert!(EventDescriptor::from_abi_json(abi, Some("Missing")).is_err());
+
+    // A single entry, with a tuple parameter
+    let entry = r#"{
+        "type": "event",
+        "name": "Ping",
+        "inputs": [
+            {"name": "triggerId", "type": "uint32"},
+            {"name": "data", "type": "bytes"},
+            {"name": "meta", "type": "tuple[]", "components": [
+                {"name": "key", "type": "string"},
+                {"name": "value", "type": "uint8"}
+            ]}
+        ],
+        "anonymous": true
+    }"#;
+    let event = EventDescriptor::from_abi_json(entry, None).unwrap();
+    assert_eq!(event.signature(), "Ping(uint32,bytes,(string,uint8)[])");
+    assert_eq!(event.topic0(), None);
+}
@@ -0,0 +1,60 @@
+//! A price hovering at the threshold must not flip the feed back and forth
+//! until the hold is over, and nothing may go out during the cooldown.
+
+use common::update_policy::{Decision, Direction, Submission, Thresholds, UpdatePolicy};
+
+const POLICY: UpdatePolicy = UpdatePolicy {
+    thresholds: Some(Thresholds { up_bps: 100, down_bps: 50, min_hold_secs: 600 }),
+    cooldown_secs: 0,
+};
+
+fn submitted(price: f64, at: u64, direction: Option<Direction>) -> Submission {
+    Submission { price: Some(price), at, direction }
+}
+
+#[test]
+fn separate_up_and_down_thresholds() {
+    assert_eq!(POLICY.decide(None, Some(100.0), 0), Decision::First);
+    let last = submitted(100.0, 0, None);
+    assert!(matches!(POLICY.decide(Some(&last), Some(100.9), 60), Decision::Within { .. }));
+    assert!(matches!(
+        POLICY.decide(Some(&last), Some(101.0), 60),
+        Decision::Moved { direction: Direction::Up, .. }
+    ));
+    // Down only needs half the move
+    assert!(matches!(
+        POLICY.decide(Some(&last), Some(99.5), 60),
+        Decision::Moved { direction: Direction::Down, .. }
+    ));
+    assert!(matches!(POLICY.decide(Some(&last), Some(99.6), 60), Decision::Within { .. }));
+}
+
+#[test]
+fn reversals_wait_for_the_hold() {
+    let up = submitted(101.0, 1_000, Some(Direction::Up));
+    assert_eq!(
+        POLICY.decide(Some(&up), Some(100.0), 1_200),
+        Decision::Held { direction: Direction::Down, remaining_secs: 400 }
+    );
+    assert!(POLICY.decide(Some(&up), Some(100.0), 1_600).submit());
+    // Moving further the same way is not held
+    assert!(POLICY.decide(Some(&up), Some(102.5), 1_001).submit());
+}
+
+#[test]
+fn cooldown_applies_whatever_the_price() {
+    let policy = UpdatePolicy { cooldown_secs: 300, ..POLICY };
+    let last = submitted(100.0, 1_000, None);
+    assert_eq!(
+        policy.decide(Some(&last), Some(150.0), 1_100),
+        Decision::Cooling { remaining_secs: 200 }
+    );
+    assert!(policy.decide(Some(&last), Some(150.0), 1_300).submit());
+
+    // Without thresholds, or for results without a price, only the cooldown counts
+    let cooldown_only = UpdatePolicy { thresholds: None, cooldown_secs: 300 };
+    let index = Submission { price: None, at: 1_000, direction: None };
+    assert!(!cooldown_only.decide(Some(&index), None, 1_299).submit());
+    assert_eq!(cooldown_only.decide(Some(&index), None, 1_300), Decision::Due);
+    assert_eq!(policy.decide(Some(&index), None, 1_300), Decision::Due);
+}
@@ -0,0 +1,223 @@
+//! BLS public data API reads of monthly CPI series.
+//!
+//! CPI for a month is released around the middle of the following month.
+//! Unadjusted CPI-U is final once released; seasonally adjusted series are
+//! revised every February for the previous five years, and chained CPI-U is
+//! published as preliminary and revised for about a year. Each observation
+//! carries the flags consumers need to tell those apart.
+
+use anyhow::{anyhow, Context, Result};
+use common::{
+    context::RunContext,
+    http::{self, fetch_json},
+    mirrors::Mirrors,
+    proxy,
+    secret::Secret,
+};
+use serde::{Deserialize, Serialize};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+/// BLS API, overridable with the `bls_base_urls` mirrors
+const BLS_API_BASE: &str = "https://api.bls.gov";
+
+/// Optional registration key raising the daily request limit
+pub const API_KEY_ENV: &str = "WAVS_ENV_BLS_API_KEY";
+
+/// A calendar month, `YYYY-MM`
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize, Deserialize)]
+pub struct Period {
+    pub year: u16,
+    pub month: u8,
+}
+
+impl Period {
+    pub fn parse(s: &str) -> Result<Self> {
+        let invalid = || anyhow!("invalid period {s:?}, expected YYYY-MM");
+        let (year, month) = s.split_once('-').ok_or_else(invalid)?;
+        let period = Self {
+            year: year.parse().map_err(|_| invalid())?,
+            month: month.parse().map_err(|_| invalid())?,
+        };
+        if year.len() != 4 || !(1..=12).contains(&period.month) {
+            return Err(invalid());
+        }
+        Ok(period)
+    }
+
+    /// Months since year 0, for lag arithmetic
+    pub fn index(self) -> u32 {
+        self.year as u32 * 12 + self.month as u32 - 1
+    }
+}
+
+impl std::fmt::Display for Period {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(f, "{:04}-{:02}", self.year, self.month)
+    }
+}
+
+#[derive(Debug)]
+pub struct Observation {
+    pub period: Period,
+    /// Index level as published, e.g. `323.364`
+    pub value: String,
+    /// BLS footnote `P`: the value will be revised
+    pub preliminary: bool,
+}
+
+#[derive(Debug, Deserialize)]
+struct BlsResponse {
+    status: String,
+    #[serde(default)]
+    message: Vec<String>,
+    #[serde(rename = "Results")]
+    results: Option<BlsResults>,
+}
+
+#[derive(Debug, Deserialize)]
+struct BlsResults {
+    series: Vec<BlsSeries>,
+}
+
+#[derive(Debug, Deserialize)]
+struct BlsSeries {
+    data: Vec<BlsRow>,
+}
+
+#[derive(Debug, Deserialize)]
+struct BlsRow {
+    year: String,
+    /// `M01`..`M12`, `M13` for the annual average
+    period: String,
+    value: String,
+    #[serde(default)]
+    footnotes: Vec<BlsFootnote>,
+}
+
+#[derive(Debug, Default, Deserialize)]
+struct BlsFootnote {
+    #[serde(default)]
+    code: Option<String>,
+}
+
+/// Reads the observation for `period`, or the latest released month
+pub async fn observe(
+    ctx: &RunContext,
+    series: &str,
+    period: Option<Period>,
+) -> Result<Observation> {
+    let mut path = format!("/publicAPI/v2/timeseries/data/{series}?");
+    match period {
+        Some(period) => path.push_str(&format!("startyear={0}&endyear={0}", period.year)),
+        None => path.push_str("latest=true"),
+    }
+    if let Some(key) = Secret::from_env(API_KEY_ENV) {
+        path.push_str(&format!("&registrationkey={}", http::percent_encode(key.expose())));
+    }
+
+    let response: BlsResponse = Mirrors::from_env("bls", BLS_API_BASE)?
+        .fetch(ctx, &path, |url| async move {
+            let mut req = http_request_get(&url)?;
+            req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+            proxy::apply(&mut req)?;
+            fetch_json(req).await
+        })
+        .await?;
+    response.into_observation(series, period)
+}
+
+impl BlsResponse {
+    /// The newest monthly row of `series`, the one for `period` if given
+    fn into_observation(self, series: &str, period: Option<Period>) -> Result<Observation> {
+        if self.status != "REQUEST_SUCCEEDED" {
+            return Err(anyhow!("BLS request failed: {}", self.message.join("; ")));
+        }
+
+        // Rows are newest first; the annual average is not a release
+        let rows = self.results.into_iter().flat_map(|r| r.series).flat_map(|s| s.data);
+        for row in rows {
+            let Some(month) = row.period.strip_prefix('M').and_then(|m| m.parse::<u8>().ok())
+            else {
+                continue;
+            };
+            if !(1..=12).contains(&month) {
+                continue;
+            }
+            let year = row.year.parse().with_context(|| format!("invalid year {}", row.year))?;
+            let row_period = Period { year, month };
+            if period.is_some_and(|wanted| wanted != row_period) {
+                continue;
+            }
+            let preliminary = row.footnotes.iter().any(|f| f.code.as_deref() == Some("P"));
+            return Ok(Observation { period: row_period, value: row.value, preliminary });
+        }
+        Err(anyhow!(
+            "{series} has no release for {}",
+            period.map_or("the latest month".to_string(), |p| p.to_string())
+        ))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// Chained CPI-U rows as BLS serves them: the annual average first, the
+    /// newest month preliminary
+    const ROWS: &str = r#"{"status": "REQUEST_SUCCEEDED", "message": [], "Results": {"series": [
+        {"seriesID": "SUUR0000SA0", "data": [
+            {"year": "2024", "period": "M13", "value": "181.025", "footnotes": [{}]},
+            {"year": "2024", "period": "M12", "value": "181.950",
+                "footnotes": [{"code": "P", "text": "preliminary"}]},
+            {"year": "2024", "period": "M11", "value": "181.900", "footnotes": [{}]}]}]}}"#;
+
+    fn response(json: &str) -> BlsResponse {
+        serde_json::from_str(json).unwrap()
+    }
+
+    #[test]
+    fn periods_parse() {
+        let period = Period::parse("2025-03").unwrap();
+        assert_eq!(period, Period { year: 2025, month: 3 });
+        assert_eq!(period.to_string(), "2025-03");
+        assert_eq!(period.index() - Period::parse("2024-12").unwrap().index(), 3);
+        for invalid in ["2025-13", "2025-00", "25-03", "2025", "2025-March"] {
+            assert!(Period::parse(invalid).is_err(), "{invalid}");
+        }
+    }
+
+    #[test]
+    fn latest_is_the_newest_month() {
+        let latest = response(ROWS).into_observation("SUUR0000SA0", None).unwrap();
+        assert_eq!(latest.period, Period { year: 2024, month: 12 });
+        assert_eq!(latest.value, "181.950");
+        assert!(latest.preliminary);
+    }
+
+    #[test]
+    fn periods_are_picked_by_month() {
+        let november = Some(Period { year: 2024, month: 11 });
+        let observation = response(ROWS).into_observation("SUUR0000SA0", november).unwrap();
+        assert_eq!(observation.value, "181.900");
+        assert!(!observation.preliminary);
+
+        let october = Some(Period { year: 2024, month: 10 });
+        assert_eq!(
+            response(ROWS).into_observation("SUUR0000SA0", october).unwrap_err().to_string(),
+            "SUUR0000SA0 has no release for 2024-10"
+        );
+    }
+
+    #[test]
+    fn failed_requests_carry_the_bls_message() {
+        let failed = response(
+            r#"{"status": "REQUEST_NOT_PROCESSED",
+                "message": ["daily threshold reached", "register for a key"]}"#,
+        );
+        assert_eq!(
+            failed.into_observation("CUUR0000SA0", None).unwrap_err().to_string(),
+            "BLS request failed: daily threshold reached; register for a key"
+        );
+    }
+}
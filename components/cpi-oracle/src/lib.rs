@@ -0,0 +1,306 @@
+mod bls;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_sol_types::SolValue;
+use bls::{Observation, Period};
+use common::{
+    alloc_stats, canonical_json, clock, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    fixed_point::{self, Rounding},
+    output::{self, Computed},
+    panic_guard,
+};
+use serde::{Deserialize, Serialize};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["cpi"];
+
+/// CPI-U, US city average, all items, not seasonally adjusted; overridable
+/// with `cpi_series`
+const DEFAULT_SERIES: &str = "CUUR0000SA0";
+
+/// Decimals of the fixed-point index, overridable with `index_decimals`;
+/// BLS publishes three
+const DEFAULT_INDEX_DECIMALS: u8 = 3;
+
+/// Months the latest release may trail the current month before it is
+/// considered overdue, overridable with `max_release_lag_months`. March
+/// CPI is released in mid April, so a lag of two covers the days before it.
+const DEFAULT_MAX_RELEASE_LAG_MONTHS: u32 = 2;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let (series, period) = parse_request(input.trim_end_matches('\0').trim())?;
+    println!("series: {} period: {:?}", series, period);
+
+    let config = CpiConfig::from_env()?;
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let release = block_on(get_release(&ctx, &config, &series, period))?;
+        println!("release: {:?}", release);
+
+        // One feed per month: a revision republishes the same feed ID
+        let feed_id = format!("cpi:{}:{}", release.series, release.period);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::CpiRelease {
+                    seriesId: release.series.clone(),
+                    year: release.period.year,
+                    month: release.period.month,
+                    index: release.index,
+                    decimals: release.decimals,
+                    preliminary: release.preliminary,
+                    seasonallyAdjusted: release.seasonally_adjusted,
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => {
+                canonical_json::to_vec(&release).map_err(|e| e.to_string())?
+            }
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// Parses `SERIES`, `SERIES@YYYY-MM` or `@YYYY-MM`, where the series is a BLS
+/// series ID or one of `CPI-U`, `CPI-U-SA`, `CORE` and `C-CPI-U`. An empty
+/// input is the latest release of the `cpi_series` kv config.
+fn parse_request(input: &str) -> Result<(String, Option<Period>), String> {
+    let (series, period) = match input.split_once('@') {
+        Some((series, period)) => (series, Some(Period::parse(period).map_err(|e| e.to_string())?)),
+        None => (input, None),
+    };
+    let series = match series.to_ascii_uppercase().as_str() {
+        "" => config::string_or("cpi_series", DEFAULT_SERIES),
+        "CPI-U" => DEFAULT_SERIES.to_string(),
+        "CPI-U-SA" => "CUSR0000SA0".to_string(),
+        "CORE" => "CUUR0000SA0L1E".to_string(),
+        "C-CPI-U" => "SUUR0000SA0".to_string(),
+        id => id.to_string(),
+    };
+    if series.len() < 4 || !series.chars().all(|c| c.is_ascii_alphanumeric()) {
+        return Err(format!("Invalid BLS series ID: {}", series));
+    }
+    Ok((series, period))
+}
+
+struct CpiConfig {
+    decimals: u8,
+    max_lag_months: u32,
+}
+
+impl CpiConfig {
+    fn from_env() -> Result<Self, String> {
+        let decimals = config::parse_or("index_decimals", DEFAULT_INDEX_DECIMALS)
+            .map_err(|e| e.to_string())?;
+        if decimals > 12 {
+            return Err(format!("index_decimals {} is above 12", decimals));
+        }
+        let max_lag_months =
+            config::parse_or("max_release_lag_months", DEFAULT_MAX_RELEASE_LAG_MONTHS)
+                .map_err(|e| e.to_string())?;
+        Ok(Self { decimals, max_lag_months })
+    }
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct CpiRelease {
+    series: String,
+    /// Month the index measures
+    period: Period,
+    /// Index level, fixed-point with `decimals`
+    index: u64,
+    decimals: u8,
+    /// The value is subject to revision
+    preliminary: bool,
+    /// Seasonally adjusted values are revised each February
+    seasonally_adjusted: bool,
+}
+
+async fn get_release(
+    ctx: &RunContext,
+    config: &CpiConfig,
+    series: &str,
+    period: Option<Period>,
+) -> Result<CpiRelease, String> {
+    let observation = ctx
+        .run(bls::observe(ctx, series, period))
+        .await
+        .map_err(|e| e.to_string())?
+        .map_err(|e| format!("{:#}", e))?;
+    cpi_release(config, series, period, observation, ctx.clock().unix_secs())
+}
+
+/// The release of `observation`, checked to be recent when the latest was
+/// asked for
+fn cpi_release(
+    config: &CpiConfig,
+    series: &str,
+    period: Option<Period>,
+    observation: Observation,
+    now: u64,
+) -> Result<CpiRelease, String> {
+    if period.is_none() {
+        let (year, month, _) = clock::utc_date(now);
+        let current = Period { year: year as u16, month: month as u8 };
+        let lag = current.index().saturating_sub(observation.period.index());
+        if lag > config.max_lag_months {
+            return Err(format!(
+                "Latest {} release is for {}, {} months ago, above max_release_lag_months {}",
+                series, observation.period, lag, config.max_lag_months
+            ));
+        }
+    }
+
+    Ok(CpiRelease {
+        series: series.to_string(),
+        period: observation.period,
+        index: to_fixed_point(&observation.value, config.decimals)?,
+        decimals: config.decimals,
+        preliminary: observation.preliminary,
+        // BLS CPI IDs are prefix, seasonal code, periodicity, area, item
+        seasonally_adjusted: series.as_bytes()[2] == b'S',
+    })
+}
+
+/// Parses a published decimal into fixed-point, rejecting precision the
+/// encoding would drop
+fn to_fixed_point(value: &str, decimals: u8) -> Result<u64, String> {
+    let invalid = || format!("Invalid index value {:?} for {} decimals", value, decimals);
+    let scaled = fixed_point::parse(value, decimals, Rounding::Exact).map_err(|_| invalid())?;
+    u64::try_from(scaled).map_err(|_| invalid())
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // Index level, fixed-point with `decimals`, for the month year/month
+        struct CpiRelease {
+            string seriesId;
+            uint16 year;
+            uint8 month;
+            uint64 index;
+            uint8 decimals;
+            bool preliminary;
+            bool seasonallyAdjusted;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// 2025-04-10T00:00:00, before March CPI is released
+    const APRIL_10: u64 = 1_744_243_200;
+
+    const CONFIG: CpiConfig =
+        CpiConfig { decimals: 3, max_lag_months: DEFAULT_MAX_RELEASE_LAG_MONTHS };
+
+    fn month(year: u16, month: u8) -> Period {
+        Period { year, month }
+    }
+
+    fn observed(period: Period, value: &str) -> Observation {
+        Observation { period, value: value.to_string(), preliminary: false }
+    }
+
+    #[test]
+    fn requests_parse_series_and_period() {
+        assert_eq!(parse_request("").unwrap(), (DEFAULT_SERIES.to_string(), None));
+        assert_eq!(
+            parse_request("core@2025-03").unwrap(),
+            ("CUUR0000SA0L1E".to_string(), Some(month(2025, 3)))
+        );
+        assert_eq!(
+            parse_request("@2024-12").unwrap(),
+            (DEFAULT_SERIES.to_string(), Some(month(2024, 12)))
+        );
+        assert_eq!(parse_request("cuur0000sa0e").unwrap().0, "CUUR0000SA0E");
+        assert_eq!(parse_request("abc"), Err("Invalid BLS series ID: ABC".to_string()));
+        assert_eq!(
+            parse_request("CPI-U@2025-13"),
+            Err(r#"invalid period "2025-13", expected YYYY-MM"#.to_string())
+        );
+    }
+
+    #[test]
+    fn latest_release_may_lag_two_months() {
+        let release = cpi_release(
+            &CONFIG,
+            DEFAULT_SERIES,
+            None,
+            observed(month(2025, 2), "319.082"),
+            APRIL_10,
+        )
+        .unwrap();
+        assert_eq!((release.period, release.index, release.decimals), (month(2025, 2), 319_082, 3));
+        assert!(!release.seasonally_adjusted);
+
+        let overdue = cpi_release(
+            &CONFIG,
+            DEFAULT_SERIES,
+            None,
+            observed(month(2025, 1), "317.671"),
+            APRIL_10,
+        );
+        assert_eq!(
+            overdue.unwrap_err(),
+            "Latest CUUR0000SA0 release is for 2025-01, 3 months ago, above max_release_lag_months 2"
+        );
+    }
+
+    #[test]
+    fn requested_periods_may_be_old() {
+        let period = Some(month(2020, 1));
+        let release = cpi_release(
+            &CONFIG,
+            "CUSR0000SA0",
+            period,
+            observed(month(2020, 1), "258.682"),
+            APRIL_10,
+        )
+        .unwrap();
+        assert_eq!(release.index, 258_682);
+        assert!(release.seasonally_adjusted);
+    }
+
+    #[test]
+    fn index_values_scale_exactly() {
+        assert_eq!(to_fixed_point("323.364", 3), Ok(323_364));
+        assert_eq!(to_fixed_point("100", 3), Ok(100_000));
+        assert_eq!(
+            to_fixed_point("323.3645", 3),
+            Err(r#"Invalid index value "323.3645" for 3 decimals"#.to_string())
+        );
+        assert!(to_fixed_point("-1.5", 3).is_err());
+    }
+}
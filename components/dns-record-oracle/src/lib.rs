@@ -0,0 +1,393 @@
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    http::{self, fetch_json},
+    json_schema,
+    mirrors::Mirrors,
+    output::{self, Computed},
+    panic_guard, proxy,
+};
+use serde::{Deserialize, Serialize};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::{http::HeaderValue, runtime::block_on};
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["resolve"];
+
+/// DNS-over-HTTPS resolver serving the JSON API at `/dns-query`, overridable
+/// with the `doh_base_urls` mirrors
+const DEFAULT_RESOLVER: &str = "https://cloudflare-dns.com";
+
+/// Schema of [`DnsRequest`], checked before it is deserialized
+const REQUEST_SCHEMA: &str = include_str!("../schemas/dns_request.schema.json");
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let request = DnsRequest::parse(input.trim_end_matches('\0').trim())?;
+    println!("request: {:?}", request);
+
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let proof = block_on(resolve(&ctx, request.clone()))?;
+        println!("proof: {:?}", proof);
+
+        let feed_id = format!("dns:{}:{}", proof.record_type, proof.name);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::DnsRecordProof {
+                    name: proof.name.clone(),
+                    recordType: proof.record_type.code(),
+                    records: proof.records.clone(),
+                    expected: proof.expected.clone().unwrap_or_default(),
+                    matched: proof.matched,
+                    dnssec: proof.dnssec,
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&proof).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "UPPERCASE")]
+pub enum RecordType {
+    #[default]
+    Txt,
+    A,
+    Aaaa,
+    Cname,
+}
+
+impl RecordType {
+    /// IANA resource record type
+    fn code(self) -> u16 {
+        match self {
+            Self::A => 1,
+            Self::Cname => 5,
+            Self::Txt => 16,
+            Self::Aaaa => 28,
+        }
+    }
+}
+
+impl std::fmt::Display for RecordType {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str(match self {
+            Self::A => "A",
+            Self::Cname => "CNAME",
+            Self::Txt => "TXT",
+            Self::Aaaa => "AAAA",
+        })
+    }
+}
+
+/// Trigger input: a bare domain name for its TXT records, or
+/// `{"name": "_wavs.example.com", "type": "TXT", "expect": "0x..."}`
+#[derive(Debug, Clone, Deserialize)]
+pub struct DnsRequest {
+    name: String,
+    #[serde(default, rename = "type")]
+    record_type: RecordType,
+    #[serde(default)]
+    expect: Option<String>,
+}
+
+impl DnsRequest {
+    fn parse(input: &str) -> Result<Self, String> {
+        if input.starts_with('{') {
+            return json_schema::from_slice(REQUEST_SCHEMA, input.as_bytes())
+                .map_err(|e| format!("Invalid DNS request: {}", e));
+        }
+        if input.is_empty() || input.contains(char::is_whitespace) {
+            return Err(format!("Invalid domain name: {:?}", input));
+        }
+        Ok(Self { name: input.to_string(), record_type: RecordType::Txt, expect: None })
+    }
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct DnsProof {
+    name: String,
+    record_type: RecordType,
+    /// Record data, sorted; TXT character strings are joined
+    records: Vec<String>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    expected: Option<String>,
+    /// Whether a record contains `expected`, ignoring ASCII case
+    matched: bool,
+    /// The resolver validated the answer with DNSSEC
+    dnssec: bool,
+}
+
+/// `application/dns-json` response
+#[derive(Debug, Deserialize)]
+struct DohResponse {
+    #[serde(rename = "Status")]
+    status: u32,
+    #[serde(rename = "AD", default)]
+    authenticated: bool,
+    #[serde(rename = "Answer", default)]
+    answer: Vec<DohAnswer>,
+}
+
+#[derive(Debug, Deserialize)]
+struct DohAnswer {
+    #[serde(rename = "type")]
+    record_type: u16,
+    data: String,
+}
+
+async fn resolve(ctx: &RunContext, request: DnsRequest) -> Result<DnsProof, String> {
+    let name = request.name.trim_end_matches('.').to_ascii_lowercase();
+    let path =
+        format!("/dns-query?name={}&type={}", http::percent_encode(&name), request.record_type);
+    let mirrors = Mirrors::from_env("doh", DEFAULT_RESOLVER).map_err(|e| e.to_string())?;
+    let response: DohResponse = mirrors
+        .fetch(ctx, &path, |url| async move {
+            let mut req = http_request_get(&url)?;
+            req.headers_mut().insert("Accept", HeaderValue::from_static("application/dns-json"));
+            proxy::apply(&mut req)?;
+            fetch_json(req).await
+        })
+        .await
+        .map_err(|e| e.to_string())?;
+
+    let require_dnssec = config::flag("require_dnssec", false).map_err(|e| e.to_string())?;
+    prove(name, request, response, require_dnssec)
+}
+
+/// The proof of `request` for the normalized `name` from the resolver's
+/// `response`
+fn prove(
+    name: String,
+    request: DnsRequest,
+    response: DohResponse,
+    require_dnssec: bool,
+) -> Result<DnsProof, String> {
+    // NXDOMAIN (3) is an answer: the name has no records
+    if response.status != 0 && response.status != 3 {
+        return Err(format!("Resolver failed with DNS status {}", response.status));
+    }
+    if require_dnssec && !response.authenticated {
+        return Err(format!("Answer for {} is not DNSSEC validated", name));
+    }
+
+    // CNAME chains are answered too, keep only the requested type
+    let mut records: Vec<String> = response
+        .answer
+        .iter()
+        .filter(|answer| answer.record_type == request.record_type.code())
+        .map(|answer| match request.record_type {
+            RecordType::Txt => join_character_strings(&answer.data),
+            _ => answer.data.trim_end_matches('.').to_string(),
+        })
+        .collect();
+    records.sort();
+    records.dedup();
+
+    let matched = request.expect.as_ref().is_some_and(|expected| {
+        let expected = expected.to_ascii_lowercase();
+        records.iter().any(|record| record.to_ascii_lowercase().contains(&expected))
+    });
+    Ok(DnsProof {
+        name,
+        record_type: request.record_type,
+        records,
+        expected: request.expect,
+        matched,
+        dnssec: response.authenticated,
+    })
+}
+
+/// Joins the quoted character strings of TXT data: `"a" "b"` -> `ab`
+fn join_character_strings(data: &str) -> String {
+    if !data.starts_with('"') {
+        return data.to_string();
+    }
+    let mut out = String::new();
+    let mut chars = data.chars();
+    let mut quoted = false;
+    while let Some(c) = chars.next() {
+        match c {
+            '"' => quoted = !quoted,
+            '\\' if quoted => out.extend(chars.next()),
+            c if quoted => out.push(c),
+            _ => {}
+        }
+    }
+    out
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        struct DnsRecordProof {
+            string name;
+            uint16 recordType;
+            string[] records;
+            string expected;
+            bool matched;
+            bool dnssec;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// Cloudflare's answer for the A records of a name behind a CNAME
+    const CNAME_CHAIN: &str = r#"{"Status": 0, "TC": false, "RD": true, "RA": true, "AD": true,
+        "Question": [{"name": "www.example.com", "type": 1}],
+        "Answer": [
+            {"name": "www.example.com", "type": 5, "TTL": 300, "data": "example.com."},
+            {"name": "example.com", "type": 1, "TTL": 300, "data": "93.184.215.14"},
+            {"name": "example.com", "type": 1, "TTL": 300, "data": "93.184.215.12"},
+            {"name": "example.com", "type": 1, "TTL": 300, "data": "93.184.215.12"}
+        ]}"#;
+
+    fn request(record_type: RecordType, expect: Option<&str>) -> DnsRequest {
+        DnsRequest {
+            name: "www.example.com".to_string(),
+            record_type,
+            expect: expect.map(String::from),
+        }
+    }
+
+    fn response(json: &str) -> DohResponse {
+        serde_json::from_str(json).unwrap()
+    }
+
+    #[test]
+    fn requests_parse_from_names_or_json() {
+        let bare = DnsRequest::parse("_wavs.example.com").unwrap();
+        assert_eq!(
+            (bare.name.as_str(), bare.record_type, bare.expect),
+            ("_wavs.example.com", RecordType::Txt, None)
+        );
+
+        let json =
+            DnsRequest::parse(r#"{"name": "example.com", "type": "AAAA", "expect": "2606:"}"#)
+                .unwrap();
+        assert_eq!((json.record_type, json.expect.as_deref()), (RecordType::Aaaa, Some("2606:")));
+
+        assert!(DnsRequest::parse("").is_err());
+        assert!(DnsRequest::parse("example.com; rm").is_err());
+        assert!(DnsRequest::parse(r#"{"name": "example.com", "type": "MX"}"#).is_err());
+    }
+
+    #[test]
+    fn only_the_requested_type_is_kept() {
+        let proof = prove(
+            "www.example.com".to_string(),
+            request(RecordType::A, Some("93.184.215.12")),
+            response(CNAME_CHAIN),
+            true,
+        )
+        .unwrap();
+        assert_eq!(proof.records, ["93.184.215.12", "93.184.215.14"]);
+        assert!(proof.matched && proof.dnssec);
+
+        let proof = prove(
+            "www.example.com".to_string(),
+            request(RecordType::Cname, None),
+            response(CNAME_CHAIN),
+            false,
+        )
+        .unwrap();
+        assert_eq!(proof.records, ["example.com"]);
+        assert!(!proof.matched);
+    }
+
+    #[test]
+    fn txt_records_match_ignoring_case() {
+        let txt = r#"{"Status": 0, "AD": false, "Answer": [
+            {"name": "_wavs.example.com", "type": 16, "data": "\"wavs-verification=\" \"0xABCdef\""}
+        ]}"#;
+        let proof = prove(
+            "_wavs.example.com".to_string(),
+            request(RecordType::Txt, Some("0xabcDEF")),
+            response(txt),
+            false,
+        )
+        .unwrap();
+        assert_eq!(proof.records, ["wavs-verification=0xABCdef"]);
+        assert!(proof.matched);
+        assert!(!proof.dnssec);
+    }
+
+    #[test]
+    fn resolver_status_and_dnssec_are_checked() {
+        // NXDOMAIN proves there are no records
+        let proof = prove(
+            "nx.example.com".to_string(),
+            request(RecordType::Txt, Some("x")),
+            response(r#"{"Status": 3}"#),
+            false,
+        )
+        .unwrap();
+        assert!(proof.records.is_empty() && !proof.matched);
+
+        let servfail = prove(
+            "example.com".to_string(),
+            request(RecordType::Txt, None),
+            response(r#"{"Status": 2}"#),
+            false,
+        );
+        assert_eq!(servfail.unwrap_err(), "Resolver failed with DNS status 2");
+
+        let unsigned = prove(
+            "example.com".to_string(),
+            request(RecordType::Txt, None),
+            response(r#"{"Status": 0, "AD": false}"#),
+            true,
+        );
+        assert_eq!(unsigned.unwrap_err(), "Answer for example.com is not DNSSEC validated");
+    }
+
+    #[test]
+    fn character_strings_are_joined() {
+        assert_eq!(join_character_strings(r#""a" "b""#), "ab");
+        assert_eq!(join_character_strings(r#""say \"hi\"""#), r#"say "hi""#);
+        assert_eq!(join_character_strings("v=spf1 -all"), "v=spf1 -all");
+    }
+
+    #[test]
+    fn record_type_codes_are_iana() {
+        let codes = [RecordType::A, RecordType::Cname, RecordType::Txt, RecordType::Aaaa]
+            .map(RecordType::code);
+        assert_eq!(codes, [1, 5, 16, 28]);
+    }
+}
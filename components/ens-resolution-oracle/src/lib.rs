@@ -0,0 +1,228 @@
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, host::get_eth_chain_config, Guest, TriggerAction};
+use alloy_primitives::{address, hex, Address, B256};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    crypto::keccak256,
+    envelope::ComponentInfo,
+    evm,
+    output::{self, Computed},
+    panic_guard,
+};
+use serde::{Deserialize, Serialize};
+use wstd::runtime::block_on;
+
+/// ENS registry, deployed at the same address on mainnet and the public testnets
+const ENS_REGISTRY: Address = address!("00000000000C2E074eC69A0dFb2997BA6C7d2e1e");
+
+/// Chain from `wavs.toml` to query when `ens_chain_name` is not configured
+const DEFAULT_CHAIN_NAME: &str = "sepolia";
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["resolve"];
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let input = input.trim_end_matches('\0').trim();
+    println!("input: {}", input);
+
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let resolution =
+            block_on(async { ctx.run(resolve(&ctx, input)).await.map_err(|e| e.to_string())? })?;
+        println!("resolution: {:?}", resolution);
+
+        let feed_id = format!("ens:{}", resolution.name);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::EnsResolution {
+                    name: resolution.name.clone(),
+                    addr: resolution.address,
+                    isReverse: resolution.reverse,
+                    verified: resolution.verified,
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => {
+                canonical_json::to_vec(&resolution).map_err(|e| e.to_string())?
+            }
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct Resolution {
+    name: String,
+    address: Address,
+    /// True for address to name (reverse record) lookups
+    reverse: bool,
+    /// True when the name resolves back to the address
+    verified: bool,
+}
+
+/// Resolves an ENS name to its address, or an `0x` address to its primary
+/// name, at the trigger block when it is on the ENS chain
+async fn resolve(ctx: &RunContext, input: &str) -> Result<Resolution, String> {
+    let chain_name = config::string_or("ens_chain_name", DEFAULT_CHAIN_NAME);
+    let endpoint = get_eth_chain_config(&chain_name)
+        .and_then(|config| config.http_endpoint)
+        .ok_or_else(|| format!("No http endpoint configured for chain {}", chain_name))?;
+    let provider = evm::provider(&endpoint).map_err(|e| e.to_string())?;
+    let registry = config::parse_or("ens_registry", ENS_REGISTRY).map_err(|e| e.to_string())?;
+
+    let ens = Ens { provider, registry, block: ctx.pinned_height(&chain_name) };
+    if input.starts_with("0x") {
+        let address: Address = input.parse().map_err(|e| format!("Invalid address: {}", e))?;
+        let name = ens.reverse(address).await?;
+        let verified = ens.addr(&name).await.map(|addr| addr == address).unwrap_or(false);
+        Ok(Resolution { name, address, reverse: true, verified })
+    } else {
+        let name = input.to_lowercase();
+        let address = ens.addr(&name).await?;
+        Ok(Resolution { name, address, reverse: false, verified: true })
+    }
+}
+
+struct Ens {
+    provider: alloy_provider::RootProvider<alloy_network::Ethereum>,
+    registry: Address,
+    block: Option<u64>,
+}
+
+impl Ens {
+    async fn resolver(&self, node: B256) -> Result<Address, String> {
+        let call = solidity::IENSRegistry::resolverCall { node };
+        let resolver = evm::call(&self.provider, self.registry, &call, self.block)
+            .await
+            .map_err(|e| e.to_string())?
+            ._0;
+        if resolver.is_zero() {
+            return Err("No resolver set".to_string());
+        }
+        Ok(resolver)
+    }
+
+    async fn addr(&self, name: &str) -> Result<Address, String> {
+        let node = namehash(name);
+        let resolver = self.resolver(node).await?;
+        let call = solidity::IENSResolver::addrCall { node };
+        let addr = evm::call(&self.provider, resolver, &call, self.block)
+            .await
+            .map_err(|e| e.to_string())?
+            ._0;
+        if addr.is_zero() {
+            return Err(format!("{} does not resolve to an address", name));
+        }
+        Ok(addr)
+    }
+
+    async fn reverse(&self, address: Address) -> Result<String, String> {
+        let node = reverse_node(address);
+        let resolver = self.resolver(node).await?;
+        let call = solidity::IENSResolver::nameCall { node };
+        let name = evm::call(&self.provider, resolver, &call, self.block)
+            .await
+            .map_err(|e| e.to_string())?
+            ._0;
+        if name.is_empty() {
+            return Err(format!("{} has no reverse record", address));
+        }
+        Ok(name)
+    }
+}
+
+/// ENS namehash (EIP-137). Names are expected to be already normalized.
+fn namehash(name: &str) -> B256 {
+    let mut node = B256::ZERO;
+    if name.is_empty() {
+        return node;
+    }
+    for label in name.rsplit('.') {
+        let label_hash = keccak256(label.as_bytes());
+        node = keccak256([node.as_slice(), label_hash.as_slice()].concat());
+    }
+    node
+}
+
+/// Node of the reverse record of `address`: `<lowercase hex>.addr.reverse`
+fn reverse_node(address: Address) -> B256 {
+    namehash(&format!("{}.addr.reverse", hex::encode(address)))
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        interface IENSRegistry {
+            function resolver(bytes32 node) external view returns (address);
+        }
+
+        interface IENSResolver {
+            function addr(bytes32 node) external view returns (address);
+            function name(bytes32 node) external view returns (string memory);
+        }
+
+        struct EnsResolution {
+            string name;
+            address addr;
+            bool isReverse;
+            bool verified;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloy_primitives::{address, b256};
+
+    /// Vectors from EIP-137
+    #[test]
+    fn namehash_matches_eip137() {
+        assert_eq!(namehash(""), B256::ZERO);
+        assert_eq!(
+            namehash("eth"),
+            b256!("93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae")
+        );
+        assert_eq!(
+            namehash("foo.eth"),
+            b256!("de9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f")
+        );
+    }
+
+    #[test]
+    fn reverse_node_uses_the_lowercase_address() {
+        assert_eq!(
+            reverse_node(address!("5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed")),
+            b256!("2103fd044150f573e47fcb48a7eedec6afd0911f9af1b0ff9167014ff22edd24")
+        );
+    }
+}
@@ -0,0 +1,292 @@
+mod providers;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_primitives::U256;
+use alloy_sol_types::SolValue;
+use anyhow::Context;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::{self, ComponentInfo},
+    fan_out::FanOut,
+    fixed_point::{self, Rounding},
+    http,
+    output::{self, Computed},
+    panic_guard,
+    sanity::PriceBounds,
+    secret::Secret,
+};
+use providers::{Provider, Quote, Session, API_KEY_ENV};
+use serde::{Deserialize, Serialize};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["quote"];
+
+/// Decimals of the fixed-point prices, overridable with `price_decimals`
+const DEFAULT_PRICE_DECIMALS: u8 = 8;
+
+/// Upper bound on the symbols quoted in one run, overridable with `max_symbols`
+const DEFAULT_MAX_SYMBOLS: usize = 10;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let config = QuoteConfig::from_env()?;
+    let symbols = parse_symbols(input.trim_end_matches('\0'), config.max_symbols)?;
+    println!("symbols: {:?}", symbols);
+
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(get_quotes(&ctx, &config, &symbols))?;
+        println!("report: {:?}", report);
+
+        // Consumers that only read the envelope still see that prices are closes
+        let flags = match report.session {
+            Session::Open => 0,
+            Session::Closed => envelope::FLAG_MARKET_CLOSED,
+        };
+        let feed_id = format!("equities:{}", report.symbols_label());
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload: Vec<solidity::EquityPrice> = report
+                    .prices
+                    .iter()
+                    .map(|p| solidity::EquityPrice {
+                        symbol: p.symbol.clone(),
+                        price: p.price,
+                        decimals: report.decimals,
+                        asOf: p.as_of,
+                        marketOpen: report.session == Session::Open,
+                    })
+                    .collect();
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload).with_flags(flags))
+    })?;
+    Ok(Some(output))
+}
+
+struct QuoteConfig {
+    provider: Provider,
+    api_key: Secret,
+    decimals: u8,
+    max_symbols: usize,
+}
+
+impl QuoteConfig {
+    fn from_env() -> Result<Self, String> {
+        let provider = Provider::from_env().map_err(|e| e.to_string())?;
+        let api_key = Secret::required(API_KEY_ENV).map_err(|e| e.to_string())?;
+        let decimals = config::parse_or("price_decimals", DEFAULT_PRICE_DECIMALS)
+            .map_err(|e| e.to_string())?;
+        // Beyond 18 decimals f64 quotes carry no more precision
+        if decimals > 18 {
+            return Err(format!("price_decimals {} is above 18", decimals));
+        }
+        let max_symbols =
+            config::parse_or("max_symbols", DEFAULT_MAX_SYMBOLS).map_err(|e| e.to_string())?;
+        Ok(Self { provider, api_key, decimals, max_symbols })
+    }
+}
+
+/// Reads the comma or whitespace separated tickers of the input, or the comma
+/// separated `equity_symbols` kv config when the input is empty
+fn parse_symbols(input: &str, max_symbols: usize) -> Result<Vec<String>, String> {
+    let list = if input.trim().is_empty() {
+        config::list("equity_symbols").unwrap_or_default()
+    } else {
+        input.split(|c: char| c == ',' || c.is_whitespace()).map(str::to_string).collect()
+    };
+    let mut symbols: Vec<String> = list
+        .iter()
+        .filter(|symbol| !symbol.is_empty())
+        .map(|symbol| symbol.to_ascii_uppercase())
+        .collect();
+    symbols.sort();
+    symbols.dedup();
+
+    if symbols.is_empty() {
+        return Err("No symbols to quote, pass them as input or set equity_symbols".to_string());
+    }
+    if symbols.len() > max_symbols {
+        return Err(format!(
+            "{} symbols requested, at most {} are allowed",
+            symbols.len(),
+            max_symbols
+        ));
+    }
+    if let Some(symbol) = symbols
+        .iter()
+        .find(|s| !s.chars().all(|c| c.is_ascii_alphanumeric() || matches!(c, '.' | '-')))
+    {
+        return Err(format!("Invalid symbol: {}", symbol));
+    }
+    Ok(symbols)
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct EquityQuote {
+    symbol: String,
+    /// USD per share, fixed-point with the report's decimals
+    price: U256,
+    /// Unix seconds of the trade or close
+    as_of: u64,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct QuoteReport {
+    provider: Provider,
+    /// `closed` means every price is the last close
+    session: Session,
+    decimals: u8,
+    prices: Vec<EquityQuote>,
+}
+
+impl QuoteReport {
+    fn symbols_label(&self) -> String {
+        let symbols: Vec<&str> = self.prices.iter().map(|p| p.symbol.as_str()).collect();
+        symbols.join(",")
+    }
+}
+
+async fn get_quotes(
+    ctx: &RunContext,
+    config: &QuoteConfig,
+    symbols: &[String],
+) -> Result<QuoteReport, String> {
+    let provider = config.provider;
+    let key = &http::percent_encode(config.api_key.expose());
+    // One status for the whole run, so all prices share a session
+    let session = provider.session(ctx, key).await.map_err(|e| format!("{:#}", e))?;
+    let bounds = &PriceBounds::from_env().map_err(|e| e.to_string())?;
+    let prices = FanOut::from_env()
+        .map_err(|e| e.to_string())?
+        .try_join(
+            ctx,
+            symbols.iter().map(|symbol| async move {
+                let quote = provider.quote(ctx, key, symbol, session).await?;
+                equity_quote(symbol, quote, config.decimals, bounds)
+            }),
+        )
+        .await
+        .map_err(|e| format!("{:#}", e))?;
+    Ok(QuoteReport { provider, session, decimals: config.decimals, prices })
+}
+
+/// The published price of `symbol`, checked against `bounds`
+fn equity_quote(
+    symbol: &str,
+    quote: Quote,
+    decimals: u8,
+    bounds: &PriceBounds,
+) -> anyhow::Result<EquityQuote> {
+    let price = bounds.check(symbol, quote.price)?;
+    Ok(EquityQuote {
+        symbol: symbol.to_string(),
+        price: fixed_point::from_f64(price, decimals, Rounding::HalfUp)
+            .with_context(|| format!("price {} of {}", price, symbol))?,
+        as_of: quote.as_of,
+    })
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // USD per share, fixed-point with `decimals`; a closed market
+        // publishes its last close
+        struct EquityPrice {
+            string symbol;
+            uint256 price;
+            uint8 decimals;
+            uint64 asOf;
+            bool marketOpen;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn symbols_parse_from_input() {
+        assert_eq!(parse_symbols("aapl, BRK.B msft,AAPL", 3).unwrap(), ["AAPL", "BRK.B", "MSFT"]);
+        assert_eq!(
+            parse_symbols("AAPL MSFT", 1),
+            Err("2 symbols requested, at most 1 are allowed".to_string())
+        );
+        assert_eq!(parse_symbols("AAPL$", 3), Err("Invalid symbol: AAPL$".to_string()));
+    }
+
+    #[test]
+    fn configured_symbols_are_the_fallback() {
+        std::env::set_var("equity_symbols", "msft, aapl");
+        assert_eq!(parse_symbols("", 3).unwrap(), ["AAPL", "MSFT"]);
+        std::env::remove_var("equity_symbols");
+        assert_eq!(
+            parse_symbols(" ", 3),
+            Err("No symbols to quote, pass them as input or set equity_symbols".to_string())
+        );
+    }
+
+    #[test]
+    fn quotes_scale_to_fixed_point() {
+        let quote = Quote { price: 231.25, as_of: 1_735_776_000 };
+        let price = equity_quote("IBM", quote, 8, &PriceBounds::default()).unwrap();
+        assert_eq!(price.price, U256::from(23_125_000_000u64));
+        assert_eq!((price.symbol.as_str(), price.as_of), ("IBM", 1_735_776_000));
+
+        let zero = Quote { price: 0.0, as_of: 1_735_776_000 };
+        let err = equity_quote("IBM", zero, 8, &PriceBounds::default()).unwrap_err();
+        assert!(err.to_string().starts_with("SANITY_CHECK_FAILED"), "{err}");
+    }
+
+    #[test]
+    fn report_labels_its_symbols() {
+        let report = QuoteReport {
+            provider: Provider::Polygon,
+            session: Session::Closed,
+            decimals: 8,
+            prices: ["AAPL", "MSFT"]
+                .iter()
+                .map(|symbol| {
+                    let quote = Quote { price: 1.0, as_of: 0 };
+                    equity_quote(symbol, quote, 8, &PriceBounds::default()).unwrap()
+                })
+                .collect(),
+        };
+        assert_eq!(report.symbols_label(), "AAPL,MSFT");
+        let json = serde_json::to_value(&report).unwrap();
+        assert_eq!(
+            (json["provider"].as_str(), json["session"].as_str()),
+            (Some("polygon"), Some("closed"))
+        );
+    }
+}
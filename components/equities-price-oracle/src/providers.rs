@@ -0,0 +1,314 @@
+//! Quote providers: Alpha Vantage and Polygon.io.
+//!
+//! Each provider reports whether the exchange is trading and quotes a symbol
+//! accordingly: the latest trade while open, the last official close while
+//! closed.
+
+use anyhow::{anyhow, Context, Result};
+use common::{
+    clock, config,
+    context::RunContext,
+    http::{self, fetch_json},
+    mirrors::Mirrors,
+    proxy,
+};
+use serde::{de::DeserializeOwned, Deserialize, Serialize};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+/// API key of the configured provider
+pub const API_KEY_ENV: &str = "WAVS_ENV_EQUITIES_API_KEY";
+
+/// Market whose trading status Alpha Vantage reports, overridable with
+/// `market_region`
+const DEFAULT_MARKET_REGION: &str = "United States";
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Provider {
+    AlphaVantage,
+    Polygon,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Session {
+    Open,
+    Closed,
+}
+
+#[derive(Debug)]
+pub struct Quote {
+    /// USD per share
+    pub price: f64,
+    /// Unix seconds of the trade or close; midnight UTC of the trading day
+    /// for providers that only report the day
+    pub as_of: u64,
+}
+
+impl Provider {
+    /// From the `equities_provider` kv config, Alpha Vantage by default
+    pub fn from_env() -> Result<Self> {
+        match config::string_or("equities_provider", "alphavantage").as_str() {
+            "alphavantage" => Ok(Self::AlphaVantage),
+            "polygon" => Ok(Self::Polygon),
+            other => Err(anyhow!("unknown equities_provider {other}")),
+        }
+    }
+
+    /// Name of the mirrors config and the default API base
+    fn source(self) -> (&'static str, &'static str) {
+        match self {
+            Self::AlphaVantage => ("alphavantage", "https://www.alphavantage.co"),
+            Self::Polygon => ("polygon", "https://api.polygon.io"),
+        }
+    }
+
+    pub async fn session(self, ctx: &RunContext, key: &str) -> Result<Session> {
+        let open = match self {
+            Self::AlphaVantage => {
+                let status: AvMarketStatus =
+                    self.get(ctx, &format!("/query?function=MARKET_STATUS&apikey={key}")).await?;
+                let region = config::string_or("market_region", DEFAULT_MARKET_REGION);
+                status.equity_open(&region)?
+            }
+            Self::Polygon => {
+                let status: PolygonMarketStatus =
+                    self.get(ctx, &format!("/v1/marketstatus/now?apiKey={key}")).await?;
+                // Extended hours trade thinly, their prices are not published
+                status.market == "open"
+            }
+        };
+        Ok(if open { Session::Open } else { Session::Closed })
+    }
+
+    pub async fn quote(
+        self,
+        ctx: &RunContext,
+        key: &str,
+        symbol: &str,
+        session: Session,
+    ) -> Result<Quote> {
+        let encoded = http::percent_encode(symbol);
+        match self {
+            Self::AlphaVantage => {
+                let response: AvQuoteResponse = self
+                    .get(
+                        ctx,
+                        &format!("/query?function=GLOBAL_QUOTE&symbol={encoded}&apikey={key}"),
+                    )
+                    .await?;
+                response.into_quote(symbol)
+            }
+            Self::Polygon => {
+                let response: PolygonSnapshot = self
+                    .get(
+                        ctx,
+                        &format!(
+                            "/v2/snapshot/locale/us/markets/stocks/tickers/{encoded}?apiKey={key}"
+                        ),
+                    )
+                    .await?;
+                response.ticker.into_quote(symbol, session)
+            }
+        }
+    }
+
+    async fn get<T: DeserializeOwned>(self, ctx: &RunContext, path: &str) -> Result<T> {
+        let (source, base) = self.source();
+        let mirrors = Mirrors::from_env(source, base)?;
+        mirrors
+            .fetch(ctx, path, |url| async move {
+                let mut req = http_request_get(&url)?;
+                req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+                proxy::apply(&mut req)?;
+                fetch_json(req).await
+            })
+            .await
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct AvMarketStatus {
+    markets: Vec<AvMarket>,
+}
+
+impl AvMarketStatus {
+    /// Whether the equity market of `region` is trading
+    fn equity_open(&self, region: &str) -> Result<bool> {
+        let market = self
+            .markets
+            .iter()
+            .find(|m| m.market_type == "Equity" && m.region == region)
+            .with_context(|| format!("no equity market status for {region}"))?;
+        Ok(market.current_status.eq_ignore_ascii_case("open"))
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct AvMarket {
+    market_type: String,
+    region: String,
+    current_status: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct AvQuoteResponse {
+    #[serde(rename = "Global Quote", default, deserialize_with = "empty_as_none")]
+    quote: Option<AvQuote>,
+}
+
+impl AvQuoteResponse {
+    fn into_quote(self, symbol: &str) -> Result<Quote> {
+        // Unknown symbols are answered with an empty quote
+        let quote = self.quote.with_context(|| format!("no quote for {symbol}"))?;
+        // Once the session ends the latest price is the official close
+        let price: f64 =
+            quote.price.parse().with_context(|| format!("invalid price for {symbol}"))?;
+        let as_of = clock::parse_utc(&format!("{}T00:00:00", quote.latest_trading_day))?;
+        Ok(Quote { price, as_of })
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct AvQuote {
+    #[serde(rename = "05. price")]
+    price: String,
+    #[serde(rename = "07. latest trading day")]
+    latest_trading_day: String,
+}
+
+fn empty_as_none<'de, D, T>(deserializer: D) -> Result<Option<T>, D::Error>
+where
+    D: serde::Deserializer<'de>,
+    T: DeserializeOwned,
+{
+    let value = serde_json::Value::deserialize(deserializer)?;
+    match value {
+        serde_json::Value::Object(ref map) if map.is_empty() => Ok(None),
+        value => serde_json::from_value(value).map(Some).map_err(serde::de::Error::custom),
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct PolygonMarketStatus {
+    market: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct PolygonSnapshot {
+    ticker: PolygonTicker,
+}
+
+#[derive(Debug, Deserialize)]
+struct PolygonTicker {
+    day: PolygonBar,
+    #[serde(rename = "prevDay")]
+    prev_day: PolygonBar,
+    #[serde(rename = "lastTrade", default)]
+    last_trade: Option<PolygonTrade>,
+    /// Unix nanoseconds
+    updated: u64,
+}
+
+impl PolygonTicker {
+    fn into_quote(self, symbol: &str, session: Session) -> Result<Quote> {
+        let as_of = self.updated / 1_000_000_000;
+        match session {
+            Session::Open => {
+                let trade =
+                    self.last_trade.with_context(|| format!("no trade for {symbol} yet"))?;
+                Ok(Quote { price: trade.price, as_of: trade.timestamp / 1_000_000_000 })
+            }
+            // The day bar is empty before the first trade of the day
+            Session::Closed if self.day.close > 0.0 => Ok(Quote { price: self.day.close, as_of }),
+            Session::Closed => Ok(Quote { price: self.prev_day.close, as_of }),
+        }
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct PolygonBar {
+    #[serde(rename = "c")]
+    close: f64,
+}
+
+#[derive(Debug, Deserialize)]
+struct PolygonTrade {
+    #[serde(rename = "p")]
+    price: f64,
+    /// Unix nanoseconds
+    #[serde(rename = "t")]
+    timestamp: u64,
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// 2025-01-02T15:00:00 in Unix nanoseconds
+    const UPDATED_NANOS: u64 = 1_735_830_000_000_000_000;
+
+    fn ticker(day_close: f64, last_trade: &str) -> PolygonTicker {
+        serde_json::from_str(&format!(
+            r#"{{"day": {{"c": {day_close}}}, "prevDay": {{"c": 180.5}},
+                {last_trade} "updated": {UPDATED_NANOS}}}"#
+        ))
+        .unwrap()
+    }
+
+    #[test]
+    fn alpha_vantage_status_is_read_for_the_region() {
+        let status: AvMarketStatus = serde_json::from_str(
+            r#"{"markets": [
+                {"market_type": "Forex", "region": "Global", "current_status": "open"},
+                {"market_type": "Equity", "region": "United States", "current_status": "Closed"},
+                {"market_type": "Equity", "region": "Japan", "current_status": "OPEN"}]}"#,
+        )
+        .unwrap();
+        assert!(!status.equity_open("United States").unwrap());
+        assert!(status.equity_open("Japan").unwrap());
+        assert_eq!(
+            status.equity_open("Global").unwrap_err().to_string(),
+            "no equity market status for Global"
+        );
+    }
+
+    #[test]
+    fn alpha_vantage_quotes_are_dated_by_trading_day() {
+        let response: AvQuoteResponse = serde_json::from_str(
+            r#"{"Global Quote": {"01. symbol": "IBM", "05. price": "231.2500",
+                "07. latest trading day": "2025-01-02"}}"#,
+        )
+        .unwrap();
+        let quote = response.into_quote("IBM").unwrap();
+        assert_eq!((quote.price, quote.as_of), (231.25, 1_735_776_000));
+
+        let unknown: AvQuoteResponse = serde_json::from_str(r#"{"Global Quote": {}}"#).unwrap();
+        assert_eq!(unknown.into_quote("NOPE").unwrap_err().to_string(), "no quote for NOPE");
+
+        let garbled: AvQuoteResponse = serde_json::from_str(
+            r#"{"Global Quote": {"05. price": "n/a", "07. latest trading day": "2025-01-02"}}"#,
+        )
+        .unwrap();
+        assert_eq!(garbled.into_quote("IBM").unwrap_err().to_string(), "invalid price for IBM");
+    }
+
+    #[test]
+    fn polygon_quotes_follow_the_session() {
+        let trade = r#""lastTrade": {"p": 190.25, "t": 1735830060000000000},"#;
+        let open = ticker(189.0, trade).into_quote("AAPL", Session::Open).unwrap();
+        assert_eq!((open.price, open.as_of), (190.25, 1_735_830_060));
+
+        let closed = ticker(189.0, trade).into_quote("AAPL", Session::Closed).unwrap();
+        assert_eq!((closed.price, closed.as_of), (189.0, 1_735_830_000));
+
+        // Before the first trade of the day the previous close stands
+        let early = ticker(0.0, "").into_quote("AAPL", Session::Closed).unwrap();
+        assert_eq!(early.price, 180.5);
+        assert_eq!(
+            ticker(0.0, "").into_quote("AAPL", Session::Open).unwrap_err().to_string(),
+            "no trade for AAPL yet"
+        );
+    }
+}
@@ -0,0 +1,158 @@
+use alloy_primitives::Address;
+use anyhow::{anyhow, Context, Result};
+use common::{
+    config,
+    context::RunContext,
+    http::{self, fetch_json},
+    paginate::{Page, PageRequest, Paginator},
+    proxy,
+};
+use serde_json::Value;
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+/// Holder listing API settings from the service `kv` config
+struct HolderApi {
+    /// URL with a `{token}` placeholder, e.g. `https://api.example.com/tokens/{token}/holders`
+    url: String,
+    /// Dotted path to the array of holders, each an address or an object with `address`
+    holders_field: String,
+    /// Dotted path to the next-page cursor, missing or null on the last page
+    cursor_field: String,
+    /// Query parameter the cursor is sent back in
+    cursor_param: String,
+}
+
+impl HolderApi {
+    fn from_env() -> Result<Self> {
+        let url = config::string("holder_api_url")
+            .context("holder_api_url must be set when the request has no holders")?;
+        Ok(Self {
+            url,
+            holders_field: config::string_or("holders_field", "holders"),
+            cursor_field: config::string_or("cursor_field", "next"),
+            cursor_param: config::string_or("cursor_param", "cursor"),
+        })
+    }
+
+    fn page_url(&self, token: Address, request: &PageRequest) -> String {
+        let url = self.url.replace("{token}", &token.to_string());
+        match request {
+            PageRequest::Cursor(cursor) => {
+                let sep = if url.contains('?') { '&' } else { '?' };
+                format!("{url}{sep}{}={}", self.cursor_param, http::percent_encode(cursor))
+            }
+            _ => url,
+        }
+    }
+
+    async fn page(&self, token: Address, request: PageRequest) -> Result<Page<Address>> {
+        let mut req = http_request_get(&self.page_url(token, &request))?;
+        req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+        proxy::apply(&mut req)?;
+        self.parse_page(&fetch_json(req).await?)
+    }
+
+    /// The holders and next-page cursor of a listing response
+    fn parse_page(&self, json: &Value) -> Result<Page<Address>> {
+        let holders = lookup(json, &self.holders_field)
+            .and_then(Value::as_array)
+            .ok_or_else(|| anyhow!("{} missing from holder listing", self.holders_field))?
+            .iter()
+            .map(|holder| {
+                let address = holder.get("address").unwrap_or(holder);
+                address
+                    .as_str()
+                    .ok_or_else(|| anyhow!("invalid holder entry {holder}"))?
+                    .parse()
+                    .with_context(|| format!("invalid holder address {address}"))
+            })
+            .collect::<Result<Vec<Address>>>()?;
+        let cursor = lookup(json, &self.cursor_field).and_then(Value::as_str).map(String::from);
+        Ok(Page::with_cursor(holders, cursor))
+    }
+}
+
+fn lookup<'a>(json: &'a Value, path: &str) -> Option<&'a Value> {
+    path.split('.').try_fold(json, |value, key| value.get(key))
+}
+
+/// Lists the token holders from `holder_api_url`, following its cursor up to `max_pages`
+pub async fn list(ctx: &RunContext, token: Address) -> Result<Vec<Address>> {
+    let api = HolderApi::from_env()?;
+    let listing = Paginator::from_env()?
+        .collect(ctx, PageRequest::First, |request| api.page(token, request))
+        .await?;
+    if !listing.complete {
+        return Err(anyhow!("holder listing has more than {} pages", listing.pages));
+    }
+    Ok(listing.items)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloy_primitives::address;
+    use serde_json::json;
+
+    const TOKEN: Address = address!("A0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48");
+
+    fn holder_api(url: &str) -> HolderApi {
+        HolderApi {
+            url: url.to_string(),
+            holders_field: "data.items".to_string(),
+            cursor_field: "data.next".to_string(),
+            cursor_param: "after".to_string(),
+        }
+    }
+
+    #[test]
+    fn cursor_is_sent_back_as_a_query_parameter() {
+        let api = holder_api("https://api.example.com/tokens/{token}/holders");
+        assert_eq!(
+            api.page_url(TOKEN, &PageRequest::First),
+            format!("https://api.example.com/tokens/{TOKEN}/holders")
+        );
+        assert_eq!(
+            api.page_url(TOKEN, &PageRequest::Cursor("a b/c".to_string())),
+            format!("https://api.example.com/tokens/{TOKEN}/holders?after=a%20b%2Fc")
+        );
+        let api = holder_api("https://api.example.com/holders?token={token}");
+        assert_eq!(
+            api.page_url(TOKEN, &PageRequest::Cursor("2".to_string())),
+            format!("https://api.example.com/holders?token={TOKEN}&after=2")
+        );
+    }
+
+    #[test]
+    fn holders_are_addresses_or_objects() {
+        let page = holder_api("").parse_page(&json!({"data": {
+            "items": ["0x1111111111111111111111111111111111111111",
+                      {"address": "0x2222222222222222222222222222222222222222", "balance": "5"}],
+            "next": "page2"
+        }}));
+        let page = page.unwrap();
+        assert_eq!(
+            page.items,
+            [
+                address!("1111111111111111111111111111111111111111"),
+                address!("2222222222222222222222222222222222222222")
+            ]
+        );
+        assert_eq!(page.next, Some(PageRequest::Cursor("page2".to_string())));
+    }
+
+    #[test]
+    fn last_page_has_no_cursor() {
+        let page =
+            holder_api("").parse_page(&json!({"data": {"items": [], "next": null}})).unwrap();
+        assert_eq!(page.next, None);
+    }
+
+    #[test]
+    fn malformed_listings_are_errors() {
+        assert!(holder_api("").parse_page(&json!({"items": []})).is_err());
+        assert!(holder_api("").parse_page(&json!({"data": {"items": [42]}})).is_err());
+        assert!(holder_api("").parse_page(&json!({"data": {"items": ["0x1234"]}})).is_err());
+    }
+}
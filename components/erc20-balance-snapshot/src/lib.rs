@@ -0,0 +1,322 @@
+mod holders;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, host::get_eth_chain_config, Guest, TriggerAction};
+use alloy_primitives::{Address, B256, U256};
+use alloy_provider::Provider;
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    evm,
+    fan_out::FanOut,
+    ipfs, json_schema,
+    merkle::{self, MerkleTree},
+    output::{self, Computed},
+    panic_guard,
+};
+use serde::{Deserialize, Serialize};
+use wstd::runtime::block_on;
+
+/// Upper bound on the number of holders in one snapshot, overridable with `max_holders`
+const DEFAULT_MAX_HOLDERS: usize = 1_000;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["snapshot"];
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let request: SnapshotRequest = json_schema::from_slice(REQUEST_SCHEMA, trim_padding(&req))
+        .map_err(|e| format!("Invalid snapshot request: {}", e))?;
+    println!("request: {:?}", request);
+
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let snapshot = block_on(async {
+            let mut snapshot = take_snapshot(&ctx, request.clone()).await?;
+            // Only the root goes on-chain, the proofs are published for claimants
+            if let Some(api_url) = ipfs::api_url_from_env() {
+                let proofs = canonical_json::to_vec(&snapshot).map_err(|e| e.to_string())?;
+                let cid = ctx
+                    .run(ipfs::add(&api_url, "snapshot.json", "application/json", &proofs))
+                    .await
+                    .map_err(|e| e.to_string())?
+                    .map_err(|e| format!("Failed to upload proofs: {}", e))?;
+                snapshot.proofs_cid = Some(cid);
+            }
+            Ok::<_, String>(snapshot)
+        })?;
+        println!("snapshot: {} holders, root {}", snapshot.holders, snapshot.root);
+
+        let feed_id = format!("balances:{}@{}", snapshot.token, snapshot.block_number);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::BalanceSnapshot {
+                    token: snapshot.token,
+                    blockNumber: snapshot.block_number,
+                    root: snapshot.root,
+                    holders: U256::from(snapshot.holders),
+                    totalBalance: snapshot.total_balance,
+                    proofsCid: snapshot.proofs_cid.clone().unwrap_or_default(),
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => {
+                canonical_json::to_vec(&snapshot).map_err(|e| e.to_string())?
+            }
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// Trailing NUL bytes are left over when the input was sent as bytes32
+fn trim_padding(input: &[u8]) -> &[u8] {
+    let len = input.iter().rposition(|b| *b != 0).map_or(0, |i| i + 1);
+    &input[..len]
+}
+
+/// Schema of [`SnapshotRequest`], checked before it is deserialized
+const REQUEST_SCHEMA: &str = include_str!("../schemas/snapshot_request.schema.json");
+
+/// Trigger input: the token, the block to read at (the trigger block, or the
+/// latest for CLI input, when omitted) and
+/// the holders, which are listed from `holder_api_url` when omitted
+#[derive(Debug, Clone, Deserialize)]
+pub struct SnapshotRequest {
+    token: Address,
+    #[serde(default)]
+    block: Option<u64>,
+    #[serde(default)]
+    holders: Option<Vec<Address>>,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct Snapshot {
+    token: Address,
+    block_number: u64,
+    /// Merkle root over `(holder, balance)` leaves, so a holder can prove their
+    /// balance against it with OpenZeppelin's `MerkleProof`
+    root: B256,
+    holders: usize,
+    total_balance: U256,
+    balances: Vec<Balance>,
+    /// IPFS CID of this snapshot with every proof, when `ipfs_api_url` is set
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    proofs_cid: Option<String>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct Balance {
+    holder: Address,
+    balance: U256,
+    /// Merkle proof of `(holder, balance)` against the snapshot root
+    proof: Vec<B256>,
+}
+
+async fn take_snapshot(ctx: &RunContext, request: SnapshotRequest) -> Result<Snapshot, String> {
+    let chain_name = config::string_or("chain_name", "local");
+    let endpoint = get_eth_chain_config(&chain_name)
+        .and_then(|c| c.http_endpoint)
+        .ok_or_else(|| format!("No http endpoint configured for chain {}", chain_name))?;
+    let provider = evm::provider(&endpoint).map_err(|e| e.to_string())?;
+    let max_holders =
+        config::parse_or("max_holders", DEFAULT_MAX_HOLDERS).map_err(|e| e.to_string())?;
+
+    let holders = match request.holders {
+        Some(holders) => holders,
+        None => holders::list(ctx, request.token).await.map_err(|e| e.to_string())?,
+    };
+    let holders = unique_holders(holders, max_holders)?;
+
+    // Every balance is read at the same block so operators agree on the snapshot
+    let block_number = match request.block.or_else(|| ctx.pinned_height(&chain_name)) {
+        Some(block) => block,
+        None => ctx
+            .run(provider.get_block_number())
+            .await
+            .map_err(|e| e.to_string())?
+            .map_err(|e| format!("Failed to get block number: {}", e))?,
+    };
+
+    let fan_out = FanOut::from_env().map_err(|e| e.to_string())?;
+    let (provider, token) = (&provider, request.token);
+    let amounts = fan_out
+        .try_join(
+            ctx,
+            holders.iter().map(|holder| async move {
+                let call = solidity::IERC20::balanceOfCall { account: *holder };
+                evm::call(provider, token, &call, Some(block_number)).await.map(|b| b._0)
+            }),
+        )
+        .await
+        .map_err(|e| e.to_string())?;
+
+    build_snapshot(token, block_number, holders, amounts)
+}
+
+/// `holders` sorted and deduplicated, at most `max_holders` of them
+fn unique_holders(mut holders: Vec<Address>, max_holders: usize) -> Result<Vec<Address>, String> {
+    holders.sort();
+    holders.dedup();
+    if holders.len() > max_holders {
+        return Err(format!("{} holders exceeds max_holders {}", holders.len(), max_holders));
+    }
+    Ok(holders)
+}
+
+/// The snapshot of `holders` with their `amounts` at `block_number`: the
+/// Merkle tree over the balances, a proof for each and their total
+fn build_snapshot(
+    token: Address,
+    block_number: u64,
+    holders: Vec<Address>,
+    amounts: Vec<U256>,
+) -> Result<Snapshot, String> {
+    let leaves: Vec<B256> = holders
+        .iter()
+        .zip(&amounts)
+        .map(|(holder, balance)| merkle::standard_leaf(&(*holder, *balance)))
+        .collect();
+    let tree = MerkleTree::new(leaves.clone()).map_err(|e| e.to_string())?;
+    let total_balance = amounts
+        .iter()
+        .try_fold(U256::ZERO, |total, balance| total.checked_add(*balance))
+        .ok_or("Total balance overflows uint256")?;
+    let balances: Vec<Balance> = holders
+        .into_iter()
+        .zip(amounts)
+        .zip(leaves)
+        .map(|((holder, balance), leaf)| Balance {
+            holder,
+            balance,
+            proof: tree.proof(leaf).unwrap_or_default(),
+        })
+        .collect();
+
+    Ok(Snapshot {
+        token,
+        block_number,
+        root: tree.root(),
+        holders: balances.len(),
+        total_balance,
+        balances,
+        proofs_cid: None,
+    })
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        interface IERC20 {
+            function balanceOf(address account) external view returns (uint256);
+        }
+
+        struct BalanceSnapshot {
+            address token;
+            uint64 blockNumber;
+            bytes32 root;
+            uint256 holders;
+            uint256 totalBalance;
+            string proofsCid;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloy_primitives::address;
+
+    const TOKEN: Address = address!("A0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48");
+    const ALICE: Address = address!("1111111111111111111111111111111111111111");
+    const BOB: Address = address!("2222222222222222222222222222222222222222");
+    const CAROL: Address = address!("3333333333333333333333333333333333333333");
+
+    #[test]
+    fn request_parses_from_padded_input() {
+        let mut padded = format!(r#"{{"token":"{TOKEN}","block":19000000}}"#).into_bytes();
+        padded.extend([0; 8]);
+        let request: SnapshotRequest =
+            json_schema::from_slice(REQUEST_SCHEMA, trim_padding(&padded)).unwrap();
+        assert_eq!(
+            (request.token, request.block, request.holders),
+            (TOKEN, Some(19_000_000), None)
+        );
+
+        let unknown = format!(r#"{{"token":"{TOKEN}","chain":"base"}}"#);
+        assert!(
+            json_schema::from_slice::<SnapshotRequest>(REQUEST_SCHEMA, unknown.as_bytes()).is_err()
+        );
+    }
+
+    #[test]
+    fn holders_are_sorted_deduplicated_and_capped() {
+        assert_eq!(unique_holders(vec![CAROL, ALICE, CAROL, BOB], 3), Ok(vec![ALICE, BOB, CAROL]));
+        assert_eq!(
+            unique_holders(vec![CAROL, ALICE, BOB], 2),
+            Err("3 holders exceeds max_holders 2".to_string())
+        );
+    }
+
+    #[test]
+    fn every_balance_proves_against_the_root() {
+        let amounts = vec![U256::from(5), U256::ZERO, U256::from(7)];
+        let snapshot = build_snapshot(TOKEN, 42, vec![ALICE, BOB, CAROL], amounts).unwrap();
+        assert_eq!((snapshot.holders, snapshot.block_number), (3, 42));
+        assert_eq!(snapshot.total_balance, U256::from(12));
+        for balance in &snapshot.balances {
+            let leaf = merkle::standard_leaf(&(balance.holder, balance.balance));
+            assert!(merkle::verify(snapshot.root, leaf, &balance.proof));
+        }
+        // A claimed balance other than the snapshot's does not prove
+        let forged = merkle::standard_leaf(&(BOB, U256::from(1)));
+        assert!(!merkle::verify(snapshot.root, forged, &snapshot.balances[1].proof));
+    }
+
+    #[test]
+    fn snapshot_is_independent_of_holder_order() {
+        let snapshot = |holders: Vec<Address>, amounts: Vec<U256>| {
+            let holders = unique_holders(holders, 10).unwrap();
+            build_snapshot(TOKEN, 42, holders, amounts).unwrap().root
+        };
+        let amounts = vec![U256::from(5), U256::from(5), U256::from(5)];
+        assert_eq!(
+            snapshot(vec![ALICE, BOB, CAROL], amounts.clone()),
+            snapshot(vec![CAROL, BOB, ALICE, BOB], amounts)
+        );
+    }
+
+    #[test]
+    fn total_balance_overflow_is_an_error() {
+        let amounts = vec![U256::MAX, U256::from(1)];
+        assert_eq!(
+            build_snapshot(TOKEN, 42, vec![ALICE, BOB], amounts).unwrap_err(),
+            "Total balance overflows uint256"
+        );
+    }
+}
@@ -0,0 +1,241 @@
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, host::get_eth_chain_config, Guest, TriggerAction};
+use alloy_primitives::{Address, B256, U256};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    evm,
+    output::{self, Computed},
+    panic_guard,
+};
+use serde::{Deserialize, Serialize};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["metadata"];
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let token = parse_token(&req)?;
+    println!("token: {}", token);
+
+    let chain_name = config::string_or("chain_name", "local");
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let read_at = read_height(ctx.pinned_height(&chain_name))?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let metadata = block_on(async {
+            ctx.run(get_metadata(&chain_name, token, read_at)).await.map_err(|e| e.to_string())?
+        })?;
+        println!("metadata: {:?}", metadata);
+
+        encode(&metadata, dest)
+    })?;
+    Ok(Some(output))
+}
+
+/// The token address a trigger asks about, NUL padding and whitespace
+/// trimmed
+fn parse_token(req: &[u8]) -> Result<Address, String> {
+    let input = std::str::from_utf8(req).map_err(|e| e.to_string())?;
+    input.trim_end_matches('\0').trim().parse().map_err(|e| format!("Invalid token address: {}", e))
+}
+
+/// The block to read at: the `block_number` kv config, else the trigger's
+/// `pinned` block, else the latest
+fn read_height(pinned: Option<u64>) -> Result<Option<u64>, String> {
+    Ok(config::parse("block_number").map_err(|e| e.to_string())?.or(pinned))
+}
+
+/// `metadata` encoded for `dest`: the `TokenMetadata` struct on-chain,
+/// canonical JSON for the CLI
+fn encode(metadata: &TokenMetadata, dest: Destination) -> Result<Computed, String> {
+    let feed_id = format!("erc20:{}:{}", metadata.chain_id, metadata.token);
+    let payload = match dest {
+        Destination::Ethereum => solidity::TokenMetadata {
+            chainId: metadata.chain_id,
+            token: metadata.token,
+            name: metadata.name.clone(),
+            symbol: metadata.symbol.clone(),
+            decimals: metadata.decimals,
+            totalSupply: metadata.total_supply,
+        }
+        .abi_encode(),
+        Destination::CliOutput => canonical_json::to_vec(metadata).map_err(|e| e.to_string())?,
+    };
+    Ok(Computed::new(feed_id, payload))
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct TokenMetadata {
+    chain_id: u64,
+    token: Address,
+    name: String,
+    symbol: String,
+    decimals: u8,
+    total_supply: U256,
+}
+
+/// Reads the token's ERC-20 metadata on `chain_name`, optionally pinned to `block`
+async fn get_metadata(
+    chain_name: &str,
+    token: Address,
+    block: Option<u64>,
+) -> Result<TokenMetadata, String> {
+    let config =
+        get_eth_chain_config(chain_name).ok_or_else(|| format!("Unknown chain {}", chain_name))?;
+    let chain_id = config.chain_id.parse().map_err(|e| format!("Invalid chain id: {}", e))?;
+    let endpoint = config
+        .http_endpoint
+        .ok_or_else(|| format!("No http endpoint configured for chain {}", chain_name))?;
+    let provider = evm::provider(&endpoint).map_err(|e| e.to_string())?;
+
+    // Some early tokens (MKR, SAI) return bytes32 instead of string
+    let name = match evm::call(&provider, token, &solidity::IERC20::nameCall {}, block).await {
+        Ok(name) => name._0,
+        Err(_) => evm::call(&provider, token, &solidity::IERC20Bytes32::nameCall {}, block)
+            .await
+            .map(|name| bytes32_to_string(name._0))
+            .map_err(|e| e.to_string())?,
+    };
+    let symbol = match evm::call(&provider, token, &solidity::IERC20::symbolCall {}, block).await {
+        Ok(symbol) => symbol._0,
+        Err(_) => evm::call(&provider, token, &solidity::IERC20Bytes32::symbolCall {}, block)
+            .await
+            .map(|symbol| bytes32_to_string(symbol._0))
+            .map_err(|e| e.to_string())?,
+    };
+    let decimals = evm::call(&provider, token, &solidity::IERC20::decimalsCall {}, block)
+        .await
+        .map_err(|e| e.to_string())?
+        ._0;
+    let total_supply = evm::call(&provider, token, &solidity::IERC20::totalSupplyCall {}, block)
+        .await
+        .map_err(|e| e.to_string())?
+        ._0;
+
+    Ok(TokenMetadata { chain_id, token, name, symbol, decimals, total_supply })
+}
+
+/// Decodes a NUL-padded bytes32 string
+fn bytes32_to_string(value: B256) -> String {
+    let len = value.iter().position(|b| *b == 0).unwrap_or(value.len());
+    String::from_utf8_lossy(&value[..len]).into_owned()
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        interface IERC20 {
+            function name() external view returns (string memory);
+            function symbol() external view returns (string memory);
+            function decimals() external view returns (uint8);
+            function totalSupply() external view returns (uint256);
+        }
+
+        interface IERC20Bytes32 {
+            function name() external view returns (bytes32);
+            function symbol() external view returns (bytes32);
+        }
+
+        struct TokenMetadata {
+            uint64 chainId;
+            address token;
+            string name;
+            string symbol;
+            uint8 decimals;
+            uint256 totalSupply;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloy_primitives::{address, b256};
+
+    const USDC: Address = address!("A0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48");
+
+    fn usdc() -> TokenMetadata {
+        TokenMetadata {
+            chain_id: 1,
+            token: USDC,
+            name: "USD Coin".to_string(),
+            symbol: "USDC".to_string(),
+            decimals: 6,
+            total_supply: U256::from(25_000_000_000_000_000u64),
+        }
+    }
+
+    #[test]
+    fn token_parses_from_padded_input() {
+        let padded = format!("{USDC} \0\0");
+        assert_eq!(parse_token(padded.as_bytes()), Ok(USDC));
+        assert!(parse_token(b"0x1234").is_err());
+        assert!(parse_token(&[0xff, 0xfe]).is_err());
+    }
+
+    #[test]
+    fn configured_block_wins_over_the_pinned_one() {
+        std::env::set_var("block_number", "19000000");
+        assert_eq!(read_height(Some(42)), Ok(Some(19_000_000)));
+        std::env::set_var("block_number", "latest");
+        assert!(read_height(Some(42)).unwrap_err().starts_with("Invalid block_number"));
+        std::env::remove_var("block_number");
+        assert_eq!(read_height(Some(42)), Ok(Some(42)));
+        assert_eq!(read_height(None), Ok(None));
+    }
+
+    #[test]
+    fn onchain_output_is_the_metadata_struct() {
+        let computed = encode(&usdc(), Destination::Ethereum).unwrap();
+        assert_eq!(computed.feed_id, format!("erc20:1:{USDC}"));
+        let decoded = solidity::TokenMetadata::abi_decode(&computed.payload, true).unwrap();
+        assert_eq!((decoded.chainId, decoded.token), (1, USDC));
+        assert_eq!((decoded.name.as_str(), decoded.symbol.as_str()), ("USD Coin", "USDC"));
+        assert_eq!(decoded.decimals, 6);
+        assert_eq!(decoded.totalSupply, U256::from(25_000_000_000_000_000u64));
+    }
+
+    #[test]
+    fn cli_output_is_canonical_json() {
+        let computed = encode(&usdc(), Destination::CliOutput).unwrap();
+        let json: serde_json::Value = serde_json::from_slice(&computed.payload).unwrap();
+        assert_eq!(json["symbol"], "USDC");
+        assert_eq!(json["decimals"], 6);
+        assert_eq!(json["token"], serde_json::to_value(USDC).unwrap());
+        assert_eq!(computed.payload, canonical_json::to_vec(&json).unwrap());
+    }
+
+    #[test]
+    fn bytes32_names_stop_at_the_padding() {
+        let maker = b256!("4d616b6572000000000000000000000000000000000000000000000000000000");
+        assert_eq!(bytes32_to_string(maker), "Maker");
+        assert_eq!(bytes32_to_string(B256::ZERO), "");
+    }
+}
@@ -0,0 +1,79 @@
+//! ABI-encoded price payload.
+//!
+//! Version 1 of the Ethereum payload is the canonical JSON of the feed,
+//! which consumer contracts have to parse on-chain. Version 2, selected with
+//! the `price_payload_version` kv config, is `abi.encode(PriceFeed)` with the
+//! `ITypes.PriceFeed` struct, so a contract reads it with
+//! `abi.decode(payload, (ITypes.PriceFeed))`.
+//!
+//! Several values, such as an index and its constituents, are encoded as
+//! the parameters of a multi-value return, with one array per column, so a
+//! contract decodes them in one `abi.decode` without parsing nested structs.
+
+use crate::eip712::PRICE_DECIMALS;
+use alloy_primitives::U256;
+use alloy_sol_types::SolValue;
+use anyhow::{anyhow, Context, Result};
+use common::{
+    clock, config,
+    fixed_point::{self, Rounding},
+    types::PriceFeedData,
+};
+
+/// Layout of the Ethereum payload
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum PayloadVersion {
+    /// Canonical JSON bytes
+    Json = 1,
+    /// ABI-encoded `PriceFeed` struct
+    Struct = 2,
+}
+
+impl PayloadVersion {
+    /// Reads `price_payload_version`, JSON when unset
+    pub fn from_env() -> Result<Self> {
+        match config::parse_or("price_payload_version", 1u8)? {
+            1 => Ok(Self::Json),
+            2 => Ok(Self::Struct),
+            other => Err(anyhow!("Invalid price_payload_version: {other}, expected 1 or 2")),
+        }
+    }
+}
+
+/// Fixed-point decimals of basket weights in ABI payloads
+pub const WEIGHT_DECIMALS: u8 = 18;
+
+/// Converts the price feed into its ABI struct, with the price rounded to
+/// [`PRICE_DECIMALS`] and the provider timestamp in unix seconds
+pub fn to_struct(data: &PriceFeedData) -> Result<solidity::PriceFeed> {
+    Ok(solidity::PriceFeed {
+        symbol: data.symbol.clone(),
+        price: price(&data.symbol, data.price)?,
+        decimals: PRICE_DECIMALS,
+        timestamp: clock::parse_utc(&data.timestamp)?,
+    })
+}
+
+/// `price` of `what` rounded to [`PRICE_DECIMALS`]
+pub fn price(what: &str, price: f64) -> Result<U256> {
+    fixed_point::from_f64(price, PRICE_DECIMALS, Rounding::HalfUp)
+        .with_context(|| format!("price {price} of {what}"))
+}
+
+/// Basket `weight` of `what` rounded to [`WEIGHT_DECIMALS`]
+pub fn weight(what: &str, weight: f64) -> Result<U256> {
+    fixed_point::from_f64(weight, WEIGHT_DECIMALS, Rounding::HalfUp)
+        .with_context(|| format!("weight {weight} of {what}"))
+}
+
+/// `abi.encode(PriceFeed)` of the price feed
+pub fn encode(data: &PriceFeedData) -> Result<Vec<u8>> {
+    Ok(to_struct(data)?.abi_encode())
+}
+
+pub mod solidity {
+    use alloy_sol_macro::sol;
+    pub use ITypes::*;
+
+    sol!("../../src/interfaces/ITypes.sol");
+}
@@ -0,0 +1,141 @@
+use crate::PriceFeedData;
+use alloy_primitives::{Address, B256, U256};
+use alloy_sol_types::{Eip712Domain, SolStruct, SolValue};
+use anyhow::{anyhow, Context, Result};
+use common::{
+    address_book::AddressBook,
+    config,
+    fixed_point::{self, Rounding},
+};
+use std::borrow::Cow;
+
+/// EIP-712 domain name and version, must match the verifying contract
+pub const DOMAIN_NAME: &str = "WavsPriceOracle";
+pub const DOMAIN_VERSION: &str = "1";
+
+/// Default fixed-point decimals used for the typed `price` field
+pub const PRICE_DECIMALS: u8 = 8;
+
+/// Typed-data settings resolved from the service config
+pub struct TypedDataConfig {
+    pub domain: Eip712Domain,
+    pub decimals: u8,
+}
+
+/// Builds the EIP-712 domain from the service `kv` config.
+///
+/// The chain ID and verifying contract come either from `eip712_chain_id` and
+/// `eip712_verifying_contract`, or from the address book entry named by
+/// `eip712_network`. Returns `None` when neither is set, in which case the
+/// component keeps submitting the raw JSON payload.
+pub fn config_from_env() -> Result<Option<TypedDataConfig>> {
+    let (chain_id, verifying_contract, decimals) =
+        if let Some(verifying_contract) = config::parse::<Address>("eip712_verifying_contract")? {
+            let chain_id: u64 = config::parse("eip712_chain_id")?.ok_or_else(|| {
+                anyhow!("eip712_chain_id is required when eip712_verifying_contract is set")
+            })?;
+            (chain_id, verifying_contract, PRICE_DECIMALS)
+        } else if let Some(network) = config::string("eip712_network") {
+            let book = AddressBook::from_env()?;
+            let entry = book.require(&network)?;
+            (entry.chain_id, entry.submit_address, entry.decimals)
+        } else {
+            return Ok(None);
+        };
+
+    Ok(Some(TypedDataConfig { domain: domain(chain_id, verifying_contract), decimals }))
+}
+
+/// The oracle's EIP-712 domain on `chain_id`
+pub fn domain(chain_id: u64, verifying_contract: Address) -> Eip712Domain {
+    Eip712Domain::new(
+        Some(Cow::Borrowed(DOMAIN_NAME)),
+        Some(Cow::Borrowed(DOMAIN_VERSION)),
+        Some(U256::from(chain_id)),
+        Some(verifying_contract),
+        None,
+    )
+}
+
+/// Converts the price feed into its typed-data struct, rounding the price
+/// to `decimals`
+pub fn to_typed(
+    trigger_id: u64,
+    data: &PriceFeedData,
+    decimals: u8,
+) -> Result<solidity::PriceFeed> {
+    let price = fixed_point::from_f64(data.price, decimals, Rounding::HalfUp)
+        .with_context(|| format!("price {} of {}", data.price, data.symbol))?;
+    Ok(solidity::PriceFeed {
+        triggerId: trigger_id,
+        symbol: data.symbol.clone(),
+        price,
+        timestamp: data.timestamp.clone(),
+    })
+}
+
+/// Returns the EIP-712 signing hash: `keccak256("\x19\x01" ‖ domainSeparator ‖ hashStruct(feed))`
+pub fn signing_hash(domain: &Eip712Domain, feed: &solidity::PriceFeed) -> B256 {
+    feed.eip712_signing_hash(domain)
+}
+
+/// ABI-encodes `(PriceFeed, bytes32 digest)` so the consumer contract can
+/// recompute the digest and check it against operator typed-data signatures.
+pub fn encode_typed_payload(domain: &Eip712Domain, feed: solidity::PriceFeed) -> Vec<u8> {
+    let digest = signing_hash(domain, &feed);
+    (feed, digest).abi_encode_params()
+}
+
+pub mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        struct PriceFeed {
+            uint64 triggerId;
+            string symbol;
+            uint256 price;
+            string timestamp;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloy_primitives::{address, b256};
+
+    fn feed(price: f64) -> PriceFeedData {
+        PriceFeedData {
+            symbol: "ETH".to_string(),
+            timestamp: "2025-03-01T12:00:00.000Z".to_string(),
+            price,
+            signature: None,
+        }
+    }
+
+    #[test]
+    fn prices_scale_without_float_error() {
+        let typed = to_typed(7, &feed(1.1), PRICE_DECIMALS).unwrap();
+        assert_eq!(typed.price, U256::from(110_000_000u64));
+        let typed = to_typed(7, &feed(0.1 + 0.2), 18).unwrap();
+        assert_eq!(typed.price, U256::from(300_000_000_000_000_040u64));
+        assert!(to_typed(7, &feed(-1.0), PRICE_DECIMALS).is_err());
+        assert!(to_typed(7, &feed(f64::NAN), PRICE_DECIMALS).is_err());
+    }
+
+    #[test]
+    fn payload_carries_the_signing_hash() {
+        let domain = domain(1, address!("5FbDB2315678afecb367f032d93F642f64180aa3"));
+        let typed = to_typed(7, &feed(1.1), PRICE_DECIMALS).unwrap();
+        // keccak256("\x19\x01" ‖ domainSeparator ‖ hashStruct(feed)), computed by hand
+        let expected = b256!("01ac7f3391a32a8ec90713a258728eb138ed55d77d390c77ca042ff80d4de7ac");
+        assert_eq!(signing_hash(&domain, &typed), expected);
+
+        let payload = encode_typed_payload(&domain, typed.clone());
+        let (decoded, digest) =
+            <(solidity::PriceFeed, B256)>::abi_decode_params(&payload, true).unwrap();
+        assert_eq!(decoded.price, typed.price);
+        assert_eq!(decoded.symbol, typed.symbol);
+        assert_eq!(digest, expected);
+    }
+}
@@ -0,0 +1,273 @@
+use crate::{abi_feed, eip712::PRICE_DECIMALS, get_price_feeds, PriceFeedData};
+use alloy_sol_types::SolValue;
+use anyhow::{anyhow, Context, Result};
+use common::{clock, config, context::RunContext, json_schema};
+use serde::{Deserialize, Serialize};
+
+/// Trigger input selecting the index mode
+pub const INDEX_REQUEST: &str = "index";
+
+/// DeFi blue-chip basket (CoinMarketCap IDs for UNI, AAVE, MKR, LINK), used when
+/// no `index_basket` is configured
+const DEFAULT_BASKET: &str = "defi-bluechip:7083=0.25,7278=0.25,1518=0.25,1975=0.25";
+
+/// A weighted set of assets
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct Basket {
+    pub name: String,
+    pub assets: Vec<BasketAsset>,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct BasketAsset {
+    pub id: u64,
+    pub weight: f64,
+}
+
+/// Index value together with the constituent prices it was computed from
+#[derive(Debug, Serialize, Deserialize)]
+pub struct IndexData {
+    name: String,
+    value: f64,
+    timestamp: String,
+    constituents: Vec<Constituent>,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct Constituent {
+    id: u64,
+    symbol: String,
+    price: f64,
+    weight: f64,
+}
+
+/// Maximum number of assets a caller-supplied basket may contain
+pub const MAX_BASKET_ASSETS: usize = 16;
+
+/// Allowed deviation of the summed weights from 1
+pub const WEIGHT_TOLERANCE: f64 = 1e-6;
+
+/// Schema of [`IndexRequest`], checked before it is deserialized
+const REQUEST_SCHEMA: &str = include_str!("../schemas/index_request.schema.json");
+
+/// Caller-supplied basket carried in the trigger payload, e.g.
+/// `{"index":{"name":"btc-eth","assets":[{"id":1,"weight":0.6},{"id":1027,"weight":0.4}]}}`
+#[derive(Debug, Deserialize)]
+struct IndexRequest {
+    index: Basket,
+}
+
+/// Parses the (possibly bytes32-padded) trigger input.
+///
+/// Returns the configured basket for a plain `index` request, the caller's basket
+/// for a JSON index request, and `None` when the input is not an index request.
+pub fn parse_index_request(input: &str) -> Result<Option<Basket>> {
+    let input = input.trim_end_matches('\0').trim();
+    if input == INDEX_REQUEST {
+        return Basket::from_env().map(Some);
+    }
+    if input.starts_with('{') {
+        let req: IndexRequest = json_schema::from_slice(REQUEST_SCHEMA, input.as_bytes())
+            .context("invalid index request")?;
+        req.index.validate()?;
+        return Ok(Some(req.index));
+    }
+    Ok(None)
+}
+
+impl Basket {
+    /// Parses `name:id=weight,id=weight,...`
+    pub fn parse(s: &str) -> Result<Self> {
+        let (name, assets) = s.split_once(':').ok_or_else(|| anyhow!("missing basket name"))?;
+        let assets = assets
+            .split(',')
+            .map(|asset| {
+                let (id, weight) =
+                    asset.split_once('=').ok_or_else(|| anyhow!("invalid basket asset {asset}"))?;
+                Ok(BasketAsset {
+                    id: id.trim().parse().with_context(|| format!("invalid asset id {id}"))?,
+                    weight: weight
+                        .trim()
+                        .parse()
+                        .with_context(|| format!("invalid asset weight {weight}"))?,
+                })
+            })
+            .collect::<Result<Vec<_>>>()?;
+
+        let basket = Self { name: name.trim().to_string(), assets };
+        basket.validate()?;
+        Ok(basket)
+    }
+
+    /// Checks the basket size and that the weights are positive and sum to 1
+    pub fn validate(&self) -> Result<()> {
+        if self.assets.is_empty() {
+            return Err(anyhow!("basket {} has no assets", self.name));
+        }
+        if self.assets.len() > MAX_BASKET_ASSETS {
+            return Err(anyhow!(
+                "basket {} has {} assets, at most {MAX_BASKET_ASSETS} are allowed",
+                self.name,
+                self.assets.len()
+            ));
+        }
+        if let Some(asset) = self.assets.iter().find(|asset| !(asset.weight > 0.0)) {
+            return Err(anyhow!("asset {} has non-positive weight {}", asset.id, asset.weight));
+        }
+
+        let total: f64 = self.assets.iter().map(|asset| asset.weight).sum();
+        if (total - 1.0).abs() > WEIGHT_TOLERANCE {
+            return Err(anyhow!("basket {} weights sum to {total}, expected 1", self.name));
+        }
+        Ok(())
+    }
+
+    /// Loads the basket from the `index_basket` kv config, falling back to the default basket
+    pub fn from_env() -> Result<Self> {
+        Self::parse(&config::string_or("index_basket", DEFAULT_BASKET))
+    }
+}
+
+/// Enables [`Aggregation::Geometric`]
+pub const GEOMETRIC_EXPERIMENT: &str = "index-geometric";
+
+/// How constituent prices combine into the index value
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Aggregation {
+    /// `Σ weight × price`
+    Arithmetic,
+    /// `Π price ^ weight`, less dominated by the highest-priced constituent;
+    /// experimental
+    Geometric,
+}
+
+/// Fetches every constituent and computes the weighted index value
+pub async fn compute_index(
+    ctx: &RunContext,
+    basket: &Basket,
+    aggregation: Aggregation,
+) -> Result<IndexData, String> {
+    let ids: Vec<u64> = basket.assets.iter().map(|asset| asset.id).collect();
+    let feeds = get_price_feeds(ctx, &ids).await?;
+    Ok(build_index(basket, feeds, aggregation))
+}
+
+impl IndexData {
+    /// Encodes the index for payload version 2 as
+    /// `(string name, uint256 value, uint8 decimals, uint64 timestamp, uint64[] ids,
+    /// string[] symbols, uint256[] prices, uint256[] weights)`: prices and the
+    /// value have [`PRICE_DECIMALS`], weights [`abi_feed::WEIGHT_DECIMALS`]
+    pub fn abi_encode(&self) -> Result<Vec<u8>> {
+        let value = abi_feed::price(&self.name, self.value)?;
+        let timestamp = clock::parse_utc(&self.timestamp)?;
+        let ids: Vec<u64> = self.constituents.iter().map(|c| c.id).collect();
+        let symbols: Vec<String> = self.constituents.iter().map(|c| c.symbol.clone()).collect();
+        let prices = self
+            .constituents
+            .iter()
+            .map(|c| abi_feed::price(&c.symbol, c.price))
+            .collect::<Result<Vec<_>>>()?;
+        let weights = self
+            .constituents
+            .iter()
+            .map(|c| abi_feed::weight(&c.symbol, c.weight))
+            .collect::<Result<Vec<_>>>()?;
+        Ok((self.name.clone(), value, PRICE_DECIMALS, timestamp, ids, symbols, prices, weights)
+            .abi_encode_params())
+    }
+}
+
+fn build_index(basket: &Basket, feeds: Vec<PriceFeedData>, aggregation: Aggregation) -> IndexData {
+    let timestamp = feeds.iter().map(|feed| feed.timestamp.clone()).max().unwrap_or_default();
+    let constituents: Vec<Constituent> = basket
+        .assets
+        .iter()
+        .zip(feeds)
+        .map(|(asset, feed)| Constituent {
+            id: asset.id,
+            symbol: feed.symbol,
+            price: feed.price,
+            weight: asset.weight,
+        })
+        .collect();
+    let value = match aggregation {
+        Aggregation::Arithmetic => constituents.iter().map(|c| c.price * c.weight).sum(),
+        Aggregation::Geometric => constituents.iter().map(|c| c.price.powf(c.weight)).product(),
+    };
+
+    IndexData { name: basket.name.clone(), value, timestamp, constituents }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn feed(symbol: &str, price: f64, timestamp: &str) -> PriceFeedData {
+        PriceFeedData {
+            symbol: symbol.to_string(),
+            timestamp: timestamp.to_string(),
+            price,
+            signature: None,
+        }
+    }
+
+    #[test]
+    fn baskets_parse_and_validate() {
+        let basket = Basket::parse(DEFAULT_BASKET).unwrap();
+        assert_eq!(basket.name, "defi-bluechip");
+        assert_eq!(basket.assets.len(), 4);
+        assert_eq!(basket.assets[0], BasketAsset { id: 7083, weight: 0.25 });
+
+        for invalid in ["no-name", "b:", "b:1=x", "b:1=0.5", "b:1=0.5,2=0.6", "b:1=1,2=0"] {
+            assert!(Basket::parse(invalid).is_err(), "{invalid}");
+        }
+        let too_many: Vec<String> =
+            (0..=MAX_BASKET_ASSETS).map(|id| format!("{id}=0.0588235294117647")).collect();
+        assert!(Basket::parse(&format!("big:{}", too_many.join(","))).is_err());
+    }
+
+    #[test]
+    fn index_value_weights_constituent_prices() {
+        let basket = Basket::parse("pair:1=0.75,1027=0.25").unwrap();
+        let feeds = vec![
+            feed("BTC", 100.0, "2025-03-01T12:00:00.000Z"),
+            feed("ETH", 20.0, "2025-03-01T12:00:05.000Z"),
+        ];
+
+        let index = build_index(&basket, feeds.clone(), Aggregation::Arithmetic);
+        assert_eq!(index.value, 80.0);
+        assert_eq!(index.timestamp, "2025-03-01T12:00:05.000Z");
+        assert_eq!(index.constituents[1].id, 1027);
+        assert_eq!(index.constituents[1].symbol, "ETH");
+
+        let geometric = build_index(&basket, feeds, Aggregation::Geometric);
+        let expected = 100f64.powf(0.75) * 20f64.powf(0.25);
+        assert!((geometric.value - expected).abs() < 1e-9);
+    }
+
+    #[test]
+    fn callers_supply_baskets_as_json() {
+        let basket = parse_index_request(
+            r#"{"index":{"name":"btc-eth","assets":[{"id":1,"weight":0.6},{"id":1027,"weight":0.4}]}}"#,
+        )
+        .unwrap()
+        .unwrap();
+        assert_eq!(basket.name, "btc-eth");
+        assert_eq!(basket.assets[1], BasketAsset { id: 1027, weight: 0.4 });
+
+        // bytes32-padded plain input is not an index request
+        assert_eq!(parse_index_request("1\0\0\0").unwrap(), None);
+
+        for invalid in [
+            // Unknown field, rejected by the schema
+            r#"{"index":{"name":"x","assets":[{"id":1,"weight":1}]},"extra":1}"#,
+            // Negative ID
+            r#"{"index":{"name":"x","assets":[{"id":-1,"weight":1}]}}"#,
+            // Weights not summing to 1
+            r#"{"index":{"name":"x","assets":[{"id":1,"weight":0.5}]}}"#,
+            "{not json",
+        ] {
+            assert!(parse_index_request(invalid).is_err(), "{invalid}");
+        }
+    }
+}
@@ -1,74 +1,357 @@
+mod abi_feed;
+mod eip712;
+mod index;
+mod readback;
 mod trigger;
-use trigger::{decode_trigger_event, encode_trigger_output, Destination};
-use wavs_wasi_chain::http::{fetch_json, http_request_get};
+use trigger::{decode_trigger_event, Destination, TriggerBlock, TriggerRequest};
+use wavs_wasi_chain::http::http_request_get;
 pub mod bindings;
 use crate::bindings::{export, Guest, TriggerAction};
+use common::{
+    alloc_stats,
+    batch::Batcher,
+    canonical_json,
+    config::{self, Experiments},
+    context::RunContext,
+    cost, determinism,
+    envelope::{self, ComponentInfo},
+    fan_out::FanOut,
+    http::fetch_bytes,
+    http_cache::HttpCache,
+    http_headers::{HeaderRules, ANY_HOST},
+    mirrors::Mirrors,
+    output::{self, Computed},
+    panic_guard, proxy,
+    result_cache::ResultCache,
+    sanity::PriceBounds,
+    signed_response::ResponseVerifier,
+    types::PriceFeedData,
+    update_policy::{Decision, Submission, SubmissionStore, UpdatePolicy},
+};
 use serde::{Deserialize, Serialize};
-use wstd::{http::HeaderValue, runtime::block_on};
+use wstd::runtime::block_on;
+
+/// CoinMarketCap data API, the first of the `coinmarketcap_base_urls` mirrors by default
+const COINMARKETCAP_API_URL: &str = "https://api.coinmarketcap.com";
+
+/// Interval of the quote CoinMarketCap returns, overridable with `coinmarketcap_range`
+const DEFAULT_RANGE: &str = "1h";
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["price", "index"];
+
+/// Modes deployments can opt into with the `experimental` kv config
+const EXPERIMENTS: &[&str] = &[index::GEOMETRIC_EXPERIMENT];
 
 struct Component;
 export!(Component with_types_in bindings);
 
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
 impl Guest for Component {
     fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
-        let (trigger_id, req, dest) =
-            decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    config::embed(include_str!("../config.toml")).map_err(|e| e.to_string())?;
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
 
-        // Convert bytes to string and parse first char as u64
-        let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
-        println!("input id: {}", input);
+    // Convert bytes to string and parse first char as u64
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    println!("input id: {}", input);
 
-        let id = input.chars().next().ok_or("Empty input")?;
-        let id = id.to_digit(16).ok_or("Invalid hex digit")? as u64;
+    // Redelivered on-chain triggers get the answer that was already produced
+    let cache = result_cache(&dest, &block)?;
+    if let Some(cached) = cache.as_ref().and_then(|cache| cached_outcome(cache, trigger_id, &req)) {
+        println!("returning cached result for trigger {}", trigger_id);
+        return Ok(cached);
+    }
 
-        let res = block_on(async move {
-            let resp_data = get_price_feed(id).await?;
-            println!("resp_data: {:?}", resp_data);
-            serde_json::to_vec(&resp_data).map_err(|e| e.to_string())
-        })?;
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    // Only chain triggers are submitted, so only their results are read back
+    let watchdog = match (&dest, &block) {
+        (Destination::Ethereum, Some(_)) => {
+            readback::Watchdog::from_env().map_err(|e| e.to_string())?
+        }
+        _ => None,
+    };
+    let readback_flags = match &watchdog {
+        // Unchecked results stay pending for the next run
+        Some(watchdog) => block_on(watchdog.check(&ctx)).unwrap_or_else(|e| {
+            println!("readback failed: {e:#}");
+            0
+        }),
+        None => 0,
+    };
 
-        let output = match dest {
-            Destination::Ethereum => Some(encode_trigger_output(trigger_id, &res)),
-            Destination::CliOutput => Some(res),
-        };
+    let mut computed = None;
+    let output = determinism::run_checked(|| {
+        let result = compute(&ctx, trigger_id, input, &dest)?;
+        let output = output::encode(COMPONENT, trigger_id, dest, &result.computed)
+            .map_err(|e| format!("{:#}", e))?;
+        computed = Some(result);
         Ok(output)
+    })?;
+    let output = output::with_run_stats(dest, output).map_err(|e| format!("{:#}", e))?;
+    let update = match (&dest, &block, &computed) {
+        (Destination::Ethereum, Some(_), Some(result)) => update_decision(&ctx, result)?,
+        _ => Update::Always,
+    };
+    if let Update::Skip = update {
+        return Ok(None);
+    }
+    // Held for a batch, or the batch this result completes
+    let (output, batched) = match (&dest, &block) {
+        (Destination::Ethereum, Some(_)) => match Batcher::from_env().map_err(|e| e.to_string())? {
+            Some(batcher) => (
+                batcher
+                    .push(trigger_id, &output, ctx.clock().unix_secs())
+                    .map_err(|e| format!("{:#}", e))?,
+                true,
+            ),
+            None => (Some(output), false),
+        },
+        _ => (Some(output), false),
+    };
+    if let Some(cache) = &cache {
+        let own = if batched { None } else { output.as_deref() };
+        cache_outcome(cache, trigger_id, &req, own)?;
+    }
+    if let Some(output) = &output {
+        // Only now does the result count as submitted, not while it is held
+        if let (Update::Submit(store, submission), Some(result)) = (&update, &computed) {
+            store.put(&result.computed.feed_id, submission).map_err(|e| format!("{:#}", e))?;
+        }
+        if let Some(watchdog) = &watchdog {
+            if let Err(e) = watchdog.record(&ctx, output) {
+                println!("readback record failed: {e:#}");
+            }
+        }
+    }
+    // Copied once, after the determinism check may have computed twice
+    if let Some(result) = computed {
+        // The operator's own readback view stays off-chain
+        let copy = result.computed.with_flags(readback_flags);
+        block_on(output::deliver(&ctx, COMPONENT, trigger_id, &copy))
+            .map_err(|e| format!("{:#}", e))?;
     }
+    Ok(output)
 }
 
-async fn get_price_feed(id: u64) -> Result<PriceFeedData, String> {
-    let url = format!(
-        "https://api.coinmarketcap.com/data-api/v3/cryptocurrency/detail?id={}&range=1h",
-        id
-    );
+/// The result cache, for chain triggers only. Structured CLI requests with
+/// `format:"abi"` also go to [`Destination::Ethereum`], but pick their own
+/// trigger ID: caching them would answer a later chain trigger with that ID.
+fn result_cache(
+    dest: &Destination,
+    block: &Option<TriggerBlock>,
+) -> Result<Option<ResultCache>, String> {
+    match (dest, block) {
+        (Destination::Ethereum, Some(_)) => ResultCache::from_env().map_err(|e| e.to_string()),
+        _ => Ok(None),
+    }
+}
+
+/// Cache entry of a trigger whose result went into a batch. The batch it may
+/// have completed carries other triggers' results too, so a redelivery gets
+/// nothing to submit rather than the whole batch again.
+const QUEUED: &[u8] = &[];
+
+/// The cached outcome of `trigger_id`: its output, or `None` when its result
+/// was queued for a batch
+fn cached_outcome(cache: &ResultCache, trigger_id: u64, req: &[u8]) -> Option<Option<Vec<u8>>> {
+    let cached = cache.get(trigger_id, req)?;
+    Some((cached != QUEUED).then_some(cached))
+}
+
+/// Caches the trigger's own output, or [`QUEUED`] when `output` is `None`
+fn cache_outcome(
+    cache: &ResultCache,
+    trigger_id: u64,
+    req: &[u8],
+    output: Option<&[u8]>,
+) -> Result<(), String> {
+    cache.put(trigger_id, req, output.unwrap_or(QUEUED)).map_err(|e| e.to_string())
+}
 
-    let current_time = std::time::SystemTime::now().elapsed().unwrap().as_secs();
+/// A result before it is encoded for its destinations
+struct ComputedResult {
+    computed: Computed,
+    /// The single asset price, which update thresholds apply to
+    price: Option<f64>,
+}
 
-    let mut req = http_request_get(&url).map_err(|e| e.to_string())?;
-    req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
-    req.headers_mut().insert("Content-Type", HeaderValue::from_static("application/json"));
-    req.headers_mut()
-        .insert("User-Agent", HeaderValue::from_static("Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/132.0.0.0 Safari/537.36"));
-    req.headers_mut().insert(
-        "Cookie",
-        HeaderValue::from_str(&format!("myrandom_cookie={}", current_time)).unwrap(),
-    );
+/// What the `update_*` policy says about a chain-triggered result
+enum Update {
+    /// No thresholds or cooldown are configured
+    Always,
+    Skip,
+    /// Submit, and store `Submission` as the feed's last one once it is out
+    Submit(SubmissionStore, Submission),
+}
 
-    let json: Root = fetch_json(req).await.map_err(|e| e.to_string())?;
+/// Applies the `update_*` policy to a chain-triggered result. Skipped results
+/// are not cached, so a redelivered trigger decides again.
+fn update_decision(ctx: &RunContext, result: &ComputedResult) -> Result<Update, String> {
+    let Some(policy) = UpdatePolicy::from_env().map_err(|e| e.to_string())? else {
+        return Ok(Update::Always);
+    };
+    let store = SubmissionStore::from_env().map_err(|e| e.to_string())?;
+    let last = store.last(&result.computed.feed_id).map_err(|e| format!("{:#}", e))?;
+    let now = ctx.clock().unix_secs();
+    let decision = policy.decide(last.as_ref(), result.price, now);
+    println!("update decision for {}: {:?}", result.computed.feed_id, decision);
+    if !decision.submit() {
+        return Ok(Update::Skip);
+    }
+    let direction = match decision {
+        Decision::Moved { direction, .. } => Some(direction),
+        _ => None,
+    };
+    Ok(Update::Submit(store, Submission { price: result.price, at: now, direction }))
+}
+
+/// Fetches the requested data, typed for `dest` when it calls for EIP-712
+fn compute(
+    ctx: &RunContext,
+    trigger_id: u64,
+    input: &str,
+    dest: &Destination,
+) -> Result<ComputedResult, String> {
+    if let Some(basket) = index::parse_index_request(input).map_err(|e| e.to_string())? {
+        let experiments = Experiments::from_env(EXPERIMENTS).map_err(|e| e.to_string())?;
+        let (aggregation, experimental) = if experiments.enabled(index::GEOMETRIC_EXPERIMENT) {
+            (index::Aggregation::Geometric, envelope::FLAG_EXPERIMENTAL)
+        } else {
+            (index::Aggregation::Arithmetic, 0)
+        };
+        let index_data =
+            block_on(async move { index::compute_index(ctx, &basket, aggregation).await })?;
+        println!("index_data: {:?}", index_data);
+
+        let (payload, flags) = match payload_version(dest)? {
+            abi_feed::PayloadVersion::Struct => (
+                index_data.abi_encode().map_err(|e| format!("{:#}", e))?,
+                envelope::FLAG_ABI_STRUCT,
+            ),
+            abi_feed::PayloadVersion::Json => {
+                (canonical_json::to_vec(&index_data).map_err(|e| e.to_string())?, 0)
+            }
+        };
+        let flags = flags | experimental;
+        let computed = Computed::new("index", payload).with_flags(flags);
+        return Ok(ComputedResult { computed, price: None });
+    }
+
+    let id = input.chars().next().ok_or("Empty input")?;
+    let id = id.to_digit(16).ok_or("Invalid hex digit")? as u64;
+
+    let resp_data = block_on(async move { get_price_feed(ctx, id).await })?;
+    println!("resp_data: {:?}", resp_data);
+
+    let typed = match dest {
+        Destination::Ethereum => eip712::config_from_env().map_err(|e| e.to_string())?,
+        Destination::CliOutput => None,
+    };
+    let version = payload_version(dest)?;
+    // Typed data is ABI-encoded already and takes precedence
+    let (payload, flags) = match (typed, version) {
+        (Some(typed), _) => {
+            let feed = eip712::to_typed(trigger_id, &resp_data, typed.decimals)
+                .map_err(|e| format!("{:#}", e))?;
+            (eip712::encode_typed_payload(&typed.domain, feed), envelope::FLAG_TYPED_DATA)
+        }
+        (None, abi_feed::PayloadVersion::Struct) => (
+            abi_feed::encode(&resp_data).map_err(|e| format!("{:#}", e))?,
+            envelope::FLAG_ABI_STRUCT,
+        ),
+        (None, abi_feed::PayloadVersion::Json) => {
+            (canonical_json::to_vec(&resp_data).map_err(|e| e.to_string())?, 0)
+        }
+    };
+    let price = Some(resp_data.price);
+    let computed = Computed::new(format!("price:{}", id), payload).with_flags(flags);
+    Ok(ComputedResult { computed, price })
+}
+
+/// Layout of the payload for `dest`, CLI output is always JSON
+fn payload_version(dest: &Destination) -> Result<abi_feed::PayloadVersion, String> {
+    match dest {
+        Destination::Ethereum => abi_feed::PayloadVersion::from_env().map_err(|e| e.to_string()),
+        Destination::CliOutput => Ok(abi_feed::PayloadVersion::Json),
+    }
+}
+
+/// Headers CoinMarketCap needs to serve the data API, overridable with the
+/// `http_headers` kv config
+fn default_headers() -> HeaderRules {
+    HeaderRules::new()
+        .with(ANY_HOST, "Accept", "application/json")
+        .with(ANY_HOST, "Content-Type", "application/json")
+        .with(
+            "api.coinmarketcap.com",
+            "User-Agent",
+            "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/132.0.0.0 Safari/537.36",
+        )
+        .with("api.coinmarketcap.com", "Cookie", "myrandom_cookie={unix_time}")
+}
+
+/// Fetches the price feeds for several assets in parallel, preserving the
+/// order of `ids`
+async fn get_price_feeds(ctx: &RunContext, ids: &[u64]) -> Result<Vec<PriceFeedData>, String> {
+    let fan_out = FanOut::from_env().map_err(|e| e.to_string())?;
+    fan_out
+        .try_join(ctx, ids.iter().map(|id| get_price_feed(ctx, *id)))
+        .await
+        .map_err(|e| e.to_string())
+}
+
+async fn get_price_feed(ctx: &RunContext, id: u64) -> Result<PriceFeedData, String> {
+    let range = config::string_or("coinmarketcap_range", DEFAULT_RANGE);
+    let path = format!("/data-api/v3/cryptocurrency/detail?id={}&range={}", id, range);
+    let mirrors =
+        Mirrors::from_env("coinmarketcap", COINMARKETCAP_API_URL).map_err(|e| e.to_string())?;
+    let headers = HeaderRules::from_env(default_headers()).map_err(|e| e.to_string())?;
+    // Signed responses are checked before the data is accepted
+    let verifier = ResponseVerifier::from_env().map_err(|e| e.to_string())?;
+    let http_cache = HttpCache::from_env().map_err(|e| e.to_string())?;
+
+    let (headers, verifier_ref, http_cache) = (&headers, &verifier, &http_cache);
+    let body = mirrors
+        .fetch(ctx, &path, |url| async move {
+            let mut req = http_request_get(&url)?;
+            headers.apply(&mut req, ctx)?;
+            proxy::apply(&mut req)?;
+            match (http_cache, verifier_ref) {
+                (Some(cache), verifier) => cache.fetch(req, verifier.as_ref()).await,
+                (None, Some(verifier)) => verifier.fetch(req).await,
+                (None, None) => fetch_bytes(req).await,
+            }
+        })
+        .await
+        .map_err(|e| e.to_string())?;
+    let json: Root = serde_json::from_slice(&body).map_err(|e| e.to_string())?;
+    let price = PriceBounds::from_env()
+        .and_then(|bounds| bounds.check(&json.data.symbol, json.data.statistics.price))
+        .map_err(|e| e.to_string())?;
 
     Ok(PriceFeedData {
         symbol: json.data.symbol,
-        price: json.data.statistics.price,
+        price,
         timestamp: json.status.timestamp,
+        signature: verifier.map(|verifier| verifier.audit()),
     })
 }
 
-#[derive(Debug, Serialize, Deserialize)]
-pub struct PriceFeedData {
-    symbol: String,
-    timestamp: String,
-    price: f64,
-}
-
 /// -----
 /// <https://transform.tools/json-to-rust-serde>
 /// Generated from <https://api.coinmarketcap.com/data-api/v3/cryptocurrency/detail?id=1&range=1h>
@@ -118,3 +401,45 @@ pub struct Status {
     pub elapsed: String,
     pub credit_count: f64,
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::bindings::wavs::worker::layer_types::TriggerData;
+
+    #[test]
+    fn cli_abi_runs_do_not_use_the_result_cache() {
+        let dir =
+            std::env::temp_dir().join(format!("eth-price-oracle-cache-{}", std::process::id()));
+        std::env::set_var("result_cache_dir", &dir);
+
+        let cli = decode_trigger_event(TriggerData::Raw(
+            br#"{"cmd":"price","args":"1","format":"abi","trigger_id":7}"#.to_vec(),
+        ))
+        .unwrap();
+        assert_eq!((cli.destination, cli.block.as_ref()), (Destination::Ethereum, None));
+        assert!(result_cache(&cli.destination, &cli.block).unwrap().is_none());
+
+        let block =
+            Some(TriggerBlock { chain_name: "local".to_string(), height: 1, http_endpoint: None });
+        assert!(result_cache(&Destination::Ethereum, &block).unwrap().is_some());
+        assert!(result_cache(&Destination::CliOutput, &block).unwrap().is_none());
+
+        std::fs::remove_dir_all(&dir).unwrap();
+    }
+    #[test]
+    fn batched_triggers_are_cached_as_queued() {
+        let dir =
+            std::env::temp_dir().join(format!("eth-price-oracle-queued-{}", std::process::id()));
+        let cache = ResultCache::open(&dir, 16).unwrap();
+
+        cache_outcome(&cache, 1, b"1", Some(b"output")).unwrap();
+        assert_eq!(cached_outcome(&cache, 1, b"1"), Some(Some(b"output".to_vec())));
+        // Completing a batch caches the queued outcome, not the batch
+        cache_outcome(&cache, 2, b"1", None).unwrap();
+        assert_eq!(cached_outcome(&cache, 2, b"1"), Some(None));
+        assert_eq!(cached_outcome(&cache, 3, b"1"), None);
+
+        std::fs::remove_dir_all(&dir).unwrap();
+    }
+}
@@ -0,0 +1,299 @@
+//! Readback watchdog: checks that earlier results actually landed on-chain.
+//!
+//! With `readback_network` naming an address book network, every result
+//! submitted for a chain trigger is recorded in `readback_state_dir` with the
+//! hash of its data and the time it was produced. Each later run reads what
+//! the network's submit contract stored for the recorded triggers with
+//! `getData`, at the pinned block, and logs
+//!
+//! - [`FLAG_READBACK_MISMATCH`] when a stored result differs from the one
+//!   computed, e.g. another operator set's answer or a tampered submitter;
+//! - [`FLAG_READBACK_MISSED`] when nothing is stored `readback_grace_secs`
+//!   after the result was produced.
+//!
+//! The flags are also set on the record copied to `result_destinations`, but
+//! never on the submitted result: they come from the operator's own RPC view
+//! and local records (an operator that missed the earlier run has nothing to
+//! check), so putting them on-chain would split the operators' answers. A
+//! flagged result is still a good result, so the watchdog never fails the
+//! run.
+
+use alloy_primitives::{keccak256, Address, Bytes, B256};
+use alloy_sol_types::SolValue;
+use anyhow::{Context, Result};
+use common::{
+    address_book::AddressBook,
+    batch, config,
+    context::RunContext,
+    envelope::{FLAG_READBACK_MISMATCH, FLAG_READBACK_MISSED},
+    evm,
+};
+use serde::{Deserialize, Serialize};
+use std::{collections::BTreeMap, path::PathBuf};
+
+/// Seconds a result may take to land, overridable with `readback_grace_secs`
+const DEFAULT_GRACE_SECS: u64 = 600;
+
+/// Most results awaiting readback; older ones are dropped unchecked
+const MAX_PENDING: usize = 64;
+
+const STATE_FILE: &str = "readback.json";
+
+pub struct Watchdog {
+    dir: PathBuf,
+    network: String,
+    endpoint: String,
+    submit_address: Address,
+    grace_secs: u64,
+}
+
+/// A submitted result awaiting readback
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+struct Record {
+    /// Hash of the result data, without any operator signature
+    data_hash: B256,
+    /// Unix seconds the result was produced, at the run's clock
+    produced_at: u64,
+}
+
+impl Watchdog {
+    /// The watchdog configured by `readback_network`, `None` when unset
+    pub fn from_env() -> Result<Option<Self>> {
+        let Some(network) = config::string("readback_network") else {
+            return Ok(None);
+        };
+        let book = AddressBook::from_env()?;
+        let entry = book.require(&network)?;
+        let endpoint = entry
+            .provider_endpoints
+            .first()
+            .with_context(|| format!("no provider endpoint for readback network {network}"))?
+            .clone();
+        let dir: String = config::required("readback_state_dir")?;
+        std::fs::create_dir_all(&dir)
+            .with_context(|| format!("failed to create readback state {dir}"))?;
+        Ok(Some(Self {
+            dir: dir.into(),
+            network,
+            endpoint,
+            submit_address: entry.submit_address,
+            grace_secs: config::parse_or("readback_grace_secs", DEFAULT_GRACE_SECS)?,
+        }))
+    }
+
+    /// Reads back the results whose grace period is over and returns the
+    /// envelope flags for what went wrong, forgetting the checked results
+    pub async fn check(&self, ctx: &RunContext) -> Result<u32> {
+        let mut pending = self.load()?;
+        let ready = due(&pending, ctx.clock().unix_secs(), self.grace_secs);
+        if ready.is_empty() {
+            return Ok(0);
+        }
+
+        let provider = evm::provider(&self.endpoint)?;
+        let block = ctx.pinned_height(&self.network);
+        let mut flags = 0;
+        for (trigger_id, record) in ready {
+            let stored = ctx
+                .run(evm::call(
+                    &provider,
+                    self.submit_address,
+                    &solidity::ISimpleSubmit::getDataCall { triggerId: trigger_id },
+                    block,
+                ))
+                .await??
+                ._data;
+            flags |= verdict(trigger_id, record, &stored);
+            pending.remove(&trigger_id);
+        }
+        self.save(&pending)?;
+        Ok(flags)
+    }
+
+    /// Records `output`, the `DataWithId` submitted for a trigger or a batch
+    /// of them, for a later run to read back
+    pub fn record(&self, ctx: &RunContext, output: &[u8]) -> Result<()> {
+        self.record_at(output, ctx.clock().unix_secs())
+    }
+
+    fn record_at(&self, output: &[u8], produced_at: u64) -> Result<()> {
+        let (trigger_id, data) =
+            <(u64, Bytes)>::abi_decode(output, true).context("invalid DataWithId")?;
+        // A batch is stored per trigger, so each is read back on its own
+        let results = if trigger_id == batch::BATCH_TRIGGER_ID {
+            let (trigger_ids, results) = batch::decode(&data)?;
+            trigger_ids.into_iter().zip(results).collect()
+        } else {
+            vec![(trigger_id, data)]
+        };
+        let mut pending = self.load()?;
+        for (trigger_id, data) in results {
+            pending.insert(trigger_id, Record { data_hash: result_hash(&data), produced_at });
+        }
+        while pending.len() > MAX_PENDING {
+            pending.pop_first();
+        }
+        self.save(&pending)
+    }
+
+    fn load(&self) -> Result<BTreeMap<u64, Record>> {
+        let path = self.dir.join(STATE_FILE);
+        match std::fs::read(&path) {
+            Ok(bytes) => serde_json::from_slice(&bytes)
+                .with_context(|| format!("corrupt readback state {}", path.display())),
+            Err(e) if e.kind() == std::io::ErrorKind::NotFound => Ok(BTreeMap::new()),
+            Err(e) => Err(e).with_context(|| format!("failed to read {}", path.display())),
+        }
+    }
+
+    fn save(&self, pending: &BTreeMap<u64, Record>) -> Result<()> {
+        // Write then rename so a crash never leaves a truncated file behind
+        let path = self.dir.join(STATE_FILE);
+        let tmp = path.with_extension("tmp");
+        std::fs::write(&tmp, serde_json::to_vec(pending)?)
+            .context("failed to write readback state")?;
+        std::fs::rename(&tmp, &path).context("failed to commit readback state")
+    }
+}
+
+/// The records in `pending` whose grace period is over at `now`
+fn due(pending: &BTreeMap<u64, Record>, now: u64, grace_secs: u64) -> Vec<(u64, Record)> {
+    pending
+        .iter()
+        .filter(|(_, record)| now.saturating_sub(record.produced_at) >= grace_secs)
+        .map(|(&trigger_id, &record)| (trigger_id, record))
+        .collect()
+}
+
+/// Envelope flags for the result `stored` for a trigger recorded as `record`
+fn verdict(trigger_id: u64, record: Record, stored: &[u8]) -> u32 {
+    if stored.is_empty() {
+        println!("readback: trigger {trigger_id} was never submitted");
+        FLAG_READBACK_MISSED
+    } else if result_hash(stored) != record.data_hash {
+        println!("readback: trigger {trigger_id} stored a different result");
+        FLAG_READBACK_MISMATCH
+    } else {
+        0
+    }
+}
+
+/// Hash of the result inside a `SignedResult` (or `BlsSignedResult`, whose
+/// result is in the same place), or of `data` itself when it is unsigned;
+/// every operator signs with its own key, so only the result is compared
+fn result_hash(data: &[u8]) -> B256 {
+    match <(Bytes, Address, Bytes)>::abi_decode(data, true) {
+        Ok((result, _, _)) => keccak256(result),
+        Err(_) => keccak256(data),
+    }
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        interface ISimpleSubmit {
+            function getData(uint64 triggerId) external view returns (bytes memory _data);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// A watchdog keeping its state in a fresh directory named for `test`
+    fn watchdog(test: &str) -> Watchdog {
+        let dir = std::env::temp_dir().join(format!("readback-{test}-{}", std::process::id()));
+        let _ = std::fs::remove_dir_all(&dir);
+        std::fs::create_dir_all(&dir).unwrap();
+        Watchdog {
+            dir,
+            network: "local".into(),
+            endpoint: "http://localhost:8545".into(),
+            submit_address: Address::ZERO,
+            grace_secs: DEFAULT_GRACE_SECS,
+        }
+    }
+
+    fn signed(result: &[u8], signer: Address) -> Vec<u8> {
+        (Bytes::copy_from_slice(result), signer, Bytes::from(vec![0x1b; 65])).abi_encode()
+    }
+
+    fn output(trigger_id: u64, data: &[u8]) -> Vec<u8> {
+        (trigger_id, Bytes::copy_from_slice(data)).abi_encode()
+    }
+
+    #[test]
+    fn signatures_are_left_out_of_the_hash() {
+        let mine = signed(b"price", Address::repeat_byte(0x01));
+        let theirs = signed(b"price", Address::repeat_byte(0x02));
+        assert_eq!(result_hash(&mine), keccak256(b"price"));
+        assert_eq!(result_hash(&mine), result_hash(&theirs));
+        assert_ne!(result_hash(&signed(b"other", Address::repeat_byte(0x01))), result_hash(&mine));
+        assert_eq!(result_hash(b"unsigned"), keccak256(b"unsigned"));
+    }
+
+    #[test]
+    fn stored_results_are_compared_with_the_recorded_ones() {
+        let record = Record { data_hash: keccak256(b"price"), produced_at: 1_000 };
+        assert_eq!(verdict(7, record, &signed(b"price", Address::repeat_byte(0x02))), 0);
+        assert_eq!(verdict(7, record, b"price"), 0);
+        assert_eq!(verdict(7, record, &[]), FLAG_READBACK_MISSED);
+        assert_eq!(verdict(7, record, &signed(b"tampered", Address::ZERO)), FLAG_READBACK_MISMATCH);
+    }
+
+    #[test]
+    fn results_are_due_after_the_grace_period() {
+        let record = |produced_at| Record { data_hash: B256::ZERO, produced_at };
+        let pending = BTreeMap::from([(1, record(1_000)), (2, record(1_500)), (3, record(2_000))]);
+        assert_eq!(due(&pending, 2_100, 600), [(1, record(1_000)), (2, record(1_500))]);
+        assert!(due(&pending, 1_599, 600).is_empty());
+        // A clock behind the record never makes it due
+        assert!(due(&pending, 500, 600).is_empty());
+    }
+
+    #[test]
+    fn results_are_recorded_per_trigger() {
+        let watchdog = watchdog("record");
+        watchdog.record_at(&output(7, &signed(b"price", Address::ZERO)), 1_000).unwrap();
+        let batch =
+            batch::encode(vec![8, 9], vec![Bytes::from_static(b"a"), Bytes::from_static(b"b")]);
+        watchdog.record_at(&output(batch::BATCH_TRIGGER_ID, &batch), 1_060).unwrap();
+
+        let pending = watchdog.load().unwrap();
+        assert_eq!(pending.keys().copied().collect::<Vec<_>>(), [7, 8, 9]);
+        assert_eq!(pending[&7], Record { data_hash: keccak256(b"price"), produced_at: 1_000 });
+        assert_eq!(pending[&9], Record { data_hash: keccak256(b"b"), produced_at: 1_060 });
+        std::fs::remove_dir_all(&watchdog.dir).unwrap();
+    }
+
+    #[test]
+    fn oldest_results_are_dropped_past_the_limit() {
+        let watchdog = watchdog("limit");
+        for trigger_id in 0..MAX_PENDING as u64 + 2 {
+            watchdog.record_at(&output(trigger_id, b"price"), 1_000 + trigger_id).unwrap();
+        }
+        let pending = watchdog.load().unwrap();
+        assert_eq!(pending.len(), MAX_PENDING);
+        assert_eq!(pending.first_key_value().unwrap().0, &2);
+        std::fs::remove_dir_all(&watchdog.dir).unwrap();
+    }
+
+    #[test]
+    fn invalid_outputs_and_state_fail() {
+        let watchdog = watchdog("invalid");
+        assert_eq!(watchdog.load().unwrap(), BTreeMap::new());
+        assert_eq!(
+            watchdog.record_at(b"not abi", 1_000).unwrap_err().to_string(),
+            "invalid DataWithId"
+        );
+        assert!(watchdog
+            .record_at(&output(batch::BATCH_TRIGGER_ID, b"not a batch"), 1_000)
+            .is_err());
+
+        std::fs::write(watchdog.dir.join(STATE_FILE), "{not json").unwrap();
+        assert!(watchdog.load().unwrap_err().to_string().starts_with("corrupt readback state"));
+        std::fs::remove_dir_all(&watchdog.dir).unwrap();
+    }
+}
@@ -1,33 +1,28 @@
-use crate::bindings::wavs::worker::layer_types::{TriggerData, TriggerDataEthContractEvent};
-use alloy_sol_types::SolValue;
+use crate::bindings::{
+    host::get_eth_chain_config,
+    wavs::worker::layer_types::{TriggerData, TriggerDataEthContractEvent},
+};
 use anyhow::Result;
-use wavs_wasi_chain::decode_event_log_data;
+use common::trigger::{self, EthEvent};
+pub use common::types::{Destination, TriggerBlock, TriggerRequest};
 
-pub enum Destination {
-    Ethereum,
-    CliOutput,
-}
-
-pub fn decode_trigger_event(trigger_data: TriggerData) -> Result<(u64, Vec<u8>, Destination)> {
+/// Converts the host's trigger into the shared [`common::trigger`] inputs
+pub fn decode_trigger_event(trigger_data: TriggerData) -> Result<TriggerRequest> {
     match trigger_data {
-        TriggerData::EthContractEvent(TriggerDataEthContractEvent { log, .. }) => {
-            let event: solidity::NewTrigger = decode_event_log_data!(log)?;
-            let trigger_info = solidity::TriggerInfo::abi_decode(&event._triggerInfo, false)?;
-            Ok((trigger_info.triggerId, trigger_info.data.to_vec(), Destination::Ethereum))
-        }
-        TriggerData::Raw(data) => Ok((0, data.clone(), Destination::CliOutput)),
-        _ => Err(anyhow::anyhow!("Unsupported trigger data type")),
+        TriggerData::EthContractEvent(TriggerDataEthContractEvent {
+            contract_address,
+            log,
+            chain_name,
+            block_height,
+        }) => trigger::decode_eth_event(EthEvent {
+            contract_address: &contract_address.raw_bytes,
+            topics: &log.topics,
+            data: &log.data,
+            http_endpoint: get_eth_chain_config(&chain_name).and_then(|c| c.http_endpoint),
+            chain_name,
+            block_height,
+        }),
+        TriggerData::Raw(data) => trigger::decode_raw(&data, crate::CLI_COMMANDS),
+        _ => Err(trigger::unsupported()),
     }
 }
-
-pub fn encode_trigger_output(trigger_id: u64, output: impl AsRef<[u8]>) -> Vec<u8> {
-    solidity::DataWithId { triggerId: trigger_id, data: output.as_ref().to_vec().into() }
-        .abi_encode()
-}
-
-mod solidity {
-    use alloy_sol_macro::sol;
-    pub use ITypes::*;
-
-    sol!("../../src/interfaces/ITypes.sol");
-}
@@ -0,0 +1,162 @@
+//! The chain's latest justified and finalized execution blocks.
+//!
+//! The RPC source reads the `safe` and `finalized` block tags, which
+//! post-merge execution clients take from their consensus client. The beacon
+//! source asks a beacon node directly for the execution payload of its
+//! justified and finalized checkpoint blocks, for operators that would
+//! rather not trust the execution client's view of consensus.
+
+use alloy_network::Ethereum;
+use alloy_primitives::B256;
+use alloy_provider::RootProvider;
+use anyhow::{anyhow, Context, Result};
+use common::{context::RunContext, evm, http::fetch_json, proxy};
+use serde::{Deserialize, Serialize};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Source {
+    Rpc,
+    Beacon,
+}
+
+impl Source {
+    pub fn parse(s: &str) -> Result<Self> {
+        match s {
+            "rpc" => Ok(Self::Rpc),
+            "beacon" => Ok(Self::Beacon),
+            _ => Err(anyhow!("invalid finality_source {s:?}, expected rpc or beacon")),
+        }
+    }
+}
+
+/// An execution block at a consensus checkpoint
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Checkpoint {
+    pub number: u64,
+    pub hash: B256,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Checkpoints {
+    pub justified: Checkpoint,
+    pub finalized: Checkpoint,
+}
+
+/// Reads the RPC node's `safe` and `finalized` blocks
+pub async fn from_rpc(ctx: &RunContext, provider: &RootProvider<Ethereum>) -> Result<Checkpoints> {
+    let read = |tag: &'static str| async move {
+        let header = ctx.run(evm::tagged_header(provider, tag)).await??;
+        Ok::<_, anyhow::Error>(Checkpoint { number: header.number.to(), hash: header.hash })
+    };
+    Ok(Checkpoints { justified: read("safe").await?, finalized: read("finalized").await? })
+}
+
+/// Reads the beacon node's justified and finalized blocks from `api_url`
+pub async fn from_beacon(ctx: &RunContext, api_url: &str) -> Result<Checkpoints> {
+    let read = |block_id: &'static str| async move {
+        let url = format!("{}/eth/v2/beacon/blocks/{block_id}", api_url.trim_end_matches('/'));
+        let block: BeaconData<SignedBlock> = ctx
+            .run(async {
+                let mut req = http_request_get(&url)?;
+                req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+                proxy::apply(&mut req)?;
+                fetch_json(req).await
+            })
+            .await?
+            .with_context(|| format!("beacon {block_id} block request failed"))?;
+        block.checkpoint(block_id)
+    };
+    Ok(Checkpoints { justified: read("justified").await?, finalized: read("finalized").await? })
+}
+
+#[derive(Debug, Deserialize)]
+struct BeaconData<T> {
+    data: T,
+}
+
+impl BeaconData<SignedBlock> {
+    /// The execution block the `block_id` beacon block carries
+    fn checkpoint(self, block_id: &str) -> Result<Checkpoint> {
+        let payload = self.data.message.body.execution_payload.ok_or_else(|| {
+            anyhow!("beacon {block_id} block predates the merge and has no execution payload")
+        })?;
+        Ok(Checkpoint {
+            number: payload.block_number.parse().context("invalid execution block number")?,
+            hash: payload.block_hash,
+        })
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct SignedBlock {
+    message: BeaconBlock,
+}
+
+#[derive(Debug, Deserialize)]
+struct BeaconBlock {
+    body: BeaconBlockBody,
+}
+
+#[derive(Debug, Deserialize)]
+struct BeaconBlockBody {
+    execution_payload: Option<ExecutionPayload>,
+}
+
+#[derive(Debug, Deserialize)]
+struct ExecutionPayload {
+    /// Beacon API integers are JSON strings
+    block_number: String,
+    block_hash: B256,
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const HASH: &str = "0x1d2b0bda21d56b8bd12d4f94ebacffdfb35f5e226f84b461103bb8beab6353be";
+
+    fn block(body: &str) -> BeaconData<SignedBlock> {
+        serde_json::from_str(&format!(
+            r#"{{"version": "deneb", "data": {{"message": {{"slot": "10755840", "body": {body}}}}}}}"#
+        ))
+        .unwrap()
+    }
+
+    #[test]
+    fn sources_parse() {
+        assert_eq!(Source::parse("beacon").unwrap(), Source::Beacon);
+        assert_eq!(
+            Source::parse("Beacon").unwrap_err().to_string(),
+            "invalid finality_source \"Beacon\", expected rpc or beacon"
+        );
+    }
+
+    #[test]
+    fn beacon_blocks_carry_the_execution_block() {
+        let finalized = block(&format!(
+            r#"{{"execution_payload": {{"block_number": "21000000", "block_hash": "{HASH}"}}}}"#
+        ));
+        assert_eq!(
+            finalized.checkpoint("finalized").unwrap(),
+            Checkpoint { number: 21_000_000, hash: HASH.parse().unwrap() }
+        );
+    }
+
+    #[test]
+    fn malformed_beacon_blocks_fail() {
+        assert_eq!(
+            block("{}").checkpoint("justified").unwrap_err().to_string(),
+            "beacon justified block predates the merge and has no execution payload"
+        );
+        let hex_number = block(&format!(
+            r#"{{"execution_payload": {{"block_number": "0x1", "block_hash": "{HASH}"}}}}"#
+        ));
+        assert_eq!(
+            hex_number.checkpoint("finalized").unwrap_err().to_string(),
+            "invalid execution block number"
+        );
+    }
+}
@@ -0,0 +1,276 @@
+mod checkpoints;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, host::get_eth_chain_config, Guest, TriggerAction};
+use alloy_primitives::B256;
+use alloy_sol_types::SolValue;
+use checkpoints::{Checkpoints, Source};
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    evm,
+    output::{self, Computed},
+    panic_guard,
+};
+use serde::{Deserialize, Serialize};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["attest"];
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let target = Target::parse(input.trim_end_matches('\0').trim())?;
+    println!("target: {:?}", target);
+
+    let chain_name = config::string_or("chain_name", "local");
+    let source =
+        Source::parse(&config::string_or("finality_source", "rpc")).map_err(|e| e.to_string())?;
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let attestation = block_on(attest(&ctx, &chain_name, source, target))?;
+        println!("attestation: {:?}", attestation);
+
+        let feed_id = format!("finality:{}:{}", attestation.chain_id, attestation.block_number);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::FinalityAttestation {
+                    chainId: attestation.chain_id,
+                    blockNumber: attestation.block_number,
+                    blockHash: attestation.block_hash,
+                    status: attestation.status.code(),
+                    finalizedNumber: attestation.checkpoints.finalized.number,
+                    finalizedHash: attestation.checkpoints.finalized.hash,
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => {
+                canonical_json::to_vec(&attestation).map_err(|e| e.to_string())?
+            }
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// The block asked about: a height, a hash, or a height and the hash
+/// expected there as `height:hash`
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+struct Target {
+    height: Option<u64>,
+    hash: Option<B256>,
+}
+
+impl Target {
+    fn parse(s: &str) -> Result<Self, String> {
+        let hash = |s: &str| s.parse::<B256>().map_err(|e| format!("Invalid block hash: {}", e));
+        let height = |s: &str| s.parse::<u64>().map_err(|e| format!("Invalid block height: {}", e));
+        match s.split_once(':') {
+            Some((h, hs)) => Ok(Self { height: Some(height(h)?), hash: Some(hash(hs)?) }),
+            None if s.starts_with("0x") => Ok(Self { height: None, hash: Some(hash(s)?) }),
+            None => Ok(Self { height: Some(height(s)?), hash: None }),
+        }
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Status {
+    /// Above the justified checkpoint, or not yet produced
+    Pending,
+    /// At or below the justified checkpoint but above the finalized one
+    Justified,
+    Finalized,
+    /// A different block is justified or finalized at its height
+    Orphaned,
+}
+
+impl Status {
+    fn code(self) -> u8 {
+        match self {
+            Self::Pending => 0,
+            Self::Justified => 1,
+            Self::Finalized => 2,
+            Self::Orphaned => 3,
+        }
+    }
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct Attestation {
+    chain_id: u64,
+    block_number: u64,
+    /// The canonical block at `block_number`, or the hash asked about while
+    /// it is pending
+    block_hash: B256,
+    status: Status,
+    source: Source,
+    checkpoints: Checkpoints,
+}
+
+/// Places the target against the chain's current checkpoints.
+///
+/// Checkpoints are read as of now rather than at the trigger block, since the
+/// question is whether the block is final yet. Operators running moments
+/// apart can disagree until the block is finalized, after which the answer
+/// never changes.
+async fn attest(
+    ctx: &RunContext,
+    chain_name: &str,
+    source: Source,
+    target: Target,
+) -> Result<Attestation, String> {
+    let chain =
+        get_eth_chain_config(chain_name).ok_or_else(|| format!("Unknown chain {}", chain_name))?;
+    let chain_id = chain.chain_id.parse().map_err(|e| format!("Invalid chain id: {}", e))?;
+    let endpoint = chain
+        .http_endpoint
+        .ok_or_else(|| format!("No http endpoint configured for chain {}", chain_name))?;
+    let provider = evm::provider(&endpoint).map_err(|e| e.to_string())?;
+
+    let height = match (target.height, target.hash) {
+        (Some(height), _) => height,
+        (None, Some(hash)) => ctx
+            .run(evm::block_header_by_hash(&provider, hash))
+            .await
+            .map_err(|e| e.to_string())?
+            .map_err(|e| e.to_string())?
+            .ok_or_else(|| format!("Block {} not found", hash))?
+            .number
+            .to(),
+        (None, None) => unreachable!("Target::parse sets a height or a hash"),
+    };
+    let checkpoints = match source {
+        Source::Rpc => checkpoints::from_rpc(ctx, &provider).await,
+        Source::Beacon => {
+            let api_url: String = config::required("beacon_api_url").map_err(|e| e.to_string())?;
+            checkpoints::from_beacon(ctx, &api_url).await
+        }
+    }
+    .map_err(|e| format!("{e:#}"))?;
+
+    if height > checkpoints.justified.number {
+        return Ok(Attestation {
+            chain_id,
+            block_number: height,
+            block_hash: target.hash.unwrap_or_default(),
+            status: Status::Pending,
+            source,
+            checkpoints,
+        });
+    }
+    // Up to the justified checkpoint the canonical chain only changes if a
+    // third of the stake is slashed, so the node's block at the height is
+    // the one attested
+    let canonical = ctx
+        .run(evm::block_header(&provider, height))
+        .await
+        .map_err(|e| e.to_string())?
+        .map_err(|e| e.to_string())?
+        .hash;
+    Ok(Attestation {
+        chain_id,
+        block_number: height,
+        block_hash: canonical,
+        status: settled(target.hash, height, canonical, &checkpoints),
+        source,
+        checkpoints,
+    })
+}
+
+/// Status of a block at or below the justified checkpoint whose canonical
+/// hash is `canonical`, when `hash` was asked about
+fn settled(hash: Option<B256>, height: u64, canonical: B256, checkpoints: &Checkpoints) -> Status {
+    if hash.is_some_and(|hash| hash != canonical) {
+        Status::Orphaned
+    } else if height <= checkpoints.finalized.number {
+        Status::Finalized
+    } else {
+        Status::Justified
+    }
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // `status` is 0 pending, 1 justified, 2 finalized, 3 orphaned
+        struct FinalityAttestation {
+            uint64 chainId;
+            uint64 blockNumber;
+            bytes32 blockHash;
+            uint8 status;
+            uint64 finalizedNumber;
+            bytes32 finalizedHash;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use checkpoints::Checkpoint;
+
+    const CHECKPOINTS: Checkpoints = Checkpoints {
+        justified: Checkpoint { number: 164, hash: B256::repeat_byte(0x64) },
+        finalized: Checkpoint { number: 132, hash: B256::repeat_byte(0x32) },
+    };
+
+    #[test]
+    fn targets_parse() {
+        let hash = B256::repeat_byte(0xab);
+        assert_eq!(Target::parse("150").unwrap(), Target { height: Some(150), hash: None });
+        assert_eq!(
+            Target::parse(&hash.to_string()).unwrap(),
+            Target { height: None, hash: Some(hash) }
+        );
+        assert_eq!(
+            Target::parse(&format!("150:{hash}")).unwrap(),
+            Target { height: Some(150), hash: Some(hash) }
+        );
+        assert!(Target::parse("latest").unwrap_err().starts_with("Invalid block height"));
+        assert!(Target::parse("0x1234").unwrap_err().starts_with("Invalid block hash"));
+        assert!(Target::parse("150:0x12").unwrap_err().starts_with("Invalid block hash"));
+    }
+
+    #[test]
+    fn settled_blocks_are_justified_then_finalized() {
+        let canonical = B256::repeat_byte(0xab);
+        assert_eq!(settled(None, 164, canonical, &CHECKPOINTS), Status::Justified);
+        assert_eq!(settled(None, 133, canonical, &CHECKPOINTS), Status::Justified);
+        assert_eq!(settled(None, 132, canonical, &CHECKPOINTS), Status::Finalized);
+        assert_eq!(settled(Some(canonical), 100, canonical, &CHECKPOINTS), Status::Finalized);
+    }
+
+    #[test]
+    fn replaced_blocks_are_orphaned() {
+        let (canonical, asked) = (B256::repeat_byte(0xab), B256::repeat_byte(0xcd));
+        assert_eq!(settled(Some(asked), 100, canonical, &CHECKPOINTS), Status::Orphaned);
+        assert_eq!(settled(Some(asked), 150, canonical, &CHECKPOINTS), Status::Orphaned);
+        assert_eq!(Status::Orphaned.code(), 3);
+    }
+}
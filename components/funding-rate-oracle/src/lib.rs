@@ -0,0 +1,352 @@
+mod trigger;
+mod venues;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_primitives::I256;
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    fan_out::FanOut,
+    fixed_point::{self, Rounding},
+    output::{self, Computed},
+    panic_guard,
+};
+use serde::{Deserialize, Serialize};
+use venues::{Funding, Market, Venue};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["funding"];
+
+/// Venues blended, overridable with `funding_venues`
+const DEFAULT_VENUES: &str = "binance,bybit,okx";
+
+/// Fewest venues that must answer, overridable with `funding_min_venues`
+const DEFAULT_MIN_VENUES: usize = 2;
+
+/// Decimals of the fixed-point rates
+const RATE_DECIMALS: u8 = 18;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let market = Market::parse(input.trim_end_matches('\0')).map_err(|e| e.to_string())?;
+    println!("market: {}", market);
+
+    let config = FundingConfig::from_env().map_err(|e| e.to_string())?;
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(blend(&ctx, &config, &market))?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("funding:{}", report.market);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::FundingRate {
+                    market: report.market.clone(),
+                    rate: report.rate,
+                    decimals: RATE_DECIMALS,
+                    timestamp: report.timestamp,
+                    venues: report.venues.len() as u8,
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// How venue rates are combined, set with `funding_aggregation`
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Aggregation {
+    /// Middle rate, or the mean of the middle two; ignores a single outlier
+    Median,
+    Mean,
+}
+
+impl std::str::FromStr for Aggregation {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> anyhow::Result<Self> {
+        match s {
+            "median" => Ok(Self::Median),
+            "mean" => Ok(Self::Mean),
+            _ => Err(anyhow::anyhow!("unknown aggregation {s}, expected median or mean")),
+        }
+    }
+}
+
+impl Aggregation {
+    /// Combines `rates`, rounding toward zero
+    fn apply(self, rates: &[I256]) -> I256 {
+        match self {
+            Self::Median => {
+                let mut sorted = rates.to_vec();
+                sorted.sort();
+                let mid = sorted.len() / 2;
+                if sorted.len() % 2 == 1 {
+                    sorted[mid]
+                } else {
+                    (sorted[mid - 1] + sorted[mid]) / I256::unchecked_from(2)
+                }
+            }
+            Self::Mean => {
+                rates.iter().fold(I256::ZERO, |sum, &rate| sum + rate)
+                    / I256::unchecked_from(rates.len())
+            }
+        }
+    }
+}
+
+struct FundingConfig {
+    venues: Vec<Venue>,
+    aggregation: Aggregation,
+    min_venues: usize,
+}
+
+impl FundingConfig {
+    fn from_env() -> anyhow::Result<Self> {
+        let mut venues = config::list("funding_venues")
+            .unwrap_or_else(|| DEFAULT_VENUES.split(',').map(String::from).collect())
+            .iter()
+            .map(|v| v.parse())
+            .collect::<anyhow::Result<Vec<Venue>>>()?;
+        venues.sort_by_key(|v| v.as_str());
+        venues.dedup();
+        let min_venues = config::parse_or("funding_min_venues", DEFAULT_MIN_VENUES)?;
+        if min_venues == 0 || min_venues > venues.len() {
+            return Err(anyhow::anyhow!(
+                "funding_min_venues must be between 1 and the {} configured venues",
+                venues.len()
+            ));
+        }
+        Ok(Self {
+            venues,
+            aggregation: config::parse_or("funding_aggregation", Aggregation::Median)?,
+            min_venues,
+        })
+    }
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct VenueRate {
+    venue: Venue,
+    /// Per funding interval, fixed-point with `RATE_DECIMALS`
+    rate: I256,
+    /// Unix milliseconds the rate is next charged at
+    next_funding_time: u64,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct FundingReport {
+    market: String,
+    /// Unix seconds the rates were read at
+    timestamp: u64,
+    aggregation: Aggregation,
+    /// Blended rate per funding interval, fixed-point with `RATE_DECIMALS`
+    rate: I256,
+    /// Venues that answered, in name order
+    venues: Vec<VenueRate>,
+}
+
+/// Reads every venue's current rate and blends them. Venues that fail are
+/// logged and left out, as long as `min_venues` remain.
+async fn blend(
+    ctx: &RunContext,
+    config: &FundingConfig,
+    market: &Market,
+) -> Result<FundingReport, String> {
+    let results = FanOut::from_env()
+        .map_err(|e| e.to_string())?
+        .try_join(
+            ctx,
+            config
+                .venues
+                .iter()
+                .map(|&venue| async move { anyhow::Ok((venue, venue.funding(ctx, market).await)) }),
+        )
+        .await
+        .map_err(|e| e.to_string())?;
+    funding_report(config, market, results, ctx.clock().unix_secs())
+}
+
+/// Blends the venues in `results` that answered, read at `timestamp`
+fn funding_report(
+    config: &FundingConfig,
+    market: &Market,
+    results: Vec<(Venue, anyhow::Result<Funding>)>,
+    timestamp: u64,
+) -> Result<FundingReport, String> {
+    let venues = results
+        .into_iter()
+        .filter_map(|(venue, funding)| match funding {
+            Ok(Funding { rate, next_funding_time }) => Some(
+                fixed_point::parse_signed(&rate, RATE_DECIMALS, Rounding::HalfUp)
+                    .map(|rate| VenueRate { venue, rate, next_funding_time })
+                    .map_err(|e| format!("Funding rate on {}: {}", venue, e)),
+            ),
+            Err(e) => {
+                println!("{venue} funding for {market} unavailable: {e:#}");
+                None
+            }
+        })
+        .collect::<Result<Vec<_>, String>>()?;
+    if venues.len() < config.min_venues {
+        return Err(format!(
+            "Only {} of {} venues returned a {} funding rate, need {}",
+            venues.len(),
+            config.venues.len(),
+            market,
+            config.min_venues
+        ));
+    }
+
+    let rates: Vec<I256> = venues.iter().map(|v| v.rate).collect();
+    Ok(FundingReport {
+        market: market.to_string(),
+        timestamp,
+        aggregation: config.aggregation,
+        rate: config.aggregation.apply(&rates),
+        venues,
+    })
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // `rate` is the blended funding per interval (eight hours on the
+        // covered venues), fixed-point with `decimals`; positive when longs
+        // pay shorts
+        struct FundingRate {
+            string market;
+            int256 rate;
+            uint8 decimals;
+            uint64 timestamp;
+            uint8 venues;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const NOW: u64 = 1_735_689_600;
+    const NEXT: u64 = 1_735_718_400_000;
+
+    fn rates(rates: &[i64]) -> Vec<I256> {
+        rates.iter().map(|&r| I256::unchecked_from(r)).collect()
+    }
+
+    fn config(aggregation: Aggregation, min_venues: usize) -> FundingConfig {
+        FundingConfig {
+            venues: vec![Venue::Binance, Venue::Bybit, Venue::Okx],
+            aggregation,
+            min_venues,
+        }
+    }
+
+    fn funding(rate: &str) -> anyhow::Result<Funding> {
+        Ok(Funding { rate: rate.into(), next_funding_time: NEXT })
+    }
+
+    /// `units` of 1e-6 at `RATE_DECIMALS`
+    fn micros(units: i64) -> I256 {
+        I256::unchecked_from(units) * I256::unchecked_from(1_000_000_000_000i64)
+    }
+
+    #[test]
+    fn median_takes_the_middle_rates() {
+        assert_eq!(Aggregation::Median.apply(&rates(&[5, -3, 100])), I256::unchecked_from(5));
+        assert_eq!(Aggregation::Median.apply(&rates(&[4, 1, 100, 2])), I256::unchecked_from(3));
+        // Rounds toward zero
+        assert_eq!(Aggregation::Median.apply(&rates(&[-1, -2])), I256::unchecked_from(-1));
+    }
+
+    #[test]
+    fn mean_averages_every_rate() {
+        assert_eq!(Aggregation::Mean.apply(&rates(&[5, -3, 100])), I256::unchecked_from(34));
+        assert_eq!(Aggregation::Mean.apply(&rates(&[-1, -2])), I256::unchecked_from(-1));
+    }
+
+    #[test]
+    fn aggregations_parse() {
+        assert_eq!("mean".parse::<Aggregation>().unwrap(), Aggregation::Mean);
+        assert!("mode".parse::<Aggregation>().is_err());
+    }
+
+    #[test]
+    fn default_config() {
+        let config = FundingConfig::from_env().unwrap();
+        assert_eq!(config.venues, [Venue::Binance, Venue::Bybit, Venue::Okx]);
+        assert_eq!((config.aggregation, config.min_venues), (Aggregation::Median, 2));
+    }
+
+    #[test]
+    fn failed_venues_are_left_out() {
+        let market = Market::parse("BTC").unwrap();
+        let results = vec![
+            (Venue::Binance, funding("0.0001")),
+            (Venue::Bybit, Err(anyhow::anyhow!("bybit: no ticker"))),
+            (Venue::Okx, funding("-0.00002")),
+        ];
+        let report =
+            funding_report(&config(Aggregation::Median, 2), &market, results, NOW).unwrap();
+        assert_eq!((report.market.as_str(), report.timestamp), ("BTC-USDT", NOW));
+        let venues: Vec<(Venue, I256, u64)> =
+            report.venues.iter().map(|v| (v.venue, v.rate, v.next_funding_time)).collect();
+        assert_eq!(venues, [(Venue::Binance, micros(100), NEXT), (Venue::Okx, micros(-20), NEXT)]);
+        assert_eq!(report.rate, micros(40));
+    }
+
+    #[test]
+    fn too_few_venues_fail() {
+        let market = Market::parse("BTC").unwrap();
+        let results = vec![
+            (Venue::Binance, funding("0.0001")),
+            (Venue::Bybit, Err(anyhow::anyhow!("bybit: no ticker"))),
+        ];
+        assert_eq!(
+            funding_report(&config(Aggregation::Mean, 2), &market, results, NOW).unwrap_err(),
+            "Only 1 of 3 venues returned a BTC-USDT funding rate, need 2"
+        );
+    }
+
+    #[test]
+    fn malformed_rates_fail() {
+        let market = Market::parse("BTC").unwrap();
+        let results = vec![(Venue::Binance, funding("0.0001")), (Venue::Okx, funding("n/a"))];
+        assert_eq!(
+            funding_report(&config(Aggregation::Mean, 1), &market, results, NOW).unwrap_err(),
+            "Funding rate on okx: \"n/a\" is not a decimal number"
+        );
+    }
+}
@@ -0,0 +1,286 @@
+//! Venues and their public funding rate endpoints.
+//!
+//! Each venue's base URL is overridable with `<venue>_base_urls`, like any
+//! other [`Mirrors`] source. Rates are the venue's current rate for one
+//! funding interval, which is eight hours on the major linear perpetuals all
+//! three list.
+
+use anyhow::{anyhow, Context, Result};
+use common::{context::RunContext, http::fetch_json, mirrors::Mirrors, proxy};
+use serde::{de::DeserializeOwned, Deserialize, Serialize};
+use std::fmt;
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+/// Quote asset when the input names only the base, e.g. `BTC`
+const DEFAULT_QUOTE: &str = "USDT";
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Venue {
+    Binance,
+    Bybit,
+    Okx,
+}
+
+impl std::str::FromStr for Venue {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self> {
+        match s.trim() {
+            "binance" => Ok(Self::Binance),
+            "bybit" => Ok(Self::Bybit),
+            "okx" => Ok(Self::Okx),
+            other => Err(anyhow!("unknown venue {other}, expected binance, bybit or okx")),
+        }
+    }
+}
+
+impl fmt::Display for Venue {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(self.as_str())
+    }
+}
+
+/// A linear perpetual, e.g. `BTC-USDT`
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Market {
+    pub base: String,
+    pub quote: String,
+}
+
+impl Market {
+    /// Parses `BASE`, `BASE-QUOTE` or `BASE/QUOTE`, case-insensitively
+    pub fn parse(s: &str) -> Result<Self> {
+        let s = s.trim();
+        let (base, quote) = s.split_once(['-', '/']).unwrap_or((s, DEFAULT_QUOTE));
+        let valid = |a: &str| {
+            !a.is_empty() && a.len() <= 10 && a.bytes().all(|b| b.is_ascii_alphanumeric())
+        };
+        if !valid(base) || !valid(quote) {
+            return Err(anyhow!(
+                "invalid market {s:?}, expected BASE or BASE-QUOTE, e.g. BTC-USDT"
+            ));
+        }
+        Ok(Self { base: base.to_ascii_uppercase(), quote: quote.to_ascii_uppercase() })
+    }
+}
+
+impl fmt::Display for Market {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}-{}", self.base, self.quote)
+    }
+}
+
+/// A venue's current funding
+#[derive(Debug, Clone, PartialEq)]
+pub struct Funding {
+    /// Decimal fraction per interval as the venue sent it, e.g. `"-0.00002"`
+    pub rate: String,
+    /// Unix milliseconds the rate is next charged at
+    pub next_funding_time: u64,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct BinancePremiumIndex {
+    last_funding_rate: String,
+    next_funding_time: u64,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct BybitTickers {
+    ret_code: i64,
+    #[serde(default)]
+    ret_msg: String,
+    result: Option<BybitResult>,
+}
+
+impl BybitTickers {
+    fn into_funding(self) -> Result<Funding> {
+        if self.ret_code != 0 {
+            return Err(anyhow!("bybit: {} {}", self.ret_code, self.ret_msg));
+        }
+        let ticker = self
+            .result
+            .and_then(|result| result.list.into_iter().next())
+            .context("bybit: no ticker")?;
+        Ok(Funding {
+            rate: ticker.funding_rate,
+            next_funding_time: millis(&ticker.next_funding_time)?,
+        })
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct BybitResult {
+    list: Vec<BybitTicker>,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct BybitTicker {
+    funding_rate: String,
+    next_funding_time: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct OkxFundingRates {
+    code: String,
+    #[serde(default)]
+    msg: String,
+    data: Vec<OkxFundingRate>,
+}
+
+impl OkxFundingRates {
+    fn into_funding(self) -> Result<Funding> {
+        if self.code != "0" {
+            return Err(anyhow!("okx: {} {}", self.code, self.msg));
+        }
+        let rate = self.data.into_iter().next().context("okx: no funding rate")?;
+        Ok(Funding { rate: rate.funding_rate, next_funding_time: millis(&rate.funding_time)? })
+    }
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct OkxFundingRate {
+    funding_rate: String,
+    /// When the current rate is charged; `nextFundingTime` is the one after
+    funding_time: String,
+}
+
+impl Venue {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Binance => "binance",
+            Self::Bybit => "bybit",
+            Self::Okx => "okx",
+        }
+    }
+
+    fn default_base(self) -> &'static str {
+        match self {
+            Self::Binance => "https://fapi.binance.com",
+            Self::Bybit => "https://api.bybit.com",
+            Self::Okx => "https://www.okx.com",
+        }
+    }
+
+    /// The venue's current funding for `market`
+    pub async fn funding(self, ctx: &RunContext, market: &Market) -> Result<Funding> {
+        let Market { base, quote } = market;
+        match self {
+            Self::Binance => {
+                let index: BinancePremiumIndex =
+                    self.get(ctx, &format!("/fapi/v1/premiumIndex?symbol={base}{quote}")).await?;
+                Ok(Funding {
+                    rate: index.last_funding_rate,
+                    next_funding_time: index.next_funding_time,
+                })
+            }
+            Self::Bybit => {
+                let path = format!("/v5/market/tickers?category=linear&symbol={base}{quote}");
+                self.get::<BybitTickers>(ctx, &path).await?.into_funding()
+            }
+            Self::Okx => {
+                let path = format!("/api/v5/public/funding-rate?instId={base}-{quote}-SWAP");
+                self.get::<OkxFundingRates>(ctx, &path).await?.into_funding()
+            }
+        }
+    }
+
+    async fn get<T: DeserializeOwned>(self, ctx: &RunContext, path: &str) -> Result<T> {
+        Mirrors::from_env(self.as_str(), self.default_base())?
+            .fetch(ctx, path, |url| async move {
+                let mut req = http_request_get(&url)?;
+                req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+                proxy::apply(&mut req)?;
+                fetch_json(req).await
+            })
+            .await
+    }
+}
+
+fn millis(s: &str) -> Result<u64> {
+    s.parse().with_context(|| format!("invalid timestamp {s}"))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn markets_parse() {
+        let market = Market::parse(" eth ").unwrap();
+        assert_eq!((market.base.as_str(), market.quote.as_str()), ("ETH", "USDT"));
+        assert_eq!(Market::parse("sol/usdc").unwrap().to_string(), "SOL-USDC");
+        for invalid in ["", "BTC-", "-USDT", "BTC_USDT", "BTC-USDT-SWAP"] {
+            assert!(Market::parse(invalid).is_err(), "{invalid}");
+        }
+    }
+
+    #[test]
+    fn venues_parse() {
+        assert_eq!("bybit".parse::<Venue>().unwrap(), Venue::Bybit);
+        assert_eq!(
+            "dydx".parse::<Venue>().unwrap_err().to_string(),
+            "unknown venue dydx, expected binance, bybit or okx"
+        );
+    }
+
+    #[test]
+    fn bybit_tickers() {
+        let tickers: BybitTickers = serde_json::from_str(
+            r#"{"retCode": 0, "retMsg": "OK", "result": {"list": [
+                {"symbol": "BTCUSDT", "fundingRate": "-0.00002", "nextFundingTime": "1735718400000"}
+            ]}}"#,
+        )
+        .unwrap();
+        assert_eq!(
+            tickers.into_funding().unwrap(),
+            Funding { rate: "-0.00002".into(), next_funding_time: 1_735_718_400_000 }
+        );
+
+        let invalid: BybitTickers = serde_json::from_str(
+            r#"{"retCode": 10001, "retMsg": "params error: symbol invalid", "result": null}"#,
+        )
+        .unwrap();
+        assert_eq!(
+            invalid.into_funding().unwrap_err().to_string(),
+            "bybit: 10001 params error: symbol invalid"
+        );
+        let empty: BybitTickers =
+            serde_json::from_str(r#"{"retCode": 0, "result": {"list": []}}"#).unwrap();
+        assert_eq!(empty.into_funding().unwrap_err().to_string(), "bybit: no ticker");
+    }
+
+    #[test]
+    fn okx_funding_rates() {
+        let rates: OkxFundingRates = serde_json::from_str(
+            r#"{"code": "0", "msg": "", "data": [{"instId": "BTC-USDT-SWAP",
+                "fundingRate": "0.0001", "fundingTime": "1735718400000",
+                "nextFundingTime": "1735747200000"}]}"#,
+        )
+        .unwrap();
+        assert_eq!(
+            rates.into_funding().unwrap(),
+            Funding { rate: "0.0001".into(), next_funding_time: 1_735_718_400_000 }
+        );
+
+        let bad_time: OkxFundingRates = serde_json::from_str(
+            r#"{"code": "0", "data": [{"fundingRate": "0.0001", "fundingTime": "soon"}]}"#,
+        )
+        .unwrap();
+        assert_eq!(bad_time.into_funding().unwrap_err().to_string(), "invalid timestamp soon");
+        let invalid: OkxFundingRates = serde_json::from_str(
+            r#"{"code": "51001", "msg": "Instrument ID does not exist", "data": []}"#,
+        )
+        .unwrap();
+        assert_eq!(
+            invalid.into_funding().unwrap_err().to_string(),
+            "okx: 51001 Instrument ID does not exist"
+        );
+    }
+}
@@ -0,0 +1,107 @@
+//! Short-horizon base fee projection under EIP-1559.
+//!
+//! Each block moves the base fee by `(used - target) / target / 8`, with the
+//! target half the gas limit, so a run of blocks at utilization `u` changes it
+//! by a factor of `1 + (2u - 1) / 8` per block. The forecast assumes the
+//! recent mean utilization persists, or full blocks while the pending pool is
+//! congested; the ceiling assumes full blocks throughout. Arithmetic is in
+//! integers, so every operator projects the same fees from the same history.
+
+use alloy_primitives::U256;
+use serde::{Deserialize, Serialize};
+
+/// Per-block change is expressed in millionths of this
+const STEP_DENOMINATOR: i64 = 8_000_000;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Congestion {
+    /// Blocks under half full, base fee falling
+    Low,
+    Normal,
+    /// Blocks nearly full or the pending pool backed up, base fee rising
+    High,
+}
+
+impl Congestion {
+    pub fn level(self) -> u8 {
+        match self {
+            Self::Low => 0,
+            Self::Normal => 1,
+            Self::High => 2,
+        }
+    }
+}
+
+/// Utilization from which blocks count as congested
+pub const HIGH_UTILIZATION: f64 = 0.9;
+
+pub fn congestion(utilization: f64, pool_congested: bool) -> Congestion {
+    if pool_congested || utilization >= HIGH_UTILIZATION {
+        Congestion::High
+    } else if utilization < 0.5 {
+        Congestion::Low
+    } else {
+        Congestion::Normal
+    }
+}
+
+/// `base_fee` after `blocks` blocks at `utilization`
+pub fn project(base_fee: U256, utilization: f64, blocks: u64) -> U256 {
+    let change = ((2.0 * utilization.clamp(0.0, 1.0) - 1.0) * 1_000_000.0).round() as i64;
+    let factor = U256::from((STEP_DENOMINATOR + change) as u64);
+    let denominator = U256::from(STEP_DENOMINATOR as u64);
+    (0..blocks).fold(base_fee, |fee, _| fee.saturating_mul(factor) / denominator)
+}
+
+/// Median of `values`, the lower middle one for an even count
+pub fn median(mut values: Vec<U256>) -> Option<U256> {
+    values.sort();
+    values.get(values.len().checked_sub(1)? / 2).copied()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const GWEI: u64 = 1_000_000_000;
+
+    #[test]
+    fn full_blocks_raise_the_fee_an_eighth_each() {
+        let fee = U256::from(GWEI);
+        assert_eq!(project(fee, 1.0, 1), U256::from(1_125_000_000u64));
+        assert_eq!(project(fee, 1.0, 2), U256::from(1_265_625_000u64));
+        assert_eq!(project(fee, 0.0, 1), U256::from(875_000_000u64));
+    }
+
+    #[test]
+    fn half_full_blocks_keep_the_fee() {
+        assert_eq!(project(U256::from(GWEI), 0.5, 10), U256::from(GWEI));
+        assert_eq!(project(U256::from(GWEI), 0.75, 1), U256::from(1_062_500_000u64));
+        // Out of range utilizations are clamped
+        assert_eq!(project(U256::from(GWEI), 1.5, 1), project(U256::from(GWEI), 1.0, 1));
+        assert_eq!(project(U256::from(GWEI), 0.9, 0), U256::from(GWEI));
+    }
+
+    #[test]
+    fn projections_saturate() {
+        assert_eq!(project(U256::MAX, 1.0, 1), U256::MAX / U256::from(8_000_000));
+    }
+
+    #[test]
+    fn congestion_levels() {
+        assert_eq!(congestion(0.49, false), Congestion::Low);
+        assert_eq!(congestion(0.5, false), Congestion::Normal);
+        assert_eq!(congestion(HIGH_UTILIZATION, false), Congestion::High);
+        assert_eq!(congestion(0.1, true), Congestion::High);
+        assert_eq!(Congestion::High.level(), 2);
+    }
+
+    #[test]
+    fn median_takes_the_lower_middle() {
+        let values = |v: &[u64]| v.iter().map(|&v| U256::from(v)).collect::<Vec<_>>();
+        assert_eq!(median(values(&[3, 1, 2])), Some(U256::from(2)));
+        assert_eq!(median(values(&[4, 1, 3, 2])), Some(U256::from(2)));
+        assert_eq!(median(vec![]), None);
+    }
+}
@@ -0,0 +1,298 @@
+mod forecast;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, host::get_eth_chain_config, Guest, TriggerAction};
+use alloy_primitives::U256;
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    evm::{self, FeeHistory},
+    output::{self, Computed},
+    panic_guard,
+};
+use forecast::Congestion;
+use serde::{Deserialize, Serialize};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["forecast"];
+
+/// Blocks of fee history read, overridable with `gas_history_blocks`
+const DEFAULT_HISTORY_BLOCKS: u64 = 20;
+
+/// Blocks ahead forecast, overridable with `gas_horizon_blocks`
+const DEFAULT_HORIZON_BLOCKS: u64 = 5;
+
+/// Pending transactions from which the pool counts as congested,
+/// overridable with `gas_congested_pending`
+const DEFAULT_CONGESTED_PENDING: u64 = 10_000;
+
+/// Priority fee percentiles read from the fee history
+const REWARD_PERCENTILES: [f64; 2] = [50.0, 90.0];
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    // The input optionally names the chain to forecast, defaulting to `chain_name`
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let chain_name = match input.trim_end_matches('\0').trim() {
+        "" => config::string_or("chain_name", "local"),
+        name => name.to_string(),
+    };
+    println!("chain: {}", chain_name);
+
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let pinned = ctx.pinned_height(&chain_name);
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(forecast_gas(&ctx, &chain_name, pinned))?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("gas:{}", report.chain_id);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::GasForecast {
+                    chainId: report.chain_id,
+                    blockNumber: report.block_number,
+                    horizonBlocks: report.horizon_blocks,
+                    nextBaseFee: report.next_base_fee,
+                    forecastBaseFee: report.forecast_base_fee,
+                    maxBaseFee: report.max_base_fee,
+                    priorityFeeP50: report.priority_fee_p50,
+                    priorityFeeP90: report.priority_fee_p90,
+                    utilizationBps: report.utilization_bps,
+                    congestion: report.congestion.level(),
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct GasReport {
+    chain_id: u64,
+    /// Newest block of the history
+    block_number: u64,
+    horizon_blocks: u64,
+    /// Base fee of the next block, known exactly; fees are in wei
+    next_base_fee: U256,
+    /// Expected base fee `horizon_blocks` after `block_number`
+    forecast_base_fee: U256,
+    /// Base fee if every block until then is full
+    max_base_fee: U256,
+    /// Median over the history of each block's priority fee percentile
+    priority_fee_p50: U256,
+    priority_fee_p90: U256,
+    /// Mean gas used over the gas limit
+    utilization_bps: u16,
+    /// Executable transactions in the RPC node's pool, when it reports them
+    pending: Option<u64>,
+    congestion: Congestion,
+}
+
+async fn forecast_gas(
+    ctx: &RunContext,
+    chain_name: &str,
+    pinned: Option<u64>,
+) -> Result<GasReport, String> {
+    let chain =
+        get_eth_chain_config(chain_name).ok_or_else(|| format!("Unknown chain {}", chain_name))?;
+    let chain_id = chain.chain_id.parse().map_err(|e| format!("Invalid chain id: {}", e))?;
+    let endpoint = chain
+        .http_endpoint
+        .ok_or_else(|| format!("No http endpoint configured for chain {}", chain_name))?;
+    let parse = |key: &str, default: u64| {
+        config::parse_or(key, default).map_err(|e| e.to_string()).and_then(|value| match value {
+            0 => Err(format!("{} must be positive", key)),
+            value => Ok(value),
+        })
+    };
+    let history_blocks = parse("gas_history_blocks", DEFAULT_HISTORY_BLOCKS)?;
+    let horizon_blocks = parse("gas_horizon_blocks", DEFAULT_HORIZON_BLOCKS)?;
+    let congested_pending = parse("gas_congested_pending", DEFAULT_CONGESTED_PENDING)?;
+
+    let provider = evm::provider(&endpoint).map_err(|e| e.to_string())?;
+    let block_number = match pinned {
+        Some(height) => height,
+        None => ctx
+            .run(evm::block_number(&provider))
+            .await
+            .map_err(|e| e.to_string())?
+            .map_err(|e| e.to_string())?,
+    };
+    let history = ctx
+        .run(evm::fee_history(&provider, history_blocks, block_number, &REWARD_PERCENTILES))
+        .await
+        .map_err(|e| e.to_string())?
+        .map_err(|e| e.to_string())?;
+    // The pool is the node's own view and not pinned, so it only raises the
+    // congestion level; nodes without `txpool_status` are forecast without it
+    let pending = match ctx.run(evm::txpool_pending(&provider)).await.map_err(|e| e.to_string())? {
+        Ok(pending) => Some(pending),
+        Err(e) => {
+            println!("pending pool unavailable: {e:#}");
+            None
+        }
+    };
+    let horizon = (horizon_blocks, congested_pending);
+    gas_report(chain_id, block_number, horizon, &history, pending)
+}
+
+/// Forecasts `horizon.0` blocks past `history`, with the pending pool
+/// congested from `horizon.1` transactions
+fn gas_report(
+    chain_id: u64,
+    block_number: u64,
+    (horizon_blocks, congested_pending): (u64, u64),
+    history: &FeeHistory,
+    pending: Option<u64>,
+) -> Result<GasReport, String> {
+    let next_base_fee = *history.base_fee_per_gas.last().ok_or("Fee history has no base fees")?;
+    if history.gas_used_ratio.is_empty() {
+        return Err("Fee history has no blocks".to_string());
+    }
+    let utilization =
+        history.gas_used_ratio.iter().sum::<f64>() / history.gas_used_ratio.len() as f64;
+    let pool_congested = pending.is_some_and(|pending| pending >= congested_pending);
+    let congestion = forecast::congestion(utilization, pool_congested);
+    let expected = if pool_congested { 1.0 } else { utilization };
+    let percentile = |i: usize| {
+        forecast::median(history.reward.iter().filter_map(|r| r.get(i).copied()).collect())
+            .unwrap_or_default()
+    };
+
+    Ok(GasReport {
+        chain_id,
+        block_number,
+        horizon_blocks,
+        next_base_fee,
+        forecast_base_fee: forecast::project(next_base_fee, expected, horizon_blocks - 1),
+        max_base_fee: forecast::project(next_base_fee, 1.0, horizon_blocks - 1),
+        priority_fee_p50: percentile(0),
+        priority_fee_p90: percentile(1),
+        utilization_bps: (utilization.clamp(0.0, 1.0) * 10_000.0).round() as u16,
+        pending,
+        congestion,
+    })
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // Fees in wei; `congestion` is 0 low, 1 normal, 2 high
+        struct GasForecast {
+            uint64 chainId;
+            uint64 blockNumber;
+            uint64 horizonBlocks;
+            uint256 nextBaseFee;
+            uint256 forecastBaseFee;
+            uint256 maxBaseFee;
+            uint256 priorityFeeP50;
+            uint256 priorityFeeP90;
+            uint16 utilizationBps;
+            uint8 congestion;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloy_primitives::U64;
+
+    const GWEI: u64 = 1_000_000_000;
+
+    fn history(gas_used_ratio: Vec<f64>, reward: Vec<[u64; 2]>) -> FeeHistory {
+        FeeHistory {
+            oldest_block: U64::from(21_000_000),
+            base_fee_per_gas: vec![U256::from(GWEI); gas_used_ratio.len() + 1],
+            gas_used_ratio,
+            reward: reward
+                .into_iter()
+                .map(|fees| fees.into_iter().map(U256::from).collect())
+                .collect(),
+        }
+    }
+
+    #[test]
+    fn forecast_assumes_the_mean_utilization() {
+        let history = history(vec![0.5, 1.0], vec![[1, 10], [3, 30]]);
+        let report = gas_report(1, 21_000_001, (3, 10_000), &history, Some(50)).unwrap();
+        assert_eq!(report.next_base_fee, U256::from(GWEI));
+        // Two blocks changing the fee by 1/16 each
+        assert_eq!(report.forecast_base_fee, U256::from(1_128_906_250u64));
+        assert_eq!(report.max_base_fee, U256::from(1_265_625_000u64));
+        assert_eq!((report.utilization_bps, report.congestion), (7_500, Congestion::Normal));
+        // The lower middle of an even count
+        assert_eq!(
+            (report.priority_fee_p50, report.priority_fee_p90),
+            (U256::from(1), U256::from(10))
+        );
+    }
+
+    #[test]
+    fn a_congested_pool_forecasts_full_blocks() {
+        let history = history(vec![0.2, 0.3, 0.1], vec![[1, 10], [3, 30], [2, 20]]);
+        let report = gas_report(1, 21_000_002, (3, 10_000), &history, Some(10_000)).unwrap();
+        assert_eq!(report.congestion, Congestion::High);
+        assert_eq!(report.forecast_base_fee, report.max_base_fee);
+        assert_eq!(
+            (report.priority_fee_p50, report.priority_fee_p90),
+            (U256::from(2), U256::from(20))
+        );
+
+        let report = gas_report(1, 21_000_002, (3, 10_000), &history, None).unwrap();
+        assert_eq!((report.congestion, report.pending), (Congestion::Low, None));
+        assert!(report.forecast_base_fee < report.next_base_fee);
+    }
+
+    #[test]
+    fn next_block_horizon_is_the_known_fee() {
+        let history = history(vec![1.0], vec![]);
+        let report = gas_report(1, 21_000_000, (1, 10_000), &history, None).unwrap();
+        assert_eq!(report.forecast_base_fee, U256::from(GWEI));
+        assert_eq!(report.max_base_fee, U256::from(GWEI));
+        assert_eq!(report.priority_fee_p50, U256::ZERO);
+    }
+
+    #[test]
+    fn empty_histories_fail() {
+        let mut empty = history(vec![], vec![]);
+        assert_eq!(
+            gas_report(1, 0, (5, 10_000), &empty, None).unwrap_err(),
+            "Fee history has no blocks"
+        );
+        empty.base_fee_per_gas.clear();
+        assert_eq!(
+            gas_report(1, 0, (5, 10_000), &empty, None).unwrap_err(),
+            "Fee history has no base fees"
+        );
+    }
+}
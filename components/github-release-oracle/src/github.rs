@@ -0,0 +1,138 @@
+//! GitHub REST API reads for a release: the release, its tag's commit and
+//! its assets.
+
+use anyhow::{anyhow, Context, Result};
+use common::{config, http, proxy, secret::Secret};
+use serde::{de::DeserializeOwned, Deserialize};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+/// Public API, overridable with `github_api_url` (e.g. for GitHub Enterprise)
+pub const DEFAULT_API_URL: &str = "https://api.github.com";
+
+/// Optional token raising the API rate limit and granting private repos
+pub const TOKEN_ENV: &str = "WAVS_ENV_GITHUB_TOKEN";
+
+pub struct GitHub {
+    api_url: String,
+    token: Option<Secret>,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct Release {
+    pub tag_name: String,
+    pub draft: bool,
+    pub prerelease: bool,
+    pub assets: Vec<Asset>,
+}
+
+#[derive(Debug, Deserialize)]
+pub struct Asset {
+    pub name: String,
+    pub size: u64,
+    /// API URL of the asset, served as bytes with `Accept: application/octet-stream`
+    pub url: String,
+    /// `sha256:<hex>`, computed by GitHub for assets uploaded since mid 2025
+    #[serde(default)]
+    pub digest: Option<String>,
+}
+
+#[derive(Debug, Deserialize)]
+struct GitRef {
+    object: GitObject,
+}
+
+#[derive(Debug, Deserialize)]
+struct GitTag {
+    object: GitObject,
+}
+
+#[derive(Debug, Deserialize)]
+struct GitObject {
+    sha: String,
+    #[serde(rename = "type")]
+    kind: String,
+}
+
+impl GitHub {
+    pub fn from_env() -> Self {
+        Self {
+            api_url: config::string_or("github_api_url", DEFAULT_API_URL)
+                .trim_end_matches('/')
+                .to_string(),
+            token: Secret::from_env(TOKEN_ENV),
+        }
+    }
+
+    pub async fn release(&self, repo: &str, tag: &str) -> Result<Release> {
+        self.get_json(&format!("/repos/{repo}/releases/tags/{}", http::percent_encode(tag))).await
+    }
+
+    /// The commit a tag points at, peeling annotated tags
+    pub async fn tag_commit(&self, repo: &str, tag: &str) -> Result<String> {
+        let tag_ref: GitRef = self
+            .get_json(&format!("/repos/{repo}/git/ref/tags/{}", http::percent_encode(tag)))
+            .await?;
+        let mut object = tag_ref.object;
+        // Tags of tags are allowed, but never nest deeply in practice
+        for _ in 0..4 {
+            match object.kind.as_str() {
+                "commit" => return Ok(object.sha),
+                "tag" => {
+                    let tag: GitTag =
+                        self.get_json(&format!("/repos/{repo}/git/tags/{}", object.sha)).await?;
+                    object = tag.object;
+                }
+                kind => return Err(anyhow!("tag {tag} points at a {kind}, not a commit")),
+            }
+        }
+        Err(anyhow!("tag {tag} is nested too deeply"))
+    }
+
+    /// Downloads an asset, following the redirect to its storage URL
+    pub async fn download(&self, asset: &Asset) -> Result<Vec<u8>> {
+        let response = self.send(&asset.url, "application/octet-stream", true).await?;
+        let response = match response.status {
+            301 | 302 | 307 | 308 => {
+                let location = response.header("location").with_context(|| {
+                    format!("redirect for asset {} has no location", asset.name)
+                })?;
+                // The storage URL is pre-signed and must not get the API token
+                self.send(location, "application/octet-stream", false).await?
+            }
+            _ => response,
+        };
+        response.into_ok_body().with_context(|| format!("failed to download asset {}", asset.name))
+    }
+
+    async fn get_json<T: DeserializeOwned>(&self, path: &str) -> Result<T> {
+        let url = format!("{}{}", self.api_url, path);
+        let body = self
+            .send(&url, "application/vnd.github+json", true)
+            .await?
+            .into_ok_body()
+            .with_context(|| format!("GitHub request {path} failed"))?;
+        serde_json::from_slice(&body).with_context(|| format!("invalid GitHub response for {path}"))
+    }
+
+    async fn send(
+        &self,
+        url: &str,
+        accept: &'static str,
+        authorize: bool,
+    ) -> Result<http::Response> {
+        let mut req = http_request_get(url)?;
+        let headers = req.headers_mut();
+        headers.insert("Accept", HeaderValue::from_static(accept));
+        headers.insert("X-GitHub-Api-Version", HeaderValue::from_static("2022-11-28"));
+        // GitHub rejects requests without a user agent
+        headers.insert("User-Agent", HeaderValue::from_static("wavs-github-release-oracle"));
+        if let Some(token) = self.token.as_ref().filter(|_| authorize) {
+            let value = HeaderValue::from_str(&format!("Bearer {}", token.expose()))
+                .with_context(|| format!("invalid {TOKEN_ENV}"))?;
+            headers.insert("Authorization", value);
+        }
+        proxy::apply(&mut req)?;
+        http::send(req).await
+    }
+}
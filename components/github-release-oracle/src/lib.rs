@@ -0,0 +1,333 @@
+mod github;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_primitives::{hex, FixedBytes, B256};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    output::{self, Computed},
+    panic_guard,
+};
+use github::{Asset, GitHub};
+use serde::{Deserialize, Serialize};
+use sha2::{Digest, Sha256};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["release"];
+
+/// Largest asset hashed locally when GitHub has no digest for it,
+/// overridable with `max_asset_bytes`
+const DEFAULT_MAX_ASSET_BYTES: u64 = 32 * 1024 * 1024;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let (repository, tag) = parse_release(input.trim_end_matches('\0').trim())?;
+    println!("release: {}@{}", repository, tag);
+
+    let max_asset_bytes =
+        config::parse_or("max_asset_bytes", DEFAULT_MAX_ASSET_BYTES).map_err(|e| e.to_string())?;
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let release = block_on(async {
+            ctx.run(verify_release(&GitHub::from_env(), &repository, &tag, max_asset_bytes))
+                .await
+                .map_err(|e| e.to_string())?
+        })?;
+        println!("release: {:?}", release);
+
+        let feed_id = format!("release:{}@{}", release.repository, release.tag);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::GitHubRelease {
+                    repository: release.repository.clone(),
+                    tag: release.tag.clone(),
+                    commitSha: release.commit,
+                    prerelease: release.prerelease,
+                    assets: release
+                        .assets
+                        .iter()
+                        .map(|asset| solidity::ReleaseAsset {
+                            name: asset.name.clone(),
+                            size: asset.size,
+                            sha256: asset.sha256,
+                        })
+                        .collect(),
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => {
+                canonical_json::to_vec(&release).map_err(|e| e.to_string())?
+            }
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// Parses `owner/repo@tag`
+fn parse_release(input: &str) -> Result<(String, String), String> {
+    let (repository, tag) =
+        input.split_once('@').ok_or("Expected owner/repo@tag, e.g. rust-lang/rust@1.80.0")?;
+    // `.` and `..` would walk up the API path
+    let valid_name = |s: &str| {
+        !s.is_empty()
+            && s.chars().any(|c| c != '.')
+            && s.chars().all(|c| c.is_ascii_alphanumeric() || matches!(c, '-' | '_' | '.'))
+    };
+    match repository.split_once('/') {
+        Some((owner, repo)) if valid_name(owner) && valid_name(repo) => {}
+        _ => return Err(format!("Invalid repository: {}", repository)),
+    }
+    if tag.is_empty() {
+        return Err("Empty release tag".to_string());
+    }
+    Ok((repository.to_string(), tag.to_string()))
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct VerifiedRelease {
+    repository: String,
+    tag: String,
+    commit: FixedBytes<20>,
+    prerelease: bool,
+    assets: Vec<AssetChecksum>,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct AssetChecksum {
+    name: String,
+    size: u64,
+    sha256: B256,
+    /// Whether the checksum is GitHub's digest or was computed from the download
+    source: ChecksumSource,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum ChecksumSource {
+    Github,
+    Download,
+}
+
+async fn verify_release(
+    github: &GitHub,
+    repository: &str,
+    tag: &str,
+    max_asset_bytes: u64,
+) -> Result<VerifiedRelease, String> {
+    let release = github.release(repository, tag).await.map_err(|e| format!("{:#}", e))?;
+    if release.draft {
+        return Err(format!("Release {} is a draft", tag));
+    }
+    let commit = github.tag_commit(repository, tag).await.map_err(|e| format!("{:#}", e))?;
+    let commit = parse_commit(&commit)?;
+
+    let mut assets = Vec::with_capacity(release.assets.len());
+    for asset in &release.assets {
+        assets.push(checksum(github, asset, max_asset_bytes).await?);
+    }
+    // Upload order is not stable, names are unique within a release
+    assets.sort_by(|a, b| a.name.cmp(&b.name));
+
+    Ok(VerifiedRelease {
+        repository: repository.to_string(),
+        tag: release.tag_name,
+        commit,
+        prerelease: release.prerelease,
+        assets,
+    })
+}
+
+/// Parses a 40 hex digit commit SHA
+fn parse_commit(sha: &str) -> Result<FixedBytes<20>, String> {
+    hex::decode(sha)
+        .ok()
+        .and_then(|sha| FixedBytes::<20>::try_from(sha.as_slice()).ok())
+        .ok_or_else(|| format!("Invalid commit SHA {}", sha))
+}
+
+/// Uses GitHub's digest when there is one, otherwise hashes the download
+async fn checksum(
+    github: &GitHub,
+    asset: &Asset,
+    max_asset_bytes: u64,
+) -> Result<AssetChecksum, String> {
+    if let Some(checksum) = github_checksum(asset)? {
+        return Ok(checksum);
+    }
+    if asset.size > max_asset_bytes {
+        return Err(format!(
+            "Asset {} has no digest and is {} bytes, above max_asset_bytes {}",
+            asset.name, asset.size, max_asset_bytes
+        ));
+    }
+    let data = github.download(asset).await.map_err(|e| format!("{:#}", e))?;
+    downloaded_checksum(asset, &data)
+}
+
+/// The checksum from GitHub's `sha256:` digest of `asset`, if it has one
+fn github_checksum(asset: &Asset) -> Result<Option<AssetChecksum>, String> {
+    let Some(digest) = &asset.digest else {
+        return Ok(None);
+    };
+    let sha256 = digest
+        .strip_prefix("sha256:")
+        .and_then(|digits| digits.parse::<B256>().ok())
+        .ok_or_else(|| format!("Unsupported digest {} for asset {}", digest, asset.name))?;
+    Ok(Some(AssetChecksum {
+        name: asset.name.clone(),
+        size: asset.size,
+        sha256,
+        source: ChecksumSource::Github,
+    }))
+}
+
+/// The checksum of `data` downloaded for `asset`, which must be the size
+/// GitHub lists
+fn downloaded_checksum(asset: &Asset, data: &[u8]) -> Result<AssetChecksum, String> {
+    if data.len() as u64 != asset.size {
+        return Err(format!(
+            "Asset {} downloaded {} bytes, expected {}",
+            asset.name,
+            data.len(),
+            asset.size
+        ));
+    }
+    Ok(AssetChecksum {
+        name: asset.name.clone(),
+        size: asset.size,
+        sha256: B256::from_slice(&Sha256::digest(data)),
+        source: ChecksumSource::Download,
+    })
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        struct ReleaseAsset {
+            string name;
+            uint64 size;
+            bytes32 sha256;
+        }
+
+        struct GitHubRelease {
+            string repository;
+            string tag;
+            bytes20 commitSha;
+            bool prerelease;
+            ReleaseAsset[] assets;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloy_primitives::b256;
+
+    /// `sha256("hello")`
+    const HELLO: B256 = b256!("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824");
+
+    fn asset(size: u64, digest: Option<&str>) -> Asset {
+        Asset {
+            name: "wavs-x86_64.tar.gz".to_string(),
+            size,
+            url: "https://api.github.com/repos/Lay3rLabs/WAVS/releases/assets/1".to_string(),
+            digest: digest.map(String::from),
+        }
+    }
+
+    #[test]
+    fn release_parses_from_input() {
+        assert_eq!(
+            parse_release("rust-lang/rust@1.80.0"),
+            Ok(("rust-lang/rust".to_string(), "1.80.0".to_string()))
+        );
+        assert_eq!(
+            parse_release("Lay3rLabs/WAVS@v0.3.0-alpha.4"),
+            Ok(("Lay3rLabs/WAVS".to_string(), "v0.3.0-alpha.4".to_string()))
+        );
+        assert!(parse_release("rust-lang/rust").is_err());
+        assert_eq!(parse_release("rust-lang/rust@"), Err("Empty release tag".to_string()));
+        for repository in ["rust", "rust-lang/", "/rust", "a/b/c", "rust lang/rust", "../x"] {
+            assert_eq!(
+                parse_release(&format!("{repository}@1.0")),
+                Err(format!("Invalid repository: {repository}"))
+            );
+        }
+    }
+
+    #[test]
+    fn commit_is_a_full_sha() {
+        let sha = "3f5b1a4e8c2d9f0a7b6c5d4e3f2a1b0c9d8e7f6a";
+        assert_eq!(hex::encode(parse_commit(sha).unwrap()), sha);
+        assert!(parse_commit("3f5b1a4").is_err());
+        assert!(parse_commit("not hex").is_err());
+    }
+
+    #[test]
+    fn github_digest_is_used_when_present() {
+        let digest = format!("sha256:{}", hex::encode(HELLO));
+        let checksum = github_checksum(&asset(5, Some(&digest))).unwrap().unwrap();
+        assert_eq!((checksum.sha256, checksum.source), (HELLO, ChecksumSource::Github));
+
+        assert!(github_checksum(&asset(5, None)).unwrap().is_none());
+        assert_eq!(
+            github_checksum(&asset(5, Some("sha512:00"))).unwrap_err(),
+            "Unsupported digest sha512:00 for asset wavs-x86_64.tar.gz"
+        );
+    }
+
+    #[test]
+    fn downloads_are_hashed_at_the_listed_size() {
+        let checksum = downloaded_checksum(&asset(5, None), b"hello").unwrap();
+        assert_eq!((checksum.sha256, checksum.source), (HELLO, ChecksumSource::Download));
+        assert_eq!(
+            downloaded_checksum(&asset(6, None), b"hello").unwrap_err(),
+            "Asset wavs-x86_64.tar.gz downloaded 5 bytes, expected 6"
+        );
+    }
+
+    #[test]
+    fn release_decodes_from_the_api() {
+        let release: github::Release = serde_json::from_str(
+            r#"{"tag_name": "v1.0.0", "draft": false, "prerelease": true, "assets": [
+                {"name": "a.tar.gz", "size": 5, "url": "https://api.github.com/a", "digest": null},
+                {"name": "b.tar.gz", "size": 6, "url": "https://api.github.com/b",
+                 "digest": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"}
+            ]}"#,
+        )
+        .unwrap();
+        assert!(release.prerelease && !release.draft);
+        assert_eq!(release.assets[0].digest, None);
+        assert_eq!(github_checksum(&release.assets[1]).unwrap().unwrap().sha256, HELLO);
+    }
+}
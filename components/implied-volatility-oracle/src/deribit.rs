@@ -0,0 +1,327 @@
+//! Deribit's public options market data.
+//!
+//! The base URL is overridable with `deribit_base_urls`, like any other
+//! [`Mirrors`] source. Deribit quotes volatility in annualized percent.
+
+use anyhow::{anyhow, Context, Result};
+use common::{clock, context::RunContext, http::fetch_json, mirrors::Mirrors, proxy};
+use serde::{de::DeserializeOwned, Deserialize};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+const DEFAULT_BASE: &str = "https://www.deribit.com";
+
+/// How far back DVOL candles are read; the index prints every minute
+const DVOL_WINDOW_SECS: u64 = 600;
+
+/// Deribit's JSON-RPC style reply
+#[derive(Debug, Deserialize)]
+struct Reply<T> {
+    result: Option<T>,
+    error: Option<ReplyError>,
+}
+
+#[derive(Debug, Deserialize)]
+struct ReplyError {
+    code: i64,
+    message: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct VolatilityIndexData {
+    /// `[timestamp_ms, open, high, low, close]`
+    data: Vec<(u64, f64, f64, f64, f64)>,
+}
+
+#[derive(Debug, Deserialize)]
+struct BookSummary {
+    instrument_name: String,
+    mark_iv: Option<f64>,
+    underlying_price: Option<f64>,
+}
+
+/// A DVOL reading: the 30-day constant-maturity implied volatility index
+#[derive(Debug, Clone, PartialEq)]
+pub struct Dvol {
+    /// Annualized percent
+    pub percent: f64,
+    /// Unix seconds of the candle
+    pub timestamp: u64,
+}
+
+/// At-the-money implied volatility of one expiry
+#[derive(Debug, Clone, PartialEq)]
+pub struct AtmVol {
+    /// Annualized percent, the mean of the call and put mark IVs
+    pub percent: f64,
+    /// Unix seconds the options expire at
+    pub expiry: u64,
+    pub strike: f64,
+    /// Price of the expiry's underlying future
+    pub underlying_price: f64,
+}
+
+/// The last DVOL close at or before `now`
+pub async fn dvol(ctx: &RunContext, currency: &str, now: u64) -> Result<Dvol> {
+    let (start, end) = (now.saturating_sub(DVOL_WINDOW_SECS) * 1_000, now * 1_000);
+    let path = format!(
+        "/api/v2/public/get_volatility_index_data?currency={currency}&start_timestamp={start}&end_timestamp={end}&resolution=60"
+    );
+    get::<VolatilityIndexData>(ctx, &path).await?.latest(currency, now)
+}
+
+impl VolatilityIndexData {
+    /// The last close at or before `now`
+    fn latest(&self, currency: &str, now: u64) -> Result<Dvol> {
+        self.data
+            .iter()
+            .filter(|candle| candle.0 <= now * 1_000)
+            .max_by_key(|candle| candle.0)
+            .map(|&(timestamp, _, _, _, close)| Dvol {
+                percent: close,
+                timestamp: timestamp / 1_000,
+            })
+            .ok_or_else(|| anyhow!("no {currency} DVOL in the {DVOL_WINDOW_SECS}s before {now}"))
+    }
+}
+
+/// At-the-money implied volatility of the first expiry at least
+/// `min_expiry_secs` after `now`, from the strike nearest the underlying
+/// (the lower one on a tie)
+pub async fn atm(
+    ctx: &RunContext,
+    currency: &str,
+    now: u64,
+    min_expiry_secs: u64,
+) -> Result<AtmVol> {
+    let path =
+        format!("/api/v2/public/get_book_summary_by_currency?currency={currency}&kind=option");
+    let summaries: Vec<BookSummary> = get(ctx, &path).await?;
+    atm_vol(&summaries, currency, now, min_expiry_secs)
+}
+
+fn atm_vol(
+    summaries: &[BookSummary],
+    currency: &str,
+    now: u64,
+    min_expiry_secs: u64,
+) -> Result<AtmVol> {
+    let mut options = Vec::new();
+    for summary in summaries {
+        let Some(option) = Instrument::parse(&summary.instrument_name) else {
+            println!("skipping unrecognized instrument {}", summary.instrument_name);
+            continue;
+        };
+        if option.expiry >= now + min_expiry_secs {
+            options.push((option, summary));
+        }
+    }
+    let expiry = options
+        .iter()
+        .map(|(option, _)| option.expiry)
+        .min()
+        .with_context(|| format!("no {currency} options expire after {min_expiry_secs}s"))?;
+    options.retain(|(option, _)| option.expiry == expiry);
+
+    let underlying_price = options
+        .iter()
+        .find_map(|(_, summary)| summary.underlying_price)
+        .filter(|price| price.is_finite() && *price > 0.0)
+        .context("no underlying price")?;
+    let strike = options
+        .iter()
+        .map(|(option, _)| option.strike)
+        .min_by(|a, b| {
+            (a - underlying_price)
+                .abs()
+                .total_cmp(&(b - underlying_price).abs())
+                .then(a.total_cmp(b))
+        })
+        .context("no strikes")?;
+    let ivs: Vec<f64> = options
+        .iter()
+        .filter(|(option, _)| option.strike == strike)
+        .filter_map(|(_, summary)| summary.mark_iv)
+        .filter(|iv| iv.is_finite() && *iv > 0.0)
+        .collect();
+    if ivs.is_empty() {
+        return Err(anyhow!("no mark IV at strike {strike}"));
+    }
+    Ok(AtmVol {
+        percent: ivs.iter().sum::<f64>() / ivs.len() as f64,
+        expiry,
+        strike,
+        underlying_price,
+    })
+}
+
+/// An option named like `BTC-27DEC24-100000-C`
+struct Instrument {
+    /// Unix seconds; Deribit options expire at 08:00 UTC
+    expiry: u64,
+    strike: f64,
+}
+
+impl Instrument {
+    fn parse(name: &str) -> Option<Self> {
+        let mut parts = name.split('-');
+        let (_, date, strike, _) = (parts.next()?, parts.next()?, parts.next()?, parts.next()?);
+        // Day without padding, then e.g. DEC24
+        let split = date.len().checked_sub(5).filter(|_| date.is_ascii())?;
+        let (day, month, year) = (&date[..split], &date[split..split + 3], &date[split + 3..]);
+        const MONTHS: [&str; 12] =
+            ["JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"];
+        let month = MONTHS.iter().position(|m| *m == month)? + 1;
+        let (day, year): (u64, u64) = (day.parse().ok()?, year.parse().ok()?);
+        let expiry =
+            clock::parse_utc(&format!("{:04}-{:02}-{:02}T08:00:00", 2000 + year, month, day))
+                .ok()?;
+        // Some strikes use `d` as the decimal point, e.g. `0d5`
+        let strike: f64 = strike.replace('d', ".").parse().ok()?;
+        (strike.is_finite() && strike > 0.0).then_some(Self { expiry, strike })
+    }
+}
+
+async fn get<T: DeserializeOwned>(ctx: &RunContext, path: &str) -> Result<T> {
+    let reply: Reply<T> = Mirrors::from_env("deribit", DEFAULT_BASE)?
+        .fetch(ctx, path, |url| async move {
+            let mut req = http_request_get(&url)?;
+            req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+            proxy::apply(&mut req)?;
+            fetch_json(req).await
+        })
+        .await?;
+    reply.into_result()
+}
+
+impl<T> Reply<T> {
+    fn into_result(self) -> Result<T> {
+        if let Some(error) = self.error {
+            return Err(anyhow!("deribit: {} {}", error.code, error.message));
+        }
+        self.result.context("deribit: empty reply")
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// 2025-01-01T00:00:00Z
+    const NOW: u64 = 1_735_689_600;
+    const WEEK: u64 = 7 * 86_400;
+    /// 2025-01-10T08:00:00Z
+    const JAN_10: u64 = 1_736_496_000;
+
+    fn summaries(json: &str) -> Vec<BookSummary> {
+        serde_json::from_str(json).unwrap()
+    }
+
+    #[test]
+    fn instruments_parse() {
+        let option = Instrument::parse("BTC-27DEC24-100000-C").unwrap();
+        assert_eq!((option.expiry, option.strike), (1_735_286_400, 100_000.0));
+        let option = Instrument::parse("XRP_USDC-3JAN25-0d5-P").unwrap();
+        assert_eq!((option.expiry, option.strike), (1_735_891_200, 0.5));
+        for invalid in [
+            "BTC-PERPETUAL",
+            "BTC-27DEC24",
+            "BTC-27XYZ24-100000-C",
+            "BTC-32DEC24-100000-C",
+            "BTC-27DEC24-0-C",
+            "BTC-27DEC24-abc-C",
+        ] {
+            assert!(Instrument::parse(invalid).is_none(), "{invalid}");
+        }
+    }
+
+    #[test]
+    fn dvol_is_the_last_close_by_now() {
+        let index: VolatilityIndexData = serde_json::from_str(
+            r#"{"data": [
+                [1735689480000, 50.0, 51.0, 49.0, 50.5],
+                [1735689540000, 50.5, 52.0, 50.0, 51.25],
+                [1735689660000, 51.0, 53.0, 51.0, 52.0]
+            ], "continuation": null}"#,
+        )
+        .unwrap();
+        assert_eq!(
+            index.latest("BTC", NOW).unwrap(),
+            Dvol { percent: 51.25, timestamp: 1_735_689_540 }
+        );
+        assert_eq!(
+            index.latest("BTC", 1_735_689_000).unwrap_err().to_string(),
+            "no BTC DVOL in the 600s before 1735689000"
+        );
+    }
+
+    #[test]
+    fn atm_reads_the_first_expiry_past_the_minimum() {
+        let summaries = summaries(
+            r#"[
+                {"instrument_name": "BTC-3JAN25-100000-C", "mark_iv": 40.0, "underlying_price": 99000.0},
+                {"instrument_name": "BTC-PERPETUAL", "mark_iv": null, "underlying_price": null},
+                {"instrument_name": "BTC-10JAN25-95000-C", "mark_iv": 58.0, "underlying_price": 101000.0},
+                {"instrument_name": "BTC-10JAN25-100000-C", "mark_iv": 55.2, "underlying_price": 101000.0},
+                {"instrument_name": "BTC-10JAN25-100000-P", "mark_iv": 54.8, "underlying_price": 101000.0},
+                {"instrument_name": "BTC-10JAN25-105000-P", "mark_iv": 53.0, "underlying_price": 101000.0},
+                {"instrument_name": "BTC-31JAN25-100000-C", "mark_iv": 60.0, "underlying_price": 101500.0}
+            ]"#,
+        );
+        assert_eq!(
+            atm_vol(&summaries, "BTC", NOW, WEEK).unwrap(),
+            AtmVol {
+                percent: 55.0,
+                expiry: JAN_10,
+                strike: 100_000.0,
+                underlying_price: 101_000.0
+            }
+        );
+        assert_eq!(
+            atm_vol(&summaries, "BTC", NOW, 60 * 86_400).unwrap_err().to_string(),
+            "no BTC options expire after 5184000s"
+        );
+    }
+
+    #[test]
+    fn atm_ties_take_the_lower_strike() {
+        let summaries = summaries(
+            r#"[
+                {"instrument_name": "ETH-10JAN25-3500-C", "mark_iv": 62.0, "underlying_price": 3550.0},
+                {"instrument_name": "ETH-10JAN25-3600-C", "mark_iv": 60.0, "underlying_price": 3550.0},
+                {"instrument_name": "ETH-10JAN25-3500-P", "mark_iv": null, "underlying_price": 3550.0}
+            ]"#,
+        );
+        let atm = atm_vol(&summaries, "ETH", NOW, WEEK).unwrap();
+        assert_eq!((atm.strike, atm.percent), (3_500.0, 62.0));
+    }
+
+    #[test]
+    fn atm_needs_a_price_and_an_iv() {
+        let no_price = summaries(
+            r#"[{"instrument_name": "ETH-10JAN25-3500-C", "mark_iv": 62.0, "underlying_price": null}]"#,
+        );
+        assert_eq!(
+            atm_vol(&no_price, "ETH", NOW, WEEK).unwrap_err().to_string(),
+            "no underlying price"
+        );
+        let no_iv = summaries(
+            r#"[{"instrument_name": "ETH-10JAN25-3500-C", "mark_iv": 0.0, "underlying_price": 3550.0}]"#,
+        );
+        assert_eq!(
+            atm_vol(&no_iv, "ETH", NOW, WEEK).unwrap_err().to_string(),
+            "no mark IV at strike 3500"
+        );
+    }
+
+    #[test]
+    fn reply_errors_are_reported() {
+        let reply: Reply<Vec<BookSummary>> = serde_json::from_str(
+            r#"{"jsonrpc": "2.0", "error": {"code": 10009, "message": "invalid_currency"}}"#,
+        )
+        .unwrap();
+        assert_eq!(reply.into_result().unwrap_err().to_string(), "deribit: 10009 invalid_currency");
+        let empty: Reply<Vec<BookSummary>> = serde_json::from_str(r#"{"jsonrpc": "2.0"}"#).unwrap();
+        assert_eq!(empty.into_result().unwrap_err().to_string(), "deribit: empty reply");
+    }
+}
@@ -0,0 +1,265 @@
+mod deribit;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_primitives::U256;
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    fixed_point::{self, Rounding},
+    output::{self, Computed},
+    panic_guard,
+};
+use deribit::AtmVol;
+use serde::{Deserialize, Serialize};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["volatility"];
+
+/// Shortest time to expiry the `chain` source accepts, overridable with
+/// `iv_min_expiry_days`; nearer expiries swing with the last few days' moves
+const DEFAULT_MIN_EXPIRY_DAYS: u64 = 7;
+
+/// Decimals of the fixed-point volatility, an annualized fraction
+const VOL_DECIMALS: u8 = 18;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let currency = parse_currency(input.trim_end_matches('\0'))?;
+    println!("currency: {}", currency);
+
+    let source = config::parse_or("iv_source", Source::Dvol).map_err(|e| e.to_string())?;
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(read_volatility(&ctx, &currency, source))?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("iv:{}", report.currency);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::ImpliedVolatility {
+                    currency: report.currency.clone(),
+                    source: report.source.as_str().to_string(),
+                    volatility: report.volatility,
+                    decimals: VOL_DECIMALS,
+                    timestamp: report.timestamp,
+                    expiry: report.atm.as_ref().map_or(0, |atm| atm.expiry),
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// Where the volatility comes from, set with `iv_source`
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Source {
+    /// Deribit's DVOL index, a 30-day constant-maturity volatility
+    Dvol,
+    /// At-the-money mark IV of the nearest listed expiry past
+    /// `iv_min_expiry_days`
+    Chain,
+}
+
+impl std::str::FromStr for Source {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> anyhow::Result<Self> {
+        match s {
+            "dvol" => Ok(Self::Dvol),
+            "chain" => Ok(Self::Chain),
+            _ => Err(anyhow::anyhow!("unknown volatility source {s}, expected dvol or chain")),
+        }
+    }
+}
+
+impl Source {
+    fn as_str(self) -> &'static str {
+        match self {
+            Self::Dvol => "dvol",
+            Self::Chain => "chain",
+        }
+    }
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct AtmDetail {
+    /// Unix seconds the options expire at
+    expiry: u64,
+    strike: U256,
+    underlying_price: U256,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct VolatilityReport {
+    currency: String,
+    source: Source,
+    /// Annualized, fixed-point with `VOL_DECIMALS`: 0.55e18 is 55%
+    volatility: U256,
+    /// Unix seconds of the reading
+    timestamp: u64,
+    /// The options read, for the `chain` source; prices have `VOL_DECIMALS`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    atm: Option<AtmDetail>,
+}
+
+/// An underlying as Deribit names it, e.g. `BTC`
+fn parse_currency(s: &str) -> Result<String, String> {
+    let s = s.trim();
+    if s.is_empty() || s.len() > 10 || !s.bytes().all(|b| b.is_ascii_alphanumeric()) {
+        return Err(format!("Invalid currency {s:?}, expected e.g. BTC or ETH"));
+    }
+    Ok(s.to_ascii_uppercase())
+}
+
+async fn read_volatility(
+    ctx: &RunContext,
+    currency: &str,
+    source: Source,
+) -> Result<VolatilityReport, String> {
+    let now = ctx.clock().unix_secs();
+    match source {
+        Source::Dvol => {
+            let dvol = deribit::dvol(ctx, currency, now).await.map_err(|e| format!("{e:#}"))?;
+            Ok(VolatilityReport {
+                currency: currency.to_string(),
+                source,
+                volatility: volatility(dvol.percent)?,
+                timestamp: dvol.timestamp,
+                atm: None,
+            })
+        }
+        Source::Chain => {
+            let min_days = config::parse_or("iv_min_expiry_days", DEFAULT_MIN_EXPIRY_DAYS)
+                .map_err(|e| e.to_string())?;
+            let atm = deribit::atm(ctx, currency, now, min_days * 86_400)
+                .await
+                .map_err(|e| format!("{e:#}"))?;
+            chain_report(currency, &atm, now)
+        }
+    }
+}
+
+/// The `chain` source's report of `atm`, read at `now`
+fn chain_report(currency: &str, atm: &AtmVol, now: u64) -> Result<VolatilityReport, String> {
+    let price = |value: f64| {
+        fixed_point::from_f64(value, VOL_DECIMALS, Rounding::HalfUp)
+            .map_err(|e| format!("Price {}: {}", value, e))
+    };
+    Ok(VolatilityReport {
+        currency: currency.to_string(),
+        source: Source::Chain,
+        volatility: volatility(atm.percent)?,
+        timestamp: now,
+        atm: Some(AtmDetail {
+            expiry: atm.expiry,
+            strike: price(atm.strike)?,
+            underlying_price: price(atm.underlying_price)?,
+        }),
+    })
+}
+
+/// Annualized percent to a fixed-point fraction with `VOL_DECIMALS`
+fn volatility(percent: f64) -> Result<U256, String> {
+    // Two fewer decimals divides by 100 without float error
+    fixed_point::from_f64(percent, VOL_DECIMALS - 2, Rounding::HalfUp)
+        .map_err(|e| format!("Volatility {}: {}", percent, e))
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // `volatility` is annualized, fixed-point with `decimals`; `expiry`
+        // is the options' expiry for the `chain` source, 0 for `dvol`
+        struct ImpliedVolatility {
+            string currency;
+            string source;
+            uint256 volatility;
+            uint8 decimals;
+            uint64 timestamp;
+            uint64 expiry;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// `units` of 1e-4 at `VOL_DECIMALS`
+    fn bps(units: u64) -> U256 {
+        U256::from(units) * U256::from(100_000_000_000_000u64)
+    }
+
+    #[test]
+    fn currencies_parse() {
+        assert_eq!(parse_currency(" eth ").unwrap(), "ETH");
+        assert_eq!(
+            parse_currency("BTC-USD").unwrap_err(),
+            "Invalid currency \"BTC-USD\", expected e.g. BTC or ETH"
+        );
+        assert!(parse_currency("").is_err());
+    }
+
+    #[test]
+    fn sources_parse() {
+        assert_eq!("chain".parse::<Source>().unwrap(), Source::Chain);
+        assert!("realized".parse::<Source>().is_err());
+    }
+
+    #[test]
+    fn percent_becomes_a_fraction() {
+        assert_eq!(volatility(55.0).unwrap(), bps(5_500));
+        assert_eq!(volatility(48.37).unwrap(), bps(4_837));
+        assert_eq!(volatility(-1.0).unwrap_err(), "Volatility -1: value is negative");
+        assert_eq!(volatility(f64::NAN).unwrap_err(), "Volatility NaN: value is not finite");
+    }
+
+    #[test]
+    fn chain_reports_carry_the_options_read() {
+        let atm = AtmVol {
+            percent: 55.0,
+            expiry: 1_736_496_000,
+            strike: 100_000.0,
+            underlying_price: 101_000.5,
+        };
+        let report = chain_report("BTC", &atm, 1_735_689_600).unwrap();
+        assert_eq!((report.source, report.volatility), (Source::Chain, bps(5_500)));
+        assert_eq!(report.timestamp, 1_735_689_600);
+        let detail = report.atm.unwrap();
+        assert_eq!(detail.expiry, 1_736_496_000);
+        assert_eq!(detail.strike, U256::from(100_000u64) * U256::from(10u64).pow(U256::from(18)));
+        assert_eq!(detail.underlying_price, bps(1_010_005_000));
+    }
+}
@@ -0,0 +1,124 @@
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_primitives::{keccak256, B256};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    ipfs::{self, HashMismatch},
+    output::{self, Computed},
+    panic_guard,
+};
+use serde::{Deserialize, Serialize};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["verify"];
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let input = input.trim_end_matches('\0').trim().to_string();
+    println!("cid: {}", input);
+
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report =
+            block_on(async { ctx.run(verify_cid(&input)).await.map_err(|e| e.to_string())? })?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("ipfs:{}", report.cid);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::CidVerification {
+                    cid: report.cid.clone(),
+                    verified: report.verified,
+                    size: report.size,
+                    prefixHash: report.prefix_hash,
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct VerificationReport {
+    cid: String,
+    verified: bool,
+    gateway: Option<String>,
+    size: u64,
+    /// keccak256 of the first `prefix_bytes` bytes of the block, zero when not requested
+    prefix_hash: B256,
+}
+
+/// Fetches the raw block for `cid` and checks that its sha2-256 digest matches the CID
+async fn verify_cid(cid: &str) -> Result<VerificationReport, String> {
+    let prefix_bytes: usize = config::parse_or("prefix_bytes", 0).map_err(|e| e.to_string())?;
+
+    match ipfs::fetch_verified(cid, &ipfs::gateways_from_env()).await {
+        Ok(content) => {
+            let prefix_hash = if prefix_bytes > 0 {
+                keccak256(&content.data[..prefix_bytes.min(content.data.len())])
+            } else {
+                B256::ZERO
+            };
+            Ok(VerificationReport {
+                cid: cid.to_string(),
+                verified: true,
+                gateway: Some(content.gateway),
+                size: content.data.len() as u64,
+                prefix_hash,
+            })
+        }
+        // Gateways answered with the wrong bytes: publish a failed verification
+        Err(e) if e.is::<HashMismatch>() => Ok(VerificationReport {
+            cid: cid.to_string(),
+            verified: false,
+            gateway: None,
+            size: 0,
+            prefix_hash: B256::ZERO,
+        }),
+        Err(e) => Err(e.to_string()),
+    }
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        struct CidVerification {
+            string cid;
+            bool verified;
+            uint64 size;
+            bytes32 prefixHash;
+        }
+    }
+}
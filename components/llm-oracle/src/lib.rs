@@ -0,0 +1,281 @@
+mod template;
+mod trigger;
+use template::TemplateRequest;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+use wavs_wasi_chain::http::http_request_post_json;
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_primitives::{keccak256, B256};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    http::fetch_json,
+    json_schema,
+    output::{self, Computed},
+    panic_guard, proxy,
+    secret::Secret,
+};
+use serde::{Deserialize, Serialize};
+use wstd::{http::HeaderValue, runtime::block_on};
+
+/// Defaults for the `llm_api_url`, `llm_model` and `llm_max_tokens` kv config
+const DEFAULT_API_URL: &str = "https://api.openai.com/v1";
+const DEFAULT_MODEL: &str = "gpt-4o-mini";
+const DEFAULT_MAX_TOKENS: u32 = 256;
+
+/// Responses are truncated to this many bytes (on a char boundary) before hashing
+const MAX_RESPONSE_BYTES: usize = 1024;
+
+/// Fixed sampling seed so compatible providers return reproducible completions
+const SEED: u64 = 42;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["prompt"];
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let input = input.trim_end_matches('\0').trim();
+
+    let config = LlmConfig::from_env()?;
+    let prompt = build_prompt(&config, input)?;
+    println!("prompt: {}", prompt);
+
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let resp = block_on(async {
+            ctx.run(complete(&config, &prompt)).await.map_err(|e| e.to_string())?
+        })?;
+        println!("resp: {:?}", resp);
+
+        let feed_id = format!("llm:{}", resp.model);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::LlmResponse {
+                    responseHash: resp.response_hash,
+                    text: resp.text.clone(),
+                    model: resp.model.clone(),
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&resp).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+struct LlmConfig {
+    api_url: String,
+    api_key: Secret,
+    model: String,
+    max_tokens: u32,
+    /// Accept free-form prompts in addition to templates (`llm_allow_raw_prompt`)
+    allow_raw_prompt: bool,
+}
+
+impl LlmConfig {
+    fn from_env() -> Result<Self, String> {
+        let api_key = Secret::required("WAVS_ENV_OPENAI_API_KEY").map_err(|e| e.to_string())?;
+        let max_tokens =
+            config::parse_or("llm_max_tokens", DEFAULT_MAX_TOKENS).map_err(|e| e.to_string())?;
+        let allow_raw_prompt =
+            config::flag("llm_allow_raw_prompt", false).map_err(|e| e.to_string())?;
+        Ok(Self {
+            api_url: config::string_or("llm_api_url", DEFAULT_API_URL),
+            api_key,
+            model: config::string_or("llm_model", DEFAULT_MODEL),
+            max_tokens,
+            allow_raw_prompt,
+        })
+    }
+}
+
+/// Schema of [`TemplateRequest`], checked before it is deserialized
+const TEMPLATE_REQUEST_SCHEMA: &str = include_str!("../schemas/template_request.schema.json");
+
+/// Renders a template request, or passes a raw prompt through when allowed
+fn build_prompt(config: &LlmConfig, input: &str) -> Result<String, String> {
+    if input.starts_with('{') {
+        let req: TemplateRequest =
+            json_schema::from_slice(TEMPLATE_REQUEST_SCHEMA, input.as_bytes())
+                .map_err(|e| format!("Invalid template request: {}", e))?;
+        return req.render();
+    }
+    if !config.allow_raw_prompt {
+        return Err("Raw prompts are disabled, use a template request".to_string());
+    }
+    if input.is_empty() {
+        return Err("Empty prompt".to_string());
+    }
+    Ok(input.to_string())
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct LlmResult {
+    model: String,
+    text: String,
+    /// keccak256 of the post-processed `text`
+    response_hash: B256,
+}
+
+async fn complete(config: &LlmConfig, prompt: &str) -> Result<LlmResult, String> {
+    let body = ChatRequest {
+        model: config.model.clone(),
+        messages: vec![ChatMessage { role: "user".to_string(), content: prompt.to_string() }],
+        temperature: 0.0,
+        seed: SEED,
+        max_tokens: config.max_tokens,
+    };
+
+    let url = format!("{}/chat/completions", config.api_url.trim_end_matches('/'));
+    let mut req = http_request_post_json(&url, &body).map_err(|e| e.to_string())?;
+    req.headers_mut().insert(
+        "Authorization",
+        HeaderValue::from_str(&format!("Bearer {}", config.api_key.expose()))
+            .map_err(|e| e.to_string())?,
+    );
+    proxy::apply(&mut req).map_err(|e| e.to_string())?;
+
+    let resp: ChatResponse = fetch_json(req).await.map_err(|e| e.to_string())?;
+    let content = resp
+        .choices
+        .into_iter()
+        .next()
+        .map(|choice| choice.message.content)
+        .ok_or("Empty completion")?;
+
+    let text = canonicalize(&content);
+    Ok(LlmResult { model: config.model.clone(), response_hash: keccak256(&text), text })
+}
+
+/// Normalizes line endings and surrounding whitespace and truncates to
+/// `MAX_RESPONSE_BYTES`, so byte-identical completions hash identically
+fn canonicalize(text: &str) -> String {
+    let text = text.replace("\r\n", "\n");
+    let text = text.trim();
+    let mut end = text.len().min(MAX_RESPONSE_BYTES);
+    while !text.is_char_boundary(end) {
+        end -= 1;
+    }
+    text[..end].to_string()
+}
+
+#[derive(Debug, Serialize)]
+struct ChatRequest {
+    model: String,
+    messages: Vec<ChatMessage>,
+    temperature: f64,
+    seed: u64,
+    max_tokens: u32,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+struct ChatMessage {
+    role: String,
+    content: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct ChatResponse {
+    choices: Vec<ChatChoice>,
+}
+
+#[derive(Debug, Deserialize)]
+struct ChatChoice {
+    message: ChatMessage,
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        struct LlmResponse {
+            bytes32 responseHash;
+            string text;
+            string model;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn completions_are_canonicalized_before_hashing() {
+        assert_eq!(canonicalize("  BULLISH\r\n"), "BULLISH");
+        assert_eq!(canonicalize("a\r\nb"), canonicalize("a\nb"));
+
+        let long = "é".repeat(MAX_RESPONSE_BYTES);
+        let truncated = canonicalize(&long);
+        // Two-byte chars, so the limit falls on a char boundary
+        assert_eq!(truncated.len(), MAX_RESPONSE_BYTES);
+        let truncated = canonicalize(&format!("x{long}"));
+        assert_eq!(truncated.len(), MAX_RESPONSE_BYTES - 1);
+        assert!(truncated.starts_with("xé"));
+    }
+
+    #[test]
+    fn sampling_is_pinned_in_the_request() {
+        let body = ChatRequest {
+            model: DEFAULT_MODEL.to_string(),
+            messages: vec![ChatMessage { role: "user".to_string(), content: "hi".to_string() }],
+            temperature: 0.0,
+            seed: SEED,
+            max_tokens: DEFAULT_MAX_TOKENS,
+        };
+        assert_eq!(
+            serde_json::to_string(&body).unwrap(),
+            r#"{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}],"temperature":0.0,"seed":42,"max_tokens":256}"#
+        );
+    }
+
+    fn config(allow_raw_prompt: bool) -> LlmConfig {
+        LlmConfig {
+            api_url: DEFAULT_API_URL.to_string(),
+            api_key: Secret::new("sk-test"),
+            model: DEFAULT_MODEL.to_string(),
+            max_tokens: DEFAULT_MAX_TOKENS,
+            allow_raw_prompt,
+        }
+    }
+
+    #[test]
+    fn raw_prompts_need_opting_in() {
+        assert!(build_prompt(&config(false), "Is ETH bullish?").is_err());
+        assert_eq!(build_prompt(&config(true), "Is ETH bullish?").unwrap(), "Is ETH bullish?");
+        assert!(build_prompt(&config(true), "").is_err());
+    }
+
+    #[test]
+    fn template_requests_are_schema_checked() {
+        let req = r#"{"template":"sentiment","vars":{"subject":"ETH","window":"24 hours"}}"#;
+        assert!(build_prompt(&config(false), req).unwrap().contains("ETH over the last 24 hours"));
+        let req = r#"{"template":"sentiment","vars":{"subject":"ETH"},"raw":"hi"}"#;
+        assert!(build_prompt(&config(true), req).is_err());
+    }
+}
@@ -0,0 +1,252 @@
+mod pools;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, host::get_eth_chain_config, Guest, TriggerAction};
+use alloy_primitives::Address;
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    fan_out::FanOut,
+    output::{self, Computed},
+    panic_guard,
+    secret::Secret,
+};
+use pools::{Chain, Kind, Pool, Subgraph};
+use serde::{Deserialize, Serialize};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["apy"];
+
+/// Blocks between the two `v2` reads, overridable with `lp_lookback_blocks`;
+/// a week of twelve second blocks
+const DEFAULT_LOOKBACK_BLOCKS: u64 = 50_400;
+
+/// Complete days of `v3` fees averaged, overridable with `lp_window_days`
+const DEFAULT_WINDOW_DAYS: u64 = 7;
+
+/// APYs are published in parts per million, so 12.4% is 124000
+const APY_SCALE: f64 = 1_000_000.0;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let pools = select_pools(input.trim_end_matches('\0'))?;
+    println!("pools: {:?}", pools);
+
+    let chain_name = config::string_or("chain_name", "local");
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let pinned = ctx.pinned_height(&chain_name);
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(get_apys(&ctx, &chain_name, pinned, &pools))?;
+        println!("report: {:?}", report);
+
+        let names: Vec<&str> = report.pools.iter().map(|p| p.pool.as_str()).collect();
+        let feed_id = format!("lp-apy:{}", names.join(","));
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload: Vec<solidity::PoolApy> = report
+                    .pools
+                    .iter()
+                    .map(|p| solidity::PoolApy {
+                        pool: p.pool.clone(),
+                        poolAddress: p.address,
+                        apyPpm: p.apy_ppm,
+                        windowSecs: p.window_secs,
+                        blockNumber: report.block_number,
+                    })
+                    .collect();
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// The `lp_pools` named in the comma separated input, or all of them when it
+/// is empty
+fn select_pools(input: &str) -> Result<Vec<Pool>, String> {
+    let configured = config::list("lp_pools")
+        .unwrap_or_default()
+        .iter()
+        .map(|entry| Pool::parse(entry))
+        .collect::<anyhow::Result<Vec<_>>>()
+        .map_err(|e| e.to_string())?;
+    select(&configured, input)
+}
+
+fn select(configured: &[Pool], input: &str) -> Result<Vec<Pool>, String> {
+    let mut names: Vec<&str> =
+        input.split(|c: char| c == ',' || c.is_whitespace()).filter(|s| !s.is_empty()).collect();
+    if names.is_empty() {
+        names = configured.iter().map(|p| p.name.as_str()).collect();
+    }
+    names.sort();
+    names.dedup();
+    let selected = names
+        .into_iter()
+        .map(|name| {
+            configured
+                .iter()
+                .find(|p| p.name == name)
+                .cloned()
+                .ok_or_else(|| format!("Pool {} is not in lp_pools", name))
+        })
+        .collect::<Result<Vec<_>, String>>()?;
+    if selected.is_empty() {
+        return Err("No pools configured in lp_pools".to_string());
+    }
+    Ok(selected)
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct PoolApy {
+    pool: String,
+    kind: Kind,
+    address: Address,
+    /// Parts per million
+    apy_ppm: u64,
+    /// Seconds of history the APY was realized over
+    window_secs: u64,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct ApyReport {
+    chain_id: u64,
+    /// Block every chain read was pinned to
+    block_number: u64,
+    pools: Vec<PoolApy>,
+}
+
+async fn get_apys(
+    ctx: &RunContext,
+    chain_name: &str,
+    pinned: Option<u64>,
+    pools: &[Pool],
+) -> Result<ApyReport, String> {
+    let config =
+        get_eth_chain_config(chain_name).ok_or_else(|| format!("Unknown chain {}", chain_name))?;
+    let chain_id = config.chain_id.parse().map_err(|e| format!("Invalid chain id: {}", e))?;
+    let endpoint = config
+        .http_endpoint
+        .ok_or_else(|| format!("No http endpoint configured for chain {}", chain_name))?;
+    let lookback = config::parse_or("lp_lookback_blocks", DEFAULT_LOOKBACK_BLOCKS)
+        .map_err(|e| e.to_string())?;
+    let window_days =
+        config::parse_or("lp_window_days", DEFAULT_WINDOW_DAYS).map_err(|e| e.to_string())?;
+    if window_days == 0 {
+        return Err("lp_window_days must be positive".to_string());
+    }
+    let subgraph = config::string("lp_subgraph_url")
+        .map(|url| Subgraph { url, api_key: Secret::from_env(pools::SUBGRAPH_KEY_ENV) });
+
+    let chain = ctx
+        .run(Chain::at(endpoint, pinned))
+        .await
+        .map_err(|e| e.to_string())?
+        .map_err(|e| format!("{e:#}"))?;
+    let (chain, subgraph) = (&chain, subgraph.as_ref());
+    let measured = FanOut::from_env()
+        .map_err(|e| e.to_string())?
+        .try_join(
+            ctx,
+            pools.iter().map(|pool| async move {
+                let measured = pool.apy(chain, lookback, subgraph, window_days).await?;
+                anyhow::Ok(PoolApy {
+                    pool: pool.name.clone(),
+                    kind: pool.kind,
+                    address: pool.address,
+                    apy_ppm: (measured.apy * APY_SCALE).round() as u64,
+                    window_secs: measured.window_secs,
+                })
+            }),
+        )
+        .await
+        .map_err(|e| e.to_string())?;
+    Ok(ApyReport { chain_id, block_number: chain.height, pools: measured })
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // APY in parts per million, 124000 being 12.4%, realized over the
+        // `windowSecs` before block `blockNumber`
+        struct PoolApy {
+            string pool;
+            address poolAddress;
+            uint64 apyPpm;
+            uint64 windowSecs;
+            uint64 blockNumber;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn configured() -> Vec<Pool> {
+        [
+            "eth-usdc=v2@0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc",
+            "wbtc-eth=v3@0xcbcdf9626bc03e24f779434178a73a0b4bad62ed",
+            "dai-usdc=v3@0x5777d92f208679db4b9778590fa3cab3ac9e2168",
+        ]
+        .iter()
+        .map(|entry| Pool::parse(entry).unwrap())
+        .collect()
+    }
+
+    fn names(pools: &[Pool]) -> Vec<&str> {
+        pools.iter().map(|p| p.name.as_str()).collect()
+    }
+
+    #[test]
+    fn empty_input_selects_every_pool() {
+        let pools = configured();
+        assert_eq!(names(&select(&pools, "").unwrap()), ["dai-usdc", "eth-usdc", "wbtc-eth"]);
+    }
+
+    #[test]
+    fn named_pools_are_sorted_and_deduplicated() {
+        let pools = configured();
+        let selected = select(&pools, "wbtc-eth, eth-usdc wbtc-eth").unwrap();
+        assert_eq!(names(&selected), ["eth-usdc", "wbtc-eth"]);
+        assert_eq!(selected[1].kind, Kind::V3);
+    }
+
+    #[test]
+    fn unknown_pools_fail() {
+        assert_eq!(
+            select(&configured(), "eth-usdc,pepe-eth").unwrap_err(),
+            "Pool pepe-eth is not in lp_pools"
+        );
+        assert_eq!(select(&[], "").unwrap_err(), "No pools configured in lp_pools");
+    }
+}
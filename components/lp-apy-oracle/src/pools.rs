@@ -0,0 +1,342 @@
+//! Liquidity pools and how their realized APY is measured.
+//!
+//! - `v2` (Uniswap V2 and forks): swap fees stay in the reserves, so the
+//!   invariant per LP share, `sqrt(reserve0 * reserve1) / totalSupply`, grows
+//!   by exactly the fees earned. It is read with `eth_call` at the run's
+//!   block and `lp_lookback_blocks` before it, and the growth annualized with
+//!   compounding. Price moves (impermanent loss) do not enter it.
+//! - `v3` (Uniswap V3 and forks): fees are paid out instead of compounding
+//!   into the position, so the subgraph's daily `feesUSD` over `tvlUSD` is
+//!   taken across the last `lp_window_days` complete UTC days and compounded
+//!   daily. The pool's `fee()` is read with `eth_call` first, so an address
+//!   that is not a pool on the configured chain fails rather than trusting
+//!   the subgraph.
+
+use alloy_primitives::Address;
+use anyhow::{anyhow, Context, Result};
+use common::{evm, http, proxy, secret::Secret};
+use serde::{Deserialize, Serialize};
+use wstd::http::HeaderValue;
+
+/// 365.25 days
+const SECONDS_PER_YEAR: f64 = 31_557_600.0;
+
+/// Optional API key for subgraph gateways, sent as a bearer token
+pub const SUBGRAPH_KEY_ENV: &str = "WAVS_ENV_GRAPH_API_KEY";
+
+const POOL_DAY_DATAS: &str = r#"query($pool: String!, $before: Int!, $days: Int!) {
+  poolDayDatas(first: $days, orderBy: date, orderDirection: desc, where: { pool: $pool, date_lt: $before }) {
+    date
+    feesUSD
+    tvlUSD
+  }
+}"#;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Kind {
+    V2,
+    V3,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Pool {
+    pub name: String,
+    pub kind: Kind,
+    pub address: Address,
+}
+
+/// The chain the pools live on, at the block every read is pinned to
+pub struct Chain {
+    pub endpoint: String,
+    pub height: u64,
+    /// Unix seconds of `height`
+    pub timestamp: u64,
+}
+
+/// How the `v3` subgraph is reached
+pub struct Subgraph {
+    pub url: String,
+    pub api_key: Option<Secret>,
+}
+
+/// A realized APY and the span it was measured over
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct Measured {
+    /// Fraction, e.g. `0.124`
+    pub apy: f64,
+    pub window_secs: u64,
+}
+
+impl Pool {
+    /// Parses `name=kind@address`, e.g. `eth-usdc=v2@0xB4e16d0168e52d35CaCD2c6185b44281Ec28C9Dc`
+    pub fn parse(s: &str) -> Result<Self> {
+        let invalid = || anyhow!("invalid pool {s:?}, expected name=v2@address or name=v3@address");
+        let (name, rest) = s.trim().split_once('=').ok_or_else(invalid)?;
+        let (kind, address) = rest.split_once('@').ok_or_else(invalid)?;
+        let kind = match kind {
+            "v2" => Kind::V2,
+            "v3" => Kind::V3,
+            _ => return Err(invalid()),
+        };
+        if name.is_empty() {
+            return Err(invalid());
+        }
+        Ok(Self { name: name.to_string(), kind, address: address.parse().map_err(|_| invalid())? })
+    }
+
+    pub async fn apy(
+        &self,
+        chain: &Chain,
+        lookback_blocks: u64,
+        subgraph: Option<&Subgraph>,
+        window_days: u64,
+    ) -> Result<Measured> {
+        let measured = match self.kind {
+            Kind::V2 => self.v2_apy(chain, lookback_blocks).await,
+            Kind::V3 => {
+                let subgraph =
+                    subgraph.context("lp_subgraph_url must be set to measure v3 pools")?;
+                self.v3_apy(chain, subgraph, window_days).await
+            }
+        }
+        .with_context(|| format!("pool {}", self.name))?;
+        measured.checked(&self.name)
+    }
+
+    async fn v2_apy(&self, chain: &Chain, lookback_blocks: u64) -> Result<Measured> {
+        let provider = evm::provider(&chain.endpoint)?;
+        let before = chain
+            .height
+            .checked_sub(lookback_blocks)
+            .filter(|_| lookback_blocks > 0)
+            .with_context(|| format!("cannot look back {lookback_blocks} blocks"))?;
+        let then = evm::block_header(&provider, before).await?.timestamp.to::<u64>();
+        let elapsed = chain.timestamp.saturating_sub(then);
+        if elapsed == 0 {
+            return Err(anyhow!("blocks {before} and {} have the same timestamp", chain.height));
+        }
+
+        let mut values = [0.0; 2];
+        for (value, height) in values.iter_mut().zip([before, chain.height]) {
+            let reserves = evm::call(
+                &provider,
+                self.address,
+                &solidity::IUniswapV2Pair::getReservesCall {},
+                Some(height),
+            )
+            .await?;
+            let supply = evm::call(
+                &provider,
+                self.address,
+                &solidity::IUniswapV2Pair::totalSupplyCall {},
+                Some(height),
+            )
+            .await?
+            ._0;
+            let supply = u128::try_from(supply).context("totalSupply exceeds uint128")? as f64;
+            if supply == 0.0 {
+                return Err(anyhow!("no liquidity at block {height}"));
+            }
+            let (reserve0, reserve1) =
+                (reserves.reserve0.to::<u128>() as f64, reserves.reserve1.to::<u128>() as f64);
+            *value = (reserve0 * reserve1).sqrt() / supply;
+        }
+        Ok(Measured::compounded(values[1] / values[0], elapsed))
+    }
+
+    async fn v3_apy(
+        &self,
+        chain: &Chain,
+        subgraph: &Subgraph,
+        window_days: u64,
+    ) -> Result<Measured> {
+        let provider = evm::provider(&chain.endpoint)?;
+        evm::call(
+            &provider,
+            self.address,
+            &solidity::IUniswapV3Pool::feeCall {},
+            Some(chain.height),
+        )
+        .await
+        .context("not a v3 pool")?;
+
+        // Whole days before the pinned block, so every operator reads the same ones
+        let before = chain.timestamp - chain.timestamp % 86_400;
+        let variables = serde_json::json!({
+            "pool": self.address.to_string().to_lowercase(),
+            "before": before,
+            "days": window_days,
+        });
+        let mut req = http::graphql(&subgraph.url, POOL_DAY_DATAS, variables)?;
+        if let Some(key) = &subgraph.api_key {
+            let value = HeaderValue::from_str(&format!("Bearer {}", key.expose()))
+                .with_context(|| format!("invalid {SUBGRAPH_KEY_ENV}"))?;
+            req.headers_mut().insert("Authorization", value);
+        }
+        proxy::apply(&mut req)?;
+        let data: PoolDayDatas = http::send_graphql(req).await?;
+        data.measured(window_days, before)
+    }
+}
+
+impl Measured {
+    /// Annualizes `growth` realized over `elapsed` seconds
+    fn compounded(growth: f64, elapsed: u64) -> Self {
+        Self { apy: growth.powf(SECONDS_PER_YEAR / elapsed as f64) - 1.0, window_secs: elapsed }
+    }
+
+    /// `self` if the APY is a non-negative number
+    fn checked(self, pool: &str) -> Result<Self> {
+        if !self.apy.is_finite() || self.apy < 0.0 {
+            return Err(anyhow!("{} APY came out as {}", pool, self.apy));
+        }
+        Ok(self)
+    }
+}
+
+impl Chain {
+    /// `pinned` or, without one, the latest block of the chain at `endpoint`
+    pub async fn at(endpoint: String, pinned: Option<u64>) -> Result<Self> {
+        let provider = evm::provider(&endpoint)?;
+        let height = match pinned {
+            Some(height) => height,
+            None => evm::block_number(&provider).await?,
+        };
+        let timestamp = evm::block_header(&provider, height).await?.timestamp.to();
+        Ok(Self { endpoint, height, timestamp })
+    }
+}
+
+/// Subgraph decimals are JSON strings
+fn decimal(s: &str) -> Result<f64> {
+    s.parse().with_context(|| format!("invalid decimal {s:?}"))
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct PoolDayDatas {
+    pool_day_datas: Vec<PoolDayData>,
+}
+
+impl PoolDayDatas {
+    /// Fees over liquidity across the days, compounded daily
+    fn measured(&self, window_days: u64, before: u64) -> Result<Measured> {
+        let (mut fees, mut tvl) = (0.0, 0.0);
+        for day in &self.pool_day_datas {
+            fees += decimal(&day.fees_usd)?;
+            tvl += decimal(&day.tvl_usd)?;
+        }
+        if tvl <= 0.0 {
+            return Err(anyhow!("no liquidity in the {} days before {before}", window_days));
+        }
+        let days = self.pool_day_datas.len();
+        Ok(Measured {
+            apy: (1.0 + fees / tvl).powf(365.25) - 1.0,
+            window_secs: days as u64 * 86_400,
+        })
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct PoolDayData {
+    #[serde(rename = "feesUSD")]
+    fees_usd: String,
+    #[serde(rename = "tvlUSD")]
+    tvl_usd: String,
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        interface IUniswapV2Pair {
+            function getReserves() external view returns (uint112 reserve0, uint112 reserve1, uint32 blockTimestampLast);
+            function totalSupply() external view returns (uint256);
+        }
+
+        interface IUniswapV3Pool {
+            function fee() external view returns (uint24);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// 2025-01-01T00:00:00Z
+    const BEFORE: u64 = 1_735_689_600;
+
+    fn days(json: &str) -> PoolDayDatas {
+        serde_json::from_str(json).unwrap()
+    }
+
+    #[test]
+    fn pools_parse() {
+        let pool = Pool::parse(" eth-usdc=v2@0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc ").unwrap();
+        assert_eq!((pool.name.as_str(), pool.kind), ("eth-usdc", Kind::V2));
+        assert_eq!(
+            pool.address,
+            "0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc".parse::<Address>().unwrap()
+        );
+        for invalid in [
+            "eth-usdc",
+            "eth-usdc=v2",
+            "=v2@0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc",
+            "eth-usdc=v4@0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc",
+            "eth-usdc=v3@0xb4e16d",
+        ] {
+            assert!(Pool::parse(invalid).is_err(), "{invalid}");
+        }
+    }
+
+    #[test]
+    fn v2_growth_is_annualized_with_compounding() {
+        // 5% over half a year
+        let measured = Measured::compounded(1.05, 15_778_800);
+        assert!((measured.apy - 0.1025).abs() < 1e-12, "{}", measured.apy);
+        assert_eq!(measured.window_secs, 15_778_800);
+        assert_eq!(Measured::compounded(1.0, 604_800).apy, 0.0);
+    }
+
+    #[test]
+    fn v3_fees_are_compounded_daily() {
+        let data = days(
+            r#"{"poolDayDatas": [
+                {"date": 1735603200, "feesUSD": "100", "tvlUSD": "1000000"},
+                {"date": 1735516800, "feesUSD": "300.0", "tvlUSD": "1000000.0"}
+            ]}"#,
+        );
+        let measured = data.measured(7, BEFORE).unwrap();
+        // (1 + 400 / 2000000)^365.25 - 1
+        assert!((measured.apy - 0.075776467258086).abs() < 1e-12, "{}", measured.apy);
+        assert_eq!(measured.window_secs, 2 * 86_400);
+    }
+
+    #[test]
+    fn v3_needs_liquidity_and_decimals() {
+        assert_eq!(
+            days(r#"{"poolDayDatas": []}"#).measured(7, BEFORE).unwrap_err().to_string(),
+            "no liquidity in the 7 days before 1735689600"
+        );
+        let malformed =
+            days(r#"{"poolDayDatas": [{"date": 1735603200, "feesUSD": "n/a", "tvlUSD": "1"}]}"#);
+        assert_eq!(
+            malformed.measured(7, BEFORE).unwrap_err().to_string(),
+            "invalid decimal \"n/a\""
+        );
+    }
+
+    #[test]
+    fn negative_or_undefined_apys_fail() {
+        let measured = Measured { apy: 0.124, window_secs: 604_800 };
+        assert_eq!(measured.checked("eth-usdc").unwrap(), measured);
+        let shrunk = Measured { apy: -0.01, window_secs: 604_800 };
+        assert_eq!(
+            shrunk.checked("eth-usdc").unwrap_err().to_string(),
+            "eth-usdc APY came out as -0.01"
+        );
+        assert!(Measured { apy: f64::NAN, window_secs: 0 }.checked("eth-usdc").is_err());
+    }
+}
@@ -0,0 +1,259 @@
+mod relays;
+mod swaps;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, host::get_eth_chain_config, Guest, TriggerAction};
+use alloy_primitives::Address;
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    evm,
+    output::{self, Computed},
+    panic_guard,
+};
+use relays::BuilderStats;
+use serde::{Deserialize, Serialize};
+use swaps::{Indicators, Swap};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["mev"];
+
+/// Blocks of swaps analysed, overridable with `mev_lookback_blocks`; an hour
+/// of twelve second blocks
+const DEFAULT_LOOKBACK_BLOCKS: u64 = 300;
+
+/// MEV-Boost relays read for builder stats, overridable with `mev_relays`
+const DEFAULT_RELAYS: &str = "https://boost-relay.flashbots.net,https://relay.ultrasound.money";
+
+/// Weights of the sandwich rate, backrun rate and top builder share in the
+/// score; sandwiches cost the pool's traders directly, so they weigh most
+const SCORE_WEIGHTS: [f64; 3] = [0.6, 0.25, 0.15];
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let pool: Address = input
+        .trim_end_matches('\0')
+        .trim()
+        .parse()
+        .map_err(|e| format!("Invalid pool address: {}", e))?;
+    println!("pool: {}", pool);
+
+    let chain_name = config::string_or("chain_name", "local");
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let pinned = ctx.pinned_height(&chain_name);
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(monitor(&ctx, &chain_name, pinned, pool))?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("mev:{}:{}", report.chain_id, report.pool);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::MevRisk {
+                    pool: report.pool,
+                    fromBlock: report.from_block,
+                    toBlock: report.to_block,
+                    swaps: report.swaps,
+                    sandwiched: report.sandwiched,
+                    backrun: report.backrun,
+                    topBuilderShareBps: report.top_builder_share_bps,
+                    scoreBps: report.score_bps,
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct MevReport {
+    chain_id: u64,
+    pool: Address,
+    /// Blocks analysed, inclusive
+    from_block: u64,
+    to_block: u64,
+    swaps: u32,
+    /// Swaps with the same trader swapping before and back after them
+    sandwiched: u32,
+    /// Swaps immediately reversed by another trader's next transaction
+    backrun: u32,
+    /// Blocks in the window delivered by the configured relays
+    relayed_blocks: u32,
+    top_builder: Option<String>,
+    /// The top builder's share of the relayed blocks
+    top_builder_share_bps: u16,
+    /// 0 (no MEV seen) to 10000, weighted by `SCORE_WEIGHTS`
+    score_bps: u16,
+}
+
+/// Reads the pool's swaps and the relays' deliveries over the lookback
+/// window ending at the pinned (or latest) block and scores them
+async fn monitor(
+    ctx: &RunContext,
+    chain_name: &str,
+    pinned: Option<u64>,
+    pool: Address,
+) -> Result<MevReport, String> {
+    let chain =
+        get_eth_chain_config(chain_name).ok_or_else(|| format!("Unknown chain {}", chain_name))?;
+    let chain_id = chain.chain_id.parse().map_err(|e| format!("Invalid chain id: {}", e))?;
+    let endpoint = chain
+        .http_endpoint
+        .ok_or_else(|| format!("No http endpoint configured for chain {}", chain_name))?;
+    let lookback = config::parse_or("mev_lookback_blocks", DEFAULT_LOOKBACK_BLOCKS)
+        .map_err(|e| e.to_string())?;
+    if lookback == 0 {
+        return Err("mev_lookback_blocks must be positive".to_string());
+    }
+    let relays = config::list("mev_relays")
+        .unwrap_or_else(|| DEFAULT_RELAYS.split(',').map(String::from).collect());
+
+    let provider = evm::provider(&endpoint).map_err(|e| e.to_string())?;
+    let to_block = match pinned {
+        Some(height) => height,
+        None => ctx
+            .run(evm::block_number(&provider))
+            .await
+            .map_err(|e| e.to_string())?
+            .map_err(|e| e.to_string())?,
+    };
+    let from_block = to_block.saturating_sub(lookback - 1);
+
+    let logs = ctx
+        .run(evm::logs(&provider, pool, &[swaps::V2_SWAP, swaps::V3_SWAP], from_block, to_block))
+        .await
+        .map_err(|e| e.to_string())?
+        .map_err(|e| e.to_string())?;
+    let swaps = logs
+        .iter()
+        .map(Swap::from_log)
+        .collect::<anyhow::Result<Vec<_>>>()
+        .map_err(|e| e.to_string())?;
+    let indicators = swaps::indicators(&swaps);
+    let builders = relays::builder_stats(ctx, &relays, from_block, to_block)
+        .await
+        .map_err(|e| format!("{e:#}"))?;
+    Ok(score(chain_id, pool, (from_block, to_block), indicators, builders))
+}
+
+/// Scores the swaps and deliveries seen from `blocks.0` to `blocks.1`
+fn score(
+    chain_id: u64,
+    pool: Address,
+    (from_block, to_block): (u64, u64),
+    indicators: Indicators,
+    builders: BuilderStats,
+) -> MevReport {
+    let rate = |count: u32, total: u32| if total == 0 { 0.0 } else { count as f64 / total as f64 };
+    let rates = [
+        rate(indicators.sandwiched, indicators.swaps),
+        rate(indicators.backrun, indicators.swaps),
+        rate(builders.top_builder_blocks, builders.relayed_blocks),
+    ];
+    let score: f64 = rates.iter().zip(SCORE_WEIGHTS).map(|(rate, weight)| rate * weight).sum();
+    let bps = |fraction: f64| (fraction.clamp(0.0, 1.0) * 10_000.0).round() as u16;
+    MevReport {
+        chain_id,
+        pool,
+        from_block,
+        to_block,
+        swaps: indicators.swaps,
+        sandwiched: indicators.sandwiched,
+        backrun: indicators.backrun,
+        relayed_blocks: builders.relayed_blocks,
+        top_builder: builders.top_builder,
+        top_builder_share_bps: bps(rates[2]),
+        score_bps: bps(score),
+    }
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // Swap counts over blocks `fromBlock` to `toBlock` inclusive; shares
+        // and the score in basis points, 10000 being the highest risk
+        struct MevRisk {
+            address pool;
+            uint64 fromBlock;
+            uint64 toBlock;
+            uint32 swaps;
+            uint32 sandwiched;
+            uint32 backrun;
+            uint16 topBuilderShareBps;
+            uint16 scoreBps;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloy_primitives::address;
+
+    const POOL: Address = address!("B4e16d0168e52d35CaCD2c6185b44281Ec28C9Dc");
+
+    fn builders(relayed_blocks: u32, top_builder_blocks: u32) -> BuilderStats {
+        BuilderStats {
+            relayed_blocks,
+            top_builder_blocks,
+            top_builder: (top_builder_blocks > 0).then(|| "0xaa".to_string()),
+        }
+    }
+
+    #[test]
+    fn score_weighs_the_rates() {
+        let indicators = Indicators { swaps: 10, sandwiched: 2, backrun: 1 };
+        let report = score(1, POOL, (100, 399), indicators, builders(100, 40));
+        assert_eq!((report.from_block, report.to_block), (100, 399));
+        assert_eq!((report.swaps, report.sandwiched, report.backrun), (10, 2, 1));
+        assert_eq!(report.top_builder_share_bps, 4_000);
+        // 0.6 * 0.2 + 0.25 * 0.1 + 0.15 * 0.4
+        assert_eq!(report.score_bps, 2_050);
+    }
+
+    #[test]
+    fn quiet_pools_score_only_the_builders() {
+        let report = score(1, POOL, (100, 399), Indicators::default(), builders(50, 50));
+        assert_eq!((report.top_builder_share_bps, report.score_bps), (10_000, 1_500));
+        assert_eq!(report.top_builder.as_deref(), Some("0xaa"));
+
+        let report = score(1, POOL, (100, 399), Indicators::default(), builders(0, 0));
+        assert_eq!((report.top_builder_share_bps, report.score_bps), (0, 0));
+    }
+
+    #[test]
+    fn every_swap_sandwiched_is_the_highest_swap_risk() {
+        let indicators = Indicators { swaps: 4, sandwiched: 4, backrun: 4 };
+        let report = score(1, POOL, (100, 399), indicators, builders(1, 1));
+        assert_eq!(report.score_bps, 10_000);
+    }
+}
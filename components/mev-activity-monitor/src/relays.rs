@@ -0,0 +1,172 @@
+//! Block builder statistics from MEV-Boost relays' public data API.
+//!
+//! Relays list the payloads they delivered to proposers, newest first. The
+//! API is not pinned to a block, so only deliveries up to the run's block
+//! are counted and the results can still differ slightly between operators
+//! that read the relays at different times.
+
+use anyhow::{anyhow, Context, Result};
+use common::{context::RunContext, http::fetch_json, proxy};
+use serde::Deserialize;
+use std::collections::BTreeMap;
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+/// Deliveries read from each relay, the most the API returns per page
+const PAGE_SIZE: usize = 200;
+
+#[derive(Debug, Deserialize)]
+struct Delivered {
+    block_number: String,
+    builder_pubkey: String,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Default)]
+pub struct BuilderStats {
+    /// Blocks in the window that any relay delivered
+    pub relayed_blocks: u32,
+    /// Relayed blocks built by the most frequent builder
+    pub top_builder_blocks: u32,
+    pub top_builder: Option<String>,
+}
+
+/// Builders of the blocks from `from` to `to` inclusive that `relays`
+/// delivered; a block delivered by several relays counts once. Relays that
+/// fail are logged and left out, as long as one answers.
+pub async fn builder_stats(
+    ctx: &RunContext,
+    relays: &[String],
+    from: u64,
+    to: u64,
+) -> Result<BuilderStats> {
+    let mut builders: BTreeMap<u64, String> = BTreeMap::new();
+    let mut answered = 0;
+    for relay in relays {
+        let url = format!(
+            "{}/relay/v1/data/bidtraces/proposer_payload_delivered?limit={PAGE_SIZE}",
+            relay.trim_end_matches('/')
+        );
+        let delivered: Result<Vec<Delivered>> = ctx
+            .run(async {
+                let mut req = http_request_get(&url)?;
+                req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+                proxy::apply(&mut req)?;
+                fetch_json(req).await
+            })
+            .await?;
+        let delivered = match delivered {
+            Ok(delivered) => delivered,
+            Err(e) => {
+                println!("relay {relay} unavailable: {e:#}");
+                continue;
+            }
+        };
+        answered += 1;
+        record(&mut builders, delivered, from, to)?;
+    }
+
+    if answered == 0 && !relays.is_empty() {
+        return Err(anyhow!("no relay answered"));
+    }
+    Ok(stats(&builders))
+}
+
+/// Adds the builders of the `delivered` blocks from `from` to `to` that no
+/// earlier relay delivered
+fn record(
+    builders: &mut BTreeMap<u64, String>,
+    delivered: Vec<Delivered>,
+    from: u64,
+    to: u64,
+) -> Result<()> {
+    for payload in delivered {
+        let block: u64 = payload
+            .block_number
+            .parse()
+            .with_context(|| format!("invalid block number {}", payload.block_number))?;
+        if (from..=to).contains(&block) {
+            builders.entry(block).or_insert(payload.builder_pubkey);
+        }
+    }
+    Ok(())
+}
+
+fn stats(builders: &BTreeMap<u64, String>) -> BuilderStats {
+    let mut counts: BTreeMap<&str, u32> = BTreeMap::new();
+    for builder in builders.values() {
+        *counts.entry(builder).or_default() += 1;
+    }
+    // Ties go to the lowest pubkey, so operators agree
+    let top = counts.iter().max_by(|a, b| a.1.cmp(b.1).then(b.0.cmp(a.0)));
+    BuilderStats {
+        relayed_blocks: builders.len() as u32,
+        top_builder_blocks: top.map_or(0, |(_, &count)| count),
+        top_builder: top.map(|(builder, _)| builder.to_string()),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn delivered(json: &str) -> Vec<Delivered> {
+        serde_json::from_str(json).unwrap()
+    }
+
+    #[test]
+    fn blocks_count_once_within_the_window() {
+        let mut builders = BTreeMap::new();
+        let first = delivered(
+            r#"[
+                {"slot": "1", "block_number": "21000102", "builder_pubkey": "0xbb"},
+                {"slot": "2", "block_number": "21000101", "builder_pubkey": "0xaa"},
+                {"slot": "3", "block_number": "21000099", "builder_pubkey": "0xaa"}
+            ]"#,
+        );
+        record(&mut builders, first, 21_000_100, 21_000_102).unwrap();
+        // Another relay delivering the same block does not count it again
+        let second = delivered(
+            r#"[
+                {"block_number": "21000102", "builder_pubkey": "0xcc"},
+                {"block_number": "21000100", "builder_pubkey": "0xaa"}
+            ]"#,
+        );
+        record(&mut builders, second, 21_000_100, 21_000_102).unwrap();
+        assert_eq!(
+            stats(&builders),
+            BuilderStats {
+                relayed_blocks: 3,
+                top_builder_blocks: 2,
+                top_builder: Some("0xaa".into()),
+            }
+        );
+    }
+
+    #[test]
+    fn ties_go_to_the_lowest_pubkey() {
+        let mut builders = BTreeMap::new();
+        let payloads = delivered(
+            r#"[
+                {"block_number": "11", "builder_pubkey": "0xbb"},
+                {"block_number": "10", "builder_pubkey": "0xcc"}
+            ]"#,
+        );
+        record(&mut builders, payloads, 10, 11).unwrap();
+        let tied = stats(&builders);
+        assert_eq!((tied.top_builder.as_deref(), tied.top_builder_blocks), (Some("0xbb"), 1));
+    }
+
+    #[test]
+    fn no_deliveries_have_no_top_builder() {
+        assert_eq!(stats(&BTreeMap::new()), BuilderStats::default());
+    }
+
+    #[test]
+    fn malformed_block_numbers_fail() {
+        let payloads = delivered(r#"[{"block_number": "0x10", "builder_pubkey": "0xaa"}]"#);
+        assert_eq!(
+            record(&mut BTreeMap::new(), payloads, 0, 100).unwrap_err().to_string(),
+            "invalid block number 0x10"
+        );
+    }
+}
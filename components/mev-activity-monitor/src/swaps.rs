@@ -0,0 +1,205 @@
+//! Sandwich and backrun indicators from a pool's swap logs.
+//!
+//! Swaps are attributed to the `to` (V2) or `recipient` (V3) of the Swap
+//! event, which is the searcher's own contract for MEV bots and the user or
+//! router for everyone else. Within a block:
+//!
+//! - a swap is *sandwiched* when one trader swaps the same direction in an
+//!   earlier transaction and back the other way in a later one;
+//! - a swap is *backrun* when the very next transaction swaps the other way
+//!   from a different trader, outside any sandwich.
+//!
+//! Both are heuristics: they miss searchers that route through a fresh
+//! recipient and count coincidental trades, but their rates track MEV
+//! pressure on the pool well.
+
+use alloy_primitives::{b256, Address, B256, I256, U256};
+use anyhow::{anyhow, Result};
+use common::evm::Log;
+use std::collections::BTreeSet;
+
+/// `Swap(address,uint256,uint256,uint256,uint256,address)` of Uniswap V2 pairs
+pub const V2_SWAP: B256 = b256!("d78ad95fa46c994b6551d0da85fc275fe613ce37657fb8d5e3d130840159d822");
+
+/// `Swap(address,address,int256,int256,uint160,uint128,int24)` of Uniswap V3 pools
+pub const V3_SWAP: B256 = b256!("c42079f94a6350d7e6235f29174924f928cc2ac818eb64fed8004e115fbcca67");
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Swap {
+    pub block: u64,
+    pub tx_index: u64,
+    pub trader: Address,
+    /// Token0 in, token1 out
+    pub zero_for_one: bool,
+}
+
+impl Swap {
+    /// Decodes a V2 or V3 Swap log
+    pub fn from_log(log: &Log) -> Result<Self> {
+        let word = |i: usize| -> Result<[u8; 32]> {
+            log.data
+                .get(i * 32..(i + 1) * 32)
+                .and_then(|w| w.try_into().ok())
+                .ok_or_else(|| anyhow!("short Swap data in {}", log.transaction_hash))
+        };
+        let (topic0, trader) = match log.topics.as_slice() {
+            [topic0, _, trader, ..] => (*topic0, Address::from_word(*trader)),
+            _ => {
+                return Err(anyhow!("Swap log without indexed trader in {}", log.transaction_hash))
+            }
+        };
+        let zero_for_one = if topic0 == V2_SWAP {
+            // amount0In, amount1In, amount0Out, amount1Out
+            !U256::from_be_bytes(word(0)?).is_zero()
+        } else if topic0 == V3_SWAP {
+            // amount0, positive when it flows into the pool
+            I256::from_raw(U256::from_be_bytes(word(0)?)).is_positive()
+        } else {
+            return Err(anyhow!("not a Swap log: {topic0}"));
+        };
+        Ok(Self {
+            block: log.block_number.to(),
+            tx_index: log.transaction_index.to(),
+            trader,
+            zero_for_one,
+        })
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
+pub struct Indicators {
+    pub swaps: u32,
+    pub sandwiched: u32,
+    pub backrun: u32,
+}
+
+/// Counts sandwiched and backrun swaps among `swaps`, which must be in chain
+/// order
+pub fn indicators(swaps: &[Swap]) -> Indicators {
+    let mut result = Indicators { swaps: swaps.len() as u32, ..Default::default() };
+    for block in swaps.chunk_by(|a, b| a.block == b.block) {
+        // Indices of swaps that are a victim or a leg of a sandwich
+        let mut sandwich = BTreeSet::new();
+        for (i, front) in block.iter().enumerate() {
+            for (k, back) in block.iter().enumerate().skip(i + 1) {
+                if back.trader != front.trader
+                    || back.zero_for_one == front.zero_for_one
+                    || back.tx_index == front.tx_index
+                {
+                    continue;
+                }
+                let victims: Vec<usize> = (i + 1..k)
+                    .filter(|&j| {
+                        let victim = &block[j];
+                        victim.trader != front.trader
+                            && victim.zero_for_one == front.zero_for_one
+                            && victim.tx_index > front.tx_index
+                            && victim.tx_index < back.tx_index
+                    })
+                    .collect();
+                if !victims.is_empty() {
+                    result.sandwiched +=
+                        victims.iter().filter(|&&j| !sandwich.contains(&j)).count() as u32;
+                    sandwich.extend(victims);
+                    sandwich.extend([i, k]);
+                }
+            }
+        }
+        for (i, pair) in block.windows(2).enumerate() {
+            let (swap, next) = (&pair[0], &pair[1]);
+            if next.tx_index == swap.tx_index + 1
+                && next.trader != swap.trader
+                && next.zero_for_one != swap.zero_for_one
+                && !sandwich.contains(&i)
+                && !sandwich.contains(&(i + 1))
+            {
+                result.backrun += 1;
+            }
+        }
+    }
+    result
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloy_primitives::{Bytes, U64};
+
+    fn swap(block: u64, tx_index: u64, trader: u8, zero_for_one: bool) -> Swap {
+        Swap { block, tx_index, trader: Address::repeat_byte(trader), zero_for_one }
+    }
+
+    fn log(topic0: B256, words: &[U256]) -> Log {
+        Log {
+            block_number: U64::from(21_000_000),
+            transaction_index: U64::from(7),
+            log_index: U64::from(2),
+            transaction_hash: B256::repeat_byte(0xee),
+            topics: vec![topic0, B256::ZERO, Address::repeat_byte(0xbb).into_word()],
+            data: Bytes::from(
+                words.iter().flat_map(|w| w.to_be_bytes::<32>()).collect::<Vec<u8>>(),
+            ),
+        }
+    }
+
+    #[test]
+    fn v2_swaps_decode() {
+        let words = [U256::from(5), U256::ZERO, U256::ZERO, U256::from(9)];
+        assert_eq!(
+            Swap::from_log(&log(V2_SWAP, &words)).unwrap(),
+            Swap {
+                block: 21_000_000,
+                tx_index: 7,
+                trader: Address::repeat_byte(0xbb),
+                zero_for_one: true
+            }
+        );
+        let words = [U256::ZERO, U256::from(9), U256::from(5), U256::ZERO];
+        assert!(!Swap::from_log(&log(V2_SWAP, &words)).unwrap().zero_for_one);
+    }
+
+    #[test]
+    fn v3_swaps_decode() {
+        let amount = |a: i64| I256::unchecked_from(a).into_raw();
+        let words = [amount(-5), amount(9), U256::ZERO, U256::ZERO, U256::ZERO];
+        assert!(!Swap::from_log(&log(V3_SWAP, &words)).unwrap().zero_for_one);
+        let words = [amount(5), amount(-9), U256::ZERO, U256::ZERO, U256::ZERO];
+        assert!(Swap::from_log(&log(V3_SWAP, &words)).unwrap().zero_for_one);
+    }
+
+    #[test]
+    fn other_logs_fail() {
+        assert!(Swap::from_log(&log(B256::repeat_byte(1), &[U256::ZERO])).is_err());
+        assert!(Swap::from_log(&log(V2_SWAP, &[])).is_err());
+        let mut unindexed = log(V2_SWAP, &[U256::from(1)]);
+        unindexed.topics.truncate(2);
+        assert!(Swap::from_log(&unindexed).is_err());
+    }
+
+    #[test]
+    fn sandwiches_and_backruns_are_counted() {
+        let swaps = [
+            // Trader 1 sandwiches trader 2
+            swap(100, 1, 1, true),
+            swap(100, 2, 2, true),
+            swap(100, 3, 1, false),
+            // Trader 4 backruns trader 3
+            swap(100, 4, 3, false),
+            swap(100, 5, 4, true),
+            // Not in consecutive transactions
+            swap(101, 0, 5, true),
+            swap(101, 2, 6, false),
+        ];
+        assert_eq!(indicators(&swaps), Indicators { swaps: 7, sandwiched: 1, backrun: 1 });
+    }
+
+    #[test]
+    fn sandwiches_do_not_span_blocks_or_transactions() {
+        let swaps = [swap(100, 1, 1, true), swap(101, 0, 2, true), swap(101, 1, 1, false)];
+        assert_eq!(indicators(&swaps), Indicators { swaps: 3, sandwiched: 0, backrun: 1 });
+
+        // Both legs in one transaction are an arbitrage, not a sandwich
+        let swaps = [swap(100, 1, 1, true), swap(100, 1, 2, true), swap(100, 1, 1, false)];
+        assert_eq!(indicators(&swaps), Indicators { swaps: 3, ..Default::default() });
+    }
+}
@@ -0,0 +1,530 @@
+mod trigger;
+mod venues;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, host::get_eth_chain_config, Guest, TriggerAction};
+use alloy_primitives::{aliases::U80, Address, I256, U256};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json,
+    clock::FixedClock,
+    config,
+    context::RunContext,
+    cost,
+    cron::CronFire,
+    envelope::ComponentInfo,
+    evm,
+    fan_out::FanOut,
+    fixed_point::{self, Rounding},
+    output::{self, Computed},
+    panic_guard,
+    random::{self, SeededRng},
+};
+use serde::{Deserialize, Serialize};
+use std::rc::Rc;
+use venues::{Pair, Venue};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["validate"];
+
+/// Venues the reference price is read from, overridable with
+/// `validator_venues`; both quote USD pairs, as most feeds do
+const DEFAULT_VENUES: &str = "coinbase,kraken";
+
+/// Venues that must answer, overridable with `validator_min_venues`
+const DEFAULT_MIN_VENUES: usize = 2;
+
+/// Largest deviation from the reference the feed may show, overridable with
+/// `validator_max_deviation_bps`
+const DEFAULT_MAX_DEVIATION_BPS: u32 = 100;
+
+/// Oldest update the feed may show, overridable with `validator_max_age_secs`;
+/// the hour heartbeat of most Chainlink feeds. Scheduled checks default to
+/// the period since the schedule's previous fire instead.
+const DEFAULT_MAX_AGE_SECS: u64 = 3_600;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let request = decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+    let TriggerRequest { trigger_id, destination: dest, .. } = request;
+
+    // A cron payload carries no request: a scheduled check validates the
+    // `validator_feed` kv config, as of the time the schedule fired
+    let scheduled = CronFire::parse(&request.data).map_err(|e| e.to_string())?;
+    let input = match &scheduled {
+        Some(fire) => {
+            println!(
+                "scheduled check #{} of {} at {}",
+                fire.occurrence, fire.schedule, fire.fire_time
+            );
+            config::string("validator_feed")
+                .ok_or("validator_feed must be set for scheduled checks")?
+        }
+        None => std::str::from_utf8(&request.data).map_err(|e| e.to_string())?.to_string(),
+    };
+
+    let (feed, pair) = parse_feed(input.trim_end_matches('\0'))?;
+    println!("feed: {} ({})", feed, pair);
+
+    let mut config = ValidatorConfig::from_env(scheduled.as_ref()).map_err(|e| e.to_string())?;
+    let chain_name = config::string_or("chain_name", "local");
+    let mut ctx = RunContext::from_trigger(request.block.as_ref()).map_err(|e| e.to_string())?;
+    if let Some(fire) = &scheduled {
+        ctx = ctx.with_clock(Rc::new(FixedClock::from_unix_secs(fire.fire_time)));
+    }
+    let pinned = ctx.pinned_height(&chain_name);
+    // Sampled once: the seed is fixed by the trigger, not by the compute run
+    if let Some(k) = config.sample_venues {
+        config.venues = block_on(sample_venues(&ctx, &request, &config.venues, k))?;
+        println!("sampled venues: {:?}", config.venues);
+    }
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(validate(&ctx, &config, &chain_name, pinned, feed, &pair))?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("feed-check:{}:{}", report.chain_id, report.feed);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::FeedCheck {
+                    feed: report.feed,
+                    roundId: U80::from(report.round_id),
+                    answer: report.answer,
+                    decimals: report.decimals,
+                    updatedAt: report.updated_at,
+                    referencePrice: report.reference_price,
+                    deviationBps: report.deviation_bps,
+                    ageSecs: report.age_secs,
+                    deviates: report.deviates,
+                    stale: report.stale,
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// `feed:PAIR`, e.g. `0x5f4e...8419:ETH-USD`
+fn parse_feed(input: &str) -> Result<(Address, Pair), String> {
+    let (feed, pair) = input
+        .trim()
+        .split_once(':')
+        .ok_or("Expected feed:PAIR, e.g. 0x5f4eC3Df9cbd43714FE2740f5E3616155c5b8419:ETH-USD")?;
+    let feed: Address = feed.parse().map_err(|e| format!("Invalid feed address: {}", e))?;
+    let pair = Pair::parse(pair).map_err(|e| e.to_string())?;
+    Ok((feed, pair))
+}
+
+struct ValidatorConfig {
+    venues: Vec<Venue>,
+    min_venues: usize,
+    /// Venues each check reads, drawn from `venues` per trigger with
+    /// `validator_sample_venues`; all of them when unset
+    sample_venues: Option<usize>,
+    max_deviation_bps: u32,
+    max_age_secs: u64,
+}
+
+impl ValidatorConfig {
+    /// `scheduled` is the fire of a scheduled check, whose feed must have
+    /// updated within the schedule's period unless `validator_max_age_secs`
+    /// says otherwise
+    fn from_env(scheduled: Option<&CronFire>) -> anyhow::Result<Self> {
+        let mut venues = config::list("validator_venues")
+            .unwrap_or_else(|| DEFAULT_VENUES.split(',').map(String::from).collect())
+            .iter()
+            .map(|v| v.parse())
+            .collect::<anyhow::Result<Vec<Venue>>>()?;
+        venues.sort_by_key(|v| v.as_str());
+        venues.dedup();
+        let min_venues = config::parse_or("validator_min_venues", DEFAULT_MIN_VENUES)?;
+        let sample_venues = config::parse::<usize>("validator_sample_venues")?;
+        check_venue_counts(venues.len(), min_venues, sample_venues)?;
+        let default_max_age = match scheduled {
+            Some(fire) => {
+                let (previous, fire_time) = fire.window()?;
+                fire_time - previous
+            }
+            None => DEFAULT_MAX_AGE_SECS,
+        };
+        Ok(Self {
+            venues,
+            min_venues,
+            sample_venues,
+            max_deviation_bps: config::parse_or(
+                "validator_max_deviation_bps",
+                DEFAULT_MAX_DEVIATION_BPS,
+            )?,
+            max_age_secs: config::parse_or("validator_max_age_secs", default_max_age)?,
+        })
+    }
+}
+
+/// Whether `min_venues` and `sample_venues` fit the `venues` configured
+fn check_venue_counts(
+    venues: usize,
+    min_venues: usize,
+    sample_venues: Option<usize>,
+) -> anyhow::Result<()> {
+    if min_venues == 0 || min_venues > venues {
+        return Err(anyhow::anyhow!(
+            "validator_min_venues must be between 1 and the {venues} configured venues"
+        ));
+    }
+    if let Some(k) = sample_venues.filter(|&k| k < min_venues || k > venues) {
+        return Err(anyhow::anyhow!(
+            "validator_sample_venues {k} must be between validator_min_venues ({min_venues}) \
+             and the {venues} configured venues"
+        ));
+    }
+    Ok(())
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct FeedReport {
+    chain_id: u64,
+    feed: Address,
+    pair: String,
+    /// Block the feed was read at
+    block_number: u64,
+    round_id: u128,
+    /// The feed's answer, with `decimals` decimals
+    answer: I256,
+    decimals: u8,
+    /// Unix seconds of the feed's last update
+    updated_at: u64,
+    /// Median of the venues' mid prices, with the feed's decimals
+    reference_price: U256,
+    /// Venues that answered, in name order
+    venues: Vec<Venue>,
+    /// Distance of the answer from the reference, rounded up
+    deviation_bps: u32,
+    /// Seconds since the last update, at the run's clock or, for scheduled
+    /// checks, the fire time
+    age_secs: u64,
+    deviates: bool,
+    stale: bool,
+}
+
+/// Draws `k` of `venues` from the trigger's seed, so every operator reads the
+/// same ones while the load spreads across venues; kept in name order
+async fn sample_venues(
+    ctx: &RunContext,
+    request: &TriggerRequest,
+    venues: &[Venue],
+    k: usize,
+) -> Result<Vec<Venue>, String> {
+    let seed = ctx
+        .run(random::seed_for(request))
+        .await
+        .map_err(|e| e.to_string())?
+        .map_err(|e| format!("{e:#}"))?;
+    let mut indices = SeededRng::new(seed).sample_indices(venues.len(), k);
+    indices.sort_unstable();
+    Ok(indices.into_iter().map(|i| venues[i]).collect())
+}
+
+/// Reads the feed's latest round at the pinned (or latest) block and the
+/// venues' current prices, and compares the two.
+///
+/// The reference is read live and not pinned, so operators can see slightly
+/// different deviations; a feed close to `max_deviation_bps` may be flagged
+/// by some of them only.
+async fn validate(
+    ctx: &RunContext,
+    config: &ValidatorConfig,
+    chain_name: &str,
+    pinned: Option<u64>,
+    feed: Address,
+    pair: &Pair,
+) -> Result<FeedReport, String> {
+    let chain =
+        get_eth_chain_config(chain_name).ok_or_else(|| format!("Unknown chain {}", chain_name))?;
+    let chain_id = chain.chain_id.parse().map_err(|e| format!("Invalid chain id: {}", e))?;
+    let endpoint = chain
+        .http_endpoint
+        .ok_or_else(|| format!("No http endpoint configured for chain {}", chain_name))?;
+    let provider = evm::provider(&endpoint).map_err(|e| e.to_string())?;
+    let block_number = match pinned {
+        Some(height) => height,
+        None => ctx
+            .run(evm::block_number(&provider))
+            .await
+            .map_err(|e| e.to_string())?
+            .map_err(|e| e.to_string())?,
+    };
+    let decimals = ctx
+        .run(evm::call(
+            &provider,
+            feed,
+            &solidity::IAggregatorV3::decimalsCall {},
+            Some(block_number),
+        ))
+        .await
+        .map_err(|e| e.to_string())?
+        .map_err(|e| format!("{e:#}"))?
+        ._0;
+    let round = ctx
+        .run(evm::call(
+            &provider,
+            feed,
+            &solidity::IAggregatorV3::latestRoundDataCall {},
+            Some(block_number),
+        ))
+        .await
+        .map_err(|e| e.to_string())?
+        .map_err(|e| format!("{e:#}"))?;
+    let updated_at: u64 = round.updatedAt.try_into().map_err(|_| "updatedAt exceeds 64 bits")?;
+
+    let results = FanOut::from_env()
+        .map_err(|e| e.to_string())?
+        .try_join(
+            ctx,
+            config
+                .venues
+                .iter()
+                .map(|&venue| async move { anyhow::Ok((venue, venue.mid_price(ctx, pair).await)) }),
+        )
+        .await
+        .map_err(|e| e.to_string())?;
+    let (reference_price, venues) = reference(config, pair, results, decimals)?;
+    let deviation_bps = deviation_bps(round.answer, reference_price);
+    let age_secs = ctx.clock().unix_secs().saturating_sub(updated_at);
+    Ok(FeedReport {
+        chain_id,
+        feed,
+        pair: pair.to_string(),
+        block_number,
+        round_id: round.roundId.to(),
+        answer: round.answer,
+        decimals,
+        updated_at,
+        reference_price,
+        venues,
+        deviation_bps,
+        age_secs,
+        deviates: deviation_bps > config.max_deviation_bps,
+        stale: age_secs > config.max_age_secs,
+    })
+}
+
+/// Median of the venues in `results` that answered, with `decimals`, and
+/// those venues
+fn reference(
+    config: &ValidatorConfig,
+    pair: &Pair,
+    results: Vec<(Venue, anyhow::Result<f64>)>,
+    decimals: u8,
+) -> Result<(U256, Vec<Venue>), String> {
+    let mut prices = Vec::with_capacity(results.len());
+    let mut venues = Vec::with_capacity(results.len());
+    for (venue, price) in results {
+        match price {
+            Ok(price) => {
+                prices.push(price);
+                venues.push(venue);
+            }
+            Err(e) => println!("{venue} price for {pair} unavailable: {e:#}"),
+        }
+    }
+    if prices.len() < config.min_venues {
+        return Err(format!(
+            "{} of the {} venues needed returned a {} price",
+            prices.len(),
+            config.min_venues,
+            pair
+        ));
+    }
+    prices.sort_by(f64::total_cmp);
+    let mid = prices.len() / 2;
+    let median =
+        if prices.len() % 2 == 0 { (prices[mid - 1] + prices[mid]) / 2.0 } else { prices[mid] };
+    let reference_price = fixed_point::from_f64(median, decimals, Rounding::HalfUp)
+        .map_err(|e| format!("Reference price {}: {}", median, e))?;
+    Ok((reference_price, venues))
+}
+
+/// Distance of `answer` from `reference` in basis points, rounded up
+fn deviation_bps(answer: I256, reference: U256) -> u32 {
+    // A non-positive answer is as wrong as a feed can be
+    if answer.is_positive() && !reference.is_zero() {
+        let distance = answer.into_raw().abs_diff(reference) * U256::from(10_000u32);
+        u32::try_from(distance.div_ceil(reference)).unwrap_or(u32::MAX)
+    } else {
+        u32::MAX
+    }
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        interface IAggregatorV3 {
+            function decimals() external view returns (uint8);
+            function latestRoundData() external view returns (uint80 roundId, int256 answer, uint256 startedAt, uint256 updatedAt, uint80 answeredInRound);
+        }
+
+        // `answer` and `referencePrice` with `decimals` decimals; a feed
+        // agrees when neither `deviates` nor `stale` is set
+        struct FeedCheck {
+            address feed;
+            uint80 roundId;
+            int256 answer;
+            uint8 decimals;
+            uint64 updatedAt;
+            uint256 referencePrice;
+            uint32 deviationBps;
+            uint64 ageSecs;
+            bool deviates;
+            bool stale;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const FEED: &str = "0x5f4eC3Df9cbd43714FE2740f5E3616155c5b8419";
+
+    fn config(min_venues: usize) -> ValidatorConfig {
+        ValidatorConfig {
+            venues: vec![Venue::Binance, Venue::Coinbase, Venue::Kraken],
+            min_venues,
+            sample_venues: None,
+            max_deviation_bps: DEFAULT_MAX_DEVIATION_BPS,
+            max_age_secs: DEFAULT_MAX_AGE_SECS,
+        }
+    }
+
+    fn pair() -> Pair {
+        Pair::parse("ETH-USD").unwrap()
+    }
+
+    /// `units` at 8 decimals, as Chainlink USD feeds answer
+    fn e8(units: u64) -> U256 {
+        U256::from(units) * U256::from(100_000_000u64)
+    }
+
+    fn answer(units: i64) -> I256 {
+        I256::unchecked_from(units) * I256::unchecked_from(100_000_000i64)
+    }
+
+    #[test]
+    fn feeds_parse() {
+        let (feed, pair) = parse_feed(&format!(" {FEED}:eth/usd ")).unwrap();
+        assert_eq!(feed, FEED.parse::<Address>().unwrap());
+        assert_eq!(pair.to_string(), "ETH-USD");
+        assert!(parse_feed(FEED).unwrap_err().starts_with("Expected feed:PAIR"));
+        assert!(parse_feed("0x5f4e:ETH-USD").unwrap_err().starts_with("Invalid feed address"));
+        assert!(parse_feed(&format!("{FEED}:ETHUSD")).is_err());
+    }
+
+    #[test]
+    fn default_config() {
+        let config = ValidatorConfig::from_env(None).unwrap();
+        assert_eq!(config.venues, [Venue::Coinbase, Venue::Kraken]);
+        assert_eq!((config.min_venues, config.sample_venues), (2, None));
+        assert_eq!((config.max_deviation_bps, config.max_age_secs), (100, 3_600));
+    }
+
+    #[test]
+    fn scheduled_checks_allow_the_schedule_period() {
+        let fire = CronFire::parse(br#"{"schedule": "*/15 * * * *", "fire_time": 1735689600}"#)
+            .unwrap()
+            .unwrap();
+        assert_eq!(ValidatorConfig::from_env(Some(&fire)).unwrap().max_age_secs, 900);
+    }
+
+    #[test]
+    fn venue_counts_must_fit() {
+        assert!(check_venue_counts(3, 2, None).is_ok());
+        assert!(check_venue_counts(3, 2, Some(2)).is_ok());
+        assert_eq!(
+            check_venue_counts(2, 3, None).unwrap_err().to_string(),
+            "validator_min_venues must be between 1 and the 2 configured venues"
+        );
+        assert!(check_venue_counts(2, 0, None).is_err());
+        assert_eq!(
+            check_venue_counts(3, 2, Some(1)).unwrap_err().to_string(),
+            "validator_sample_venues 1 must be between validator_min_venues (2) and the 3 \
+             configured venues"
+        );
+        assert!(check_venue_counts(3, 2, Some(4)).is_err());
+    }
+
+    #[test]
+    fn reference_is_the_median_of_the_venues_that_answered() {
+        let results = vec![
+            (Venue::Binance, Ok(2_000.5)),
+            (Venue::Coinbase, Err(anyhow::anyhow!("timed out"))),
+            (Venue::Kraken, Ok(2_001.5)),
+        ];
+        let (price, venues) = reference(&config(2), &pair(), results, 8).unwrap();
+        assert_eq!(price, e8(2_001));
+        assert_eq!(venues, [Venue::Binance, Venue::Kraken]);
+
+        let results =
+            vec![(Venue::Binance, Ok(3.0)), (Venue::Coinbase, Ok(1.0)), (Venue::Kraken, Ok(2.0))];
+        assert_eq!(reference(&config(2), &pair(), results, 8).unwrap().0, e8(2));
+    }
+
+    #[test]
+    fn too_few_venues_fail() {
+        let results = vec![
+            (Venue::Binance, Ok(2_000.5)),
+            (Venue::Coinbase, Err(anyhow::anyhow!("timed out"))),
+            (Venue::Kraken, Err(anyhow::anyhow!("kraken: no ticker"))),
+        ];
+        assert_eq!(
+            reference(&config(2), &pair(), results, 8).unwrap_err(),
+            "1 of the 2 venues needed returned a ETH-USD price"
+        );
+    }
+
+    #[test]
+    fn references_that_round_to_zero_fail() {
+        let results = vec![(Venue::Binance, Ok(1e-9))];
+        assert_eq!(
+            reference(&config(1), &pair(), results, 8).unwrap_err(),
+            "Reference price 0.000000001: non-zero value rounds to zero"
+        );
+    }
+
+    #[test]
+    fn deviation_is_rounded_up() {
+        assert_eq!(deviation_bps(answer(2_001), e8(2_001)), 0);
+        // 10 / 2001 is 49.98 basis points
+        assert_eq!(deviation_bps(answer(2_011), e8(2_001)), 50);
+        assert_eq!(deviation_bps(answer(1_991), e8(2_001)), 50);
+        assert_eq!(deviation_bps(answer(2_001) + I256::ONE, e8(2_001)), 1);
+        assert_eq!(deviation_bps(answer(4_002), e8(2_001)), 10_000);
+    }
+
+    #[test]
+    fn non_positive_answers_deviate_the_most() {
+        assert_eq!(deviation_bps(I256::ZERO, e8(2_001)), u32::MAX);
+        assert_eq!(deviation_bps(answer(-2_001), e8(2_001)), u32::MAX);
+        assert_eq!(deviation_bps(answer(2_001), U256::ZERO), u32::MAX);
+    }
+}
@@ -0,0 +1,241 @@
+//! Spot venues the reference price is read from.
+//!
+//! Each venue quotes the mid of its best bid and ask, which unlike the last
+//! trade cannot be stale on a quiet pair. Base URLs are overridable with
+//! `<venue>_base_urls`, like any other [`Mirrors`] source.
+
+use anyhow::{anyhow, Context, Result};
+use common::{context::RunContext, http::fetch_json, mirrors::Mirrors, proxy};
+use serde::{de::DeserializeOwned, Deserialize, Serialize};
+use std::{collections::BTreeMap, fmt};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Venue {
+    Binance,
+    Coinbase,
+    Kraken,
+}
+
+impl std::str::FromStr for Venue {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self> {
+        match s.trim() {
+            "binance" => Ok(Self::Binance),
+            "coinbase" => Ok(Self::Coinbase),
+            "kraken" => Ok(Self::Kraken),
+            other => Err(anyhow!("unknown venue {other}, expected binance, coinbase or kraken")),
+        }
+    }
+}
+
+impl fmt::Display for Venue {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(self.as_str())
+    }
+}
+
+/// The pair a feed prices, e.g. `ETH-USD`
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Pair {
+    pub base: String,
+    pub quote: String,
+}
+
+impl Pair {
+    /// Parses `BASE-QUOTE` or `BASE/QUOTE`, case-insensitively
+    pub fn parse(s: &str) -> Result<Self> {
+        let invalid = || anyhow!("invalid pair {s:?}, expected BASE-QUOTE, e.g. ETH-USD");
+        let (base, quote) = s.trim().split_once(['-', '/']).ok_or_else(invalid)?;
+        let valid = |a: &str| {
+            !a.is_empty() && a.len() <= 10 && a.bytes().all(|b| b.is_ascii_alphanumeric())
+        };
+        if !valid(base) || !valid(quote) {
+            return Err(invalid());
+        }
+        Ok(Self { base: base.to_ascii_uppercase(), quote: quote.to_ascii_uppercase() })
+    }
+}
+
+impl fmt::Display for Pair {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}-{}", self.base, self.quote)
+    }
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct BinanceBookTicker {
+    bid_price: String,
+    ask_price: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct CoinbaseTicker {
+    bid: String,
+    ask: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct KrakenTicker {
+    error: Vec<String>,
+    #[serde(default)]
+    result: BTreeMap<String, KrakenPair>,
+}
+
+impl KrakenTicker {
+    /// The best bid and ask
+    fn into_quote(self) -> Result<(String, String)> {
+        if !self.error.is_empty() {
+            return Err(anyhow!("kraken: {}", self.error.join("; ")));
+        }
+        // Keyed by Kraken's own name for the pair, e.g. XETHZUSD
+        let pair = self.result.into_values().next().context("kraken: no ticker")?;
+        let best = |side: Vec<String>| side.into_iter().next().unwrap_or_default();
+        Ok((best(pair.b), best(pair.a)))
+    }
+}
+
+/// `[price, whole lot volume, lot volume]` of the best ask and bid
+#[derive(Debug, Deserialize)]
+struct KrakenPair {
+    a: Vec<String>,
+    b: Vec<String>,
+}
+
+impl Venue {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Binance => "binance",
+            Self::Coinbase => "coinbase",
+            Self::Kraken => "kraken",
+        }
+    }
+
+    fn default_base(self) -> &'static str {
+        match self {
+            Self::Binance => "https://api.binance.com",
+            Self::Coinbase => "https://api.exchange.coinbase.com",
+            Self::Kraken => "https://api.kraken.com",
+        }
+    }
+
+    /// The venue's current mid price for `pair`
+    pub async fn mid_price(self, ctx: &RunContext, pair: &Pair) -> Result<f64> {
+        let Pair { base, quote } = pair;
+        let (bid, ask) = match self {
+            Self::Binance => {
+                let path = format!("/api/v3/ticker/bookTicker?symbol={base}{quote}");
+                let ticker: BinanceBookTicker = self.get(ctx, &path).await?;
+                (ticker.bid_price, ticker.ask_price)
+            }
+            Self::Coinbase => {
+                let ticker: CoinbaseTicker =
+                    self.get(ctx, &format!("/products/{base}-{quote}/ticker")).await?;
+                (ticker.bid, ticker.ask)
+            }
+            Self::Kraken => {
+                // Kraken still names bitcoin XBT
+                let base = if base == "BTC" { "XBT" } else { base.as_str() };
+                self.get::<KrakenTicker>(ctx, &format!("/0/public/Ticker?pair={base}{quote}"))
+                    .await?
+                    .into_quote()?
+            }
+        };
+        mid(&bid, &ask)
+    }
+
+    async fn get<T: DeserializeOwned>(self, ctx: &RunContext, path: &str) -> Result<T> {
+        Mirrors::from_env(self.as_str(), self.default_base())?
+            .fetch(ctx, path, |url| async move {
+                let mut req = http_request_get(&url)?;
+                req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+                proxy::apply(&mut req)?;
+                fetch_json(req).await
+            })
+            .await
+    }
+}
+
+/// Mid of the quoted `bid` and `ask`, which must be positive and uncrossed
+fn mid(bid: &str, ask: &str) -> Result<f64> {
+    let parse = |s: &str| -> Result<f64> {
+        let price: f64 = s.parse().with_context(|| format!("invalid price {s:?}"))?;
+        if !price.is_finite() || price <= 0.0 {
+            return Err(anyhow!("invalid price {price}"));
+        }
+        Ok(price)
+    };
+    let (bid, ask) = (parse(bid)?, parse(ask)?);
+    if bid > ask {
+        return Err(anyhow!("crossed book, bid {bid} above ask {ask}"));
+    }
+    Ok((bid + ask) / 2.0)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn pairs_parse() {
+        let pair = Pair::parse(" eth/usd ").unwrap();
+        assert_eq!((pair.base.as_str(), pair.quote.as_str()), ("ETH", "USD"));
+        assert_eq!(pair.to_string(), "ETH-USD");
+        for invalid in ["ETHUSD", "ETH-", "-USD", "ETH-U.S", "ETH-USD-PERP"] {
+            assert!(Pair::parse(invalid).is_err(), "{invalid}");
+        }
+    }
+
+    #[test]
+    fn venues_parse() {
+        assert_eq!(" kraken".parse::<Venue>().unwrap(), Venue::Kraken);
+        assert_eq!(
+            "okx".parse::<Venue>().unwrap_err().to_string(),
+            "unknown venue okx, expected binance, coinbase or kraken"
+        );
+    }
+
+    #[test]
+    fn mid_is_between_bid_and_ask() {
+        assert_eq!(mid("2000.1", "2000.5").unwrap(), 2000.3);
+        assert_eq!(mid("2000", "2000").unwrap(), 2000.0);
+    }
+
+    #[test]
+    fn bad_quotes_fail() {
+        assert_eq!(
+            mid("2001", "2000").unwrap_err().to_string(),
+            "crossed book, bid 2001 above ask 2000"
+        );
+        assert_eq!(mid("0", "2000").unwrap_err().to_string(), "invalid price 0");
+        assert_eq!(mid("2000", "-1").unwrap_err().to_string(), "invalid price -1");
+        assert_eq!(mid("NaN", "2000").unwrap_err().to_string(), "invalid price NaN");
+        assert_eq!(mid("2000", "").unwrap_err().to_string(), "invalid price \"\"");
+    }
+
+    #[test]
+    fn kraken_quotes_the_best_levels() {
+        let ticker: KrakenTicker = serde_json::from_str(
+            r#"{"error": [], "result": {"XETHZUSD": {
+                "a": ["2000.50000", "12", "12.000"],
+                "b": ["2000.10000", "3", "3.000"],
+                "c": ["2000.30000", "0.5"]
+            }}}"#,
+        )
+        .unwrap();
+        assert_eq!(ticker.into_quote().unwrap(), ("2000.10000".into(), "2000.50000".into()));
+
+        let unknown: KrakenTicker =
+            serde_json::from_str(r#"{"error": ["EQuery:Unknown asset pair"]}"#).unwrap();
+        assert_eq!(
+            unknown.into_quote().unwrap_err().to_string(),
+            "kraken: EQuery:Unknown asset pair"
+        );
+        let empty: KrakenTicker = serde_json::from_str(r#"{"error": [], "result": {}}"#).unwrap();
+        assert_eq!(empty.into_quote().unwrap_err().to_string(), "kraken: no ticker");
+    }
+}
@@ -0,0 +1,145 @@
+//! Payout formula of a parametric policy.
+//!
+//! Index values (rainfall, temperature, delay minutes, ...) are fixed-point
+//! with three decimals, so the payout is computed in integers and every
+//! operator settles the same amount:
+//!
+//! ```text
+//! exceedance = max(0, observed - strike)   (or strike - observed for `below`)
+//! payout     = min(cap, exceedance * tick_value / 1000)
+//! ```
+
+use alloy_primitives::U256;
+use anyhow::{anyhow, Result};
+use serde::{Deserialize, Deserializer, Serialize};
+
+/// Fixed-point scale of index values: thousandths
+pub const INDEX_SCALE: i64 = 1_000;
+
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Direction {
+    /// Pays when the index rises above the strike, e.g. rainfall or delays
+    #[default]
+    Above,
+    /// Pays when the index falls below the strike, e.g. frost
+    Below,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Formula {
+    /// Index level where payouts start, in thousandths
+    #[serde(deserialize_with = "deserialize_index")]
+    pub strike: i64,
+    /// Payout per whole index unit beyond the strike, in token base units
+    pub tick_value: U256,
+    /// Maximum payout, in token base units
+    pub cap: U256,
+    #[serde(default)]
+    pub direction: Direction,
+}
+
+impl Formula {
+    /// Index units beyond the strike in the paying direction, in thousandths
+    pub fn exceedance(&self, observed: i64) -> u64 {
+        let beyond = match self.direction {
+            Direction::Above => observed.saturating_sub(self.strike),
+            Direction::Below => self.strike.saturating_sub(observed),
+        };
+        beyond.max(0) as u64
+    }
+
+    pub fn payout(&self, observed: i64) -> U256 {
+        let exceedance = U256::from(self.exceedance(observed));
+        let uncapped = exceedance.saturating_mul(self.tick_value) / U256::from(INDEX_SCALE);
+        uncapped.min(self.cap)
+    }
+}
+
+/// Converts a measured value to thousandths, rounding half away from zero
+pub fn index_from_f64(value: f64) -> Result<i64> {
+    let scaled = (value * INDEX_SCALE as f64).round();
+    if !scaled.is_finite() || scaled.abs() >= i64::MAX as f64 {
+        return Err(anyhow!("index value {value} is out of range"));
+    }
+    Ok(scaled as i64)
+}
+
+/// Parses a decimal with at most three fraction digits into thousandths
+pub fn parse_index(s: &str) -> Result<i64> {
+    let invalid =
+        || anyhow!("invalid index value {s:?}, expected a decimal with at most 3 decimals");
+    let (negative, digits) = match s.trim().strip_prefix('-') {
+        Some(rest) => (true, rest),
+        None => (false, s.trim()),
+    };
+    let (whole, fraction) = digits.split_once('.').unwrap_or((digits, ""));
+    if whole.is_empty() || fraction.len() > 3 || !fraction.bytes().all(|b| b.is_ascii_digit()) {
+        return Err(invalid());
+    }
+    let whole: i64 = whole.parse().map_err(|_| invalid())?;
+    let fraction: i64 = format!("{fraction:0<3}").parse().map_err(|_| invalid())?;
+    let value =
+        whole.checked_mul(INDEX_SCALE).and_then(|w| w.checked_add(fraction)).ok_or_else(invalid)?;
+    Ok(if negative { -value } else { value })
+}
+
+/// Accepts JSON numbers and decimal strings
+fn deserialize_index<'de, D: Deserializer<'de>>(deserializer: D) -> Result<i64, D::Error> {
+    let value = serde_json::Value::deserialize(deserializer)?;
+    let text = match &value {
+        serde_json::Value::String(s) => s.clone(),
+        serde_json::Value::Number(n) => n.to_string(),
+        _ => return Err(serde::de::Error::custom("strike must be a number or a decimal string")),
+    };
+    parse_index(&text).map_err(serde::de::Error::custom)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn formula(strike: i64, tick_value: u64, cap: u64, direction: Direction) -> Formula {
+        Formula { strike, tick_value: U256::from(tick_value), cap: U256::from(cap), direction }
+    }
+
+    #[test]
+    fn index_values_parse_to_thousandths() {
+        assert_eq!(parse_index("20").unwrap(), 20_000);
+        assert_eq!(parse_index(" 1.5 ").unwrap(), 1_500);
+        assert_eq!(parse_index("-2.125").unwrap(), -2_125);
+        assert_eq!(parse_index("0.05").unwrap(), 50);
+        for invalid in ["", ".5", "1.2345", "1e3", "1.-5", "abc", "99999999999999999"] {
+            assert!(parse_index(invalid).is_err(), "{invalid}");
+        }
+    }
+
+    #[test]
+    fn measurements_round_to_thousandths() {
+        assert_eq!(index_from_f64(12.3456).unwrap(), 12_346);
+        assert!(index_from_f64(f64::INFINITY).is_err());
+        assert!(index_from_f64(1e300).is_err());
+    }
+
+    #[test]
+    fn payout_scales_with_exceedance_up_to_the_cap() {
+        let above = formula(20_000, 1_000_000, 50_000_000, Direction::Above);
+        assert_eq!(above.exceedance(19_000), 0);
+        assert_eq!(above.exceedance(20_500), 500);
+        assert_eq!(above.payout(20_500), U256::from(500_000u64));
+        assert_eq!(above.payout(100_000), U256::from(50_000_000u64));
+
+        // Frost cover pays as the temperature falls below the strike
+        let below = formula(-2_000, 1_000, u64::MAX, Direction::Below);
+        assert_eq!(below.exceedance(0), 0);
+        assert_eq!(below.exceedance(-5_500), 3_500);
+        assert_eq!(below.payout(-5_500), U256::from(3_500u64));
+    }
+
+    #[test]
+    fn extreme_values_saturate() {
+        let above = formula(i64::MIN, u64::MAX, u64::MAX, Direction::Above);
+        assert_eq!(above.exceedance(i64::MAX), i64::MAX as u64);
+        assert_eq!(above.payout(i64::MAX), U256::from(u64::MAX));
+    }
+}
@@ -0,0 +1,229 @@
+mod formula;
+mod sources;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_primitives::{keccak256, B256, U256};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    json_schema,
+    output::{self, Computed},
+    panic_guard,
+};
+use formula::Formula;
+use serde::{Deserialize, Serialize};
+use sources::Source;
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["payout"];
+
+/// Schema of [`Policy`], checked before it is deserialized
+const POLICY_SCHEMA: &str = include_str!("../schemas/policy.schema.json");
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let policy: Policy =
+        json_schema::from_slice(POLICY_SCHEMA, input.trim_end_matches('\0').trim().as_bytes())
+            .map_err(|e| format!("Invalid policy: {}", e))?;
+    println!("policy: {:?}", policy);
+
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let settlement = block_on(settle(&ctx, &policy))?;
+        println!("settlement: {:?}", settlement);
+
+        let feed_id = format!("insurance:{}", settlement.policy_id);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::PayoutResult {
+                    policyId: settlement.policy_id.clone(),
+                    policyHash: settlement.policy_hash,
+                    observedMilli: settlement.observed,
+                    strikeMilli: settlement.strike,
+                    payout: settlement.payout,
+                    triggered: settlement.triggered,
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => {
+                canonical_json::to_vec(&settlement).map_err(|e| e.to_string())?
+            }
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// Trigger input: the policy terms, e.g.
+/// `{"policy_id": "crop-42", "source": {"kind": "weather", "date": "2025-07-01",
+/// "latitude": 52.52, "longitude": 13.41, "metric": "precipitation_sum"},
+/// "formula": {"strike": 20, "tick_value": "1000000", "cap": "50000000"}}`
+#[derive(Debug, Serialize, Deserialize)]
+pub struct Policy {
+    policy_id: String,
+    source: Source,
+    formula: Formula,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct Settlement {
+    policy_id: String,
+    /// keccak256 of the canonical JSON policy, binding the payout to its terms
+    policy_hash: B256,
+    index: String,
+    /// Observed index, in thousandths
+    observed: i64,
+    /// Strike, in thousandths
+    strike: i64,
+    /// Token base units to settle, capped
+    payout: U256,
+    triggered: bool,
+}
+
+async fn settle(ctx: &RunContext, policy: &Policy) -> Result<Settlement, String> {
+    let observed = ctx
+        .run(policy.source.observe(ctx))
+        .await
+        .map_err(|e| e.to_string())?
+        .map_err(|e| format!("{:#}", e))?;
+    settlement(policy, observed)
+}
+
+/// Settles `policy` against the `observed` index value
+fn settlement(policy: &Policy, observed: f64) -> Result<Settlement, String> {
+    let policy_hash = keccak256(canonical_json::to_vec(policy).map_err(|e| e.to_string())?);
+    let observed = formula::index_from_f64(observed).map_err(|e| e.to_string())?;
+
+    let payout = policy.formula.payout(observed);
+    Ok(Settlement {
+        index: policy.source.index_name().to_string(),
+        policy_id: policy.policy_id.clone(),
+        policy_hash,
+        observed,
+        strike: policy.formula.strike,
+        triggered: policy.formula.exceedance(observed) > 0,
+        payout,
+    })
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // Index values are fixed-point with three decimals
+        struct PayoutResult {
+            string policyId;
+            bytes32 policyHash;
+            int64 observedMilli;
+            int64 strikeMilli;
+            uint256 payout;
+            bool triggered;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const RAIN_POLICY: &str = r#"{"policy_id": "crop-42", "source": {"kind": "weather",
+        "date": "2025-07-01", "latitude": 52.52, "longitude": 13.41,
+        "metric": "precipitation_sum"},
+        "formula": {"strike": 20, "tick_value": "1000000", "cap": "50000000"}}"#;
+
+    fn policy(json: &str) -> Result<Policy, String> {
+        json_schema::from_slice(POLICY_SCHEMA, json.as_bytes()).map_err(|e| e.to_string())
+    }
+
+    #[test]
+    fn policies_parse_against_the_schema() {
+        let rain = policy(RAIN_POLICY).unwrap();
+        assert_eq!(rain.policy_id, "crop-42");
+        assert_eq!(rain.source.index_name(), "precipitation_sum");
+        assert_eq!(rain.formula.strike, 20_000);
+        assert_eq!(rain.formula.direction, formula::Direction::Above);
+
+        let flight = policy(
+            r#"{"policy_id": "delay-7", "source": {"kind": "flight", "date": "2025-07-01",
+                "flight": "LH400"},
+                "formula": {"strike": "30.5", "tick_value": "10", "cap": "1000",
+                "direction": "above"}}"#,
+        )
+        .unwrap();
+        assert_eq!(flight.source.index_name(), "arrival_delay_minutes");
+        assert_eq!(flight.formula.strike, 30_500);
+
+        assert!(policy(r#"{"policy_id": "crop-42"}"#).is_err());
+        // Unknown terms are refused rather than ignored
+        assert!(policy(&RAIN_POLICY.replace("\"cap\"", "\"limit\"")).is_err());
+        assert!(policy(&RAIN_POLICY.replace("precipitation_sum", "snow_depth")).is_err());
+    }
+
+    #[test]
+    fn payout_beyond_the_strike() {
+        let rain = policy(RAIN_POLICY).unwrap();
+        let wet = settlement(&rain, 32.25).unwrap();
+        assert_eq!((wet.observed, wet.strike), (32_250, 20_000));
+        assert!(wet.triggered);
+        assert_eq!(wet.payout, U256::from(12_250_000u64));
+        assert_eq!(wet.index, "precipitation_sum");
+
+        let dry = settlement(&rain, 20.0).unwrap();
+        assert!(!dry.triggered);
+        assert_eq!(dry.payout, U256::ZERO);
+
+        let flood = settlement(&rain, 500.0).unwrap();
+        assert_eq!(flood.payout, U256::from(50_000_000u64));
+    }
+
+    #[test]
+    fn hash_binds_the_terms_not_their_layout() {
+        let rain = policy(RAIN_POLICY).unwrap();
+        let hash = settlement(&rain, 0.0).unwrap().policy_hash;
+
+        let reordered = policy(
+            r#"{"formula": {"cap": "50000000", "tick_value": "1000000", "strike": "20.000"},
+                "source": {"metric": "precipitation_sum", "longitude": 13.41,
+                "latitude": 52.52, "date": "2025-07-01", "kind": "weather"},
+                "policy_id": "crop-42"}"#,
+        )
+        .unwrap();
+        assert_eq!(settlement(&reordered, 0.0).unwrap().policy_hash, hash);
+
+        let higher_cap = policy(&RAIN_POLICY.replace("50000000", "60000000")).unwrap();
+        assert_ne!(settlement(&higher_cap, 0.0).unwrap().policy_hash, hash);
+    }
+
+    #[test]
+    fn non_finite_observations_fail() {
+        let rain = policy(RAIN_POLICY).unwrap();
+        assert_eq!(settlement(&rain, f64::NAN).unwrap_err(), "index value NaN is out of range");
+    }
+}
@@ -0,0 +1,174 @@
+//! Index sources of a policy: daily weather observations and flight arrival
+//! delays.
+
+use anyhow::{anyhow, Context, Result};
+use common::{
+    config,
+    context::RunContext,
+    http::{self, fetch_json},
+    mirrors::Mirrors,
+    proxy,
+    secret::Secret,
+};
+use serde::{Deserialize, Serialize};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+/// Open-Meteo historical weather API, overridable with the
+/// `weather_base_urls` mirrors
+pub const DEFAULT_WEATHER_BASE: &str = "https://archive-api.open-meteo.com";
+
+/// Flight status lookup with `{flight}`, `{date}` and `{key}` replaced,
+/// overridable with `flight_api_url`
+pub const DEFAULT_FLIGHT_API_URL: &str =
+    "https://api.aviationstack.com/v1/flights?access_key={key}&flight_iata={flight}&flight_date={date}";
+
+/// Dot separated path of the arrival delay in minutes within the flight
+/// response, overridable with `flight_delay_field`
+pub const DEFAULT_FLIGHT_DELAY_FIELD: &str = "data.0.arrival.delay";
+
+/// API key substituted for `{key}` in the flight API URL
+pub const FLIGHT_API_KEY_ENV: &str = "WAVS_ENV_FLIGHT_API_KEY";
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum SourceKind {
+    Weather,
+    Flight,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum Metric {
+    /// Millimetres
+    PrecipitationSum,
+    /// Degrees Celsius
+    #[serde(rename = "temperature_2m_max")]
+    Temperature2mMax,
+    /// Degrees Celsius
+    #[serde(rename = "temperature_2m_min")]
+    Temperature2mMin,
+    /// Kilometres per hour
+    #[serde(rename = "wind_speed_10m_max")]
+    WindSpeed10mMax,
+}
+
+impl Metric {
+    /// Open-Meteo daily variable name
+    fn name(self) -> &'static str {
+        match self {
+            Self::PrecipitationSum => "precipitation_sum",
+            Self::Temperature2mMax => "temperature_2m_max",
+            Self::Temperature2mMin => "temperature_2m_min",
+            Self::WindSpeed10mMax => "wind_speed_10m_max",
+        }
+    }
+}
+
+/// Where the index of a policy is read
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct Source {
+    pub kind: SourceKind,
+    /// Observation day, `YYYY-MM-DD` in UTC
+    pub date: String,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub latitude: Option<f64>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub longitude: Option<f64>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub metric: Option<Metric>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub flight: Option<String>,
+}
+
+impl Source {
+    /// Human readable name of the observed index, e.g. `precipitation_sum`
+    pub fn index_name(&self) -> &'static str {
+        match (self.kind, self.metric) {
+            (SourceKind::Weather, Some(metric)) => metric.name(),
+            (SourceKind::Weather, None) => "weather",
+            (SourceKind::Flight, _) => "arrival_delay_minutes",
+        }
+    }
+
+    /// Reads the index value for the policy's day
+    pub async fn observe(&self, ctx: &RunContext) -> Result<f64> {
+        valid_date(&self.date)?;
+        match self.kind {
+            SourceKind::Weather => self.observe_weather(ctx).await,
+            SourceKind::Flight => self.observe_flight().await,
+        }
+    }
+
+    async fn observe_weather(&self, ctx: &RunContext) -> Result<f64> {
+        let (Some(latitude), Some(longitude), Some(metric)) =
+            (self.latitude, self.longitude, self.metric)
+        else {
+            return Err(anyhow!("weather sources need latitude, longitude and metric"));
+        };
+        let path = format!(
+            "/v1/archive?latitude={latitude}&longitude={longitude}&start_date={date}&end_date={date}&daily={}&timezone=UTC",
+            metric.name(),
+            date = self.date,
+        );
+        let mirrors = Mirrors::from_env("weather", DEFAULT_WEATHER_BASE)?;
+        let response: serde_json::Value = mirrors
+            .fetch(ctx, &path, |url| async move {
+                let mut req = http_request_get(&url)?;
+                req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+                proxy::apply(&mut req)?;
+                fetch_json(req).await
+            })
+            .await?;
+
+        // The archive lags a few days behind, unpublished days are null
+        response
+            .pointer(&format!("/daily/{}/0", metric.name()))
+            .and_then(serde_json::Value::as_f64)
+            .with_context(|| format!("no {} observation for {} yet", metric.name(), self.date))
+    }
+
+    async fn observe_flight(&self) -> Result<f64> {
+        let flight = self
+            .flight
+            .as_deref()
+            .filter(|f| f.chars().all(|c| c.is_ascii_alphanumeric()))
+            .context("flight sources need an IATA flight number")?;
+        let template = config::string_or("flight_api_url", DEFAULT_FLIGHT_API_URL);
+        let key = if template.contains("{key}") {
+            http::percent_encode(Secret::required(FLIGHT_API_KEY_ENV)?.expose())
+        } else {
+            String::new()
+        };
+        let url = template
+            .replace("{flight}", &flight.to_ascii_uppercase())
+            .replace("{date}", &self.date)
+            .replace("{key}", &key);
+
+        let mut req = http_request_get(&url)?;
+        req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+        proxy::apply(&mut req)?;
+        let response: serde_json::Value = fetch_json(req).await?;
+
+        let field = config::string_or("flight_delay_field", DEFAULT_FLIGHT_DELAY_FIELD);
+        let pointer: String = field.split('.').map(|part| format!("/{part}")).collect();
+        // A null delay means the flight has not landed or was not reported
+        response
+            .pointer(&pointer)
+            .and_then(serde_json::Value::as_f64)
+            .with_context(|| format!("no arrival delay for {flight} on {} yet", self.date))
+    }
+}
+
+fn valid_date(date: &str) -> Result<()> {
+    let bytes = date.as_bytes();
+    let shape = bytes.len() == 10
+        && bytes.iter().enumerate().all(|(i, b)| match i {
+            4 | 7 => *b == b'-',
+            _ => b.is_ascii_digit(),
+        });
+    if !shape {
+        return Err(anyhow!("invalid date {date:?}, expected YYYY-MM-DD"));
+    }
+    Ok(())
+}
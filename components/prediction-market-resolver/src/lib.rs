@@ -0,0 +1,311 @@
+mod rulebook;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_primitives::{keccak256, B256};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, clock, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    fan_out::FanOut,
+    http,
+    http_headers::HeaderRules,
+    json_schema,
+    output::{self, Computed},
+    panic_guard, proxy,
+};
+use rulebook::{Outcome, Rule, Rulebook, SourceRule};
+use serde::{Deserialize, Serialize};
+use serde_json::Value;
+use wavs_wasi_chain::http::http_request_get;
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["resolve"];
+
+/// Schema of the `rulebook` kv config
+const RULEBOOK_SCHEMA: &str = include_str!("../schemas/rulebook.schema.json");
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let market_id = input.trim_end_matches('\0').trim().to_string();
+    let rule = load_rule(&market_id)?;
+    println!("market: {} rule: {:?}", market_id, rule);
+
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let resolution = block_on(resolve(&ctx, market_id.clone(), rule.clone()))?;
+        println!("resolution: {:?}", resolution);
+
+        let feed_id = format!("market:{}", resolution.market_id);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::MarketResolution {
+                    marketId: resolution.market_id.clone(),
+                    outcome: resolution.outcome.code(),
+                    ruleHash: resolution.rule_hash,
+                    evidence: resolution.sources.iter().map(|s| s.evidence).collect(),
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => {
+                canonical_json::to_vec(&resolution).map_err(|e| e.to_string())?
+            }
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// Looks the market up in the `rulebook` kv config, a JSON object of rules
+/// keyed by market ID:
+///
+/// ```json
+/// {"btc-100k-2025": {"question": "Will BTC close 2025 above $100k?",
+///   "resolves_after": "2026-01-01T00:00:00Z",
+///   "sources": [{"url": "https://api.coingecko.com/api/v3/simple/price?ids=bitcoin&vs_currencies=usd",
+///                "pointer": "/bitcoin/usd"}],
+///   "condition": {"op": ">", "value": 100000}}}
+/// ```
+fn load_rule(market_id: &str) -> Result<Rule, String> {
+    if market_id.is_empty() {
+        return Err("Empty market ID".to_string());
+    }
+    let rulebook: String = config::required("rulebook").map_err(|e| e.to_string())?;
+    rule_for(&rulebook, market_id)
+}
+
+/// The rule of `market_id` in the JSON `rulebook`
+fn rule_for(rulebook: &str, market_id: &str) -> Result<Rule, String> {
+    let mut rulebook: Rulebook = json_schema::from_slice(RULEBOOK_SCHEMA, rulebook.as_bytes())
+        .map_err(|e| format!("Invalid rulebook: {}", e))?;
+    rulebook.remove(market_id).ok_or_else(|| format!("No rule for market {}", market_id))
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct SourceEvidence {
+    url: String,
+    pointer: String,
+    /// `null` when the response has no value at the pointer
+    value: Value,
+    /// `null` when the value can't be compared
+    vote: Option<bool>,
+    /// keccak256 of the canonical JSON `{url, pointer, value}`
+    evidence: B256,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct Resolution {
+    market_id: String,
+    question: String,
+    outcome: Outcome,
+    /// keccak256 of the canonical JSON rule, pinning the rulebook entry used
+    rule_hash: B256,
+    sources: Vec<SourceEvidence>,
+}
+
+async fn resolve(ctx: &RunContext, market_id: String, rule: Rule) -> Result<Resolution, String> {
+    check_resolvable(&market_id, &rule, ctx.clock().unix_secs())?;
+    let headers = HeaderRules::from_env(HeaderRules::new()).map_err(|e| e.to_string())?;
+    let sources = FanOut::from_env()
+        .map_err(|e| e.to_string())?
+        .try_join(ctx, rule.sources.iter().map(|source| observe(ctx, &headers, &rule, source)))
+        .await
+        .map_err(|e| e.to_string())?;
+    resolution(market_id, rule, sources)
+}
+
+/// Fails while `now` is before the rule's `resolves_after`
+fn check_resolvable(market_id: &str, rule: &Rule, now: u64) -> Result<(), String> {
+    if let Some(resolves_after) = &rule.resolves_after {
+        let not_before = clock::parse_utc(resolves_after).map_err(|e| e.to_string())?;
+        if now < not_before {
+            return Err(format!("Market {} can't resolve before {}", market_id, resolves_after));
+        }
+    }
+    Ok(())
+}
+
+/// Combines the votes of `sources` by the rule's quorum
+fn resolution(
+    market_id: String,
+    rule: Rule,
+    sources: Vec<SourceEvidence>,
+) -> Result<Resolution, String> {
+    let rule_hash = keccak256(canonical_json::to_vec(&rule).map_err(|e| e.to_string())?);
+    let votes: Vec<Option<bool>> = sources.iter().map(|s| s.vote).collect();
+    Ok(Resolution {
+        market_id,
+        outcome: rule.resolve(&votes),
+        question: rule.question,
+        rule_hash,
+        sources,
+    })
+}
+
+async fn observe(
+    ctx: &RunContext,
+    headers: &HeaderRules,
+    rule: &Rule,
+    source: &SourceRule,
+) -> anyhow::Result<SourceEvidence> {
+    let mut req = http_request_get(&source.url)?;
+    headers.apply(&mut req, ctx)?;
+    proxy::apply(&mut req)?;
+    let body = http::send(req).await?.into_ok_body()?;
+    let response: Value = serde_json::from_slice(&body)?;
+    evidence(rule, source, &response)
+}
+
+/// The vote of `source` on the value it points at in `response`
+fn evidence(rule: &Rule, source: &SourceRule, response: &Value) -> anyhow::Result<SourceEvidence> {
+    let value = response.pointer(&source.pointer).cloned().unwrap_or(Value::Null);
+    let vote = rule.condition.evaluate(&value);
+    // Hashing the extracted value rather than the raw body keeps the evidence
+    // identical across operators whose responses differ in unrelated fields
+    let evidence = keccak256(canonical_json::to_vec(&serde_json::json!({
+        "url": source.url,
+        "pointer": source.pointer,
+        "value": value,
+    }))?);
+    Ok(SourceEvidence {
+        url: source.url.clone(),
+        pointer: source.pointer.clone(),
+        value,
+        vote,
+        evidence,
+    })
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // outcome: 1 YES, 2 NO, 3 INVALID; evidence is one hash per source,
+        // in rulebook order
+        struct MarketResolution {
+            string marketId;
+            uint8 outcome;
+            bytes32 ruleHash;
+            bytes32[] evidence;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// 2026-01-01T00:00:00Z
+    const RESOLVES_AFTER: u64 = 1_767_225_600;
+
+    const RULEBOOK: &str = r#"{"btc-100k-2025": {"question": "Will BTC close 2025 above $100k?",
+        "resolves_after": "2026-01-01T00:00:00Z",
+        "sources": [{"url": "https://api.example.com/price", "pointer": "/bitcoin/usd"},
+                    {"url": "https://api.example.org/btc", "pointer": "/price"}],
+        "condition": {"op": ">", "value": 100000}, "quorum": "majority"}}"#;
+
+    fn rule() -> Rule {
+        rule_for(RULEBOOK, "btc-100k-2025").unwrap()
+    }
+
+    fn observed(rule: &Rule, source: usize, response: Value) -> SourceEvidence {
+        evidence(rule, &rule.sources[source], &response).unwrap()
+    }
+
+    #[test]
+    fn rules_are_looked_up_by_market() {
+        let rule = rule();
+        assert_eq!(rule.sources.len(), 2);
+        assert_eq!(
+            rule_for(RULEBOOK, "eth-10k-2025").unwrap_err(),
+            "No rule for market eth-10k-2025"
+        );
+
+        let no_sources = r#"{"m": {"question": "?", "sources": [],
+            "condition": {"op": "==", "value": true}}}"#;
+        assert!(rule_for(no_sources, "m").unwrap_err().starts_with("Invalid rulebook: "));
+        let unknown_op = RULEBOOK.replace(r#""op": ">""#, r#""op": "~""#);
+        assert!(rule_for(&unknown_op, "btc-100k-2025").is_err());
+    }
+
+    #[test]
+    fn markets_resolve_after_their_date() {
+        let rule = rule();
+        assert_eq!(
+            check_resolvable("btc-100k-2025", &rule, RESOLVES_AFTER - 1),
+            Err("Market btc-100k-2025 can't resolve before 2026-01-01T00:00:00Z".to_string())
+        );
+        assert_eq!(check_resolvable("btc-100k-2025", &rule, RESOLVES_AFTER), Ok(()));
+    }
+
+    #[test]
+    fn evidence_hashes_the_extracted_value() {
+        let rule = rule();
+        let yes = observed(&rule, 0, serde_json::json!({"bitcoin": {"usd": 101000}, "ts": 1}));
+        assert_eq!((yes.value.clone(), yes.vote), (serde_json::json!(101000), Some(true)));
+        assert_eq!(
+            yes.evidence,
+            "0x071b676daef01fb3578954b044a74e7306c764bddeb40d6aa93a26bbe47a8252"
+                .parse::<B256>()
+                .unwrap()
+        );
+        // Unrelated fields and number formatting leave the evidence unchanged
+        let other = observed(&rule, 0, serde_json::json!({"bitcoin": {"usd": 101000.0}}));
+        assert_eq!(other.evidence, yes.evidence);
+
+        let missing = observed(&rule, 0, serde_json::json!({"bitcoin": {}}));
+        assert_eq!((missing.value, missing.vote), (Value::Null, None));
+        assert_eq!(
+            missing.evidence,
+            "0x1ed5efdb5e282aa8ca79137a217819c8bb221355887675607f96489a1a556f63"
+                .parse::<B256>()
+                .unwrap()
+        );
+    }
+
+    #[test]
+    fn votes_combine_by_quorum() {
+        let rule = rule();
+        let sources = vec![
+            observed(&rule, 0, serde_json::json!({"bitcoin": {"usd": 101000}})),
+            observed(&rule, 1, serde_json::json!({"price": "n/a"})),
+        ];
+        // One valid vote of two is no majority
+        let invalid = resolution("btc-100k-2025".to_string(), rule.clone(), sources).unwrap();
+        assert_eq!(invalid.outcome, Outcome::Invalid);
+        assert_eq!(invalid.question, "Will BTC close 2025 above $100k?");
+        assert_eq!(invalid.rule_hash, keccak256(canonical_json::to_vec(&rule).unwrap()));
+
+        let sources = vec![
+            observed(&rule, 0, serde_json::json!({"bitcoin": {"usd": 95000}})),
+            observed(&rule, 1, serde_json::json!({"price": 99999.5})),
+        ];
+        let no = resolution("btc-100k-2025".to_string(), rule, sources).unwrap();
+        assert_eq!((no.outcome, no.outcome.code()), (Outcome::No, 2));
+    }
+}
@@ -0,0 +1,213 @@
+//! Resolution rules of prediction markets.
+//!
+//! A rule reads one value from each of its sources, tests it against the
+//! condition and combines the votes by quorum. A source whose value is
+//! missing or of the wrong type votes invalid; sources that can't be reached
+//! fail the run instead, so an outage is retried rather than resolved.
+
+use serde::{Deserialize, Serialize};
+use serde_json::Value;
+use std::collections::BTreeMap;
+
+/// Rules keyed by market ID
+pub type Rulebook = BTreeMap<String, Rule>;
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct Rule {
+    pub question: String,
+    /// UTC timestamp before which the market can't resolve
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub resolves_after: Option<String>,
+    pub sources: Vec<SourceRule>,
+    pub condition: Condition,
+    #[serde(default)]
+    pub quorum: Quorum,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct SourceRule {
+    pub url: String,
+    /// JSON pointer of the value in the response, e.g. `/bitcoin/usd`
+    pub pointer: String,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct Condition {
+    pub op: Op,
+    pub value: Value,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub enum Op {
+    #[serde(rename = ">")]
+    Gt,
+    #[serde(rename = ">=")]
+    Ge,
+    #[serde(rename = "<")]
+    Lt,
+    #[serde(rename = "<=")]
+    Le,
+    #[serde(rename = "==")]
+    Eq,
+    #[serde(rename = "!=")]
+    Ne,
+    /// Substring match of strings, ignoring ASCII case
+    #[serde(rename = "contains")]
+    Contains,
+}
+
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Quorum {
+    /// Every source must agree
+    #[default]
+    All,
+    /// More than half of the sources must agree
+    Majority,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "UPPERCASE")]
+pub enum Outcome {
+    Yes,
+    No,
+    Invalid,
+}
+
+impl Outcome {
+    /// On-chain code; 0 is left for unresolved markets
+    pub fn code(self) -> u8 {
+        match self {
+            Self::Yes => 1,
+            Self::No => 2,
+            Self::Invalid => 3,
+        }
+    }
+}
+
+impl Condition {
+    /// Whether `observed` meets the condition, `None` when it can't be
+    /// compared
+    pub fn evaluate(&self, observed: &Value) -> Option<bool> {
+        match (self.op, observed, &self.value) {
+            (Op::Eq, observed, expected) => same_value(observed, expected),
+            (Op::Ne, observed, expected) => same_value(observed, expected).map(|same| !same),
+            (Op::Contains, Value::String(observed), Value::String(expected)) => {
+                Some(observed.to_ascii_lowercase().contains(&expected.to_ascii_lowercase()))
+            }
+            (op, Value::Number(observed), Value::Number(expected)) => {
+                let (observed, expected) = (observed.as_f64()?, expected.as_f64()?);
+                Some(match op {
+                    Op::Gt => observed > expected,
+                    Op::Ge => observed >= expected,
+                    Op::Lt => observed < expected,
+                    Op::Le => observed <= expected,
+                    _ => return None,
+                })
+            }
+            _ => None,
+        }
+    }
+}
+
+/// Equality of JSON scalars of the same type, numbers compared by value
+fn same_value(a: &Value, b: &Value) -> Option<bool> {
+    match (a, b) {
+        (Value::Number(a), Value::Number(b)) => Some(a.as_f64()? == b.as_f64()?),
+        (Value::String(a), Value::String(b)) => Some(a == b),
+        (Value::Bool(a), Value::Bool(b)) => Some(a == b),
+        _ => None,
+    }
+}
+
+impl Rule {
+    /// Combines per-source votes, `None` being an invalid vote
+    pub fn resolve(&self, votes: &[Option<bool>]) -> Outcome {
+        let yes = votes.iter().filter(|vote| **vote == Some(true)).count();
+        let no = votes.iter().filter(|vote| **vote == Some(false)).count();
+        let needed = match self.quorum {
+            Quorum::All => votes.len(),
+            Quorum::Majority => votes.len() / 2 + 1,
+        };
+        if yes >= needed {
+            Outcome::Yes
+        } else if no >= needed {
+            Outcome::No
+        } else {
+            Outcome::Invalid
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    fn condition(op: Op, value: Value) -> Condition {
+        Condition { op, value }
+    }
+
+    fn rule(quorum: Quorum) -> Rule {
+        Rule {
+            question: "?".to_string(),
+            resolves_after: None,
+            sources: Vec::new(),
+            condition: condition(Op::Eq, json!(true)),
+            quorum,
+        }
+    }
+
+    #[test]
+    fn numbers_compare_by_value() {
+        assert_eq!(condition(Op::Gt, json!(100)).evaluate(&json!(100.5)), Some(true));
+        assert_eq!(condition(Op::Ge, json!(100)).evaluate(&json!(100.0)), Some(true));
+        assert_eq!(condition(Op::Lt, json!(100)).evaluate(&json!(100)), Some(false));
+        assert_eq!(condition(Op::Le, json!(-1)).evaluate(&json!(-2)), Some(true));
+        assert_eq!(condition(Op::Eq, json!(1)).evaluate(&json!(1.0)), Some(true));
+        assert_eq!(condition(Op::Ne, json!(1)).evaluate(&json!(2)), Some(true));
+        // Numeric strings are not numbers
+        assert_eq!(condition(Op::Gt, json!(100)).evaluate(&json!("101")), None);
+        assert_eq!(condition(Op::Gt, json!(100)).evaluate(&Value::Null), None);
+    }
+
+    #[test]
+    fn strings_and_booleans_compare_by_type() {
+        assert_eq!(condition(Op::Eq, json!("Yes")).evaluate(&json!("Yes")), Some(true));
+        assert_eq!(condition(Op::Eq, json!("Yes")).evaluate(&json!("yes")), Some(false));
+        assert_eq!(condition(Op::Ne, json!(true)).evaluate(&json!(false)), Some(true));
+        assert_eq!(condition(Op::Eq, json!(true)).evaluate(&json!("true")), None);
+        assert_eq!(condition(Op::Gt, json!("a")).evaluate(&json!("b")), None);
+
+        let contains = condition(Op::Contains, json!("WINS"));
+        assert_eq!(contains.evaluate(&json!("Home team wins 2-1")), Some(true));
+        assert_eq!(contains.evaluate(&json!("Draw")), Some(false));
+        assert_eq!(contains.evaluate(&json!(1)), None);
+    }
+
+    #[test]
+    fn all_sources_must_agree_by_default() {
+        let all = rule(Quorum::default());
+        assert_eq!(all.resolve(&[Some(true), Some(true)]), Outcome::Yes);
+        assert_eq!(all.resolve(&[Some(false), Some(false)]), Outcome::No);
+        assert_eq!(all.resolve(&[Some(true), Some(false)]), Outcome::Invalid);
+        assert_eq!(all.resolve(&[Some(true), None]), Outcome::Invalid);
+    }
+
+    #[test]
+    fn majority_needs_more_than_half() {
+        let majority = rule(Quorum::Majority);
+        assert_eq!(majority.resolve(&[Some(true), Some(true), None]), Outcome::Yes);
+        assert_eq!(majority.resolve(&[Some(false), Some(true), Some(false)]), Outcome::No);
+        assert_eq!(majority.resolve(&[Some(true), Some(false)]), Outcome::Invalid);
+        assert_eq!(majority.resolve(&[Some(true), None, None]), Outcome::Invalid);
+    }
+
+    #[test]
+    fn outcomes_have_codes() {
+        let codes: Vec<u8> =
+            [Outcome::Yes, Outcome::No, Outcome::Invalid].iter().map(|o| o.code()).collect();
+        assert_eq!(codes, [1, 2, 3]);
+        assert_eq!(serde_json::to_value(Outcome::Invalid).unwrap(), "INVALID");
+    }
+}
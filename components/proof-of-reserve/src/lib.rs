@@ -0,0 +1,252 @@
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+use wavs_wasi_chain::http::http_request_get;
+pub mod bindings;
+use crate::bindings::{export, host::get_eth_chain_config, Guest, TriggerAction};
+use alloy_primitives::{Address, U256};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    evm,
+    fixed_point::{self, Rounding},
+    http::fetch_bytes,
+    output::{self, Computed},
+    panic_guard, proxy,
+};
+use serde::{Deserialize, Serialize};
+use serde_json::value::RawValue;
+use std::collections::HashMap;
+use wstd::{http::HeaderValue, runtime::block_on};
+
+/// Reserve ratio is expressed in basis points, 10_000 = fully backed
+const BPS: u64 = 10_000;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["reserve"];
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let token: Address = input
+        .trim_end_matches('\0')
+        .trim()
+        .parse()
+        .map_err(|e| format!("Invalid token address: {}", e))?;
+    println!("token: {}", token);
+
+    let config = ReserveConfig::from_env()?;
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(async {
+            ctx.run(check_reserves(&ctx, token, &config)).await.map_err(|e| e.to_string())?
+        })?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("reserve:{}", report.token);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::ReserveAttestation {
+                    token: report.token,
+                    reserves: report.reserves,
+                    totalSupply: report.total_supply,
+                    ratioBps: report.ratio_bps,
+                    passed: report.passed,
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// Reserve check settings from the service `kv` config
+struct ReserveConfig {
+    /// Custodian attestation endpoint returning JSON
+    api_url: String,
+    /// Dotted path to the reserve amount in the response, e.g. `data.totalReserve`
+    reserve_field: String,
+    /// Chain from `wavs.toml` holding the token
+    chain_name: String,
+    /// Minimum reserves / supply ratio in basis points for the check to pass
+    min_ratio_bps: u64,
+}
+
+impl ReserveConfig {
+    fn from_env() -> Result<Self, String> {
+        let api_url = config::required("reserve_api_url").map_err(|e| e.to_string())?;
+        let min_ratio_bps =
+            config::parse_or("min_reserve_ratio_bps", BPS).map_err(|e| e.to_string())?;
+        Ok(Self {
+            api_url,
+            reserve_field: config::string_or("reserve_field", "totalReserve"),
+            chain_name: config::string_or("chain_name", "local"),
+            min_ratio_bps,
+        })
+    }
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct ReserveReport {
+    token: Address,
+    reserves: U256,
+    total_supply: U256,
+    ratio_bps: U256,
+    passed: bool,
+}
+
+async fn check_reserves(
+    ctx: &RunContext,
+    token: Address,
+    config: &ReserveConfig,
+) -> Result<ReserveReport, String> {
+    let endpoint = get_eth_chain_config(&config.chain_name)
+        .and_then(|c| c.http_endpoint)
+        .ok_or_else(|| format!("No http endpoint configured for chain {}", config.chain_name))?;
+    let provider = evm::provider(&endpoint).map_err(|e| e.to_string())?;
+    // The supply the reserves are compared with, as of the trigger
+    let block = ctx.pinned_height(&config.chain_name);
+
+    let total_supply = evm::call(&provider, token, &solidity::IERC20::totalSupplyCall {}, block)
+        .await
+        .map_err(|e| e.to_string())?
+        ._0;
+    let decimals = evm::call(&provider, token, &solidity::IERC20::decimalsCall {}, block)
+        .await
+        .map_err(|e| e.to_string())?
+        ._0;
+
+    // Base units are indivisible, so a finer attestation rounds down
+    let reserves = fixed_point::parse(&get_reserves(config).await?, decimals, Rounding::Down)
+        .map_err(|e| format!("Invalid reserve amount: {}", e))?;
+    let ratio_bps = ratio_bps(reserves, total_supply);
+    Ok(ReserveReport {
+        token,
+        reserves,
+        total_supply,
+        ratio_bps,
+        passed: !total_supply.is_zero() && ratio_bps >= U256::from(config.min_ratio_bps),
+    })
+}
+
+/// Reserves per unit of supply in basis points, rounded down; zero without
+/// supply
+fn ratio_bps(reserves: U256, total_supply: U256) -> U256 {
+    if total_supply.is_zero() {
+        U256::ZERO
+    } else {
+        reserves * U256::from(BPS) / total_supply
+    }
+}
+
+/// Reads the attested reserve amount (in whole tokens) from the custodian API,
+/// as a decimal string
+async fn get_reserves(config: &ReserveConfig) -> Result<String, String> {
+    let mut req = http_request_get(&config.api_url).map_err(|e| e.to_string())?;
+    req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+    proxy::apply(&mut req).map_err(|e| e.to_string())?;
+    let body = fetch_bytes(req).await.map_err(|e| e.to_string())?;
+    reserve_amount(&body, &config.reserve_field)
+}
+
+/// The amount at the dotted `field` path of the attestation. Custodians report
+/// either JSON numbers or decimal strings; numbers are taken as the text sent
+/// rather than through `f64`, which rounds amounts past 2^53 and prints large
+/// ones in exponent form.
+fn reserve_amount(body: &[u8], field: &str) -> Result<String, String> {
+    let missing = || format!("Field {} missing from attestation", field);
+    let mut value: &RawValue = serde_json::from_slice(body).map_err(|e| e.to_string())?;
+    for key in field.split('.') {
+        let object: HashMap<String, &RawValue> =
+            serde_json::from_str(value.get()).map_err(|_| missing())?;
+        value = object.get(key).copied().ok_or_else(missing)?;
+    }
+    let text = value.get();
+    if text.starts_with('"') {
+        serde_json::from_str(text).map_err(|e| e.to_string())
+    } else if text.starts_with(|c: char| c == '-' || c.is_ascii_digit()) {
+        Ok(text.to_string())
+    } else {
+        Err(format!("Field {} is not a number", field))
+    }
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        interface IERC20 {
+            function totalSupply() external view returns (uint256);
+            function decimals() external view returns (uint8);
+        }
+
+        struct ReserveAttestation {
+            address token;
+            uint256 reserves;
+            uint256 totalSupply;
+            uint256 ratioBps;
+            bool passed;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn amounts_keep_every_digit() {
+        let body =
+            br#"{"data":{"totalReserve":123456789012345678901.123456789,"asString":"42.5"}}"#;
+        assert_eq!(
+            reserve_amount(body, "data.totalReserve").unwrap(),
+            "123456789012345678901.123456789"
+        );
+        assert_eq!(reserve_amount(body, "data.asString").unwrap(), "42.5");
+
+        let reserves = fixed_point::parse("123456789012345678901.123456789", 6, Rounding::Down);
+        assert_eq!(reserves.unwrap().to_string(), "123456789012345678901123456");
+    }
+
+    #[test]
+    fn missing_and_non_numeric_fields_are_rejected() {
+        let body = br#"{"data":{"totalReserve":null,"nested":{"x":1}},"list":[1]}"#;
+        assert!(reserve_amount(body, "data.totalReserve").is_err());
+        assert!(reserve_amount(body, "data.nested").is_err());
+        assert!(reserve_amount(body, "data.missing").is_err());
+        assert!(reserve_amount(body, "list.0").is_err());
+        assert!(reserve_amount(b"not json", "totalReserve").is_err());
+    }
+
+    #[test]
+    fn ratio_rounds_down() {
+        let supply = U256::from(3_000_000u64);
+        assert_eq!(ratio_bps(U256::from(3_000_000u64), supply), U256::from(BPS));
+        assert_eq!(ratio_bps(U256::from(2_999_999u64), supply), U256::from(9_999u64));
+        assert_eq!(ratio_bps(U256::from(1u64), U256::ZERO), U256::ZERO);
+    }
+}
@@ -0,0 +1,203 @@
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+use wavs_wasi_chain::http::http_request_get;
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_primitives::U256;
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    fixed_point::{self, Rounding},
+    http::fetch_bytes,
+    mirrors::Mirrors,
+    output::{self, Computed},
+    panic_guard, proxy,
+};
+use serde::{Deserialize, Serialize};
+use wstd::{http::HeaderValue, runtime::block_on};
+
+/// Default DefiLlama API, overridable with the `defillama_api_url` kv config
+const DEFILLAMA_API_URL: &str = "https://api.llama.fi";
+
+/// Fixed-point decimals of the published USD value
+const TVL_DECIMALS: u8 = 8;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["tvl"];
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    println!("input: {}", input);
+
+    let target = TvlTarget::parse(input)?;
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let tvl = block_on(get_tvl(&ctx, target.clone()))?;
+        println!("tvl: {:?}", tvl);
+
+        let feed_id = format!("tvl:{}", tvl.target);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::ProtocolTvl {
+                    target: tvl.target.clone(),
+                    tvlUsd: tvl.tvl_usd,
+                    decimals: TVL_DECIMALS,
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&tvl).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// What to measure: a single protocol by its DefiLlama slug, or a whole chain
+#[derive(Debug, Clone, PartialEq)]
+pub enum TvlTarget {
+    Protocol(String),
+    Chain(String),
+}
+
+impl TvlTarget {
+    /// Parses `<protocol-slug>` or `chain:<chain name>`, ignoring bytes32 padding
+    pub fn parse(input: &str) -> Result<Self, String> {
+        let input = input.trim_end_matches('\0').trim();
+        if input.is_empty() {
+            return Err("Empty input".to_string());
+        }
+        match input.strip_prefix("chain:") {
+            Some(chain) => Ok(TvlTarget::Chain(chain.trim().to_string())),
+            None => Ok(TvlTarget::Protocol(input.to_string())),
+        }
+    }
+
+    fn name(&self) -> String {
+        match self {
+            TvlTarget::Protocol(slug) => slug.clone(),
+            TvlTarget::Chain(chain) => format!("chain:{chain}"),
+        }
+    }
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct TvlData {
+    target: String,
+    tvl: f64,
+    tvl_usd: U256,
+    decimals: u8,
+}
+
+async fn get_tvl(ctx: &RunContext, target: TvlTarget) -> Result<TvlData, String> {
+    let base_url = config::string_or("defillama_api_url", DEFILLAMA_API_URL);
+    let mirrors = Mirrors::from_env("defillama", &base_url).map_err(|e| e.to_string())?;
+
+    let path = match &target {
+        TvlTarget::Protocol(slug) => format!("/tvl/{slug}"),
+        TvlTarget::Chain(_) => "/v2/chains".to_string(),
+    };
+    let body = mirrors
+        .fetch(ctx, &path, |url| async move {
+            let mut req = http_request_get(&url)?;
+            req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+            proxy::apply(&mut req)?;
+            fetch_bytes(req).await
+        })
+        .await
+        .map_err(|e| e.to_string())?;
+
+    let tvl = parse_tvl(&target, &body)?;
+    Ok(TvlData {
+        target: target.name(),
+        tvl,
+        tvl_usd: fixed_point::from_f64(tvl, TVL_DECIMALS, Rounding::HalfUp)
+            .map_err(|e| format!("Invalid TVL value {}: {}", tvl, e))?,
+        decimals: TVL_DECIMALS,
+    })
+}
+
+/// Reads the TVL of `target` from its DefiLlama response: a bare number for
+/// a protocol, the list of every chain for a chain
+fn parse_tvl(target: &TvlTarget, body: &[u8]) -> Result<f64, String> {
+    match target {
+        TvlTarget::Protocol(_) => serde_json::from_slice::<f64>(body).map_err(|e| e.to_string()),
+        TvlTarget::Chain(chain) => {
+            let chains: Vec<ChainTvl> = serde_json::from_slice(body).map_err(|e| e.to_string())?;
+            chains
+                .into_iter()
+                .find(|c| c.name.eq_ignore_ascii_case(chain))
+                .map(|c| c.tvl)
+                .ok_or_else(|| format!("Unknown chain: {}", chain))
+        }
+    }
+}
+
+/// Entry of <https://api.llama.fi/v2/chains>
+#[derive(Default, Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct ChainTvl {
+    pub name: String,
+    pub tvl: f64,
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        struct ProtocolTvl {
+            string target;
+            uint256 tvlUsd;
+            uint8 decimals;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn targets_parse_from_padded_input() {
+        assert_eq!(TvlTarget::parse("aave\0\0\0"), Ok(TvlTarget::Protocol("aave".to_string())));
+        let chain = TvlTarget::parse("chain: Ethereum").unwrap();
+        assert_eq!(chain, TvlTarget::Chain("Ethereum".to_string()));
+        assert_eq!(chain.name(), "chain:Ethereum");
+        assert!(TvlTarget::parse("\0\0").is_err());
+    }
+
+    #[test]
+    fn tvl_is_read_from_the_response() {
+        let protocol = TvlTarget::Protocol("aave".to_string());
+        assert_eq!(parse_tvl(&protocol, b"21345678901.25"), Ok(21345678901.25));
+        assert!(parse_tvl(&protocol, b"{}").is_err());
+
+        let chains = br#"[{"name":"Ethereum","tvl":61000000000.5,"tokenSymbol":"ETH"},{"name":"Base","tvl":3100000000}]"#;
+        let base = TvlTarget::Chain("base".to_string());
+        assert_eq!(parse_tvl(&base, chains), Ok(3100000000.0));
+        let unknown = TvlTarget::Chain("Solana".to_string());
+        assert_eq!(parse_tvl(&unknown, chains), Err("Unknown chain: Solana".to_string()));
+    }
+}
@@ -0,0 +1,127 @@
+//! Block hashes seen on earlier runs, persisted per chain.
+//!
+//! Each chain's recent `height -> hash` map is a JSON file in the directory
+//! named by the `reorg_state_dir` kv config, written then renamed so a crash
+//! never leaves a truncated file. Unlike the caches this is real state:
+//! deleting it only loses the ability to notice reorgs of blocks seen before.
+
+use alloy_primitives::B256;
+use anyhow::{Context, Result};
+use std::{collections::BTreeMap, path::PathBuf};
+
+/// A chain's recently seen blocks
+#[derive(Debug, Default, Clone, PartialEq, Eq)]
+pub struct History {
+    pub hashes: BTreeMap<u64, B256>,
+}
+
+pub struct Store {
+    dir: PathBuf,
+}
+
+impl Store {
+    pub fn open(dir: impl Into<PathBuf>) -> Result<Self> {
+        let dir = dir.into();
+        std::fs::create_dir_all(&dir)
+            .with_context(|| format!("failed to create reorg state {}", dir.display()))?;
+        Ok(Self { dir })
+    }
+
+    /// The chain's history, empty on its first run
+    pub fn load(&self, chain: &str) -> Result<History> {
+        let path = self.path(chain);
+        match std::fs::read(&path) {
+            Ok(bytes) => Ok(History {
+                hashes: serde_json::from_slice(&bytes)
+                    .with_context(|| format!("corrupt reorg state {}", path.display()))?,
+            }),
+            Err(e) if e.kind() == std::io::ErrorKind::NotFound => Ok(History::default()),
+            Err(e) => Err(e).with_context(|| format!("failed to read {}", path.display())),
+        }
+    }
+
+    pub fn save(&self, chain: &str, history: &History) -> Result<()> {
+        let path = self.path(chain);
+        let tmp = path.with_extension("tmp");
+        std::fs::write(&tmp, serde_json::to_vec(&history.hashes)?)
+            .with_context(|| format!("failed to write {}", tmp.display()))?;
+        std::fs::rename(&tmp, &path).with_context(|| format!("failed to commit {}", path.display()))
+    }
+
+    fn path(&self, chain: &str) -> PathBuf {
+        self.dir.join(format!("{chain}.json"))
+    }
+}
+
+impl History {
+    /// Highest height seen
+    pub fn top(&self) -> Option<u64> {
+        self.hashes.keys().next_back().copied()
+    }
+
+    /// First height to remember up to `head`: past the highest seen, at most
+    /// `window` heights back, or just the head on the first run
+    pub fn unseen_from(&self, head: u64, window: u64) -> u64 {
+        match self.top() {
+            Some(top) if top < head => (top + 1).max(head.saturating_sub(window - 1)),
+            Some(_) => head + 1,
+            None => head,
+        }
+    }
+
+    /// Keeps the `window` highest heights
+    pub fn truncate(&mut self, window: u64) {
+        if let Some(top) = self.top() {
+            let oldest = top.saturating_sub(window.saturating_sub(1));
+            self.hashes = self.hashes.split_off(&oldest);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn history(heights: std::ops::RangeInclusive<u64>) -> History {
+        History { hashes: heights.map(|h| (h, B256::repeat_byte(h as u8))).collect() }
+    }
+
+    #[test]
+    fn unseen_heights_follow_the_top() {
+        assert_eq!(History::default().unseen_from(100, 128), 100);
+        assert_eq!(history(90..=95).unseen_from(100, 128), 96);
+        // A long gap only fills the window
+        assert_eq!(history(10..=20).unseen_from(100, 8), 93);
+        // Nothing new
+        assert_eq!(history(90..=100).unseen_from(100, 128), 101);
+        assert_eq!(history(90..=105).unseen_from(100, 128), 101);
+    }
+
+    #[test]
+    fn truncate_keeps_the_highest_heights() {
+        let mut seen = history(1..=10);
+        seen.truncate(3);
+        assert_eq!(seen, history(8..=10));
+        assert_eq!(seen.top(), Some(10));
+
+        let mut empty = History::default();
+        empty.truncate(3);
+        assert_eq!(empty.top(), None);
+    }
+
+    #[test]
+    fn histories_are_saved_per_chain() {
+        let dir = std::env::temp_dir().join(format!("reorg-history-{}", std::process::id()));
+        let store = Store::open(&dir).unwrap();
+        assert_eq!(store.load("mainnet").unwrap(), History::default());
+
+        store.save("mainnet", &history(1..=3)).unwrap();
+        assert_eq!(store.load("mainnet").unwrap(), history(1..=3));
+        assert_eq!(store.load("sepolia").unwrap(), History::default());
+
+        std::fs::write(dir.join("sepolia.json"), b"{\"1\":").unwrap();
+        assert!(store.load("sepolia").unwrap_err().to_string().starts_with("corrupt reorg state"));
+
+        std::fs::remove_dir_all(&dir).unwrap();
+    }
+}
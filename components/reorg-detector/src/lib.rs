@@ -0,0 +1,322 @@
+mod history;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, host::get_eth_chain_config, Guest, TriggerAction};
+use alloy_primitives::B256;
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    evm,
+    fan_out::FanOut,
+    output::{self, Computed},
+    panic_guard,
+};
+use history::{History, Store};
+use serde::{Deserialize, Serialize};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["check"];
+
+/// Recent heights remembered per chain, overridable with `reorg_window`; a
+/// reorg deeper than this is reported at the window's depth with
+/// `beyond_window` set
+const DEFAULT_WINDOW: u64 = 128;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let chains = parse_chains(input.trim_end_matches('\0'))?;
+    println!("chains: {:?}", chains);
+
+    let state_dir: String = config::required("reorg_state_dir").map_err(|e| e.to_string())?;
+    let store = Store::open(state_dir).map_err(|e| format!("{e:#}"))?;
+    let window = config::parse_or("reorg_window", DEFAULT_WINDOW).map_err(|e| e.to_string())?;
+    if window == 0 {
+        return Err("reorg_window must be positive".to_string());
+    }
+
+    // Loaded before and saved after the compute step, which the determinism
+    // check may run twice
+    let histories = chains
+        .iter()
+        .map(|chain| store.load(chain))
+        .collect::<anyhow::Result<Vec<_>>>()
+        .map_err(|e| format!("{e:#}"))?;
+    let mut updated = Vec::new();
+
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(async {
+            let mut statuses = Vec::with_capacity(chains.len());
+            updated.clear();
+            for (chain, history) in chains.iter().zip(&histories) {
+                let pinned = ctx.pinned_height(chain);
+                let (status, history) =
+                    check_chain(&ctx, chain, history.clone(), pinned, window).await?;
+                statuses.push(status);
+                updated.push(history);
+            }
+            Ok::<_, String>(ReorgReport { chains: statuses })
+        })?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("reorg:{}", chains.join(","));
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload: Vec<solidity::ReorgStatus> = report
+                    .chains
+                    .iter()
+                    .map(|status| solidity::ReorgStatus {
+                        chainId: status.chain_id,
+                        head: status.head,
+                        reorged: status.reorg.is_some(),
+                        forkHeight: status.reorg.as_ref().map_or(0, |r| r.fork_height),
+                        depth: status.reorg.as_ref().map_or(0, |r| r.depth),
+                        beyondWindow: status.reorg.as_ref().is_some_and(|r| r.beyond_window),
+                        oldHash: status.reorg.as_ref().map_or(B256::ZERO, |r| r.old_hash),
+                        newHash: status.reorg.as_ref().map_or(B256::ZERO, |r| r.new_hash),
+                    })
+                    .collect();
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    for (chain, history) in chains.iter().zip(&updated) {
+        store.save(chain, history).map_err(|e| format!("{e:#}"))?;
+    }
+    Ok(Some(output))
+}
+
+/// Reads the comma separated chain names of the input, or of the
+/// `reorg_chains` kv config when the input is empty, defaulting to
+/// `chain_name`
+fn parse_chains(input: &str) -> Result<Vec<String>, String> {
+    let mut chains: Vec<String> = if input.trim().is_empty() {
+        config::list("reorg_chains")
+            .unwrap_or_else(|| vec![config::string_or("chain_name", "local")])
+    } else {
+        input.split(',').map(|chain| chain.trim().to_string()).collect()
+    };
+    chains.retain(|chain| !chain.is_empty());
+    chains.sort();
+    chains.dedup();
+    if chains.is_empty() {
+        return Err("No chains to check, pass them as input or set reorg_chains".to_string());
+    }
+    // Chain names become state file names
+    if let Some(chain) = chains
+        .iter()
+        .find(|chain| !chain.chars().all(|c| c.is_ascii_alphanumeric() || matches!(c, '-' | '_')))
+    {
+        return Err(format!("Invalid chain name: {}", chain));
+    }
+    Ok(chains)
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct ReorgReport {
+    chains: Vec<ChainStatus>,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct ChainStatus {
+    chain: String,
+    chain_id: u64,
+    head: u64,
+    /// Set when a block seen on an earlier run has been replaced
+    reorg: Option<Reorg>,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct Reorg {
+    /// Lowest replaced height seen before
+    fork_height: u64,
+    /// Replaced heights from `fork_height` to the highest one rechecked
+    depth: u32,
+    /// No remembered height still matches, so the fork may be deeper
+    beyond_window: bool,
+    /// Hashes at `fork_height` before and after
+    old_hash: B256,
+    new_hash: B256,
+}
+
+/// Rechecks the chain's remembered hashes up to its head, walking down from
+/// the highest until one still matches, then remembers the blocks since,
+/// returning the history to save.
+///
+/// The history is this operator's own, so operators that started at
+/// different times or missed runs can report different depths, or one a
+/// reorg the other never saw.
+async fn check_chain(
+    ctx: &RunContext,
+    chain_name: &str,
+    mut history: History,
+    pinned: Option<u64>,
+    window: u64,
+) -> Result<(ChainStatus, History), String> {
+    let chain =
+        get_eth_chain_config(chain_name).ok_or_else(|| format!("Unknown chain {}", chain_name))?;
+    let chain_id = chain.chain_id.parse().map_err(|e| format!("Invalid chain id: {}", e))?;
+    let endpoint = chain
+        .http_endpoint
+        .ok_or_else(|| format!("No http endpoint configured for chain {}", chain_name))?;
+    let provider = evm::provider(&endpoint).map_err(|e| e.to_string())?;
+    let head = match pinned {
+        Some(height) => height,
+        None => ctx
+            .run(evm::block_number(&provider))
+            .await
+            .map_err(|e| e.to_string())?
+            .map_err(|e| e.to_string())?,
+    };
+    let provider = &provider;
+    let hash_at = move |height: u64| async move {
+        ctx.run(evm::block_header(provider, height))
+            .await
+            .map_err(|e| e.to_string())?
+            .map(|header| header.hash)
+            .map_err(|e| format!("{e:#}"))
+    };
+
+    let mut replaced = Vec::new();
+    for (&height, &old_hash) in history.hashes.range(..=head).rev() {
+        let new_hash = hash_at(height).await?;
+        if new_hash == old_hash {
+            break;
+        }
+        replaced.push((height, old_hash, new_hash));
+    }
+    let reorg = abandon(&mut history, &replaced);
+    if let Some(reorg) = &reorg {
+        println!("{chain_name}: reorg at {} depth {}", reorg.fork_height, reorg.depth);
+    }
+
+    let from = history.unseen_from(head, window);
+    let hashes = FanOut::from_env()
+        .map_err(|e| e.to_string())?
+        .try_join(
+            ctx,
+            (from..=head).map(move |height| async move {
+                Ok::<_, String>((height, hash_at(height).await?))
+            }),
+        )
+        .await
+        .map_err(|e| e.to_string())?;
+    history.hashes.extend(hashes);
+    history.truncate(window);
+
+    Ok((ChainStatus { chain: chain_name.to_string(), chain_id, head, reorg }, history))
+}
+
+/// The reorg of the `replaced` heights, highest first with their old and
+/// new hashes, dropping them and everything above from `history`
+fn abandon(history: &mut History, replaced: &[(u64, B256, B256)]) -> Option<Reorg> {
+    let (&(top, _, _), &(fork_height, old_hash, new_hash)) = (replaced.first()?, replaced.last()?);
+    let reorg = Reorg {
+        fork_height,
+        depth: (top - fork_height + 1) as u32,
+        beyond_window: history.hashes.keys().next().is_some_and(|&h| h == fork_height),
+        old_hash,
+        new_hash,
+    };
+    // Everything from the fork on belongs to the abandoned branch
+    history.hashes.retain(|&height, _| height < fork_height);
+    Some(reorg)
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // Hashes are zero and heights 0 when `reorged` is false
+        struct ReorgStatus {
+            uint64 chainId;
+            uint64 head;
+            bool reorged;
+            uint64 forkHeight;
+            uint32 depth;
+            bool beyondWindow;
+            bytes32 oldHash;
+            bytes32 newHash;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn hash(n: u8) -> B256 {
+        B256::repeat_byte(n)
+    }
+
+    fn history(heights: std::ops::RangeInclusive<u64>) -> History {
+        History { hashes: heights.map(|h| (h, hash(h as u8))).collect() }
+    }
+
+    #[test]
+    fn chains_parse() {
+        assert_eq!(parse_chains(" sepolia,mainnet ,sepolia,").unwrap(), ["mainnet", "sepolia"]);
+        assert_eq!(parse_chains("").unwrap(), ["local"]);
+        assert_eq!(parse_chains("../etc").unwrap_err(), "Invalid chain name: ../etc");
+        assert_eq!(
+            parse_chains(" , ").unwrap_err(),
+            "No chains to check, pass them as input or set reorg_chains"
+        );
+    }
+
+    #[test]
+    fn reorgs_run_from_the_highest_to_the_lowest_replaced_height() {
+        let mut seen = history(10..=20);
+        let replaced =
+            [(20, hash(20), hash(120)), (19, hash(19), hash(119)), (18, hash(18), hash(118))];
+        let reorg = abandon(&mut seen, &replaced).unwrap();
+        assert_eq!((reorg.fork_height, reorg.depth, reorg.beyond_window), (18, 3, false));
+        assert_eq!((reorg.old_hash, reorg.new_hash), (hash(18), hash(118)));
+        assert_eq!(seen.top(), Some(17));
+    }
+
+    #[test]
+    fn reorgs_down_to_the_oldest_height_may_be_deeper() {
+        let mut seen = history(10..=12);
+        let replaced =
+            [(12, hash(12), hash(112)), (11, hash(11), hash(111)), (10, hash(10), hash(110))];
+        let reorg = abandon(&mut seen, &replaced).unwrap();
+        assert_eq!((reorg.fork_height, reorg.depth, reorg.beyond_window), (10, 3, true));
+        assert_eq!(seen, History::default());
+    }
+
+    #[test]
+    fn nothing_replaced_is_no_reorg() {
+        let mut seen = history(10..=12);
+        assert!(abandon(&mut seen, &[]).is_none());
+        assert_eq!(seen, history(10..=12));
+    }
+}
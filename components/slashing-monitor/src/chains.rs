@@ -0,0 +1,342 @@
+//! Slashing and jailing state of validators, read from beacon nodes and
+//! Cosmos SDK LCDs.
+//!
+//! Neither API reports when a penalty happened, so the time is recovered
+//! from the state it left behind: a slashed beacon validator becomes
+//! withdrawable `EPOCHS_PER_SLASHINGS_VECTOR` epochs after the slashing, and
+//! a jailed Cosmos validator finishes unbonding one unbonding period after
+//! it was jailed. Both derivations give the same answer on every operator.
+
+use anyhow::{anyhow, Context, Result};
+use common::{
+    clock,
+    context::RunContext,
+    http::{self, fetch_json},
+    proxy,
+};
+use serde::{de::DeserializeOwned, Deserialize, Serialize};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+/// Spec `EPOCHS_PER_SLASHINGS_VECTOR`
+const EPOCHS_PER_SLASHINGS_VECTOR: u64 = 8192;
+
+/// 32 slots of 12 seconds
+const SECS_PER_EPOCH: u64 = 384;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Kind {
+    Beacon,
+    Cosmos,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Network {
+    pub name: String,
+    pub kind: Kind,
+    pub api_url: String,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Penalty {
+    /// Slashed on the beacon chain; the validator is forced out
+    Slashed,
+    /// Jailed on a Cosmos SDK chain, for downtime or double signing
+    Jailed,
+}
+
+impl Penalty {
+    pub fn code(self) -> u8 {
+        match self {
+            Self::Slashed => 1,
+            Self::Jailed => 2,
+        }
+    }
+}
+
+/// A penalty found on a watched validator
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct PenaltyEvent {
+    pub network: String,
+    pub validator: String,
+    pub penalty: Penalty,
+    /// Unix seconds the penalty was applied, to the epoch or second
+    pub at: u64,
+}
+
+impl Network {
+    /// Parses `name=kind@url`, e.g. `ethereum=beacon@http://localhost:5052`
+    pub fn parse(s: &str) -> Result<Self> {
+        let invalid =
+            || anyhow!("invalid network {s:?}, expected name=beacon@url or name=cosmos@url");
+        let (name, rest) = s.trim().split_once('=').ok_or_else(invalid)?;
+        let (kind, api_url) = rest.split_once('@').ok_or_else(invalid)?;
+        let kind = match kind {
+            "beacon" => Kind::Beacon,
+            "cosmos" => Kind::Cosmos,
+            _ => return Err(invalid()),
+        };
+        if name.is_empty() || !api_url.starts_with("http") {
+            return Err(invalid());
+        }
+        Ok(Self {
+            name: name.to_string(),
+            kind,
+            api_url: api_url.trim_end_matches('/').to_string(),
+        })
+    }
+
+    /// Penalties currently in effect on `validators`
+    pub async fn penalties(
+        &self,
+        ctx: &RunContext,
+        validators: &[String],
+    ) -> Result<Vec<PenaltyEvent>> {
+        match self.kind {
+            Kind::Beacon => self.beacon_penalties(ctx, validators).await,
+            Kind::Cosmos => self.cosmos_penalties(ctx, validators).await,
+        }
+    }
+
+    async fn beacon_penalties(
+        &self,
+        ctx: &RunContext,
+        validators: &[String],
+    ) -> Result<Vec<PenaltyEvent>> {
+        let genesis: BeaconData<Genesis> = self.get(ctx, "/eth/v1/beacon/genesis").await?;
+        let genesis_time: u64 =
+            genesis.data.genesis_time.parse().context("invalid genesis time")?;
+        let ids: Vec<String> = validators.iter().map(|v| http::percent_encode(v)).collect();
+        let states: BeaconData<Vec<ValidatorState>> = self
+            .get(ctx, &format!("/eth/v1/beacon/states/head/validators?id={}", ids.join(",")))
+            .await?;
+        self.slashed(genesis_time, validators, states.data)
+    }
+
+    /// The slashed of `states`, dated from their withdrawable epoch
+    fn slashed(
+        &self,
+        genesis_time: u64,
+        validators: &[String],
+        states: Vec<ValidatorState>,
+    ) -> Result<Vec<PenaltyEvent>> {
+        let mut events = Vec::new();
+        for state in states.into_iter().filter(|s| s.validator.slashed) {
+            let withdrawable: u64 =
+                state.validator.withdrawable_epoch.parse().context("invalid withdrawable epoch")?;
+            let epoch = withdrawable.saturating_sub(EPOCHS_PER_SLASHINGS_VECTOR);
+            // Report the ID the way it was watched, index or pubkey
+            let validator = validators
+                .iter()
+                .find(|v| v.eq_ignore_ascii_case(&state.validator.pubkey))
+                .cloned()
+                .unwrap_or(state.index);
+            events.push(PenaltyEvent {
+                network: self.name.clone(),
+                validator,
+                penalty: Penalty::Slashed,
+                at: genesis_time + epoch * SECS_PER_EPOCH,
+            });
+        }
+        Ok(events)
+    }
+
+    async fn cosmos_penalties(
+        &self,
+        ctx: &RunContext,
+        validators: &[String],
+    ) -> Result<Vec<PenaltyEvent>> {
+        let params: StakingParams = self.get(ctx, "/cosmos/staking/v1beta1/params").await?;
+        let unbonding_secs = duration_secs(&params.params.unbonding_time)?;
+
+        let mut events = Vec::new();
+        for validator in validators {
+            let response: ValidatorResponse = self
+                .get(
+                    ctx,
+                    &format!(
+                        "/cosmos/staking/v1beta1/validators/{}",
+                        http::percent_encode(validator)
+                    ),
+                )
+                .await?;
+            events.extend(self.jailed(validator, &response.validator, unbonding_secs)?);
+        }
+        Ok(events)
+    }
+
+    /// The penalty of `validator` if jailed, dated one unbonding period
+    /// before it finishes unbonding
+    fn jailed(
+        &self,
+        validator: &str,
+        state: &CosmosValidator,
+        unbonding_secs: u64,
+    ) -> Result<Option<PenaltyEvent>> {
+        if !state.jailed {
+            return Ok(None);
+        }
+        let unbonded_at = clock::parse_utc(&state.unbonding_time)?;
+        Ok(Some(PenaltyEvent {
+            network: self.name.clone(),
+            validator: validator.to_string(),
+            penalty: Penalty::Jailed,
+            at: unbonded_at.saturating_sub(unbonding_secs),
+        }))
+    }
+
+    async fn get<T: DeserializeOwned>(&self, ctx: &RunContext, path: &str) -> Result<T> {
+        let url = format!("{}{}", self.api_url, path);
+        ctx.run(async {
+            let mut req = http_request_get(&url)?;
+            req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+            proxy::apply(&mut req)?;
+            fetch_json(req).await
+        })
+        .await?
+        .with_context(|| format!("{} request {path} failed", self.name))
+    }
+}
+
+/// Seconds of a protobuf duration such as `1814400s`
+fn duration_secs(duration: &str) -> Result<u64> {
+    duration
+        .strip_suffix('s')
+        .and_then(|secs| secs.parse().ok())
+        .with_context(|| format!("invalid unbonding time {duration}"))
+}
+
+#[derive(Debug, Deserialize)]
+struct BeaconData<T> {
+    data: T,
+}
+
+#[derive(Debug, Deserialize)]
+struct Genesis {
+    genesis_time: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct ValidatorState {
+    index: String,
+    validator: BeaconValidator,
+}
+
+#[derive(Debug, Deserialize)]
+struct BeaconValidator {
+    pubkey: String,
+    slashed: bool,
+    withdrawable_epoch: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct StakingParams {
+    params: UnbondingTime,
+}
+
+#[derive(Debug, Deserialize)]
+struct UnbondingTime {
+    /// Protobuf duration, e.g. `1814400s`
+    unbonding_time: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct ValidatorResponse {
+    validator: CosmosValidator,
+}
+
+#[derive(Debug, Deserialize)]
+struct CosmosValidator {
+    jailed: bool,
+    unbonding_time: String,
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// Beacon chain mainnet genesis
+    const GENESIS_TIME: u64 = 1_606_824_023;
+
+    const PUBKEY: &str = "0x933ad9491b62059dd065b560d256d8957a8c402cc6e8d8ee7290ae11e8f7329267a8811c397529dac52ae1342ba58c95";
+
+    fn network(s: &str) -> Network {
+        Network::parse(s).unwrap()
+    }
+
+    fn states(json: &str) -> Vec<ValidatorState> {
+        serde_json::from_str::<BeaconData<Vec<ValidatorState>>>(json).unwrap().data
+    }
+
+    #[test]
+    fn networks_parse() {
+        assert_eq!(
+            network("ethereum=beacon@http://localhost:5052/"),
+            Network {
+                name: "ethereum".to_string(),
+                kind: Kind::Beacon,
+                api_url: "http://localhost:5052".to_string(),
+            }
+        );
+        assert_eq!(network("cosmoshub=cosmos@https://lcd.example.com").kind, Kind::Cosmos);
+        for invalid in ["ethereum", "ethereum=beacon", "=beacon@http://x", "x=beacon@ws://x"] {
+            assert!(Network::parse(invalid).is_err(), "{invalid}");
+        }
+    }
+
+    #[test]
+    fn slashings_are_dated_from_the_withdrawable_epoch() {
+        let ethereum = network("ethereum=beacon@http://localhost:5052");
+        let states = states(&format!(
+            r#"{{"data": [
+                {{"index": "12345", "validator": {{"pubkey": "0xaa", "slashed": true,
+                    "withdrawable_epoch": "8292"}}}},
+                {{"index": "777", "validator": {{"pubkey": "{PUBKEY}", "slashed": true,
+                    "withdrawable_epoch": "8192"}}}},
+                {{"index": "1", "validator": {{"pubkey": "0xbb", "slashed": false,
+                    "withdrawable_epoch": "18446744073709551615"}}}}]}}"#
+        ));
+        let watched = ["12345".to_string(), PUBKEY.to_uppercase().replace("0X", "0x")];
+        let events = ethereum.slashed(GENESIS_TIME, &watched, states).unwrap();
+        let found: Vec<(&str, Penalty, u64)> =
+            events.iter().map(|e| (e.validator.as_str(), e.penalty, e.at)).collect();
+        // Reported by index or pubkey, the way they were watched
+        assert_eq!(
+            found,
+            [
+                ("12345", Penalty::Slashed, GENESIS_TIME + 100 * SECS_PER_EPOCH),
+                (watched[1].as_str(), Penalty::Slashed, GENESIS_TIME),
+            ]
+        );
+        assert!(events.iter().all(|e| e.network == "ethereum"));
+    }
+
+    #[test]
+    fn jailings_are_dated_one_unbonding_period_back() {
+        let hub = network("cosmoshub=cosmos@https://lcd.example.com");
+        let unbonding_secs = duration_secs("1814400s").unwrap();
+        let jailed = CosmosValidator {
+            jailed: true,
+            unbonding_time: "2025-01-22T00:00:00.123456789Z".to_string(),
+        };
+        let event = hub.jailed("cosmosvaloper1abc", &jailed, unbonding_secs).unwrap().unwrap();
+        assert_eq!((event.penalty, event.at), (Penalty::Jailed, 1_735_689_600));
+
+        let active = CosmosValidator { jailed: false, unbonding_time: String::new() };
+        assert!(hub.jailed("cosmosvaloper1abc", &active, unbonding_secs).unwrap().is_none());
+    }
+
+    #[test]
+    fn durations_need_seconds() {
+        assert_eq!(duration_secs("1814400s").unwrap(), 1_814_400);
+        assert_eq!(duration_secs("21d").unwrap_err().to_string(), "invalid unbonding time 21d");
+        assert!(duration_secs("1.5s").is_err());
+    }
+
+    #[test]
+    fn penalties_have_codes() {
+        assert_eq!((Penalty::Slashed.code(), Penalty::Jailed.code()), (1, 2));
+    }
+}
@@ -0,0 +1,287 @@
+mod chains;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_sol_types::SolValue;
+use chains::{Network, PenaltyEvent};
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    fan_out::FanOut,
+    json_schema,
+    output::{self, Computed},
+    panic_guard,
+};
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["check"];
+
+/// Schema of [`CheckRequest`], checked before it is deserialized
+const REQUEST_SCHEMA: &str = include_str!("../schemas/check_request.schema.json");
+
+/// Window of penalties reported when the trigger gives no `since`,
+/// overridable with `slashing_lookback_secs`
+const DEFAULT_LOOKBACK_SECS: u64 = 86_400;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let request = CheckRequest::parse(input.trim_end_matches('\0').trim())?;
+    println!("request: {:?}", request);
+
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(check(&ctx, request.clone()))?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("slashing:{}", report.since);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::SlashingReport {
+                    since: report.since,
+                    checked: report.checked,
+                    events: report
+                        .events
+                        .iter()
+                        .map(|event| solidity::SlashingEvent {
+                            network: event.network.clone(),
+                            validator: event.validator.clone(),
+                            penalty: event.penalty.code(),
+                            at: event.at,
+                        })
+                        .collect(),
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// Trigger input: empty, the `since` Unix seconds, or
+/// `{"since": 1735689600, "validators": ["ethereum:12345", "cosmoshub:cosmosvaloper1..."]}`.
+///
+/// Passing the time of the previous check as `since` reports every penalty
+/// exactly once and gives all operators the same window; without it the
+/// window is the `slashing_lookback_secs` before the run clock. Validators
+/// default to the `watched_validators` kv config.
+#[derive(Debug, Clone, Default, Deserialize)]
+struct CheckRequest {
+    #[serde(default)]
+    since: Option<u64>,
+    #[serde(default)]
+    validators: Option<Vec<String>>,
+}
+
+impl CheckRequest {
+    fn parse(input: &str) -> Result<Self, String> {
+        if input.is_empty() {
+            return Ok(Self::default());
+        }
+        if input.starts_with('{') {
+            return json_schema::from_slice(REQUEST_SCHEMA, input.as_bytes())
+                .map_err(|e| format!("Invalid check request: {}", e));
+        }
+        let since = input.parse().map_err(|_| format!("Invalid since: {:?}", input))?;
+        Ok(Self { since: Some(since), validators: None })
+    }
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct SlashingReport {
+    /// Penalties at or after this Unix time are reported
+    since: u64,
+    /// Validators checked
+    checked: u32,
+    /// Ordered by time, then network and validator
+    events: Vec<PenaltyEvent>,
+}
+
+async fn check(ctx: &RunContext, request: CheckRequest) -> Result<SlashingReport, String> {
+    let since = match request.since {
+        Some(since) => since,
+        None => {
+            let lookback = config::parse_or("slashing_lookback_secs", DEFAULT_LOOKBACK_SECS)
+                .map_err(|e| e.to_string())?;
+            ctx.clock().unix_secs().saturating_sub(lookback)
+        }
+    };
+    let validators = match request.validators {
+        Some(validators) => validators,
+        None => config::list("watched_validators").unwrap_or_default(),
+    };
+    if validators.is_empty() {
+        return Err("No validators to check, pass them or set watched_validators".to_string());
+    }
+
+    let networks = config::list("slashing_networks")
+        .ok_or("slashing_networks is not configured")?
+        .iter()
+        .map(|entry| Network::parse(entry))
+        .collect::<anyhow::Result<Vec<_>>>()
+        .map_err(|e| e.to_string())?;
+
+    let by_network = group_by_network(&validators, &networks)?;
+    let checked: usize = by_network.values().map(Vec::len).sum();
+    let networks = &networks;
+
+    let found = FanOut::from_env()
+        .map_err(|e| e.to_string())?
+        .try_join(
+            ctx,
+            by_network.iter().map(|(name, validators)| async move {
+                let network = networks.iter().find(|n| n.name == *name).expect("checked above");
+                network.penalties(ctx, validators).await
+            }),
+        )
+        .await
+        .map_err(|e| e.to_string())?;
+    Ok(SlashingReport { since, checked: checked as u32, events: since_ordered(found, since) })
+}
+
+/// `network:validator` entries grouped by network, so each API is asked once
+fn group_by_network<'a>(
+    validators: &'a [String],
+    networks: &[Network],
+) -> Result<BTreeMap<&'a str, Vec<String>>, String> {
+    let mut by_network: BTreeMap<&str, Vec<String>> = BTreeMap::new();
+    for entry in validators {
+        let (network, validator) = entry
+            .split_once(':')
+            .ok_or_else(|| format!("Expected network:validator, got {}", entry))?;
+        if !networks.iter().any(|n| n.name == network) {
+            return Err(format!("Network {} is not in slashing_networks", network));
+        }
+        by_network.entry(network).or_default().push(validator.to_string());
+    }
+    Ok(by_network)
+}
+
+/// The penalties at or after `since`, ordered by time, network and validator
+fn since_ordered(found: Vec<Vec<PenaltyEvent>>, since: u64) -> Vec<PenaltyEvent> {
+    let mut events: Vec<PenaltyEvent> =
+        found.into_iter().flatten().filter(|event| event.at >= since).collect();
+    events.sort_by(|a, b| (a.at, &a.network, &a.validator).cmp(&(b.at, &b.network, &b.validator)));
+    events
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // penalty: 1 slashed (beacon chain), 2 jailed (Cosmos SDK)
+        struct SlashingEvent {
+            string network;
+            string validator;
+            uint8 penalty;
+            uint64 at;
+        }
+
+        struct SlashingReport {
+            uint64 since;
+            uint32 checked;
+            SlashingEvent[] events;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use chains::Penalty;
+
+    fn networks() -> Vec<Network> {
+        ["ethereum=beacon@http://localhost:5052", "cosmoshub=cosmos@https://lcd.example.com"]
+            .iter()
+            .map(|entry| Network::parse(entry).unwrap())
+            .collect()
+    }
+
+    fn event(network: &str, validator: &str, at: u64) -> PenaltyEvent {
+        PenaltyEvent {
+            network: network.to_string(),
+            validator: validator.to_string(),
+            penalty: Penalty::Slashed,
+            at,
+        }
+    }
+
+    #[test]
+    fn requests_parse() {
+        assert!(CheckRequest::parse("").unwrap().since.is_none());
+        assert_eq!(CheckRequest::parse("1735689600").unwrap().since, Some(1_735_689_600));
+        assert_eq!(CheckRequest::parse("yesterday").unwrap_err(), r#"Invalid since: "yesterday""#);
+
+        let request =
+            CheckRequest::parse(r#"{"since": 1735689600, "validators": ["ethereum:12345"]}"#)
+                .unwrap();
+        assert_eq!(request.validators, Some(vec!["ethereum:12345".to_string()]));
+        let err = CheckRequest::parse(r#"{"since": -1}"#).unwrap_err();
+        assert!(err.starts_with("Invalid check request: "), "{err}");
+        assert!(CheckRequest::parse(r#"{"validators": []}"#).is_err());
+    }
+
+    #[test]
+    fn validators_group_by_network() {
+        let validators =
+            ["cosmoshub:cosmosvaloper1abc", "ethereum:12345", "ethereum:0xaa:bb"].map(String::from);
+        let networks = networks();
+        let grouped = group_by_network(&validators, &networks).unwrap();
+        assert_eq!(grouped["ethereum"], ["12345", "0xaa:bb"]);
+        assert_eq!(grouped["cosmoshub"], ["cosmosvaloper1abc"]);
+
+        let unknown = ["osmosis:osmovaloper1".to_string()];
+        assert_eq!(
+            group_by_network(&unknown, &networks),
+            Err("Network osmosis is not in slashing_networks".to_string())
+        );
+        let bare = ["12345".to_string()];
+        assert_eq!(
+            group_by_network(&bare, &networks),
+            Err("Expected network:validator, got 12345".to_string())
+        );
+    }
+
+    #[test]
+    fn events_are_windowed_and_ordered() {
+        let found = vec![
+            vec![event("ethereum", "2", 200), event("ethereum", "1", 99)],
+            vec![event("cosmoshub", "b", 200), event("cosmoshub", "a", 100)],
+        ];
+        let events = since_ordered(found, 100);
+        let order: Vec<(&str, &str, u64)> =
+            events.iter().map(|e| (e.network.as_str(), e.validator.as_str(), e.at)).collect();
+        assert_eq!(
+            order,
+            [("cosmoshub", "a", 100), ("cosmoshub", "b", 200), ("ethereum", "2", 200)]
+        );
+    }
+}
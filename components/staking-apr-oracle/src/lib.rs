@@ -0,0 +1,189 @@
+mod networks;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    fan_out::FanOut,
+    output::{self, Computed},
+    panic_guard,
+};
+use networks::{Kind, Network};
+use serde::{Deserialize, Serialize};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["apr"];
+
+/// Networks and their APIs, overridable with `staking_networks`
+const DEFAULT_NETWORKS: &[&str] = &["cosmoshub=cosmos@https://rest.cosmos.directory/cosmoshub"];
+
+/// APRs are published in parts per million, so 3.1% is 31000
+const APR_SCALE: f64 = 1_000_000.0;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let networks = select_networks(input.trim_end_matches('\0'))?;
+    println!("networks: {:?}", networks);
+
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(get_aprs(&ctx, &networks))?;
+        println!("report: {:?}", report);
+
+        let names: Vec<&str> = report.networks.iter().map(|n| n.network.as_str()).collect();
+        let feed_id = format!("staking-apr:{}", names.join(","));
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload: Vec<solidity::StakingApr> = report
+                    .networks
+                    .iter()
+                    .map(|n| solidity::StakingApr { network: n.network.clone(), aprPpm: n.apr_ppm })
+                    .collect();
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// The configured networks named in the comma separated input, or all of
+/// them when it is empty
+fn select_networks(input: &str) -> Result<Vec<Network>, String> {
+    let configured = config::list("staking_networks")
+        .unwrap_or_else(|| DEFAULT_NETWORKS.iter().map(|n| n.to_string()).collect());
+    let configured = configured
+        .iter()
+        .map(|entry| Network::parse(entry))
+        .collect::<anyhow::Result<Vec<_>>>()
+        .map_err(|e| e.to_string())?;
+
+    let mut names: Vec<&str> =
+        input.split(|c: char| c == ',' || c.is_whitespace()).filter(|s| !s.is_empty()).collect();
+    if names.is_empty() {
+        names = configured.iter().map(|n| n.name.as_str()).collect();
+    }
+    names.sort();
+    names.dedup();
+    let selected = names
+        .into_iter()
+        .map(|name| {
+            configured
+                .iter()
+                .find(|n| n.name == name)
+                .cloned()
+                .ok_or_else(|| format!("Network {} is not in staking_networks", name))
+        })
+        .collect::<Result<Vec<_>, String>>()?;
+    if selected.is_empty() {
+        return Err("No staking networks configured".to_string());
+    }
+    Ok(selected)
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct NetworkApr {
+    network: String,
+    kind: Kind,
+    /// Parts per million
+    apr_ppm: u64,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct AprReport {
+    networks: Vec<NetworkApr>,
+}
+
+async fn get_aprs(ctx: &RunContext, networks: &[Network]) -> Result<AprReport, String> {
+    let networks = FanOut::from_env()
+        .map_err(|e| e.to_string())?
+        .try_join(
+            ctx,
+            networks.iter().map(|network| async move {
+                let apr = network.apr(ctx).await?;
+                anyhow::Ok(NetworkApr {
+                    network: network.name.clone(),
+                    kind: network.kind,
+                    apr_ppm: to_ppm(apr),
+                })
+            }),
+        )
+        .await
+        .map_err(|e| e.to_string())?;
+    Ok(AprReport { networks })
+}
+
+/// An APR fraction in whole parts per million
+fn to_ppm(apr: f64) -> u64 {
+    (apr * APR_SCALE).round() as u64
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // APR in parts per million, 31000 being 3.1%
+        struct StakingApr {
+            string network;
+            uint64 aprPpm;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn all_configured_networks_by_default() {
+        let networks = select_networks(" ").unwrap();
+        let names: Vec<&str> = networks.iter().map(|n| n.name.as_str()).collect();
+        assert_eq!(names, ["cosmoshub"]);
+        assert_eq!(networks[0].api_url, "https://rest.cosmos.directory/cosmoshub");
+    }
+
+    #[test]
+    fn networks_are_picked_by_name() {
+        assert_eq!(select_networks("cosmoshub, cosmoshub").unwrap().len(), 1);
+        assert_eq!(
+            select_networks("cosmoshub osmosis"),
+            Err("Network osmosis is not in staking_networks".to_string())
+        );
+    }
+
+    #[test]
+    fn aprs_round_to_parts_per_million() {
+        assert_eq!(to_ppm(0.031), 31_000);
+        assert_eq!(to_ppm(0.0279319549), 27_932);
+        assert_eq!(to_ppm(0.0000004), 0);
+        assert_eq!(to_ppm(0.0), 0);
+    }
+}
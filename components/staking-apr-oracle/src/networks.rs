@@ -0,0 +1,284 @@
+//! Staking networks and how their reference APR is derived.
+//!
+//! - Beacon chain: the ideal consensus-layer yield of the spec's base reward,
+//!   `64 / isqrt(total active gwei)` per epoch, scaled by the previous epoch's
+//!   target participation. Execution tips and MEV are not included. Needs a
+//!   Lighthouse node for the `validator_inclusion` endpoint.
+//! - Cosmos SDK: `inflation * supply * (1 - community_tax) / bonded`, from
+//!   the standard `x/mint`, `x/bank`, `x/distribution` and `x/staking`
+//!   modules, before validator commission.
+
+use anyhow::{anyhow, Context, Result};
+use common::{context::RunContext, http::fetch_json, proxy};
+use serde::{de::DeserializeOwned, Deserialize, Serialize};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::http::HeaderValue;
+
+/// Spec `BASE_REWARD_FACTOR`
+const BASE_REWARD_FACTOR: f64 = 64.0;
+
+/// 365.25 days of 32 twelve second slots
+const EPOCHS_PER_YEAR: f64 = 31_557_600.0 / 384.0;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Kind {
+    Beacon,
+    Cosmos,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Network {
+    pub name: String,
+    pub kind: Kind,
+    pub api_url: String,
+}
+
+impl Network {
+    /// Parses `name=kind@url`, e.g. `cosmoshub=cosmos@https://rest.cosmos.directory/cosmoshub`
+    pub fn parse(s: &str) -> Result<Self> {
+        let invalid =
+            || anyhow!("invalid network {s:?}, expected name=beacon@url or name=cosmos@url");
+        let (name, rest) = s.trim().split_once('=').ok_or_else(invalid)?;
+        let (kind, api_url) = rest.split_once('@').ok_or_else(invalid)?;
+        let kind = match kind {
+            "beacon" => Kind::Beacon,
+            "cosmos" => Kind::Cosmos,
+            _ => return Err(invalid()),
+        };
+        if name.is_empty() || !api_url.starts_with("http") {
+            return Err(invalid());
+        }
+        Ok(Self {
+            name: name.to_string(),
+            kind,
+            api_url: api_url.trim_end_matches('/').to_string(),
+        })
+    }
+
+    /// Annual percentage rate as a fraction, e.g. `0.031`
+    pub async fn apr(&self, ctx: &RunContext) -> Result<f64> {
+        let apr = match self.kind {
+            Kind::Beacon => self.beacon_apr(ctx).await?,
+            Kind::Cosmos => self.cosmos_apr(ctx).await?,
+        };
+        if !apr.is_finite() || apr < 0.0 {
+            return Err(anyhow!("{} APR came out as {apr}", self.name));
+        }
+        Ok(apr)
+    }
+
+    async fn beacon_apr(&self, ctx: &RunContext) -> Result<f64> {
+        let checkpoints: BeaconData<FinalityCheckpoints> =
+            self.get(ctx, "/eth/v1/beacon/states/head/finality_checkpoints").await?;
+        let epoch: u64 = checkpoints.data.finalized.epoch.parse().context("invalid epoch")?;
+        let inclusion: BeaconData<GlobalInclusion> =
+            self.get(ctx, &format!("/lighthouse/validator_inclusion/{epoch}/global")).await?;
+        beacon_yield(epoch, &inclusion.data)
+    }
+
+    async fn cosmos_apr(&self, ctx: &RunContext) -> Result<f64> {
+        let staking: StakingParams = self.get(ctx, "/cosmos/staking/v1beta1/params").await?;
+        let denom = staking.params.bond_denom;
+        let inflation: Inflation = self.get(ctx, "/cosmos/mint/v1beta1/inflation").await?;
+        let pool: StakingPool = self.get(ctx, "/cosmos/staking/v1beta1/pool").await?;
+        let supply: Supply =
+            self.get(ctx, &format!("/cosmos/bank/v1beta1/supply/by_denom?denom={denom}")).await?;
+        let distribution: DistributionParams =
+            self.get(ctx, "/cosmos/distribution/v1beta1/params").await?;
+
+        cosmos_yield(
+            &inflation.inflation,
+            &supply.amount.amount,
+            &distribution.params.community_tax,
+            &pool.pool.bonded_tokens,
+        )
+    }
+
+    async fn get<T: DeserializeOwned>(&self, ctx: &RunContext, path: &str) -> Result<T> {
+        let url = format!("{}{}", self.api_url, path);
+        ctx.run(async {
+            let mut req = http_request_get(&url)?;
+            req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+            proxy::apply(&mut req)?;
+            fetch_json(req).await
+        })
+        .await?
+        .with_context(|| format!("{} request {path} failed", self.name))
+    }
+}
+
+/// Ideal yield of the stake active at `epoch`, scaled by its participation
+fn beacon_yield(epoch: u64, inclusion: &GlobalInclusion) -> Result<f64> {
+    if inclusion.current_epoch_active_gwei == 0 {
+        return Err(anyhow!("no active stake at epoch {epoch}"));
+    }
+    let ideal = BASE_REWARD_FACTOR * EPOCHS_PER_YEAR
+        / integer_sqrt(inclusion.current_epoch_active_gwei) as f64;
+    let participation = inclusion.previous_epoch_target_attesting_gwei as f64
+        / inclusion.current_epoch_active_gwei as f64;
+    Ok(ideal * participation.min(1.0))
+}
+
+/// Yield of the bonded tokens from the inflation left after the community tax
+fn cosmos_yield(inflation: &str, supply: &str, community_tax: &str, bonded: &str) -> Result<f64> {
+    let bonded = decimal(bonded)?;
+    if bonded == 0.0 {
+        return Err(anyhow!("nothing is bonded"));
+    }
+    let minted = decimal(inflation)? * decimal(supply)?;
+    Ok(minted * (1.0 - decimal(community_tax)?) / bonded)
+}
+
+/// Largest integer whose square is at most `n`, as the spec's `integer_squareroot`
+fn integer_sqrt(n: u64) -> u64 {
+    let (mut x, mut y) = (n, (n + 1) / 2);
+    while y < x {
+        x = y;
+        y = (x + n / x) / 2;
+    }
+    x
+}
+
+/// Cosmos SDK decimals and integers are JSON strings
+fn decimal(s: &str) -> Result<f64> {
+    s.parse().with_context(|| format!("invalid decimal {s:?}"))
+}
+
+#[derive(Debug, Deserialize)]
+struct BeaconData<T> {
+    data: T,
+}
+
+#[derive(Debug, Deserialize)]
+struct FinalityCheckpoints {
+    finalized: Checkpoint,
+}
+
+#[derive(Debug, Deserialize)]
+struct Checkpoint {
+    epoch: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct GlobalInclusion {
+    current_epoch_active_gwei: u64,
+    previous_epoch_target_attesting_gwei: u64,
+}
+
+#[derive(Debug, Deserialize)]
+struct StakingParams {
+    params: BondDenom,
+}
+
+#[derive(Debug, Deserialize)]
+struct BondDenom {
+    bond_denom: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct Inflation {
+    inflation: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct StakingPool {
+    pool: Pool,
+}
+
+#[derive(Debug, Deserialize)]
+struct Pool {
+    bonded_tokens: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct Supply {
+    amount: Coin,
+}
+
+#[derive(Debug, Deserialize)]
+struct Coin {
+    amount: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct DistributionParams {
+    params: CommunityTax,
+}
+
+#[derive(Debug, Deserialize)]
+struct CommunityTax {
+    community_tax: String,
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// A million validators of 32 ETH
+    const ACTIVE_GWEI: u64 = 32_000_000_000_000_000;
+
+    fn inclusion(active: u64, attesting: u64) -> GlobalInclusion {
+        GlobalInclusion {
+            current_epoch_active_gwei: active,
+            previous_epoch_target_attesting_gwei: attesting,
+        }
+    }
+
+    #[test]
+    fn networks_parse() {
+        assert_eq!(
+            Network::parse(" mainnet=beacon@http://localhost:5052/ ").unwrap(),
+            Network {
+                name: "mainnet".to_string(),
+                kind: Kind::Beacon,
+                api_url: "http://localhost:5052".to_string(),
+            }
+        );
+        assert_eq!(Network::parse(crate::DEFAULT_NETWORKS[0]).unwrap().kind, Kind::Cosmos);
+        for invalid in ["cosmoshub", "cosmoshub=cosmos", "=cosmos@https://x", "x=solana@https://x"]
+        {
+            assert!(Network::parse(invalid).is_err(), "{invalid}");
+        }
+        assert_eq!(
+            Network::parse("x=cosmos@ftp://x").unwrap_err().to_string(),
+            r#"invalid network "x=cosmos@ftp://x", expected name=beacon@url or name=cosmos@url"#
+        );
+    }
+
+    #[test]
+    fn beacon_yield_follows_participation() {
+        let full = beacon_yield(1, &inclusion(ACTIVE_GWEI, ACTIVE_GWEI)).unwrap();
+        assert_eq!((full * 1e6).round(), 29_402.0);
+        let partial = beacon_yield(1, &inclusion(ACTIVE_GWEI, ACTIVE_GWEI / 100 * 95)).unwrap();
+        assert_eq!((partial * 1e6).round(), 27_932.0);
+        // Late attestations can't push participation above one
+        assert_eq!(beacon_yield(1, &inclusion(ACTIVE_GWEI, 2 * ACTIVE_GWEI)).unwrap(), full);
+        assert_eq!(
+            beacon_yield(7, &inclusion(0, 0)).unwrap_err().to_string(),
+            "no active stake at epoch 7"
+        );
+    }
+
+    #[test]
+    fn cosmos_yield_is_inflation_over_bonded() {
+        let apr = cosmos_yield("0.100000000000000000", "1000000", "0.020000000000000000", "500000");
+        assert_eq!((apr.unwrap() * 1e6).round(), 196_000.0);
+        assert_eq!(
+            cosmos_yield("0.1", "1000000", "0.02", "0").unwrap_err().to_string(),
+            "nothing is bonded"
+        );
+        assert_eq!(
+            cosmos_yield("0.1", "1000000uatom", "0.02", "1").unwrap_err().to_string(),
+            r#"invalid decimal "1000000uatom""#
+        );
+    }
+
+    #[test]
+    fn integer_sqrt_rounds_down() {
+        let roots: Vec<u64> =
+            [0, 1, 15, 16, 17, ACTIVE_GWEI].iter().map(|&n| integer_sqrt(n)).collect();
+        assert_eq!(roots, [0, 1, 3, 4, 4, 178_885_438]);
+        assert_eq!(integer_sqrt(1_000_000_000_000_000_000), 1_000_000_000);
+    }
+}
@@ -0,0 +1,372 @@
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, clock, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    fan_out::FanOut,
+    http::{self, fetch_json},
+    output::{self, Computed},
+    panic_guard, proxy,
+};
+use serde::{Deserialize, Serialize};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::{http::HeaderValue, runtime::block_on};
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["check"];
+
+/// Certificate transparency search returning JSON certificate entries, with
+/// `{host}` replaced; overridable with `cert_api_url`
+const DEFAULT_CERT_API_URL: &str = "https://crt.sh/?q={host}&output=json&exclude=expired";
+
+/// Days before expiry at which a certificate is flagged for renewal,
+/// overridable with `renewal_threshold_days`
+const DEFAULT_RENEWAL_THRESHOLD_DAYS: i64 = 14;
+
+/// Upper bound on the hosts checked in one run, overridable with `max_hosts`
+const DEFAULT_MAX_HOSTS: usize = 10;
+
+const SECS_PER_DAY: i64 = 86_400;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let config = MonitorConfig::from_env()?;
+    let hosts = parse_hosts(input.trim_end_matches('\0'), config.max_hosts)?;
+    println!("hosts: {:?}", hosts);
+
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(check_hosts(&ctx, &config, &hosts))?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("certs:{}", report.hosts_label());
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload: Vec<solidity::CertificateStatus> = report
+                    .certificates
+                    .iter()
+                    .map(|cert| solidity::CertificateStatus {
+                        host: cert.host.clone(),
+                        issuer: cert.issuer.clone(),
+                        notAfter: cert.not_after,
+                        daysToExpiry: cert.days_to_expiry,
+                        needsRenewal: cert.needs_renewal,
+                    })
+                    .collect();
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+struct MonitorConfig {
+    api_url: String,
+    renewal_threshold_days: i64,
+    max_hosts: usize,
+}
+
+impl MonitorConfig {
+    fn from_env() -> Result<Self, String> {
+        let api_url = config::string_or("cert_api_url", DEFAULT_CERT_API_URL);
+        if !api_url.contains("{host}") {
+            return Err("cert_api_url must contain {host}".to_string());
+        }
+        let renewal_threshold_days =
+            config::parse_or("renewal_threshold_days", DEFAULT_RENEWAL_THRESHOLD_DAYS)
+                .map_err(|e| e.to_string())?;
+        let max_hosts =
+            config::parse_or("max_hosts", DEFAULT_MAX_HOSTS).map_err(|e| e.to_string())?;
+        Ok(Self { api_url, renewal_threshold_days, max_hosts })
+    }
+}
+
+/// Reads the comma or whitespace separated hosts of the input, or the comma
+/// separated `cert_hosts` kv config when the input is empty
+fn parse_hosts(input: &str, max_hosts: usize) -> Result<Vec<String>, String> {
+    let list = if input.trim().is_empty() {
+        config::list("cert_hosts").unwrap_or_default()
+    } else {
+        input.split(|c: char| c == ',' || c.is_whitespace()).map(str::to_string).collect()
+    };
+    let mut hosts: Vec<String> = list
+        .iter()
+        .filter(|host| !host.is_empty())
+        .map(|host| host.trim_end_matches('.').to_ascii_lowercase())
+        .collect();
+    hosts.sort();
+    hosts.dedup();
+
+    if hosts.is_empty() {
+        return Err("No hosts to check, pass them as input or set cert_hosts".to_string());
+    }
+    if hosts.len() > max_hosts {
+        return Err(format!("{} hosts requested, at most {} are allowed", hosts.len(), max_hosts));
+    }
+    if let Some(host) = hosts
+        .iter()
+        .find(|host| !host.chars().all(|c| c.is_ascii_alphanumeric() || matches!(c, '-' | '.')))
+    {
+        return Err(format!("Invalid host: {}", host));
+    }
+    Ok(hosts)
+}
+
+/// Certificate transparency log entry, as served by crt.sh
+#[derive(Debug, Deserialize)]
+struct CtEntry {
+    issuer_name: String,
+    /// Names the certificate covers, newline separated
+    name_value: String,
+    not_before: String,
+    not_after: String,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct CertificateInfo {
+    host: String,
+    issuer: String,
+    /// Unix seconds
+    not_after: u64,
+    /// Whole days left, negative once expired
+    days_to_expiry: i64,
+    needs_renewal: bool,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct CertificateReport {
+    certificates: Vec<CertificateInfo>,
+}
+
+impl CertificateReport {
+    fn hosts_label(&self) -> String {
+        let hosts: Vec<&str> = self.certificates.iter().map(|c| c.host.as_str()).collect();
+        hosts.join(",")
+    }
+}
+
+async fn check_hosts(
+    ctx: &RunContext,
+    config: &MonitorConfig,
+    hosts: &[String],
+) -> Result<CertificateReport, String> {
+    let now = ctx.clock().unix_secs() as i64;
+    let certificates = FanOut::from_env()
+        .map_err(|e| e.to_string())?
+        .try_join(ctx, hosts.iter().map(|host| check_host(config, host, now)))
+        .await
+        .map_err(|e| e.to_string())?;
+    Ok(CertificateReport { certificates })
+}
+
+async fn check_host(
+    config: &MonitorConfig,
+    host: &str,
+    now: i64,
+) -> Result<CertificateInfo, String> {
+    let url = config.api_url.replace("{host}", &http::percent_encode(host));
+    let mut req = http_request_get(&url).map_err(|e| e.to_string())?;
+    req.headers_mut().insert("Accept", HeaderValue::from_static("application/json"));
+    proxy::apply(&mut req).map_err(|e| e.to_string())?;
+    let entries: Vec<CtEntry> = fetch_json(req).await.map_err(|e| e.to_string())?;
+    current_certificate(&entries, host, now, config.renewal_threshold_days)
+}
+
+/// Picks the most recently issued of `entries` that covers `host` and is
+/// already valid at `now`
+fn current_certificate(
+    entries: &[CtEntry],
+    host: &str,
+    now: i64,
+    renewal_threshold_days: i64,
+) -> Result<CertificateInfo, String> {
+    let mut latest: Option<(u64, u64, String)> = None;
+    for entry in entries.iter().filter(|entry| covers(&entry.name_value, host)) {
+        let not_before = clock::parse_utc(&entry.not_before).map_err(|e| e.to_string())?;
+        let not_after = clock::parse_utc(&entry.not_after).map_err(|e| e.to_string())?;
+        if not_before as i64 > now || latest.as_ref().is_some_and(|(nb, _, _)| *nb >= not_before) {
+            continue;
+        }
+        latest = Some((not_before, not_after, entry.issuer_name.clone()));
+    }
+    let (_, not_after, issuer) =
+        latest.ok_or_else(|| format!("No current certificate found for {}", host))?;
+
+    let days_to_expiry = (not_after as i64 - now).div_euclid(SECS_PER_DAY);
+    Ok(CertificateInfo {
+        host: host.to_string(),
+        issuer,
+        not_after,
+        days_to_expiry,
+        needs_renewal: days_to_expiry < renewal_threshold_days,
+    })
+}
+
+/// Whether one of the newline separated certificate names matches `host`,
+/// wildcards covering a single label
+fn covers(names: &str, host: &str) -> bool {
+    names.lines().map(|name| name.trim().to_ascii_lowercase()).any(|name| {
+        match name.strip_prefix("*.") {
+            Some(parent) => host.split_once('.').is_some_and(|(_, rest)| rest == parent),
+            None => name == host,
+        }
+    })
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        struct CertificateStatus {
+            string host;
+            string issuer;
+            uint64 notAfter;
+            int64 daysToExpiry;
+            bool needsRenewal;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// 2025-01-01T00:00:00
+    const NOW: i64 = 1_735_689_600;
+
+    fn entry(names: &str, issuer: &str, not_before: &str, not_after: &str) -> CtEntry {
+        CtEntry {
+            issuer_name: issuer.to_string(),
+            name_value: names.to_string(),
+            not_before: not_before.to_string(),
+            not_after: not_after.to_string(),
+        }
+    }
+
+    #[test]
+    fn hosts_parse_from_input() {
+        assert_eq!(
+            parse_hosts("Example.com. api.example.com,example.com\tb.example.org", 3).unwrap(),
+            ["api.example.com", "b.example.org", "example.com"]
+        );
+        assert_eq!(
+            parse_hosts("a.example.com b.example.com", 1),
+            Err("2 hosts requested, at most 1 are allowed".to_string())
+        );
+        assert_eq!(
+            parse_hosts("example.com/path", 3),
+            Err("Invalid host: example.com/path".to_string())
+        );
+    }
+
+    #[test]
+    fn configured_hosts_are_the_fallback() {
+        std::env::set_var("cert_hosts", "b.example.com, a.example.com");
+        assert_eq!(parse_hosts(" ", 3).unwrap(), ["a.example.com", "b.example.com"]);
+        std::env::remove_var("cert_hosts");
+        assert_eq!(
+            parse_hosts("", 3),
+            Err("No hosts to check, pass them as input or set cert_hosts".to_string())
+        );
+    }
+
+    #[test]
+    fn wildcards_cover_a_single_label() {
+        assert!(covers("example.com\nwww.example.com", "www.example.com"));
+        assert!(covers("*.Example.com", "api.example.com"));
+        assert!(!covers("*.example.com", "example.com"));
+        assert!(!covers("*.example.com", "a.b.example.com"));
+        assert!(!covers("example.com", "api.example.com"));
+    }
+
+    #[test]
+    fn latest_valid_certificate_is_picked() {
+        let entries = [
+            entry("example.com", "Old CA", "2024-06-01T00:00:00", "2024-12-01T00:00:00"),
+            entry("*.example.com", "Current CA", "2024-11-01T00:00:00", "2025-02-01T00:00:00"),
+            // Not valid yet
+            entry(
+                "example.com\nwww.example.com",
+                "Next CA",
+                "2025-01-15T00:00:00",
+                "2025-06-01T00:00:00",
+            ),
+            // Newer, but for another name
+            entry("other.example.com", "Other CA", "2024-12-15T00:00:00", "2025-03-01T00:00:00"),
+        ];
+        let cert = current_certificate(&entries, "www.example.com", NOW, 14).unwrap();
+        assert_eq!(cert.issuer, "Current CA");
+        assert_eq!(cert.not_after, 1_738_368_000);
+        assert_eq!(cert.days_to_expiry, 31);
+        assert!(!cert.needs_renewal);
+
+        assert_eq!(
+            current_certificate(&entries, "api.example.org", NOW, 14).unwrap_err(),
+            "No current certificate found for api.example.org"
+        );
+    }
+
+    #[test]
+    fn renewal_is_flagged_below_the_threshold() {
+        let entries = [entry("example.com", "CA", "2024-10-01T00:00:00", "2025-01-10T12:00:00")];
+        let cert = current_certificate(&entries, "example.com", NOW, 14).unwrap();
+        assert_eq!(cert.days_to_expiry, 9);
+        assert!(cert.needs_renewal);
+        assert!(!current_certificate(&entries, "example.com", NOW, 9).unwrap().needs_renewal);
+
+        // Partial days left round down, past expiry as well
+        let expired = [entry("example.com", "CA", "2024-10-01T00:00:00", "2024-12-31T12:00:00")];
+        let cert = current_certificate(&expired, "example.com", NOW, 14).unwrap();
+        assert_eq!(cert.days_to_expiry, -1);
+        assert!(cert.needs_renewal);
+    }
+
+    #[test]
+    fn unparsable_dates_fail() {
+        let entries = [entry("example.com", "CA", "yesterday", "2025-02-01T00:00:00")];
+        assert_eq!(
+            current_certificate(&entries, "example.com", NOW, 14).unwrap_err(),
+            "invalid UTC timestamp yesterday"
+        );
+    }
+
+    #[test]
+    fn label_lists_the_hosts() {
+        let entries = [entry("*.example.com", "CA", "2024-11-01T00:00:00", "2025-02-01T00:00:00")];
+        let report = CertificateReport {
+            certificates: ["a.example.com", "b.example.com"]
+                .iter()
+                .map(|host| current_certificate(&entries, host, NOW, 14).unwrap())
+                .collect(),
+        };
+        assert_eq!(report.hosts_label(), "a.example.com,b.example.com");
+    }
+}
@@ -0,0 +1,364 @@
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, Guest, TriggerAction};
+use alloy_primitives::{keccak256, B256};
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost, determinism,
+    envelope::ComponentInfo,
+    fan_out::FanOut,
+    http,
+    output::{self, Computed},
+    panic_guard, proxy,
+};
+use serde::{Deserialize, Serialize};
+use std::time::{Duration, Instant};
+use wavs_wasi_chain::http::http_request_get;
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["probe"];
+
+/// Upper bound on the URLs probed in one run, overridable with `max_urls`
+const DEFAULT_MAX_URLS: usize = 20;
+
+/// Per-probe timeout, overridable with `probe_timeout_ms`
+const DEFAULT_PROBE_TIMEOUT_MS: u64 = 5_000;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let config = ProbeConfig::from_env()?;
+    let urls = parse_urls(input.trim_end_matches('\0'), config.max_urls)?;
+    println!("probing {} urls", urls.len());
+
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(probe_all(&ctx, &config, urls.clone()))?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("uptime:{}", report.urls_hash);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let payload = solidity::UptimeReport {
+                    urlsHash: report.urls_hash,
+                    up: report.up,
+                    total: report.probes.len() as u32,
+                    availabilityBps: report.availability_bps,
+                    probes: report
+                        .probes
+                        .iter()
+                        .map(|probe| solidity::UrlProbe {
+                            url: probe.url.clone(),
+                            up: probe.up,
+                            statusCode: probe.status_code.unwrap_or_default(),
+                            tls: probe.tls as u8,
+                        })
+                        .collect(),
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+struct ProbeConfig {
+    max_urls: usize,
+    timeout: Duration,
+}
+
+impl ProbeConfig {
+    fn from_env() -> Result<Self, String> {
+        let max_urls = config::parse_or("max_urls", DEFAULT_MAX_URLS).map_err(|e| e.to_string())?;
+        let timeout_ms = config::parse_or("probe_timeout_ms", DEFAULT_PROBE_TIMEOUT_MS)
+            .map_err(|e| e.to_string())?;
+        Ok(Self { max_urls, timeout: Duration::from_millis(timeout_ms) })
+    }
+}
+
+/// Reads the comma or whitespace separated URLs of the input, or the comma
+/// separated `uptime_urls` kv config when the input is empty
+fn parse_urls(input: &str, max_urls: usize) -> Result<Vec<String>, String> {
+    let urls: Vec<String> = if input.trim().is_empty() {
+        config::list("uptime_urls").unwrap_or_default()
+    } else {
+        input
+            .split(|c: char| c == ',' || c.is_whitespace())
+            .filter(|url| !url.is_empty())
+            .map(str::to_string)
+            .collect()
+    };
+
+    if urls.is_empty() {
+        return Err("No URLs to probe, pass them as input or set uptime_urls".to_string());
+    }
+    if urls.len() > max_urls {
+        return Err(format!("{} URLs requested, at most {} are allowed", urls.len(), max_urls));
+    }
+    if let Some(url) =
+        urls.iter().find(|url| !url.starts_with("https://") && !url.starts_with("http://"))
+    {
+        return Err(format!("Invalid URL {}, expected http:// or https://", url));
+    }
+    Ok(urls)
+}
+
+/// Outcome of the TLS handshake
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum TlsStatus {
+    /// Plain HTTP
+    None = 0,
+    /// The certificate was accepted by the host
+    Valid = 1,
+    /// The host rejected the certificate or the handshake
+    Invalid = 2,
+    /// The connection failed before TLS could be judged
+    Unknown = 3,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct UrlProbe {
+    url: String,
+    /// Answered with a status below 400. Latency is left out: it differs
+    /// between operators, who must agree on the report.
+    up: bool,
+    status_code: Option<u16>,
+    /// Differs between operators, so it is only in the CLI report
+    latency_ms: Option<u64>,
+    tls: TlsStatus,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    error: Option<String>,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct UptimeReport {
+    /// keccak256 of the probed URLs joined by `\n`, identifying the URL set
+    urls_hash: B256,
+    up: u32,
+    /// Share of URLs that are up, in basis points
+    availability_bps: u16,
+    probes: Vec<UrlProbe>,
+}
+
+async fn probe_all(
+    ctx: &RunContext,
+    config: &ProbeConfig,
+    urls: Vec<String>,
+) -> Result<UptimeReport, String> {
+    // Probes time out individually and report the URL as down
+    let fan_out = FanOut { source_timeout: None, ..FanOut::from_env().map_err(|e| e.to_string())? };
+    let probes = fan_out
+        .try_join(
+            ctx,
+            urls.iter().map(|url| async move { Ok::<_, String>(probe(ctx, config, url).await) }),
+        )
+        .await
+        .map_err(|e| e.to_string())?;
+
+    Ok(summarize(&urls, probes))
+}
+
+/// The report over `probes` of `urls`
+fn summarize(urls: &[String], probes: Vec<UrlProbe>) -> UptimeReport {
+    let up = probes.iter().filter(|probe| probe.up).count() as u32;
+    UptimeReport {
+        urls_hash: keccak256(urls.join("\n")),
+        up,
+        availability_bps: (up as u64 * 10_000 / probes.len() as u64) as u16,
+        probes,
+    }
+}
+
+async fn probe(ctx: &RunContext, config: &ProbeConfig, url: &str) -> UrlProbe {
+    let started = Instant::now();
+    let result = async {
+        let mut req = http_request_get(url)?;
+        proxy::apply(&mut req)?;
+        ctx.with_timeout(config.timeout).run(http::send(req)).await?
+    }
+    .await;
+    // Timing is not replayed, so the determinism check leaves it out
+    let latency = (!determinism::active()).then(|| started.elapsed());
+
+    outcome(url, result, latency)
+}
+
+/// The probe of `url` that got `result` after `latency`
+fn outcome(
+    url: &str,
+    result: anyhow::Result<http::Response>,
+    latency: Option<Duration>,
+) -> UrlProbe {
+    let https = url.starts_with("https://");
+    match result {
+        Ok(response) => UrlProbe {
+            url: url.to_string(),
+            up: response.status < 400,
+            status_code: Some(response.status),
+            latency_ms: latency.map(|latency| latency.as_millis() as u64),
+            tls: if https { TlsStatus::Valid } else { TlsStatus::None },
+            error: None,
+        },
+        Err(e) => {
+            let tls = match (https, http::transport_error(&e)) {
+                (false, _) => TlsStatus::None,
+                (true, Some(transport)) if transport.is_tls() => TlsStatus::Invalid,
+                (true, _) => TlsStatus::Unknown,
+            };
+            let error = format!("{:#}", e);
+            UrlProbe {
+                url: url.to_string(),
+                up: false,
+                status_code: None,
+                latency_ms: None,
+                tls,
+                error: Some(error),
+            }
+        }
+    }
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        struct UrlProbe {
+            string url;
+            bool up;
+            uint16 statusCode;
+            // 0: plain HTTP, 1: valid, 2: invalid, 3: unknown
+            uint8 tls;
+        }
+
+        struct UptimeReport {
+            bytes32 urlsHash;
+            uint32 up;
+            uint32 total;
+            uint16 availabilityBps;
+            UrlProbe[] probes;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use common::http::{Response, TransportError};
+    use wstd::http::error::WasiHttpErrorCode;
+
+    fn status(status: u16) -> anyhow::Result<Response> {
+        Ok(Response { status, headers: Vec::new(), body: Vec::new() })
+    }
+
+    fn failed(code: WasiHttpErrorCode) -> anyhow::Result<Response> {
+        Err(anyhow::Error::new(TransportError(code)))
+    }
+
+    #[test]
+    fn urls_parse_from_input() {
+        let urls =
+            parse_urls("https://a.example.com, http://b.example.com\nhttps://c.example.com", 3);
+        assert_eq!(
+            urls.unwrap(),
+            ["https://a.example.com", "http://b.example.com", "https://c.example.com"]
+        );
+        assert_eq!(
+            parse_urls("https://a.example.com https://b.example.com", 1),
+            Err("2 URLs requested, at most 1 are allowed".to_string())
+        );
+        assert_eq!(
+            parse_urls("ftp://a.example.com", 3),
+            Err("Invalid URL ftp://a.example.com, expected http:// or https://".to_string())
+        );
+    }
+
+    #[test]
+    fn configured_urls_are_the_fallback() {
+        std::env::set_var("uptime_urls", "https://a.example.com,https://b.example.com");
+        assert_eq!(parse_urls(" ", 3).unwrap(), ["https://a.example.com", "https://b.example.com"]);
+        std::env::remove_var("uptime_urls");
+        assert!(parse_urls("", 3).is_err());
+    }
+
+    #[test]
+    fn up_is_judged_by_status_only() {
+        let ok = outcome("https://a.example.com", status(200), Some(Duration::from_secs(30)));
+        assert!(ok.up);
+        assert_eq!(
+            (ok.status_code, ok.latency_ms, ok.tls),
+            (Some(200), Some(30_000), TlsStatus::Valid)
+        );
+
+        let redirect = outcome("http://a.example.com", status(301), None);
+        assert!(redirect.up);
+        assert_eq!(redirect.tls, TlsStatus::None);
+
+        let unavailable = outcome("https://a.example.com", status(503), None);
+        assert!(!unavailable.up);
+        assert_eq!(unavailable.status_code, Some(503));
+    }
+
+    #[test]
+    fn tls_failures_are_classified_from_the_error_code() {
+        let bad_cert =
+            outcome("https://a.example.com", failed(WasiHttpErrorCode::TlsCertificateError), None);
+        assert_eq!((bad_cert.up, bad_cert.tls), (false, TlsStatus::Invalid));
+        assert!(bad_cert.error.is_some());
+
+        let refused =
+            outcome("https://a.example.com", failed(WasiHttpErrorCode::ConnectionRefused), None);
+        assert_eq!(refused.tls, TlsStatus::Unknown);
+        // An error that merely mentions TLS is not a TLS failure
+        let other =
+            outcome("https://a.example.com", Err(anyhow::anyhow!("tls proxy said no")), None);
+        assert_eq!(other.tls, TlsStatus::Unknown);
+
+        let plain =
+            outcome("http://a.example.com", failed(WasiHttpErrorCode::TlsCertificateError), None);
+        assert_eq!(plain.tls, TlsStatus::None);
+    }
+
+    #[test]
+    fn report_counts_the_urls_up() {
+        let urls = ["https://a.example.com", "https://b.example.com", "https://c.example.com"]
+            .map(String::from);
+        let probes = vec![
+            outcome(&urls[0], status(200), None),
+            outcome(&urls[1], status(500), None),
+            outcome(&urls[2], status(204), None),
+        ];
+        let report = summarize(&urls, probes);
+        assert_eq!((report.up, report.availability_bps), (2, 6_666));
+        assert_eq!(
+            report.urls_hash,
+            keccak256("https://a.example.com\nhttps://b.example.com\nhttps://c.example.com")
+        );
+    }
+}
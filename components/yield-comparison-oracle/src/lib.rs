@@ -0,0 +1,449 @@
+mod protocols;
+mod trigger;
+use trigger::{decode_trigger_event, Destination, TriggerRequest};
+pub mod bindings;
+use crate::bindings::{export, host::get_eth_chain_config, Guest, TriggerAction};
+use alloy_primitives::Address;
+use alloy_sol_types::SolValue;
+use common::{
+    alloc_stats, canonical_json, config,
+    context::RunContext,
+    cost,
+    envelope::ComponentInfo,
+    evm,
+    fan_out::FanOut,
+    output::{self, Computed},
+    panic_guard,
+};
+use protocols::{Protocol, Quote};
+use serde::{Deserialize, Serialize};
+use wstd::runtime::block_on;
+
+/// Identifies results in the output envelope
+const COMPONENT: ComponentInfo = common::component_info!();
+
+/// Accepted `cmd`s of structured CLI requests
+const CLI_COMMANDS: &[&str] = &["rates"];
+
+/// Protocols compared, overridable with `yield_protocols`
+const DEFAULT_PROTOCOLS: &str = "aave,compound,morpho";
+
+/// Aave V3 pool on Ethereum mainnet, overridable with `aave_pool`
+const DEFAULT_AAVE_POOL: &str = "0x87870Bca3F3fD6335C3F4ce8392D69350B4fA4E2";
+
+/// Compound V3 USDC and WETH markets on Ethereum mainnet, overridable with
+/// `compound_comets`
+const DEFAULT_COMETS: &str =
+    "0xc3d688B66703497DAA19211EEdff47f25384cdc3,0xA17581A9E3356d9A858b789D68B4d866e593aE94";
+
+/// Overridable with `morpho_api_url`
+const DEFAULT_MORPHO_API_URL: &str = "https://blue-api.morpho.org/graphql";
+
+/// Smallest Morpho market considered, overridable with `morpho_min_supply_usd`
+const DEFAULT_MORPHO_MIN_SUPPLY_USD: f64 = 1_000_000.0;
+
+/// APYs are published in parts per million, so 4.1% is 41000
+const APY_SCALE: f64 = 1_000_000.0;
+
+struct Component;
+export!(Component with_types_in bindings);
+
+#[cfg(feature = "alloc-profiling")]
+#[global_allocator]
+static ALLOC: alloc_stats::CountingAlloc = alloc_stats::CountingAlloc;
+
+impl Guest for Component {
+    fn run(action: TriggerAction) -> std::result::Result<Option<Vec<u8>>, String> {
+        let _profile = alloc_stats::Profile::start();
+        let _cost = cost::Meter::start();
+        panic_guard::catch(|| handle(action))
+    }
+}
+
+fn handle(action: TriggerAction) -> Result<Option<Vec<u8>>, String> {
+    let TriggerRequest { trigger_id, data: req, destination: dest, block } =
+        decode_trigger_event(action.data).map_err(|e| e.to_string())?;
+
+    let input = std::str::from_utf8(&req).map_err(|e| e.to_string())?;
+    let assets = parse_assets(input.trim_end_matches('\0'))?;
+    println!("assets: {:?}", assets);
+
+    let config = YieldConfig::from_env().map_err(|e| e.to_string())?;
+    let chain_name = config::string_or("chain_name", "local");
+    let ctx = RunContext::from_trigger(block.as_ref()).map_err(|e| e.to_string())?;
+    let pinned = ctx.pinned_height(&chain_name);
+    let output = output::produce(&ctx, COMPONENT, trigger_id, dest, || {
+        let report = block_on(compare(&ctx, &config, &chain_name, pinned, &assets))?;
+        println!("report: {:?}", report);
+
+        let feed_id = format!("yield:{}", report.chain_id);
+        let payload = match dest {
+            Destination::Ethereum => {
+                let best = |rate: &Option<BestRate>| match rate {
+                    Some(rate) => (rate.protocol.to_string(), rate.market.clone(), rate.apy_ppm),
+                    None => (String::new(), String::new(), 0),
+                };
+                let payload = solidity::BestRates {
+                    chainId: report.chain_id,
+                    blockNumber: report.block_number,
+                    rates: report
+                        .assets
+                        .iter()
+                        .map(|a| {
+                            let (supply_protocol, supply_market, supply_ppm) = best(&a.best_supply);
+                            let (borrow_protocol, borrow_market, borrow_ppm) = best(&a.best_borrow);
+                            solidity::BestRate {
+                                asset: a.asset,
+                                supplyProtocol: supply_protocol,
+                                supplyMarket: supply_market,
+                                supplyApyPpm: supply_ppm,
+                                borrowProtocol: borrow_protocol,
+                                borrowMarket: borrow_market,
+                                borrowApyPpm: borrow_ppm,
+                            }
+                        })
+                        .collect(),
+                };
+                payload.abi_encode()
+            }
+            Destination::CliOutput => canonical_json::to_vec(&report).map_err(|e| e.to_string())?,
+        };
+        Ok(Computed::new(feed_id, payload))
+    })?;
+    Ok(Some(output))
+}
+
+/// Comma or whitespace separated token addresses, deduplicated
+fn parse_assets(input: &str) -> Result<Vec<Address>, String> {
+    let mut assets = input
+        .split(|c: char| c == ',' || c.is_whitespace())
+        .filter(|s| !s.is_empty())
+        .map(|s| s.parse().map_err(|e| format!("Invalid asset address {}: {}", s, e)))
+        .collect::<Result<Vec<Address>, String>>()?;
+    assets.sort();
+    assets.dedup();
+    if assets.is_empty() {
+        return Err("No assets given".to_string());
+    }
+    Ok(assets)
+}
+
+struct YieldConfig {
+    protocols: Vec<Protocol>,
+    aave_pool: Address,
+    comets: Vec<Address>,
+    morpho_api_url: String,
+    morpho_min_supply_usd: f64,
+}
+
+impl YieldConfig {
+    fn from_env() -> anyhow::Result<Self> {
+        let list = |key: &str, default: &str| {
+            config::list(key).unwrap_or_else(|| default.split(',').map(String::from).collect())
+        };
+        let mut protocols = list("yield_protocols", DEFAULT_PROTOCOLS)
+            .iter()
+            .map(|p| p.parse())
+            .collect::<anyhow::Result<Vec<Protocol>>>()?;
+        protocols.sort_by_key(|p| p.to_string());
+        protocols.dedup();
+        let comets = list("compound_comets", DEFAULT_COMETS)
+            .iter()
+            .map(|c| c.trim().parse().map_err(|e| anyhow::anyhow!("Invalid compound_comets: {e}")))
+            .collect::<anyhow::Result<Vec<Address>>>()?;
+        Ok(Self {
+            protocols,
+            aave_pool: config::parse_or("aave_pool", DEFAULT_AAVE_POOL.parse()?)?,
+            comets,
+            morpho_api_url: config::string_or("morpho_api_url", DEFAULT_MORPHO_API_URL),
+            morpho_min_supply_usd: config::parse_or(
+                "morpho_min_supply_usd",
+                DEFAULT_MORPHO_MIN_SUPPLY_USD,
+            )?,
+        })
+    }
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct MarketRates {
+    protocol: Protocol,
+    market: String,
+    /// Parts per million
+    supply_apy_ppm: u64,
+    borrow_apy_ppm: u64,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct BestRate {
+    protocol: Protocol,
+    market: String,
+    apy_ppm: u64,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct AssetRates {
+    asset: Address,
+    /// Highest supply APY
+    best_supply: Option<BestRate>,
+    /// Lowest non-zero borrow APY; zero means borrowing is disabled
+    best_borrow: Option<BestRate>,
+    /// Every market quoting the asset, by protocol then market
+    markets: Vec<MarketRates>,
+}
+
+#[derive(Debug, Serialize, Deserialize)]
+pub struct YieldReport {
+    chain_id: u64,
+    /// Block Aave and Compound were read at
+    block_number: u64,
+    assets: Vec<AssetRates>,
+}
+
+/// Reads every protocol's rates for `assets` and picks the best of each.
+/// Protocols that fail are logged and left out, as long as every asset keeps
+/// at least one market.
+async fn compare(
+    ctx: &RunContext,
+    config: &YieldConfig,
+    chain_name: &str,
+    pinned: Option<u64>,
+    assets: &[Address],
+) -> Result<YieldReport, String> {
+    let chain =
+        get_eth_chain_config(chain_name).ok_or_else(|| format!("Unknown chain {}", chain_name))?;
+    let chain_id: u64 = chain.chain_id.parse().map_err(|e| format!("Invalid chain id: {}", e))?;
+    let endpoint = chain
+        .http_endpoint
+        .ok_or_else(|| format!("No http endpoint configured for chain {}", chain_name))?;
+    let block_number = match pinned {
+        Some(height) => height,
+        None => {
+            let provider = evm::provider(&endpoint).map_err(|e| e.to_string())?;
+            evm::block_number(&provider).await.map_err(|e| e.to_string())?
+        }
+    };
+
+    let endpoint = endpoint.as_str();
+    let results = FanOut::from_env()
+        .map_err(|e| e.to_string())?
+        .try_join(
+            ctx,
+            config.protocols.iter().map(|&protocol| async move {
+                let quotes =
+                    read_protocol(config, protocol, endpoint, chain_id, block_number, assets).await;
+                anyhow::Ok((protocol, quotes))
+            }),
+        )
+        .await
+        .map_err(|e| e.to_string())?;
+    let mut quotes: Vec<Quote> = Vec::new();
+    for (protocol, result) in results {
+        match result {
+            Ok(found) => quotes.extend(found),
+            Err(e) => println!("{protocol} rates unavailable: {e:#}"),
+        }
+    }
+    let assets = best_rates(assets, &quotes)?;
+    Ok(YieldReport { chain_id, block_number, assets })
+}
+
+/// Each asset's markets in `quotes` and the best of them
+fn best_rates(assets: &[Address], quotes: &[Quote]) -> Result<Vec<AssetRates>, String> {
+    assets
+        .iter()
+        .map(|&asset| {
+            let mut markets: Vec<&Quote> = quotes.iter().filter(|q| q.asset == asset).collect();
+            if markets.is_empty() {
+                return Err(format!("No protocol has a market for {}", asset));
+            }
+            markets.sort_by(|a, b| {
+                a.protocol.to_string().cmp(&b.protocol.to_string()).then(a.market.cmp(&b.market))
+            });
+            let best_supply = markets
+                .iter()
+                .copied()
+                .reduce(|best, q| if q.supply_apy > best.supply_apy { q } else { best })
+                .map(|q| BestRate {
+                    protocol: q.protocol,
+                    market: q.market.clone(),
+                    apy_ppm: ppm(q.supply_apy),
+                });
+            let best_borrow = markets
+                .iter()
+                .copied()
+                .filter(|q| q.borrow_apy > 0.0)
+                .reduce(|best, q| if q.borrow_apy < best.borrow_apy { q } else { best })
+                .map(|q| BestRate {
+                    protocol: q.protocol,
+                    market: q.market.clone(),
+                    apy_ppm: ppm(q.borrow_apy),
+                });
+            Ok(AssetRates {
+                asset,
+                best_supply,
+                best_borrow,
+                markets: markets
+                    .iter()
+                    .map(|q| MarketRates {
+                        protocol: q.protocol,
+                        market: q.market.clone(),
+                        supply_apy_ppm: ppm(q.supply_apy),
+                        borrow_apy_ppm: ppm(q.borrow_apy),
+                    })
+                    .collect(),
+            })
+        })
+        .collect()
+}
+
+/// Every quote `protocol` has for `assets`
+async fn read_protocol(
+    config: &YieldConfig,
+    protocol: Protocol,
+    endpoint: &str,
+    chain_id: u64,
+    block_number: u64,
+    assets: &[Address],
+) -> anyhow::Result<Vec<Quote>> {
+    let mut quotes = Vec::new();
+    match protocol {
+        Protocol::Aave => {
+            for &asset in assets {
+                quotes.extend(
+                    protocols::aave(endpoint, config.aave_pool, asset, block_number).await?,
+                );
+            }
+        }
+        Protocol::Compound => {
+            for &comet in &config.comets {
+                let quote = protocols::compound(endpoint, comet, block_number).await?;
+                if assets.contains(&quote.asset) {
+                    quotes.push(quote);
+                }
+            }
+        }
+        Protocol::Morpho => {
+            quotes = protocols::morpho(
+                &config.morpho_api_url,
+                chain_id,
+                assets,
+                config.morpho_min_supply_usd,
+            )
+            .await?;
+        }
+    }
+    Ok(quotes)
+}
+
+fn ppm(apy: f64) -> u64 {
+    (apy.max(0.0) * APY_SCALE).round() as u64
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // APYs in parts per million, 41000 being 4.1%; a missing side has
+        // an empty protocol and a zero APY
+        struct BestRate {
+            address asset;
+            string supplyProtocol;
+            string supplyMarket;
+            uint64 supplyApyPpm;
+            string borrowProtocol;
+            string borrowMarket;
+            uint64 borrowApyPpm;
+        }
+
+        struct BestRates {
+            uint64 chainId;
+            uint64 blockNumber;
+            BestRate[] rates;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const USDC: &str = "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48";
+    const WETH: &str = "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2";
+
+    fn quote(asset: &str, protocol: Protocol, market: &str, supply: f64, borrow: f64) -> Quote {
+        Quote {
+            asset: asset.parse().unwrap(),
+            protocol,
+            market: market.into(),
+            supply_apy: supply,
+            borrow_apy: borrow,
+        }
+    }
+
+    fn best(rate: &Option<BestRate>) -> Option<(Protocol, &str, u64)> {
+        rate.as_ref().map(|r| (r.protocol, r.market.as_str(), r.apy_ppm))
+    }
+
+    #[test]
+    fn assets_parse() {
+        let assets = parse_assets(&format!("{WETH}, {USDC}\n{WETH}")).unwrap();
+        assert_eq!(assets, [USDC.parse::<Address>().unwrap(), WETH.parse().unwrap()]);
+        assert_eq!(parse_assets(" , ").unwrap_err(), "No assets given");
+        assert!(parse_assets("0x1234").unwrap_err().starts_with("Invalid asset address 0x1234"));
+    }
+
+    #[test]
+    fn best_supply_is_highest_and_best_borrow_lowest() {
+        let quotes = [
+            quote(USDC, Protocol::Morpho, "0x02", 0.061, 0.074),
+            quote(USDC, Protocol::Aave, "pool", 0.041, 0.0525),
+            quote(USDC, Protocol::Morpho, "0x01", 0.058, 0.0),
+            quote(USDC, Protocol::Compound, "comet", 0.052, 0.063),
+            quote(WETH, Protocol::Aave, "pool", 0.019, 0.027),
+        ];
+        let rates = best_rates(&[USDC.parse().unwrap()], &quotes).unwrap();
+        let usdc = &rates[0];
+        assert_eq!(best(&usdc.best_supply), Some((Protocol::Morpho, "0x02", 61_000)));
+        // Morpho 0x01 has borrowing disabled
+        assert_eq!(best(&usdc.best_borrow), Some((Protocol::Aave, "pool", 52_500)));
+        let markets: Vec<(Protocol, &str)> =
+            usdc.markets.iter().map(|m| (m.protocol, m.market.as_str())).collect();
+        assert_eq!(
+            markets,
+            [
+                (Protocol::Aave, "pool"),
+                (Protocol::Compound, "comet"),
+                (Protocol::Morpho, "0x01"),
+                (Protocol::Morpho, "0x02"),
+            ]
+        );
+    }
+
+    #[test]
+    fn ties_keep_the_first_market_and_no_borrow_is_none() {
+        let quotes = [
+            quote(WETH, Protocol::Morpho, "0x01", 0.02, 0.0),
+            quote(WETH, Protocol::Aave, "pool", 0.02, 0.0),
+        ];
+        let rates = best_rates(&[WETH.parse().unwrap()], &quotes).unwrap();
+        assert_eq!(best(&rates[0].best_supply), Some((Protocol::Aave, "pool", 20_000)));
+        assert!(rates[0].best_borrow.is_none());
+    }
+
+    #[test]
+    fn every_asset_needs_a_market() {
+        let quotes = [quote(USDC, Protocol::Aave, "pool", 0.041, 0.0525)];
+        let weth: Address = WETH.parse().unwrap();
+        assert_eq!(
+            best_rates(&[USDC.parse().unwrap(), weth], &quotes).unwrap_err(),
+            format!("No protocol has a market for {weth}")
+        );
+    }
+
+    #[test]
+    fn ppm_rounds_and_floors_at_zero() {
+        assert_eq!(ppm(0.0412344), 41_234);
+        assert_eq!(ppm(0.0412345), 41_235);
+        assert_eq!(ppm(-0.01), 0);
+    }
+}
@@ -0,0 +1,316 @@
+//! Lending protocols and how their current rates are read.
+//!
+//! - Aave V3: `getReserveData(asset)` on the `aave_pool` contract, whose
+//!   liquidity and variable borrow rates are per-year APRs in ray (1e27),
+//!   compounded every second.
+//! - Compound V3: each of the `compound_comets` lends one base asset; its
+//!   per-second supply and borrow rates at the current utilization (1e18)
+//!   are compounded every second.
+//! - Morpho Blue: markets lending the asset from the GraphQL API at
+//!   `morpho_api_url`, which already reports APYs. Markets holding less than
+//!   `morpho_min_supply_usd` are left out, since a nearly empty market can
+//!   quote any rate. The API is not pinned to the run's block, so these
+//!   quotes can differ slightly between operators.
+//!
+//! Aave and Compound are read with `eth_call` at the run's block.
+
+use alloy_primitives::Address;
+use anyhow::{anyhow, Context, Result};
+use common::{evm, http, proxy};
+use serde::{Deserialize, Serialize};
+use std::fmt;
+
+/// Compounding periods per year of the per-second rates, 365 days as both
+/// protocols count them
+const SECONDS_PER_YEAR: f64 = 31_536_000.0;
+
+const RAY: f64 = 1e27;
+const WAD: f64 = 1e18;
+
+const MORPHO_MARKETS: &str = r#"query($assets: [String!], $chains: [Int!]) {
+  markets(first: 1000, where: { loanAssetAddress_in: $assets, chainId_in: $chains }) {
+    items {
+      uniqueKey
+      loanAsset { address }
+      state { supplyApy borrowApy supplyAssetsUsd }
+    }
+  }
+}"#;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Protocol {
+    Aave,
+    Compound,
+    Morpho,
+}
+
+impl std::str::FromStr for Protocol {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self> {
+        match s.trim() {
+            "aave" => Ok(Self::Aave),
+            "compound" => Ok(Self::Compound),
+            "morpho" => Ok(Self::Morpho),
+            other => Err(anyhow!("unknown protocol {other}, expected aave, compound or morpho")),
+        }
+    }
+}
+
+impl fmt::Display for Protocol {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            Self::Aave => "aave",
+            Self::Compound => "compound",
+            Self::Morpho => "morpho",
+        })
+    }
+}
+
+/// One market's current rates for an asset
+#[derive(Debug, Clone, PartialEq)]
+pub struct Quote {
+    pub asset: Address,
+    pub protocol: Protocol,
+    /// The pool, comet or Morpho market id
+    pub market: String,
+    /// Fractions, e.g. `0.041`
+    pub supply_apy: f64,
+    pub borrow_apy: f64,
+}
+
+/// The asset's reserve on the Aave pool, `None` when it is not listed
+pub async fn aave(
+    endpoint: &str,
+    pool: Address,
+    asset: Address,
+    block: u64,
+) -> Result<Option<Quote>> {
+    let provider = evm::provider(endpoint)?;
+    let reserve =
+        evm::call(&provider, pool, &solidity::IAavePool::getReserveDataCall { asset }, Some(block))
+            .await?
+            ._0;
+    if reserve.aTokenAddress == Address::ZERO {
+        return Ok(None);
+    }
+    Ok(Some(Quote {
+        asset,
+        protocol: Protocol::Aave,
+        market: pool.to_string(),
+        supply_apy: per_second(reserve.currentLiquidityRate as f64 / RAY / SECONDS_PER_YEAR),
+        borrow_apy: per_second(reserve.currentVariableBorrowRate as f64 / RAY / SECONDS_PER_YEAR),
+    }))
+}
+
+/// The comet's base asset and its rates
+pub async fn compound(endpoint: &str, comet: Address, block: u64) -> Result<Quote> {
+    let provider = evm::provider(endpoint)?;
+    let asset =
+        evm::call(&provider, comet, &solidity::IComet::baseTokenCall {}, Some(block)).await?._0;
+    let utilization =
+        evm::call(&provider, comet, &solidity::IComet::getUtilizationCall {}, Some(block))
+            .await?
+            ._0;
+    let supply = evm::call(
+        &provider,
+        comet,
+        &solidity::IComet::getSupplyRateCall { utilization },
+        Some(block),
+    )
+    .await?
+    ._0;
+    let borrow = evm::call(
+        &provider,
+        comet,
+        &solidity::IComet::getBorrowRateCall { utilization },
+        Some(block),
+    )
+    .await?
+    ._0;
+    Ok(Quote {
+        asset,
+        protocol: Protocol::Compound,
+        market: comet.to_string(),
+        supply_apy: per_second(supply as f64 / WAD),
+        borrow_apy: per_second(borrow as f64 / WAD),
+    })
+}
+
+/// Morpho markets lending any of `assets` on `chain_id`
+pub async fn morpho(
+    api_url: &str,
+    chain_id: u64,
+    assets: &[Address],
+    min_supply_usd: f64,
+) -> Result<Vec<Quote>> {
+    let variables = serde_json::json!({
+        "assets": assets.iter().map(|a| a.to_string()).collect::<Vec<_>>(),
+        "chains": [chain_id],
+    });
+    let mut req = http::graphql(api_url, MORPHO_MARKETS, &variables)?;
+    proxy::apply(&mut req)?;
+    let data: MorphoMarkets =
+        http::send_graphql(req).await.context("morpho markets request failed")?;
+    data.quotes(min_supply_usd)
+}
+
+/// APY of a rate compounded every second
+fn per_second(rate: f64) -> f64 {
+    (1.0 + rate).powf(SECONDS_PER_YEAR) - 1.0
+}
+
+#[derive(Debug, Deserialize)]
+struct MorphoMarkets {
+    markets: MorphoPage,
+}
+
+impl MorphoMarkets {
+    /// Markets holding at least `min_supply_usd` that quote both rates
+    fn quotes(self, min_supply_usd: f64) -> Result<Vec<Quote>> {
+        let mut quotes = Vec::new();
+        for market in self.markets.items {
+            let Some(state) = market.state else { continue };
+            if state.supply_assets_usd.unwrap_or_default() < min_supply_usd {
+                continue;
+            }
+            let (Some(supply_apy), Some(borrow_apy)) = (state.supply_apy, state.borrow_apy) else {
+                continue;
+            };
+            quotes.push(Quote {
+                asset: market.loan_asset.address.parse().context("invalid loan asset address")?,
+                protocol: Protocol::Morpho,
+                market: market.unique_key,
+                supply_apy,
+                borrow_apy,
+            });
+        }
+        Ok(quotes)
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct MorphoPage {
+    items: Vec<MorphoMarket>,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct MorphoMarket {
+    unique_key: String,
+    loan_asset: MorphoAsset,
+    state: Option<MorphoState>,
+}
+
+#[derive(Debug, Deserialize)]
+struct MorphoAsset {
+    address: String,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct MorphoState {
+    supply_apy: Option<f64>,
+    borrow_apy: Option<f64>,
+    supply_assets_usd: Option<f64>,
+}
+
+mod solidity {
+    use alloy_sol_macro::sol;
+
+    sol! {
+        // Aave V3.0 `DataTypes.ReserveData`
+        struct ReserveData {
+            uint256 configuration;
+            uint128 liquidityIndex;
+            uint128 currentLiquidityRate;
+            uint128 variableBorrowIndex;
+            uint128 currentVariableBorrowRate;
+            uint128 currentStableBorrowRate;
+            uint40 lastUpdateTimestamp;
+            uint16 id;
+            address aTokenAddress;
+            address stableDebtTokenAddress;
+            address variableDebtTokenAddress;
+            address interestRateStrategyAddress;
+            uint128 accruedToTreasury;
+            uint128 unbacked;
+            uint128 isolationModeTotalDebt;
+        }
+
+        interface IAavePool {
+            function getReserveData(address asset) external view returns (ReserveData memory);
+        }
+
+        interface IComet {
+            function baseToken() external view returns (address);
+            function getUtilization() external view returns (uint256);
+            function getSupplyRate(uint256 utilization) external view returns (uint64);
+            function getBorrowRate(uint256 utilization) external view returns (uint64);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const USDC: &str = "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48";
+
+    #[test]
+    fn protocols_parse() {
+        assert_eq!(" morpho ".parse::<Protocol>().unwrap(), Protocol::Morpho);
+        assert_eq!(Protocol::Compound.to_string(), "compound");
+        assert_eq!(
+            "spark".parse::<Protocol>().unwrap_err().to_string(),
+            "unknown protocol spark, expected aave, compound or morpho"
+        );
+    }
+
+    #[test]
+    fn per_second_rates_compound_to_about_continuous() {
+        let apy = per_second(0.05 / SECONDS_PER_YEAR);
+        assert!((apy - (0.05f64.exp() - 1.0)).abs() < 1e-8, "{apy}");
+        assert_eq!(per_second(0.0), 0.0);
+    }
+
+    #[test]
+    fn small_and_incomplete_morpho_markets_are_left_out() {
+        let markets: MorphoMarkets = serde_json::from_str(&format!(
+            r#"{{"markets": {{"items": [
+                {{"uniqueKey": "0x01", "loanAsset": {{"address": "{USDC}"}},
+                  "state": {{"supplyApy": 0.061, "borrowApy": 0.074, "supplyAssetsUsd": 25000000.0}}}},
+                {{"uniqueKey": "0x02", "loanAsset": {{"address": "{USDC}"}},
+                  "state": {{"supplyApy": 0.9, "borrowApy": 1.2, "supplyAssetsUsd": 1500.0}}}},
+                {{"uniqueKey": "0x03", "loanAsset": {{"address": "{USDC}"}},
+                  "state": {{"supplyApy": null, "borrowApy": 0.05, "supplyAssetsUsd": 9000000.0}}}},
+                {{"uniqueKey": "0x04", "loanAsset": {{"address": "{USDC}"}}, "state": null}}
+            ]}}}}"#
+        ))
+        .unwrap();
+        assert_eq!(
+            markets.quotes(1_000_000.0).unwrap(),
+            [Quote {
+                asset: USDC.parse().unwrap(),
+                protocol: Protocol::Morpho,
+                market: "0x01".into(),
+                supply_apy: 0.061,
+                borrow_apy: 0.074,
+            }]
+        );
+    }
+
+    #[test]
+    fn malformed_morpho_assets_fail() {
+        let markets: MorphoMarkets = serde_json::from_str(
+            r#"{"markets": {"items": [{"uniqueKey": "0x01", "loanAsset": {"address": "usdc"},
+                "state": {"supplyApy": 0.061, "borrowApy": 0.074, "supplyAssetsUsd": 25000000.0}}]}}"#,
+        )
+        .unwrap();
+        assert_eq!(
+            markets.quotes(1_000_000.0).unwrap_err().to_string(),
+            "invalid loan asset address"
+        );
+    }
+}
@@ -0,0 +1,10 @@
+//! CID strings come straight from trigger input, so parsing must not panic.
+#![no_main]
+
+use libfuzzer_sys::fuzz_target;
+
+fuzz_target!(|data: &[u8]| {
+    if let Ok(input) = std::str::from_utf8(data) {
+        let _ = common::cid::Cid::parse(input);
+    }
+});
@@ -0,0 +1,57 @@
+//! Arbitrary logs must decode to an error, never a panic, as the events a
+//! `trigger_event` kv config can describe: indexed trigger fields, dynamic and
+//! nested types, and anonymous events.
+//!
+//! The first byte picks the event and the number of topics, each topic takes
+//! the next 32 bytes and the rest is the event data. For events with a topic0
+//! the real one is put first, so the fuzzer reaches the data decoding.
+//!
+//! Offsets of nested dynamic values may alias, so a small log can describe
+//! a huge value tree; `seeds/configured_event/aliased_offsets` is a 19 KB
+//! `Nested` log whose matrix claims 300 x 300 items. Decoding must stay
+//! within [`MAX_DECODE_TIME`] whatever the input.
+#![no_main]
+
+use common::trigger_event::EventDescriptor;
+use libfuzzer_sys::fuzz_target;
+use std::{
+    sync::OnceLock,
+    time::{Duration, Instant},
+};
+
+/// Far above what `abi::decode` needs for its value cap, far below what an
+/// unbounded decode of an aliased input takes
+const MAX_DECODE_TIME: Duration = Duration::from_secs(1);
+
+const EVENTS: &[&str] = &[
+    "event OrderPlaced(uint64 indexed triggerId, address indexed creator, string data, uint256 amount)",
+    "event Ping(uint32 triggerId, bytes data) anonymous",
+    "event Batch(uint256[] ids, (address,bool[2]) meta, uint64 indexed triggerId, bytes data)",
+    "event Nested(uint256[][] matrix, uint64 indexed triggerId, bytes data)",
+];
+
+fn events() -> &'static [EventDescriptor] {
+    static PARSED: OnceLock<Vec<EventDescriptor>> = OnceLock::new();
+    PARSED.get_or_init(|| EVENTS.iter().map(|e| EventDescriptor::parse(e).unwrap()).collect())
+}
+
+fuzz_target!(|input: &[u8]| {
+    let Some((&selector, mut rest)) = input.split_first() else {
+        return;
+    };
+    let event = &events()[selector as usize % EVENTS.len()];
+    let mut topics: Vec<Vec<u8>> = event.topic0().map(|t| t.to_vec()).into_iter().collect();
+    for _ in 0..(selector >> 4) % 4 {
+        let Some((topic, tail)) = rest.split_first_chunk::<32>() else {
+            break;
+        };
+        topics.push(topic.to_vec());
+        rest = tail;
+    }
+    let started = Instant::now();
+    if let Ok(trigger) = event.decode_log(&topics, rest) {
+        let _ = (trigger.format, trigger.trigger_id, trigger.creator, trigger.data);
+    }
+    let elapsed = started.elapsed();
+    assert!(elapsed < MAX_DECODE_TIME, "decoding {} bytes took {elapsed:?}", rest.len());
+});
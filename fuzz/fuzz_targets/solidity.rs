@@ -0,0 +1,4 @@
+use alloy_sol_macro::sol;
+pub use ITypes::*;
+
+sol!("../src/interfaces/ITypes.sol");
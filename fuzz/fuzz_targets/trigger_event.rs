@@ -0,0 +1,21 @@
+//! Arbitrary `NewTrigger` event data must decode to an error, never a panic,
+//! through `trigger_event::decode_log` as each component's `decode_trigger_event`
+//! calls it. No `trigger_event` is configured, so the layout detection of
+//! `trigger_compat` runs; configured events are fuzzed by `configured_event`.
+#![no_main]
+
+use alloy_sol_types::SolEvent;
+use common::{trigger_compat, trigger_event};
+use libfuzzer_sys::fuzz_target;
+
+#[path = "solidity.rs"]
+mod solidity;
+
+fuzz_target!(|data: &[u8]| {
+    let topics = vec![solidity::NewTrigger::SIGNATURE_HASH.to_vec()];
+    if let Ok(trigger) = trigger_event::decode_log(&topics, data) {
+        let _ = (trigger.format, trigger.trigger_id, trigger.creator, trigger.data);
+    }
+    // Payloads of every layout, without the event wrapper
+    let _ = trigger_compat::decode_payload(data);
+});
@@ -0,0 +1,19 @@
+//! `DataWithId` must round-trip: anything that decodes re-encodes to a value
+//! that decodes to the same struct.
+#![no_main]
+
+use alloy_sol_types::SolValue;
+use libfuzzer_sys::fuzz_target;
+
+#[path = "solidity.rs"]
+mod solidity;
+
+fuzz_target!(|data: &[u8]| {
+    let Ok(output) = solidity::DataWithId::abi_decode(data, false) else {
+        return;
+    };
+    let encoded = output.abi_encode();
+    let decoded = solidity::DataWithId::abi_decode(&encoded, true).expect("re-encoded output");
+    assert_eq!(decoded.triggerId, output.triggerId);
+    assert_eq!(decoded.data, output.data);
+});
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: MIT
+pragma solidity 0.8.22;
+
+import {Script} from "forge-std/Script.sol";
+import {ITypes} from "interfaces/ITypes.sol";
+
+/// @dev Regenerates test/fixtures/abi.json, only needed when ITypes changes.
+/// Run with `make abi-fixtures`.
+contract AbiFixtures is Script {
+    address internal constant _CREATOR = 0x7FA9385bE102ac3EAc297483Dd6233D62b3e1496;
+
+    function run() public {
+        string memory outputs = "data_with_id";
+        _dataWithId(outputs, "data1", 1, "data1");
+        _dataWithId(outputs, "empty", 0, "");
+        _dataWithId(
+            outputs,
+            "max_id",
+            type(uint64).max,
+            hex"abababababababababababababababababababababababababababababababababab"
+        );
+        outputs = _dataWithId(
+            outputs,
+            "price_feed",
+            42,
+            bytes('{"price":97234.51,"symbol":"BTC","timestamp":"2025-02-12T10:21:33.071Z"}')
+        );
+
+        string memory trigger = "data1";
+        vm.serializeUint(trigger, "triggerId", 1);
+        vm.serializeAddress(trigger, "creator", _CREATOR);
+        vm.serializeBytes(trigger, "data", "data1");
+        ITypes.TriggerInfo memory info =
+            ITypes.TriggerInfo({triggerId: ITypes.TriggerId.wrap(1), creator: _CREATOR, data: "data1"});
+        trigger = vm.serializeBytes(trigger, "encoded", abi.encode(abi.encode(info)));
+        string memory triggers = vm.serializeString("new_trigger", "data1", trigger);
+
+        string memory root = "root";
+        vm.serializeString(root, "data_with_id", outputs);
+        root = vm.serializeString(root, "new_trigger", triggers);
+        vm.writeJson(root, string.concat(vm.projectRoot(), "/test/fixtures/abi.json"));
+    }
+
+    function _dataWithId(
+        string memory outputs,
+        string memory name,
+        uint64 triggerId,
+        bytes memory data
+    ) internal returns (string memory) {
+        vm.serializeUint(name, "triggerId", triggerId);
+        vm.serializeBytes(name, "data", data);
+        ITypes.DataWithId memory output = ITypes.DataWithId({triggerId: ITypes.TriggerId.wrap(triggerId), data: data});
+        string memory entry = vm.serializeBytes(name, "encoded", abi.encode(output));
+        return vm.serializeString(outputs, name, entry);
+    }
+}
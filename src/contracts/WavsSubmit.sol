@@ -13,6 +13,9 @@ contract SimpleSubmit is ISimpleSubmit, IWavsServiceHandler {
     /// @notice Mapping of trigger signatures
     mapping(TriggerId _triggerId => bytes _signature) internal _signatures;
 
+    /// @notice Trigger ID of submissions whose data is an encoded TriggerBatch
+    TriggerId public constant BATCH_TRIGGER_ID = TriggerId.wrap(type(uint64).max);
+
     /// @notice Service manager instance
     IWavsServiceManager private _serviceManager;
 
@@ -30,9 +33,16 @@ contract SimpleSubmit is ISimpleSubmit, IWavsServiceHandler {
 
         DataWithId memory dataWithId = abi.decode(_data, (DataWithId));
 
-        _signatures[dataWithId.triggerId] = _signature;
-        _datas[dataWithId.triggerId] = dataWithId.data;
-        _validTriggers[dataWithId.triggerId] = true;
+        if (TriggerId.unwrap(dataWithId.triggerId) != TriggerId.unwrap(BATCH_TRIGGER_ID)) {
+            _store(dataWithId.triggerId, dataWithId.data, _signature);
+            return;
+        }
+
+        TriggerBatch memory batch = abi.decode(dataWithId.data, (TriggerBatch));
+        if (batch.triggerIds.length != batch.results.length) revert InvalidBatch();
+        for (uint256 _i; _i < batch.triggerIds.length; ++_i) {
+            _store(batch.triggerIds[_i], batch.results[_i], _signature);
+        }
     }
 
     /// @inheritdoc ISimpleSubmit
@@ -49,4 +59,16 @@ contract SimpleSubmit is ISimpleSubmit, IWavsServiceHandler {
     function getData(TriggerId _triggerId) external view returns (bytes memory _data) {
         _data = _datas[_triggerId];
     }
+
+    /**
+     * @notice Record the result of a trigger
+     * @param _triggerId The identifier of the trigger
+     * @param _data The result
+     * @param _signature The signature of the submission that carried it
+     */
+    function _store(TriggerId _triggerId, bytes memory _data, bytes calldata _signature) internal {
+        _signatures[_triggerId] = _signature;
+        _datas[_triggerId] = _data;
+        _validTriggers[_triggerId] = true;
+    }
 }
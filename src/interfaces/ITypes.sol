@@ -24,6 +24,78 @@ interface ITypes {
         bytes data;
     }
 
+    /**
+     * @notice Results of several triggers submitted together, as the data of a DataWithId whose triggerId is type(uint64).max
+     * @param triggerIds The triggers, in ascending order
+     * @param results The data each trigger would have submitted on its own
+     */
+    struct TriggerBatch {
+        TriggerId[] triggerIds;
+        bytes[] results;
+    }
+
+    /**
+     * @notice Result signed by the operator that computed it
+     * @param data The component result
+     * @param signer Address of the operator key
+     * @param signature Signature of keccak256(abi.encodePacked(block.chainid, address(this), triggerId, data))
+     *        as an eth_sign message, where address(this) is the submit contract
+     */
+    struct SignedResult {
+        bytes data;
+        address signer;
+        bytes signature;
+    }
+
+    /**
+     * @notice Result signed with the operator's BLS12-381 key, for aggregation off-chain
+     * @param data The component result
+     * @param publicKey Compressed G1 public key of the operator (48 bytes)
+     * @param signature Compressed G2 signature of the SignedResult hash, chain ID and submit contract
+     *        included (96 bytes)
+     */
+    struct BlsSignedResult {
+        bytes data;
+        bytes publicKey;
+        bytes signature;
+    }
+
+    /**
+     * @notice Versioned wrapper around a component result
+     * @param schemaVersion Envelope layout version, currently 1
+     * @param component Name of the component that produced the result
+     * @param componentVersion Version of that component
+     * @param feedId What the result is about, e.g. "price:1"
+     * @param flags Bit set describing the payload (1: size limited, 2: EIP-712 typed data, 4: market closed, 8: ABI struct, 16: experimental mode)
+     * @param commitmentHash Hash used for the commitment (0: keccak256, 1: Poseidon)
+     * @param commitment Hash of the payload
+     * @param payload The component result
+     */
+    struct ResultEnvelope {
+        uint16 schemaVersion;
+        string component;
+        string componentVersion;
+        string feedId;
+        uint32 flags;
+        uint8 commitmentHash;
+        bytes32 commitment;
+        bytes payload;
+    }
+
+    /**
+     * @notice Price reported by the price oracle with payload version 2
+     * @param symbol Asset symbol, e.g. "BTC"
+     * @param price Price in USD, fixed-point with `decimals`
+     * @param decimals Decimals of `price`
+     * @param timestamp Provider time of the price, in unix seconds
+     */
+    struct PriceFeed {
+        string symbol;
+        uint256 price;
+        uint8 decimals;
+        uint64 timestamp;
+    }
+
     /**
      * @notice Event emitted when a new trigger is created
      * @param _triggerInfo Encoded TriggerInfo struct
@@ -4,6 +4,14 @@ pragma solidity 0.8.22;
 import {ITypes} from "interfaces/ITypes.sol";
 
 interface ISimpleSubmit is ITypes {
+    /*///////////////////////////////////////////////////////////////
+                                ERRORS
+    //////////////////////////////////////////////////////////////*/
+    /**
+     * @notice Thrown when a TriggerBatch has a different number of trigger IDs and results
+     */
+    error InvalidBatch();
+
     /*///////////////////////////////////////////////////////////////
                             VIEW FUNCTIONS
     //////////////////////////////////////////////////////////////*/
@@ -17,7 +25,7 @@ interface ISimpleSubmit is ITypes {
     /**
      * @notice Get the signature for a triggerId
      * @param _triggerId The identifier of the trigger
-     * @return _signature The signature associated with the trigger
+     * @return _signature The signature associated with the trigger, that of the whole batch for batched results
      */
     function getSignature(TriggerId _triggerId) external view returns (bytes memory _signature);
 
@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: MIT
+pragma solidity 0.8.22;
+
+import {Test} from "forge-std/Test.sol";
+import {Vm} from "forge-std/Vm.sol";
+import {SimpleTrigger} from "contracts/WavsTrigger.sol";
+import {ITypes} from "interfaces/ITypes.sol";
+
+/// @dev Pins the ABI bytes in test/fixtures/abi.json, which the component
+/// encoders are checked against in components/common/tests/golden_abi.rs
+contract AbiGoldenTest is Test {
+    string internal _fixtures;
+
+    function setUp() public {
+        _fixtures = vm.readFile(string.concat(vm.projectRoot(), "/test/fixtures/abi.json"));
+    }
+
+    function testDataWithIdGolden() public view {
+        string[4] memory cases = ["data1", "empty", "max_id", "price_feed"];
+        for (uint256 i = 0; i < cases.length; i++) {
+            string memory key = string.concat(".data_with_id.", cases[i]);
+            ITypes.DataWithId memory output = ITypes.DataWithId({
+                triggerId: ITypes.TriggerId.wrap(uint64(vm.parseJsonUint(_fixtures, string.concat(key, ".triggerId")))),
+                data: vm.parseJsonBytes(_fixtures, string.concat(key, ".data"))
+            });
+            assertEq(abi.encode(output), vm.parseJsonBytes(_fixtures, string.concat(key, ".encoded")), cases[i]);
+        }
+    }
+
+    function testNewTriggerGolden() public {
+        SimpleTrigger simpleTrigger = new SimpleTrigger();
+        string memory key = ".new_trigger.data1";
+
+        vm.recordLogs();
+        vm.prank(vm.parseJsonAddress(_fixtures, string.concat(key, ".creator")));
+        simpleTrigger.addTrigger(vm.parseJsonBytes(_fixtures, string.concat(key, ".data")));
+        Vm.Log[] memory logs = vm.getRecordedLogs();
+
+        assertEq(logs.length, 1);
+        assertEq(logs[0].topics[0], ITypes.NewTrigger.selector);
+        assertEq(logs[0].data, vm.parseJsonBytes(_fixtures, string.concat(key, ".encoded")));
+    }
+}
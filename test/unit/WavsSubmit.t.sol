@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: MIT
+pragma solidity 0.8.22;
+
+import {Test} from "forge-std/Test.sol";
+import {IWavsServiceManager} from "@wavs/interfaces/IWavsServiceManager.sol";
+import {SimpleSubmit} from "contracts/WavsSubmit.sol";
+import {ISimpleSubmit} from "interfaces/IWavsSubmit.sol";
+import {ITypes} from "interfaces/ITypes.sol";
+
+contract SubmitTest is Test {
+    SimpleSubmit public simpleSubmit;
+
+    function setUp() public {
+        // Any signature validates
+        address serviceManager = makeAddr("serviceManager");
+        vm.etch(serviceManager, hex"00");
+        vm.mockCall(serviceManager, abi.encodeWithSelector(IWavsServiceManager.validate.selector), "");
+        simpleSubmit = new SimpleSubmit(IWavsServiceManager(serviceManager));
+    }
+
+    function testSingleResult() public {
+        ITypes.TriggerId triggerId = ITypes.TriggerId.wrap(1);
+        simpleSubmit.handleSignedData(abi.encode(ITypes.DataWithId(triggerId, "result1")), "signature");
+
+        assertTrue(simpleSubmit.isValidTriggerId(triggerId));
+        assertEq(simpleSubmit.getData(triggerId), "result1");
+        assertEq(simpleSubmit.getSignature(triggerId), "signature");
+    }
+
+    function testBatchStoresEveryResult() public {
+        ITypes.TriggerId[] memory triggerIds = new ITypes.TriggerId[](2);
+        triggerIds[0] = ITypes.TriggerId.wrap(3);
+        triggerIds[1] = ITypes.TriggerId.wrap(7);
+        bytes[] memory results = new bytes[](2);
+        results[0] = "result3";
+        results[1] = "result7";
+        bytes memory batch = abi.encode(ITypes.TriggerBatch(triggerIds, results));
+
+        simpleSubmit.handleSignedData(
+            abi.encode(ITypes.DataWithId(simpleSubmit.BATCH_TRIGGER_ID(), batch)), "signature"
+        );
+
+        for (uint256 i = 0; i < triggerIds.length; i++) {
+            assertTrue(simpleSubmit.isValidTriggerId(triggerIds[i]));
+            assertEq(simpleSubmit.getData(triggerIds[i]), results[i]);
+            assertEq(simpleSubmit.getSignature(triggerIds[i]), "signature");
+        }
+        assertFalse(simpleSubmit.isValidTriggerId(simpleSubmit.BATCH_TRIGGER_ID()));
+    }
+
+    function testBatchLengthMismatchReverts() public {
+        ITypes.TriggerId[] memory triggerIds = new ITypes.TriggerId[](2);
+        bytes[] memory results = new bytes[](1);
+        bytes memory batch = abi.encode(ITypes.TriggerBatch(triggerIds, results));
+
+        vm.expectRevert(ISimpleSubmit.InvalidBatch.selector);
+        simpleSubmit.handleSignedData(abi.encode(ITypes.DataWithId(simpleSubmit.BATCH_TRIGGER_ID(), batch)), "");
+    }
+}
@@ -0,0 +1,78 @@
+#!/bin/bash
+# Regenerates `src/bindings.rs` of every component from the WIT world pinned
+# in its Cargo.toml and type-checks the component against it, so a binding
+# upgrade is one command. The bindings are generated, never edited, and must
+# come out identical in every component.
+#
+# Usage: tools/bindings.sh [--check]
+#   --check  leave the committed bindings in place and fail if regenerating
+#            them would change anything (for CI)
+
+set -e
+
+CHECK=false
+if [ "$1" = "--check" ]; then
+    CHECK=true
+elif [ -n "$1" ]; then
+    echo "Usage: $0 [--check]"
+    exit 1
+fi
+
+ROOT=$(cd "$(dirname "$0")/.." && pwd)
+cd "$ROOT"
+COMPONENTS=$(ls components | grep -v '^common$')
+
+# Every component targets the same world
+WORLDS=$(grep -h '^target = ' components/*/Cargo.toml tools/component-template/Cargo.toml.tmpl | sort -u)
+if [ "$(echo "$WORLDS" | wc -l)" -ne 1 ]; then
+    echo "Components target different WIT worlds:"
+    echo "$WORLDS"
+    exit 1
+fi
+WORLD=$(echo "$WORLDS" | sed -E 's/target = "(.*)"/\1/')
+VERSION=${WORLD##*@}
+echo "WIT world: $WORLD"
+
+# The simulator's host-side copy of the world has to match
+if ! grep -q "^package wavs:worker@$VERSION;" tools/simulate/wit/world.wit; then
+    echo "tools/simulate/wit/world.wit is not wavs:worker@$VERSION"
+    exit 1
+fi
+
+BACKUP=$(mktemp -d)
+trap 'rm -rf "$BACKUP"' EXIT
+
+for component in $COMPONENTS; do
+    echo "Generating bindings: $component"
+    mkdir -p "$BACKUP/$component"
+    mv "components/$component/src/bindings.rs" "$BACKUP/$component/" 2>/dev/null || true
+    # Generates the bindings and checks the exports against them
+    (cd "components/$component" && cargo component check --quiet)
+    rustfmt --edition 2021 --config-path rustfmt.toml "components/$component/src/bindings.rs"
+done
+
+FAILED=false
+REFERENCE=""
+for component in $COMPONENTS; do
+    bindings="components/$component/src/bindings.rs"
+    if [ -z "$REFERENCE" ]; then
+        REFERENCE=$bindings
+    elif ! cmp -s "$REFERENCE" "$bindings"; then
+        echo "$bindings differs from $REFERENCE"
+        FAILED=true
+    fi
+    if $CHECK; then
+        if ! cmp -s "$BACKUP/$component/bindings.rs" "$bindings"; then
+            echo "$bindings is out of date, run make bindings"
+            FAILED=true
+        fi
+        if [ -f "$BACKUP/$component/bindings.rs" ]; then
+            mv "$BACKUP/$component/bindings.rs" "$bindings"
+        fi
+    fi
+done
+
+if $FAILED; then
+    exit 1
+fi
+echo "Bindings of $(echo "$COMPONENTS" | wc -w) components are up to date"
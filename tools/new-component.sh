@@ -0,0 +1,60 @@
+#!/bin/bash
+# Creates a new component from tools/component-template: the crate manifest,
+# a lib.rs fetching JSON from one data source through `common::mirrors`, the
+# shared trigger and bindings modules, and simulator recordings for the
+# source so the component runs with `make simulate` before it is deployed.
+#
+# Usage: tools/new-component.sh <name> <source> <source-url>
+#   e.g. tools/new-component.sh weather-oracle openmeteo https://api.open-meteo.com
+
+set -e
+
+NAME=$1
+SOURCE=$2
+SOURCE_URL=${3%/}
+
+if [ -z "$NAME" ] || [ -z "$SOURCE" ] || [ -z "$SOURCE_URL" ]; then
+    echo "Usage: $0 <name> <source> <source-url>"
+    exit 1
+fi
+if ! [[ "$NAME" =~ ^[a-z][a-z0-9-]*$ ]]; then
+    echo "Component name must be lowercase kebab-case, got $NAME"
+    exit 1
+fi
+# The source names kv config keys such as `<source>_base_urls`
+if ! [[ "$SOURCE" =~ ^[a-z][a-z0-9_]*$ ]]; then
+    echo "Source must be lowercase snake_case, got $SOURCE"
+    exit 1
+fi
+if ! [[ "$SOURCE_URL" =~ ^https?:// ]]; then
+    echo "Source URL must be http(s), got $SOURCE_URL"
+    exit 1
+fi
+
+ROOT=$(cd "$(dirname "$0")/.." && pwd)
+TEMPLATE="$ROOT/tools/component-template"
+DIR="$ROOT/components/$NAME"
+# trigger.rs and the generated bindings are identical in every component
+REFERENCE="$ROOT/components/eth-price-oracle"
+
+if [ -e "$DIR" ]; then
+    echo "$DIR already exists"
+    exit 1
+fi
+
+render() {
+    sed -e "s|{{name}}|$NAME|g" -e "s|{{source}}|$SOURCE|g" -e "s|{{source_url}}|$SOURCE_URL|g" "$1" > "$2"
+}
+
+mkdir -p "$DIR/src"
+render "$TEMPLATE/Cargo.toml.tmpl" "$DIR/Cargo.toml"
+render "$TEMPLATE/src/lib.rs.tmpl" "$DIR/src/lib.rs"
+render "$TEMPLATE/recordings.json.tmpl" "$DIR/recordings.json"
+cp "$REFERENCE/src/trigger.rs" "$REFERENCE/src/bindings.rs" "$DIR/src/"
+
+WASM=$(echo "$NAME" | tr '-' '_').wasm
+echo "Created $DIR"
+echo
+echo "Build and run it against the recorded $SOURCE responses:"
+echo "  make wasi-build"
+echo "  make simulate COMPONENT_FILENAME=$WASM COIN_MARKET_CAP_ID=status RECORDINGS=components/$NAME/recordings.json"
@@ -0,0 +1,104 @@
+//! Outgoing HTTP for the simulated component, answered from recordings.
+//!
+//! A recordings file maps full request URLs to responses:
+//!
+//! ```json
+//! { "https://api.example.com/price?id=1": { "status": 200, "body": { "price": 1.0 } } }
+//! ```
+//!
+//! A string `body` is served as-is, anything else as JSON.
+
+use crate::State;
+use anyhow::{Context, Result};
+use bytes::Bytes;
+use http_body_util::{BodyExt, Full};
+use serde::Deserialize;
+use std::{collections::HashMap, path::Path};
+use wasmtime::component::ResourceTable;
+use wasmtime_wasi_http::{
+    bindings::http::types::ErrorCode,
+    body::HyperOutgoingBody,
+    types::{
+        default_send_request, HostFutureIncomingResponse, IncomingResponse, OutgoingRequestConfig,
+    },
+    HttpResult, WasiHttpCtx, WasiHttpView,
+};
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct Recorded {
+    #[serde(default = "default_status")]
+    pub status: u16,
+    #[serde(default)]
+    pub headers: HashMap<String, String>,
+    pub body: serde_json::Value,
+}
+
+fn default_status() -> u16 {
+    200
+}
+
+#[derive(Debug, Default)]
+pub struct Recordings(HashMap<String, Recorded>);
+
+impl Recordings {
+    pub fn load(path: &Path) -> Result<Self> {
+        let json = std::fs::read(path).with_context(|| format!("reading {}", path.display()))?;
+        Ok(Self(serde_json::from_slice(&json).context("invalid recordings file")?))
+    }
+
+    fn get(&self, url: &str) -> Option<&Recorded> {
+        self.0.get(url)
+    }
+}
+
+impl Recorded {
+    fn into_response(self) -> Result<hyper::Response<wasmtime_wasi_http::body::HyperIncomingBody>> {
+        let body = match self.body {
+            serde_json::Value::String(text) => text.into_bytes(),
+            value => serde_json::to_vec(&value)?,
+        };
+        let mut response = hyper::Response::builder().status(self.status);
+        for (name, value) in &self.headers {
+            response = response.header(name, value);
+        }
+        let body = Full::new(Bytes::from(body)).map_err(|never| match never {}).boxed();
+        Ok(response.body(body)?)
+    }
+}
+
+impl WasiHttpView for State {
+    fn ctx(&mut self) -> &mut WasiHttpCtx {
+        &mut self.http
+    }
+
+    fn table(&mut self) -> &mut ResourceTable {
+        &mut self.table
+    }
+
+    fn send_request(
+        &mut self,
+        request: hyper::Request<HyperOutgoingBody>,
+        config: OutgoingRequestConfig,
+    ) -> HttpResult<HostFutureIncomingResponse> {
+        let url = request.uri().to_string();
+        if let Some(recorded) = self.recordings.get(&url).cloned() {
+            eprintln!("[http] {} {url} -> {} (recorded)", request.method(), recorded.status);
+            let response = recorded.into_response().map(|resp| {
+                Ok(IncomingResponse {
+                    resp,
+                    worker: None,
+                    between_bytes_timeout: config.between_bytes_timeout,
+                })
+            });
+            return Ok(HostFutureIncomingResponse::ready(response));
+        }
+
+        if self.passthrough {
+            eprintln!("[http] {} {url} (passthrough)", request.method());
+            return Ok(default_send_request(request, config));
+        }
+
+        eprintln!("[http] {} {url} -> denied, no recording (use --passthrough)", request.method());
+        Ok(HostFutureIncomingResponse::ready(Ok(Err(ErrorCode::HttpRequestDenied))))
+    }
+}
@@ -0,0 +1,286 @@
+//! Runs a built component against a synthetic trigger, without a WAVS node.
+//!
+//! The trigger is delivered either as raw data (what `wavs-cli exec` does) or
+//! as a `NewTrigger` event log (what an on-chain trigger produces). HTTP
+//! requests are answered from a recordings file; host chain configs come from
+//! `--chain` flags.
+
+mod http;
+
+use alloy_primitives::{hex, Address};
+use alloy_sol_types::{SolEvent, SolValue};
+use anyhow::{anyhow, bail, Context, Result};
+use clap::Parser;
+use std::{collections::HashMap, path::PathBuf};
+use wasmtime::{
+    component::{Component, Linker, ResourceTable},
+    Config, Engine, Store,
+};
+use wasmtime_wasi::{WasiCtx, WasiCtxBuilder, WasiView};
+use wasmtime_wasi_http::{WasiHttpCtx, WasiHttpView};
+
+wasmtime::component::bindgen!({
+    path: "wit",
+    world: "layer-trigger-world",
+});
+
+use wavs::worker::layer_types::{
+    CosmosChainConfig, EthAddress, EthChainConfig, EthEventLogData, LogLevel, TriggerAction,
+    TriggerConfig, TriggerData, TriggerDataEthContractEvent, TriggerSource,
+    TriggerSourceEthContractEvent,
+};
+
+mod solidity {
+    use alloy_sol_macro::sol;
+    pub use ITypes::*;
+
+    sol!("../../src/interfaces/ITypes.sol");
+}
+
+#[derive(Parser)]
+#[command(about = "Run a WAVS component locally against a synthetic trigger")]
+struct Args {
+    /// Built component, e.g. compiled/eth_price_oracle.wasm
+    component: PathBuf,
+
+    /// Trigger input as text
+    #[arg(long, conflicts_with = "input_hex")]
+    input: Option<String>,
+
+    /// Trigger input as 0x-prefixed hex
+    #[arg(long)]
+    input_hex: Option<String>,
+
+    /// Right-pad the input to 32 bytes, like `cast format-bytes32-string`
+    #[arg(long)]
+    bytes32: bool,
+
+    /// Deliver the input as a `NewTrigger` event log instead of raw data
+    #[arg(long)]
+    event: bool,
+
+    /// Trigger ID of the synthetic event
+    #[arg(long, default_value_t = 1)]
+    trigger_id: u64,
+
+    /// Creator of the synthetic event
+    #[arg(long, default_value_t = Address::ZERO)]
+    creator: Address,
+
+    /// Contract emitting the synthetic event; defaults to the first
+    /// `trigger_contract` given with `--kv`, so the emitter check passes, and
+    /// to the zero address without one
+    #[arg(long)]
+    contract: Option<Address>,
+
+    /// Chain the synthetic event is emitted on
+    #[arg(long, default_value = "local")]
+    chain_name: String,
+
+    /// Chain config served to the component, as `name=chain_id@http_endpoint`
+    #[arg(long = "chain", value_parser = parse_chain, default_value = "local=31337@http://localhost:8545")]
+    chains: Vec<(String, EthChainConfig)>,
+
+    /// Service `kv` config entry, as `key=value`
+    #[arg(long = "kv", value_parser = parse_key_val)]
+    kv: Vec<(String, String)>,
+
+    /// JSON file of recorded HTTP responses keyed by URL
+    #[arg(long)]
+    recordings: Option<PathBuf>,
+
+    /// Send requests without a recording to the real upstream
+    #[arg(long)]
+    passthrough: bool,
+
+    /// Fuel limit, matching `fuel_limit` in the service config
+    #[arg(long, default_value_t = 100_000_000)]
+    fuel: u64,
+}
+
+struct State {
+    wasi: WasiCtx,
+    http: WasiHttpCtx,
+    table: ResourceTable,
+    chains: HashMap<String, EthChainConfig>,
+    recordings: http::Recordings,
+    passthrough: bool,
+}
+
+impl WasiView for State {
+    fn table(&mut self) -> &mut ResourceTable {
+        &mut self.table
+    }
+
+    fn ctx(&mut self) -> &mut WasiCtx {
+        &mut self.wasi
+    }
+}
+
+impl wavs::worker::layer_types::Host for State {}
+
+impl host::Host for State {
+    fn get_eth_chain_config(&mut self, chain_name: String) -> Option<EthChainConfig> {
+        self.chains.get(&chain_name).cloned()
+    }
+
+    fn get_cosmos_chain_config(&mut self, _chain_name: String) -> Option<CosmosChainConfig> {
+        None
+    }
+
+    fn log(&mut self, level: LogLevel, message: String) {
+        eprintln!("[{level:?}] {message}");
+    }
+}
+
+fn main() -> Result<()> {
+    let args = Args::parse();
+
+    let mut config = Config::new();
+    config.wasm_component_model(true).consume_fuel(true);
+    let engine = Engine::new(&config)?;
+    let component = Component::from_file(&engine, &args.component)
+        .with_context(|| format!("loading {}", args.component.display()))?;
+
+    let mut linker = Linker::<State>::new(&engine);
+    wasmtime_wasi::add_to_linker_sync(&mut linker)?;
+    wasmtime_wasi_http::add_only_http_to_linker_sync(&mut linker)?;
+    LayerTriggerWorld::add_to_linker(&mut linker, |state: &mut State| state)?;
+
+    // Like WAVS: kv entries become env vars, and WAVS_ENV_* host envs pass through
+    let mut wasi = WasiCtxBuilder::new();
+    wasi.inherit_stdout().inherit_stderr();
+    for (key, value) in std::env::vars().filter(|(key, _)| key.starts_with("WAVS_ENV_")) {
+        wasi.env(key, value);
+    }
+    for (key, value) in &args.kv {
+        wasi.env(key, value);
+    }
+
+    let recordings = match &args.recordings {
+        Some(path) => http::Recordings::load(path)?,
+        None => http::Recordings::default(),
+    };
+    let state = State {
+        wasi: wasi.build(),
+        http: WasiHttpCtx::new(),
+        table: ResourceTable::new(),
+        chains: args.chains.iter().cloned().collect(),
+        recordings,
+        passthrough: args.passthrough,
+    };
+    let mut store = Store::new(&engine, state);
+    store.set_fuel(args.fuel)?;
+
+    let input = input_bytes(&args)?;
+    let action = trigger_action(&args, input)?;
+
+    let world = LayerTriggerWorld::instantiate(&mut store, &component, &linker)?;
+    let result = world.call_run(&mut store, &action)?;
+    let fuel_used = args.fuel - store.get_fuel()?;
+    eprintln!("fuel used: {fuel_used}");
+
+    match result {
+        Ok(Some(output)) if args.event => {
+            let output = solidity::DataWithId::abi_decode(&output, true)
+                .context("output is not an ABI-encoded DataWithId")?;
+            println!("trigger id: {}", output.triggerId);
+            println!("data: {}", display_bytes(&output.data));
+        }
+        Ok(Some(output)) => println!("{}", display_bytes(&output)),
+        Ok(None) => println!("(no output)"),
+        Err(err) => bail!("component error: {err}"),
+    }
+    Ok(())
+}
+
+fn input_bytes(args: &Args) -> Result<Vec<u8>> {
+    let mut input = match (&args.input, &args.input_hex) {
+        (Some(text), _) => text.as_bytes().to_vec(),
+        (None, Some(hex)) => hex::decode(hex).context("invalid --input-hex")?,
+        (None, None) => bail!("one of --input or --input-hex is required"),
+    };
+    if args.bytes32 {
+        if input.len() > 32 {
+            bail!("input is longer than 32 bytes");
+        }
+        input.resize(32, 0);
+    }
+    Ok(input)
+}
+
+fn trigger_action(args: &Args, input: Vec<u8>) -> Result<TriggerAction> {
+    let contract_address = EthAddress { raw_bytes: trigger_contract(args)?.to_vec() };
+    let event_hash = solidity::NewTrigger::SIGNATURE_HASH.to_vec();
+
+    let data = if args.event {
+        let info = solidity::TriggerInfo {
+            triggerId: args.trigger_id,
+            creator: args.creator,
+            data: input.into(),
+        };
+        let event = solidity::NewTrigger { _triggerInfo: info.abi_encode().into() };
+        TriggerData::EthContractEvent(TriggerDataEthContractEvent {
+            contract_address: contract_address.clone(),
+            chain_name: args.chain_name.clone(),
+            log: EthEventLogData { topics: vec![event_hash.clone()], data: event.encode_data() },
+            block_height: 1,
+        })
+    } else {
+        TriggerData::Raw(input)
+    };
+
+    Ok(TriggerAction {
+        config: TriggerConfig {
+            service_id: "simulate".to_string(),
+            workflow_id: "default".to_string(),
+            trigger_source: TriggerSource::EthContractEvent(TriggerSourceEthContractEvent {
+                address: contract_address,
+                chain_name: args.chain_name.clone(),
+                event_hash,
+            }),
+        },
+        data,
+    })
+}
+
+/// `--contract`, else the first `trigger_contract` kv entry (the last one
+/// given wins, as for the env var)
+fn trigger_contract(args: &Args) -> Result<Address> {
+    if let Some(contract) = args.contract {
+        return Ok(contract);
+    }
+    match args.kv.iter().rev().find(|(key, _)| key == "trigger_contract") {
+        Some((_, contracts)) => {
+            let first = contracts.split(',').next().unwrap_or_default().trim();
+            first.parse().with_context(|| format!("invalid trigger_contract {first}"))
+        }
+        None => Ok(Address::ZERO),
+    }
+}
+
+/// Prints UTF-8 output as text and anything else as hex
+fn display_bytes(bytes: &[u8]) -> String {
+    match std::str::from_utf8(bytes) {
+        Ok(text) => text.to_string(),
+        Err(_) => hex::encode_prefixed(bytes),
+    }
+}
+
+fn parse_key_val(s: &str) -> Result<(String, String)> {
+    let (key, value) = s.split_once('=').ok_or_else(|| anyhow!("expected key=value: {s}"))?;
+    Ok((key.to_string(), value.to_string()))
+}
+
+fn parse_chain(s: &str) -> Result<(String, EthChainConfig)> {
+    let (name, config) = parse_key_val(s)?;
+    let (chain_id, http_endpoint) = config
+        .split_once('@')
+        .ok_or_else(|| anyhow!("expected name=chain_id@http_endpoint: {s}"))?;
+    let config = EthChainConfig {
+        chain_id: chain_id.to_string(),
+        ws_endpoint: None,
+        http_endpoint: Some(http_endpoint.to_string()),
+    };
+    Ok((name, config))
+}
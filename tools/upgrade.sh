@@ -33,8 +33,8 @@ sed -E -i "s/ghcr.io\/lay3rlabs\/wavs:[^\"]+/ghcr.io\/lay3rlabs\/wavs:${VERSION}
 sed -E -i "s/wavs-wasi-chain = \"[^\"]+/wavs-wasi-chain = \"${VERSION}/g" Cargo.toml
 
 # Update [package.metadata.component] in components/*/Cargo.toml (for wit)
-sed -E -i "s/wavs:worker\/layer-trigger-world@[^\"]+/wavs:worker\/layer-trigger-world@${VERSION}/g" components/*/Cargo.toml
+sed -E -i "s/wavs:worker\/layer-trigger-world@[^\"]+/wavs:worker\/layer-trigger-world@${VERSION}/g" components/*/Cargo.toml tools/component-template/Cargo.toml.tmpl
 
-# Rebuild with cargo component build in order to update bindings and Cargo.lock
-rm components/*/src/bindings.rs
+# Regenerate the bindings from the new world, then rebuild to update Cargo.lock
+./tools/bindings.sh
 make wasi-build
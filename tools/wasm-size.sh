@@ -0,0 +1,20 @@
+#!/bin/bash
+# Reports the raw and gzipped size of each compiled component.
+#
+# Usage: tools/wasm-size.sh [dir]   (default: ./compiled)
+
+set -e
+
+DIR=${1:-./compiled}
+
+if ! ls "$DIR"/*.wasm >/dev/null 2>&1; then
+    echo "No .wasm files in $DIR, run 'make wasi-build' first"
+    exit 1
+fi
+
+printf "%-40s %12s %12s\n" "component" "bytes" "gzip"
+for wasm in "$DIR"/*.wasm; do
+    raw=$(wc -c < "$wasm" | tr -d ' ')
+    gz=$(gzip -9 -c "$wasm" | wc -c | tr -d ' ')
+    printf "%-40s %12s %12s\n" "$(basename "$wasm")" "$raw" "$gz"
+done